@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"llm-proxy/internal/aider"
+	"llm-proxy/internal/client"
+)
+
+// runAider writes the model metadata and settings files Aider reads for the
+// models a running proxy serves, into --dir, and prints how to start Aider
+// against the proxy.
+func runAider(args []string) int {
+	fs := flag.NewFlagSet("aider", flag.ContinueOnError)
+	flagURL := fs.String("url", os.Getenv("LLM_PROXY_URL"), "base URL of the running proxy (default: http://127.0.0.1:8080)")
+	flagKey := fs.String("api-key", os.Getenv("LLM_PROXY_API_KEY"), "API key for a proxy with auth enabled")
+	flagDir := fs.String("dir", ".", "directory to write the files to: the repository Aider runs in, or your home directory")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	url := *flagURL
+	if url == "" {
+		url = client.LocalBaseURL(":8080")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := client.New(url)
+	c.APIKey = *flagKey
+	models, err := c.ListModels(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "list models: %v\n", err)
+		return 1
+	}
+	if len(models) == 0 {
+		fmt.Fprintln(os.Stderr, "the proxy serves no models")
+		return 1
+	}
+	metadata, err := aider.Metadata(models)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "encode metadata: %v\n", err)
+		return 1
+	}
+	settings, err := aider.Settings(models)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "encode settings: %v\n", err)
+		return 1
+	}
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{aider.MetadataFile, metadata}, {aider.SettingsFile, settings}} {
+		path := filepath.Join(*flagDir, f.name)
+		if err := os.WriteFile(path, f.data, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println("wrote", path)
+	}
+	fmt.Printf("\nexport OPENAI_API_BASE=%s/v1 OPENAI_API_KEY=%s\naider --model %s\n", c.BaseURL, keyOrPlaceholder(*flagKey), aider.ModelName(models[0].ID))
+	return 0
+}
+
+// keyOrPlaceholder keeps the key out of the printed command: Aider needs
+// one even when the proxy has auth off.
+func keyOrPlaceholder(key string) string {
+	if key != "" {
+		return "<your key>"
+	}
+	return "unused"
+}
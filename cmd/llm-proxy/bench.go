@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"llm-proxy/internal/api"
+	"llm-proxy/internal/client"
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+)
+
+// runBench fires concurrent streaming requests at a proxy and reports
+// latency, time to first token and throughput. With --mock it benchmarks an
+// in-process proxy whose backend is simulated, which measures the proxy's own
+// overhead and its scheduler without spending any quota.
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flagURL := fs.String("url", os.Getenv("LLM_PROXY_URL"), "base URL of the proxy to benchmark")
+	flagKey := fs.String("api-key", os.Getenv("LLM_PROXY_API_KEY"), "API key for a proxy with auth enabled")
+	flagModel := fs.String("model", "", "model ID to request (default with --mock: mock)")
+	flagEndpoint := fs.String("endpoint", "chat", `API to exercise: "chat" (/v1/chat/completions) or "responses" (/v1/responses)`)
+	flagPrompt := fs.String("prompt", "Reply with one short sentence.", "prompt sent with every request")
+	flagConcurrency := fs.Int("concurrency", 4, "requests in flight at once")
+	flagRequests := fs.Int("requests", 20, "total requests to send (ignored with --duration)")
+	flagDuration := fs.Duration("duration", 0, "keep sending requests for this long instead of a fixed count")
+	flagJSON := fs.Bool("json", false, "print the report as JSON")
+	flagMock := fs.Bool("mock", false, "benchmark an in-process proxy with a simulated backend instead of --url")
+	flagMockTTFT := fs.Duration("mock-ttft", 200*time.Millisecond, "simulated backend's delay before its first token")
+	flagMockTokens := fs.Int("mock-tokens", 50, "deltas the simulated backend streams per request")
+	flagMockInterval := fs.Duration("mock-interval", 10*time.Millisecond, "simulated backend's delay between deltas")
+	flagMockLimit := fs.Int("mock-concurrency-limit", 0, "upstream turns the in-process proxy runs at once (0: unlimited)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: llm-proxy bench (--url URL --model ID | --mock) [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *flagEndpoint != "chat" && *flagEndpoint != "responses" {
+		fmt.Fprintf(os.Stderr, "bench: unknown endpoint %q\n", *flagEndpoint)
+		return 2
+	}
+	if *flagConcurrency < 1 || (*flagDuration <= 0 && *flagRequests < 1) {
+		fmt.Fprintln(os.Stderr, "bench: --concurrency and --requests must be at least 1")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	baseURL, model := *flagURL, *flagModel
+	if *flagMock {
+		if model == "" {
+			model = "mock"
+		}
+		backend := &benchAdapter{
+			model:    model,
+			ttft:     *flagMockTTFT,
+			tokens:   *flagMockTokens,
+			interval: *flagMockInterval,
+		}
+		s := api.NewServer(proxy.NewRouter(backend, &benchAdapter{model: model + "-codex"}))
+		s.SetConcurrencyLimit(*flagMockLimit)
+		srv := httptest.NewServer(openapiv1.Handler(s))
+		defer srv.Close()
+		baseURL = srv.URL
+	}
+	if baseURL == "" || model == "" {
+		fs.Usage()
+		return 2
+	}
+
+	c := client.New(baseURL)
+	c.APIKey = *flagKey
+	send := func(ctx context.Context, onDelta func(string) error) error {
+		if *flagEndpoint == "responses" {
+			_, err := c.ResponsesStream(ctx, model, *flagPrompt, onDelta)
+			return err
+		}
+		_, err := c.ChatStream(ctx, model, []client.Message{{Role: "user", Content: *flagPrompt}}, onDelta)
+		return err
+	}
+
+	report := runBenchLoad(ctx, *flagConcurrency, *flagRequests, *flagDuration, send)
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "bench: interrupted; reporting the requests that finished")
+	}
+	if *flagJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "encode report: %v\n", err)
+			return 1
+		}
+	} else {
+		report.print(os.Stdout)
+	}
+	if report.Succeeded == 0 {
+		return 1
+	}
+	return 0
+}
+
+// benchReport summarizes a benchmark run. Durations are in milliseconds.
+type benchReport struct {
+	Requests    int            `json:"requests"`
+	Succeeded   int            `json:"succeeded"`
+	Failed      int            `json:"failed"`
+	Errors      map[string]int `json:"errors,omitempty"`
+	Concurrency int            `json:"concurrency"`
+	WallMs      float64        `json:"wall_ms"`
+	// RequestsPerSec and DeltasPerSec count successful requests only.
+	RequestsPerSec float64        `json:"requests_per_sec"`
+	DeltasPerSec   float64        `json:"deltas_per_sec"`
+	Latency        benchQuantiles `json:"latency_ms"`
+	TTFT           benchQuantiles `json:"ttft_ms"`
+}
+
+type benchQuantiles struct {
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+type benchResult struct {
+	latency time.Duration
+	ttft    time.Duration
+	deltas  int
+	err     error
+}
+
+// runBenchLoad runs send from concurrency workers, requests times in all or,
+// when duration is set, until it has passed.
+func runBenchLoad(ctx context.Context, concurrency, requests int, duration time.Duration, send func(context.Context, func(string) error) error) benchReport {
+	var deadline time.Time
+	if duration > 0 {
+		deadline = time.Now().Add(duration)
+	}
+	var issued atomic.Int64
+	next := func() bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		if duration > 0 {
+			return time.Now().Before(deadline)
+		}
+		return issued.Add(1) <= int64(requests)
+	}
+
+	var mu sync.Mutex
+	var results []benchResult
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for next() {
+				began := time.Now()
+				var res benchResult
+				res.err = send(ctx, func(string) error {
+					if res.deltas == 0 {
+						res.ttft = time.Since(began)
+					}
+					res.deltas++
+					return nil
+				})
+				res.latency = time.Since(began)
+				if errors.Is(res.err, context.Canceled) && ctx.Err() != nil {
+					return
+				}
+				mu.Lock()
+				results = append(results, res)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return summarizeBench(results, concurrency, time.Since(start))
+}
+
+func summarizeBench(results []benchResult, concurrency int, wall time.Duration) benchReport {
+	report := benchReport{Requests: len(results), Concurrency: concurrency, WallMs: ms(wall)}
+	var latencies, ttfts []time.Duration
+	deltas := 0
+	for _, r := range results {
+		if r.err != nil {
+			report.Failed++
+			if report.Errors == nil {
+				report.Errors = map[string]int{}
+			}
+			report.Errors[r.err.Error()]++
+			continue
+		}
+		report.Succeeded++
+		deltas += r.deltas
+		latencies = append(latencies, r.latency)
+		if r.deltas > 0 {
+			ttfts = append(ttfts, r.ttft)
+		}
+	}
+	if secs := wall.Seconds(); secs > 0 {
+		report.RequestsPerSec = float64(report.Succeeded) / secs
+		report.DeltasPerSec = float64(deltas) / secs
+	}
+	report.Latency = quantiles(latencies)
+	report.TTFT = quantiles(ttfts)
+	return report
+}
+
+func quantiles(ds []time.Duration) benchQuantiles {
+	if len(ds) == 0 {
+		return benchQuantiles{}
+	}
+	slices.Sort(ds)
+	// Nearest rank: the smallest value at or above the fraction p of samples.
+	at := func(p float64) float64 {
+		i := int(p*float64(len(ds))+0.999999) - 1
+		return ms(ds[max(0, min(i, len(ds)-1))])
+	}
+	var sum time.Duration
+	for _, d := range ds {
+		sum += d
+	}
+	return benchQuantiles{
+		P50:  at(0.50),
+		P90:  at(0.90),
+		P99:  at(0.99),
+		Max:  ms(ds[len(ds)-1]),
+		Mean: ms(sum / time.Duration(len(ds))),
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (r benchReport) print(w io.Writer) {
+	fmt.Fprintf(w, "%d requests (%d ok, %d failed) at concurrency %d in %.1fs\n", r.Requests, r.Succeeded, r.Failed, r.Concurrency, r.WallMs/1000)
+	fmt.Fprintf(w, "throughput: %.2f req/s, %.1f deltas/s\n\n", r.RequestsPerSec, r.DeltasPerSec)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\tp50\tp90\tp99\tmax\tmean\t")
+	for _, row := range []struct {
+		name string
+		q    benchQuantiles
+	}{{"latency (ms)", r.Latency}, {"ttft (ms)", r.TTFT}} {
+		fmt.Fprintf(tw, "%s\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t\n", row.name, row.q.P50, row.q.P90, row.q.P99, row.q.Max, row.q.Mean)
+	}
+	_ = tw.Flush()
+	if len(r.Errors) > 0 {
+		fmt.Fprintln(w, "\nerrors:")
+		msgs := make([]string, 0, len(r.Errors))
+		for msg := range r.Errors {
+			msgs = append(msgs, msg)
+		}
+		slices.Sort(msgs)
+		for _, msg := range msgs {
+			fmt.Fprintf(w, "  %4d  %s\n", r.Errors[msg], strings.TrimSpace(msg))
+		}
+	}
+}
+
+// benchAdapter is the simulated backend of `bench --mock`: it streams tokens
+// deltas, the first after ttft and the rest interval apart.
+type benchAdapter struct {
+	model    string
+	ttft     time.Duration
+	tokens   int
+	interval time.Duration
+}
+
+func (a *benchAdapter) SupportsModel(_ context.Context, model string) (bool, error) {
+	return model == a.model, nil
+}
+
+func (a *benchAdapter) ListModels(context.Context) ([]proxy.Model, error) {
+	return []proxy.Model{{ID: a.model, Backend: proxy.BackendClaude}}, nil
+}
+
+func (a *benchAdapter) HealthCheck(context.Context) error { return nil }
+
+func (a *benchAdapter) stream(ctx context.Context, onDelta func(string) error) (string, error) {
+	var out strings.Builder
+	wait := a.ttft
+	for i := range a.tokens {
+		select {
+		case <-ctx.Done():
+			return out.String(), ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = a.interval
+		delta := fmt.Sprintf("tok%d ", i)
+		out.WriteString(delta)
+		if onDelta != nil {
+			if err := onDelta(delta); err != nil {
+				return out.String(), err
+			}
+		}
+	}
+	return out.String(), nil
+}
+
+func (a *benchAdapter) Chat(ctx context.Context, req proxy.ChatRequest) (proxy.ChatResponse, error) {
+	text, err := a.stream(ctx, nil)
+	return proxy.ChatResponse{Model: req.Model, Text: text}, err
+}
+
+func (a *benchAdapter) ChatStream(ctx context.Context, req proxy.ChatRequest, onDelta func(string) error) (proxy.ChatResponse, error) {
+	text, err := a.stream(ctx, onDelta)
+	return proxy.ChatResponse{Model: req.Model, Text: text}, err
+}
+
+func (a *benchAdapter) Respond(ctx context.Context, req proxy.ResponsesRequest) (proxy.ResponsesResponse, error) {
+	text, err := a.stream(ctx, nil)
+	return proxy.ResponsesResponse{Model: req.Model, Text: text}, err
+}
+
+func (a *benchAdapter) RespondStream(ctx context.Context, req proxy.ResponsesRequest, onDelta func(string) error) (proxy.ResponsesResponse, error) {
+	text, err := a.stream(ctx, onDelta)
+	return proxy.ResponsesResponse{Model: req.Model, Text: text}, err
+}
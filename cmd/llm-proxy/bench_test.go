@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBenchLoadCountsRequestsAndErrors(t *testing.T) {
+	var calls atomic.Int64
+	report := runBenchLoad(t.Context(), 3, 10, 0, func(_ context.Context, onDelta func(string) error) error {
+		if calls.Add(1)%5 == 0 {
+			return errors.New("boom")
+		}
+		_ = onDelta("a")
+		_ = onDelta("b")
+		return nil
+	})
+	if report.Requests != 10 || report.Succeeded != 8 || report.Failed != 2 || report.Errors["boom"] != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.Concurrency != 3 || report.RequestsPerSec <= 0 || report.DeltasPerSec <= 0 {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestQuantilesUseNearestRank(t *testing.T) {
+	var ds []time.Duration
+	for i := 100; i >= 1; i-- {
+		ds = append(ds, time.Duration(i)*time.Millisecond)
+	}
+	q := quantiles(ds)
+	if q.P50 != 50 || q.P90 != 90 || q.P99 != 99 || q.Max != 100 || q.Mean != 50.5 {
+		t.Fatalf("quantiles = %+v", q)
+	}
+	if (quantiles(nil) != benchQuantiles{}) {
+		t.Fatal("empty samples should give zero quantiles")
+	}
+}
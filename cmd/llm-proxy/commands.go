@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"llm-proxy/internal/client"
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+)
+
+// modelRow is one model `llm-proxy models` lists.
+type modelRow struct {
+	ID      string `json:"id"`
+	Backend string `json:"backend"`
+	// Base is the model an alias or virtual model runs.
+	Base string `json:"base_model,omitempty"`
+}
+
+func runModels(args []string) int {
+	fs := flag.NewFlagSet("models", flag.ContinueOnError)
+	flagURL := fs.String("url", os.Getenv("LLM_PROXY_URL"), "base URL of a running proxy (default: embedded adapters)")
+	flagKey := fs.String("api-key", os.Getenv("LLM_PROXY_API_KEY"), "API key for a running proxy with auth enabled")
+	flagJSON := fs.Bool("json", false, "print models as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var rows []modelRow
+	if *flagURL != "" {
+		c := client.New(*flagURL)
+		c.APIKey = *flagKey
+		models, err := c.ListModels(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "list models: %v\n", err)
+			return 1
+		}
+		for _, m := range models {
+			rows = append(rows, modelRow{ID: m.ID, Backend: m.OwnedBy, Base: m.BaseModel})
+		}
+	} else {
+		router, err := embeddedRouter()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		models, err := router.ListModels(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "list models: %v\n", err)
+			return 1
+		}
+		for _, m := range models {
+			rows = append(rows, modelRow{ID: m.ID, Backend: string(m.Backend), Base: m.Base})
+		}
+	}
+
+	if err := printModels(os.Stdout, rows, *flagJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "print models: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// printModels writes rows as a table, or as JSON when asJSON is set.
+func printModels(w io.Writer, rows []modelRow, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tBACKEND\tBASE")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.ID, r.Backend, r.Base)
+	}
+	return tw.Flush()
+}
+
+func runChat(args []string) int {
+	fs := flag.NewFlagSet("chat", flag.ContinueOnError)
+	flagURL := fs.String("url", os.Getenv("LLM_PROXY_URL"), "base URL of a running proxy (default: embedded adapters)")
+	flagKey := fs.String("api-key", os.Getenv("LLM_PROXY_API_KEY"), "API key for a running proxy with auth enabled")
+	flagModel := fs.String("model", "", "model ID to use (required)")
+	flagSystem := fs.String("system", "", "optional system message")
+	flagYOLO := fs.Bool("yolo", false, "enable YOLO mode for embedded adapters")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: llm-proxy chat --model ID [flags] [prompt...]")
+		fmt.Fprintln(fs.Output(), "The prompt is read from stdin when no arguments are given or the argument is \"-\".")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *flagModel == "" {
+		fs.Usage()
+		return 2
+	}
+
+	prompt := strings.Join(fs.Args(), " ")
+	if prompt == "" || prompt == "-" {
+		raw, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read prompt: %v\n", err)
+			return 1
+		}
+		prompt = string(raw)
+	}
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		fmt.Fprintln(os.Stderr, "prompt is empty")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	onDelta := func(delta string) error {
+		_, err := io.WriteString(os.Stdout, delta)
+		return err
+	}
+
+	var err error
+	if *flagURL != "" {
+		messages := make([]client.Message, 0, 2)
+		if *flagSystem != "" {
+			messages = append(messages, client.Message{Role: "system", Content: *flagSystem})
+		}
+		messages = append(messages, client.Message{Role: "user", Content: prompt})
+		c := client.New(*flagURL)
+		c.APIKey = *flagKey
+		_, err = c.ChatStream(ctx, *flagModel, messages, onDelta)
+	} else {
+		proxy.SetYOLO(*flagYOLO || envBool("LLM_PROXY_YOLO"))
+		err = embeddedChat(ctx, *flagModel, *flagSystem, prompt, onDelta)
+	}
+	fmt.Fprintln(os.Stdout)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return 130
+		}
+		fmt.Fprintf(os.Stderr, "chat: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runReplay re-runs the adapters' event extraction over files written by
+// --debug-upstream and prints the events as JSON lines, ending with the
+// final result.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flagStream := fs.Bool("stream-output", false, "stream Codex output per delta, as chat streams do")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: llm-proxy replay [flags] dump.jsonl...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	enc := json.NewEncoder(os.Stdout)
+	status := 0
+	for _, path := range fs.Args() {
+		resp, err := proxy.ReplayDump(ctx, path, self, *flagStream, func(ev proxy.ResponseEvent) error {
+			line := map[string]any{"kind": ev.Kind, "delta": ev.Delta}
+			if ev.Tool != nil {
+				line["tool"] = map[string]any{"id": ev.Tool.ID, "name": ev.Tool.Name, "arguments": ev.Tool.Arguments}
+			}
+			return enc.Encode(line)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "replay %s: %v\n", path, err)
+			status = 1
+			continue
+		}
+		_ = enc.Encode(map[string]any{"file": path, "output": resp.Text, "reasoning": resp.Reasoning})
+	}
+	return status
+}
+
+// embeddedRouter builds the backends in-process, honouring the same config
+// file as the server.
+func embeddedRouter() (*proxy.Router, error) {
+	path, explicit := configSource("")
+	cfg, err := config.Load(path, explicit)
+	if err != nil {
+		return nil, err
+	}
+	return newRouter(cfg), nil
+}
+
+func embeddedChat(ctx context.Context, model, system, prompt string, onDelta func(string) error) error {
+	router, err := embeddedRouter()
+	if err != nil {
+		return err
+	}
+	adapter, model, err := router.Resolve(ctx, model)
+	if err != nil {
+		return err
+	}
+	messages := make([]proxy.Message, 0, 2)
+	if system != "" {
+		messages = append(messages, proxy.Message{Role: "system", Content: system})
+	}
+	messages = append(messages, proxy.Message{Role: "user", Content: prompt})
+	_, err = adapter.ChatStream(ctx, proxy.ChatRequest{
+		Model:    model,
+		Messages: messages,
+		Stream:   true,
+	}, onDelta)
+	return err
+}
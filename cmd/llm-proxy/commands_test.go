@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPrintModelsShowsAliasBases(t *testing.T) {
+	rows := []modelRow{
+		{ID: "sonnet", Backend: "claude"},
+		{ID: "reviewer", Backend: "claude", Base: "sonnet"},
+	}
+
+	var table strings.Builder
+	if err := printModels(&table, rows, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 3 || strings.Join(strings.Fields(lines[0]), " ") != "MODEL BACKEND BASE" || strings.Join(strings.Fields(lines[2]), " ") != "reviewer claude sonnet" {
+		t.Fatalf("table:\n%s", table.String())
+	}
+
+	var out strings.Builder
+	if err := printModels(&out, rows, true); err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]string
+	if err := json.Unmarshal([]byte(out.String()), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0]["base_model"] != "" || got[1]["base_model"] != "sonnet" {
+		t.Fatalf("json: %s", out.String())
+	}
+}
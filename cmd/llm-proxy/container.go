@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"os"
+
+	"llm-proxy/internal/proxy"
+)
+
+// setupContainer prepares llm-proxy to run as a container's main process:
+// log lines become JSON on stdout for the runtime to collect, and HOME is
+// filled in from the passwd entry when the image leaves it unset, so the
+// CLIs find their logins.
+func setupContainer() {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	if os.Getenv("HOME") != "" {
+		return
+	}
+	if home := proxy.UserHome(); home != "" {
+		_ = os.Setenv("HOME", home)
+		log.Printf("HOME is not set, using %s", home)
+		return
+	}
+	log.Printf("HOME is not set and the user has no home directory; set HOME (or CODEX_HOME) to where the CLIs keep their logins")
+}
+
+// isTerminal reports whether stdin and stdout are both a terminal, which the
+// TUI needs.
+func isTerminal() bool {
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		info, err := f.Stat()
+		if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func defaultPidfile() string {
+	if v := strings.TrimSpace(os.Getenv("LLM_PROXY_PIDFILE")); v != "" {
+		return v
+	}
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "llm-proxy.pid")
+}
+
+func defaultDaemonLog(pidfile string) string {
+	if v := strings.TrimSpace(os.Getenv("LLM_PROXY_LOG_FILE")); v != "" {
+		return v
+	}
+	return strings.TrimSuffix(pidfile, filepath.Ext(pidfile)) + ".log"
+}
+
+func writePidfile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+}
+
+func readPidfile(path string) (int, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pidfile %s", path)
+	}
+	return pid, nil
+}
+
+// runningPid returns the daemon pid recorded in path if that process is still
+// alive; stale pidfiles are reported as not running.
+func runningPid(path string) (int, bool) {
+	pid, err := readPidfile(path)
+	if err != nil {
+		return 0, false
+	}
+	return pid, processAlive(pid)
+}
+
+func daemonFlags(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	pidfile := fs.String("pidfile", defaultPidfile(), "path of the daemon pidfile")
+	return fs, pidfile
+}
+
+func runStart(args []string) int {
+	fs, pidfile := daemonFlags("start")
+	logFile := fs.String("log-file", "", "daemon log file (default: next to the pidfile)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: llm-proxy start [--pidfile path] [--log-file path] [-- server flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if pid, ok := runningPid(*pidfile); ok {
+		fmt.Fprintf(os.Stderr, "llm-proxy already running (pid %d)\n", pid)
+		return 1
+	}
+	if *logFile == "" {
+		*logFile = defaultDaemonLog(*pidfile)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resolve executable: %v\n", err)
+		return 1
+	}
+	if err := os.MkdirAll(filepath.Dir(*logFile), 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "create log dir: %v\n", err)
+		return 1
+	}
+	logOut, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open log file: %v\n", err)
+		return 1
+	}
+	defer logOut.Close()
+
+	_ = os.Remove(*pidfile)
+	childArgs := append([]string{"--headless", "--pidfile", *pidfile}, fs.Args()...)
+	cmd := exec.Command(exe, childArgs...)
+	cmd.Stdin = nil
+	cmd.Stdout = logOut
+	cmd.Stderr = logOut
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "start daemon: %v\n", err)
+		return 1
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	deadline := time.After(5 * time.Second)
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case err := <-exited:
+			fmt.Fprintf(os.Stderr, "daemon exited during startup (%v); see %s\n", err, *logFile)
+			return 1
+		case <-deadline:
+			fmt.Fprintf(os.Stderr, "daemon did not write %s within 5s; see %s\n", *pidfile, *logFile)
+			return 1
+		case <-tick.C:
+			if pid, ok := runningPid(*pidfile); ok {
+				fmt.Printf("llm-proxy started (pid %d, log %s)\n", pid, *logFile)
+				return 0
+			}
+		}
+	}
+}
+
+func runStop(args []string) int {
+	fs, pidfile := daemonFlags("stop")
+	timeout := fs.Duration("timeout", 10*time.Second, "how long to wait for a graceful shutdown")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	pid, ok := runningPid(*pidfile)
+	if !ok {
+		_ = os.Remove(*pidfile)
+		fmt.Println("llm-proxy is not running")
+		return 0
+	}
+	if err := terminateProcess(pid); err != nil {
+		fmt.Fprintf(os.Stderr, "stop pid %d: %v\n", pid, err)
+		return 1
+	}
+	deadline := time.Now().Add(*timeout)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			_ = os.Remove(*pidfile)
+			fmt.Printf("llm-proxy stopped (pid %d)\n", pid)
+			return 0
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	fmt.Fprintf(os.Stderr, "llm-proxy (pid %d) did not exit within %s\n", pid, *timeout)
+	return 1
+}
+
+func runStatus(args []string) int {
+	fs, pidfile := daemonFlags("status")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	pid, ok := runningPid(*pidfile)
+	if !ok {
+		fmt.Println("llm-proxy is not running")
+		return 3
+	}
+	fmt.Printf("llm-proxy is running (pid %d, pidfile %s)\n", pid, *pidfile)
+	return 0
+}
+
+func runReload(args []string) int {
+	fs, pidfile := daemonFlags("reload")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	pid, ok := runningPid(*pidfile)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "llm-proxy is not running")
+		return 1
+	}
+	if err := reloadProcess(pid); err != nil {
+		if errors.Is(err, errReloadUnsupported) {
+			fmt.Fprintln(os.Stderr, "reload is not supported on this platform; use stop/start")
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "reload pid %d: %v\n", pid, err)
+		return 1
+	}
+	fmt.Printf("reload signal sent to llm-proxy (pid %d)\n", pid)
+	return 0
+}
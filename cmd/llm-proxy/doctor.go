@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"llm-proxy/internal/proxy"
+)
+
+// doctorCheck is one line of the doctor's report.
+type doctorCheck struct {
+	Backend string `json:"backend"`
+	Check   string `json:"check"`
+	OK      bool   `json:"ok"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// runDoctor checks what the proxy needs from each backend: that its CLI is
+// installed, that it is logged in to a subscription and that it can reach
+// its API, directly or through the outbound proxy set for it. It exits 1
+// when a check fails.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	flagJSON := fs.Bool("json", false, "print the checks as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	router, err := embeddedRouter()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	checks := doctorChecks(router.InspectBinaries(ctx), router.CheckHealth(ctx), router.CheckNetwork(ctx))
+
+	if *flagJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(checks); err != nil {
+			fmt.Fprintf(os.Stderr, "encode checks: %v\n", err)
+			return 1
+		}
+	} else {
+		printDoctorChecks(os.Stdout, checks)
+	}
+	for _, c := range checks {
+		if !c.OK {
+			return 1
+		}
+	}
+	return 0
+}
+
+func doctorChecks(binaries []proxy.BinaryInfo, health []proxy.HealthStatus, network []proxy.NetworkInfo) []doctorCheck {
+	var checks []doctorCheck
+	for _, b := range binaries {
+		c := doctorCheck{Backend: string(b.Backend), Check: "cli", OK: b.Err == nil}
+		switch {
+		case b.Err != nil:
+			c.Detail = b.Err.Error()
+		case b.Warning != "":
+			c.Detail = fmt.Sprintf("%s (%s): warning: %s", b.Path, b.Version, b.Warning)
+		default:
+			c.Detail = fmt.Sprintf("%s (%s)", b.Path, b.Version)
+		}
+		checks = append(checks, c)
+	}
+	for _, st := range health {
+		c := doctorCheck{Backend: string(st.Backend), Check: "health", OK: st.Err == nil}
+		if st.Err != nil {
+			c.Detail = st.Err.Error()
+		}
+		checks = append(checks, c)
+	}
+	for _, n := range network {
+		route := "direct"
+		if n.Proxy != "" {
+			route = fmt.Sprintf("via %s (%s)", n.Proxy, n.ProxyEnv)
+		}
+		c := doctorCheck{Backend: string(n.Backend), Check: "network", OK: n.Err == nil, Detail: n.Endpoint + " " + route}
+		if n.Err != nil {
+			c.Detail += ": " + n.Err.Error()
+		} else {
+			c.Detail += fmt.Sprintf(", answered in %dms", n.Latency.Milliseconds())
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+func printDoctorChecks(w io.Writer, checks []doctorCheck) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BACKEND\tCHECK\tSTATUS\tDETAIL")
+	for _, c := range checks {
+		status := "ok"
+		if !c.OK {
+			status = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Backend, c.Check, status, c.Detail)
+	}
+	_ = tw.Flush()
+}
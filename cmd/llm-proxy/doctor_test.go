@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/proxy"
+)
+
+func TestDoctorChecksReportEachBackend(t *testing.T) {
+	checks := doctorChecks(
+		[]proxy.BinaryInfo{{Backend: proxy.BackendClaude, Path: "/usr/bin/claude", Version: "2.0.14"}, {Backend: proxy.BackendCodex, Err: errors.New("codex: not found")}},
+		[]proxy.HealthStatus{{Backend: proxy.BackendClaude}},
+		[]proxy.NetworkInfo{
+			{Backend: proxy.BackendClaude, Endpoint: "https://api.anthropic.com", Proxy: "http://proxy:3128", ProxyEnv: "HTTPS_PROXY", Latency: 120 * time.Millisecond},
+			{Backend: proxy.BackendCodex, Endpoint: "https://chatgpt.com", Err: errors.New("dial tcp: i/o timeout")},
+		},
+	)
+	want := []doctorCheck{
+		{"claude", "cli", true, "/usr/bin/claude (2.0.14)"},
+		{"codex", "cli", false, "codex: not found"},
+		{"claude", "health", true, ""},
+		{"claude", "network", true, "https://api.anthropic.com via http://proxy:3128 (HTTPS_PROXY), answered in 120ms"},
+		{"codex", "network", false, "https://chatgpt.com direct: dial tcp: i/o timeout"},
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("checks = %+v", checks)
+	}
+	for i := range want {
+		if checks[i] != want[i] {
+			t.Errorf("check %d = %+v, want %+v", i, checks[i], want[i])
+		}
+	}
+
+	var out strings.Builder
+	printDoctorChecks(&out, checks)
+	if !strings.Contains(out.String(), "codex    network  FAIL") {
+		t.Fatalf("report:\n%s", out.String())
+	}
+}
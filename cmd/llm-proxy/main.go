@@ -2,26 +2,73 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"flag"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"llm-proxy/internal/api"
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/logfile"
 	"llm-proxy/internal/openapiv1"
 	"llm-proxy/internal/proxy"
+	"llm-proxy/internal/store"
+	"llm-proxy/internal/tokenizer"
 	"llm-proxy/internal/tui"
 )
 
 func main() {
+	if path := os.Getenv(proxy.ReplayEnv); path != "" {
+		// Started by `llm-proxy replay` in place of a backend CLI.
+		os.Exit(proxy.ServeReplay(path, os.Stdin, os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "models":
+			os.Exit(runModels(os.Args[2:]))
+		case "chat":
+			os.Exit(runChat(os.Args[2:]))
+		case "start":
+			os.Exit(runStart(os.Args[2:]))
+		case "stop":
+			os.Exit(runStop(os.Args[2:]))
+		case "status":
+			os.Exit(runStatus(os.Args[2:]))
+		case "reload":
+			os.Exit(runReload(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		case "bench":
+			os.Exit(runBench(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctor(os.Args[2:]))
+		case "aider":
+			os.Exit(runAider(os.Args[2:]))
+		}
+	}
+	serve()
+}
+
+func serve() {
 	var (
-		flagAddr     = flag.String("addr", "", "listen address (overrides ADDR env)")
-		flagHeadless = flag.Bool("headless", false, "run without terminal UI")
-		flagYOLO     = flag.Bool("yolo", false, "enable YOLO mode (disable CLI permission prompts)")
+		flagAddr      = flag.String("addr", "", "listen address (overrides ADDR env)")
+		flagHeadless  = flag.Bool("headless", false, "run without terminal UI")
+		flagYOLO      = flag.Bool("yolo", false, "enable YOLO mode (disable CLI permission prompts)")
+		flagPidfile   = flag.String("pidfile", "", "write the process id to this file while running")
+		flagConfig    = flag.String("config", "", "path to JSON config file (overrides LLM_PROXY_CONFIG)")
+		flagDebug     = flag.Bool("debug", false, "include backend CLI stderr in upstream error responses")
+		flagWarmup    = flag.Bool("warmup", false, "warm up both backends at startup so the first request avoids the cold start")
+		flagDumpDir   = flag.String("debug-upstream", "", "dump the raw CLI traffic of every request to files in this directory (see `llm-proxy replay`)")
+		flagContainer = flag.Bool("container", false, "run as a container's main process: headless, JSON logs on stdout")
 	)
 	flag.Parse()
 
@@ -32,34 +79,199 @@ func main() {
 	if *flagAddr != "" {
 		addr = *flagAddr
 	}
-	headless := *flagHeadless || os.Getenv("LLM_PROXY_HEADLESS") == "1"
+	container := *flagContainer || envBool("LLM_PROXY_CONTAINER")
+	if container {
+		setupContainer()
+	}
+	headless := *flagHeadless || os.Getenv("LLM_PROXY_HEADLESS") == "1" || container
+	if !headless && !isTerminal() {
+		log.Printf("no terminal attached, running headless")
+		headless = true
+	}
 	yolo := *flagYOLO || envBool("LLM_PROXY_YOLO")
 	proxy.SetYOLO(yolo)
+	dumpDir := *flagDumpDir
+	if dumpDir == "" {
+		dumpDir = os.Getenv("LLM_PROXY_DEBUG_UPSTREAM")
+	}
+	proxy.SetUpstreamDumpDir(dumpDir)
 
-	router := proxy.NewRouter(proxy.NewClaudeAdapter(), proxy.NewCodexAdapter())
-	apiServer := api.NewServer(router)
+	if *flagPidfile != "" {
+		if err := writePidfile(*flagPidfile); err != nil {
+			log.Fatalf("write pidfile: %v", err)
+		}
+		defer os.Remove(*flagPidfile)
+	}
+
+	configPath, configExplicit := configSource(*flagConfig)
+	cfg, err := config.Load(configPath, configExplicit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	proxy.SetUpstreamDumpLimits(upstreamDumpLimits(cfg))
+	proxy.SetProcessLimits(processLimits(cfg))
+	recoverProcesses()
+	proxy.SetBinSearchDirs(cfg.Discovery.SearchDirs)
+
+	// The TUI playground goes through the real HTTP path, so it gets its own
+	// key whenever auth is enabled.
+	tuiKey := ""
+	if !headless {
+		tuiKey = randomToken()
+	}
+	auth := api.NewAuthenticator(authKeys(cfg, tuiKey))
 	metrics := api.NewMetrics()
+	metrics.SetPricing(cfg.Pricing)
+	if cfg.AccessLog != nil {
+		w, err := openAccessLog(cfg.AccessLog)
+		if err != nil {
+			log.Fatalf("access log: %v", err)
+		}
+		defer w.Close()
+		metrics.SetAccessLog(api.NewAccessLogger(w, cfg.AccessLog.Format))
+	}
 
-	handler := openapiv1.HandlerFromMux(apiServer, http.NewServeMux())
-	handler = metrics.Middleware(handler)
+	var pinStore proxy.PinStore
+	router := newRouter(cfg)
+	apiServer := api.NewServer(router)
+	apiServer.SetMetrics(metrics)
+	if cfg.Store != nil {
+		st, err := store.Open(cfg.Store.Path, time.Duration(cfg.Store.TTL))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer st.Close()
+		pinStore = st
+		router.SetPinStore(st)
+		apiServer.SetStore(st)
+	}
+	apiServer.SetDebug(*flagDebug || envBool("LLM_PROXY_DEBUG"))
+	apiServer.SetHistoryPolicy(historyPolicy(cfg))
+	apiServer.SetConcurrencyLimit(cfg.Limits.MaxConcurrent)
+	apiServer.SetCoalesceIdentical(cfg.Limits.CoalesceIdentical)
+	apiServer.SetPartialOnFailure(cfg.Streaming.PartialOnFailure)
+	apiServer.SetOutputFilters(outputFilters(cfg))
+	apiServer.SetStreamCompat(cfg.Streaming.Compat, time.Duration(cfg.Streaming.DoneWithin))
+	apiServer.SetMaxStreamDuration(time.Duration(cfg.Streaming.MaxDuration))
+	apiServer.SetUserRateLimit(cfg.Limits.UserRequestsPerMinute)
+	apiServer.SetRequestBudget(cfg.Limits, cfg.Pricing)
+	apiServer.SetLoopLimits(cfg.Limits.LoopRepeats, cfg.Limits.LoopToolCalls)
+	apiServer.SetQuietHours(cfg.QuietHours)
+	apiServer.SetDeprecatedModels(cfg.DeprecatedModels)
+	apiServer.SetBestOfN(cfg.BestOfN)
+	apiServer.SetShadow(cfg.Shadow)
+	tokenizers, err := tokenizer.Load(cfg.Tokenizers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	apiServer.SetTokenizers(tokenizers)
+	apiServer.SetContextWindows(cfg.ContextWindows)
+	apiServer.SetWebhookSecret(cfg.Webhooks.SigningSecret())
+	apiServer.SetWebhookAllowHosts(cfg.Webhooks.AllowHosts)
+	profiles := newProfileRouters(cfg, pinStore)
+	apiServer.SetProfiles(profiles)
+	stopProfileHealth := pollProfileHealth(profiles)
+	reloadCh := make(chan os.Signal, 1)
+	notifyReload(reloadCh)
+	go func() {
+		for range reloadCh {
+			newCfg, err := config.Load(configPath, configExplicit)
+			if err != nil {
+				log.Printf("reload failed, keeping previous config: %v", err)
+				continue
+			}
+			auth.SetKeys(authKeys(newCfg, tuiKey))
+			metrics.SetPricing(newCfg.Pricing)
+			proxy.SetUpstreamDumpLimits(upstreamDumpLimits(newCfg))
+			proxy.SetProcessLimits(processLimits(newCfg))
+			proxy.SetBinSearchDirs(newCfg.Discovery.SearchDirs)
+			router.SetAdapters(newAdapters(newCfg))
+			router.SetRaces(newCfg.Races)
+			router.SetVirtualModels(virtualModels(newCfg))
+			router.SetPipelines(pipelines(newCfg))
+			router.SetAutoPolicy(autoPolicy(newCfg))
+			go router.PrefetchModels(context.Background())
+			apiServer.SetHistoryPolicy(historyPolicy(newCfg))
+			apiServer.SetConcurrencyLimit(newCfg.Limits.MaxConcurrent)
+			apiServer.SetCoalesceIdentical(newCfg.Limits.CoalesceIdentical)
+			apiServer.SetPartialOnFailure(newCfg.Streaming.PartialOnFailure)
+			apiServer.SetOutputFilters(outputFilters(newCfg))
+			apiServer.SetStreamCompat(newCfg.Streaming.Compat, time.Duration(newCfg.Streaming.DoneWithin))
+			apiServer.SetMaxStreamDuration(time.Duration(newCfg.Streaming.MaxDuration))
+			apiServer.SetUserRateLimit(newCfg.Limits.UserRequestsPerMinute)
+			apiServer.SetRequestBudget(newCfg.Limits, newCfg.Pricing)
+			apiServer.SetLoopLimits(newCfg.Limits.LoopRepeats, newCfg.Limits.LoopToolCalls)
+			apiServer.SetQuietHours(newCfg.QuietHours)
+			apiServer.SetDeprecatedModels(newCfg.DeprecatedModels)
+			apiServer.SetBestOfN(newCfg.BestOfN)
+			apiServer.SetShadow(newCfg.Shadow)
+			if tokenizers, err := tokenizer.Load(newCfg.Tokenizers); err != nil {
+				log.Printf("reload: keeping previous tokenizers: %v", err)
+			} else {
+				apiServer.SetTokenizers(tokenizers)
+			}
+			apiServer.SetContextWindows(newCfg.ContextWindows)
+			apiServer.SetWebhookSecret(newCfg.Webhooks.SigningSecret())
+			apiServer.SetWebhookAllowHosts(newCfg.Webhooks.AllowHosts)
+			profiles := newProfileRouters(newCfg, pinStore)
+			apiServer.SetProfiles(profiles)
+			stopProfileHealth()
+			stopProfileHealth = pollProfileHealth(profiles)
+			log.Printf("reloaded config and backend adapters")
+			api.RecordAudit(api.AuditEntry{Source: api.AuditSourceReload, Setting: "config", To: configPath})
+		}
+	}()
 
-	httpServer := &http.Server{
-		Addr:    addr,
-		Handler: handler,
+	ln, activated, err := listen(addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if activated {
+		addr = ln.Addr().String()
 	}
+
+	mux := http.NewServeMux()
+	apiServer.RegisterAdminRoutes(mux)
+	metrics.RegisterAdminRoutes(mux)
+	api.NewDashboard(metrics, addr, auth.Enabled).RegisterRoutes(mux)
+	api.RegisterDocsRoutes(mux)
+	api.RegisterUnknownRoutes(mux)
+	handler := openapiv1.HandlerFromMux(apiServer, mux)
+	handler = apiServer.NoRedirects(handler)
+	handler = auth.Middleware(handler)
+	handler = metrics.Middleware(handler)
+
+	httpServer := newHTTPServer(cfg.Server, addr, handler)
 	errCh := make(chan error, 1)
 	go func() {
-		err := httpServer.ListenAndServe()
+		err := httpServer.Serve(ln)
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			errCh <- err
 		}
 		close(errCh)
 	}()
 
-	log.Printf("llm-proxy listening on %s", addr)
+	if activated {
+		log.Printf("llm-proxy listening on %s (systemd socket activation)", addr)
+	} else {
+		log.Printf("llm-proxy listening on %s", addr)
+	}
 	if yolo {
 		log.Printf("YOLO mode enabled")
 	}
+	if auth.Enabled() {
+		log.Printf("API key auth enabled")
+	}
+	if *flagWarmup || envBool("LLM_PROXY_WARMUP") {
+		go warmup(router, metrics, headless)
+	} else {
+		go router.PrefetchModels(context.Background())
+	}
+	if !cfg.Discovery.SkipVersionCheck {
+		go inspectBinaries(router)
+	}
+	go pollQuotas(router, metrics)
+	go pollHealth(router, metrics.ObserveHealth, nil)
 
 	if headless {
 		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -76,10 +288,14 @@ func main() {
 		if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Printf("shutdown error: %v", err)
 		}
+		stopProcesses()
 		return
 	}
 
-	app := tui.New(addr, metrics, httpServer, errCh)
+	if !auth.Enabled() {
+		tuiKey = ""
+	}
+	app := tui.New(addr, tuiKey, metrics, apiServer.Replay, httpServer, errCh)
 	runErr := app.Run()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -88,12 +304,348 @@ func main() {
 	if shutdownErr != nil {
 		log.Printf("shutdown error: %v", shutdownErr)
 	}
+	stopProcesses()
 
 	if runErr != nil {
 		log.Fatal(runErr)
 	}
 }
 
+// configSource resolves the config file path. A path given by flag or
+// LLM_PROXY_CONFIG is explicit and must exist.
+func configSource(flagPath string) (string, bool) {
+	if flagPath != "" {
+		return flagPath, true
+	}
+	return config.DefaultPath(), os.Getenv("LLM_PROXY_CONFIG") != ""
+}
+
+// Server defaults guard against slow or idle clients holding connections; the
+// write timeout stays off so long streams are not cut.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+)
+
+func newHTTPServer(cfg config.Server, addr string, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: durationOr(cfg.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.WriteTimeout),
+		IdleTimeout:       durationOr(cfg.IdleTimeout, defaultIdleTimeout),
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	if cfg.H2C {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return srv
+}
+
+func durationOr(d config.Duration, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return time.Duration(d)
+	}
+	return fallback
+}
+
+// warmupTimeout bounds the startup warm-up; a backend stuck longer is left
+// to the first real request.
+const warmupTimeout = 2 * time.Minute
+
+// openAccessLog opens the configured access log; "-" is stdout, meant for
+// headless runs.
+func openAccessLog(cfg *config.AccessLog) (io.WriteCloser, error) {
+	if cfg.Path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return logfile.Open(cfg.Path, logfile.Options{
+		MaxSize:      int64(cfg.MaxSizeMB) << 20,
+		Interval:     time.Duration(cfg.RotateEvery),
+		MaxBackups:   cfg.MaxBackups,
+		MaxAge:       time.Duration(cfg.MaxAge),
+		MaxTotalSize: int64(cfg.MaxTotalMB) << 20,
+	})
+}
+
+func upstreamDumpLimits(cfg *config.Config) logfile.Limits {
+	return logfile.Limits{
+		MaxAge:       time.Duration(cfg.UpstreamDumps.MaxAge),
+		MaxFiles:     cfg.UpstreamDumps.MaxFiles,
+		MaxTotalSize: int64(cfg.UpstreamDumps.MaxTotalMB) << 20,
+	}
+}
+
+// recoverProcesses kills the CLIs a crashed proxy left running, then has
+// this one record its own.
+func recoverProcesses() {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		log.Printf("process janitor: %v", err)
+		return
+	}
+	dir := filepath.Join(cache, "llm-proxy", "processes")
+	if n, err := proxy.RecoverProcesses(dir); err != nil {
+		log.Printf("process janitor: %v", err)
+	} else if n > 0 {
+		log.Printf("process janitor: killed %d CLI processes left by a previous run", n)
+	}
+	if err := proxy.SetProcessDir(dir); err != nil {
+		log.Printf("process janitor: %v", err)
+	}
+}
+
+// stopProcesses kills the CLIs still running at shutdown.
+func stopProcesses() {
+	if n := proxy.KillProcesses(); n > 0 {
+		log.Printf("stopped %d CLI processes", n)
+	}
+}
+
+func outputFilters(cfg *config.Config) proxy.OutputFilters {
+	f := cfg.Streaming.OutputFilters
+	return proxy.OutputFilters{StripANSI: f.StripANSI, StripPreamble: f.StripPreamble, CodeFences: f.CodeFences}
+}
+
+func processLimits(cfg *config.Config) proxy.ProcessLimits {
+	p := cfg.ProcessLimits
+	if p != (config.ProcessLimits{}) && !proxy.ProcessLimitsSupported {
+		log.Printf("process_limits: only enforced on Linux, ignoring")
+	}
+	return proxy.ProcessLimits{
+		MemoryBytes: uint64(p.MaxMemoryMB) << 20,
+		CPUTime:     time.Duration(p.MaxCPUTime),
+		OpenFiles:   uint64(p.MaxOpenFiles),
+	}
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func warmup(router *proxy.Router, metrics *api.Metrics, logProgress bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), warmupTimeout)
+	defer cancel()
+	router.Warmup(ctx, func(st proxy.WarmupStatus) {
+		metrics.ObserveWarmup(st)
+		if !logProgress {
+			return
+		}
+		switch st.State {
+		case proxy.WarmupReady:
+			log.Printf("warm-up: %s ready in %s", st.Backend, st.Duration.Round(time.Millisecond))
+		case proxy.WarmupFailed:
+			log.Printf("warm-up: %s failed: %v", st.Backend, st.Err)
+		}
+	})
+}
+
+const (
+	// quotaPollInterval is how often the backends' subscription usage is
+	// refreshed for the TUI and dashboard, for backends that had traffic
+	// lately.
+	quotaPollInterval = 5 * time.Minute
+	quotaPollTimeout  = time.Minute
+
+	// healthPollInterval is how often the backends are probed; a backend
+	// failing two probes in a row stops taking requests until one passes.
+	healthPollInterval = time.Minute
+	healthPollTimeout  = 30 * time.Second
+)
+
+// inspectBinaries logs where each CLI was found and warns about versions
+// the adapters only partly support.
+func inspectBinaries(router *proxy.Router) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthPollTimeout)
+	defer cancel()
+	for _, b := range router.InspectBinaries(ctx) {
+		switch {
+		case b.Err != nil:
+			log.Printf("%s CLI: %v", b.Backend, b.Err)
+		case b.Warning != "":
+			log.Printf("%s CLI %s (%s): warning: %s", b.Backend, b.Path, b.Version, b.Warning)
+		default:
+			log.Printf("%s CLI %s (%s)", b.Backend, b.Path, b.Version)
+		}
+	}
+}
+
+// pollHealth probes router's backends every healthPollInterval until stop
+// is closed, passing each round's results to observe when it is set.
+func pollHealth(router *proxy.Router, observe func([]proxy.HealthStatus), stop <-chan struct{}) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), healthPollTimeout)
+		statuses := router.CheckHealth(ctx)
+		cancel()
+		if observe != nil {
+			observe(statuses)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(healthPollInterval):
+		}
+	}
+}
+
+// pollProfileHealth probes the backends of each profile's router, as
+// pollHealth does the default router's, until the returned func is called.
+// The dashboard shows only the default router's health.
+func pollProfileHealth(routers map[string]*proxy.Router) (stop func()) {
+	done := make(chan struct{})
+	for _, router := range routers {
+		go pollHealth(router, nil, done)
+	}
+	return func() { close(done) }
+}
+
+func pollQuotas(router *proxy.Router, metrics *api.Metrics) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), quotaPollTimeout)
+		metrics.ObserveQuotas(router.PollQuotas(ctx))
+		cancel()
+		time.Sleep(quotaPollInterval)
+	}
+}
+
+func newRouter(cfg *config.Config) *proxy.Router {
+	router := proxy.NewRouter(newAdapters(cfg))
+	router.SetRaces(cfg.Races)
+	router.SetVirtualModels(virtualModels(cfg))
+	router.SetPipelines(pipelines(cfg))
+	router.SetAutoPolicy(autoPolicy(cfg))
+	return router
+}
+
+// newProfileRouters builds one router per configured profile.
+func newProfileRouters(cfg *config.Config, pinStore proxy.PinStore) map[string]*proxy.Router {
+	out := make(map[string]*proxy.Router, len(cfg.Profiles))
+	for name, p := range cfg.Profiles {
+		out[name] = proxy.NewRouter(newProfileAdapters(cfg, p))
+		out[name].SetRaces(cfg.Races)
+		out[name].SetVirtualModels(virtualModels(cfg))
+		out[name].SetPipelines(pipelines(cfg))
+		out[name].SetAutoPolicy(autoPolicy(cfg))
+		if pinStore != nil {
+			out[name].SetPinStore(pinStore)
+		}
+	}
+	return out
+}
+
+func newAdapters(cfg *config.Config) (proxy.Adapter, proxy.Adapter) {
+	return newProfileAdapters(cfg, config.Profile{})
+}
+
+func newProfileAdapters(cfg *config.Config, profile config.Profile) (proxy.Adapter, proxy.Adapter) {
+	env := profile.Environ()
+	permissions := proxy.PermissionPolicy{OnPrompt: cfg.Permissions.OnPrompt, StallTimeout: time.Duration(cfg.Permissions.StallTimeout)}
+	claudeOpts := proxy.ClaudeOptions{Bin: profile.ClaudeBin, Env: append(cfg.Claude.Environ(), env...), Args: cfg.Claude.Args, TextFallback: cfg.Claude.TextFallback, MaxTurns: cfg.Claude.MaxTurns, Permissions: permissions}
+	if len(cfg.Claude.Models) > 0 {
+		claudeOpts.Models = make(map[string]proxy.ClaudeModelOptions, len(cfg.Claude.Models))
+		for model, m := range cfg.Claude.Models {
+			claudeOpts.Models[model] = proxy.ClaudeModelOptions{
+				Base:               m.Model,
+				Args:               m.Args,
+				SystemPrompt:       m.SystemPrompt,
+				AppendSystemPrompt: m.AppendSystemPrompt,
+				Agents:             m.AgentsJSON(),
+				MaxTurns:           m.MaxTurns,
+			}
+		}
+	}
+	codexOpts := proxy.CodexOptions{CodexTurnOptions: codexTurnOptions(cfg.Codex.CodexTurn), Bin: profile.CodexBin, Env: append(cfg.Codex.Environ(), env...), KeepThreads: cfg.Codex.KeepThreads, Permissions: permissions}
+	if len(cfg.Codex.Models) > 0 {
+		codexOpts.Models = make(map[string]proxy.CodexTurnOptions, len(cfg.Codex.Models))
+		for model, t := range cfg.Codex.Models {
+			codexOpts.Models[model] = codexTurnOptions(t)
+		}
+	}
+	return proxy.NewClaudeAdapterWithOptions(claudeOpts), proxy.NewCodexAdapterWithOptions(codexOpts)
+}
+
+func autoPolicy(cfg *config.Config) *proxy.AutoPolicy {
+	if cfg.Auto == nil {
+		return nil
+	}
+	p := &proxy.AutoPolicy{Default: cfg.Auto.Default}
+	for _, r := range cfg.Auto.Rules {
+		p.Rules = append(p.Rules, proxy.AutoRule{
+			Model:    r.Model,
+			MinChars: r.MinChars,
+			MaxChars: r.MaxChars,
+			Keywords: r.Keywords,
+			Efforts:  r.Efforts,
+		})
+	}
+	return p
+}
+
+func virtualModels(cfg *config.Config) map[string]proxy.VirtualModel {
+	if len(cfg.VirtualModels) == 0 {
+		return nil
+	}
+	out := make(map[string]proxy.VirtualModel, len(cfg.VirtualModels))
+	for id, m := range cfg.VirtualModels {
+		out[id] = proxy.VirtualModel{Base: m.Model, SystemPrompt: m.SystemPrompt, MaxTokens: m.MaxTokens}
+	}
+	return out
+}
+
+func pipelines(cfg *config.Config) map[string][]proxy.PipelineStep {
+	if len(cfg.Pipelines) == 0 {
+		return nil
+	}
+	out := make(map[string][]proxy.PipelineStep, len(cfg.Pipelines))
+	for id, steps := range cfg.Pipelines {
+		for _, step := range steps {
+			out[id] = append(out[id], proxy.PipelineStep{Model: step.Model, Prompt: step.Prompt})
+		}
+	}
+	return out
+}
+
+func historyPolicy(cfg *config.Config) proxy.HistoryPolicy {
+	return proxy.HistoryPolicy{
+		MaxMessages:  cfg.History.MaxMessages,
+		MaxChars:     cfg.History.MaxChars,
+		SummaryModel: cfg.History.SummaryModel,
+	}
+}
+
+func codexTurnOptions(t config.CodexTurn) proxy.CodexTurnOptions {
+	return proxy.CodexTurnOptions{
+		Sandbox:        t.Sandbox,
+		ApprovalPolicy: t.ApprovalPolicy,
+		Cwd:            t.Cwd,
+		Effort:         t.Effort,
+		WebSearch:      t.WebSearch,
+		MaxTurns:       t.MaxTurns,
+	}
+}
+
+func authKeys(cfg *config.Config, tuiKey string) []config.APIKey {
+	keys := append([]config.APIKey(nil), cfg.Auth.Keys...)
+	if static := strings.TrimSpace(os.Getenv("LLM_PROXY_API_KEY")); static != "" {
+		keys = append(keys, config.APIKey{Name: "static", Key: static, Scopes: []string{config.ScopeAll}})
+	}
+	if len(keys) > 0 && tuiKey != "" {
+		keys = append(keys, config.APIKey{Name: "tui", Key: tuiKey, Scopes: []string{config.ScopeModels, config.ScopeChat, config.ScopeResponses}})
+	}
+	return keys
+}
+
+func randomToken() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "sk-llmproxy-" + hex.EncodeToString(b)
+}
+
 func envBool(key string) bool {
 	v := os.Getenv(key)
 	switch v {
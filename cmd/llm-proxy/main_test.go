@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/proxy"
+)
+
+// probedAdapter passes every health check; nothing else of it is used.
+type probedAdapter struct {
+	proxy.Adapter
+}
+
+func (probedAdapter) HealthCheck(context.Context) error { return nil }
+
+func TestProfileRoutersAreProbedUntilStopped(t *testing.T) {
+	router := proxy.NewRouter(probedAdapter{}, probedAdapter{})
+	stop := pollProfileHealth(map[string]*proxy.Router{"work": router})
+	defer stop()
+
+	probed := func() bool {
+		for _, st := range router.Health() {
+			if st.CheckedAt.IsZero() || !st.Healthy() {
+				return false
+			}
+		}
+		return true
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !probed() {
+		if time.Now().After(deadline) {
+			t.Fatalf("the profile's backends were not probed: %+v", router.Health())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/config"
+)
+
+func TestHTTPServerServesH2CWhenEnabled(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	srv := newHTTPServer(config.Server{H2C: true}, ln.Addr().String(), handler)
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	if srv.ReadHeaderTimeout != defaultReadHeaderTimeout || srv.IdleTimeout != defaultIdleTimeout || srv.WriteTimeout != 0 {
+		t.Fatalf("unexpected default timeouts: %v %v %v", srv.ReadHeaderTimeout, srv.IdleTimeout, srv.WriteTimeout)
+	}
+
+	for _, tc := range []struct {
+		h2   bool
+		want string
+	}{{false, "HTTP/1.1"}, {true, "HTTP/2.0"}} {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(!tc.h2)
+		protocols.SetUnencryptedHTTP2(tc.h2)
+		client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{Protocols: protocols}}
+		resp, err := client.Get("http://" + ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.Proto != tc.want {
+			t.Fatalf("got %s, want %s", resp.Proto, tc.want)
+		}
+	}
+}
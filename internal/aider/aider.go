@@ -0,0 +1,74 @@
+// Package aider builds the model files Aider reads, so it treats the models
+// the proxy serves as models it knows: the metadata file, in LiteLLM's
+// format, gives their context windows and costs, and the settings file the
+// edit format and options that suit the CLIs behind the proxy. Aider looks
+// for both in the home directory, the repository root and the current
+// directory.
+package aider
+
+import (
+	"encoding/json"
+
+	"gopkg.in/yaml.v3"
+
+	"llm-proxy/internal/client"
+)
+
+const (
+	MetadataFile = ".aider.model.metadata.json"
+	SettingsFile = ".aider.model.settings.yml"
+)
+
+// ModelName is the name Aider knows a proxy model by: LiteLLM's prefix for
+// an OpenAI-compatible API, then the model ID.
+func ModelName(id string) string {
+	return "openai/" + id
+}
+
+type metadata struct {
+	MaxInputTokens     int     `json:"max_input_tokens,omitempty"`
+	InputCostPerToken  float64 `json:"input_cost_per_token"`
+	OutputCostPerToken float64 `json:"output_cost_per_token"`
+	LiteLLMProvider    string  `json:"litellm_provider"`
+	Mode               string  `json:"mode"`
+}
+
+// Metadata returns the metadata file for models. Costs are zero: the
+// subscriptions behind the proxy are not billed per token.
+func Metadata(models []client.Model) ([]byte, error) {
+	out := make(map[string]metadata, len(models))
+	for _, m := range models {
+		out[ModelName(m.ID)] = metadata{
+			MaxInputTokens:  m.ContextWindow,
+			LiteLLMProvider: "openai",
+			Mode:            "chat",
+		}
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+type settings struct {
+	Name           string `yaml:"name"`
+	EditFormat     string `yaml:"edit_format"`
+	UseRepoMap     bool   `yaml:"use_repo_map"`
+	UseTemperature bool   `yaml:"use_temperature"`
+	Streaming      bool   `yaml:"streaming"`
+}
+
+// Settings returns the settings file for models. They all get the diff
+// edit format, search and replace blocks, which the models behind the proxy
+// follow well, where Aider's default for a model it does not know, whole,
+// has them send back every file they change. Temperature is off since the
+// CLIs take none.
+func Settings(models []client.Model) ([]byte, error) {
+	out := make([]settings, 0, len(models))
+	for _, m := range models {
+		out = append(out, settings{
+			Name:       ModelName(m.ID),
+			EditFormat: "diff",
+			UseRepoMap: true,
+			Streaming:  true,
+		})
+	}
+	return yaml.Marshal(out)
+}
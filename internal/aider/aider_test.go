@@ -0,0 +1,41 @@
+package aider
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"llm-proxy/internal/client"
+)
+
+func TestModelFiles(t *testing.T) {
+	models := []client.Model{{ID: "sonnet", OwnedBy: "claude", ContextWindow: 200000}, {ID: "gpt-5", OwnedBy: "codex"}}
+
+	raw, err := Metadata(models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta map[string]map[string]any
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if m := meta["openai/sonnet"]; m["max_input_tokens"] != 200000.0 || m["litellm_provider"] != "openai" || m["mode"] != "chat" || m["input_cost_per_token"] != 0.0 {
+		t.Fatalf("sonnet metadata = %v", m)
+	}
+	if _, ok := meta["openai/gpt-5"]["max_input_tokens"]; ok || len(meta) != 2 {
+		t.Fatalf("metadata = %s", raw)
+	}
+
+	raw, err = Settings(models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]any
+	if err := yaml.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1]["name"] != "openai/gpt-5" || got[1]["edit_format"] != "diff" || got[1]["use_temperature"] != false || got[1]["use_repo_map"] != true {
+		t.Fatalf("settings = %s", raw)
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access log formats.
+const (
+	AccessLogCombined = "combined"
+	AccessLogJSON     = "json"
+)
+
+// AccessLogger writes one line per request, either in Apache's combined
+// format with llm-proxy's fields appended or as a JSON object.
+type AccessLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+}
+
+func NewAccessLogger(w io.Writer, format string) *AccessLogger {
+	if format == "" {
+		format = AccessLogCombined
+	}
+	return &AccessLogger{w: w, format: format}
+}
+
+// SetAccessLog makes the middleware write every request it records to l.
+func (m *Metrics) SetAccessLog(l *AccessLogger) {
+	m.accessLog.Store(l)
+}
+
+type accessLogLine struct {
+	Time      time.Time `json:"time"`
+	Remote    string    `json:"remote"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     uint64    `json:"bytes"`
+	LatencyMs float64   `json:"latency_ms"`
+	Model     string    `json:"model,omitempty"`
+	Key       string    `json:"key,omitempty"`
+	KeyHash   string    `json:"key_hash,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	// Timings is only in the JSON format.
+	Timings *RequestTimings `json:"timings,omitempty"`
+}
+
+func (l *AccessLogger) log(r *http.Request, e RequestLogEntry) {
+	if l == nil {
+		return
+	}
+	line := accessLogLine{
+		Time:      e.Time,
+		Remote:    remoteHost(r),
+		Method:    r.Method,
+		Path:      r.URL.RequestURI(),
+		Proto:     r.Proto,
+		Status:    e.Status,
+		Bytes:     e.BytesSent,
+		LatencyMs: e.LatencyMs,
+		Model:     e.Model,
+		Key:       e.Key,
+		KeyHash:   keyHash(requestToken(r)),
+		User:      e.User,
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+		Tags:      e.Tags,
+		Timings:   e.Timings,
+	}
+	var b []byte
+	if l.format == AccessLogJSON {
+		b, _ = json.Marshal(line)
+		b = append(b, '\n')
+	} else {
+		b = line.combined()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(b); err != nil {
+		log.Printf("access log: %v", err)
+	}
+}
+
+// combined renders the line as
+//
+//	host - user [time] "request" status bytes "referer" "user-agent" model key_hash latency_ms tags
+//
+// where user is the API key's name, tags are comma-separated and unknown
+// fields are "-". The model and tags come from the client, so characters
+// that could split or forge a field are dropped from them.
+func (l accessLogLine) combined() []byte {
+	bytes := "-"
+	if l.Bytes > 0 {
+		bytes = strconv.FormatUint(l.Bytes, 10)
+	}
+	return fmt.Appendf(nil, "%s - %s [%s] %s %d %s %s %s %s %s %.1f %s\n",
+		dash(l.Remote),
+		dash(l.Key),
+		l.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(l.Method+" "+l.Path+" "+l.Proto),
+		l.Status,
+		bytes,
+		strconv.Quote(dash(l.Referer)),
+		strconv.Quote(dash(l.UserAgent)),
+		dash(logToken(l.Model)),
+		dash(l.KeyHash),
+		l.LatencyMs,
+		dash(logToken(strings.Join(l.Tags, ","))),
+	)
+}
+
+// logToken keeps the characters of s that model names and tags are made of,
+// [A-Za-z0-9=_.,:/-], dropping spaces, quotes, control characters and the
+// rest.
+func logToken(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("=_.,:/-", r):
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// keyHash identifies an API key in logs without revealing it: the first 12
+// hex digits of its SHA-256.
+func keyHash(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:6])
+}
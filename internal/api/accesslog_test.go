@@ -0,0 +1,69 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func serveLogged(t *testing.T, format string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	m := NewMetrics()
+	m.SetAccessLog(NewAccessLogger(&buf, format))
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ObserveModel(w, "sonnet")
+		ObserveKey(w, "ci")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions?x=1", nil)
+	req.RemoteAddr = "10.0.0.7:5123"
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set(TagsHeader, "project=billing, aider")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	return buf.String()
+}
+
+func TestAccessLogCombinedFormat(t *testing.T) {
+	line := serveLogged(t, AccessLogCombined)
+	want := regexp.MustCompile(`^10\.0\.0\.7 - ci \[[^\]]+\] "POST /v1/chat/completions\?x=1 HTTP/1\.1" 201 5 "-" "test-agent" sonnet ([0-9a-f]{12}) [0-9.]+ project=billing,aider\n$`)
+	m := want.FindStringSubmatch(line)
+	if m == nil {
+		t.Fatalf("unexpected line %q", line)
+	}
+	if m[1] != keyHash("secret-token") || strings.Contains(line, "secret-token") {
+		t.Fatalf("key must be logged only as its hash: %q", line)
+	}
+}
+
+func TestAccessLogJSONFormat(t *testing.T) {
+	var got accessLogLine
+	if err := json.Unmarshal([]byte(serveLogged(t, AccessLogJSON)), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Method != http.MethodPost || got.Path != "/v1/chat/completions?x=1" || got.Status != http.StatusCreated ||
+		got.Bytes != 5 || got.Model != "sonnet" || got.Key != "ci" || got.KeyHash != keyHash("secret-token") || got.Remote != "10.0.0.7" ||
+		strings.Join(got.Tags, ",") != "project=billing,aider" {
+		t.Fatalf("unexpected entry: %+v", got)
+	}
+}
+
+func TestAccessLogCombinedDropsInjectedCharacters(t *testing.T) {
+	line := accessLogLine{
+		Method: http.MethodPost, Path: "/v1/chat/completions", Proto: "HTTP/1.1", Status: 200,
+		Model: "sonnet\n10.0.0.1 - admin", Tags: []string{"a b", `c"d`, "e\rf"},
+	}
+	got := string(line.combined())
+	if strings.Count(got, "\n") != 1 || strings.Contains(got, "\r") {
+		t.Fatalf("expected one line, got %q", got)
+	}
+	if !strings.HasSuffix(got, " ab,cd,ef\n") || !strings.Contains(got, " sonnet10.0.0.1-admin ") {
+		t.Fatalf("expected the model and tags as plain tokens, got %q", got)
+	}
+}
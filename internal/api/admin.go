@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"llm-proxy/internal/proxy"
+)
+
+func (s *Server) RegisterAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/yolo", s.getYOLO)
+	mux.HandleFunc("POST /admin/yolo", s.setYOLO)
+	mux.HandleFunc("GET /admin/quota", s.getQuota)
+	mux.HandleFunc("GET /admin/health", s.getHealth)
+	mux.HandleFunc("GET /admin/pause", s.getPause)
+	mux.HandleFunc("POST /admin/pause", s.setPause)
+	mux.HandleFunc("GET /admin/quiet-hours", s.getQuietHours)
+	mux.HandleFunc("POST /admin/quiet-hours", s.setQuietHours)
+	mux.HandleFunc("GET /admin/audit", s.getAudit)
+	mux.HandleFunc("POST /admin/requests/{id}/replay", s.replayRequest)
+	mux.HandleFunc("GET /admin/shadow", s.getShadow)
+	mux.HandleFunc("GET /readyz", s.getReady)
+	mux.HandleFunc("GET /healthz", s.getLive)
+}
+
+func (s *Server) getYOLO(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"enabled": proxy.YOLOEnabled()})
+}
+
+func (s *Server) setYOLO(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", `expected JSON body {"enabled": true|false}`)
+		return
+	}
+	prev := proxy.YOLOEnabled()
+	proxy.SetYOLO(*req.Enabled)
+	RecordAudit(adminAudit(r, "yolo", OnOff(prev), OnOff(*req.Enabled)))
+	writeJSON(w, http.StatusOK, map[string]any{"enabled": proxy.YOLOEnabled()})
+}
+
+// getQuota reports each backend's remaining subscription usage. Codex is
+// asked through its app-server when the cached answer is stale.
+func (s *Server) getQuota(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"data": quotaStats(s.router.Quotas(r.Context()))})
+}
+
+// getHealth reports the latest health probe of each backend and, with
+// ?network=1, whether each can reach its API from here.
+func (s *Server) getHealth(w http.ResponseWriter, r *http.Request) {
+	body := map[string]any{"data": healthStats(s.router.Health())}
+	if network, _ := strconv.ParseBool(r.URL.Query().Get("network")); network {
+		body["network"] = networkStats(s.router.CheckNetwork(r.Context()))
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// getLive is the liveness probe: the process serves HTTP. Backend trouble
+// shows in getReady instead, so a container is not restarted over it.
+func (s *Server) getLive(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+}
+
+// getReady is the readiness probe: 200 while at least one backend takes
+// requests, else 503. It needs no key, so it names no errors.
+func (s *Server) getReady(w http.ResponseWriter, r *http.Request) {
+	backends := map[string]bool{}
+	for _, st := range s.router.Health() {
+		backends[string(st.Backend)] = !st.CircuitOpen()
+	}
+	status := http.StatusOK
+	if !s.router.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, map[string]any{"ready": status == http.StatusOK, "backends": backends})
+}
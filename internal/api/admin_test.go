@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"llm-proxy/internal/proxy"
+)
+
+type unhealthyTestAdapter struct {
+	streamingTestAdapter
+}
+
+func (a *unhealthyTestAdapter) HealthCheck(context.Context) error {
+	return errors.New("codex app-server stream ended: boom")
+}
+
+func TestReadinessAndCircuitBreaking(t *testing.T) {
+	router := proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &unhealthyTestAdapter{streamingTestAdapter{model: "m2"}})
+	s := NewServer(router)
+	mux := http.NewServeMux()
+	s.RegisterAdminRoutes(mux)
+	mux.HandleFunc("POST /v1/chat/completions", s.CreateChatCompletion)
+
+	ready := func() (int, map[string]bool) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body struct {
+			Backends map[string]bool `json:"backends"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body.Backends
+	}
+
+	router.CheckHealth(context.Background())
+	router.CheckHealth(context.Background())
+	if code, backends := ready(); code != http.StatusOK || !backends["claude"] || backends["codex"] {
+		t.Fatalf("readyz = %d %v, want 200 with codex down", code, backends)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"codex/m2","messages":[{"role":"user","content":"hi"}]}`))))
+	if w.Code != http.StatusServiceUnavailable || !bytes.Contains(w.Body.Bytes(), []byte("backend_unavailable")) {
+		t.Fatalf("request to an open circuit = %d %s, want 503 backend_unavailable", w.Code, w.Body)
+	}
+
+	router.SetAdapters(&unhealthyTestAdapter{}, &unhealthyTestAdapter{})
+	router.CheckHealth(context.Background())
+	router.CheckHealth(context.Background())
+	if code, _ := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz = %d with every backend down, want 503", code)
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("healthz = %d with every backend down, want 200: liveness ignores backends", w.Code)
+	}
+}
+
+type unreachableTestAdapter struct {
+	streamingTestAdapter
+}
+
+func (a *unreachableTestAdapter) CheckNetwork(context.Context) proxy.NetworkInfo {
+	return proxy.NetworkInfo{Backend: proxy.BackendClaude, Endpoint: "https://api.anthropic.com", Proxy: "http://proxy:3128", ProxyEnv: "HTTPS_PROXY", Err: errors.New("proxyconnect tcp: connection refused")}
+}
+
+func TestNetworkFailuresAreReportedAsUnreachable(t *testing.T) {
+	adapter := &unreachableTestAdapter{streamingTestAdapter{model: "m1", err: errors.New("claude stream command failed: exit status 1: API Error: Connection error. (cause: getaddrinfo ENOTFOUND api.anthropic.com)")}}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+	mux := http.NewServeMux()
+	s.RegisterAdminRoutes(mux)
+	mux.HandleFunc("POST /v1/chat/completions", s.CreateChatCompletion)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"m1","stream":true,"messages":[{"role":"user","content":"hi"}]}`))))
+	if !bytes.Contains(w.Body.Bytes(), []byte("backend_unreachable")) || !bytes.Contains(w.Body.Bytes(), []byte("llm-proxy doctor")) {
+		t.Fatalf("unreachable backend reported as %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/health", nil))
+	if bytes.Contains(w.Body.Bytes(), []byte(`"network"`)) {
+		t.Fatalf("health checked the network unasked: %s", w.Body)
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/health?network=1", nil))
+	var body struct {
+		Network []NetworkStat `json:"network"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Network) != 1 || body.Network[0].Reachable || body.Network[0].ProxyEnv != "HTTPS_PROXY" || body.Network[0].Error == "" {
+		t.Fatalf("network = %+v", body.Network)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Where a runtime change came from.
+const (
+	AuditSourceTUI    = "tui"
+	AuditSourceAdmin  = "admin-api"
+	AuditSourceReload = "reload"
+)
+
+// maxAuditEntries is how many changes the audit trail keeps in memory; the
+// log file has them all.
+const maxAuditEntries = 100
+
+// AuditEntry is one runtime change to what the CLIs may do or which requests
+// the proxy takes: YOLO, pauses, quiet hours and config reloads.
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Key     string    `json:"key,omitempty"`
+	Setting string    `json:"setting"`
+	From    string    `json:"from,omitempty"`
+	To      string    `json:"to"`
+}
+
+var (
+	auditMu  sync.Mutex
+	auditLog []AuditEntry
+)
+
+// RecordAudit adds e to the audit trail and the log, stamped with the
+// current time.
+func RecordAudit(e AuditEntry) {
+	e.Time = time.Now()
+	by := e.Source
+	if e.Key != "" {
+		by += " (key " + e.Key + ")"
+	}
+	if e.From != "" {
+		log.Printf("audit: %s changed %s from %s to %s", by, e.Setting, e.From, e.To)
+	} else {
+		log.Printf("audit: %s set %s to %s", by, e.Setting, e.To)
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditLog = append(auditLog, e)
+	if n := len(auditLog) - maxAuditEntries; n > 0 {
+		auditLog = slices.Delete(auditLog, 0, n)
+	}
+}
+
+// AuditLog returns the recorded changes, oldest first.
+func AuditLog() []AuditEntry {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	return slices.Clone(auditLog)
+}
+
+// adminAudit is an AuditEntry for a change made through the admin API,
+// naming the key that made it.
+func adminAudit(r *http.Request, setting, from, to string) AuditEntry {
+	e := AuditEntry{Source: AuditSourceAdmin, Setting: setting, From: from, To: to}
+	if key := KeyFromContext(r.Context()); key != nil {
+		e.Key = key.Name
+	}
+	return e
+}
+
+// OnOff renders a switch for the audit trail.
+func OnOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// PauseAudit renders a pause state for the audit trail.
+func PauseAudit(p Pause) string {
+	if !p.Paused {
+		return "running"
+	}
+	return "paused (" + p.Mode + ")"
+}
+
+func (s *Server) getAudit(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"data": AuditLog()})
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+)
+
+func TestAdminChangesAreAudited(t *testing.T) {
+	clearAudit := func() {
+		auditMu.Lock()
+		auditLog = nil
+		auditMu.Unlock()
+	}
+	clearAudit()
+	prevYOLO := proxy.YOLOEnabled()
+	proxy.SetYOLO(false)
+	t.Cleanup(func() {
+		proxy.SetYOLO(prevYOLO)
+		SetPause(Pause{Mode: PauseReject})
+		clearAudit()
+	})
+	auth := NewAuthenticator([]config.APIKey{{Name: "ops", Key: "sk-ops", Scopes: []string{config.ScopeAdmin}}})
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &streamingTestAdapter{model: "m2"}))
+	mux := http.NewServeMux()
+	s.RegisterAdminRoutes(mux)
+	h := auth.Middleware(mux)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer sk-ops")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", method, path, w.Code, w.Body)
+		}
+		return w
+	}
+
+	do(http.MethodPost, "/admin/yolo", `{"enabled": true}`)
+	do(http.MethodPost, "/admin/pause", `{"paused": true, "mode": "queue"}`)
+	do(http.MethodPost, "/admin/quiet-hours", `{"paused": false}`)
+
+	var got struct {
+		Data []AuditEntry `json:"data"`
+	}
+	if err := json.Unmarshal(do(http.MethodGet, "/admin/audit", "").Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []AuditEntry{
+		{Source: AuditSourceAdmin, Key: "ops", Setting: "yolo", From: "off", To: "on"},
+		{Source: AuditSourceAdmin, Key: "ops", Setting: "pause", From: "running", To: "paused (queue)"},
+		{Source: AuditSourceAdmin, Key: "ops", Setting: "quiet_hours", From: "schedule", To: "resumed"},
+	}
+	if len(got.Data) != len(want) {
+		t.Fatalf("audit = %+v", got.Data)
+	}
+	for i, e := range got.Data {
+		if e.Time.IsZero() {
+			t.Fatalf("entry %d has no time: %+v", i, e)
+		}
+		e.Time = want[i].Time
+		if e != want[i] {
+			t.Fatalf("entry %d = %+v, want %+v", i, e, want[i])
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+)
+
+type APIKey struct {
+	Name     string
+	Scopes   []string
+	Profile  string
+	Priority string
+	// Safety is the key's safety preset, applied to its requests.
+	Safety string
+	// Webhook receives signed notifications for this key's responses.
+	Webhook string
+	// Models and DenyModels are glob patterns of the model IDs the key may
+	// and may not use; an empty Models allows every model.
+	Models     []string
+	DenyModels []string
+	// MaxPromptTokens and MaxRequestCostUSD override the global request
+	// budget when set.
+	MaxPromptTokens   int
+	MaxRequestCostUSD float64
+	// StreamCompat replaces the global compatibility flags when not nil.
+	StreamCompat []string
+	token        string
+}
+
+func (k *APIKey) Allows(scope string) bool {
+	if k == nil {
+		return false
+	}
+	if scope == "" {
+		return true
+	}
+	if slices.Contains(k.Scopes, config.ScopeAll) || slices.Contains(k.Scopes, scope) {
+		return true
+	}
+	// admin implies every admin-side capability, including YOLO toggles.
+	return scope == config.ScopeYOLO && slices.Contains(k.Scopes, config.ScopeAdmin)
+}
+
+// AllowsModel reports whether the key may use model. A nil key (auth off)
+// may use any.
+func (k *APIKey) AllowsModel(model string) bool {
+	if k == nil {
+		return true
+	}
+	if matchesModel(k.DenyModels, model) {
+		return false
+	}
+	return len(k.Models) == 0 || matchesModel(k.Models, model)
+}
+
+// allowsUnderlyingModel reports whether the key may run model on behalf of
+// one it requested: only DenyModels applies, so Models may list virtual
+// models and aliases without their bases.
+func (k *APIKey) allowsUnderlyingModel(model string) bool {
+	return !matchesModel(k.DenyModels, model)
+}
+
+func matchesModel(patterns []string, model string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, model); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type Authenticator struct {
+	mu   sync.RWMutex
+	keys []*APIKey
+}
+
+func NewAuthenticator(keys []config.APIKey) *Authenticator {
+	a := &Authenticator{}
+	a.SetKeys(keys)
+	return a
+}
+
+func (a *Authenticator) SetKeys(keys []config.APIKey) {
+	out := make([]*APIKey, 0, len(keys))
+	for _, k := range keys {
+		token := k.Token()
+		if token == "" {
+			continue
+		}
+		name := k.Name
+		if name == "" {
+			name = "key-" + tokenHint(token)
+		}
+		out = append(out, &APIKey{Name: name, Scopes: slices.Clone(k.Scopes), Profile: k.Profile, Priority: k.Priority, Safety: k.Safety, Webhook: k.WebhookURL, Models: slices.Clone(k.Models), DenyModels: slices.Clone(k.DenyModels), MaxPromptTokens: k.MaxPromptTokens, MaxRequestCostUSD: k.MaxRequestCostUSD, StreamCompat: slices.Clone(k.StreamCompat), token: token})
+	}
+	a.mu.Lock()
+	a.keys = out
+	a.mu.Unlock()
+}
+
+func (a *Authenticator) Enabled() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.keys) > 0
+}
+
+func (a *Authenticator) lookup(token string) *APIKey {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var found *APIKey
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(k.token), []byte(token)) == 1 {
+			found = k
+		}
+	}
+	return found
+}
+
+type apiKeyContextKey struct{}
+
+func KeyFromContext(ctx context.Context) *APIKey {
+	k, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return k
+}
+
+// withKey puts key on ctx along with its model policy and safety preset.
+func withKey(ctx context.Context, key *APIKey) context.Context {
+	ctx = context.WithValue(ctx, apiKeyContextKey{}, key)
+	ctx = proxy.WithCaller(ctx, key.Name)
+	ctx = proxy.WithModelPolicy(ctx, key.allowsUnderlyingModel)
+	return proxy.WithSafety(ctx, key.Safety)
+}
+
+// Middleware enforces bearer-token auth once at least one key is configured;
+// without keys the proxy stays open for local use.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() || isPublicPath(cleanPath(r.URL.Path)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := requestToken(r)
+		if token == "" {
+			writeError(w, http.StatusUnauthorized, "invalid_request_error", "missing API key; send it as 'Authorization: Bearer <key>'")
+			return
+		}
+		key := a.lookup(token)
+		if key == nil {
+			writeError(w, http.StatusUnauthorized, "invalid_request_error", "invalid API key")
+			return
+		}
+		ObserveKey(w, key.Name)
+		observeAPIKey(w, key)
+		scope := scopeForRequest(r)
+		if !key.Allows(scope) {
+			writeError(w, http.StatusForbidden, "permission_error", "API key '"+key.Name+"' is not allowed to access this endpoint (requires scope '"+scope+"')")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withKey(r.Context(), key)))
+	})
+}
+
+func requestToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+			return strings.TrimSpace(h[7:])
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-Api-Key"))
+}
+
+// scopeForRequest judges the clean path, the one NoRedirects may serve.
+func scopeForRequest(r *http.Request) string {
+	path := cleanPath(r.URL.Path)
+	switch {
+	case path == "/v1/models" || strings.HasPrefix(path, "/v1/models/"):
+		return config.ScopeModels
+	case path == "/v1/chat/completions", path == "/v1/evals" || strings.HasPrefix(path, "/v1/evals/"):
+		return config.ScopeChat
+	case path == "/v1/responses" || strings.HasPrefix(path, "/v1/responses/"):
+		return config.ScopeResponses
+	case path == "/admin/yolo":
+		return config.ScopeYOLO
+	case strings.HasPrefix(path, "/admin/"), strings.HasPrefix(path, "/dashboard/"):
+		return config.ScopeAdmin
+	}
+	return ""
+}
+
+// isPublicPath lists endpoints that carry no data and must load without a key,
+// such as the dashboard shell that prompts for one.
+func isPublicPath(path string) bool {
+	return path == "/dashboard" || path == "/readyz" || path == "/healthz" || isDocsPath(path)
+}
+
+func tokenHint(token string) string {
+	if len(token) <= 4 {
+		return "****"
+	}
+	return token[len(token)-4:]
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+)
+
+func TestAuthenticatorEnforcesScopes(t *testing.T) {
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "ide", Key: "sk-ide", Scopes: []string{config.ScopeModels, config.ScopeChat}},
+		{Name: "ops", Key: "sk-ops", Scopes: []string{config.ScopeAdmin}},
+	})
+	var seenKey string
+	h := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenKey = KeyFromContext(r.Context()).Name
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodGet, "/v1/models", "", http.StatusUnauthorized},
+		{http.MethodGet, "/v1/models", "sk-nope", http.StatusUnauthorized},
+		{http.MethodGet, "/v1/models", "sk-ide", http.StatusOK},
+		{http.MethodPost, "/v1/chat/completions", "sk-ide", http.StatusOK},
+		{http.MethodPost, "/v1/responses", "sk-ide", http.StatusForbidden},
+		{http.MethodPost, "/admin/yolo", "sk-ide", http.StatusForbidden},
+		{http.MethodPost, "/admin/yolo", "sk-ops", http.StatusOK},
+		{http.MethodPost, "/v1/chat/completions", "sk-ops", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Fatalf("%s %s with %q: got %d, want %d", tc.method, tc.path, tc.token, w.Code, tc.want)
+		}
+	}
+	if seenKey != "ops" {
+		t.Fatalf("expected key to be attached to the request context, got %q", seenKey)
+	}
+}
+
+func TestAuthenticatorDisabledWithoutKeys(t *testing.T) {
+	auth := NewAuthenticator(nil)
+	h := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/yolo", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected open access without keys, got %d", w.Code)
+	}
+}
+
+func TestProfilesFollowKeyAndHeader(t *testing.T) {
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "work", Key: "sk-work", Scopes: []string{config.ScopeAll}, Profile: "work"},
+		{Name: "any", Key: "sk-any", Scopes: []string{config.ScopeAll}},
+	})
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "default"}, &streamingTestAdapter{model: "none"}))
+	s.SetProfiles(map[string]*proxy.Router{
+		"work":     proxy.NewRouter(&streamingTestAdapter{model: "work-model"}, &streamingTestAdapter{model: "none"}),
+		"personal": proxy.NewRouter(&streamingTestAdapter{model: "personal-model"}, &streamingTestAdapter{model: "none"}),
+	})
+	h := auth.Middleware(http.HandlerFunc(s.ListModels))
+
+	cases := []struct {
+		token, header string
+		want          int
+		model         string
+	}{
+		{"sk-work", "", http.StatusOK, "work-model"},
+		{"sk-work", "work", http.StatusOK, "work-model"},
+		{"sk-work", "personal", http.StatusForbidden, ""},
+		{"sk-any", "", http.StatusOK, "default"},
+		{"sk-any", "personal", http.StatusOK, "personal-model"},
+		{"sk-any", "missing", http.StatusBadRequest, ""},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		r.Header.Set("Authorization", "Bearer "+tc.token)
+		if tc.header != "" {
+			r.Header.Set(ProfileHeader, tc.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Fatalf("%s with profile %q: got %d, want %d", tc.token, tc.header, w.Code, tc.want)
+		}
+		if tc.model != "" && !strings.Contains(w.Body.String(), `"id":"`+tc.model+`"`) {
+			t.Fatalf("%s with profile %q: expected %s in %s", tc.token, tc.header, tc.model, w.Body.String())
+		}
+	}
+}
+
+func TestKeyModelListsRestrictModels(t *testing.T) {
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "tool", Key: "sk-tool", Scopes: []string{config.ScopeAll}, Models: []string{"claude-*"}, DenyModels: []string{"claude-opus"}},
+	})
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "claude-haiku", deltas: []string{"ok"}}, &streamingTestAdapter{model: "claude-opus"}))
+	chat := auth.Middleware(http.HandlerFunc(s.CreateChatCompletion))
+
+	cases := []struct {
+		model string
+		want  int
+	}{
+		{"claude-haiku", http.StatusOK},
+		{"claude-opus", http.StatusForbidden},
+		{"gpt-5", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+tc.model+`","messages":[{"role":"user","content":"hi"}]}`))
+		r.Header.Set("Authorization", "Bearer sk-tool")
+		w := httptest.NewRecorder()
+		chat.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Fatalf("%s: got %d, want %d: %s", tc.model, w.Code, tc.want, w.Body.String())
+		}
+		if tc.want == http.StatusForbidden && !strings.Contains(w.Body.String(), "model_not_allowed") {
+			t.Fatalf("%s: expected model_not_allowed, got %s", tc.model, w.Body.String())
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	r.Header.Set("Authorization", "Bearer sk-tool")
+	w := httptest.NewRecorder()
+	auth.Middleware(http.HandlerFunc(s.ListModels)).ServeHTTP(w, r)
+	if body := w.Body.String(); !strings.Contains(body, "claude-haiku") || strings.Contains(body, "claude-opus") {
+		t.Fatalf("expected only allowed models listed, got %s", body)
+	}
+}
+
+// aliasTestAdapter serves model as an alias that runs base.
+type aliasTestAdapter struct {
+	streamingTestAdapter
+	base string
+}
+
+func (a *aliasTestAdapter) BaseModel(model string) string {
+	if model == a.model {
+		return a.base
+	}
+	return ""
+}
+
+func TestKeyDenyModelsCoverEveryRoute(t *testing.T) {
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "tool", Key: "sk-tool", Scopes: []string{config.ScopeAll}, DenyModels: []string{"opus"}},
+		{Name: "terse", Key: "sk-terse", Scopes: []string{config.ScopeAll}, Models: []string{"terse"}},
+	})
+	router := proxy.NewRouter(&aliasTestAdapter{streamingTestAdapter: streamingTestAdapter{model: "fast", deltas: []string{"ok"}}, base: "opus"}, &streamingTestAdapter{model: "opus", deltas: []string{"ok"}})
+	router.SetRaces(map[string][]string{"duel": {"fast", "codex/opus"}})
+	router.SetVirtualModels(map[string]proxy.VirtualModel{"terse": {Base: "opus"}})
+	router.SetPipelines(map[string][]proxy.PipelineStep{"refine": {{Model: "fast"}, {Model: "opus"}}})
+	chat := auth.Middleware(http.HandlerFunc(NewServer(router).CreateChatCompletion))
+
+	for _, model := range []string{"opus", "codex/opus", "fast", "duel", "terse", "refine"} {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+model+`","messages":[{"role":"user","content":"hi"}]}`))
+		r.Header.Set("Authorization", "Bearer sk-tool")
+		w := httptest.NewRecorder()
+		chat.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "model_not_allowed") || !strings.Contains(w.Body.String(), `\"opus\"`) {
+			t.Fatalf("%s: got %d %s, want 403 model_not_allowed for opus", model, w.Code, w.Body.String())
+		}
+	}
+
+	// models lists what a key may request, not the bases serving it.
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"terse","messages":[{"role":"user","content":"hi"}]}`))
+	r.Header.Set("Authorization", "Bearer sk-terse")
+	w := httptest.NewRecorder()
+	chat.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("terse: got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCodexHomeHeaderNeedsAdmin(t *testing.T) {
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "ide", Key: "sk-ide", Scopes: []string{config.ScopeModels}},
+		{Name: "root", Key: "sk-root", Scopes: []string{config.ScopeAll}},
+	})
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &streamingTestAdapter{model: "m2"}))
+	h := auth.Middleware(http.HandlerFunc(s.ListModels))
+	dir := t.TempDir()
+
+	cases := []struct {
+		token, home string
+		want        int
+	}{
+		{"sk-ide", dir, http.StatusForbidden},
+		{"sk-root", dir, http.StatusOK},
+		{"sk-root", "relative/path", http.StatusBadRequest},
+		{"sk-root", dir + "/missing", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		r.Header.Set("Authorization", "Bearer "+tc.token)
+		r.Header.Set(CodexHomeHeader, tc.home)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Fatalf("%s with %q: got %d, want %d", tc.token, tc.home, w.Code, tc.want)
+		}
+	}
+}
+
+func TestKeySafetyPresetReachesAdapters(t *testing.T) {
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "reviewer", Key: "sk-ro", Scopes: []string{config.ScopeAll}, Safety: config.SafetyReadOnly},
+		{Name: "any", Key: "sk-any", Scopes: []string{config.ScopeAll}},
+	})
+	var got string
+	h := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = proxy.SafetyFromContext(r.Context())
+	}))
+	for token, want := range map[string]string{"sk-ro": proxy.SafetyReadOnly, "sk-any": ""} {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		got = "unset"
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if got != want {
+			t.Fatalf("%s: safety = %q, want %q", token, got, want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+)
+
+// defaultBestOfNMax caps best_of_n when the config does not.
+const defaultBestOfNMax = 5
+
+type bestOfNConfig struct {
+	judgeModel string
+	max        int
+}
+
+// SetBestOfN configures the best_of_n extension.
+func (s *Server) SetBestOfN(c config.BestOfN) {
+	if c.Max == 0 {
+		c.Max = defaultBestOfNMax
+	}
+	s.bestOfN.Store(&bestOfNConfig{judgeModel: c.JudgeModel, max: c.Max})
+}
+
+func (s *Server) bestOfNSettings() bestOfNConfig {
+	if c := s.bestOfN.Load(); c != nil {
+		return *c
+	}
+	return bestOfNConfig{max: defaultBestOfNMax}
+}
+
+// allowBestOfN checks a request's best_of_n, writing a 400 when it is out
+// of range or combined with stream. n is 1 when best_of_n is unset.
+func (s *Server) allowBestOfN(w http.ResponseWriter, bestOfN *int, stream bool) (n int, ok bool) {
+	if bestOfN == nil || *bestOfN == 1 {
+		return 1, true
+	}
+	max := s.bestOfNSettings().max
+	switch {
+	case *bestOfN < 1 || *bestOfN > max:
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("best_of_n must be between 1 and %d", max))
+		return 0, false
+	case stream:
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "best_of_n is not supported with stream")
+		return 0, false
+	}
+	return *bestOfN, true
+}
+
+// bestOfNRuns is how many times a request with best_of_n n sends its
+// prompt: once per sample, plus once to the judge.
+func bestOfNRuns(n int) int {
+	if n == 1 {
+		return 1
+	}
+	return n + 1
+}
+
+// judgeModel is the model that judges best_of_n samples of model.
+func (s *Server) judgeModel(model string) string {
+	if m := s.bestOfNSettings().judgeModel; m != "" {
+		return m
+	}
+	return model
+}
+
+// allowJudge writes a 403 and returns false when a best_of_n request's API
+// key may not use the judge model.
+func (s *Server) allowJudge(w http.ResponseWriter, r *http.Request, model string, n int) bool {
+	return n == 1 || allowModel(w, r, s.judgeModel(model))
+}
+
+// runBestOfN runs sample n times at once and asks the judge model which
+// answer, as text gives it, is best for request (see proxy.JudgePrompt).
+// Failed samples are left out; only when all fail is the first error
+// returned. Every sample and the judge takes a concurrency slot of its own
+// at prio: the first runs in the request's, held, and gives it up when done
+// so that a limit of one cannot leave the others waiting on it.
+func runBestOfN[R any](ctx context.Context, s *Server, router *proxy.Router, model string, n int, prio Priority, held func(), request any, sample func(context.Context) (R, error), text func(R) string) (R, *openapiv1.BestOfNResult, error) {
+	results := make([]R, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := held
+			if i > 0 {
+				var err error
+				if release, err = s.sched.Acquire(ctx, prio, nil); err != nil {
+					errs[i] = err
+					return
+				}
+			}
+			defer release()
+			results[i], errs[i] = sample(ctx)
+		}()
+	}
+	wg.Wait()
+
+	var ok []int
+	var firstErr error
+	for i, err := range errs {
+		if err == nil {
+			ok = append(ok, i)
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+	judgeModel := s.judgeModel(model)
+	meta := &openapiv1.BestOfNResult{N: n, JudgeModel: judgeModel}
+	if failed := n - len(ok); failed > 0 {
+		meta.Failed = &failed
+	}
+	if len(ok) == 0 {
+		var zero R
+		return zero, nil, firstErr
+	}
+
+	winner := ok[0]
+	if len(ok) > 1 {
+		candidates := make([]string, len(ok))
+		for j, i := range ok {
+			candidates[j] = text(results[i])
+		}
+		if pick, err := s.judgeBestOfN(ctx, router, judgeModel, prio, request, candidates); err != nil {
+			log.Printf("best_of_n judge %s: %v; returning the first sample", judgeModel, err)
+		} else {
+			winner = ok[pick]
+		}
+	}
+	meta.Winner = winner
+	alternatives := make([]string, 0, len(ok)-1)
+	for _, i := range ok {
+		if i != winner {
+			alternatives = append(alternatives, text(results[i]))
+		}
+	}
+	meta.Alternatives = &alternatives
+	return results[winner], meta, nil
+}
+
+func (s *Server) judgeBestOfN(ctx context.Context, router *proxy.Router, judgeModel string, prio Priority, request any, candidates []string) (int, error) {
+	adapter, model, err := router.Resolve(ctx, judgeModel)
+	if err != nil {
+		return 0, err
+	}
+	release, err := s.sched.Acquire(ctx, prio, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	resp, err := adapter.Chat(ctx, proxy.ChatRequest{Model: model, Messages: proxy.JudgePrompt(request, candidates)})
+	if err != nil {
+		return 0, err
+	}
+	pick, ok := proxy.ParseJudgeVerdict(resp.Text, len(candidates))
+	if !ok {
+		return 0, fmt.Errorf("no candidate number in the verdict %q", strings.TrimSpace(resp.Text))
+	}
+	return pick, nil
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+)
+
+// sampleTestAdapter answers each chat with a numbered answer.
+type sampleTestAdapter struct {
+	streamingTestAdapter
+	calls atomic.Int32
+}
+
+func (a *sampleTestAdapter) Chat(_ context.Context, req proxy.ChatRequest) (proxy.ChatResponse, error) {
+	return proxy.ChatResponse{Model: req.Model, Text: fmt.Sprintf("answer %d", a.calls.Add(1))}, nil
+}
+
+func TestBestOfNReturnsTheJudgesPick(t *testing.T) {
+	sampler := &sampleTestAdapter{streamingTestAdapter: streamingTestAdapter{model: "m1"}}
+	judge := &streamingTestAdapter{model: "judge", deltas: []string{"Candidate 2"}}
+	s := NewServer(proxy.NewRouter(sampler, judge))
+	s.SetBestOfN(config.BestOfN{JudgeModel: "judge", Max: 3})
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(body))))
+		return w
+	}
+
+	w := send(`{"model":"m1","best_of_n":3,"messages":[{"role":"user","content":"name a colour"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("best_of_n request: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		BestOfN struct {
+			N            int      `json:"n"`
+			Winner       int      `json:"winner"`
+			JudgeModel   string   `json:"judge_model"`
+			Alternatives []string `json:"alternatives"`
+		} `json:"best_of_n"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if sampler.calls.Load() != 3 {
+		t.Fatalf("expected 3 samples, got %d", sampler.calls.Load())
+	}
+	content := resp.Choices[0].Message.Content
+	meta := resp.BestOfN
+	if meta.N != 3 || meta.Winner != 1 || meta.JudgeModel != "judge" || len(meta.Alternatives) != 2 || slices.Contains(meta.Alternatives, content) || !strings.HasPrefix(content, "answer ") {
+		t.Fatalf("unexpected pick %q with %+v", content, meta)
+	}
+	if prompt := judge.chats[0].Messages[1].Content; !strings.Contains(prompt, "name a colour") || !strings.Contains(prompt, "Candidate 3:\nanswer") {
+		t.Fatalf("judge prompt = %q", prompt)
+	}
+
+	if w := send(`{"model":"m1","best_of_n":4,"messages":[{"role":"user","content":"hi"}]}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "between 1 and 3") {
+		t.Fatalf("best_of_n over the cap: %d %s", w.Code, w.Body)
+	}
+	if w := send(`{"model":"m1","best_of_n":2,"stream":true,"messages":[{"role":"user","content":"hi"}]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("best_of_n with stream: %d %s", w.Code, w.Body)
+	}
+}
+
+// slowSampleTestAdapter records how many chats run at once.
+type slowSampleTestAdapter struct {
+	sampleTestAdapter
+	running, peak atomic.Int32
+}
+
+func (a *slowSampleTestAdapter) Chat(ctx context.Context, req proxy.ChatRequest) (proxy.ChatResponse, error) {
+	n := a.running.Add(1)
+	defer a.running.Add(-1)
+	for {
+		peak := a.peak.Load()
+		if n <= peak || a.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return a.sampleTestAdapter.Chat(ctx, req)
+}
+
+func TestBestOfNRunsWithinTheLimits(t *testing.T) {
+	sampler := &slowSampleTestAdapter{sampleTestAdapter: sampleTestAdapter{streamingTestAdapter: streamingTestAdapter{model: "m1"}}}
+	judge := &streamingTestAdapter{model: "judge", deltas: []string{"Candidate 1"}}
+	s := NewServer(proxy.NewRouter(sampler, judge))
+	s.SetBestOfN(config.BestOfN{JudgeModel: "judge", Max: 3})
+	s.SetConcurrencyLimit(1)
+	send := func(key *APIKey, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(body)))
+		if key != nil {
+			r = r.WithContext(withKey(r.Context(), key))
+		}
+		w := httptest.NewRecorder()
+		s.CreateChatCompletion(w, r)
+		return w
+	}
+
+	// With one slot the samples take turns instead of waiting on each other.
+	if w := send(nil, `{"model":"m1","best_of_n":3,"messages":[{"role":"user","content":"hi"}]}`); w.Code != http.StatusOK {
+		t.Fatalf("best_of_n with a limit of 1: %d %s", w.Code, w.Body)
+	}
+	if peak := sampler.peak.Load(); peak != 1 {
+		t.Fatalf("%d samples ran at once with a limit of 1", peak)
+	}
+
+	if w := send(&APIKey{Name: "tool", DenyModels: []string{"judge"}}, `{"model":"m1","best_of_n":2,"messages":[{"role":"user","content":"hi"}]}`); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `\"judge\"`) {
+		t.Fatalf("best_of_n with a judge the key may not use: %d %s", w.Code, w.Body)
+	}
+
+	// A prompt of about $0.003 fits $0.01 once, but not for 3 samples and
+	// the judge.
+	s.SetRequestBudget(config.Limits{MaxRequestCostUSD: 0.01}, map[string]config.ModelPrice{"m1": {PromptPerMTok: 3}})
+	body := `{"model":"m1","best_of_n":3,"messages":[{"role":"user","content":"` + strings.Repeat("word ", 1000) + `"}]}`
+	if w := send(nil, strings.Replace(body, `"best_of_n":3,`, "", 1)); w.Code != http.StatusOK {
+		t.Fatalf("single run within budget: %d %s", w.Code, w.Body)
+	}
+	if w := send(nil, body); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "sent 4 times") {
+		t.Fatalf("best_of_n over budget: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+	"llm-proxy/internal/tokenizer"
+)
+
+// requestBudget caps the size of a single request's prompt, in estimated
+// tokens and in estimated cost at the model's list price.
+type requestBudget struct {
+	maxPromptTokens int
+	maxCostUSD      float64
+	pricing         map[string]config.ModelPrice
+}
+
+// SetRequestBudget sets the global per-request caps; keys may set their own.
+// Cost caps need the model to be priced.
+func (s *Server) SetRequestBudget(limits config.Limits, pricing map[string]config.ModelPrice) {
+	s.budget.Store(&requestBudget{
+		maxPromptTokens: limits.MaxPromptTokens,
+		maxCostUSD:      limits.MaxRequestCostUSD,
+		pricing:         pricing,
+	})
+}
+
+// SetTokenizers sets how tokens are counted for each model.
+func (s *Server) SetTokenizers(set *tokenizer.Set) {
+	s.tokenizers.Store(set)
+}
+
+// tokenizer counts tokens for model's usage and budgets.
+func (s *Server) tokenizer(model string) tokenizer.Tokenizer {
+	return s.tokenizers.Load().For(model)
+}
+
+// chatPromptTokens estimates the prompt messages will make for model once
+// the history policy has trimmed them.
+func (s *Server) chatPromptTokens(model string, messages []proxy.Message) uint64 {
+	if policy := s.history.Load(); policy != nil {
+		messages, _ = policy.TrimHistory(messages)
+	}
+	return estimateMessagesTokens(s.tokenizer(model), messages)
+}
+
+// allowPrompt reports whether a prompt of promptTokens for model fits the
+// request's budget, writing a 400 that says why when it does not. The
+// request sends the prompt runs times, which multiplies its cost: best_of_n
+// runs n samples and the judge.
+func (s *Server) allowPrompt(w http.ResponseWriter, r *http.Request, model string, promptTokens uint64, runs int) bool {
+	b := s.budget.Load()
+	if b == nil {
+		b = &requestBudget{}
+	}
+	maxTokens, maxCost, scope := b.maxPromptTokens, b.maxCostUSD, "limits"
+	if key := KeyFromContext(r.Context()); key != nil {
+		if key.MaxPromptTokens > 0 {
+			maxTokens, scope = key.MaxPromptTokens, fmt.Sprintf("API key %q", key.Name)
+		}
+		if key.MaxRequestCostUSD > 0 {
+			maxCost, scope = key.MaxRequestCostUSD, fmt.Sprintf("API key %q", key.Name)
+		}
+	}
+	var msg string
+	if maxTokens > 0 && promptTokens > uint64(maxTokens) {
+		msg = fmt.Sprintf("prompt is about %d tokens, over the %d-token limit per request set by %s", promptTokens, maxTokens, scope)
+	} else if price, ok := b.pricing[model]; ok && maxCost > 0 {
+		if cost := price.Cost(promptTokens, 0) * float64(runs); cost > maxCost {
+			times := ""
+			if runs > 1 {
+				times = fmt.Sprintf(" sent %d times", runs)
+			}
+			msg = fmt.Sprintf("prompt is about %d tokens%s, an estimated $%.2f at %s's list price, over the $%.2f limit per request set by %s", promptTokens, times, cost, model, maxCost, scope)
+		}
+	}
+	if msg == "" {
+		return true
+	}
+	writeJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{
+		"type":    "invalid_request_error",
+		"code":    "request_over_budget",
+		"message": msg + "; trim the conversation or raise the limit",
+	}})
+	return false
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+	"llm-proxy/internal/tokenizer"
+)
+
+func TestRequestBudgetRejectsLargePrompts(t *testing.T) {
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "agent", Key: "sk-agent", Scopes: []string{config.ScopeAll}, MaxPromptTokens: 1000},
+		{Name: "other", Key: "sk-other", Scopes: []string{config.ScopeAll}},
+	})
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "sonnet", deltas: []string{"ok"}}, &streamingTestAdapter{model: "none"}))
+	s.SetRequestBudget(config.Limits{MaxRequestCostUSD: 0.01}, map[string]config.ModelPrice{"sonnet": {PromptPerMTok: 3}})
+	h := auth.Middleware(http.HandlerFunc(s.CreateChatCompletion))
+
+	send := func(token string, chars int, stream bool) *httptest.ResponseRecorder {
+		body := []byte(`{"model":"sonnet","stream":` + strconv.FormatBool(stream) +
+			`,"messages":[{"role":"user","content":"` + strings.Repeat("a", chars) + `"}]}`)
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	cases := []struct {
+		token  string
+		chars  int
+		stream bool
+		want   int
+	}{
+		{"sk-agent", 100, false, http.StatusOK},
+		{"sk-agent", 8000, false, http.StatusBadRequest},
+		{"sk-agent", 8000, true, http.StatusBadRequest},
+		// 8000 chars is ~2000 tokens, $0.006 at $3/Mtok: under the global cap.
+		{"sk-other", 8000, false, http.StatusOK},
+		{"sk-other", 80000, false, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		w := send(tc.token, tc.chars, tc.stream)
+		if w.Code != tc.want {
+			t.Fatalf("%s with %d chars: got %d, want %d: %s", tc.token, tc.chars, w.Code, tc.want, w.Body)
+		}
+		if tc.want == http.StatusBadRequest && !strings.Contains(w.Body.String(), "request_over_budget") {
+			t.Fatalf("%s with %d chars: expected request_over_budget, got %s", tc.token, tc.chars, w.Body)
+		}
+	}
+}
+
+func TestRequestBudgetCountsWithModelTokenizer(t *testing.T) {
+	// An encoding where 8 a's make a token, against the heuristic's 4.
+	var ranks strings.Builder
+	for i, tok := range []string{"a", "aa", "aaaa", "aaaaaaaa"} {
+		fmt.Fprintf(&ranks, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), i)
+	}
+	file := filepath.Join(t.TempDir(), "a.tiktoken")
+	if err := os.WriteFile(file, []byte(ranks.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	set, err := tokenizer.Load(config.Tokenizers{Encodings: map[string]string{"a8": file}, Models: map[string]string{"son*": "a8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "sonnet", deltas: []string{"ok"}}, &streamingTestAdapter{model: "opus", deltas: []string{"ok"}}))
+	s.SetRequestBudget(config.Limits{MaxPromptTokens: 1500}, nil)
+	s.SetTokenizers(set)
+
+	// 8000 a's are 1000 tokens with the encoding, 2000 by the heuristic.
+	for model, want := range map[string]int{"sonnet": http.StatusOK, "opus": http.StatusBadRequest} {
+		body := `{"model":"` + model + `","messages":[{"role":"user","content":"` + strings.Repeat("a", 8000) + `"}]}`
+		w := httptest.NewRecorder()
+		s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+		if w.Code != want {
+			t.Fatalf("%s: got %d, want %d: %s", model, w.Code, want, w.Body)
+		}
+	}
+}
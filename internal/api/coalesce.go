@@ -0,0 +1,139 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+)
+
+const (
+	maxCoalesceInterval = time.Second
+	maxCoalesceBytes    = 64 << 10
+)
+
+// coalesceSettings validates a request's stream_coalesce extension. Both
+// zero means coalescing is off.
+func coalesceSettings(opts *openapiv1.StreamCoalesce) (time.Duration, int, error) {
+	if opts == nil {
+		return 0, 0, nil
+	}
+	var interval time.Duration
+	var maxBytes int
+	if opts.IntervalMs != nil {
+		interval = time.Duration(*opts.IntervalMs) * time.Millisecond
+	}
+	if opts.MaxBytes != nil {
+		maxBytes = *opts.MaxBytes
+	}
+	if interval < 0 || interval > maxCoalesceInterval {
+		return 0, 0, fmt.Errorf("stream_coalesce.interval_ms must be between 0 and %d", maxCoalesceInterval.Milliseconds())
+	}
+	if maxBytes < 0 || maxBytes > maxCoalesceBytes {
+		return 0, 0, fmt.Errorf("stream_coalesce.max_bytes must be between 0 and %d", maxCoalesceBytes)
+	}
+	return interval, maxBytes, nil
+}
+
+// coalesceEvents wraps next so consecutive deltas of the same kind are merged
+// and delivered once interval has passed since the first of them or maxBytes
+// are buffered. Other events flush the buffer first, keeping order. The
+// returned flush must be called once the backend is done; after that next is
+// no longer called. With both limits zero, next is returned as is.
+func coalesceEvents(interval time.Duration, maxBytes int, next func(proxy.ResponseEvent) error) (emit func(proxy.ResponseEvent) error, flush func() error) {
+	if interval <= 0 && maxBytes <= 0 {
+		return next, func() error { return nil }
+	}
+	c := &deltaCoalescer{interval: interval, maxBytes: maxBytes, next: next}
+	return c.emit, c.close
+}
+
+type deltaCoalescer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	maxBytes int
+	next     func(proxy.ResponseEvent) error
+
+	pending    proxy.ResponseEvent
+	hasPending bool
+	timer      *time.Timer
+	timerGen   int
+	// err is the first error from a timer flush, returned to the backend on
+	// its next event so it stops.
+	err    error
+	closed bool
+}
+
+func (c *deltaCoalescer) emit(ev proxy.ResponseEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	if ev.Kind == proxy.ResponseEventToolCall {
+		if err := c.flushLocked(); err != nil {
+			return err
+		}
+		return c.next(ev)
+	}
+	if ev.Delta == "" {
+		return nil
+	}
+	if c.hasPending && c.pending.Kind != ev.Kind {
+		if err := c.flushLocked(); err != nil {
+			return err
+		}
+	}
+	if c.hasPending {
+		c.pending.Delta += ev.Delta
+	} else {
+		c.pending, c.hasPending = ev, true
+	}
+	if c.maxBytes > 0 && len(c.pending.Delta) >= c.maxBytes {
+		return c.flushLocked()
+	}
+	if c.interval > 0 && c.timer == nil {
+		c.timerGen++
+		gen := c.timerGen
+		c.timer = time.AfterFunc(c.interval, func() { c.onTimer(gen) })
+	}
+	return nil
+}
+
+func (c *deltaCoalescer) onTimer(gen int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// A flush may have stopped this timer after it fired.
+	if c.closed || c.timer == nil || gen != c.timerGen {
+		return
+	}
+	c.timer = nil
+	if err := c.flushLocked(); err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *deltaCoalescer) flushLocked() error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if !c.hasPending {
+		return nil
+	}
+	ev := c.pending
+	c.pending, c.hasPending = proxy.ResponseEvent{}, false
+	return c.next(ev)
+}
+
+func (c *deltaCoalescer) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if err := c.flushLocked(); err != nil {
+		return err
+	}
+	return c.err
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/proxy"
+)
+
+func TestCoalesceEventsMergesDeltasAndKeepsOrder(t *testing.T) {
+	var got []proxy.ResponseEvent
+	emit, flush := coalesceEvents(0, 4, func(ev proxy.ResponseEvent) error {
+		got = append(got, ev)
+		return nil
+	})
+	for _, ev := range []proxy.ResponseEvent{
+		{Kind: proxy.ResponseEventReasoning, Delta: "th"},
+		{Kind: proxy.ResponseEventReasoning, Delta: "ink"},
+		{Kind: proxy.ResponseEventReasoning, Delta: "s"},
+		{Kind: proxy.ResponseEventToolCall, Tool: &proxy.ToolCall{Name: "shell"}},
+		{Kind: proxy.ResponseEventOutput, Delta: "a"},
+		{Kind: proxy.ResponseEventOutput, Delta: "b"},
+	} {
+		if err := emit(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"reasoning:think", "reasoning:s", "tool_call:", "output:ab"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(got), len(want), got)
+	}
+	for i, ev := range got {
+		if s := string(ev.Kind) + ":" + ev.Delta; s != want[i] {
+			t.Fatalf("event %d = %q, want %q", i, s, want[i])
+		}
+	}
+}
+
+func TestCoalesceEventsFlushesOnInterval(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	emit, flush := coalesceEvents(20*time.Millisecond, 0, func(ev proxy.ResponseEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, ev.Delta)
+		return nil
+	})
+	defer flush()
+	_ = emit(proxy.ResponseEvent{Kind: proxy.ResponseEventOutput, Delta: "he"})
+	_ = emit(proxy.ResponseEvent{Kind: proxy.ResponseEventOutput, Delta: "llo"})
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 1
+	})
+	if got[0] != "hello" {
+		t.Fatalf("expected merged delta, got %q", got)
+	}
+}
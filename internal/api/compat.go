@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"llm-proxy/internal/config"
+)
+
+// streamCompat holds the compatibility flags in effect for a request: small
+// departures from the usual shape of streamed chunks that some clients
+// expect, such as a content field next to the role in the first chunk.
+type streamCompat struct {
+	firstChunkContent bool
+	noRedirects       bool
+	// doneWithin, when set, is how long after the request arrives a chat
+	// completions stream must have ended.
+	doneWithin time.Duration
+}
+
+// compatSettings are the global flags and the done_within budget.
+type compatSettings struct {
+	flags      []string
+	doneWithin time.Duration
+}
+
+func (c *compatSettings) resolve(flags []string) streamCompat {
+	var out streamCompat
+	for _, f := range flags {
+		switch f {
+		case config.CompatFirstChunkContent:
+			out.firstChunkContent = true
+		case config.CompatNoRedirects:
+			out.noRedirects = true
+		case config.CompatDoneWithin:
+			out.doneWithin = c.doneWithin
+		}
+	}
+	return out
+}
+
+// SetStreamCompat sets the compatibility flags for keys that set none of
+// their own, and the done_within budget for all keys. With no budget the
+// done_within flag does nothing.
+func (s *Server) SetStreamCompat(flags []string, doneWithin time.Duration) {
+	s.compat.Store(&compatSettings{flags: flags, doneWithin: doneWithin})
+}
+
+// streamCompatFor returns the flags of r's key or, when it sets none, the
+// global ones.
+func (s *Server) streamCompatFor(r *http.Request) streamCompat {
+	c := s.compat.Load()
+	if c == nil {
+		c = &compatSettings{}
+	}
+	if key := KeyFromContext(r.Context()); key != nil && key.StreamCompat != nil {
+		return c.resolve(key.StreamCompat)
+	}
+	return c.resolve(c.flags)
+}
+
+// NoRedirects serves requests with the no_redirects flag at their clean
+// path. The mux answers a path that is not clean, such as the
+// /v1//chat/completions a base URL with a trailing slash makes, with a
+// redirect to the clean one, and clients that do not follow redirects, or
+// follow a POST's with a GET, fail. The key is known by then, so it goes
+// after the Authenticator's middleware, which judges the clean path too.
+func (s *Server) NoRedirects(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p := cleanPath(r.URL.Path); p != r.URL.Path && s.streamCompatFor(r).noRedirects {
+			r = r.Clone(r.Context())
+			r.URL.Path, r.URL.RawPath = p, ""
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cleanPath is p without repeated slashes, "." and ".." segments or a
+// trailing slash.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return path.Clean(p)
+}
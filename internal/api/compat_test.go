@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+)
+
+func chatStreamRequest(path, key string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"model":"sonnet","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	r.Header.Set("Authorization", "Bearer "+key)
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func TestNoRedirectsAndDoneWithinFlags(t *testing.T) {
+	s := NewServer(proxy.NewRouter(
+		&stallingTestAdapter{streamingTestAdapter{model: "sonnet"}},
+		&stallingTestAdapter{streamingTestAdapter{model: "gpt-5"}},
+	))
+	s.SetStreamCompat(nil, 100*time.Millisecond)
+	flags := []string{config.CompatFirstChunkContent, config.CompatNoRedirects, config.CompatDoneWithin}
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "ide", Key: "sk-ide", Scopes: []string{config.ScopeAll}, StreamCompat: flags},
+		{Name: "plain", Key: "sk-plain", Scopes: []string{config.ScopeAll}},
+		{Name: "models-only", Key: "sk-models", Scopes: []string{config.ScopeModels}, StreamCompat: flags},
+	})
+	mux := http.NewServeMux()
+	RegisterUnknownRoutes(mux)
+	h := auth.Middleware(s.NoRedirects(openapiv1.HandlerFromMux(s, mux)))
+
+	for _, path := range []string{"/v1/chat/completions", "/v1//chat/completions"} {
+		start := time.Now()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, chatStreamRequest(path, "sk-ide"))
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+			t.Fatalf("%s: got %d %s: %s", path, w.Code, w.Header().Get("Content-Type"), w.Body)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("%s: stream took %v", path, elapsed)
+		}
+		if !strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n") {
+			t.Fatalf("%s: stream does not end with [DONE]: %s", path, w.Body)
+		}
+		events := decodeSSEEvents(t, w.Body.String())
+		first := events[0]["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)
+		last := events[len(events)-1]["choices"].([]any)[0].(map[string]any)
+		if first["content"] != "" || last["finish_reason"] != "length" {
+			t.Fatalf("%s: first delta %v, last choice %v", path, first, last)
+		}
+	}
+
+	// Without no_redirects the mux redirects a path that is not clean.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, chatStreamRequest("/v1//chat/completions", "sk-plain"))
+	if w.Code/100 != 3 {
+		t.Fatalf("without no_redirects: got %d, want a redirect", w.Code)
+	}
+
+	// The clean path is the one the key's scopes are checked against.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, chatStreamRequest("/v1//chat/completions", "sk-models"))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("a key without the chat scope got %d", w.Code)
+	}
+}
+
+func TestDoneWithinCoversTimeQueued(t *testing.T) {
+	adapter := &streamingTestAdapter{model: "m1", deltas: []string{"hi"}}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+	s.SetStreamCompat([]string{config.CompatDoneWithin}, 50*time.Millisecond)
+	s.SetConcurrencyLimit(1)
+	release, err := s.sched.Acquire(t.Context(), PriorityInteractive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	w := httptest.NewRecorder()
+	s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m1","stream":true,"messages":[{"role":"user","content":"hi"}]}`)))
+	events := decodeSSEEvents(t, w.Body.String())
+	last := events[len(events)-1]["choices"].([]any)[0].(map[string]any)
+	if last["finish_reason"] != "length" || !strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n") || len(adapter.chats) != 0 {
+		t.Fatalf("a stream still queued at its budget: %s", w.Body)
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+)
+
+// ContextTruncatedHeader tells the client how many of its oldest messages
+// were dropped to fit the model's context window.
+const ContextTruncatedHeader = "X-LLM-Proxy-Context-Truncated"
+
+// SetContextWindows sets the models' context windows and what happens to
+// prompts that overflow them.
+func (s *Server) SetContextWindows(cfg config.ContextWindows) {
+	s.contextWindows.Store(&cfg)
+}
+
+// contextWindow returns model's context window, or 0 when it is not
+// configured.
+func (s *Server) contextWindow(model string) int {
+	cfg := s.contextWindows.Load()
+	if cfg == nil {
+		return 0
+	}
+	window, _ := config.LookupModel(cfg.Models, model)
+	return window
+}
+
+// promptWindow returns how many tokens model's context window leaves for
+// the prompt, or 0 when its window is not configured.
+func (s *Server) promptWindow(model string) (limit int, cfg *config.ContextWindows) {
+	cfg = s.contextWindows.Load()
+	if cfg == nil {
+		return 0, nil
+	}
+	window, ok := config.LookupModel(cfg.Models, model)
+	if !ok {
+		return 0, cfg
+	}
+	return window - cfg.ReserveTokens, cfg
+}
+
+// fitContext checks a chat prompt for model against its context window,
+// counted as chatPromptTokens does. A prompt that does not fit is refused
+// with context_length_exceeded or, with overflow "truncate", loses its
+// oldest messages, never the system ones or the last, until it does. The
+// messages it keeps stay in their order.
+func (s *Server) fitContext(w http.ResponseWriter, model string, messages []proxy.Message) ([]proxy.Message, bool) {
+	limit, cfg := s.promptWindow(model)
+	if limit == 0 {
+		return messages, true
+	}
+	tokens := s.chatPromptTokens(model, messages)
+	if tokens <= uint64(limit) {
+		return messages, true
+	}
+	if cfg.Overflow != config.OverflowTruncate {
+		writeContextExceeded(w, limit, cfg.ReserveTokens, tokens, "messages")
+		return nil, false
+	}
+	// Messages the history policy drops are not counted.
+	if policy := s.history.Load(); policy != nil {
+		messages, _ = policy.TrimHistory(messages)
+	}
+	tok := s.tokenizer(model)
+	drop := make([]bool, len(messages))
+	dropped := 0
+	for i := 0; i < len(messages) && tokens > uint64(limit); {
+		if m := messages[i]; m.Role == "system" || m.Role == "developer" {
+			i++
+			continue
+		}
+		// Tool results go with the turn before them, which called the
+		// tools: a result without its call, or a call left without its
+		// result, is a prompt the model cannot follow.
+		end := i + 1
+		for end < len(messages) && messages[end].Role == "tool" {
+			end++
+		}
+		if end == len(messages) {
+			break
+		}
+		tokens -= estimateMessagesTokens(tok, messages[i:end])
+		for ; i < end; i++ {
+			drop[i] = true
+			dropped++
+		}
+	}
+	if tokens > uint64(limit) {
+		writeContextExceeded(w, limit, cfg.ReserveTokens, tokens, "messages")
+		return nil, false
+	}
+	log.Printf("context window: dropped %d messages from the start of a %s prompt to fit %d tokens", dropped, model, limit)
+	w.Header().Set(ContextTruncatedHeader, strconv.Itoa(dropped))
+	kept := make([]proxy.Message, 0, len(messages)-dropped)
+	for i, m := range messages {
+		if !drop[i] {
+			kept = append(kept, m)
+		}
+	}
+	return kept, true
+}
+
+// allowContext reports whether a prompt of promptTokens fits model's
+// context window, writing a context_length_exceeded error when it does not.
+func (s *Server) allowContext(w http.ResponseWriter, model string, promptTokens uint64) bool {
+	limit, cfg := s.promptWindow(model)
+	if limit == 0 || promptTokens <= uint64(limit) {
+		return true
+	}
+	writeContextExceeded(w, limit, cfg.ReserveTokens, promptTokens, "input")
+	return false
+}
+
+func writeContextExceeded(w http.ResponseWriter, limit, reserve int, tokens uint64, param string) {
+	msg := fmt.Sprintf("This model's maximum context length is %d tokens. However, your %s resulted in %d tokens", limit+reserve, param, tokens)
+	if reserve > 0 {
+		msg += fmt.Sprintf(" (%d tokens are kept for the completion)", reserve)
+	}
+	writeJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{
+		"type":    "invalid_request_error",
+		"code":    "context_length_exceeded",
+		"param":   param,
+		"message": msg + ". Please reduce the length of the " + param + ".",
+	}})
+}
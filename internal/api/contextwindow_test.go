@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+)
+
+func TestContextWindowRejectsOverflowingPrompts(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "small", deltas: []string{"ok"}}, &streamingTestAdapter{model: "big", deltas: []string{"ok"}}))
+	s.SetContextWindows(config.ContextWindows{Models: map[string]int{"sm*": 300}, ReserveTokens: 100})
+	long := strings.Repeat("a", 1000) // 250 tokens
+
+	cases := []struct {
+		path, body string
+		want       int
+	}{
+		{"/v1/chat/completions", `{"model":"small","messages":[{"role":"user","content":"` + long + `"}]}`, http.StatusBadRequest},
+		{"/v1/chat/completions", `{"model":"small","stream":true,"messages":[{"role":"user","content":"` + long + `"}]}`, http.StatusBadRequest},
+		{"/v1/chat/completions", `{"model":"small","messages":[{"role":"user","content":"` + long[:600] + `"}]}`, http.StatusOK},
+		{"/v1/chat/completions", `{"model":"big","messages":[{"role":"user","content":"` + long + `"}]}`, http.StatusOK},
+		{"/v1/responses", `{"model":"small","input":"` + long + `"}`, http.StatusBadRequest},
+		{"/v1/responses", `{"model":"small","stream":true,"input":"` + long + `"}`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+		if tc.path == "/v1/responses" {
+			s.CreateResponse(w, r)
+		} else {
+			s.CreateChatCompletion(w, r)
+		}
+		if w.Code != tc.want {
+			t.Fatalf("%s %.60s: got %d, want %d: %s", tc.path, tc.body, w.Code, tc.want, w.Body)
+		}
+		if tc.want != http.StatusBadRequest {
+			continue
+		}
+		var body struct {
+			Error struct {
+				Code, Param, Message string
+			}
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		if body.Error.Code != "context_length_exceeded" || !strings.Contains(body.Error.Message, "maximum context length is 300 tokens") {
+			t.Fatalf("%s: unexpected error %s", tc.path, w.Body)
+		}
+	}
+}
+
+func TestContextWindowTruncatesOldestMessages(t *testing.T) {
+	adapter := &streamingTestAdapter{model: "small", deltas: []string{"ok"}}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "big"}))
+	s.SetContextWindows(config.ContextWindows{Models: map[string]int{"small": 100}, Overflow: config.OverflowTruncate})
+	turn := strings.Repeat("a", 400) // 100 tokens
+	send := func(last string) *httptest.ResponseRecorder {
+		body := `{"model":"small","messages":[
+			{"role":"user","content":"` + turn + `"},
+			{"role":"system","content":"be brief"},
+			{"role":"assistant","content":"` + turn + `"},
+			{"role":"user","content":"` + last + `"}]}`
+		w := httptest.NewRecorder()
+		s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+		return w
+	}
+
+	w := send("and now?")
+	if w.Code != http.StatusOK || w.Header().Get(ContextTruncatedHeader) != "2" {
+		t.Fatalf("got %d with %s %q: %s", w.Code, ContextTruncatedHeader, w.Header().Get(ContextTruncatedHeader), w.Body)
+	}
+	got := adapter.chats[len(adapter.chats)-1].Messages
+	if len(got) != 2 || got[0].Content != "be brief" || got[1].Content != "and now?" {
+		t.Fatalf("backend got %+v, want the system message and the last one", got)
+	}
+
+	// A tool result goes with the assistant turn that called the tool, and
+	// system messages keep their place.
+	body := `{"model":"small","messages":[
+		{"role":"system","content":"be brief"},
+		{"role":"assistant","content":"` + turn + `"},
+		{"role":"tool","content":"result"},
+		{"role":"system","content":"use the tool output"},
+		{"role":"user","content":"and now?"}]}`
+	w = httptest.NewRecorder()
+	s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+	if w.Code != http.StatusOK || w.Header().Get(ContextTruncatedHeader) != "2" {
+		t.Fatalf("got %d with %s %q: %s", w.Code, ContextTruncatedHeader, w.Header().Get(ContextTruncatedHeader), w.Body)
+	}
+	got = adapter.chats[len(adapter.chats)-1].Messages
+	if len(got) != 3 || got[0].Content != "be brief" || got[1].Content != "use the tool output" || got[2].Content != "and now?" {
+		t.Fatalf("backend got %+v", got)
+	}
+
+	// The last message is never dropped, so a prompt it overflows alone is
+	// refused.
+	if w := send(strings.Repeat("b", 800)); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "context_length_exceeded") {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestModelsListTheirContextWindow(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "small"}, &streamingTestAdapter{model: "big"}))
+	s.SetContextWindows(config.ContextWindows{Models: map[string]int{"sm*": 300}, ReserveTokens: 100})
+
+	w := httptest.NewRecorder()
+	s.ListModels(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	var list struct {
+		Data []map[string]any
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	windows := map[any]any{}
+	for _, m := range list.Data {
+		windows[m["id"]] = m["context_window"]
+	}
+	if windows["small"] != 300.0 || windows["big"] != nil {
+		t.Fatalf("context windows = %v", windows)
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"llm-proxy/internal/proxy"
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+type Dashboard struct {
+	metrics   *Metrics
+	addr      string
+	authOn    func() bool
+	startedAt time.Time
+}
+
+func NewDashboard(metrics *Metrics, addr string, authEnabled func() bool) *Dashboard {
+	return &Dashboard{
+		metrics:   metrics,
+		addr:      addr,
+		authOn:    authEnabled,
+		startedAt: time.Now(),
+	}
+}
+
+func (d *Dashboard) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /dashboard", d.page)
+	mux.HandleFunc("GET /dashboard/state", d.state)
+}
+
+func isDashboardPath(path string) bool {
+	return path == "/dashboard" || strings.HasPrefix(path, "/dashboard/")
+}
+
+func (d *Dashboard) page(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(dashboardHTML)
+}
+
+func (d *Dashboard) state(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	authEnabled := false
+	if d.authOn != nil {
+		authEnabled = d.authOn()
+	}
+	status := "running"
+	if CurrentPause().Paused {
+		status = "paused"
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"service": map[string]any{
+			"status":         status,
+			"address":        d.addr,
+			"started_at":     d.startedAt.UTC(),
+			"uptime_seconds": int64(time.Since(d.startedAt).Seconds()),
+			"yolo":           proxy.YOLOEnabled(),
+			"auth_enabled":   authEnabled,
+		},
+		"metrics":  d.metrics.Snapshot(),
+		"requests": d.metrics.RecentRequests(limit),
+	})
+}
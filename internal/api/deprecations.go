@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"llm-proxy/internal/config"
+)
+
+// DeprecatedModelHeader names the deprecated model a request asked for; the
+// Warning header says why and what to use instead.
+const DeprecatedModelHeader = "X-LLM-Proxy-Deprecated-Model"
+
+// SetDeprecatedModels replaces the deprecated model IDs and their
+// redirects.
+func (s *Server) SetDeprecatedModels(models map[string]config.DeprecatedModel) {
+	s.deprecated.Store(&models)
+}
+
+// redirectModel returns the model to serve for a request for model: its
+// replacement when model is deprecated and redirected, else model itself.
+// A deprecated model gets a Warning header and is counted in the metrics;
+// false means the key may not use the replacement and a 403 was written.
+func (s *Server) redirectModel(w http.ResponseWriter, r *http.Request, model string) (string, bool) {
+	models := s.deprecated.Load()
+	if models == nil {
+		return model, true
+	}
+	d, ok := (*models)[model]
+	if !ok {
+		return model, true
+	}
+	msg := d.Message
+	switch {
+	case msg != "":
+	case d.ReplacedBy != "":
+		msg = fmt.Sprintf("model %s is deprecated and was served by %s; request %s instead", model, d.ReplacedBy, d.ReplacedBy)
+	default:
+		msg = fmt.Sprintf("model %s is deprecated", model)
+	}
+	w.Header().Set(DeprecatedModelHeader, model)
+	w.Header().Add("Warning", "299 - "+strconv.Quote(msg))
+	ObserveDeprecatedModel(w, model)
+	if d.ReplacedBy == "" {
+		return model, true
+	}
+	if !allowModel(w, r, d.ReplacedBy) {
+		return "", false
+	}
+	ObserveModel(w, d.ReplacedBy)
+	return d.ReplacedBy, true
+}
+
+type deprecationObserver interface {
+	SetDeprecatedModel(model string)
+}
+
+// ObserveDeprecatedModel records that the request asked for a deprecated
+// model, which the metrics count per model.
+func ObserveDeprecatedModel(w http.ResponseWriter, model string) {
+	if mw, ok := w.(deprecationObserver); ok {
+		mw.SetDeprecatedModel(model)
+	}
+}
+
+func (r *statusRecorder) SetDeprecatedModel(model string) {
+	r.deprecatedModel = model
+}
+
+func (m *Metrics) observeDeprecatedModel(model string) {
+	m.modelMu.Lock()
+	defer m.modelMu.Unlock()
+	if m.deprecatedCounts == nil {
+		m.deprecatedCounts = make(map[string]uint64)
+	}
+	m.deprecatedCounts[model]++
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+)
+
+func TestDeprecatedModelsRedirectWithWarning(t *testing.T) {
+	m1 := &streamingTestAdapter{model: "m1", deltas: []string{"ok"}}
+	s := NewServer(proxy.NewRouter(m1, &streamingTestAdapter{model: "m2"}))
+	s.SetDeprecatedModels(map[string]config.DeprecatedModel{
+		"m0":  {ReplacedBy: "m1"},
+		"m2":  {Message: "m2 retires on 2027-01-01"},
+		"gpt": {ReplacedBy: "m1"},
+	})
+	metrics := NewMetrics()
+	h := metrics.Middleware(http.HandlerFunc(s.CreateChatCompletion))
+	send := func(model string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"`+model+`","messages":[{"role":"user","content":"hi"}]}`))))
+		return w
+	}
+
+	w := send("m0")
+	if w.Code != http.StatusOK {
+		t.Fatalf("redirected request: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Model != "m1" || len(m1.chats) != 1 || m1.chats[0].Model != "m1" {
+		t.Fatalf("expected m1 to serve the request, got model %q and chats %+v", resp.Model, m1.chats)
+	}
+	if got := w.Header().Get(DeprecatedModelHeader); got != "m0" {
+		t.Fatalf("%s = %q", DeprecatedModelHeader, got)
+	}
+	if got := w.Header().Get("Warning"); !strings.HasPrefix(got, "299 - ") || !strings.Contains(got, "served by m1") {
+		t.Fatalf("Warning = %q", got)
+	}
+
+	w = send("m2")
+	if got := w.Header().Get("Warning"); got != `299 - "m2 retires on 2027-01-01"` {
+		t.Fatalf("Warning = %q (status %d)", got, w.Code)
+	}
+	send("m0")
+	if w := send("m1"); w.Header().Get("Warning") != "" {
+		t.Fatalf("unexpected warning for a current model: %q", w.Header().Get("Warning"))
+	}
+
+	got := metrics.Snapshot().DeprecatedModels
+	if got["m0"] != 2 || got["m2"] != 1 || len(got) != 2 {
+		t.Fatalf("deprecated_models = %v", got)
+	}
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// What a DiffOp does.
+const (
+	DiffEqual  = "equal"
+	DiffDelete = "delete"
+	DiffInsert = "insert"
+)
+
+// maxDiffEdits bounds the work WordDiff does: texts more than this many words
+// apart are diffed as a replacement of everything between their common
+// prefix and suffix.
+const maxDiffEdits = 2000
+
+// DiffOp is a run of a word-level diff: text both sides share (equal), or
+// text only the first side (delete) or the second side (insert) has.
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// WordDiff diffs b against a word by word: words, runs of whitespace and
+// each punctuation mark are compared whole. The equal and delete runs spell
+// out a, the equal and insert runs spell out b. Replays and shadow runs are
+// diffed against the output they rerun; there is no /v1/compare endpoint
+// running one prompt on two models side by side.
+func WordDiff(a, b string) []DiffOp {
+	x, y := splitWords(a), splitWords(b)
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	var edits []DiffOp
+	for _, w := range x[:prefix] {
+		edits = append(edits, DiffOp{Op: DiffEqual, Text: w})
+	}
+	mx, my := x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+	if middle, ok := myersDiff(mx, my); ok {
+		edits = append(edits, middle...)
+	} else {
+		for _, w := range mx {
+			edits = append(edits, DiffOp{Op: DiffDelete, Text: w})
+		}
+		for _, w := range my {
+			edits = append(edits, DiffOp{Op: DiffInsert, Text: w})
+		}
+	}
+	for _, w := range x[len(x)-suffix:] {
+		edits = append(edits, DiffOp{Op: DiffEqual, Text: w})
+	}
+	return mergeDiff(edits)
+}
+
+// mergeDiff joins word edits into runs. Between two equal runs the deleted
+// words come first, then the inserted ones, and whitespace alone between
+// changes joins them, so "the old" to "a new" reads as one replacement.
+func mergeDiff(edits []DiffOp) []DiffOp {
+	var ops []DiffOp
+	var deleted, inserted strings.Builder
+	flush := func() {
+		if deleted.Len() > 0 {
+			ops = append(ops, DiffOp{Op: DiffDelete, Text: deleted.String()})
+		}
+		if inserted.Len() > 0 {
+			ops = append(ops, DiffOp{Op: DiffInsert, Text: inserted.String()})
+		}
+		deleted.Reset()
+		inserted.Reset()
+	}
+	for i, e := range edits {
+		switch {
+		case e.Op == DiffDelete:
+			deleted.WriteString(e.Text)
+		case e.Op == DiffInsert:
+			inserted.WriteString(e.Text)
+		case strings.TrimSpace(e.Text) == "" && i > 0 && edits[i-1].Op != DiffEqual && i+1 < len(edits) && edits[i+1].Op != DiffEqual:
+			deleted.WriteString(e.Text)
+			inserted.WriteString(e.Text)
+		default:
+			flush()
+			if n := len(ops); n > 0 && ops[n-1].Op == DiffEqual {
+				ops[n-1].Text += e.Text
+			} else {
+				ops = append(ops, e)
+			}
+		}
+	}
+	flush()
+	return ops
+}
+
+// myersDiff returns the shortest edit script turning a into b, one word per
+// op, or false when it takes more than maxDiffEdits edits. See Myers, "An
+// O(ND) Difference Algorithm and Its Variations" (1986).
+func myersDiff(a, b []string) ([]DiffOp, bool) {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] is v over diagonals -d..d as step d started.
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		if d > maxDiffEdits {
+			return nil, false
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return myersPath(a, b, trace), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// myersPath walks the trace of myersDiff back from the end of a and b.
+func myersPath(a, b []string, trace [][]int) []DiffOp {
+	var rev []DiffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		}
+		prevX := v[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			rev = append(rev, DiffOp{Op: DiffEqual, Text: a[x]})
+		}
+		if x == prevX {
+			y--
+			rev = append(rev, DiffOp{Op: DiffInsert, Text: b[y]})
+		} else {
+			x--
+			rev = append(rev, DiffOp{Op: DiffDelete, Text: a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x, y = x-1, y-1
+		rev = append(rev, DiffOp{Op: DiffEqual, Text: a[x]})
+	}
+	ops := make([]DiffOp, len(rev))
+	for i, op := range rev {
+		ops[len(rev)-1-i] = op
+	}
+	return ops
+}
+
+// splitWords cuts s into words (letters, digits and underscores), runs of
+// whitespace and single other characters.
+func splitWords(s string) []string {
+	class := func(r rune) int {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 0
+	}
+	var words []string
+	start, prev := 0, -1
+	for i, r := range s {
+		c := class(r)
+		if i > start && (c != prev || c == 0) {
+			words = append(words, s[start:i])
+			start = i
+		}
+		prev = c
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+// DiffChanged counts the words and marks a diff deletes and inserts,
+// leaving whitespace out.
+func DiffChanged(ops []DiffOp) (deleted, inserted int) {
+	for _, op := range ops {
+		n := 0
+		for _, w := range splitWords(op.Text) {
+			if r, _ := utf8.DecodeRuneInString(w); !unicode.IsSpace(r) {
+				n++
+			}
+		}
+		switch op.Op {
+		case DiffDelete:
+			deleted += n
+		case DiffInsert:
+			inserted += n
+		}
+	}
+	return deleted, inserted
+}
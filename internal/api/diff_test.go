@@ -0,0 +1,51 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWordDiff(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want []DiffOp
+	}{
+		{"same text", "same text", []DiffOp{{DiffEqual, "same text"}}},
+		{"", "new", []DiffOp{{DiffInsert, "new"}}},
+		{"the cat sat.", "the dog sat!", []DiffOp{
+			{DiffEqual, "the "}, {DiffDelete, "cat"}, {DiffInsert, "dog"}, {DiffEqual, " sat"}, {DiffDelete, "."}, {DiffInsert, "!"},
+		}},
+		{"a b c d", "a c d e", []DiffOp{
+			{DiffEqual, "a "}, {DiffDelete, "b "}, {DiffEqual, "c d"}, {DiffInsert, " e"},
+		}},
+	} {
+		got := WordDiff(tc.a, tc.b)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("WordDiff(%q, %q) = %+v, want %+v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestWordDiffSpellsOutBothSides(t *testing.T) {
+	a := strings.Repeat("one two three four five ", 300) + "end"
+	b := strings.ReplaceAll(a, "three", "3") + " appended"
+	// The last pair is too far apart for a word-by-word diff.
+	for _, pair := range [][2]string{{a, b}, {b, a}, {strings.Repeat("x ", 3000), strings.Repeat("y ", 3000)}} {
+		var gotA, gotB strings.Builder
+		for _, op := range WordDiff(pair[0], pair[1]) {
+			if op.Op != DiffInsert {
+				gotA.WriteString(op.Text)
+			}
+			if op.Op != DiffDelete {
+				gotB.WriteString(op.Text)
+			}
+		}
+		if gotA.String() != pair[0] || gotB.String() != pair[1] {
+			t.Fatal("the diff does not spell out both texts")
+		}
+	}
+	if deleted, inserted := DiffChanged(WordDiff(a, b)); deleted != 300 || inserted != 301 {
+		t.Fatalf("DiffChanged = %d deleted, %d inserted; want 300, 301", deleted, inserted)
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"llm-proxy/openapi"
+)
+
+//go:embed docs.html
+var docsHTML []byte
+
+// openAPIJSON is the embedded OpenAPI document converted to JSON.
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	var doc any
+	if err := yaml.Unmarshal(openapi.YAML, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+})
+
+// RegisterDocsRoutes serves the OpenAPI document the API is generated from,
+// as /openapi.json and /openapi.yaml, and a viewer for it at /docs.
+func RegisterDocsRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /openapi.json", serveOpenAPIJSON)
+	mux.HandleFunc("GET /openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(openapi.YAML)
+	})
+	mux.HandleFunc("GET /docs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(docsHTML)
+	})
+}
+
+func serveOpenAPIJSON(w http.ResponseWriter, r *http.Request) {
+	doc, err := openAPIJSON()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "invalid OpenAPI document: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(doc)
+}
+
+func isDocsPath(path string) bool {
+	return path == "/openapi.json" || path == "/openapi.yaml" || path == "/docs"
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+)
+
+func TestOpenAPIDocumentMatchesRoutes(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &streamingTestAdapter{model: "m2"}))
+	mux := http.NewServeMux()
+	s.RegisterAdminRoutes(mux)
+	NewMetrics().RegisterAdminRoutes(mux)
+	RegisterDocsRoutes(mux)
+	openapiv1.HandlerFromMux(s, mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/openapi.json = %d", w.Code)
+	}
+	var spec struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if spec.Info.Version == "" || len(spec.Paths) == 0 {
+		t.Fatalf("spec = %+v", spec)
+	}
+
+	// Every documented operation must be served.
+	param := regexp.MustCompile(`\{[^}]+\}`)
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			req := httptest.NewRequest(strings.ToUpper(method), param.ReplaceAllString(path, "x"), nil)
+			if _, pattern := mux.Handler(req); pattern == "" {
+				t.Errorf("%s %s is documented but not routed", strings.ToUpper(method), path)
+			}
+		}
+	}
+	for _, path := range []string{"/admin/health", "/readyz", "/healthz", "/docs"} {
+		if spec.Paths[path] == nil {
+			t.Errorf("%s is not documented", path)
+		}
+	}
+}
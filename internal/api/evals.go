@@ -0,0 +1,384 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/openapiv1"
+)
+
+const (
+	defaultEvalConcurrency = 2
+	maxEvalConcurrency     = 8
+	maxEvalItems           = 1000
+	// maxEvalLine caps an item of a JSONL eval.
+	maxEvalLine = 1 << 20
+	// maxEvalRuns is how many eval runs are kept in memory. The oldest
+	// finished ones make room for new runs; with this many still running,
+	// new ones are refused.
+	maxEvalRuns = 20
+)
+
+// evalRun is an eval submitted through POST /v1/evals. Each item runs on
+// every model as a batch chat completion.
+type evalRun struct {
+	owner    string
+	items    []openapiv1.EvalItem
+	patterns []*regexp.Regexp
+	cancel   context.CancelFunc
+
+	mu  sync.Mutex
+	run openapiv1.EvalRun
+	// results[i][j] is item i on model j, nil until it finished.
+	results [][]*openapiv1.EvalResult
+}
+
+type evalRuns struct {
+	mu   sync.Mutex
+	runs []*evalRun
+}
+
+// add keeps e, dropping the oldest finished run when full. False means
+// maxEvalRuns runs are still going.
+func (f *evalRuns) add(e *evalRun) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.runs) >= maxEvalRuns {
+		i := 0
+		for i < len(f.runs) && f.runs[i].snapshot().Status == openapiv1.EvalRunStatusRunning {
+			i++
+		}
+		if i == len(f.runs) {
+			return false
+		}
+		f.runs = append(f.runs[:i], f.runs[i+1:]...)
+	}
+	f.runs = append(f.runs, e)
+	return true
+}
+
+// get returns eval run id if owner submitted it.
+func (f *evalRuns) get(id, owner string) (*evalRun, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.runs {
+		if e.run.Id == id && e.owner == owner {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) CreateEval(w http.ResponseWriter, r *http.Request, params openapiv1.CreateEvalParams) {
+	req, err := evalRequest(r, params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	for _, model := range req.Models {
+		if !allowModel(w, r, model) {
+			return
+		}
+	}
+	e := &evalRun{owner: keyName(r), items: req.Items}
+	for i, item := range req.Items {
+		if item.Id == nil {
+			id := strconv.Itoa(i + 1)
+			e.items[i].Id = &id
+		}
+		var re *regexp.Regexp
+		if item.Match != nil && *item.Match == openapiv1.Regex && item.Expected != nil {
+			if re, err = regexp.Compile(*item.Expected); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("items[%d].expected: %v", i, err))
+				return
+			}
+		}
+		e.patterns = append(e.patterns, re)
+		e.results = append(e.results, make([]*openapiv1.EvalResult, len(req.Models)))
+	}
+	concurrency := defaultEvalConcurrency
+	if req.Concurrency != nil {
+		concurrency = *req.Concurrency
+	}
+	e.run = openapiv1.EvalRun{
+		Id:        genID("eval"),
+		Object:    openapiv1.EvalRunObjectEvalRun,
+		Status:    openapiv1.EvalRunStatusRunning,
+		CreatedAt: int(time.Now().Unix()),
+		Models:    req.Models,
+		Total:     len(req.Items) * len(req.Models),
+	}
+	// The run outlives the request but keeps its key, for model
+	// allowlists, budgets and profiles.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	e.cancel = cancel
+	if !s.evals.add(e) {
+		cancel()
+		writeError(w, http.StatusTooManyRequests, "rate_limit_exceeded", fmt.Sprintf("%d eval runs are already running", maxEvalRuns))
+		return
+	}
+	go s.runEval(ctx, e, r.Header.Get(ProfileHeader), concurrency)
+	writeJSON(w, http.StatusAccepted, e.snapshot())
+}
+
+// evalRequest reads a JSON eval request, or a JSONL body of items with the
+// models and concurrency in params, and checks it.
+func evalRequest(r *http.Request, params openapiv1.CreateEvalParams) (openapiv1.EvalRequest, error) {
+	var req openapiv1.EvalRequest
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/jsonl", "application/x-ndjson":
+		if params.Models != nil {
+			for _, m := range strings.Split(*params.Models, ",") {
+				req.Models = append(req.Models, strings.TrimSpace(m))
+			}
+		}
+		req.Concurrency = params.Concurrency
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxEvalLine)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var item openapiv1.EvalItem
+			if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+				return req, fmt.Errorf("line %d: %v", line, err)
+			}
+			req.Items = append(req.Items, item)
+		}
+		if err := scanner.Err(); err != nil {
+			return req, err
+		}
+	default:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, errors.New("invalid JSON body")
+		}
+	}
+
+	if len(req.Models) == 0 {
+		return req, errors.New("models are required")
+	}
+	for _, m := range req.Models {
+		if strings.TrimSpace(m) == "" {
+			return req, errors.New("models: empty model ID")
+		}
+	}
+	if len(req.Items) == 0 || len(req.Items) > maxEvalItems {
+		return req, fmt.Errorf("an eval takes 1 to %d items", maxEvalItems)
+	}
+	for i, item := range req.Items {
+		if strings.TrimSpace(item.Input) == "" {
+			return req, fmt.Errorf("items[%d].input: is required", i)
+		}
+		switch {
+		case item.Match == nil:
+		case *item.Match == openapiv1.Contains, *item.Match == openapiv1.Exact, *item.Match == openapiv1.Regex:
+		default:
+			return req, fmt.Errorf("items[%d].match: unknown match %q", i, *item.Match)
+		}
+	}
+	if c := req.Concurrency; c != nil && (*c < 1 || *c > maxEvalConcurrency) {
+		return req, fmt.Errorf("concurrency must be between 1 and %d", maxEvalConcurrency)
+	}
+	return req, nil
+}
+
+// runEval runs every item of e on every model, concurrency at a time.
+func (s *Server) runEval(ctx context.Context, e *evalRun, profile string, concurrency int) {
+	type job struct{ item, model int }
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				res := s.runEvalItem(ctx, e, j.item, e.run.Models[j.model], profile)
+				if ctx.Err() != nil {
+					// Cancelled midway: there is no answer to keep.
+					continue
+				}
+				e.mu.Lock()
+				e.results[j.item][j.model] = res
+				e.run.Done++
+				e.mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := range e.items {
+		for j := range e.run.Models {
+			select {
+			case jobs <- job{i, j}:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	e.mu.Lock()
+	if e.run.Status == openapiv1.EvalRunStatusRunning {
+		e.run.Status = openapiv1.EvalRunStatusCompleted
+		now := int(time.Now().Unix())
+		e.run.CompletedAt = &now
+	}
+	e.mu.Unlock()
+	e.cancel()
+}
+
+// runEvalItem runs item i of e on model as a chat completion and scores the
+// answer.
+func (s *Server) runEvalItem(ctx context.Context, e *evalRun, i int, model, profile string) *openapiv1.EvalResult {
+	item := e.items[i]
+	var messages []map[string]string
+	if item.System != nil && *item.System != "" {
+		messages = append(messages, map[string]string{"role": "system", "content": *item.System})
+	}
+	messages = append(messages, map[string]string{"role": "user", "content": item.Input})
+	body, _ := json.Marshal(map[string]any{"model": model, "messages": messages})
+	res := &openapiv1.EvalResult{ItemId: *item.Id, Model: model, Expected: item.Expected}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		msg := err.Error()
+		res.Error = &msg
+		return res
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(PriorityHeader, config.PriorityBatch)
+	if profile != "" {
+		req.Header.Set(ProfileHeader, profile)
+	}
+	rec := &replayRecorder{header: http.Header{}}
+	started := time.Now()
+	s.CreateChatCompletion(rec, req)
+	run := replayResult(rec.body.Bytes())
+	res.Status = rec.statusCode()
+	res.Output = run.Output
+	res.LatencyMs = float32(durationMs(time.Since(started)))
+	if run.Error != "" {
+		res.Error = &run.Error
+	}
+	if item.Expected != nil {
+		passed := res.Status == http.StatusOK && evalPassed(item, e.patterns[i], run.Output)
+		res.Passed = &passed
+	}
+	return res
+}
+
+// evalPassed reports whether output matches what item expects.
+func evalPassed(item openapiv1.EvalItem, re *regexp.Regexp, output string) bool {
+	if re != nil {
+		return re.MatchString(output)
+	}
+	got := strings.ToLower(strings.TrimSpace(output))
+	want := strings.ToLower(strings.TrimSpace(*item.Expected))
+	if item.Match != nil && *item.Match == openapiv1.Exact {
+		return got == want
+	}
+	return strings.Contains(got, want)
+}
+
+// snapshot is the run's state with a summary per model.
+func (e *evalRun) snapshot() openapiv1.EvalRun {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	run := e.run
+	run.Summary = make([]openapiv1.EvalModelSummary, len(run.Models))
+	for j, model := range run.Models {
+		sum := openapiv1.EvalModelSummary{Model: model}
+		var latency float32
+		for _, results := range e.results {
+			res := results[j]
+			if res == nil {
+				continue
+			}
+			sum.Runs++
+			latency += res.LatencyMs
+			if res.Status != http.StatusOK {
+				sum.Failed++
+			}
+			if res.Passed != nil {
+				sum.Scored++
+				if *res.Passed {
+					sum.Passed++
+				}
+			}
+		}
+		if sum.Runs > 0 {
+			sum.AvgLatencyMs = latency / float32(sum.Runs)
+		}
+		if sum.Scored > 0 {
+			rate := float32(sum.Passed) / float32(sum.Scored)
+			sum.PassRate = &rate
+		}
+		run.Summary[j] = sum
+	}
+	return run
+}
+
+func (s *Server) evalNotFound(w http.ResponseWriter, id string) {
+	writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("Eval run with id '%s' not found.", id))
+}
+
+func (s *Server) GetEval(w http.ResponseWriter, r *http.Request, evalID string) {
+	e, ok := s.evals.get(evalID, keyName(r))
+	if !ok {
+		s.evalNotFound(w, evalID)
+		return
+	}
+	writeJSON(w, http.StatusOK, e.snapshot())
+}
+
+func (s *Server) CancelEval(w http.ResponseWriter, r *http.Request, evalID string) {
+	e, ok := s.evals.get(evalID, keyName(r))
+	if !ok {
+		s.evalNotFound(w, evalID)
+		return
+	}
+	e.mu.Lock()
+	if e.run.Status == openapiv1.EvalRunStatusRunning {
+		e.run.Status = openapiv1.EvalRunStatusCancelled
+		now := int(time.Now().Unix())
+		e.run.CompletedAt = &now
+	}
+	e.mu.Unlock()
+	e.cancel()
+	writeJSON(w, http.StatusOK, e.snapshot())
+}
+
+func (s *Server) GetEvalResults(w http.ResponseWriter, r *http.Request, evalID string) {
+	e, ok := s.evals.get(evalID, keyName(r))
+	if !ok {
+		s.evalNotFound(w, evalID)
+		return
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	e.mu.Lock()
+	for _, results := range e.results {
+		for _, res := range results {
+			if res != nil {
+				_ = enc.Encode(res)
+			}
+		}
+	}
+	e.mu.Unlock()
+	w.Header().Set("Content-Type", "application/jsonl")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
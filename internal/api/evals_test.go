@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+)
+
+func TestEvalRunsItemsOnEveryModelAndScoresThem(t *testing.T) {
+	s := NewServer(proxy.NewRouter(
+		&streamingTestAdapter{model: "m1", deltas: []string{"Paris is the capital."}},
+		&streamingTestAdapter{model: "m2", deltas: []string{" Lyon "}},
+	))
+	h := openapiv1.HandlerFromMux(s, http.NewServeMux())
+	as := func(r *http.Request, key string) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, &APIKey{Name: key}))
+	}
+	do := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, as(r, "alice"))
+		return w
+	}
+	wait := func(id string) openapiv1.EvalRun {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			w := do(httptest.NewRequest(http.MethodGet, "/v1/evals/"+id, nil))
+			var run openapiv1.EvalRun
+			if err := json.Unmarshal(w.Body.Bytes(), &run); err != nil {
+				t.Fatalf("eval %s: %d %s", id, w.Code, w.Body)
+			}
+			if run.Status != openapiv1.EvalRunStatusRunning {
+				return run
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("eval %s is still running: %+v", id, run)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	w := do(httptest.NewRequest(http.MethodPost, "/v1/evals", strings.NewReader(`{"models":["m1","m2"],"concurrency":3,"items":[
+		{"id":"capital","input":"Capital of France?","expected":"paris"},
+		{"input":"Name a French city.","expected":"lyon","match":"exact"},
+		{"input":"Say anything."}]}`)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("create eval: %d %s", w.Code, w.Body)
+	}
+	var created openapiv1.EvalRun
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Total != 6 || created.Object != openapiv1.EvalRunObjectEvalRun {
+		t.Fatalf("created eval = %+v", created)
+	}
+
+	run := wait(created.Id)
+	if run.Status != openapiv1.EvalRunStatusCompleted || run.Done != 6 || run.CompletedAt == nil {
+		t.Fatalf("eval = %+v", run)
+	}
+	for _, sum := range run.Summary {
+		if sum.Runs != 3 || sum.Failed != 0 || sum.Scored != 2 || sum.Passed != 1 || sum.PassRate == nil || *sum.PassRate != 0.5 {
+			t.Fatalf("summary for %s = %+v", sum.Model, sum)
+		}
+	}
+
+	w = do(httptest.NewRequest(http.MethodGet, "/v1/evals/"+created.Id+"/results", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/jsonl" {
+		t.Fatalf("results content type = %q", ct)
+	}
+	passed := map[string]bool{}
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var res openapiv1.EvalResult
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			t.Fatalf("results line %q: %v", scanner.Text(), err)
+		}
+		if res.Passed != nil {
+			passed[res.ItemId+"/"+res.Model] = *res.Passed
+		}
+	}
+	want := map[string]bool{"capital/m1": true, "capital/m2": false, "2/m1": false, "2/m2": true}
+	if len(passed) != len(want) {
+		t.Fatalf("scored results = %v, want %v", passed, want)
+	}
+	for k, v := range want {
+		if passed[k] != v {
+			t.Fatalf("scored results = %v, want %v", passed, want)
+		}
+	}
+
+	other := httptest.NewRecorder()
+	h.ServeHTTP(other, as(httptest.NewRequest(http.MethodGet, "/v1/evals/"+created.Id, nil), "bob"))
+	if other.Code != http.StatusNotFound {
+		t.Fatalf("another key read the eval: %d", other.Code)
+	}
+	w = do(httptest.NewRequest(http.MethodPost, "/v1/evals/"+created.Id+"/cancel", nil))
+	var cancelled openapiv1.EvalRun
+	_ = json.Unmarshal(w.Body.Bytes(), &cancelled)
+	if w.Code != http.StatusOK || cancelled.Status != openapiv1.EvalRunStatusCompleted {
+		t.Fatalf("cancelling a finished eval: %d %s", w.Code, w.Body)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/evals?models=m2&concurrency=1", strings.NewReader(
+		`{"input":"one","expected":"(?i)^\\s*lyon\\s*$","match":"regex"}`+"\n\n"+`{"id":"two","input":"two","expected":"paris"}`+"\n"))
+	r.Header.Set("Content-Type", "application/jsonl")
+	w = do(r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("create JSONL eval: %d %s", w.Code, w.Body)
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	run = wait(created.Id)
+	if len(run.Summary) != 1 || run.Summary[0].Scored != 2 || run.Summary[0].Passed != 1 {
+		t.Fatalf("JSONL eval = %+v", run)
+	}
+}
+
+func TestEvalRejectsBadRequests(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &streamingTestAdapter{model: "m2"}))
+	h := openapiv1.HandlerFromMux(s, http.NewServeMux())
+	cases := []struct {
+		body, want string
+	}{
+		{`{"items":[{"input":"hi"}]}`, "models are required"},
+		{`{"models":["m1"],"items":[]}`, "an eval takes 1 to"},
+		{`{"models":["m1"],"items":[{"input":" "}]}`, "items[0].input: is required"},
+		{`{"models":["m1"],"items":[{"input":"hi","match":"fuzzy"}]}`, "unknown match"},
+		{`{"models":["m1"],"concurrency":9,"items":[{"input":"hi"}]}`, "concurrency must be between 1 and 8"},
+		{`{"models":["m1"],"items":[{"input":"hi","expected":"(","match":"regex"}]}`, "items[0].expected"},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/evals", strings.NewReader(tc.body)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tc.want) {
+			t.Fatalf("%s: got %d %s, want 400 with %q", tc.body, w.Code, w.Body, tc.want)
+		}
+	}
+}
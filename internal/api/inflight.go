@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errResponseCancelled is the cancel cause of a response stopped through
+// POST /v1/responses/{id}/cancel.
+var errResponseCancelled = errors.New("response was cancelled")
+
+type inflightResponse struct {
+	owner     string
+	model     string
+	createdAt int64
+	cancel    context.CancelCauseFunc
+}
+
+// inflightResponses tracks Responses API turns that are queued or running so
+// they can be cancelled by ID.
+type inflightResponses struct {
+	mu sync.Mutex
+	m  map[string]inflightResponse
+}
+
+// track registers response id for r and returns a context that is cancelled
+// with errResponseCancelled when the response is cancelled. The returned func
+// must be called once the turn is over.
+func (f *inflightResponses) track(r *http.Request, id, model string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(r.Context())
+	f.mu.Lock()
+	if f.m == nil {
+		f.m = map[string]inflightResponse{}
+	}
+	f.m[id] = inflightResponse{owner: keyName(r), model: model, createdAt: time.Now().Unix(), cancel: cancel}
+	f.mu.Unlock()
+	return ctx, func() {
+		f.mu.Lock()
+		delete(f.m, id)
+		f.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancel stops response id if it is in flight and owned by owner.
+func (f *inflightResponses) cancel(id, owner string) (inflightResponse, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp, ok := f.m[id]
+	if !ok || resp.owner != owner {
+		return inflightResponse{}, false
+	}
+	delete(f.m, id)
+	resp.cancel(errResponseCancelled)
+	return resp, true
+}
+
+// CancelResponse aborts a queued or running response. The backend turn is
+// stopped (Codex turns are interrupted, Claude processes killed) and the
+// original request ends with status "cancelled".
+func (s *Server) CancelResponse(w http.ResponseWriter, r *http.Request, responseID string) {
+	resp, ok := s.inflight.cancel(responseID, keyName(r))
+	if !ok {
+		if s.store != nil {
+			if stored, found, _ := s.store.Response(responseID); found && stored.Owner == keyName(r) {
+				writeError(w, http.StatusBadRequest, "invalid_request_error", "Cannot cancel a completed response.")
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "invalid_request_error", "Response with id '"+responseID+"' not found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, cancelledResponse(responseID, resp.model, resp.createdAt))
+}
+
+func cancelledResponse(id, model string, createdAt int64) map[string]any {
+	return responseObject(id, model, createdAt, "cancelled", []any{})
+}
+
+// writeStreamCancelled ends a response stream stopped by CancelResponse.
+func writeStreamCancelled(events eventWriter) {
+	_ = events.writeJSON(map[string]any{
+		"type":  "error",
+		"error": map[string]any{"type": "cancelled", "message": errResponseCancelled.Error()},
+	})
+	_ = events.writeDone()
+}
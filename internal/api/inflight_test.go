@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"llm-proxy/internal/proxy"
+)
+
+type blockingAdapter struct {
+	streamingTestAdapter
+	started chan struct{}
+}
+
+func (a *blockingAdapter) Respond(ctx context.Context, _ proxy.ResponsesRequest) (proxy.ResponsesResponse, error) {
+	close(a.started)
+	<-ctx.Done()
+	return proxy.ResponsesResponse{}, ctx.Err()
+}
+
+func TestCancelResponseStopsRunningTurn(t *testing.T) {
+	adapter := &blockingAdapter{streamingTestAdapter: streamingTestAdapter{model: "m1"}, started: make(chan struct{})}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+	as := func(r *http.Request, key string) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, &APIKey{Name: key}))
+	}
+
+	w := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		s.CreateResponse(w, as(httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader([]byte(`{"model":"m1","input":"hi"}`))), "alice"))
+	}()
+	<-adapter.started
+
+	s.inflight.mu.Lock()
+	var id string
+	for k := range s.inflight.m {
+		id = k
+	}
+	s.inflight.mu.Unlock()
+
+	other := httptest.NewRecorder()
+	s.CancelResponse(other, as(httptest.NewRequest(http.MethodPost, "/v1/responses/"+id+"/cancel", nil), "bob"), id)
+	if other.Code != http.StatusNotFound {
+		t.Fatalf("another key cancelled the response: %d", other.Code)
+	}
+
+	cw := httptest.NewRecorder()
+	s.CancelResponse(cw, as(httptest.NewRequest(http.MethodPost, "/v1/responses/"+id+"/cancel", nil), "alice"), id)
+	if cw.Code != http.StatusOK {
+		t.Fatalf("cancel: %d %s", cw.Code, cw.Body)
+	}
+	<-finished
+
+	var got map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["id"] != id || got["status"] != "cancelled" {
+		t.Fatalf("original request got %s", w.Body)
+	}
+}
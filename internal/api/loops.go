@@ -0,0 +1,173 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"llm-proxy/internal/proxy"
+)
+
+// loopWindow is how far back identical requests are counted.
+const loopWindow = time.Minute
+
+// loopDetector spots agentic clients stuck in a loop: the same request sent
+// over and over, or a conversation whose last turns repeat the same tool
+// call.
+type loopDetector struct {
+	mu        sync.Mutex
+	repeats   int
+	toolCalls int
+	seen      map[[sha256.Size]byte][]time.Time
+	lastGC    time.Time
+}
+
+// SetLoopLimits sets how many identical requests a key may send within a
+// minute, and how many identical tool calls (for chat, assistant turns) may
+// end a conversation, before requests are refused; zero disables a check.
+func (s *Server) SetLoopLimits(repeats, toolCalls int) {
+	s.loops.mu.Lock()
+	defer s.loops.mu.Unlock()
+	s.loops.repeats = repeats
+	s.loops.toolCalls = toolCalls
+	s.loops.seen = nil
+}
+
+// repeated records a request with fingerprint id and reports how many times
+// it was seen within the window, if that reaches the limit.
+func (d *loopDetector) repeated(id [sha256.Size]byte, now time.Time) (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.repeats <= 0 {
+		return 0, false
+	}
+	if d.seen == nil {
+		d.seen = map[[sha256.Size]byte][]time.Time{}
+	}
+	cutoff := now.Add(-loopWindow)
+	if now.Sub(d.lastGC) > loopWindow {
+		for k, times := range d.seen {
+			if times[len(times)-1].Before(cutoff) {
+				delete(d.seen, k)
+			}
+		}
+		d.lastGC = now
+	}
+	times := d.seen[id]
+	for len(times) > 0 && times[0].Before(cutoff) {
+		times = times[1:]
+	}
+	times = append(times, now)
+	d.seen[id] = times
+	return len(times), len(times) >= d.repeats
+}
+
+func (d *loopDetector) toolCallLimit() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.toolCalls
+}
+
+// allowLoop refuses a request that repeats itself: payload (the model and
+// its prompt) sent too often by the same key, or calls — the conversation's
+// trailing tool calls — all the same. The 400 it writes has code
+// "loop_detected" so agents and their users can tell it from other errors.
+func (s *Server) allowLoop(w http.ResponseWriter, r *http.Request, payload any, calls []string) bool {
+	raw, _ := json.Marshal(payload)
+	id := sha256.Sum256(append([]byte(keyName(r)+"\x00"), raw...))
+	var reason string
+	if n, loop := s.loops.repeated(id, time.Now()); loop {
+		reason = fmt.Sprintf("the same request was sent %d times within a minute", n)
+	} else if limit := s.loops.toolCallLimit(); limit > 0 && len(calls) >= limit {
+		reason = fmt.Sprintf("the conversation ends with the same tool call repeated %d times", len(calls))
+	}
+	if reason == "" {
+		return true
+	}
+	ObserveLoop(w, reason)
+	writeJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{
+		"type":    "invalid_request_error",
+		"code":    "loop_detected",
+		"message": "loop detected: " + reason + "; stopping the agent instead of sending it upstream again",
+	}})
+	return false
+}
+
+// repeatedAssistantTurns returns the trailing run of identical assistant
+// messages, ignoring the user and tool turns between them: a chat agent
+// that keeps answering with the same action.
+func repeatedAssistantTurns(messages []proxy.Message) []string {
+	var run []string
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		if m.Role != "assistant" {
+			continue
+		}
+		if m.Content == "" || (len(run) > 0 && m.Content != run[0]) {
+			break
+		}
+		run = append(run, m.Content)
+	}
+	return run
+}
+
+// repeatedFunctionCalls returns the trailing run of identical function_call
+// items (same name and arguments) in a /v1/responses input.
+func repeatedFunctionCalls(input any) []string {
+	items, _ := input.([]any)
+	var run []string
+	for i := len(items) - 1; i >= 0; i-- {
+		item, _ := items[i].(map[string]any)
+		if item["type"] != "function_call" {
+			continue
+		}
+		name, _ := item["name"].(string)
+		args, _ := item["arguments"].(string)
+		call := name + "(" + args + ")"
+		if len(run) > 0 && call != run[0] {
+			break
+		}
+		run = append(run, call)
+	}
+	return run
+}
+
+type loopObserver interface {
+	SetLoop(reason string)
+}
+
+// ObserveLoop records that the request was refused as part of a loop, which
+// the metrics keep as an alert.
+func ObserveLoop(w http.ResponseWriter, reason string) {
+	if mw, ok := w.(loopObserver); ok {
+		mw.SetLoop(reason)
+	}
+}
+
+func (r *statusRecorder) SetLoop(reason string) {
+	r.loop = reason
+}
+
+// maxLoopAlerts is how many recent loop alerts the metrics keep.
+const maxLoopAlerts = 20
+
+// LoopAlert is a request refused because its client was looping.
+type LoopAlert struct {
+	Time   time.Time `json:"time"`
+	Key    string    `json:"key,omitempty"`
+	Model  string    `json:"model,omitempty"`
+	Reason string    `json:"reason"`
+}
+
+func (m *Metrics) observeLoop(alert LoopAlert) {
+	m.loopMu.Lock()
+	defer m.loopMu.Unlock()
+	m.loopsDetected++
+	m.loopAlerts = append(m.loopAlerts, alert)
+	if len(m.loopAlerts) > maxLoopAlerts {
+		m.loopAlerts = m.loopAlerts[len(m.loopAlerts)-maxLoopAlerts:]
+	}
+}
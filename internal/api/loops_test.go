@@ -0,0 +1,64 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-proxy/internal/proxy"
+)
+
+func TestLoopDetectionStopsRepeatedRequests(t *testing.T) {
+	m := NewMetrics()
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1", deltas: []string{"ok"}}, &streamingTestAdapter{model: "m2"}))
+	s.SetLoopLimits(3, 0)
+	h := m.Middleware(http.HandlerFunc(s.CreateChatCompletion))
+
+	send := func(content string) *httptest.ResponseRecorder {
+		body := []byte(`{"model":"m1","messages":[{"role":"user","content":"` + content + `"}]}`)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body)))
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := send("hi"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: %d %s", i, w.Code, w.Body)
+		}
+	}
+	w := send("hi")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "loop_detected") {
+		t.Fatalf("expected loop_detected, got %d %s", w.Code, w.Body)
+	}
+	if w := send("something else"); w.Code != http.StatusOK {
+		t.Fatalf("a different request must go through, got %d", w.Code)
+	}
+
+	snap := m.Snapshot()
+	if snap.LoopsDetected != 1 || len(snap.LoopAlerts) != 1 || snap.LoopAlerts[0].Model != "m1" {
+		t.Fatalf("unexpected loop metrics %d %+v", snap.LoopsDetected, snap.LoopAlerts)
+	}
+}
+
+func TestLoopDetectionStopsRepeatedToolCalls(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &streamingTestAdapter{model: "m2"}))
+	s.SetLoopLimits(0, 3)
+
+	call := `{"type":"function_call","call_id":"c","name":"read_file","arguments":"{\"path\":\"a.go\"}"},{"type":"function_call_output","call_id":"c","output":"..."}`
+	cases := []struct {
+		input string
+		want  int
+	}{
+		{`[` + call + `,` + call + `]`, http.StatusOK},
+		{`[` + call + `,` + call + `,` + call + `]`, http.StatusBadRequest},
+		{`[` + call + `,` + call + `,` + strings.ReplaceAll(call, "a.go", "b.go") + `]`, http.StatusOK},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		s.CreateResponse(w, httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(`{"model":"m1","input":`+tc.input+`}`)))
+		if w.Code != tc.want {
+			t.Fatalf("input %s: got %d, want %d: %s", tc.input, w.Code, tc.want, w.Body)
+		}
+	}
+}
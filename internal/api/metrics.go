@@ -1,12 +1,17 @@
 package api
 
 import (
+	"maps"
+	"math"
 	"net/http"
 	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
 )
 
 type Metrics struct {
@@ -26,19 +31,196 @@ type Metrics struct {
 
 	bytesSent uint64
 
+	streamsCompleted      uint64
+	streamsClientAborted  uint64
+	streamsUpstreamFailed uint64
+	streamsCancelled      uint64
+
+	textFallbacks uint64
+
+	loopMu        sync.Mutex
+	loopsDetected uint64
+	loopAlerts    []LoopAlert
+
 	latencyTotalNs uint64
 	latencyMaxNs   uint64
 
 	modelMu     sync.RWMutex
 	modelCounts map[string]*modelCounters
+	keyCounts   map[string]*keyCounters
+	tagCounts   map[string]*keyCounters
+	userCounts  map[string]*keyCounters
+	pricing     map[string]config.ModelPrice
+	// deprecatedCounts counts requests per deprecated model ID.
+	deprecatedCounts map[string]uint64
+
+	// warmupMu guards the per-backend state: warm-up, usage-limit cooldowns,
+	// quotas and health.
+	warmupMu  sync.Mutex
+	warmup    map[proxy.Backend]WarmupStat
+	cooldowns map[cooldownKey]time.Time
+	quotas    []QuotaStat
+	health    []HealthStat
+
+	// windowMu guards the per-minute buckets behind the rolling windows and
+	// the time the counters started from.
+	windowMu sync.Mutex
+	windows  [windowMinutes]windowBucket
+	since    time.Time
+
+	logMu   sync.Mutex
+	log     []RequestLogEntry
+	logNext int
+	logSeq  uint64
+
+	accessLog atomic.Pointer[AccessLogger]
+	// afterRequest, when set, is called with each request logged; see
+	// Server.SetMetrics.
+	afterRequest func(RequestLogEntry)
 }
 
+const requestLogSize = 200
+
 func NewMetrics() *Metrics {
 	return &Metrics{
 		modelCounts: make(map[string]*modelCounters),
+		keyCounts:   make(map[string]*keyCounters),
+		tagCounts:   make(map[string]*keyCounters),
+		userCounts:  make(map[string]*keyCounters),
+		log:         make([]RequestLogEntry, 0, requestLogSize),
+		since:       time.Now(),
 	}
 }
 
+// Reset zeroes the counters and per-model, per-key, per-tag and per-user
+// stats, as after a restart. Backend state (warm-up, cooldowns, quotas and
+// health), requests in flight and the request log are kept.
+func (m *Metrics) Reset() {
+	for _, c := range []*uint64{
+		&m.requestsTotal, &m.errorsTotal,
+		&m.status2xx, &m.status3xx, &m.status4xx, &m.status5xx,
+		&m.modelsTotal, &m.chatCompletionsTotal, &m.responsesTotal, &m.otherTotal,
+		&m.bytesSent,
+		&m.streamsCompleted, &m.streamsClientAborted, &m.streamsUpstreamFailed, &m.streamsCancelled,
+		&m.textFallbacks,
+		&m.latencyTotalNs, &m.latencyMaxNs,
+	} {
+		atomic.StoreUint64(c, 0)
+	}
+	m.loopMu.Lock()
+	m.loopsDetected = 0
+	m.loopAlerts = nil
+	m.loopMu.Unlock()
+	m.modelMu.Lock()
+	m.modelCounts = make(map[string]*modelCounters)
+	m.keyCounts = make(map[string]*keyCounters)
+	m.tagCounts = make(map[string]*keyCounters)
+	m.userCounts = make(map[string]*keyCounters)
+	m.deprecatedCounts = nil
+	m.modelMu.Unlock()
+	m.windowMu.Lock()
+	m.windows = [windowMinutes]windowBucket{}
+	m.since = time.Now()
+	m.windowMu.Unlock()
+}
+
+type RequestLogEntry struct {
+	ID               uint64    `json:"id"`
+	Time             time.Time `json:"time"`
+	Method           string    `json:"method"`
+	Path             string    `json:"path"`
+	Model            string    `json:"model,omitempty"`
+	Key              string    `json:"key,omitempty"`
+	Tags             []string  `json:"tags,omitempty"`
+	User             string    `json:"user,omitempty"`
+	Status           int       `json:"status"`
+	LatencyMs        float64   `json:"latency_ms"`
+	BytesSent        uint64    `json:"bytes_sent"`
+	PromptTokens     uint64    `json:"prompt_tokens"`
+	CompletionTokens uint64    `json:"completion_tokens"`
+	Stream           bool      `json:"stream"`
+	TTFTMs           float64   `json:"ttft_ms,omitempty"`
+	Outcome          string    `json:"outcome,omitempty"`
+	// TextFallback is set when a Claude stream was rerun as plain text.
+	TextFallback bool            `json:"text_fallback,omitempty"`
+	Timings      *RequestTimings `json:"timings,omitempty"`
+	Stderr       string          `json:"stderr,omitempty"`
+	// Replayable is set for chat completions and responses kept with their
+	// body, which Server.Replay can run again.
+	Replayable bool `json:"replayable,omitempty"`
+	replay     *replayCapture
+}
+
+// RequestTimings splits a request's latency between the backend CLIs and
+// the proxy, to tell a slow CLI from proxy overhead. The CLI phases sum
+// over every CLI run serving the request; see proxy.CLITimings.
+type RequestTimings struct {
+	SpawnMs     float64 `json:"spawn_ms"`
+	FirstByteMs float64 `json:"first_byte_ms"`
+	StreamMs    float64 `json:"stream_ms"`
+	// SerializeMs is the time spent encoding and writing response bodies
+	// and stream events. Events are written while the CLI streams, so it
+	// overlaps StreamMs.
+	SerializeMs float64 `json:"serialize_ms"`
+	// ProxyMs is the latency not spent in a CLI: authentication, queueing,
+	// building prompts and writing the final response.
+	ProxyMs float64 `json:"proxy_ms"`
+}
+
+// requestTimings returns the breakdown of a request that took latency, or
+// nil when no CLI ran for it.
+func requestTimings(latency time.Duration, cli proxy.CLITimings, serialize time.Duration) *RequestTimings {
+	inCLI := cli.Spawn + cli.FirstByte + cli.Stream
+	if inCLI == 0 {
+		return nil
+	}
+	// Race entrants run side by side, so their sum can exceed the latency.
+	proxyTime := max(latency-inCLI, 0)
+	return &RequestTimings{
+		SpawnMs:     durationMs(cli.Spawn),
+		FirstByteMs: durationMs(cli.FirstByte),
+		StreamMs:    durationMs(cli.Stream),
+		SerializeMs: durationMs(serialize),
+		ProxyMs:     durationMs(proxyTime),
+	}
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// recordRequest adds e to the request log and returns the ID it got.
+func (m *Metrics) recordRequest(e RequestLogEntry) uint64 {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	m.logSeq++
+	e.ID = m.logSeq
+	if len(m.log) < requestLogSize {
+		m.log = append(m.log, e)
+		return e.ID
+	}
+	m.log[m.logNext] = e
+	m.logNext = (m.logNext + 1) % requestLogSize
+	return e.ID
+}
+
+// RecentRequests returns up to limit log entries, newest first.
+func (m *Metrics) RecentRequests(limit int) []RequestLogEntry {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	n := len(m.log)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	out := make([]RequestLogEntry, 0, limit)
+	for i := 0; i < limit; i++ {
+		// logNext is 0 until the ring wraps, then points at the oldest entry.
+		idx := (m.logNext - 1 - i + 2*n) % n
+		out = append(out, m.log[idx])
+	}
+	return out
+}
+
 func (m *Metrics) Snapshot() MetricsSnapshot {
 	reqs := atomic.LoadUint64(&m.requestsTotal)
 	latencyTotalNs := atomic.LoadUint64(&m.latencyTotalNs)
@@ -64,8 +246,28 @@ func (m *Metrics) Snapshot() MetricsSnapshot {
 		BytesSent:    atomic.LoadUint64(&m.bytesSent),
 		AvgLatencyMs: avgLatencyMs,
 		MaxLatencyMs: float64(latencyMaxNs) / float64(time.Millisecond),
+
+		StreamsCompleted:      atomic.LoadUint64(&m.streamsCompleted),
+		StreamsClientAborted:  atomic.LoadUint64(&m.streamsClientAborted),
+		StreamsUpstreamFailed: atomic.LoadUint64(&m.streamsUpstreamFailed),
+		StreamsCancelled:      atomic.LoadUint64(&m.streamsCancelled),
+
+		TextFallbacks: atomic.LoadUint64(&m.textFallbacks),
+	}
+	m.windowMu.Lock()
+	snapshot.Since = m.since
+	m.windowMu.Unlock()
+	snapshot.Windows = m.windowStats(time.Now())
+	m.loopMu.Lock()
+	snapshot.LoopsDetected = m.loopsDetected
+	for i := len(m.loopAlerts) - 1; i >= 0; i-- {
+		snapshot.LoopAlerts = append(snapshot.LoopAlerts, m.loopAlerts[i])
 	}
+	m.loopMu.Unlock()
 	m.modelMu.RLock()
+	if len(m.deprecatedCounts) > 0 {
+		snapshot.DeprecatedModels = maps.Clone(m.deprecatedCounts)
+	}
 	snapshot.Models = make([]ModelStats, 0, len(m.modelCounts))
 	for model, c := range m.modelCounts {
 		avgLatencyMs := 0.0
@@ -78,6 +280,10 @@ func (m *Metrics) Snapshot() MetricsSnapshot {
 		if c.LatencyTotalNs > 0 {
 			avgTokensPerSec = float64(c.TokensTotal) / (float64(c.LatencyTotalNs) / float64(time.Second))
 		}
+		outputTokensPerSec := 0.0
+		if c.GenerationNs > 0 {
+			outputTokensPerSec = float64(c.OutputTokens) / (float64(c.GenerationNs) / float64(time.Second))
+		}
 		snapshot.Models = append(snapshot.Models, ModelStats{
 			Model:            model,
 			RequestsTotal:    c.RequestsTotal,
@@ -89,8 +295,22 @@ func (m *Metrics) Snapshot() MetricsSnapshot {
 			AvgLatencyMs:     avgLatencyMs,
 			AvgTokensPerCall: avgTokensPerCall,
 			AvgTokensPerSec:  avgTokensPerSec,
+			CostUSD:          c.CostUSD,
+			Streams:          c.Streams,
+			AvgTTFTMs:        c.TTFT.avg(),
+			P50TTFTMs:        c.TTFT.percentile(50),
+			P95TTFTMs:        c.TTFT.percentile(95),
+			AvgStreamMs:      c.StreamDuration.avg(),
+			P50StreamMs:      c.StreamDuration.percentile(50),
+			P95StreamMs:      c.StreamDuration.percentile(95),
+
+			OutputTokensPerSec:    outputTokensPerSec,
+			P50OutputTokensPerSec: c.OutputRate.percentile(50),
 		})
 	}
+	snapshot.Keys = usageStats(m.keyCounts)
+	snapshot.Tags = usageStats(m.tagCounts)
+	snapshot.Users = usageStats(m.userCounts)
 	m.modelMu.RUnlock()
 	sort.Slice(snapshot.Models, func(i, j int) bool {
 		if snapshot.Models[i].RequestsTotal == snapshot.Models[j].RequestsTotal {
@@ -98,42 +318,320 @@ func (m *Metrics) Snapshot() MetricsSnapshot {
 		}
 		return snapshot.Models[i].RequestsTotal > snapshot.Models[j].RequestsTotal
 	})
+	m.warmupMu.Lock()
+	for _, st := range m.warmup {
+		snapshot.Warmup = append(snapshot.Warmup, st)
+	}
+	m.warmupMu.Unlock()
+	sort.Slice(snapshot.Warmup, func(i, j int) bool {
+		return snapshot.Warmup[i].Backend < snapshot.Warmup[j].Backend
+	})
+	m.warmupMu.Lock()
+	now := time.Now()
+	for key, until := range m.cooldowns {
+		if until.After(now) {
+			snapshot.Cooldowns = append(snapshot.Cooldowns, CooldownStat{Backend: string(key.backend), Model: key.model, Until: until})
+		}
+	}
+	m.warmupMu.Unlock()
+	sort.Slice(snapshot.Cooldowns, func(i, j int) bool {
+		a, b := snapshot.Cooldowns[i], snapshot.Cooldowns[j]
+		if a.Backend != b.Backend {
+			return a.Backend < b.Backend
+		}
+		return a.Model < b.Model
+	})
+	m.warmupMu.Lock()
+	snapshot.Quotas = m.quotas
+	snapshot.Health = m.health
+	m.warmupMu.Unlock()
 	return snapshot
 }
 
+// ObserveWarmup records a backend warm-up state change for the snapshot.
+func (m *Metrics) ObserveWarmup(st proxy.WarmupStatus) {
+	stat := WarmupStat{
+		Backend:    string(st.Backend),
+		State:      string(st.State),
+		DurationMs: float64(st.Duration) / float64(time.Millisecond),
+	}
+	if st.Err != nil {
+		stat.Error = st.Err.Error()
+	}
+	m.warmupMu.Lock()
+	defer m.warmupMu.Unlock()
+	if m.warmup == nil {
+		m.warmup = make(map[proxy.Backend]WarmupStat)
+	}
+	m.warmup[st.Backend] = stat
+}
+
+// cooldownKey is a model of a backend resting after its usage limit.
+type cooldownKey struct {
+	backend proxy.Backend
+	model   string
+}
+
+// observeCooldown records that model of backend is resting until its usage
+// limit resets.
+func (m *Metrics) observeCooldown(backend proxy.Backend, model string, until time.Time) {
+	m.warmupMu.Lock()
+	defer m.warmupMu.Unlock()
+	if m.cooldowns == nil {
+		m.cooldowns = make(map[cooldownKey]time.Time)
+	}
+	m.cooldowns[cooldownKey{backend, model}] = until
+}
+
+// ObserveQuotas records the subscription usage last reported by the backends.
+func (m *Metrics) ObserveQuotas(quotas []proxy.Quota) {
+	stats := quotaStats(quotas)
+	m.warmupMu.Lock()
+	defer m.warmupMu.Unlock()
+	m.quotas = stats
+}
+
+func quotaStats(quotas []proxy.Quota) []QuotaStat {
+	out := make([]QuotaStat, 0, len(quotas))
+	for _, q := range quotas {
+		st := QuotaStat{Backend: string(q.Backend), CheckedAt: q.CheckedAt, Windows: []QuotaWindowStat{}}
+		if q.Err != nil {
+			st.Error = q.Err.Error()
+		}
+		for _, w := range q.Windows {
+			ws := QuotaWindowStat{UsedPercent: w.UsedPercent, WindowMinutes: w.WindowMinutes}
+			if !w.ResetsAt.IsZero() {
+				ws.ResetsAt = &w.ResetsAt
+			}
+			st.Windows = append(st.Windows, ws)
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// ObserveHealth records the latest health probe results of the backends.
+func (m *Metrics) ObserveHealth(statuses []proxy.HealthStatus) {
+	stats := healthStats(statuses)
+	m.warmupMu.Lock()
+	defer m.warmupMu.Unlock()
+	m.health = stats
+}
+
+func healthStats(statuses []proxy.HealthStatus) []HealthStat {
+	out := make([]HealthStat, 0, len(statuses))
+	for _, st := range statuses {
+		hs := HealthStat{
+			Backend:     string(st.Backend),
+			Healthy:     st.Healthy(),
+			CircuitOpen: st.CircuitOpen(),
+			Failures:    st.Failures,
+			LatencyMs:   float64(st.Latency.Microseconds()) / 1000,
+		}
+		if !st.CheckedAt.IsZero() {
+			hs.CheckedAt = &st.CheckedAt
+		}
+		if st.Err != nil {
+			hs.Error = st.Err.Error()
+		}
+		out = append(out, hs)
+	}
+	return out
+}
+
+func (m *Metrics) SetPricing(pricing map[string]config.ModelPrice) {
+	m.modelMu.Lock()
+	defer m.modelMu.Unlock()
+	m.pricing = pricing
+}
+
+func (m *Metrics) RegisterAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/metrics", m.serveSnapshot)
+	mux.HandleFunc("POST /admin/metrics/reset", m.serveReset)
+}
+
+func (m *Metrics) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, m.Snapshot())
+}
+
+func (m *Metrics) serveReset(w http.ResponseWriter, r *http.Request) {
+	m.Reset()
+	writeJSON(w, http.StatusOK, m.Snapshot())
+}
+
 type MetricsSnapshot struct {
-	RequestsTotal uint64
-	ErrorsTotal   uint64
-	InFlight      int64
+	RequestsTotal uint64 `json:"requests_total"`
+	ErrorsTotal   uint64 `json:"errors_total"`
+	InFlight      int64  `json:"in_flight"`
+
+	Status2xx uint64 `json:"status_2xx"`
+	Status3xx uint64 `json:"status_3xx"`
+	Status4xx uint64 `json:"status_4xx"`
+	Status5xx uint64 `json:"status_5xx"`
+
+	ModelsTotal          uint64 `json:"models_total"`
+	ChatCompletionsTotal uint64 `json:"chat_completions_total"`
+	ResponsesTotal       uint64 `json:"responses_total"`
+	OtherTotal           uint64 `json:"other_total"`
+
+	BytesSent    uint64  `json:"bytes_sent"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	MaxLatencyMs float64 `json:"max_latency_ms"`
+
+	// How streamed requests ended. A stream the client abandons still logs
+	// as 200, so the status buckets cannot tell these apart.
+	StreamsCompleted      uint64 `json:"streams_completed"`
+	StreamsClientAborted  uint64 `json:"streams_client_aborted"`
+	StreamsUpstreamFailed uint64 `json:"streams_upstream_failed"`
+	StreamsCancelled      uint64 `json:"streams_cancelled"`
+
+	// TextFallbacks counts Claude streams that failed or came back empty and
+	// were run again with plain text output.
+	TextFallbacks uint64 `json:"text_fallbacks"`
 
-	Status2xx uint64
-	Status3xx uint64
-	Status4xx uint64
-	Status5xx uint64
+	// Since is when the counters started: the proxy's start or the last
+	// reset. Windows cover the last minute, 5 minutes and hour regardless.
+	Since   time.Time     `json:"since"`
+	Windows []WindowStats `json:"windows"`
 
-	ModelsTotal          uint64
-	ChatCompletionsTotal uint64
-	ResponsesTotal       uint64
-	OtherTotal           uint64
+	// LoopsDetected counts requests refused because their client was
+	// looping; LoopAlerts are the latest, newest first.
+	LoopsDetected uint64      `json:"loops_detected"`
+	LoopAlerts    []LoopAlert `json:"loop_alerts,omitempty"`
+
+	// DeprecatedModels counts requests for each deprecated model ID.
+	DeprecatedModels map[string]uint64 `json:"deprecated_models,omitempty"`
+
+	Models []ModelStats `json:"models"`
+	Keys   []KeyStats   `json:"keys"`
+	// Tags is usage per request tag, from the X-LLM-Proxy-Tags header or
+	// the request's metadata.
+	Tags []KeyStats `json:"tags,omitempty"`
+	// Users is usage per end user, from the request's `user` field.
+	Users  []KeyStats   `json:"users,omitempty"`
+	Warmup []WarmupStat `json:"warmup,omitempty"`
+	// Cooldowns lists the models over their usage limit, until it resets.
+	Cooldowns []CooldownStat `json:"cooldowns,omitempty"`
+	Quotas    []QuotaStat    `json:"quotas,omitempty"`
+	Health    []HealthStat   `json:"health,omitempty"`
+}
+
+// HealthStat is the latest health probe of a backend. With the circuit open,
+// requests to it fail fast with 503 until a probe passes again.
+type HealthStat struct {
+	Backend     string     `json:"backend"`
+	Healthy     bool       `json:"healthy"`
+	CircuitOpen bool       `json:"circuit_open"`
+	Failures    int        `json:"failures,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CheckedAt   *time.Time `json:"checked_at,omitempty"`
+	LatencyMs   float64    `json:"latency_ms,omitempty"`
+}
+
+// NetworkStat is whether a backend's API can be reached the way its CLI
+// connects, through the outbound proxy its environment sets, if any.
+type NetworkStat struct {
+	Backend   string  `json:"backend"`
+	Endpoint  string  `json:"endpoint"`
+	Proxy     string  `json:"proxy,omitempty"`
+	ProxyEnv  string  `json:"proxy_env,omitempty"`
+	Reachable bool    `json:"reachable"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latency_ms,omitempty"`
+}
+
+func networkStats(infos []proxy.NetworkInfo) []NetworkStat {
+	out := make([]NetworkStat, 0, len(infos))
+	for _, info := range infos {
+		ns := NetworkStat{
+			Backend:   string(info.Backend),
+			Endpoint:  info.Endpoint,
+			Proxy:     info.Proxy,
+			ProxyEnv:  info.ProxyEnv,
+			Reachable: info.Err == nil,
+			LatencyMs: float64(info.Latency.Microseconds()) / 1000,
+		}
+		if info.Err != nil {
+			ns.Error = info.Err.Error()
+		}
+		out = append(out, ns)
+	}
+	return out
+}
+
+// QuotaStat is a backend's subscription usage, per limit window (e.g. the
+// 5-hour and weekly limits).
+type QuotaStat struct {
+	Backend   string            `json:"backend"`
+	Windows   []QuotaWindowStat `json:"windows"`
+	CheckedAt time.Time         `json:"checked_at"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type QuotaWindowStat struct {
+	UsedPercent   float64    `json:"used_percent"`
+	WindowMinutes int        `json:"window_minutes,omitempty"`
+	ResetsAt      *time.Time `json:"resets_at,omitempty"`
+}
 
-	BytesSent    uint64
-	AvgLatencyMs float64
-	MaxLatencyMs float64
+type CooldownStat struct {
+	Backend string    `json:"backend"`
+	Model   string    `json:"model,omitempty"`
+	Until   time.Time `json:"until"`
+}
 
-	Models []ModelStats
+type WarmupStat struct {
+	Backend    string  `json:"backend"`
+	State      string  `json:"state"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms,omitempty"`
 }
 
 type ModelStats struct {
-	Model            string
+	Model            string  `json:"model"`
+	RequestsTotal    uint64  `json:"requests_total"`
+	ErrorsTotal      uint64  `json:"errors_total"`
+	ChatCompletions  uint64  `json:"chat_completions"`
+	Responses        uint64  `json:"responses"`
+	OtherRequests    uint64  `json:"other_requests"`
+	TokensTotal      uint64  `json:"tokens_total"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+	AvgTokensPerCall float64 `json:"avg_tokens_per_call"`
+	AvgTokensPerSec  float64 `json:"avg_tokens_per_sec"`
+	CostUSD          float64 `json:"cost_usd"`
+
+	// Streaming latency: time to first token and total stream duration.
+	// Percentiles cover the most recent latencySampleSize streams.
+	Streams     uint64  `json:"streams"`
+	AvgTTFTMs   float64 `json:"avg_ttft_ms"`
+	P50TTFTMs   float64 `json:"p50_ttft_ms"`
+	P95TTFTMs   float64 `json:"p95_ttft_ms"`
+	AvgStreamMs float64 `json:"avg_stream_ms"`
+	P50StreamMs float64 `json:"p50_stream_ms"`
+	P95StreamMs float64 `json:"p95_stream_ms"`
+
+	// Generation throughput of streams: output tokens per second from the
+	// first token to the end, which leaves out queueing and CLI start-up.
+	// The average weighs streams by length; P50 is of recent streams.
+	OutputTokensPerSec    float64 `json:"output_tokens_per_sec"`
+	P50OutputTokensPerSec float64 `json:"p50_output_tokens_per_sec"`
+}
+
+type KeyStats struct {
+	Key              string  `json:"key"`
+	RequestsTotal    uint64  `json:"requests_total"`
+	ErrorsTotal      uint64  `json:"errors_total"`
+	PromptTokens     uint64  `json:"prompt_tokens"`
+	CompletionTokens uint64  `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+type keyCounters struct {
 	RequestsTotal    uint64
 	ErrorsTotal      uint64
-	ChatCompletions  uint64
-	Responses        uint64
-	OtherRequests    uint64
-	TokensTotal      uint64
-	AvgLatencyMs     float64
-	AvgTokensPerCall float64
-	AvgTokensPerSec  float64
+	PromptTokens     uint64
+	CompletionTokens uint64
+	CostUSD          float64
 }
 
 type modelCounters struct {
@@ -144,10 +642,24 @@ type modelCounters struct {
 	OtherRequests   uint64
 	TokensTotal     uint64
 	LatencyTotalNs  uint64
+	CostUSD         float64
+	Streams         uint64
+	TTFT            latencySamples
+	StreamDuration  latencySamples
+	// Output tokens and the time spent generating them (first token to end
+	// of stream), for streams that produced any.
+	OutputTokens uint64
+	GenerationNs uint64
+	OutputRate   latencySamples
 }
 
 func (m *Metrics) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Dashboard polling would otherwise dominate the counters it displays.
+		if isDashboardPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
 		startedAt := time.Now()
 		atomic.AddInt64(&m.inFlight, 1)
 		defer atomic.AddInt64(&m.inFlight, -1)
@@ -164,8 +676,11 @@ func (m *Metrics) Middleware(next http.Handler) http.Handler {
 			atomic.AddUint64(&m.otherTotal, 1)
 		}
 
-		wrapped := &statusRecorder{ResponseWriter: w}
-		next.ServeHTTP(wrapped, r)
+		capture := captureReplay(r)
+		ctx, stderr := proxy.WithStderrCapture(r.Context())
+		ctx, trace := proxy.WithRequestTrace(ctx)
+		wrapped := &statusRecorder{ResponseWriter: w, tags: parseTags(r.Header.Get(TagsHeader))}
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
 		status := wrapped.statusCode()
 		if status >= 400 {
 			atomic.AddUint64(&m.errorsTotal, 1)
@@ -182,6 +697,10 @@ func (m *Metrics) Middleware(next http.Handler) http.Handler {
 		}
 		atomic.AddUint64(&m.bytesSent, wrapped.bytesWritten)
 		latencyNs := uint64(time.Since(startedAt))
+		ttftNs := uint64(0)
+		if !wrapped.firstTokenAt.IsZero() {
+			ttftNs = uint64(wrapped.firstTokenAt.Sub(startedAt))
+		}
 		m.observeModel(
 			wrapped.observedModel,
 			r.URL.Path,
@@ -190,6 +709,84 @@ func (m *Metrics) Middleware(next http.Handler) http.Handler {
 			wrapped.promptTokens,
 			wrapped.completionTokens,
 		)
+		outcome := ""
+		if wrapped.streaming {
+			m.observeStream(wrapped.observedModel, latencyNs, ttftNs, wrapped.completionTokens)
+			outcome = wrapped.streamOutcome
+			if outcome == "" {
+				outcome = StreamCompleted
+				if r.Context().Err() != nil {
+					outcome = StreamClientAborted
+				}
+			}
+			m.observeStreamOutcome(outcome)
+		}
+		m.observeKey(
+			wrapped.observedKey,
+			wrapped.observedModel,
+			status,
+			wrapped.promptTokens,
+			wrapped.completionTokens,
+		)
+		m.observeUser(
+			wrapped.observedUser,
+			wrapped.observedModel,
+			status,
+			wrapped.promptTokens,
+			wrapped.completionTokens,
+		)
+		m.observeTags(
+			wrapped.tags,
+			wrapped.observedModel,
+			status,
+			wrapped.promptTokens,
+			wrapped.completionTokens,
+		)
+		if wrapped.cooldownBackend != "" {
+			m.observeCooldown(wrapped.cooldownBackend, wrapped.cooldownModel, wrapped.cooldownUntil)
+		}
+		if wrapped.deprecatedModel != "" {
+			m.observeDeprecatedModel(wrapped.deprecatedModel)
+		}
+		if wrapped.loop != "" {
+			m.observeLoop(LoopAlert{Time: startedAt, Key: wrapped.observedKey, Model: strings.TrimSpace(wrapped.observedModel), Reason: wrapped.loop})
+		}
+		textFallbacks := trace.TextFallbacks()
+		atomic.AddUint64(&m.textFallbacks, uint64(textFallbacks))
+		entry := RequestLogEntry{
+			Time:             startedAt,
+			Method:           r.Method,
+			Path:             r.URL.Path,
+			Model:            strings.TrimSpace(wrapped.observedModel),
+			Key:              wrapped.observedKey,
+			Tags:             wrapped.tags,
+			User:             wrapped.observedUser,
+			Status:           status,
+			LatencyMs:        float64(latencyNs) / float64(time.Millisecond),
+			BytesSent:        wrapped.bytesWritten,
+			PromptTokens:     wrapped.promptTokens,
+			CompletionTokens: wrapped.completionTokens,
+			Stream:           wrapped.streaming,
+			TTFTMs:           float64(ttftNs) / float64(time.Millisecond),
+			Outcome:          outcome,
+			Stderr:           stderr.String(),
+			TextFallback:     textFallbacks > 0,
+			Timings:          requestTimings(time.Duration(latencyNs), trace.Timings(), time.Duration(wrapped.serializeNs.Load())),
+		}
+		// A request auth turned away keeps no capture: replaying it would run
+		// a body nobody vouched for without any key's model policy or safety.
+		if capture != nil && status != http.StatusUnauthorized && status != http.StatusForbidden {
+			capture.output = wrapped.output
+			capture.key = wrapped.apiKey
+			entry.Replayable = true
+			entry.replay = capture
+		}
+		entry.ID = m.recordRequest(entry)
+		if m.afterRequest != nil {
+			m.afterRequest(entry)
+		}
+		m.observeWindow(time.Now(), status, latencyNs, wrapped.promptTokens, wrapped.completionTokens)
+		m.accessLog.Load().log(r, entry)
 
 		atomic.AddUint64(&m.latencyTotalNs, latencyNs)
 		for {
@@ -227,6 +824,118 @@ func (m *Metrics) observeModel(model string, path string, status int, latencyNs
 	}
 	c.LatencyTotalNs += latencyNs
 	c.TokensTotal += promptTokens + completionTokens
+	c.CostUSD += m.pricing[model].Cost(promptTokens, completionTokens)
+}
+
+func (m *Metrics) observeStream(model string, durationNs uint64, ttftNs uint64, outputTokens uint64) {
+	model = strings.TrimSpace(model)
+	if model == "" {
+		return
+	}
+	m.modelMu.Lock()
+	defer m.modelMu.Unlock()
+	c := m.modelCounts[model]
+	if c == nil {
+		return
+	}
+	c.Streams++
+	c.StreamDuration.add(float64(durationNs) / float64(time.Millisecond))
+	if ttftNs > 0 {
+		c.TTFT.add(float64(ttftNs) / float64(time.Millisecond))
+	}
+	if ttftNs > 0 && durationNs > ttftNs && outputTokens > 0 {
+		genNs := durationNs - ttftNs
+		c.OutputTokens += outputTokens
+		c.GenerationNs += genNs
+		c.OutputRate.add(float64(outputTokens) / (float64(genNs) / float64(time.Second)))
+	}
+}
+
+func (m *Metrics) observeStreamOutcome(outcome string) {
+	switch outcome {
+	case StreamCompleted:
+		atomic.AddUint64(&m.streamsCompleted, 1)
+	case StreamClientAborted:
+		atomic.AddUint64(&m.streamsClientAborted, 1)
+	case StreamUpstreamFailed:
+		atomic.AddUint64(&m.streamsUpstreamFailed, 1)
+	case StreamCancelled:
+		atomic.AddUint64(&m.streamsCancelled, 1)
+	}
+}
+
+func (m *Metrics) observeKey(key string, model string, status int, promptTokens uint64, completionTokens uint64) {
+	if key == "" {
+		return
+	}
+	m.modelMu.Lock()
+	defer m.modelMu.Unlock()
+	m.observeUsage(m.keyCounts, key, model, status, promptTokens, completionTokens)
+}
+
+// maxLabelStats bounds how many distinct tags, and users, get usage
+// counters, since clients choose them; the request log keeps them all.
+const maxLabelStats = 500
+
+func (m *Metrics) observeTags(tags []string, model string, status int, promptTokens uint64, completionTokens uint64) {
+	m.modelMu.Lock()
+	defer m.modelMu.Unlock()
+	for _, tag := range tags {
+		if m.tagCounts[tag] == nil && len(m.tagCounts) >= maxLabelStats {
+			continue
+		}
+		m.observeUsage(m.tagCounts, tag, model, status, promptTokens, completionTokens)
+	}
+}
+
+func (m *Metrics) observeUser(user string, model string, status int, promptTokens uint64, completionTokens uint64) {
+	if user == "" {
+		return
+	}
+	m.modelMu.Lock()
+	defer m.modelMu.Unlock()
+	if m.userCounts[user] == nil && len(m.userCounts) >= maxLabelStats {
+		return
+	}
+	m.observeUsage(m.userCounts, user, model, status, promptTokens, completionTokens)
+}
+
+// observeUsage adds a request to name's counters; modelMu must be held.
+func (m *Metrics) observeUsage(counts map[string]*keyCounters, name string, model string, status int, promptTokens uint64, completionTokens uint64) {
+	c := counts[name]
+	if c == nil {
+		c = &keyCounters{}
+		counts[name] = c
+	}
+	c.RequestsTotal++
+	if status >= 400 {
+		c.ErrorsTotal++
+	}
+	c.PromptTokens += promptTokens
+	c.CompletionTokens += completionTokens
+	c.CostUSD += m.pricing[strings.TrimSpace(model)].Cost(promptTokens, completionTokens)
+}
+
+// usageStats lists counts busiest first; modelMu must be held.
+func usageStats(counts map[string]*keyCounters) []KeyStats {
+	out := make([]KeyStats, 0, len(counts))
+	for name, c := range counts {
+		out = append(out, KeyStats{
+			Key:              name,
+			RequestsTotal:    c.RequestsTotal,
+			ErrorsTotal:      c.ErrorsTotal,
+			PromptTokens:     c.PromptTokens,
+			CompletionTokens: c.CompletionTokens,
+			CostUSD:          c.CostUSD,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].RequestsTotal == out[j].RequestsTotal {
+			return out[i].Key < out[j].Key
+		}
+		return out[i].RequestsTotal > out[j].RequestsTotal
+	})
+	return out
 }
 
 type statusRecorder struct {
@@ -234,8 +943,24 @@ type statusRecorder struct {
 	status           int
 	bytesWritten     uint64
 	observedModel    string
+	observedKey      string
+	apiKey           *APIKey
+	tags             []string
+	observedUser     string
 	promptTokens     uint64
 	completionTokens uint64
+	streaming        bool
+	streamOutcome    string
+	firstTokenAt     time.Time
+	cooldownBackend  proxy.Backend
+	cooldownModel    string
+	cooldownUntil    time.Time
+	loop             string
+	deprecatedModel  string
+	output           string
+	// serializeNs is atomic: stream events may be written from several
+	// goroutines.
+	serializeNs atomic.Int64
 }
 
 func (r *statusRecorder) WriteHeader(statusCode int) {
@@ -270,6 +995,30 @@ func (r *statusRecorder) AddObservedTokens(promptTokens uint64, completionTokens
 	r.completionTokens += completionTokens
 }
 
+func (r *statusRecorder) SetObservedKey(key string) {
+	r.observedKey = key
+}
+
+func (r *statusRecorder) MarkStreaming() {
+	r.streaming = true
+}
+
+func (r *statusRecorder) MarkFirstToken() {
+	if r.firstTokenAt.IsZero() {
+		r.firstTokenAt = time.Now()
+	}
+}
+
+func (r *statusRecorder) SetStreamOutcome(outcome string) {
+	r.streamOutcome = outcome
+}
+
+func (r *statusRecorder) SetCooldown(backend proxy.Backend, model string, until time.Time) {
+	r.cooldownBackend = backend
+	r.cooldownModel = model
+	r.cooldownUntil = until
+}
+
 type modelObserver interface {
 	SetObservedModel(string)
 }
@@ -280,6 +1029,81 @@ func ObserveModel(w http.ResponseWriter, model string) {
 	}
 }
 
+type keyObserver interface {
+	SetObservedKey(string)
+}
+
+func ObserveKey(w http.ResponseWriter, key string) {
+	if mw, ok := w.(keyObserver); ok {
+		mw.SetObservedKey(key)
+	}
+}
+
+type streamObserver interface {
+	MarkStreaming()
+	MarkFirstToken()
+}
+
+func ObserveStreaming(w http.ResponseWriter) {
+	if mw, ok := w.(streamObserver); ok {
+		mw.MarkStreaming()
+	}
+}
+
+func ObserveFirstToken(w http.ResponseWriter) {
+	if mw, ok := w.(streamObserver); ok {
+		mw.MarkFirstToken()
+	}
+}
+
+// Stream outcomes, recorded per streamed request. Handlers report the
+// failures they see; a stream whose client went away is StreamClientAborted
+// and anything else StreamCompleted.
+const (
+	StreamCompleted      = "completed"
+	StreamClientAborted  = "client_aborted"
+	StreamUpstreamFailed = "upstream_error"
+	StreamCancelled      = "cancelled"
+)
+
+type streamOutcomeObserver interface {
+	SetStreamOutcome(string)
+}
+
+func ObserveStreamOutcome(w http.ResponseWriter, outcome string) {
+	if mw, ok := w.(streamOutcomeObserver); ok {
+		mw.SetStreamOutcome(outcome)
+	}
+}
+
+type cooldownObserver interface {
+	SetCooldown(proxy.Backend, string, time.Time)
+}
+
+// ObserveCooldown reports that model of backend hit its usage limit and
+// rests until the given time.
+func ObserveCooldown(w http.ResponseWriter, backend proxy.Backend, model string, until time.Time) {
+	if mw, ok := w.(cooldownObserver); ok {
+		mw.SetCooldown(backend, model, until)
+	}
+}
+
+func (r *statusRecorder) AddSerializeTime(d time.Duration) {
+	r.serializeNs.Add(int64(d))
+}
+
+type serializeObserver interface {
+	AddSerializeTime(time.Duration)
+}
+
+// ObserveSerialize adds the time since start to the time the request spent
+// encoding and writing its response.
+func ObserveSerialize(w http.ResponseWriter, start time.Time) {
+	if mw, ok := w.(serializeObserver); ok {
+		mw.AddSerializeTime(time.Since(start))
+	}
+}
+
 type tokenObserver interface {
 	AddObservedTokens(uint64, uint64)
 }
@@ -295,3 +1119,135 @@ func (r *statusRecorder) Flush() {
 		f.Flush()
 	}
 }
+
+const latencySampleSize = 512
+
+// latencySamples keeps running totals plus a fixed window of recent samples
+// for percentile estimates.
+type latencySamples struct {
+	count uint64
+	total float64
+	buf   []float64
+	next  int
+}
+
+func (l *latencySamples) add(v float64) {
+	l.count++
+	l.total += v
+	if len(l.buf) < latencySampleSize {
+		l.buf = append(l.buf, v)
+		return
+	}
+	l.buf[l.next] = v
+	l.next = (l.next + 1) % latencySampleSize
+}
+
+func (l *latencySamples) avg() float64 {
+	if l.count == 0 {
+		return 0
+	}
+	return l.total / float64(l.count)
+}
+
+func (l *latencySamples) percentile(p float64) float64 {
+	if len(l.buf) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), l.buf...)
+	sort.Float64s(sorted)
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// windowMinutes is how many one-minute buckets the rolling windows keep,
+// enough for the longest of them.
+const windowMinutes = 60
+
+// rollingWindows are the windows reported in each snapshot.
+var rollingWindows = []struct {
+	name    string
+	minutes int
+}{{"1m", 1}, {"5m", 5}, {"1h", 60}}
+
+// windowBucket holds the requests that finished within one minute.
+type windowBucket struct {
+	minute           int64
+	requests         uint64
+	errors           uint64
+	latencyTotalNs   uint64
+	latencyMaxNs     uint64
+	promptTokens     uint64
+	completionTokens uint64
+}
+
+// WindowStats is traffic over a recent window, where the cumulative counters
+// blur it after a long uptime. A window spans its current partial minute
+// plus the whole minutes before it.
+type WindowStats struct {
+	Window           string  `json:"window"`
+	RequestsTotal    uint64  `json:"requests_total"`
+	ErrorsTotal      uint64  `json:"errors_total"`
+	ErrorRate        float64 `json:"error_rate"`
+	RequestsPerMin   float64 `json:"requests_per_min"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+	MaxLatencyMs     float64 `json:"max_latency_ms"`
+	PromptTokens     uint64  `json:"prompt_tokens"`
+	CompletionTokens uint64  `json:"completion_tokens"`
+}
+
+func (m *Metrics) observeWindow(at time.Time, status int, latencyNs uint64, promptTokens uint64, completionTokens uint64) {
+	minute := at.Unix() / 60
+	m.windowMu.Lock()
+	defer m.windowMu.Unlock()
+	b := &m.windows[minute%windowMinutes]
+	if b.minute > minute {
+		return
+	}
+	if b.minute != minute {
+		*b = windowBucket{minute: minute}
+	}
+	b.requests++
+	if status >= 400 {
+		b.errors++
+	}
+	b.latencyTotalNs += latencyNs
+	b.latencyMaxNs = max(b.latencyMaxNs, latencyNs)
+	b.promptTokens += promptTokens
+	b.completionTokens += completionTokens
+}
+
+func (m *Metrics) windowStats(now time.Time) []WindowStats {
+	current := now.Unix() / 60
+	m.windowMu.Lock()
+	defer m.windowMu.Unlock()
+	out := make([]WindowStats, 0, len(rollingWindows))
+	for _, w := range rollingWindows {
+		st := WindowStats{Window: w.name}
+		var latencyTotalNs, latencyMaxNs uint64
+		for _, b := range m.windows {
+			if b.minute <= current-int64(w.minutes) || b.minute > current {
+				continue
+			}
+			st.RequestsTotal += b.requests
+			st.ErrorsTotal += b.errors
+			st.PromptTokens += b.promptTokens
+			st.CompletionTokens += b.completionTokens
+			latencyTotalNs += b.latencyTotalNs
+			latencyMaxNs = max(latencyMaxNs, b.latencyMaxNs)
+		}
+		if st.RequestsTotal > 0 {
+			st.ErrorRate = float64(st.ErrorsTotal) / float64(st.RequestsTotal)
+			st.AvgLatencyMs = float64(latencyTotalNs) / float64(st.RequestsTotal) / float64(time.Millisecond)
+		}
+		st.RequestsPerMin = float64(st.RequestsTotal) / float64(w.minutes)
+		st.MaxLatencyMs = float64(latencyMaxNs) / float64(time.Millisecond)
+		out = append(out, st)
+	}
+	return out
+}
@@ -0,0 +1,353 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+)
+
+func TestRecentRequestsNewestFirstAcrossWrap(t *testing.T) {
+	m := NewMetrics()
+	for i := 0; i < requestLogSize+5; i++ {
+		m.recordRequest(RequestLogEntry{Path: "/v1/models"})
+	}
+	got := m.RecentRequests(3)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(got))
+	}
+	want := uint64(requestLogSize + 5)
+	for i, e := range got {
+		if e.ID != want-uint64(i) {
+			t.Fatalf("entry %d: got id %d, want %d", i, e.ID, want-uint64(i))
+		}
+	}
+	if all := m.RecentRequests(0); len(all) != requestLogSize || all[len(all)-1].ID != 6 {
+		t.Fatalf("expected ring to hold the last %d entries, got %d ending at id %d", requestLogSize, len(all), all[len(all)-1].ID)
+	}
+}
+
+func TestAdminMetricsServesSnapshotJSON(t *testing.T) {
+	m := NewMetrics()
+	mux := http.NewServeMux()
+	m.RegisterAdminRoutes(mux)
+	mux.HandleFunc("POST /v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		ObserveModel(w, "sonnet")
+		ObserveTokenUsage(w, 10, 5)
+		w.WriteHeader(http.StatusOK)
+	})
+	h := m.Middleware(mux)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/metrics", nil))
+	var snap MetricsSnapshot
+	if err := json.Unmarshal(w.Body.Bytes(), &snap); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if snap.ChatCompletionsTotal != 1 || len(snap.Models) != 1 || snap.Models[0].Model != "sonnet" || snap.Models[0].TokensTotal != 15 {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+}
+
+func TestMetricsAccountsUsagePerKey(t *testing.T) {
+	m := NewMetrics()
+	m.SetPricing(map[string]config.ModelPrice{"sonnet": {PromptPerMTok: 3, CompletionPerMTok: 15}})
+	auth := NewAuthenticator([]config.APIKey{{Name: "aider", Key: "sk-aider", Scopes: []string{config.ScopeChat}}})
+	h := m.Middleware(auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ObserveModel(w, "sonnet")
+		ObserveTokenUsage(w, 1000, 2000)
+	})))
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	r.Header.Set("Authorization", "Bearer sk-aider")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	snap := m.Snapshot()
+	if len(snap.Keys) != 1 {
+		t.Fatalf("expected one key, got %+v", snap.Keys)
+	}
+	k := snap.Keys[0]
+	if k.Key != "aider" || k.RequestsTotal != 1 || k.PromptTokens != 1000 || k.CompletionTokens != 2000 {
+		t.Fatalf("unexpected key stats: %+v", k)
+	}
+	if want := 0.003 + 0.03; k.CostUSD < want-1e-9 || k.CostUSD > want+1e-9 {
+		t.Fatalf("expected cost %.4f, got %.4f", want, k.CostUSD)
+	}
+	if got := m.RecentRequests(1)[0].Key; got != "aider" {
+		t.Fatalf("expected request log to carry key name, got %q", got)
+	}
+}
+
+func TestLatencySamplesPercentiles(t *testing.T) {
+	var l latencySamples
+	for i := 1; i <= 100; i++ {
+		l.add(float64(i))
+	}
+	if got := l.percentile(50); got != 50 {
+		t.Fatalf("p50 = %v, want 50", got)
+	}
+	if got := l.percentile(95); got != 95 {
+		t.Fatalf("p95 = %v, want 95", got)
+	}
+	if got := l.avg(); got != 50.5 {
+		t.Fatalf("avg = %v, want 50.5", got)
+	}
+}
+
+type failingTestAdapter struct {
+	streamingTestAdapter
+}
+
+func (a *failingTestAdapter) Chat(ctx context.Context, _ proxy.ChatRequest) (proxy.ChatResponse, error) {
+	_, _ = proxy.StderrFromContext(ctx).Write([]byte("Error: session expired\n"))
+	return proxy.ChatResponse{}, errors.New("claude command failed: exit status 1")
+}
+
+func TestMetricsRecordsCLIStderr(t *testing.T) {
+	m := NewMetrics()
+	s := NewServer(proxy.NewRouter(&failingTestAdapter{streamingTestAdapter{model: "m1"}}, &streamingTestAdapter{model: "m2"}))
+	handler := m.Middleware(http.HandlerFunc(s.CreateChatCompletion))
+
+	send := func() map[string]any {
+		body := []byte(`{"model":"m1","messages":[{"role":"user","content":"hi"}]}`)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body)))
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 for an expired session, got %d", w.Code)
+		}
+		var resp struct {
+			Error map[string]any `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Error
+	}
+
+	if errBody := send(); errBody["stderr"] != nil {
+		t.Fatalf("stderr leaked without debug: %#v", errBody)
+	}
+	if got := m.RecentRequests(1)[0].Stderr; got != "Error: session expired\n" {
+		t.Fatalf("unexpected logged stderr: %q", got)
+	}
+
+	s.SetDebug(true)
+	if errBody := send(); !strings.Contains(errBody["stderr"].(string), "session expired") {
+		t.Fatalf("expected stderr in debug error body, got %#v", errBody)
+	}
+}
+
+func (a *failingTestAdapter) ChatStream(ctx context.Context, req proxy.ChatRequest, _ func(string) error) (proxy.ChatResponse, error) {
+	return a.Chat(ctx, req)
+}
+
+func TestMetricsCountsStreamOutcomes(t *testing.T) {
+	m := NewMetrics()
+	s := NewServer(proxy.NewRouter(&failingTestAdapter{streamingTestAdapter{model: "m1"}}, &streamingTestAdapter{model: "m2"}))
+	handler := m.Middleware(http.HandlerFunc(s.CreateChatCompletion))
+
+	send := func(ctx context.Context, model string) string {
+		body := []byte(`{"model":"` + model + `","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body)).WithContext(ctx)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return m.RecentRequests(1)[0].Outcome
+	}
+
+	if got := send(context.Background(), "m2"); got != StreamCompleted {
+		t.Fatalf("expected completed stream, got %q", got)
+	}
+	if got := send(context.Background(), "m1"); got != StreamUpstreamFailed {
+		t.Fatalf("expected upstream failure, got %q", got)
+	}
+	gone, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := send(gone, "m2"); got != StreamClientAborted {
+		t.Fatalf("expected client abort, got %q", got)
+	}
+
+	snap := m.Snapshot()
+	if snap.StreamsCompleted != 1 || snap.StreamsUpstreamFailed != 1 || snap.StreamsClientAborted != 1 || snap.StreamsCancelled != 0 {
+		t.Fatalf("unexpected stream outcome counts: %+v", snap)
+	}
+}
+
+type rateLimitedAdapter struct {
+	streamingTestAdapter
+	reset time.Time
+}
+
+func (a *rateLimitedAdapter) Chat(context.Context, proxy.ChatRequest) (proxy.ChatResponse, error) {
+	return proxy.ChatResponse{}, &proxy.RateLimitError{Backend: proxy.BackendCodex, Reset: a.reset, Err: errors.New("You've hit your usage limit.")}
+}
+
+func TestRateLimitSetsRetryAfterAndCooldown(t *testing.T) {
+	m := NewMetrics()
+	reset := time.Now().Add(90 * time.Second)
+	s := NewServer(proxy.NewRouter(&rateLimitedAdapter{streamingTestAdapter{model: "m1"}, reset}, &streamingTestAdapter{model: "m2"}))
+	handler := m.Middleware(http.HandlerFunc(s.CreateChatCompletion))
+
+	body := []byte(`{"model":"m1","messages":[{"role":"user","content":"hi"}]}`)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body)))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Retry-After"); got != "90" && got != "89" {
+		t.Fatalf("unexpected Retry-After %q", got)
+	}
+	if !strings.Contains(w.Body.String(), "rate_limit_exceeded") {
+		t.Fatalf("expected rate_limit_exceeded code, got %s", w.Body)
+	}
+	cooldowns := m.Snapshot().Cooldowns
+	if len(cooldowns) != 1 || cooldowns[0].Backend != "codex" || !cooldowns[0].Until.Equal(reset) {
+		t.Fatalf("unexpected cooldowns: %+v", cooldowns)
+	}
+}
+
+func TestMetricsMeasureOutputThroughput(t *testing.T) {
+	m := NewMetrics()
+	m.observeModel("m1", "/v1/chat/completions", 200, uint64(3*time.Second), 10, 100)
+	// 100 tokens in the 2s after the first token; the first second of
+	// waiting does not count.
+	m.observeStream("m1", uint64(3*time.Second), uint64(time.Second), 100)
+	m.observeModel("m1", "/v1/chat/completions", 200, uint64(2*time.Second), 10, 50)
+	m.observeStream("m1", uint64(2*time.Second), uint64(time.Second), 50)
+	// A stream without a first token is left out.
+	m.observeModel("m1", "/v1/chat/completions", 502, uint64(time.Second), 10, 0)
+	m.observeStream("m1", uint64(time.Second), 0, 0)
+
+	stats := m.Snapshot().Models[0]
+	if stats.OutputTokensPerSec != 50 || stats.P50OutputTokensPerSec != 50 {
+		t.Fatalf("unexpected throughput: %+v", stats)
+	}
+}
+
+func TestMetricsAccountsUsagePerTag(t *testing.T) {
+	m := NewMetrics()
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ObserveModel(w, "sonnet")
+		ObserveTags(w, metadataTags(&map[string]string{"tool": "aider", "project": "billing"}))
+		ObserveTokenUsage(w, 10, 5)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set(TagsHeader, "project=billing,nightly")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := m.RecentRequests(1)[0].Tags; strings.Join(got, ",") != "project=billing,nightly,tool=aider" {
+		t.Fatalf("unexpected request tags %q", got)
+	}
+	tags := m.Snapshot().Tags
+	if len(tags) != 3 {
+		t.Fatalf("expected 3 tags, got %+v", tags)
+	}
+	for _, tag := range tags {
+		if tag.RequestsTotal != 1 || tag.PromptTokens != 10 || tag.CompletionTokens != 5 {
+			t.Fatalf("unexpected usage for %s: %+v", tag.Key, tag)
+		}
+	}
+}
+
+func TestMetricsRollingWindows(t *testing.T) {
+	m := NewMetrics()
+	now := time.Now()
+	m.observeWindow(now, http.StatusOK, uint64(100*time.Millisecond), 10, 5)
+	m.observeWindow(now.Add(-3*time.Minute), http.StatusInternalServerError, uint64(300*time.Millisecond), 20, 0)
+	m.observeWindow(now.Add(-30*time.Minute), http.StatusOK, uint64(time.Second), 1, 1)
+	m.observeWindow(now.Add(-70*time.Minute), http.StatusOK, uint64(time.Second), 1, 1)
+
+	want := map[string]struct{ requests, errors, prompt uint64 }{
+		"1m": {1, 0, 10},
+		"5m": {2, 1, 30},
+		"1h": {3, 1, 31},
+	}
+	windows := m.windowStats(now)
+	if len(windows) != len(want) {
+		t.Fatalf("unexpected windows: %+v", windows)
+	}
+	for _, w := range windows {
+		exp := want[w.Window]
+		if w.RequestsTotal != exp.requests || w.ErrorsTotal != exp.errors || w.PromptTokens != exp.prompt {
+			t.Fatalf("window %s = %+v, want %+v", w.Window, w, exp)
+		}
+	}
+	if w := windows[1]; w.AvgLatencyMs != 200 || w.MaxLatencyMs != 300 || w.ErrorRate != 0.5 {
+		t.Fatalf("unexpected 5m latency or error rate: %+v", w)
+	}
+}
+
+func TestAdminMetricsResetZeroesCounters(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveHealth([]proxy.HealthStatus{{Backend: proxy.BackendClaude, CheckedAt: time.Now()}})
+	mux := http.NewServeMux()
+	m.RegisterAdminRoutes(mux)
+	mux.HandleFunc("POST /v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		ObserveModel(w, "sonnet")
+		ObserveKey(w, "ci")
+		ObserveTokenUsage(w, 10, 5)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	h := m.Middleware(mux)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	before := m.Snapshot()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/metrics/reset", nil))
+	var snap MetricsSnapshot
+	if err := json.Unmarshal(w.Body.Bytes(), &snap); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	// The reset request itself finishes after the snapshot it answers with.
+	if snap.RequestsTotal != 0 || snap.ErrorsTotal != 0 || snap.Status5xx != 0 || len(snap.Models) != 0 || len(snap.Keys) != 0 || snap.Windows[0].RequestsTotal != 0 {
+		t.Fatalf("counters survived the reset: %+v", snap)
+	}
+	if !snap.Since.After(before.Since) {
+		t.Fatalf("since = %v, want after %v", snap.Since, before.Since)
+	}
+	if len(snap.Health) != 1 || len(m.RecentRequests(0)) != 2 {
+		t.Fatalf("reset dropped backend state or the request log: %+v", snap)
+	}
+}
+
+func TestRequestTimingsSplitCLIAndProxyTime(t *testing.T) {
+	if got := requestTimings(time.Second, proxy.CLITimings{}, time.Millisecond); got != nil {
+		t.Fatalf("a request without CLI runs got timings: %+v", got)
+	}
+	got := requestTimings(time.Second, proxy.CLITimings{
+		Spawn:     200 * time.Millisecond,
+		FirstByte: 300 * time.Millisecond,
+		Stream:    400 * time.Millisecond,
+	}, 5*time.Millisecond)
+	want := RequestTimings{SpawnMs: 200, FirstByteMs: 300, StreamMs: 400, SerializeMs: 5, ProxyMs: 100}
+	if got == nil || *got != want {
+		t.Fatalf("timings = %+v, want %+v", got, want)
+	}
+	// Race entrants overlap, so the CLI time can exceed the latency.
+	if got := requestTimings(time.Second, proxy.CLITimings{Stream: 2 * time.Second}, 0); got.ProxyMs != 0 {
+		t.Fatalf("proxy time = %v, want 0", got.ProxyMs)
+	}
+}
+
+func TestMetricsRecordsSerializeTime(t *testing.T) {
+	m := NewMetrics()
+	var recorder *statusRecorder
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder = w.(*statusRecorder)
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	if recorder.serializeNs.Load() <= 0 {
+		t.Fatal("writeJSON did not record its serialize time")
+	}
+	if e := m.RecentRequests(1)[0]; e.Timings != nil {
+		t.Fatalf("a request without CLI runs got timings: %+v", e.Timings)
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"llm-proxy/openapi"
+)
+
+// apiEndpoint is a /v1 operation of the OpenAPI document.
+type apiEndpoint struct {
+	method string
+	path   string
+}
+
+func (e apiEndpoint) String() string { return e.method + " " + e.path }
+
+// matches reports whether path fits the endpoint's path template.
+func (e apiEndpoint) matches(path string) bool {
+	want, got := strings.Split(e.path, "/"), strings.Split(path, "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i, seg := range want {
+		if strings.HasPrefix(seg, "{") {
+			if got[i] == "" {
+				return false
+			}
+			continue
+		}
+		if seg != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// apiEndpoints lists the /v1 operations in the embedded OpenAPI document,
+// which is what the generated routes are built from.
+var apiEndpoints = sync.OnceValue(func() []apiEndpoint {
+	var doc struct {
+		Paths map[string]map[string]any `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(openapi.YAML, &doc); err != nil {
+		return nil
+	}
+	var out []apiEndpoint
+	for path, ops := range doc.Paths {
+		if !strings.HasPrefix(path, "/v1/") {
+			continue
+		}
+		for method := range ops {
+			switch method {
+			case "get", "post", "put", "patch", "delete":
+				out = append(out, apiEndpoint{method: strings.ToUpper(method), path: path})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].path != out[j].path {
+			return out[i].path < out[j].path
+		}
+		return out[i].method < out[j].method
+	})
+	return out
+})
+
+// RegisterUnknownRoutes answers /v1 requests no route matched with an
+// OpenAI error object listing the supported endpoints, instead of the mux's
+// plain-text 404 and 405, which SDKs fail to parse.
+func RegisterUnknownRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/", serveUnknownRoute)
+}
+
+func serveUnknownRoute(w http.ResponseWriter, r *http.Request) {
+	endpoints := apiEndpoints()
+	supported := make([]string, len(endpoints))
+	var allowed []string
+	for i, e := range endpoints {
+		supported[i] = e.String()
+		if e.matches(r.URL.Path) {
+			allowed = append(allowed, e.method)
+		}
+	}
+	status, code := http.StatusNotFound, "unknown_url"
+	message := fmt.Sprintf("Invalid URL (%s %s)", r.Method, r.URL.Path)
+	if len(allowed) > 0 {
+		status, code = http.StatusMethodNotAllowed, "method_not_allowed"
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		message = fmt.Sprintf("Method %s is not allowed on %s; use %s", r.Method, r.URL.Path, strings.Join(allowed, " or "))
+	}
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{
+			"type":                "invalid_request_error",
+			"code":                code,
+			"message":             message + ". Supported endpoints: " + strings.Join(supported, ", "),
+			"supported_endpoints": supported,
+		},
+	})
+}
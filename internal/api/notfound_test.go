@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+)
+
+func TestUnknownV1RoutesReturnOpenAIErrors(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &streamingTestAdapter{model: "m2"}))
+	mux := http.NewServeMux()
+	RegisterUnknownRoutes(mux)
+	openapiv1.HandlerFromMux(s, mux)
+
+	cases := []struct {
+		method, path string
+		status       int
+		code, allow  string
+	}{
+		{http.MethodPost, "/v1/embeddings", http.StatusNotFound, "unknown_url", ""},
+		{http.MethodGet, "/v1/chat/completions", http.StatusMethodNotAllowed, "method_not_allowed", "POST"},
+		{http.MethodPost, "/v1/responses/resp_1", http.StatusMethodNotAllowed, "method_not_allowed", "DELETE, GET"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+		if w.Code != c.status || w.Header().Get("Allow") != c.allow {
+			t.Fatalf("%s %s = %d (Allow %q): %s", c.method, c.path, w.Code, w.Header().Get("Allow"), w.Body)
+		}
+		var body struct {
+			Error struct {
+				Type               string   `json:"type"`
+				Code               string   `json:"code"`
+				Message            string   `json:"message"`
+				SupportedEndpoints []string `json:"supported_endpoints"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: decode: %v", c.method, c.path, err)
+		}
+		if body.Error.Type != "invalid_request_error" || body.Error.Code != c.code || body.Error.Message == "" {
+			t.Fatalf("%s %s: error = %+v", c.method, c.path, body.Error)
+		}
+		if !slices.Contains(body.Error.SupportedEndpoints, "POST /v1/chat/completions") || !slices.Contains(body.Error.SupportedEndpoints, "GET /v1/responses/{response_id}/events") {
+			t.Fatalf("%s %s: supported endpoints = %q", c.method, c.path, body.Error.SupportedEndpoints)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /v1/models = %d, the catch-all shadows real routes", w.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Pause modes: new requests are either turned away with a 503 or held in
+// the queue until traffic resumes. Requests already running finish either
+// way.
+const (
+	PauseReject = "reject"
+	PauseQueue  = "queue"
+)
+
+// defaultPauseRetryAfter is the Retry-After sent while paused when the
+// pause gave none.
+const defaultPauseRetryAfter = 60
+
+// Pause is the process-wide traffic switch, set from the admin API or the
+// TUI, like YOLO.
+type Pause struct {
+	Paused bool   `json:"paused"`
+	Mode   string `json:"mode"`
+	// RetryAfter is the Retry-After, in seconds, for rejected requests.
+	RetryAfter int       `json:"retry_after"`
+	Since      time.Time `json:"since,omitzero"`
+}
+
+var (
+	pauseMu sync.Mutex
+	pause   = Pause{Mode: PauseReject, RetryAfter: defaultPauseRetryAfter}
+)
+
+// SetPause pauses or resumes new /v1 generation requests. An empty mode
+// keeps the current one and a zero RetryAfter the default.
+func SetPause(p Pause) Pause {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	if p.Mode == "" {
+		p.Mode = pause.Mode
+	}
+	if p.RetryAfter <= 0 {
+		p.RetryAfter = defaultPauseRetryAfter
+	}
+	switch {
+	case !p.Paused:
+		p.Since = time.Time{}
+	case pause.Paused:
+		p.Since = pause.Since
+	default:
+		p.Since = time.Now()
+	}
+	pause = p
+	return pause
+}
+
+// CurrentPause returns the traffic switch's state.
+func CurrentPause() Pause {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	return pause
+}
+
+// pauseHolds reports whether queued requests must wait for a resume.
+func pauseHolds() bool {
+	p := CurrentPause()
+	return p.Paused && p.Mode == PauseQueue
+}
+
+// allowTraffic reports whether a new request of prio may go ahead, writing
+// a 503 with Retry-After when traffic is paused or quiet hours turn batch
+// requests away. Requests that are held instead wait in the scheduler.
+func (s *Server) allowTraffic(w http.ResponseWriter, prio Priority) bool {
+	if p := CurrentPause(); p.Paused && p.Mode == PauseReject {
+		w.Header().Set("Retry-After", strconv.Itoa(p.RetryAfter))
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": map[string]any{
+			"type":    "server_error",
+			"code":    "proxy_paused",
+			"message": "the proxy is paused and takes no new requests; try again later",
+		}})
+		return false
+	}
+	return s.allowQuietHours(w, prio)
+}
+
+func (s *Server) getPause(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, CurrentPause())
+}
+
+func (s *Server) setPause(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Paused     *bool  `json:"paused"`
+		Mode       string `json:"mode"`
+		RetryAfter int    `json:"retry_after"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Paused == nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", `expected JSON body {"paused": true|false, "mode": "reject"|"queue", "retry_after": seconds}`)
+		return
+	}
+	switch req.Mode {
+	case "", PauseReject, PauseQueue:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid_request_error", `mode must be "reject" or "queue"`)
+		return
+	}
+	if req.RetryAfter < 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "retry_after must not be negative")
+		return
+	}
+	prev := CurrentPause()
+	p := SetPause(Pause{Paused: *req.Paused, Mode: req.Mode, RetryAfter: req.RetryAfter})
+	RecordAudit(adminAudit(r, "pause", PauseAudit(prev), PauseAudit(p)))
+	s.sched.dispatch()
+	writeJSON(w, http.StatusOK, p)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/proxy"
+)
+
+func TestPauseRejectsOrHoldsNewRequests(t *testing.T) {
+	t.Cleanup(func() { SetPause(Pause{Mode: PauseReject}) })
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1", deltas: []string{"ok"}}, &streamingTestAdapter{model: "m2"}))
+	mux := http.NewServeMux()
+	s.RegisterAdminRoutes(mux)
+	setPause := func(body string) Pause {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/pause", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /admin/pause %s: %d %s", body, w.Code, w.Body)
+		}
+		var p Pause
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"m1","messages":[{"role":"user","content":"hi"}]}`))))
+		return w
+	}
+
+	if p := setPause(`{"paused": true, "retry_after": 120}`); !p.Paused || p.Mode != PauseReject || p.Since.IsZero() {
+		t.Fatalf("unexpected pause state %+v", p)
+	}
+	w := send()
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "120" || !strings.Contains(w.Body.String(), "proxy_paused") {
+		t.Fatalf("paused request: %d %q %s", w.Code, w.Header().Get("Retry-After"), w.Body)
+	}
+
+	setPause(`{"paused": true, "mode": "queue"}`)
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- send() }()
+	waitFor(t, func() bool { _, q := s.sched.Stats(); return q == 1 })
+	select {
+	case w := <-done:
+		t.Fatalf("request ran while paused: %d %s", w.Code, w.Body)
+	case <-time.After(2 * queuePollInterval):
+	}
+
+	if p := setPause(`{"paused": false}`); p.Paused || p.Mode != PauseQueue {
+		t.Fatalf("unexpected pause state %+v", p)
+	}
+	select {
+	case w := <-done:
+		if w.Code != http.StatusOK {
+			t.Fatalf("held request: %d %s", w.Code, w.Body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("held request did not run after resuming")
+	}
+}
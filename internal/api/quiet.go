@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"llm-proxy/internal/config"
+)
+
+// quietHours holds batch requests back during scheduled windows, or while
+// an admin has paused them.
+type quietHours struct {
+	mu      sync.Mutex
+	windows []quietWindow
+	reject  bool
+	loc     *time.Location
+	// override is set by the admin API: true pauses batch traffic, false
+	// lets it through, whatever the schedule says.
+	override *bool
+}
+
+type quietWindow struct {
+	days       [7]bool
+	start, end int // minutes after midnight
+}
+
+// quietState is whether batch traffic is held at a given time, and until
+// when; a zero until means until an admin resumes it.
+type quietState struct {
+	active    bool
+	scheduled bool
+	until     time.Time
+	reject    bool
+	override  *bool
+}
+
+// SetQuietHours replaces the quiet-hours schedule; nil removes it. A pause
+// or resume from the admin API stays in force.
+func (s *Server) SetQuietHours(q *config.QuietHours) {
+	var windows []quietWindow
+	loc := time.Local
+	reject := false
+	if q != nil {
+		if l, err := q.Location(); err == nil {
+			loc = l
+		}
+		reject = q.Action == "reject"
+		for _, w := range q.Windows {
+			start, end, err := w.Minutes()
+			if err != nil {
+				log.Printf("quiet_hours: %v", err)
+				continue
+			}
+			days, _ := w.Weekdays()
+			qw := quietWindow{start: start, end: end}
+			for _, d := range days {
+				qw.days[d] = true
+			}
+			windows = append(windows, qw)
+		}
+	}
+	s.quiet.mu.Lock()
+	s.quiet.windows, s.quiet.reject, s.quiet.loc = windows, reject, loc
+	s.quiet.mu.Unlock()
+	s.sched.dispatch()
+}
+
+func (q *quietHours) state(now time.Time) quietState {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st := quietState{reject: q.reject, override: q.override}
+	if q.loc != nil {
+		now = now.In(q.loc)
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	at := func(day, minutes int) time.Time {
+		return midnight.AddDate(0, 0, day).Add(time.Duration(minutes) * time.Minute)
+	}
+	m := now.Hour()*60 + now.Minute()
+	today, yesterday := now.Weekday(), (now.Weekday()+6)%7
+	for _, w := range q.windows {
+		var until time.Time
+		switch {
+		case w.start < w.end && w.days[today] && m >= w.start && m < w.end:
+			until = at(0, w.end)
+		case w.start > w.end && w.days[today] && m >= w.start:
+			until = at(1, w.end)
+		case w.start > w.end && w.days[yesterday] && m < w.end:
+			until = at(0, w.end)
+		default:
+			continue
+		}
+		st.scheduled = true
+		if until.After(st.until) {
+			st.until = until
+		}
+	}
+	st.active = st.scheduled
+	if q.override != nil {
+		st.active, st.until = *q.override, time.Time{}
+	}
+	return st
+}
+
+// holdsBatch reports whether queued batch requests must keep waiting.
+func (q *quietHours) holdsBatch() bool {
+	st := q.state(time.Now())
+	return st.active && !st.reject
+}
+
+// allowQuietHours reports whether a request of prio may go ahead, writing a
+// 503 for batch requests while quiet hours reject them. Held requests
+// instead wait in the scheduler.
+func (s *Server) allowQuietHours(w http.ResponseWriter, prio Priority) bool {
+	if prio != PriorityBatch {
+		return true
+	}
+	st := s.quiet.state(time.Now())
+	if !st.active || !st.reject {
+		return true
+	}
+	msg := "batch requests are paused"
+	if !st.until.IsZero() {
+		msg = fmt.Sprintf("batch requests are paused for quiet hours until %s", st.until.Format(time.RFC3339))
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(time.Until(st.until).Seconds())))))
+	}
+	writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": map[string]any{
+		"type":    "server_error",
+		"code":    "quiet_hours",
+		"message": msg + "; interactive requests are still served",
+	}})
+	return false
+}
+
+func (s *Server) getQuietHours(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, quietHoursJSON(s.quiet.state(time.Now())))
+}
+
+// setQuietHours pauses batch traffic ({"paused": true}), lets it through
+// despite the schedule ({"paused": false}) or goes back to the schedule
+// ({"paused": null}).
+func (s *Server) setQuietHours(w http.ResponseWriter, r *http.Request) {
+	var req map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", `expected JSON body {"paused": true|false|null}`)
+		return
+	}
+	raw, ok := req["paused"]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", `expected JSON body {"paused": true|false|null}`)
+		return
+	}
+	var paused *bool
+	if err := json.Unmarshal(raw, &paused); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", `"paused" must be true, false or null`)
+		return
+	}
+	s.quiet.mu.Lock()
+	prev := s.quiet.override
+	s.quiet.override = paused
+	s.quiet.mu.Unlock()
+	RecordAudit(adminAudit(r, "quiet_hours", quietOverrideAudit(prev), quietOverrideAudit(paused)))
+	s.sched.dispatch()
+	writeJSON(w, http.StatusOK, quietHoursJSON(s.quiet.state(time.Now())))
+}
+
+// quietOverrideAudit renders an admin override for the audit trail.
+func quietOverrideAudit(override *bool) string {
+	switch {
+	case override == nil:
+		return "schedule"
+	case *override:
+		return "paused"
+	}
+	return "resumed"
+}
+
+func quietHoursJSON(st quietState) map[string]any {
+	action := "queue"
+	if st.reject {
+		action = "reject"
+	}
+	out := map[string]any{
+		"active":    st.active,
+		"scheduled": st.scheduled,
+		"action":    action,
+		"paused":    st.override,
+		"until":     nil,
+	}
+	if !st.until.IsZero() {
+		out["until"] = st.until
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+)
+
+func TestQuietHoursWindows(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &streamingTestAdapter{model: "m2"}))
+	s.SetQuietHours(&config.QuietHours{Timezone: "UTC", Windows: []config.QuietWindow{
+		{Start: "22:00", End: "07:00", Days: []string{"fri"}},
+		{Start: "12:00", End: "13:00"},
+	}})
+
+	// 2026-10-16 is a Friday.
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	cases := []struct {
+		now    string
+		active bool
+		until  string
+	}{
+		{"2026-10-16T21:59:00Z", false, ""},
+		{"2026-10-16T23:30:00Z", true, "2026-10-17T07:00:00Z"},
+		{"2026-10-17T06:59:00Z", true, "2026-10-17T07:00:00Z"},
+		{"2026-10-17T07:00:00Z", false, ""},
+		{"2026-10-17T23:30:00Z", false, ""},
+		{"2026-10-18T12:30:00Z", true, "2026-10-18T13:00:00Z"},
+	}
+	for _, c := range cases {
+		st := s.quiet.state(at(c.now))
+		if st.active != c.active || (c.until != "" && !st.until.Equal(at(c.until))) {
+			t.Errorf("%s: active=%v until=%s, want %v %s", c.now, st.active, st.until, c.active, c.until)
+		}
+	}
+}
+
+func TestQuietHoursHoldBatchRequestsUntilResumed(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &streamingTestAdapter{model: "m2"}))
+	mux := http.NewServeMux()
+	s.RegisterAdminRoutes(mux)
+	setPaused := func(body string) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/quiet-hours", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /admin/quiet-hours %s: %d %s", body, w.Code, w.Body)
+		}
+	}
+	setPaused(`{"paused": true}`)
+
+	admitted := make(chan struct{})
+	go func() {
+		release, err := s.sched.Acquire(context.Background(), PriorityBatch, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		release()
+		close(admitted)
+	}()
+	waitFor(t, func() bool { _, q := s.sched.Stats(); return q == 1 })
+
+	release, err := s.sched.Acquire(context.Background(), PriorityInteractive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	select {
+	case <-admitted:
+		t.Fatal("batch request ran during quiet hours")
+	case <-time.After(2 * queuePollInterval):
+	}
+
+	setPaused(`{"paused": null}`)
+	select {
+	case <-admitted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch request still held after resuming")
+	}
+}
+
+func TestQuietHoursRejectBatchRequests(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1", deltas: []string{"ok"}}, &streamingTestAdapter{model: "m2"}))
+	s.SetQuietHours(&config.QuietHours{Action: "reject", Windows: []config.QuietWindow{{Start: "00:00", End: "23:59"}}})
+	// The last minute of the day is outside the window.
+	if now := time.Now(); now.Hour() == 23 && now.Minute() == 59 {
+		t.Skip("outside the window")
+	}
+
+	send := func(priority string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(`{"model":"m1","messages":[{"role":"user","content":"hi"}]}`)))
+		r.Header.Set(PriorityHeader, priority)
+		w := httptest.NewRecorder()
+		s.CreateChatCompletion(w, r)
+		return w
+	}
+	w := send("batch")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "quiet_hours") || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("batch request: %d %q %s", w.Code, w.Header().Get("Retry-After"), w.Body)
+	}
+	if w := send("interactive"); w.Code != http.StatusOK {
+		t.Fatalf("interactive request: %d %s", w.Code, w.Body)
+	}
+}
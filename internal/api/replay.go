@@ -0,0 +1,347 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxReplayBody caps the request bodies and outputs the request log keeps
+// to replay requests; larger requests are logged without them. With
+// requestLogSize entries, this bounds what the log holds.
+const maxReplayBody = 256 << 10
+
+var (
+	errReplayNotFound = errors.New("request is not in the request log")
+	errNotReplayable  = errors.New("request was logged without its body")
+)
+
+// replayCapture is what the request log keeps of a chat completion or
+// response to run it again: its body and profile, the API key it came with
+// (nil with auth off), and the text it answered.
+type replayCapture struct {
+	body    []byte
+	profile string
+	key     *APIKey
+	output  string
+}
+
+// captureReplay reads the body of a chat completion or response request,
+// up to maxReplayBody, and puts it back for the handler.
+func captureReplay(r *http.Request) *replayCapture {
+	if r.Method != http.MethodPost || r.Body == nil {
+		return nil
+	}
+	if r.URL.Path != "/v1/chat/completions" && r.URL.Path != "/v1/responses" {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxReplayBody+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || len(body) > maxReplayBody {
+		return nil
+	}
+	return &replayCapture{body: body, profile: r.Header.Get(ProfileHeader)}
+}
+
+type outputObserver interface {
+	SetOutput(string)
+}
+
+// ObserveOutput records the text a request answered, which the request log
+// keeps to compare replays against.
+func ObserveOutput(w http.ResponseWriter, text string) {
+	if mw, ok := w.(outputObserver); ok {
+		mw.SetOutput(text)
+	}
+}
+
+type apiKeyObserver interface {
+	SetAPIKey(*APIKey)
+}
+
+// observeAPIKey records the API key a request came with, which the request
+// log keeps to run the request again under it.
+func observeAPIKey(w http.ResponseWriter, key *APIKey) {
+	if mw, ok := w.(apiKeyObserver); ok {
+		mw.SetAPIKey(key)
+	}
+}
+
+func (r *statusRecorder) SetAPIKey(key *APIKey) {
+	r.apiKey = key
+}
+
+func (r *statusRecorder) SetOutput(text string) {
+	if len(text) > maxReplayBody {
+		text = strings.ToValidUTF8(text[:maxReplayBody], "")
+	}
+	r.output = text
+}
+
+// Request returns the logged request with id, while it is still in the log.
+func (m *Metrics) Request(id uint64) (RequestLogEntry, bool) {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	for _, e := range m.log {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return RequestLogEntry{}, false
+}
+
+// SetMetrics gives the server the request log that Replay runs requests
+// from and shadow traffic is mirrored from. It must be called before the
+// server takes requests.
+func (s *Server) SetMetrics(m *Metrics) {
+	s.metrics = m
+	m.afterRequest = s.mirror
+}
+
+// Replay is a logged request's output next to a new run of it, with a
+// word-level diff from the original output to the replay's.
+type Replay struct {
+	ID       uint64    `json:"id"`
+	Path     string    `json:"path"`
+	Original ReplayRun `json:"original"`
+	Replay   ReplayRun `json:"replay"`
+	Diff     []DiffOp  `json:"diff"`
+}
+
+// ReplayRun is one run of a replayed request.
+type ReplayRun struct {
+	Model     string  `json:"model"`
+	Status    int     `json:"status"`
+	Output    string  `json:"output"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+	// promptTokens and completionTokens are what the run used.
+	promptTokens, completionTokens uint64
+}
+
+type replayKey struct{}
+
+// isReplay reports whether ctx belongs to a replayed request, which must not
+// store its response, start a session from it, continue one or call
+// webhooks.
+func isReplay(ctx context.Context) bool {
+	return ctx.Value(replayKey{}) != nil
+}
+
+// Replay runs the logged request id again, on model or else the model it
+// asked for, and returns the new output next to the original. The rerun acts
+// for the API key the request came with, not the caller's: the key's models,
+// request budget and safety preset apply. It is not streamed and leaves no
+// trace: no stored response, session, webhook or request log entry.
+func (s *Server) Replay(ctx context.Context, id uint64, model string) (Replay, error) {
+	if s.metrics == nil {
+		return Replay{}, errReplayNotFound
+	}
+	entry, ok := s.metrics.Request(id)
+	if !ok {
+		return Replay{}, errReplayNotFound
+	}
+	if entry.replay == nil {
+		return Replay{}, errNotReplayable
+	}
+	return s.rerun(entry.replay.context(ctx), entry, model, "")
+}
+
+// context is ctx, for its deadline and cancellation, carrying the logged
+// request's API key, model policy and safety preset in place of its own
+// values.
+func (c *replayCapture) context(ctx context.Context) context.Context {
+	ctx = withoutValues{ctx}
+	if c.key != nil {
+		ctx = withKey(ctx, c.key)
+	}
+	return ctx
+}
+
+// withoutValues is a context that hides its parent's values.
+type withoutValues struct {
+	context.Context
+}
+
+func (withoutValues) Value(any) any {
+	return nil
+}
+
+// rerun runs a logged request again for Replay, at priority or else the
+// default one. ctx carries the request's API key; see replayCapture.context.
+func (s *Server) rerun(ctx context.Context, entry RequestLogEntry, model, priority string) (Replay, error) {
+	if entry.replay == nil {
+		return Replay{}, errNotReplayable
+	}
+	body, err := replayBody(entry.replay.body, model)
+	if err != nil {
+		return Replay{}, fmt.Errorf("%w: %v", errNotReplayable, err)
+	}
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, replayKey{}, true), http.MethodPost, entry.Path, bytes.NewReader(body))
+	if err != nil {
+		return Replay{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if entry.replay.profile != "" {
+		req.Header.Set(ProfileHeader, entry.replay.profile)
+	}
+	if priority != "" {
+		req.Header.Set(PriorityHeader, priority)
+	}
+
+	rec := &replayRecorder{header: http.Header{}}
+	started := time.Now()
+	if entry.Path == "/v1/chat/completions" {
+		s.CreateChatCompletion(rec, req)
+	} else {
+		s.CreateResponse(rec, req)
+	}
+	run := replayResult(rec.body.Bytes())
+	run.Status = rec.statusCode()
+	run.LatencyMs = durationMs(time.Since(started))
+	run.promptTokens, run.completionTokens = rec.promptTokens, rec.completionTokens
+	return Replay{
+		ID:   entry.ID,
+		Path: entry.Path,
+		Original: ReplayRun{
+			Model:     entry.Model,
+			Status:    entry.Status,
+			Output:    entry.replay.output,
+			LatencyMs: entry.LatencyMs,
+		},
+		Replay: run,
+		Diff:   WordDiff(entry.replay.output, run.Output),
+	}, nil
+}
+
+// replayBody is a logged request body to run again on model, or its own
+// model when model is empty, without streaming.
+func replayBody(body []byte, model string) ([]byte, error) {
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	if model != "" {
+		req["model"], _ = json.Marshal(model)
+	}
+	delete(req, "stream")
+	delete(req, "stream_options")
+	return json.Marshal(req)
+}
+
+// replayResult reads the model and text, or the error, of a chat completion
+// or response body.
+func replayResult(body []byte) ReplayRun {
+	var resp struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Output []struct {
+			Type    string `json:"type"`
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"output"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return ReplayRun{Error: "unreadable response: " + err.Error()}
+	}
+	run := ReplayRun{Model: resp.Model}
+	if resp.Error != nil {
+		run.Error = resp.Error.Message
+	}
+	for _, c := range resp.Choices {
+		run.Output += c.Message.Content
+	}
+	for _, item := range resp.Output {
+		if item.Type != "message" {
+			continue
+		}
+		for _, part := range item.Content {
+			run.Output += part.Text
+		}
+	}
+	return run
+}
+
+// replayRecorder collects the response to a replayed request, or to a
+// prompt an eval runs.
+type replayRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	// promptTokens and completionTokens are what the handler reported
+	// with ObserveTokenUsage.
+	promptTokens, completionTokens uint64
+}
+
+func (r *replayRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *replayRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *replayRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+func (r *replayRecorder) AddObservedTokens(promptTokens, completionTokens uint64) {
+	r.promptTokens += promptTokens
+	r.completionTokens += completionTokens
+}
+
+func (r *replayRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+func (s *Server) replayRequest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "id must be a request log ID")
+		return
+	}
+	var body struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON body")
+		return
+	}
+	replay, err := s.Replay(r.Context(), id, strings.TrimSpace(body.Model))
+	switch {
+	case errors.Is(err, errReplayNotFound):
+		writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("request %d: %v", id, err))
+	case errors.Is(err, errNotReplayable):
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("request %d cannot be replayed: %v", id, err))
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
+	default:
+		writeJSON(w, http.StatusOK, replay)
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+)
+
+func TestReplayRunsALoggedRequestOnAnotherModel(t *testing.T) {
+	m1 := &streamingTestAdapter{model: "m1", deltas: []string{"the old ", "answer"}}
+	m2 := &streamingTestAdapter{model: "m2", deltas: []string{"a new answer"}}
+	s := NewServer(proxy.NewRouter(m1, m2))
+	metrics := NewMetrics()
+	s.SetMetrics(metrics)
+	mux := http.NewServeMux()
+	s.RegisterAdminRoutes(mux)
+	h := metrics.Middleware(openapiv1.HandlerFromMux(s, mux))
+	do := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return w
+	}
+
+	if w := do("/v1/chat/completions", `{"model":"m1","stream":true,"messages":[{"role":"user","content":"hi"}]}`); w.Code != http.StatusOK {
+		t.Fatalf("chat: %d %s", w.Code, w.Body)
+	}
+	logged := metrics.RecentRequests(1)[0]
+	if !logged.Replayable {
+		t.Fatalf("chat completion was not logged as replayable: %+v", logged)
+	}
+	id := strconv.FormatUint(logged.ID, 10)
+
+	w := do("/admin/requests/"+id+"/replay", `{"model":"m2"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("replay: %d %s", w.Code, w.Body)
+	}
+	var got Replay
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Original.Model != "m1" || got.Original.Output != "the old answer" {
+		t.Fatalf("original = %+v", got.Original)
+	}
+	if got.Replay.Model != "m2" || got.Replay.Status != http.StatusOK || got.Replay.Output != "a new answer" {
+		t.Fatalf("replay = %+v", got.Replay)
+	}
+	if want := []DiffOp{{DiffDelete, "the old"}, {DiffInsert, "a new"}, {DiffEqual, " answer"}}; !reflect.DeepEqual(got.Diff, want) {
+		t.Fatalf("diff = %+v, want %+v", got.Diff, want)
+	}
+	if len(m2.chats) != 1 || m2.chats[0].Messages[0].Content != "hi" {
+		t.Fatalf("m2 was asked %+v", m2.chats)
+	}
+
+	if w := do("/admin/requests/"+id+"/replay", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"model":"m1"`) {
+		t.Fatalf("replay on the original model: %d %s", w.Code, w.Body)
+	}
+	if w := do("/admin/requests/999/replay", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("replay of an unknown request: %d %s", w.Code, w.Body)
+	}
+	if adminID := metrics.RecentRequests(1)[0].ID; adminID == logged.ID {
+		t.Fatal("admin requests were not logged")
+	} else if w := do("/admin/requests/"+strconv.FormatUint(adminID, 10)+"/replay", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("replay of an admin request: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestReplayActsForTheLoggedRequestsKey(t *testing.T) {
+	m1 := &safetyTestAdapter{streamingTestAdapter: streamingTestAdapter{model: "m1", deltas: []string{"answer"}}, safety: make(chan string, 2)}
+	m2 := &streamingTestAdapter{model: "m2", deltas: []string{"other answer"}}
+	s := NewServer(proxy.NewRouter(m1, m2))
+	metrics := NewMetrics()
+	s.SetMetrics(metrics)
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "admin", Key: "sk-admin", Scopes: []string{config.ScopeAll}, Safety: proxy.SafetyFull},
+		{Name: "tool", Key: "sk-tool", Scopes: []string{config.ScopeChat}, Safety: proxy.SafetyReadOnly, DenyModels: []string{"m2"}},
+	})
+	mux := http.NewServeMux()
+	s.RegisterAdminRoutes(mux)
+	h := metrics.Middleware(auth.Middleware(openapiv1.HandlerFromMux(s, mux)))
+	do := func(token, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do("sk-tool", "/v1/chat/completions", `{"model":"m1","messages":[{"role":"user","content":"hi"}]}`); w.Code != http.StatusOK {
+		t.Fatalf("chat: %d %s", w.Code, w.Body)
+	}
+	<-m1.safety
+	id := strconv.FormatUint(metrics.RecentRequests(1)[0].ID, 10)
+
+	if w := do("sk-admin", "/admin/requests/"+id+"/replay", ""); w.Code != http.StatusOK {
+		t.Fatalf("replay: %d %s", w.Code, w.Body)
+	}
+	if safety := <-m1.safety; safety != proxy.SafetyReadOnly {
+		t.Fatalf("replay ran with safety %q, want the logged key's %q", safety, proxy.SafetyReadOnly)
+	}
+	w := do("sk-admin", "/admin/requests/"+id+"/replay", `{"model":"m2"}`)
+	var got Replay
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Replay.Status != http.StatusForbidden || len(m2.chats) != 0 {
+		t.Fatalf("replay on a model the logged key may not use = %+v", got.Replay)
+	}
+}
+
+func TestRequestsAuthRejectedAreNotReplayable(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1", deltas: []string{"answer"}}, &streamingTestAdapter{model: "m2"}))
+	metrics := NewMetrics()
+	s.SetMetrics(metrics)
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "models", Key: "sk-models", Scopes: []string{config.ScopeModels}},
+	})
+	h := metrics.Middleware(auth.Middleware(openapiv1.HandlerFromMux(s, http.NewServeMux())))
+
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "sk-wrong": http.StatusUnauthorized, "sk-models": http.StatusForbidden} {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m1","messages":[{"role":"user","content":"hi"}]}`))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Fatalf("token %q: %d %s, want %d", token, w.Code, w.Body, want)
+		}
+		if logged := metrics.RecentRequests(1)[0]; logged.Replayable {
+			t.Fatalf("token %q: a request auth rejected was logged as replayable: %+v", token, logged)
+		}
+	}
+}
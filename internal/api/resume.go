@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"llm-proxy/internal/openapiv1"
+)
+
+const (
+	// streamResumeGrace is how long a turn keeps running with nobody
+	// following its stream, waiting for the client to reconnect.
+	streamResumeGrace = time.Minute
+	// streamRetention is how long a finished stream can still be replayed.
+	streamRetention = 5 * time.Minute
+)
+
+// eventWriter is where a response stream's events go: the client's SSE
+// connection or the resumable event log in front of it.
+type eventWriter interface {
+	writeJSON(any) error
+	writeDone() error
+}
+
+// responseStream buffers the events of one streamed response and relays them
+// to every connected follower: the original request and any client that
+// reconnected through GET /v1/responses/{id}/events. The turn outlives its
+// followers by streamResumeGrace before it is cancelled.
+type responseStream struct {
+	owner  string
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	events    []bufferedEvent
+	lastSeq   int64
+	done      bool
+	finished  chan struct{}
+	followers map[*sseWriter]struct{}
+	abandon   *time.Timer
+}
+
+type bufferedEvent struct {
+	seq  int64
+	data []byte
+}
+
+// writeJSON buffers an event and relays it. Events without a
+// sequence_number get the next one. Followers that fail are dropped; the
+// turn itself never sees a write error.
+func (st *responseStream) writeJSON(v any) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	seq := st.lastSeq + 1
+	if m, ok := v.(map[string]any); ok {
+		if n, ok := m["sequence_number"].(int64); ok {
+			seq = n
+		} else {
+			m["sequence_number"] = seq
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	st.lastSeq = seq
+	st.events = append(st.events, bufferedEvent{seq: seq, data: data})
+	for f := range st.followers {
+		if f.write("data: %s\n\n", data) != nil {
+			st.detachLocked(f)
+		}
+	}
+	return nil
+}
+
+func (st *responseStream) writeDone() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.done {
+		return nil
+	}
+	st.done = true
+	for f := range st.followers {
+		_ = f.writeDone()
+	}
+	if st.abandon != nil {
+		st.abandon.Stop()
+	}
+	close(st.finished)
+	return nil
+}
+
+// attach replays the events after seq to f and subscribes it to new ones.
+// It reports false when the stream has already finished; the replay then
+// ends with [DONE].
+func (st *responseStream) attach(f *sseWriter, after int64) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, ev := range st.events {
+		if ev.seq > after {
+			if f.write("data: %s\n\n", ev.data) != nil {
+				return false
+			}
+		}
+	}
+	if st.done {
+		_ = f.writeDone()
+		return false
+	}
+	st.followers[f] = struct{}{}
+	if st.abandon != nil {
+		st.abandon.Stop()
+		st.abandon = nil
+	}
+	return true
+}
+
+func (st *responseStream) detach(f *sseWriter) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.detachLocked(f)
+}
+
+func (st *responseStream) detachLocked(f *sseWriter) {
+	if _, ok := st.followers[f]; !ok {
+		return
+	}
+	delete(st.followers, f)
+	if len(st.followers) == 0 && !st.done && st.abandon == nil {
+		st.abandon = time.AfterFunc(streamResumeGrace, st.cancel)
+	}
+}
+
+// responseStreams indexes resumable streams by response ID.
+type responseStreams struct {
+	mu sync.Mutex
+	m  map[string]*responseStream
+}
+
+// start registers the stream of response id. cancel stops its turn once
+// the stream has been abandoned. The stream is forgotten streamRetention
+// after it finishes.
+func (rs *responseStreams) start(id, owner string, cancel context.CancelFunc) *responseStream {
+	st := &responseStream{
+		owner:     owner,
+		cancel:    cancel,
+		lastSeq:   -1,
+		finished:  make(chan struct{}),
+		followers: map[*sseWriter]struct{}{},
+	}
+	rs.mu.Lock()
+	if rs.m == nil {
+		rs.m = map[string]*responseStream{}
+	}
+	rs.m[id] = st
+	rs.mu.Unlock()
+	go func() {
+		<-st.finished
+		time.Sleep(streamRetention)
+		rs.mu.Lock()
+		delete(rs.m, id)
+		rs.mu.Unlock()
+	}()
+	return st
+}
+
+func (rs *responseStreams) get(id, owner string) (*responseStream, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	st, ok := rs.m[id]
+	if !ok || st.owner != owner {
+		return nil, false
+	}
+	return st, true
+}
+
+// follow relays st to the client of r, starting after sequence number
+// after, until the stream finishes or the client goes away.
+func (st *responseStream) follow(r *http.Request, sse *sseWriter, after int64) {
+	stopKeepAlive := sse.keepAlive(sseKeepAliveInterval, "waiting for backend")
+	defer stopKeepAlive()
+	if !st.attach(sse, after) {
+		return
+	}
+	select {
+	case <-st.finished:
+	case <-r.Context().Done():
+	}
+	st.detach(sse)
+}
+
+// StreamResponseEvents resumes a streamed response: it replays the events
+// after starting_after (all of them when absent) and then follows the stream
+// live until it completes.
+func (s *Server) StreamResponseEvents(w http.ResponseWriter, r *http.Request, responseID string, params openapiv1.StreamResponseEventsParams) {
+	after := int64(-1)
+	if params.StartingAfter != nil {
+		after = *params.StartingAfter
+	}
+	st, ok := s.streams.get(responseID, keyName(r))
+	if !ok {
+		writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No resumable stream for response '%s'.", responseID))
+		return
+	}
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	st.follow(r, sse, after)
+}
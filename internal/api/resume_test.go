@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+)
+
+// gatedAdapter streams "a", waits for gate, then streams "b".
+type gatedAdapter struct {
+	streamingTestAdapter
+	sentA chan struct{}
+	gate  chan struct{}
+}
+
+func (a *gatedAdapter) RespondStreamEvents(ctx context.Context, req proxy.ResponsesRequest, onEvent func(proxy.ResponseEvent) error) (proxy.ResponsesResponse, error) {
+	if err := onEvent(proxy.ResponseEvent{Kind: proxy.ResponseEventOutput, Delta: "a"}); err != nil {
+		return proxy.ResponsesResponse{}, err
+	}
+	close(a.sentA)
+	select {
+	case <-a.gate:
+	case <-ctx.Done():
+		return proxy.ResponsesResponse{}, ctx.Err()
+	}
+	if err := onEvent(proxy.ResponseEvent{Kind: proxy.ResponseEventOutput, Delta: "b"}); err != nil {
+		return proxy.ResponsesResponse{}, err
+	}
+	return proxy.ResponsesResponse{Model: req.Model, Text: "ab"}, nil
+}
+
+func TestResponseStreamResumesAfterDisconnect(t *testing.T) {
+	adapter := &gatedAdapter{streamingTestAdapter: streamingTestAdapter{model: "m1"}, sentA: make(chan struct{}), gate: make(chan struct{})}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+
+	clientCtx, disconnect := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader([]byte(`{"model":"m1","stream":true,"input":"hi"}`))).WithContext(clientCtx)
+	w := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		s.CreateResponse(w, r)
+	}()
+	<-adapter.sentA
+
+	s.streams.mu.Lock()
+	var id string
+	var st *responseStream
+	for k, v := range s.streams.m {
+		id, st = k, v
+	}
+	s.streams.mu.Unlock()
+	disconnect()
+	waitFor(t, func() bool {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		return len(st.followers) == 0
+	})
+	close(adapter.gate)
+	<-finished
+
+	var lastSeen int64 = -1
+	for _, ev := range decodeSSEEvents(t, w.Body.String()) {
+		if ev["type"] == "response.output_text.delta" && ev["delta"] == "b" {
+			t.Fatal("disconnected client still received events")
+		}
+		lastSeen = int64(ev["sequence_number"].(float64))
+	}
+
+	after := lastSeen
+	rw := httptest.NewRecorder()
+	s.StreamResponseEvents(rw, httptest.NewRequest(http.MethodGet, "/v1/responses/"+id+"/events", nil), id, openapiv1.StreamResponseEventsParams{StartingAfter: &after})
+	events := decodeSSEEvents(t, rw.Body.String())
+	if len(events) == 0 || int64(events[0]["sequence_number"].(float64)) != lastSeen+1 {
+		t.Fatalf("resume did not start after %d: %s", lastSeen, rw.Body)
+	}
+	var deltas []string
+	for _, ev := range events {
+		if ev["type"] == "response.output_text.delta" {
+			deltas = append(deltas, ev["delta"].(string))
+		}
+	}
+	if strings.Join(deltas, "") != "b" || events[len(events)-1]["type"] != "response.completed" {
+		t.Fatalf("unexpected resumed stream: %s", rw.Body)
+	}
+	if !strings.HasSuffix(rw.Body.String(), "data: [DONE]\n\n") {
+		t.Fatal("resumed stream did not end with [DONE]")
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// queuePollInterval is how often a queued request re-checks its position.
+const queuePollInterval = 500 * time.Millisecond
+
+// Priority orders queued requests: every waiting interactive request is
+// admitted before any batch request.
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota
+	PriorityBatch
+	numPriorities
+)
+
+func (p Priority) String() string {
+	if p == PriorityBatch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+// Scheduler bounds how many requests run a backend CLI at once. Requests over
+// the limit wait in FIFO order within their priority; a limit of zero or less
+// means unlimited.
+type Scheduler struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	queues  [numPriorities][]*schedWaiter
+	// hold, when set, keeps requests of a priority queued whatever the
+	// limit, as quiet hours do with batch requests.
+	hold func(Priority) bool
+}
+
+type schedWaiter struct {
+	ready chan struct{}
+}
+
+func NewScheduler(limit int) *Scheduler {
+	return &Scheduler{limit: limit}
+}
+
+// SetLimit changes the concurrency limit; raising it admits queued requests.
+func (s *Scheduler) SetLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	s.dispatchLocked()
+}
+
+// Stats returns the number of running and queued requests.
+func (s *Scheduler) Stats() (running, queued int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running, s.queuedLocked()
+}
+
+func (s *Scheduler) queuedLocked() int {
+	n := 0
+	for _, q := range s.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// Acquire blocks until the request may run or ctx is done. While queued,
+// onWait (if set) is called with the 1-based queue position whenever it
+// changes; batch requests count every interactive request ahead of them. The
+// returned release func must be called when the request is done.
+func (s *Scheduler) Acquire(ctx context.Context, prio Priority, onWait func(position int)) (func(), error) {
+	if prio < 0 || prio >= numPriorities {
+		prio = PriorityInteractive
+	}
+	s.mu.Lock()
+	if !s.heldLocked(prio) && (s.limit <= 0 || (s.running < s.limit && s.queuedLocked() == 0)) {
+		s.running++
+		s.mu.Unlock()
+		return s.releaseFunc(), nil
+	}
+	w := &schedWaiter{ready: make(chan struct{})}
+	s.queues[prio] = append(s.queues[prio], w)
+	// Held requests may be all that is queued, with room to run this one.
+	s.dispatchLocked()
+	s.mu.Unlock()
+
+	lastPos := 0
+	notify := func() {
+		if onWait == nil {
+			return
+		}
+		if pos := s.position(w); pos > 0 && pos != lastPos {
+			lastPos = pos
+			onWait(pos)
+		}
+	}
+	notify()
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ready:
+			return s.releaseFunc(), nil
+		case <-ctx.Done():
+			s.mu.Lock()
+			queued := s.removeLocked(w)
+			s.mu.Unlock()
+			if !queued {
+				// Granted concurrently with the cancellation.
+				s.releaseFunc()()
+			}
+			return nil, ctx.Err()
+		case <-ticker.C:
+			// A hold may have ended since the last release.
+			s.dispatch()
+			notify()
+		}
+	}
+}
+
+func (s *Scheduler) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.running--
+			s.dispatchLocked()
+		})
+	}
+}
+
+func (s *Scheduler) dispatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dispatchLocked()
+}
+
+func (s *Scheduler) heldLocked(prio Priority) bool {
+	return s.hold != nil && s.hold(prio)
+}
+
+func (s *Scheduler) dispatchLocked() {
+	for p := range s.queues {
+		if s.heldLocked(Priority(p)) {
+			continue
+		}
+		for len(s.queues[p]) > 0 && (s.limit <= 0 || s.running < s.limit) {
+			w := s.queues[p][0]
+			s.queues[p] = s.queues[p][1:]
+			s.running++
+			close(w.ready)
+		}
+	}
+}
+
+func (s *Scheduler) position(w *schedWaiter) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ahead := 0
+	for _, queue := range s.queues {
+		for i, q := range queue {
+			if q == w {
+				return ahead + i + 1
+			}
+		}
+		ahead += len(queue)
+	}
+	return 0
+}
+
+func (s *Scheduler) removeLocked(w *schedWaiter) bool {
+	for p, queue := range s.queues {
+		for i, q := range queue {
+			if q == w {
+				s.queues[p] = append(queue[:i], queue[i+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSchedulerQueuesInOrderAndReportsPosition(t *testing.T) {
+	s := NewScheduler(1)
+	release, err := s.Acquire(context.Background(), PriorityInteractive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	positions := make(chan int, 8)
+	order := make(chan string, 2)
+	start := func(name string, onWait func(int)) {
+		go func() {
+			rel, err := s.Acquire(context.Background(), PriorityInteractive, onWait)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- name
+			rel()
+		}()
+	}
+	start("first", nil)
+	waitFor(t, func() bool { _, q := s.Stats(); return q == 1 })
+	start("second", func(pos int) { positions <- pos })
+	waitFor(t, func() bool { _, q := s.Stats(); return q == 2 })
+
+	if got := <-positions; got != 2 {
+		t.Fatalf("expected initial position 2, got %d", got)
+	}
+	release()
+	if got := <-order; got != "first" {
+		t.Fatalf("expected first waiter to run first, got %s", got)
+	}
+	if got := <-order; got != "second" {
+		t.Fatalf("expected second waiter to run next, got %s", got)
+	}
+	if running, queued := s.Stats(); running != 0 || queued != 0 {
+		t.Fatalf("expected idle scheduler, got running=%d queued=%d", running, queued)
+	}
+}
+
+func TestSchedulerCancelledWaiterLeavesQueue(t *testing.T) {
+	s := NewScheduler(1)
+	release, _ := s.Acquire(context.Background(), PriorityInteractive, nil)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := s.Acquire(ctx, PriorityInteractive, nil)
+		errc <- err
+	}()
+	waitFor(t, func() bool { _, q := s.Stats(); return q == 1 })
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, queued := s.Stats(); queued != 0 {
+		t.Fatalf("expected empty queue, got %d", queued)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSchedulerAdmitsInteractiveBeforeBatch(t *testing.T) {
+	s := NewScheduler(1)
+	release, _ := s.Acquire(context.Background(), PriorityBatch, nil)
+
+	order := make(chan Priority, 2)
+	batchPos := make(chan int, 8)
+	go func() {
+		rel, _ := s.Acquire(context.Background(), PriorityBatch, func(pos int) { batchPos <- pos })
+		order <- PriorityBatch
+		rel()
+	}()
+	waitFor(t, func() bool { _, q := s.Stats(); return q == 1 })
+	go func() {
+		rel, _ := s.Acquire(context.Background(), PriorityInteractive, nil)
+		order <- PriorityInteractive
+		rel()
+	}()
+	waitFor(t, func() bool { _, q := s.Stats(); return q == 2 })
+	waitFor(t, func() bool {
+		for {
+			select {
+			case pos := <-batchPos:
+				if pos == 2 {
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	})
+
+	release()
+	if got := <-order; got != PriorityInteractive {
+		t.Fatalf("expected interactive request first, got %s", got)
+	}
+	if got := <-order; got != PriorityBatch {
+		t.Fatalf("expected batch request last, got %s", got)
+	}
+}
@@ -2,39 +2,411 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"llm-proxy/internal/config"
 	"llm-proxy/internal/openapiv1"
 	"llm-proxy/internal/proxy"
+	"llm-proxy/internal/store"
+	"llm-proxy/internal/tokenizer"
 )
 
 type Server struct {
-	router *proxy.Router
+	router   *proxy.Router
+	profiles atomic.Pointer[map[string]*proxy.Router]
+	debug    atomic.Bool
+	history  atomic.Pointer[proxy.HistoryPolicy]
+	sched    *Scheduler
+	coalesce atomic.Pointer[proxy.Coalescer]
+	// store keeps served responses when set; see SetStore.
+	store *store.Store
+	// metrics holds the request log Replay reads; see SetMetrics.
+	metrics  *Metrics
+	inflight inflightResponses
+	streams  responseStreams
+	webhooks webhookSender
+	users    userLimiter
+	sessions upstreamSessions
+	// partialOnFailure ends a stream whose backend fails midway with what
+	// was streamed instead of an error; see SetPartialOnFailure.
+	partialOnFailure atomic.Bool
+	budget           atomic.Pointer[requestBudget]
+	tokenizers       atomic.Pointer[tokenizer.Set]
+	contextWindows   atomic.Pointer[config.ContextWindows]
+	outputFilters    atomic.Pointer[proxy.OutputFilters]
+	compat           atomic.Pointer[compatSettings]
+	loops            loopDetector
+	quiet            quietHours
+	deprecated       atomic.Pointer[map[string]config.DeprecatedModel]
+	bestOfN          atomic.Pointer[bestOfNConfig]
+	shadow           shadowTraffic
+	evals            evalRuns
+	// maxStream caps a stream's backend run; see SetMaxStreamDuration.
+	maxStream atomic.Int64
+	// started dates the models in ListModels.
+	started time.Time
+}
+
+const (
+	// ProfileHeader selects a backend profile for keys not pinned to one.
+	ProfileHeader = "X-LLM-Proxy-Profile"
+	// CodexHomeHeader points Codex at another CODEX_HOME (and so another
+	// ChatGPT login) for one request. Only admin keys may use it.
+	CodexHomeHeader = "X-LLM-Proxy-Codex-Home"
+	// PriorityHeader marks a request "interactive" (the default) or "batch".
+	PriorityHeader = "X-LLM-Proxy-Priority"
+	// RoutedModelHeader names the model an "auto" request was routed to.
+	RoutedModelHeader = "X-LLM-Proxy-Routed-Model"
+	// ConversationHeader ties requests into one conversation so virtual
+	// models (auto, races) keep routing its turns to the same model.
+	ConversationHeader = "X-LLM-Proxy-Conversation"
+	// WebhookHeader overrides the key's webhook URL for one /v1/responses
+	// request.
+	WebhookHeader = "X-LLM-Proxy-Webhook"
+)
+
+// SetProfiles replaces the named backend profiles. Requests without a profile
+// keep using the router passed to NewServer.
+func (s *Server) SetProfiles(profiles map[string]*proxy.Router) {
+	s.profiles.Store(&profiles)
+}
+
+// routerFor picks the router for a request: the profile its API key is
+// pinned to, else the one named by ProfileHeader, else the default.
+func (s *Server) routerFor(r *http.Request) (*proxy.Router, int, error) {
+	name := strings.TrimSpace(r.Header.Get(ProfileHeader))
+	if key := KeyFromContext(r.Context()); key != nil && key.Profile != "" {
+		if name != "" && name != key.Profile {
+			return nil, http.StatusForbidden, fmt.Errorf("API key %q is limited to profile %q", key.Name, key.Profile)
+		}
+		name = key.Profile
+	}
+	router := s.router
+	if name != "" {
+		profiles := s.profiles.Load()
+		if profiles == nil || (*profiles)[name] == nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("unknown profile: %s", name)
+		}
+		router = (*profiles)[name]
+	}
+	if codexHome := strings.TrimSpace(r.Header.Get(CodexHomeHeader)); codexHome != "" {
+		if !KeyFromContext(r.Context()).Allows(config.ScopeAdmin) {
+			return nil, http.StatusForbidden, fmt.Errorf("%s requires an API key with the admin scope", CodexHomeHeader)
+		}
+		if !filepath.IsAbs(codexHome) {
+			return nil, http.StatusBadRequest, fmt.Errorf("%s must be an absolute path", CodexHomeHeader)
+		}
+		if info, err := os.Stat(codexHome); err != nil || !info.IsDir() {
+			return nil, http.StatusBadRequest, fmt.Errorf("%s: %s is not a directory", CodexHomeHeader, codexHome)
+		}
+		router = router.WithCodexEnv("CODEX_HOME=" + codexHome)
+	}
+	return router, 0, nil
+}
+
+// priorityFor returns the scheduling priority of a request. Keys configured
+// as batch stay batch; the header can only lower a request's priority.
+func (s *Server) priorityFor(r *http.Request) (Priority, error) {
+	prio := PriorityInteractive
+	if key := KeyFromContext(r.Context()); key != nil && key.Priority == config.PriorityBatch {
+		prio = PriorityBatch
+	}
+	switch v := strings.ToLower(strings.TrimSpace(r.Header.Get(PriorityHeader))); v {
+	case "", config.PriorityInteractive:
+	case config.PriorityBatch:
+		prio = PriorityBatch
+	default:
+		return prio, fmt.Errorf("%s: unknown priority %q (want interactive or batch)", PriorityHeader, v)
+	}
+	return prio, nil
+}
+
+func (s *Server) profileError(w http.ResponseWriter, status int, err error) {
+	typ := "invalid_request_error"
+	if status == http.StatusForbidden {
+		typ = "permission_error"
+	}
+	writeError(w, status, typ, err.Error())
 }
 
 func NewServer(router *proxy.Router) *Server {
-	return &Server{router: router}
+	s := &Server{router: router, sched: NewScheduler(0), started: time.Now()}
+	s.sched.hold = func(prio Priority) bool {
+		return pauseHolds() || (prio == PriorityBatch && s.quiet.holdsBatch())
+	}
+	return s
+}
+
+// SetCoalesceIdentical makes identical concurrent requests share one upstream
+// turn.
+func (s *Server) SetCoalesceIdentical(on bool) {
+	if !on {
+		s.coalesce.Store(nil)
+	} else if s.coalesce.Load() == nil {
+		s.coalesce.Store(proxy.NewCoalescer())
+	}
+}
+
+// SetPartialOnFailure makes streams whose backend fails after some output
+// end normally, marked as cut short (finish_reason "error", or an incomplete
+// response), so clients keep the partial answer.
+func (s *Server) SetPartialOnFailure(on bool) {
+	s.partialOnFailure.Store(on)
+}
+
+// SetMaxStreamDuration caps how long a stream's backend may run, counted
+// from when it starts; zero means no cap. A stream that runs out of time ends
+// with what it streamed, marked incomplete ("max_duration").
+func (s *Server) SetMaxStreamDuration(d time.Duration) {
+	s.maxStream.Store(int64(d))
+}
+
+// errStreamTooLong stops a backend that ran past the max stream duration.
+var errStreamTooLong = errors.New("stream reached max_duration")
+
+// incompleteMaxDuration is the Incomplete reason of a stream cut off by the
+// max stream duration.
+const incompleteMaxDuration = "max_duration"
+
+// limitStream bounds ctx by the max stream duration.
+func (s *Server) limitStream(ctx context.Context) (context.Context, context.CancelFunc) {
+	d := time.Duration(s.maxStream.Load())
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, d, errStreamTooLong)
+}
+
+// streamTooLong reports whether ctx was ended by the max stream duration.
+func streamTooLong(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errStreamTooLong)
+}
+
+func (s *Server) maybeCoalesce(adapter proxy.Adapter) proxy.Adapter {
+	if c := s.coalesce.Load(); c != nil {
+		return c.Wrap(adapter)
+	}
+	return adapter
+}
+
+// SetOutputFilters sets the filters answers go through before clients get
+// them.
+func (s *Server) SetOutputFilters(f proxy.OutputFilters) {
+	s.outputFilters.Store(&f)
+}
+
+func (s *Server) filterOutput(adapter proxy.Adapter) proxy.Adapter {
+	if f := s.outputFilters.Load(); f != nil {
+		return proxy.FilterOutput(adapter, *f)
+	}
+	return adapter
+}
+
+// SetStore persists every completed Responses API response in st. It must
+// be called before the server starts handling requests.
+func (s *Server) SetStore(st *store.Store) {
+	s.store = st
+}
+
+// saveResponse stores a completed response object along with the
+// conversation and Codex thread that produced it. Failures are only logged:
+// the client already has its answer.
+func (s *Server) saveResponse(r *http.Request, body map[string]any, threadID string) {
+	if s.store == nil || isReplay(r.Context()) {
+		return
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("store response: %v", err)
+		return
+	}
+	id, _ := body["id"].(string)
+	model, _ := body["model"].(string)
+	err = s.store.SaveResponse(store.Response{
+		ID:           id,
+		Owner:        keyName(r),
+		Conversation: proxy.ConversationFromContext(r.Context()),
+		Model:        model,
+		ThreadID:     threadID,
+		Body:         raw,
+	})
+	if err != nil {
+		log.Printf("store response: %v", err)
+	}
+}
+
+// SetConcurrencyLimit bounds how many requests run a backend at once; zero
+// means unlimited. Requests over the limit queue in arrival order.
+func (s *Server) SetConcurrencyLimit(n int) {
+	s.sched.SetLimit(n)
+}
+
+// SetDebug controls whether upstream error responses include the CLI stderr
+// captured for the request.
+func (s *Server) SetDebug(on bool) {
+	s.debug.Store(on)
+}
+
+// SetHistoryPolicy bounds the chat history sent to the backends.
+func (s *Server) SetHistoryPolicy(p proxy.HistoryPolicy) {
+	s.history.Store(&p)
+}
+
+// compactMessages trims messages per the history policy. When a summary model
+// is configured the dropped turns are replaced by a system message holding
+// their summary; if summarizing fails the request goes ahead without it.
+func (s *Server) compactMessages(ctx context.Context, router *proxy.Router, messages []proxy.Message) []proxy.Message {
+	policy := s.history.Load()
+	if policy == nil {
+		return messages
+	}
+	kept, dropped := policy.TrimHistory(messages)
+	if len(dropped) == 0 || policy.SummaryModel == "" {
+		return kept
+	}
+	adapter, model, err := router.Resolve(ctx, policy.SummaryModel)
+	if err != nil {
+		log.Printf("history summary: %v", err)
+		return kept
+	}
+	resp, err := adapter.Chat(ctx, proxy.ChatRequest{Model: model, Messages: proxy.SummaryPrompt(dropped)})
+	if err != nil || strings.TrimSpace(resp.Text) == "" {
+		log.Printf("history summary via %s failed: %v", policy.SummaryModel, err)
+		return kept
+	}
+	summary := proxy.Message{Role: "system", Content: "Summary of the earlier conversation:\n" + strings.TrimSpace(resp.Text)}
+	out := make([]proxy.Message, 0, len(kept)+1)
+	i := 0
+	for i < len(kept) && (kept[i].Role == "system" || kept[i].Role == "developer") {
+		i++
+	}
+	out = append(out, kept[:i]...)
+	out = append(out, summary)
+	return append(out, kept[i:]...)
+}
+
+// upstreamErrors maps a backend failure class to the HTTP status and OpenAI
+// error type and code clients expect for it, so SDK retry logic applies.
+// Unrecognised failures stay a 502 upstream_error.
+var upstreamErrors = map[proxy.ErrorClass]struct {
+	status int
+	typ    string
+	code   string
+}{
+	proxy.ErrorAuth:           {http.StatusUnauthorized, "authentication_error", "invalid_api_key"},
+	proxy.ErrorModelNotFound:  {http.StatusNotFound, "invalid_request_error", "model_not_found"},
+	proxy.ErrorRateLimit:      {http.StatusTooManyRequests, "rate_limit_error", "rate_limit_exceeded"},
+	proxy.ErrorCrash:          {http.StatusInternalServerError, "server_error", "backend_crashed"},
+	proxy.ErrorTimeout:        {http.StatusServiceUnavailable, "server_error", "timeout"},
+	proxy.ErrorUnavailable:    {http.StatusServiceUnavailable, "server_error", "backend_unavailable"},
+	proxy.ErrorPermission:     {http.StatusForbidden, "permission_error", "permission_required"},
+	proxy.ErrorResourceLimit:  {http.StatusInternalServerError, "server_error", "resource_limit_exceeded"},
+	proxy.ErrorNetwork:        {http.StatusServiceUnavailable, "server_error", "backend_unreachable"},
+	proxy.ErrorOutputTooLarge: {http.StatusBadGateway, "upstream_error", "output_too_large"},
+	proxy.ErrorUnknown:        {http.StatusBadGateway, "upstream_error", ""},
+}
+
+// upstreamError describes a backend failure as an OpenAI error object and
+// returns the HTTP status it maps to. A backend over its usage limit also
+// gets a Retry-After header, which streams that already started ignore.
+func (s *Server) upstreamError(w http.ResponseWriter, r *http.Request, err error) (int, map[string]any) {
+	stderr := strings.TrimSpace(proxy.StderrFromContext(r.Context()).String())
+	var rl *proxy.RateLimitError
+	if errors.As(err, &rl) {
+		ObserveCooldown(w, rl.Backend, rl.Model, rl.Reset)
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(time.Until(rl.Reset).Seconds())))))
+	}
+	class := proxy.ClassifyError(err, stderr)
+	e := upstreamErrors[class]
+	msg := err.Error()
+	if class == proxy.ErrorNetwork {
+		msg += " (the CLI could not reach its API: check the network and outbound proxy settings, e.g. with `llm-proxy doctor`)"
+	}
+	body := map[string]any{
+		"type":    e.typ,
+		"message": msg,
+	}
+	if e.code != "" {
+		body["code"] = e.code
+	}
+	if s.debug.Load() && stderr != "" {
+		body["stderr"] = stderr
+	}
+	return e.status, body
+}
+
+// writeUpstreamError writes a backend failure with its mapped status.
+func (s *Server) writeUpstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	status, body := s.upstreamError(w, r, err)
+	writeJSON(w, status, map[string]any{"error": body})
+}
+
+// resolveError reports a model that could not be resolved: unknown models
+// are 404 model_not_found as on OpenAI, models the API key may not use 403
+// model_not_allowed, backend failures while checking keep their mapped
+// status, anything else is a bad request.
+func (s *Server) resolveError(w http.ResponseWriter, r *http.Request, err error) {
+	var denied *proxy.ModelNotAllowedError
+	if errors.As(err, &denied) {
+		writeModelNotAllowed(w, KeyFromContext(r.Context()), denied.Model)
+		return
+	}
+	status, body := s.upstreamError(w, r, err)
+	if status == http.StatusBadGateway {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	writeJSON(w, status, map[string]any{"error": body})
 }
 
 func (s *Server) ListModels(w http.ResponseWriter, r *http.Request) {
-	models, err := s.router.ListModels(r.Context())
+	router, status, err := s.routerFor(r)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		s.profileError(w, status, err)
+		return
+	}
+	models, err := router.ListModels(r.Context())
+	if err != nil {
+		s.writeUpstreamError(w, r, err)
 		return
 	}
 
+	key := KeyFromContext(r.Context())
 	out := make([]openapiv1.Model, 0, len(models))
 	for _, m := range models {
-		owner := string(m.Backend)
-		out = append(out, openapiv1.Model{
+		if !key.AllowsModel(m.ID) {
+			continue
+		}
+		owner, warm := string(m.Backend), m.Warm
+		model := openapiv1.Model{
 			Id:      m.ID,
 			Object:  openapiv1.ModelObjectModel,
+			Created: int(s.started.Unix()),
 			OwnedBy: &owner,
-		})
+			Warm:    &warm,
+		}
+		if window := s.contextWindow(m.ID); window > 0 {
+			model.ContextWindow = &window
+		}
+		if m.Base != "" {
+			base := m.Base
+			model.BaseModel = &base
+		}
+		out = append(out, model)
 	}
 
 	writeJSON(w, http.StatusOK, openapiv1.ModelListResponse{
@@ -44,6 +416,7 @@ func (s *Server) ListModels(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) CreateChatCompletion(w http.ResponseWriter, r *http.Request) {
+	r = withConversation(r)
 	var req openapiv1.ChatCompletionsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON body")
@@ -55,61 +428,156 @@ func (s *Server) CreateChatCompletion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	ObserveModel(w, req.Model)
+	ObserveTags(w, metadataTags(req.Metadata))
+	if !s.allowUser(w, r, req.User) || !allowModel(w, r, req.Model) {
+		return
+	}
+	var ok bool
+	if req.Model, ok = s.redirectModel(w, r, req.Model); !ok {
+		return
+	}
+	if !s.allowLoop(w, r, []any{req.Model, req.Messages}, repeatedAssistantTurns(chatMessages(req))) {
+		return
+	}
 	if len(req.Messages) == 0 {
 		writeError(w, http.StatusBadRequest, "invalid_request_error", "messages are required")
 		return
 	}
+	format, err := chatOutputFormat(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	n, ok := s.allowBestOfN(w, req.BestOfN, req.Stream != nil && *req.Stream)
+	if !ok {
+		return
+	}
 	if req.Stream != nil && *req.Stream {
-		s.streamChatCompletion(w, r, req)
+		s.streamChatCompletion(w, r, req, format)
 		return
 	}
 
-	adapter, err := s.router.AdapterForModel(r.Context(), req.Model)
+	router, status, err := s.routerFor(r)
+	if err != nil {
+		s.profileError(w, status, err)
+		return
+	}
+	prio, err := s.priorityFor(r)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
 		return
 	}
+	if !s.allowTraffic(w, prio) {
+		return
+	}
+	model := router.RouteChat(r.Context(), proxy.ChatRequest{Model: req.Model, Messages: chatMessages(req), ReasoningEffort: stringValue(req.ReasoningEffort)})
+	if model != req.Model && !allowModel(w, r, model) {
+		return
+	}
+	adapter, backendModel, err := router.Resolve(r.Context(), model)
+	if err != nil {
+		s.resolveError(w, r, err)
+		return
+	}
+	setRoutedModel(w, req.Model, model)
+	if !s.allowJudge(w, r, model, n) || !s.allowPrompt(w, r, model, s.chatPromptTokens(model, chatMessages(req)), bestOfNRuns(n)) {
+		return
+	}
+	messages, fits := s.fitContext(w, model, chatMessages(req))
+	if !fits {
+		return
+	}
+	if n == 1 {
+		// Samples must not share one upstream turn.
+		adapter = s.maybeCoalesce(adapter)
+	}
+	adapter = s.filterOutput(adapter)
 
 	in := proxy.ChatRequest{
-		Model:    req.Model,
-		Messages: make([]proxy.Message, 0, len(req.Messages)),
-		Stream:   req.Stream != nil && *req.Stream,
+		Model:           backendModel,
+		Messages:        messages,
+		Stream:          req.Stream != nil && *req.Stream,
+		ReasoningEffort: stringValue(req.ReasoningEffort),
 	}
-	for _, m := range req.Messages {
-		in.Messages = append(in.Messages, proxy.Message{
-			Role:    m.Role,
-			Content: m.Content,
-		})
+	release, err := s.sched.Acquire(r.Context(), prio, nil)
+	if err != nil {
+		return
 	}
-	promptTokens := estimateMessagesTokens(in.Messages)
+	defer release()
+	in.Messages = s.compactMessages(r.Context(), router, in.Messages)
+	if format != nil {
+		in.Messages = append(in.Messages, proxy.Message{Role: "system", Content: format.instruction()})
+	}
+	promptTokens := estimateMessagesTokens(s.tokenizer(model), in.Messages)
 
-	resp, err := adapter.Chat(r.Context(), in)
+	chat := func(ctx context.Context) (proxy.ChatResponse, error) {
+		return adapter.Chat(ctx, in)
+	}
+	var resp proxy.ChatResponse
+	var bestOf *openapiv1.BestOfNResult
+	if n > 1 {
+		resp, bestOf, err = runBestOfN(r.Context(), s, router, model, n, prio, release, in.Messages, chat, func(resp proxy.ChatResponse) string { return resp.Text })
+	} else {
+		resp, err = chat(r.Context())
+	}
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "upstream_error", err.Error())
+		s.writeUpstreamError(w, r, err)
 		return
 	}
 
 	text := strings.TrimSpace(resp.Text)
-	ObserveTokenUsage(w, promptTokens, estimateTextTokens(text))
-	finish := "stop"
+	ObserveTokenUsage(w, promptTokens, estimateTextTokens(s.tokenizer(model), text))
+	ObserveOutput(w, text)
+	message := openapiv1.ChatCompletionMessage{
+		Role:    "assistant",
+		Content: text,
+	}
+	if format != nil {
+		var refusal string
+		if message.Content, refusal = format.enforce(text); refusal != "" {
+			message.Refusal = &refusal
+		}
+	}
 	writeJSON(w, http.StatusOK, openapiv1.ChatCompletionsResponse{
-		Id:     genID("chatcmpl"),
-		Object: openapiv1.ChatCompletion,
-		Model:  req.Model,
+		Id:                genID("chatcmpl"),
+		Object:            openapiv1.ChatCompletion,
+		Created:           int(time.Now().Unix()),
+		Model:             req.Model,
+		SystemFingerprint: systemFingerprint(model, backendModel),
+		ServiceTier:       serviceTier,
 		Choices: []openapiv1.ChatChoice{
 			{
-				Index: 0,
-				Message: openapiv1.ChatMessage{
-					Role:    "assistant",
-					Content: text,
-				},
-				FinishReason: &finish,
+				Index:        0,
+				Message:      message,
+				FinishReason: chatFinishReason(resp.Incomplete),
 			},
 		},
+		BestOfN: bestOf,
 	})
 }
 
+// serviceTier is the only tier there is: a subscription CLI has no other.
+const serviceTier = "default"
+
+// systemFingerprint stands for the backend configuration behind a chat
+// completion, as OpenAI's does: the same for every request model is routed
+// to backendModel, different once the routing changes.
+func systemFingerprint(model, backendModel string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + backendModel))
+	return "fp_" + hex.EncodeToString(sum[:5])
+}
+
+// chatFinishReason is "length" for an answer the backend cut short, by the
+// output limit or the agent's turn limit, and "stop" otherwise.
+func chatFinishReason(incomplete string) string {
+	if incomplete != "" {
+		return "length"
+	}
+	return "stop"
+}
+
 func (s *Server) CreateResponse(w http.ResponseWriter, r *http.Request) {
+	r = withConversation(r)
 	var req openapiv1.ResponsesRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON body")
@@ -120,35 +588,126 @@ func (s *Server) CreateResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	ObserveModel(w, req.Model)
+	ObserveTags(w, metadataTags(req.Metadata))
+	if !s.allowUser(w, r, req.User) || !allowModel(w, r, req.Model) {
+		return
+	}
+	var ok bool
+	if req.Model, ok = s.redirectModel(w, r, req.Model); !ok {
+		return
+	}
+	if input := responsesInput(req); !s.allowLoop(w, r, []any{req.Model, input}, repeatedFunctionCalls(input)) {
+		return
+	}
+	format, err := responsesOutputFormat(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	n, ok := s.allowBestOfN(w, req.BestOfN, req.Stream != nil && *req.Stream)
+	if !ok {
+		return
+	}
 	if req.Stream != nil && *req.Stream {
-		s.streamResponse(w, r, req)
+		s.streamResponse(w, r, req, format)
 		return
 	}
 
-	adapter, err := s.router.AdapterForModel(r.Context(), req.Model)
+	router, status, err := s.routerFor(r)
+	if err != nil {
+		s.profileError(w, status, err)
+		return
+	}
+	prio, err := s.priorityFor(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if !s.allowTraffic(w, prio) {
+		return
+	}
+	input := responsesInput(req)
+	model := router.RouteResponses(r.Context(), proxy.ResponsesRequest{Model: req.Model, Input: input, ReasoningEffort: responsesEffort(req)})
+	if model != req.Model && !allowModel(w, r, model) {
+		return
+	}
+	adapter, backendModel, err := router.Resolve(r.Context(), model)
+	if err != nil {
+		s.resolveError(w, r, err)
+		return
+	}
+	setRoutedModel(w, req.Model, model)
+	promptTokens := estimateInputTokens(s.tokenizer(model), input)
+	if !s.allowJudge(w, r, model, n) || !s.allowPrompt(w, r, model, promptTokens, bestOfNRuns(n)) || !s.allowContext(w, model, promptTokens) {
+		return
+	}
+	if n == 1 {
+		// Samples must not share one upstream turn.
+		adapter = s.maybeCoalesce(adapter)
+	}
+	adapter = s.filterOutput(adapter)
+	hook, err := s.webhookFor(r)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
 		return
 	}
 
-	var input any
-	if req.Input != nil {
-		if raw, marshalErr := req.Input.MarshalJSON(); marshalErr == nil {
-			_ = json.Unmarshal(raw, &input)
+	respID := genID("resp")
+	createdAt := time.Now().Unix()
+	ctx, done := s.inflight.track(r, respID, req.Model)
+	defer done()
+	r = r.WithContext(ctx)
+	release, err := s.sched.Acquire(r.Context(), prio, nil)
+	if err != nil {
+		if context.Cause(ctx) == errResponseCancelled {
+			cancelled := cancelledResponse(respID, req.Model, createdAt)
+			s.notifyWebhook(hook, "response.cancelled", cancelled)
+			writeJSON(w, http.StatusOK, cancelled)
 		}
+		return
+	}
+	defer release()
+	upstreamInput := format.responsesInput(input)
+	in := proxy.ResponsesRequest{
+		Model:           backendModel,
+		Input:           upstreamInput,
+		Stream:          req.Stream != nil && *req.Stream,
+		ReasoningEffort: responsesEffort(req),
+	}
+	respond := func(ctx context.Context) (proxy.ResponsesResponse, error) {
+		return adapter.Respond(ctx, in)
+	}
+	var resp proxy.ResponsesResponse
+	var bestOf *openapiv1.BestOfNResult
+	if n > 1 {
+		// Samples replay the transcript: they cannot all continue one
+		// session.
+		resp, bestOf, err = runBestOfN(r.Context(), s, router, model, n, prio, release, upstreamInput, respond, func(resp proxy.ResponsesResponse) string { return resp.Text })
+	} else {
+		in.Continue = s.continuation(r, model, upstreamInput)
+		resp, err = respond(r.Context())
 	}
-	promptTokens := estimateInputTokens(input)
-
-	resp, err := adapter.Respond(r.Context(), proxy.ResponsesRequest{
-		Model:  req.Model,
-		Input:  input,
-		Stream: req.Stream != nil && *req.Stream,
-	})
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "upstream_error", err.Error())
+		if context.Cause(ctx) == errResponseCancelled {
+			cancelled := cancelledResponse(respID, req.Model, createdAt)
+			s.notifyWebhook(hook, "response.cancelled", cancelled)
+			writeJSON(w, http.StatusOK, cancelled)
+			return
+		}
+		status, upstream := s.upstreamError(w, r, err)
+		s.notifyWebhook(hook, "response.failed", failedResponse(respID, req.Model, createdAt, upstream))
+		writeJSON(w, status, map[string]any{"error": upstream})
 		return
 	}
-	ObserveTokenUsage(w, promptTokens, estimateTextTokens(resp.Text)+estimateTextTokens(resp.Reasoning))
+	inputTokens, outputTokens, usage := responsesUsage(resp.Usage, promptTokens, estimateTextTokens(s.tokenizer(model), resp.Text), estimateTextTokens(s.tokenizer(model), resp.Reasoning))
+	ObserveTokenUsage(w, inputTokens, outputTokens)
+	ObserveOutput(w, resp.Text)
+	responseStatus := "completed"
+	var incomplete map[string]any
+	if resp.Incomplete != "" {
+		responseStatus = "incomplete"
+		incomplete = map[string]any{"reason": resp.Incomplete}
+	}
 
 	output := make([]map[string]any, 0, 2)
 	if strings.TrimSpace(resp.Reasoning) != "" {
@@ -165,29 +724,57 @@ func (s *Server) CreateResponse(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 	output = append(output, map[string]any{
-		"id":     genID("msg"),
-		"type":   "message",
-		"role":   "assistant",
-		"status": "completed",
-		"content": []map[string]any{
-			{
-				"type": "output_text",
-				"text": resp.Text,
-			},
-		},
-	})
-	writeJSON(w, http.StatusOK, map[string]any{
-		"id":         genID("resp"),
-		"object":     "response",
-		"created_at": time.Now().Unix(),
-		"model":      req.Model,
-		"status":     "completed",
-		"output":     output,
+		"id":      genID("msg"),
+		"type":    "message",
+		"role":    "assistant",
+		"status":  responseStatus,
+		"content": format.messageContent(resp.Text),
 	})
+	body := responseObject(respID, req.Model, createdAt, responseStatus, output)
+	body["usage"] = usage
+	body["incomplete_details"] = incomplete
+	if bestOf != nil {
+		body["best_of_n"] = bestOf
+	}
+	s.rememberSession(r, model, body, resp.ThreadID)
+	s.saveResponse(r, body, resp.ThreadID)
+	s.notifyWebhook(hook, "response."+responseStatus, body)
+	writeJSON(w, http.StatusOK, body)
 }
 
-func (s *Server) streamChatCompletion(w http.ResponseWriter, r *http.Request, req openapiv1.ChatCompletionsRequest) {
-	adapter, err := s.router.AdapterForModel(r.Context(), req.Model)
+func (s *Server) streamChatCompletion(w http.ResponseWriter, r *http.Request, req openapiv1.ChatCompletionsRequest, format *outputFormat) {
+	router, status, err := s.routerFor(r)
+	if err != nil {
+		s.profileError(w, status, err)
+		return
+	}
+	prio, err := s.priorityFor(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if !s.allowTraffic(w, prio) {
+		return
+	}
+	model := router.RouteChat(r.Context(), proxy.ChatRequest{Model: req.Model, Messages: chatMessages(req), ReasoningEffort: stringValue(req.ReasoningEffort)})
+	if model != req.Model && !allowModel(w, r, model) {
+		return
+	}
+	adapter, backendModel, err := router.Resolve(r.Context(), model)
+	if err != nil {
+		s.resolveError(w, r, err)
+		return
+	}
+	setRoutedModel(w, req.Model, model)
+	if !s.allowPrompt(w, r, model, s.chatPromptTokens(model, chatMessages(req)), 1) {
+		return
+	}
+	messages, fits := s.fitContext(w, model, chatMessages(req))
+	if !fits {
+		return
+	}
+	adapter = s.filterOutput(s.maybeCoalesce(adapter))
+	coalesceInterval, coalesceBytes, err := coalesceSettings(req.StreamCoalesce)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
 		return
@@ -199,85 +786,176 @@ func (s *Server) streamChatCompletion(w http.ResponseWriter, r *http.Request, re
 		return
 	}
 
-	ctx, cancel := context.WithCancel(r.Context())
+	compat := s.streamCompatFor(r)
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if compat.doneWithin > 0 {
+		// The budget counts from the request, time queued included, as the
+		// client's does: the stream ends cut short rather than run past it.
+		ctx, cancel = context.WithTimeoutCause(r.Context(), compat.doneWithin, errStreamTooLong)
+	} else {
+		ctx, cancel = context.WithCancel(r.Context())
+	}
 	defer cancel()
+	ObserveStreaming(w)
 
 	reqID := genID("chatcmpl")
-	_ = sse.writeJSON(map[string]any{
-		"id":     reqID,
-		"object": "chat.completion.chunk",
-		"model":  req.Model,
-		"choices": []map[string]any{
-			{
-				"index": 0,
-				"delta": map[string]any{"role": "assistant"},
+	created := time.Now().Unix()
+	fingerprint := systemFingerprint(model, backendModel)
+	// chunk is a chat.completion.chunk; finishReason is nil until the last.
+	chunk := func(delta map[string]any, finishReason any) map[string]any {
+		return map[string]any{
+			"id":                 reqID,
+			"object":             "chat.completion.chunk",
+			"created":            created,
+			"model":              req.Model,
+			"system_fingerprint": fingerprint,
+			"service_tier":       serviceTier,
+			"choices": []map[string]any{
+				{
+					"index":         0,
+					"delta":         delta,
+					"finish_reason": finishReason,
+				},
 			},
-		},
-	})
+		}
+	}
+	first := map[string]any{"role": "assistant"}
+	if compat.firstChunkContent {
+		first["content"] = ""
+	}
+	_ = sse.writeJSON(chunk(first, nil))
 
 	in := proxy.ChatRequest{
-		Model:    req.Model,
-		Messages: make([]proxy.Message, 0, len(req.Messages)),
-		Stream:   true,
+		Model:           backendModel,
+		Messages:        messages,
+		Stream:          true,
+		ReasoningEffort: stringValue(req.ReasoningEffort),
 	}
-	for _, m := range req.Messages {
-		in.Messages = append(in.Messages, proxy.Message{Role: m.Role, Content: m.Content})
+	stopKeepAlive := sse.keepAlive(sseKeepAliveInterval, "waiting for backend")
+	defer stopKeepAlive()
+	release, err := s.sched.Acquire(ctx, prio, func(position int) {
+		_ = sse.writeComment(fmt.Sprintf("waiting for backend (position %d)", position))
+	})
+	if err != nil {
+		if streamTooLong(ctx) {
+			// Still queued when done_within ran out.
+			_ = sse.writeJSON(chunk(map[string]any{}, chatFinishReason(incompleteMaxDuration)))
+			_ = sse.writeDone()
+		}
+		return
 	}
-	promptTokens := estimateMessagesTokens(in.Messages)
+	defer release()
+	ctx, stopLimit := s.limitStream(ctx)
+	defer stopLimit()
+	in.Messages = s.compactMessages(ctx, router, in.Messages)
+	if format != nil {
+		in.Messages = append(in.Messages, proxy.Message{Role: "system", Content: format.instruction()})
+	}
+	promptTokens := estimateMessagesTokens(s.tokenizer(model), in.Messages)
 	var out strings.Builder
 
-	_, err = adapter.ChatStream(ctx, in, func(delta string) error {
+	emit, flush := coalesceEvents(coalesceInterval, coalesceBytes, func(ev proxy.ResponseEvent) error {
+		delta := ev.Delta
 		if delta == "" {
 			return nil
 		}
+		ObserveFirstToken(w)
 		out.WriteString(delta)
-		if writeErr := sse.writeJSON(map[string]any{
-			"id":     reqID,
-			"object": "chat.completion.chunk",
-			"model":  req.Model,
-			"choices": []map[string]any{
-				{
-					"index": 0,
-					"delta": map[string]any{"content": delta},
-				},
-			},
-		}); writeErr != nil {
+		if format != nil {
+			// Structured output is checked whole before it is sent.
+			return nil
+		}
+		if writeErr := sse.writeJSON(chunk(map[string]any{"content": delta}, nil)); writeErr != nil {
 			cancel()
 			return writeErr
 		}
 		return nil
 	})
+	resp, err := adapter.ChatStream(ctx, in, func(delta string) error {
+		return emit(proxy.ResponseEvent{Kind: proxy.ResponseEventOutput, Delta: delta})
+	})
+	if flushErr := flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil && streamTooLong(ctx) {
+		err = nil
+		resp.Incomplete = incompleteMaxDuration
+	}
+	finishReason := chatFinishReason(resp.Incomplete)
 	if err != nil {
-		_ = sse.writeJSON(map[string]any{
-			"id":     reqID,
-			"object": "error",
-			"error": map[string]any{
-				"type":    "upstream_error",
-				"message": err.Error(),
-			},
-		})
-		_ = sse.writeDone()
-		return
+		if r.Context().Err() == nil {
+			ObserveStreamOutcome(w, StreamUpstreamFailed)
+		}
+		_, upstream := s.upstreamError(w, r, err)
+		if !s.partialOnFailure.Load() || out.Len() == 0 || format != nil {
+			_ = sse.writeJSON(map[string]any{
+				"id":     reqID,
+				"object": "error",
+				"error":  upstream,
+			})
+			_ = sse.writeDone()
+			return
+		}
+		// Keep what was streamed: the chunk format has no room for the error,
+		// so it goes in a comment, which clients skip.
+		finishReason = "error"
+		_ = sse.writeComment(fmt.Sprintf("upstream failed: %v", upstream["message"]))
+	}
+	ObserveTokenUsage(w, promptTokens, estimateTextTokens(s.tokenizer(model), out.String()))
+	ObserveOutput(w, out.String())
+	if format != nil {
+		delta := map[string]any{}
+		if content, refusal := format.enforce(out.String()); refusal != "" {
+			delta["refusal"] = refusal
+		} else {
+			delta["content"] = content
+		}
+		_ = sse.writeJSON(chunk(delta, nil))
 	}
-	ObserveTokenUsage(w, promptTokens, estimateTextTokens(out.String()))
 
-	_ = sse.writeJSON(map[string]any{
-		"id":     reqID,
-		"object": "chat.completion.chunk",
-		"model":  req.Model,
-		"choices": []map[string]any{
-			{
-				"index":         0,
-				"delta":         map[string]any{},
-				"finish_reason": "stop",
-			},
-		},
-	})
+	_ = sse.writeJSON(chunk(map[string]any{}, finishReason))
 	_ = sse.writeDone()
 }
 
-func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req openapiv1.ResponsesRequest) {
-	adapter, err := s.router.AdapterForModel(r.Context(), req.Model)
+func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req openapiv1.ResponsesRequest, format *outputFormat) {
+	router, status, err := s.routerFor(r)
+	if err != nil {
+		s.profileError(w, status, err)
+		return
+	}
+	prio, err := s.priorityFor(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if !s.allowTraffic(w, prio) {
+		return
+	}
+	input := responsesInput(req)
+	model := router.RouteResponses(r.Context(), proxy.ResponsesRequest{Model: req.Model, Input: input, ReasoningEffort: responsesEffort(req)})
+	if model != req.Model && !allowModel(w, r, model) {
+		return
+	}
+	adapter, backendModel, err := router.Resolve(r.Context(), model)
+	if err != nil {
+		s.resolveError(w, r, err)
+		return
+	}
+	setRoutedModel(w, req.Model, model)
+	promptTokens := estimateInputTokens(s.tokenizer(model), input)
+	if !s.allowPrompt(w, r, model, promptTokens, 1) || !s.allowContext(w, model, promptTokens) {
+		return
+	}
+	adapter = s.filterOutput(s.maybeCoalesce(adapter))
+	coalesceInterval, coalesceBytes, err := coalesceSettings(req.StreamCoalesce)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	hook, err := s.webhookFor(r)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
 		return
@@ -288,30 +966,26 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
 		return
 	}
-	ctx, cancel := context.WithCancel(r.Context())
-	defer cancel()
-
 	respID := genID("resp")
 	createdAt := time.Now().Unix()
-	_ = sse.writeJSON(map[string]any{
-		"type": "response.created",
-		"response": map[string]any{
-			"id":         respID,
-			"object":     "response",
-			"created_at": createdAt,
-			"model":      req.Model,
-			"status":     "in_progress",
-			"output":     []any{},
-		},
-	})
+	// The turn is detached from the client's connection: if it drops, the
+	// client can resume the stream for a while before the turn is cancelled.
+	tracked, done := s.inflight.track(r.WithContext(context.WithoutCancel(r.Context())), respID, req.Model)
+	defer done()
+	ctx, cancel := context.WithCancel(tracked)
+	defer cancel()
+	ObserveStreaming(w)
 
-	var input any
-	if req.Input != nil {
-		if raw, marshalErr := req.Input.MarshalJSON(); marshalErr == nil {
-			_ = json.Unmarshal(raw, &input)
-		}
-	}
-	promptTokens := estimateInputTokens(input)
+	events := s.streams.start(respID, keyName(r), cancel)
+	defer events.writeDone()
+	events.attach(sse, -1)
+	stopFollow := context.AfterFunc(r.Context(), func() { events.detach(sse) })
+	defer stopFollow()
+
+	_ = events.writeJSON(map[string]any{
+		"type":     "response.created",
+		"response": responseObject(respID, req.Model, createdAt, "in_progress", []any{}),
+	})
 
 	seq := int64(1)
 	nextSeq := func() int64 {
@@ -320,6 +994,30 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 		return s
 	}
 
+	stopKeepAlive := sse.keepAlive(sseKeepAliveInterval, "waiting for backend")
+	defer stopKeepAlive()
+	release, err := s.sched.Acquire(ctx, prio, func(position int) {
+		_ = sse.writeComment(fmt.Sprintf("waiting for backend (position %d)", position))
+		queued := responseObject(respID, req.Model, createdAt, "in_progress", []any{})
+		queued["metadata"] = map[string]any{"queue_position": fmt.Sprint(position)}
+		_ = events.writeJSON(map[string]any{
+			"type":            "response.in_progress",
+			"sequence_number": nextSeq(),
+			"response":        queued,
+		})
+	})
+	if err != nil {
+		if context.Cause(ctx) == errResponseCancelled {
+			ObserveStreamOutcome(w, StreamCancelled)
+			s.notifyWebhook(hook, "response.cancelled", cancelledResponse(respID, req.Model, createdAt))
+			writeStreamCancelled(events)
+		}
+		return
+	}
+	defer release()
+	ctx, stopLimit := s.limitStream(ctx)
+	defer stopLimit()
+
 	reasoningItemID := genID("rsn")
 	messageItemID := genID("msg")
 	reasoningIndex := int64(-1)
@@ -342,7 +1040,7 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 		}
 		reasoningStarted = true
 		reasoningIndex = assignOutputIndex()
-		if err := sse.writeJSON(map[string]any{
+		if err := events.writeJSON(map[string]any{
 			"type":            "response.output_item.added",
 			"sequence_number": nextSeq(),
 			"output_index":    reasoningIndex,
@@ -357,7 +1055,7 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 		}
 		if !reasoningSummaryAdded {
 			reasoningSummaryAdded = true
-			return sse.writeJSON(map[string]any{
+			return events.writeJSON(map[string]any{
 				"type":            "response.reasoning_summary_part.added",
 				"sequence_number": nextSeq(),
 				"item_id":         reasoningItemID,
@@ -378,7 +1076,7 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 		}
 		messageStarted = true
 		messageIndex = assignOutputIndex()
-		return sse.writeJSON(map[string]any{
+		return events.writeJSON(map[string]any{
 			"type":            "response.output_item.added",
 			"sequence_number": nextSeq(),
 			"output_index":    messageIndex,
@@ -398,11 +1096,12 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 		if delta == "" {
 			return nil
 		}
+		ObserveFirstToken(w)
 		if err := startReasoning(); err != nil {
 			return err
 		}
 		reasoningText.WriteString(delta)
-		if err := sse.writeJSON(map[string]any{
+		if err := events.writeJSON(map[string]any{
 			"type":            "response.reasoning_summary_text.delta",
 			"sequence_number": nextSeq(),
 			"item_id":         reasoningItemID,
@@ -412,7 +1111,7 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 		}); err != nil {
 			return err
 		}
-		return sse.writeJSON(map[string]any{
+		return events.writeJSON(map[string]any{
 			"type":            "response.reasoning_text.delta",
 			"sequence_number": nextSeq(),
 			"item_id":         reasoningItemID,
@@ -426,11 +1125,16 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 		if delta == "" {
 			return nil
 		}
+		ObserveFirstToken(w)
 		if err := startMessage(); err != nil {
 			return err
 		}
 		outputText.WriteString(delta)
-		return sse.writeJSON(map[string]any{
+		if format != nil {
+			// Structured output is checked whole before it is sent.
+			return nil
+		}
+		return events.writeJSON(map[string]any{
 			"type":            "response.output_text.delta",
 			"sequence_number": nextSeq(),
 			"item_id":         messageItemID,
@@ -441,57 +1145,137 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 		})
 	}
 
-	if eventAdapter, ok := adapter.(proxy.ResponsesEventAdapter); ok {
-		_, err = eventAdapter.RespondStreamEvents(ctx, proxy.ResponsesRequest{
-			Model:  req.Model,
-			Input:  input,
-			Stream: true,
-		}, func(ev proxy.ResponseEvent) error {
-			if ev.Kind == proxy.ResponseEventReasoning {
-				if writeErr := emitReasoningDelta(ev.Delta); writeErr != nil {
-					cancel()
-					return writeErr
-				}
-				return nil
-			}
-			if writeErr := emitOutputDelta(ev.Delta); writeErr != nil {
-				cancel()
-				return writeErr
-			}
+	// Tool calls the CLI ran itself are surfaced as completed function_call
+	// items so clients can show the agent's activity.
+	toolItems := map[int64]map[string]any{}
+	emitToolCall := func(tool *proxy.ToolCall) error {
+		if tool == nil || tool.Name == "" {
 			return nil
+		}
+		index := assignOutputIndex()
+		callID := tool.ID
+		if callID == "" {
+			callID = genID("call")
+		}
+		item := map[string]any{
+			"id":        genID("fc"),
+			"type":      "function_call",
+			"status":    "completed",
+			"call_id":   callID,
+			"name":      tool.Name,
+			"arguments": tool.Arguments,
+		}
+		toolItems[index] = item
+		if err := events.writeJSON(map[string]any{
+			"type":            "response.output_item.added",
+			"sequence_number": nextSeq(),
+			"output_index":    index,
+			"item":            item,
+		}); err != nil {
+			return err
+		}
+		if err := events.writeJSON(map[string]any{
+			"type":            "response.function_call_arguments.done",
+			"sequence_number": nextSeq(),
+			"item_id":         item["id"],
+			"output_index":    index,
+			"arguments":       tool.Arguments,
+		}); err != nil {
+			return err
+		}
+		return events.writeJSON(map[string]any{
+			"type":            "response.output_item.done",
+			"sequence_number": nextSeq(),
+			"output_index":    index,
+			"item":            item,
 		})
+	}
+
+	emit, flush := coalesceEvents(coalesceInterval, coalesceBytes, func(ev proxy.ResponseEvent) error {
+		var writeErr error
+		switch ev.Kind {
+		case proxy.ResponseEventToolCall:
+			writeErr = emitToolCall(ev.Tool)
+		case proxy.ResponseEventReasoning:
+			writeErr = emitReasoningDelta(ev.Delta)
+		default:
+			writeErr = emitOutputDelta(ev.Delta)
+		}
+		if writeErr != nil {
+			cancel()
+		}
+		return writeErr
+	})
+	var resp proxy.ResponsesResponse
+	upstreamInput := format.responsesInput(input)
+	continuation := s.continuation(r, model, upstreamInput)
+	// responseStatus is the response's, and its reasoning and message
+	// items', when it ends.
+	responseStatus := "completed"
+	var failure map[string]any
+	if eventAdapter, ok := adapter.(proxy.ResponsesEventAdapter); ok {
+		resp, err = eventAdapter.RespondStreamEvents(ctx, proxy.ResponsesRequest{
+			Model:           backendModel,
+			Input:           upstreamInput,
+			Stream:          true,
+			ReasoningEffort: responsesEffort(req),
+			Continue:        continuation,
+		}, emit)
 	} else {
-		_, err = adapter.RespondStream(ctx, proxy.ResponsesRequest{
-			Model:  req.Model,
-			Input:  input,
-			Stream: true,
+		resp, err = adapter.RespondStream(ctx, proxy.ResponsesRequest{
+			Model:           backendModel,
+			Input:           upstreamInput,
+			Stream:          true,
+			ReasoningEffort: responsesEffort(req),
+			Continue:        continuation,
 		}, func(delta string) error {
-			if writeErr := emitOutputDelta(delta); writeErr != nil {
-				cancel()
-				return writeErr
-			}
-			return nil
+			return emit(proxy.ResponseEvent{Kind: proxy.ResponseEventOutput, Delta: delta})
 		})
 	}
+	if flushErr := flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil && streamTooLong(ctx) {
+		err = nil
+		resp.Incomplete = incompleteMaxDuration
+	}
 	if err != nil {
-		_ = sse.writeJSON(map[string]any{
-			"type": "error",
-			"error": map[string]any{
-				"type":    "upstream_error",
-				"message": err.Error(),
-			},
-		})
-		_ = sse.writeDone()
-		return
+		if context.Cause(ctx) == errResponseCancelled {
+			ObserveStreamOutcome(w, StreamCancelled)
+			s.notifyWebhook(hook, "response.cancelled", cancelledResponse(respID, req.Model, createdAt))
+			writeStreamCancelled(events)
+			return
+		}
+		if r.Context().Err() == nil {
+			ObserveStreamOutcome(w, StreamUpstreamFailed)
+		}
+		_, upstream := s.upstreamError(w, r, err)
+		if !s.partialOnFailure.Load() || nextOutputIndex == 0 || format != nil {
+			s.notifyWebhook(hook, "response.failed", failedResponse(respID, req.Model, createdAt, upstream))
+			_ = events.writeJSON(map[string]any{
+				"type":  "error",
+				"error": upstream,
+			})
+			_ = events.writeDone()
+			return
+		}
+		// Keep what was streamed and end the response as incomplete.
+		responseStatus = "incomplete"
+		failure = upstream
+	}
+	if failure == nil && resp.Incomplete != "" {
+		responseStatus = "incomplete"
 	}
-	ObserveTokenUsage(w, promptTokens, estimateTextTokens(outputText.String())+estimateTextTokens(reasoningText.String()))
+	inputTokens, outputTokens, usage := responsesUsage(resp.Usage, promptTokens, estimateTextTokens(s.tokenizer(model), outputText.String()), estimateTextTokens(s.tokenizer(model), reasoningText.String()))
+	ObserveTokenUsage(w, inputTokens, outputTokens)
+	ObserveOutput(w, outputText.String())
 
 	if !messageStarted {
 		_ = startMessage()
 	}
 	if reasoningStarted {
 		reasoningFull := reasoningText.String()
-		_ = sse.writeJSON(map[string]any{
+		_ = events.writeJSON(map[string]any{
 			"type":            "response.reasoning_summary_text.done",
 			"sequence_number": nextSeq(),
 			"item_id":         reasoningItemID,
@@ -499,7 +1283,7 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 			"summary_index":   0,
 			"text":            reasoningFull,
 		})
-		_ = sse.writeJSON(map[string]any{
+		_ = events.writeJSON(map[string]any{
 			"type":            "response.reasoning_summary_part.done",
 			"sequence_number": nextSeq(),
 			"item_id":         reasoningItemID,
@@ -510,7 +1294,7 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 				"text": reasoningFull,
 			},
 		})
-		_ = sse.writeJSON(map[string]any{
+		_ = events.writeJSON(map[string]any{
 			"type":            "response.reasoning_text.done",
 			"sequence_number": nextSeq(),
 			"item_id":         reasoningItemID,
@@ -518,14 +1302,14 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 			"content_index":   0,
 			"text":            reasoningFull,
 		})
-		_ = sse.writeJSON(map[string]any{
+		_ = events.writeJSON(map[string]any{
 			"type":            "response.output_item.done",
 			"sequence_number": nextSeq(),
 			"output_index":    reasoningIndex,
 			"item": map[string]any{
 				"id":     reasoningItemID,
 				"type":   "reasoning",
-				"status": "completed",
+				"status": responseStatus,
 				"summary": []map[string]any{
 					{"type": "summary_text", "text": reasoningFull},
 				},
@@ -534,65 +1318,201 @@ func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, req open
 	}
 
 	outputFull := outputText.String()
-	_ = sse.writeJSON(map[string]any{
-		"type":            "response.output_text.done",
-		"sequence_number": nextSeq(),
-		"item_id":         messageItemID,
-		"output_index":    messageIndex,
-		"content_index":   0,
-		"text":            outputFull,
-		"logprobs":        []any{},
-	})
-	_ = sse.writeJSON(map[string]any{
+	content := format.messageContent(outputFull)
+	if refusal, ok := content[0]["refusal"].(string); ok {
+		_ = events.writeJSON(map[string]any{
+			"type":            "response.refusal.delta",
+			"sequence_number": nextSeq(),
+			"item_id":         messageItemID,
+			"output_index":    messageIndex,
+			"content_index":   0,
+			"delta":           refusal,
+		})
+		_ = events.writeJSON(map[string]any{
+			"type":            "response.refusal.done",
+			"sequence_number": nextSeq(),
+			"item_id":         messageItemID,
+			"output_index":    messageIndex,
+			"content_index":   0,
+			"refusal":         refusal,
+		})
+	} else {
+		if format != nil {
+			outputFull, _ = content[0]["text"].(string)
+			_ = events.writeJSON(map[string]any{
+				"type":            "response.output_text.delta",
+				"sequence_number": nextSeq(),
+				"item_id":         messageItemID,
+				"output_index":    messageIndex,
+				"content_index":   0,
+				"delta":           outputFull,
+				"logprobs":        []any{},
+			})
+		}
+		_ = events.writeJSON(map[string]any{
+			"type":            "response.output_text.done",
+			"sequence_number": nextSeq(),
+			"item_id":         messageItemID,
+			"output_index":    messageIndex,
+			"content_index":   0,
+			"text":            outputFull,
+			"logprobs":        []any{},
+		})
+	}
+	_ = events.writeJSON(map[string]any{
 		"type":            "response.output_item.done",
 		"sequence_number": nextSeq(),
 		"output_index":    messageIndex,
 		"item": map[string]any{
-			"id":     messageItemID,
-			"type":   "message",
-			"role":   "assistant",
-			"status": "completed",
-			"content": []map[string]any{
-				{"type": "output_text", "text": outputFull},
-			},
+			"id":      messageItemID,
+			"type":    "message",
+			"role":    "assistant",
+			"status":  responseStatus,
+			"content": content,
 		},
 	})
 
-	outputItems := make([]any, 0, 2)
-	if reasoningStarted {
-		outputItems = append(outputItems, map[string]any{
-			"id":     reasoningItemID,
-			"type":   "reasoning",
-			"status": "completed",
-			"summary": []map[string]any{
-				{"type": "summary_text", "text": reasoningText.String()},
-			},
-		})
+	outputItems := make([]any, 0, nextOutputIndex)
+	for index := int64(0); index < nextOutputIndex; index++ {
+		switch {
+		case index == reasoningIndex:
+			outputItems = append(outputItems, map[string]any{
+				"id":     reasoningItemID,
+				"type":   "reasoning",
+				"status": responseStatus,
+				"summary": []map[string]any{
+					{"type": "summary_text", "text": reasoningText.String()},
+				},
+			})
+		case index == messageIndex:
+			outputItems = append(outputItems, map[string]any{
+				"id":      messageItemID,
+				"type":    "message",
+				"role":    "assistant",
+				"status":  responseStatus,
+				"content": content,
+			})
+		default:
+			if item, ok := toolItems[index]; ok {
+				outputItems = append(outputItems, item)
+			}
+		}
 	}
-	outputItems = append(outputItems, map[string]any{
-		"id":     messageItemID,
-		"type":   "message",
-		"role":   "assistant",
-		"status": "completed",
-		"content": []map[string]any{
-			{"type": "output_text", "text": outputFull},
-		},
-	})
-	_ = sse.writeJSON(map[string]any{
-		"type": "response.completed",
-		"response": map[string]any{
-			"id":         respID,
-			"object":     "response",
-			"created_at": createdAt,
-			"model":      req.Model,
-			"status":     "completed",
-			"output":     outputItems,
-		},
+	completed := responseObject(respID, req.Model, createdAt, responseStatus, outputItems)
+	completed["usage"] = usage
+	if failure != nil {
+		completed["error"] = failure
+		completed["incomplete_details"] = map[string]any{"reason": "upstream_error"}
+	} else if resp.Incomplete != "" {
+		completed["incomplete_details"] = map[string]any{"reason": resp.Incomplete}
+	}
+	s.rememberSession(r, model, completed, resp.ThreadID)
+	s.saveResponse(r, completed, resp.ThreadID)
+	s.notifyWebhook(hook, "response."+responseStatus, completed)
+	_ = events.writeJSON(map[string]any{
+		"type":     "response." + responseStatus,
+		"response": completed,
 	})
-	_ = sse.writeDone()
+	_ = events.writeDone()
+}
+
+// responseObject is a /v1/responses response object with the fields that
+// SDKs require. The proxy takes no sampling or tool parameters, so those are
+// reported as their defaults.
+func responseObject(id, model string, createdAt int64, status string, output any) map[string]any {
+	return map[string]any{
+		"id":                  id,
+		"object":              "response",
+		"created_at":          createdAt,
+		"model":               model,
+		"status":              status,
+		"output":              output,
+		"error":               nil,
+		"incomplete_details":  nil,
+		"instructions":        nil,
+		"metadata":            map[string]any{},
+		"parallel_tool_calls": true,
+		"temperature":         nil,
+		"top_p":               nil,
+		"tool_choice":         "auto",
+		"tools":               []any{},
+	}
+}
+
+// withConversation tags the request context with its ConversationHeader,
+// scoped to the API key so clients cannot share or hijack each other's pins.
+func withConversation(r *http.Request) *http.Request {
+	id := strings.TrimSpace(r.Header.Get(ConversationHeader))
+	if id == "" {
+		return r
+	}
+	if key := KeyFromContext(r.Context()); key != nil {
+		id = key.Name + "/" + id
+	}
+	return r.WithContext(proxy.WithConversation(r.Context(), id))
+}
+
+func chatMessages(req openapiv1.ChatCompletionsRequest) []proxy.Message {
+	out := make([]proxy.Message, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		out = append(out, proxy.Message{Role: m.Role, Content: m.Content})
+	}
+	return out
+}
+
+func responsesInput(req openapiv1.ResponsesRequest) any {
+	var input any
+	if req.Input != nil {
+		if raw, err := req.Input.MarshalJSON(); err == nil {
+			_ = json.Unmarshal(raw, &input)
+		}
+	}
+	return input
+}
+
+// allowModel writes a 403 and returns false when the request's API key may
+// not use model.
+func allowModel(w http.ResponseWriter, r *http.Request, model string) bool {
+	key := KeyFromContext(r.Context())
+	if key.AllowsModel(model) {
+		return true
+	}
+	writeModelNotAllowed(w, key, model)
+	return false
+}
+
+func writeModelNotAllowed(w http.ResponseWriter, key *APIKey, model string) {
+	writeJSON(w, http.StatusForbidden, map[string]any{"error": map[string]any{
+		"type":    "permission_error",
+		"code":    "model_not_allowed",
+		"message": fmt.Sprintf("API key %q may not use model %q", key.Name, model),
+	}})
+}
+
+// setRoutedModel reports the model the auto router picked, since responses
+// echo the requested model ID.
+func setRoutedModel(w http.ResponseWriter, requested, routed string) {
+	if routed != requested {
+		w.Header().Set(RoutedModelHeader, routed)
+	}
+}
+
+func stringValue(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return strings.TrimSpace(*p)
+}
+
+func responsesEffort(req openapiv1.ResponsesRequest) string {
+	if req.Reasoning == nil {
+		return ""
+	}
+	return stringValue(req.Reasoning.Effort)
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
+	defer ObserveSerialize(w, time.Now())
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(v)
@@ -607,9 +1527,15 @@ func writeError(w http.ResponseWriter, status int, code, message string) {
 	})
 }
 
+// sseKeepAliveInterval is how long a stream may sit idle before a comment is
+// sent, so clients and intermediaries know the backend is still starting.
+const sseKeepAliveInterval = 10 * time.Second
+
 type sseWriter struct {
-	w http.ResponseWriter
-	f http.Flusher
+	mu        sync.Mutex
+	w         http.ResponseWriter
+	f         http.Flusher
+	lastWrite time.Time
 }
 
 func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
@@ -620,65 +1546,119 @@ func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	return &sseWriter{w: w, f: f}, nil
+	return &sseWriter{w: w, f: f, lastWrite: time.Now()}, nil
+}
+
+func (s *sseWriter) write(format string, args ...any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, format, args...); err != nil {
+		return err
+	}
+	s.f.Flush()
+	s.lastWrite = time.Now()
+	return nil
 }
 
 func (s *sseWriter) writeJSON(v any) error {
+	defer ObserveSerialize(s.w, time.Now())
 	b, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
-	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", b); err != nil {
-		return err
-	}
-	s.f.Flush()
-	return nil
+	return s.write("data: %s\n\n", b)
+}
+
+// writeComment writes an SSE comment line, which clients ignore as data but
+// may show as progress.
+func (s *sseWriter) writeComment(text string) error {
+	return s.write(": %s\n\n", text)
 }
 
 func (s *sseWriter) writeDone() error {
-	if _, err := fmt.Fprint(s.w, "data: [DONE]\n\n"); err != nil {
-		return err
+	return s.write("data: [DONE]\n\n")
+}
+
+// keepAlive writes comment whenever the stream has been idle for interval.
+// The returned func stops it and must be called before the handler returns.
+func (s *sseWriter) keepAlive(interval time.Duration, comment string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.mu.Lock()
+				idle := time.Since(s.lastWrite)
+				s.mu.Unlock()
+				if idle >= interval {
+					_ = s.writeComment(comment)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
 	}
-	s.f.Flush()
-	return nil
 }
 
 func genID(prefix string) string {
 	return fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
 }
 
-func estimateMessagesTokens(messages []proxy.Message) uint64 {
+// responsesUsage returns a response's input and output token counts and its
+// usage object: what the backend reported or, when it reported nothing,
+// estimates.
+func responsesUsage(reported *proxy.Usage, promptTokens, outputTokens, reasoningTokens uint64) (uint64, uint64, map[string]any) {
+	input, cached, output := promptTokens, uint64(0), outputTokens+reasoningTokens
+	if reported != nil {
+		input, cached, output = uint64(reported.InputTokens), uint64(reported.CachedInputTokens), uint64(reported.OutputTokens)
+		reasoningTokens = min(reasoningTokens, output)
+	}
+	return input, output, map[string]any{
+		"input_tokens":          input,
+		"input_tokens_details":  map[string]any{"cached_tokens": cached},
+		"output_tokens":         output,
+		"output_tokens_details": map[string]any{"reasoning_tokens": reasoningTokens},
+		"total_tokens":          input + output,
+	}
+}
+
+func estimateMessagesTokens(tok tokenizer.Tokenizer, messages []proxy.Message) uint64 {
 	var total uint64
 	for _, msg := range messages {
-		total += estimateTextTokens(msg.Role)
-		total += estimateTextTokens(msg.Content)
+		total += estimateTextTokens(tok, msg.Role)
+		total += estimateTextTokens(tok, msg.Content)
 	}
 	return total
 }
 
-func estimateInputTokens(input any) uint64 {
+func estimateInputTokens(tok tokenizer.Tokenizer, input any) uint64 {
 	if input == nil {
 		return 0
 	}
 	if s, ok := input.(string); ok {
-		return estimateTextTokens(s)
+		return estimateTextTokens(tok, s)
 	}
 	b, err := json.Marshal(input)
 	if err != nil {
 		return 0
 	}
-	return estimateTextTokens(string(b))
+	return estimateTextTokens(tok, string(b))
 }
 
-func estimateTextTokens(text string) uint64 {
-	text = strings.TrimSpace(text)
-	if text == "" {
+func estimateTextTokens(tok tokenizer.Tokenizer, text string) uint64 {
+	if strings.TrimSpace(text) == "" {
 		return 0
 	}
-	runes := uint64(len([]rune(text)))
-	approx := (runes + 3) / 4
-	if approx == 0 {
-		return 1
-	}
-	return approx
+	return uint64(max(tok.Count(text), 1))
 }
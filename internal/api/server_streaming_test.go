@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"llm-proxy/internal/config"
 	"llm-proxy/internal/proxy"
 )
 
@@ -16,6 +19,12 @@ type streamingTestAdapter struct {
 	model  string
 	deltas []string
 	events []proxy.ResponseEvent
+	chats  []proxy.ChatRequest
+	// err fails streams after their deltas or events.
+	err error
+	// usage and incomplete are reported by Respond.
+	usage      *proxy.Usage
+	incomplete string
 }
 
 func (a *streamingTestAdapter) SupportsModel(_ context.Context, model string) (bool, error) {
@@ -26,8 +35,13 @@ func (a *streamingTestAdapter) ListModels(_ context.Context) ([]proxy.Model, err
 	return []proxy.Model{{ID: a.model, Backend: proxy.BackendClaude}}, nil
 }
 
+func (a *streamingTestAdapter) HealthCheck(context.Context) error {
+	return nil
+}
+
 func (a *streamingTestAdapter) Chat(_ context.Context, req proxy.ChatRequest) (proxy.ChatResponse, error) {
-	return proxy.ChatResponse{Model: req.Model, Text: strings.Join(a.deltas, "")}, nil
+	a.chats = append(a.chats, req)
+	return proxy.ChatResponse{Model: req.Model, Text: strings.Join(a.deltas, ""), Incomplete: a.incomplete}, nil
 }
 
 func (a *streamingTestAdapter) ChatStream(_ context.Context, req proxy.ChatRequest, onDelta func(string) error) (proxy.ChatResponse, error) {
@@ -36,11 +50,14 @@ func (a *streamingTestAdapter) ChatStream(_ context.Context, req proxy.ChatReque
 			return proxy.ChatResponse{}, err
 		}
 	}
-	return proxy.ChatResponse{Model: req.Model, Text: strings.Join(a.deltas, "")}, nil
+	if a.err != nil {
+		return proxy.ChatResponse{}, a.err
+	}
+	return proxy.ChatResponse{Model: req.Model, Text: strings.Join(a.deltas, ""), Incomplete: a.incomplete}, nil
 }
 
 func (a *streamingTestAdapter) Respond(_ context.Context, req proxy.ResponsesRequest) (proxy.ResponsesResponse, error) {
-	return proxy.ResponsesResponse{Model: req.Model, Text: "ok"}, nil
+	return proxy.ResponsesResponse{Model: req.Model, Text: "ok", Usage: a.usage, Incomplete: a.incomplete}, nil
 }
 
 func (a *streamingTestAdapter) RespondStream(_ context.Context, req proxy.ResponsesRequest, onDelta func(string) error) (proxy.ResponsesResponse, error) {
@@ -58,6 +75,9 @@ func (a *streamingTestAdapter) RespondStreamEvents(_ context.Context, req proxy.
 			return proxy.ResponsesResponse{}, err
 		}
 	}
+	if a.err != nil {
+		return proxy.ResponsesResponse{}, a.err
+	}
 	return proxy.ResponsesResponse{Model: req.Model, Text: "done"}, nil
 }
 
@@ -152,6 +172,205 @@ func TestStreamResponseKeepsMessageOutputIndexStable(t *testing.T) {
 	}
 }
 
+func TestStreamResponseSurfacesToolCalls(t *testing.T) {
+	adapter := &streamingTestAdapter{
+		model: "m1",
+		events: []proxy.ResponseEvent{
+			{Kind: proxy.ResponseEventOutput, Delta: "Checking."},
+			{Kind: proxy.ResponseEventToolCall, Tool: &proxy.ToolCall{ID: "toolu_1", Name: "Bash", Arguments: `{"command":"ls"}`}},
+			{Kind: proxy.ResponseEventOutput, Delta: " Done."},
+		},
+	}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+
+	body := []byte(`{"model":"m1","stream":true,"input":"hi"}`)
+	r := httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	s.CreateResponse(w, r)
+
+	var toolItem, completed map[string]any
+	for _, ev := range decodeSSEEvents(t, w.Body.String()) {
+		switch ev["type"] {
+		case "response.output_item.done":
+			if item, _ := ev["item"].(map[string]any); item["type"] == "function_call" {
+				toolItem = item
+				if ev["output_index"] != 1.0 {
+					t.Fatalf("tool call output_index = %v, want 1", ev["output_index"])
+				}
+			}
+		case "response.completed":
+			completed, _ = ev["response"].(map[string]any)
+		}
+	}
+	if toolItem == nil {
+		t.Fatalf("function_call item not found in stream:\n%s", w.Body.String())
+	}
+	if toolItem["call_id"] != "toolu_1" || toolItem["name"] != "Bash" || toolItem["arguments"] != `{"command":"ls"}` {
+		t.Fatalf("unexpected tool item: %#v", toolItem)
+	}
+	output, _ := completed["output"].([]any)
+	if len(output) != 2 {
+		t.Fatalf("expected message and tool call in completed output, got %#v", output)
+	}
+	if first, _ := output[0].(map[string]any); first["type"] != "message" {
+		t.Fatalf("expected message first, got %#v", output[0])
+	}
+	if second, _ := output[1].(map[string]any); second["type"] != "function_call" {
+		t.Fatalf("expected function_call second, got %#v", output[1])
+	}
+}
+
+func TestBackendPrefixForcesAdapter(t *testing.T) {
+	claude := &streamingTestAdapter{model: "shared", deltas: []string{"from claude"}}
+	codex := &streamingTestAdapter{model: "shared", deltas: []string{"from codex"}}
+	s := NewServer(proxy.NewRouter(claude, codex))
+
+	for model, want := range map[string]string{
+		"shared":        "from claude",
+		"claude/shared": "from claude",
+		"codex/shared":  "from codex",
+	} {
+		body := []byte(`{"model":"` + model + `","messages":[{"role":"user","content":"hi"}]}`)
+		w := httptest.NewRecorder()
+		s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", model, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Model != model || resp.Choices[0].Message.Content != want {
+			t.Fatalf("%s: got model %q content %q, want %q", model, resp.Model, resp.Choices[0].Message.Content, want)
+		}
+	}
+
+	body := []byte(`{"model":"codex/missing","messages":[{"role":"user","content":"hi"}]}`)
+	w := httptest.NewRecorder()
+	s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body)))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown prefixed model, got %d", w.Code)
+	}
+}
+
+func TestChatHistoryIsTrimmedAndSummarized(t *testing.T) {
+	adapter := &streamingTestAdapter{model: "m1", deltas: []string{"earlier stuff"}}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+	s.SetHistoryPolicy(proxy.HistoryPolicy{MaxMessages: 1, SummaryModel: "m1"})
+
+	body := []byte(`{"model":"m1","messages":[{"role":"system","content":"sys"},{"role":"user","content":"old"},{"role":"assistant","content":"older reply"},{"role":"user","content":"new"}]}`)
+	w := httptest.NewRecorder()
+	s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if len(adapter.chats) != 2 {
+		t.Fatalf("expected a summary call and the chat call, got %d calls", len(adapter.chats))
+	}
+	got := adapter.chats[1].Messages
+	if len(got) != 3 || got[0].Content != "sys" || got[1].Role != "system" || !strings.Contains(got[1].Content, "earlier stuff") || got[2].Content != "new" {
+		t.Fatalf("unexpected compacted messages: %#v", got)
+	}
+}
+
+func TestStreamsKeepPartialOutputOnFailure(t *testing.T) {
+	adapter := &streamingTestAdapter{
+		model:  "m1",
+		deltas: []string{"half an "},
+		events: []proxy.ResponseEvent{{Kind: proxy.ResponseEventOutput, Delta: "half an "}},
+		err:    errors.New("backend crashed"),
+	}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+
+	chat := func() []map[string]any {
+		body := []byte(`{"model":"m1","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+		w := httptest.NewRecorder()
+		s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body)))
+		return decodeSSEEvents(t, w.Body.String())
+	}
+	if events := chat(); events[len(events)-1]["object"] != "error" {
+		t.Fatalf("expected an error event by default, got %v", events[len(events)-1])
+	}
+
+	s.SetPartialOnFailure(true)
+	events := chat()
+	last := events[len(events)-1]
+	choice := last["choices"].([]any)[0].(map[string]any)
+	if choice["finish_reason"] != "error" {
+		t.Fatalf("expected finish_reason error, got %v", last)
+	}
+
+	body := []byte(`{"model":"m1","stream":true,"input":"hi"}`)
+	w := httptest.NewRecorder()
+	s.CreateResponse(w, httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader(body)))
+	events = decodeSSEEvents(t, w.Body.String())
+	last = events[len(events)-1]
+	resp, _ := last["response"].(map[string]any)
+	if last["type"] != "response.incomplete" || resp["status"] != "incomplete" || resp["error"] == nil {
+		t.Fatalf("expected an incomplete response, got %v", last)
+	}
+	output := resp["output"].([]any)
+	message := output[0].(map[string]any)
+	text := message["content"].([]any)[0].(map[string]any)["text"]
+	if message["status"] != "incomplete" || text != "half an " {
+		t.Fatalf("expected the partial message, got %v", message)
+	}
+}
+
+// stallingTestAdapter streams one delta, then runs until it is stopped.
+type stallingTestAdapter struct {
+	streamingTestAdapter
+}
+
+func (a *stallingTestAdapter) ChatStream(ctx context.Context, _ proxy.ChatRequest, onDelta func(string) error) (proxy.ChatResponse, error) {
+	if err := onDelta("still going"); err != nil {
+		return proxy.ChatResponse{}, err
+	}
+	<-ctx.Done()
+	return proxy.ChatResponse{}, ctx.Err()
+}
+
+func (a *stallingTestAdapter) RespondStreamEvents(ctx context.Context, _ proxy.ResponsesRequest, onEvent func(proxy.ResponseEvent) error) (proxy.ResponsesResponse, error) {
+	if err := onEvent(proxy.ResponseEvent{Kind: proxy.ResponseEventOutput, Delta: "still going"}); err != nil {
+		return proxy.ResponsesResponse{}, err
+	}
+	<-ctx.Done()
+	return proxy.ResponsesResponse{}, ctx.Err()
+}
+
+func TestStreamsEndIncompleteAfterMaxDuration(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&stallingTestAdapter{streamingTestAdapter{model: "m1"}}, &streamingTestAdapter{model: "m2"}))
+	s.SetMaxStreamDuration(50 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m1","stream":true,"messages":[{"role":"user","content":"hi"}]}`)))
+	events := decodeSSEEvents(t, w.Body.String())
+	last := events[len(events)-1]
+	if choice := last["choices"].([]any)[0].(map[string]any); choice["finish_reason"] != "length" || !strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n") {
+		t.Fatalf("expected the chat stream to end with finish_reason length, got %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	s.CreateResponse(w, httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(`{"model":"m1","stream":true,"input":"hi"}`)))
+	events = decodeSSEEvents(t, w.Body.String())
+	last = events[len(events)-1]
+	resp, _ := last["response"].(map[string]any)
+	details, _ := resp["incomplete_details"].(map[string]any)
+	message := resp["output"].([]any)[0].(map[string]any)
+	text := message["content"].([]any)[0].(map[string]any)["text"]
+	if last["type"] != "response.incomplete" || details["reason"] != "max_duration" || text != "still going" {
+		t.Fatalf("expected an incomplete response cut at max_duration, got %v", last)
+	}
+}
+
 func decodeSSEEvents(t *testing.T, body string) []map[string]any {
 	t.Helper()
 	lines := strings.Split(body, "\n")
@@ -172,3 +391,162 @@ func decodeSSEEvents(t *testing.T, body string) []map[string]any {
 	}
 	return events
 }
+
+func TestAutoModelRoutesByPrompt(t *testing.T) {
+	claude := &streamingTestAdapter{model: "haiku", deltas: []string{"quick answer"}}
+	codex := &streamingTestAdapter{model: "gpt-5", deltas: []string{"deep answer"}}
+	router := proxy.NewRouter(claude, codex)
+	router.SetAutoPolicy(&proxy.AutoPolicy{
+		Default: "haiku",
+		Rules:   []proxy.AutoRule{{Model: "gpt-5", Keywords: []string{"refactor"}}},
+	})
+	s := NewServer(router)
+
+	for prompt, want := range map[string]string{
+		"what time is it":          "haiku",
+		"please Refactor this mod": "gpt-5",
+	} {
+		body := []byte(`{"model":"auto","messages":[{"role":"user","content":"` + prompt + `"}]}`)
+		w := httptest.NewRecorder()
+		s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", prompt, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get(RoutedModelHeader); got != want {
+			t.Fatalf("%s: routed to %q, want %q", prompt, got, want)
+		}
+		if !strings.Contains(w.Body.String(), `"model":"auto"`) {
+			t.Fatalf("%s: expected response to echo auto, got %s", prompt, w.Body.String())
+		}
+	}
+}
+
+func TestResponseReportsUsageAndIncompleteDetails(t *testing.T) {
+	adapter := &streamingTestAdapter{model: "m1"}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+	respond := func() map[string]any {
+		w := httptest.NewRecorder()
+		s.CreateResponse(w, httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(`{"model":"m1","input":"hello there"}`)))
+		var body map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return body
+	}
+
+	body := respond()
+	usage, _ := body["usage"].(map[string]any)
+	if body["status"] != "completed" || usage["input_tokens"] != 3.0 || usage["output_tokens"] != 1.0 || usage["total_tokens"] != 4.0 {
+		t.Fatalf("estimated usage: %v", body)
+	}
+	if v, ok := body["incomplete_details"]; !ok || v != nil {
+		t.Fatalf("incomplete_details = %v, want null", v)
+	}
+	if v, ok := body["error"]; !ok || v != nil {
+		t.Fatalf("error = %v, want null", v)
+	}
+
+	adapter.usage = &proxy.Usage{InputTokens: 50, CachedInputTokens: 40, OutputTokens: 9}
+	adapter.incomplete = "max_output_tokens"
+	body = respond()
+	usage, _ = body["usage"].(map[string]any)
+	cached, _ := usage["input_tokens_details"].(map[string]any)
+	if usage["input_tokens"] != 50.0 || cached["cached_tokens"] != 40.0 || usage["output_tokens"] != 9.0 {
+		t.Fatalf("reported usage: %v", usage)
+	}
+	details, _ := body["incomplete_details"].(map[string]any)
+	if body["status"] != "incomplete" || details["reason"] != "max_output_tokens" {
+		t.Fatalf("truncated response: %v", body)
+	}
+}
+
+func TestChatCompletionTurnLimitFinishesWithLength(t *testing.T) {
+	adapter := &streamingTestAdapter{model: "m1", deltas: []string{"partial"}, incomplete: proxy.IncompleteMaxTurns}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+
+	w := httptest.NewRecorder()
+	s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m1","messages":[{"role":"user","content":"hi"}]}`)))
+	if !strings.Contains(w.Body.String(), `"finish_reason":"length"`) {
+		t.Fatalf("expected finish_reason length, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m1","stream":true,"messages":[{"role":"user","content":"hi"}]}`)))
+	var finish any
+	for _, ev := range decodeSSEEvents(t, w.Body.String()) {
+		if choices, ok := ev["choices"].([]any); ok && len(choices) > 0 {
+			if reason := choices[0].(map[string]any)["finish_reason"]; reason != nil {
+				finish = reason
+			}
+		}
+	}
+	if finish != "length" {
+		t.Fatalf("streamed finish_reason = %v, want length", finish)
+	}
+}
+
+func TestChatCompletionsCarryCreatedFingerprintAndTier(t *testing.T) {
+	adapter := &streamingTestAdapter{model: "m1", deltas: []string{"hi"}}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+
+	w := httptest.NewRecorder()
+	s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m1","messages":[{"role":"user","content":"hi"}]}`)))
+	var completion map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &completion); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	fingerprint, _ := completion["system_fingerprint"].(string)
+	if !strings.HasPrefix(fingerprint, "fp_") || completion["service_tier"] != "default" || completion["created"] == nil {
+		t.Fatalf("completion = %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m1","stream":true,"messages":[{"role":"user","content":"hi"}]}`)))
+	chunks := decodeSSEEvents(t, w.Body.String())
+	if len(chunks) < 3 {
+		t.Fatalf("expected role, content and finish chunks, got %s", w.Body.String())
+	}
+	for _, chunk := range chunks {
+		if chunk["system_fingerprint"] != fingerprint || chunk["service_tier"] != "default" || chunk["created"] == nil {
+			t.Fatalf("chunk %v, want fingerprint %s", chunk, fingerprint)
+		}
+	}
+
+	if systemFingerprint("m1", "m1") == systemFingerprint("m2", "m2") {
+		t.Fatal("different routes share a fingerprint")
+	}
+}
+
+func TestFirstChunkContentCompatFlag(t *testing.T) {
+	adapter := &streamingTestAdapter{model: "m1", deltas: []string{"hi"}}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+	firstDelta := func(key *APIKey) map[string]any {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m1","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+		if key != nil {
+			r = r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key))
+		}
+		w := httptest.NewRecorder()
+		s.CreateChatCompletion(w, r)
+		chunks := decodeSSEEvents(t, w.Body.String())
+		if len(chunks) == 0 {
+			t.Fatalf("no chunks in %s", w.Body.String())
+		}
+		return chunks[0]["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)
+	}
+
+	if delta := firstDelta(nil); delta["role"] != "assistant" || delta["content"] != nil {
+		t.Fatalf("default first delta = %v", delta)
+	}
+	s.SetStreamCompat([]string{config.CompatFirstChunkContent}, 0)
+	if delta := firstDelta(nil); delta["role"] != "assistant" || delta["content"] != "" {
+		t.Fatalf("first delta with first_chunk_content = %v", delta)
+	}
+	if delta := firstDelta(&APIKey{Name: "strict", StreamCompat: []string{}}); delta["content"] != nil {
+		t.Fatalf("a key with no flags still got %v", delta)
+	}
+	s.SetStreamCompat(nil, 0)
+	if delta := firstDelta(&APIKey{Name: "cursor", StreamCompat: []string{config.CompatFirstChunkContent}}); delta["content"] != "" {
+		t.Fatalf("the key's flag was ignored: %v", delta)
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"llm-proxy/internal/proxy"
+)
+
+const (
+	// sessionTTL is how long a response's items can be continued.
+	sessionTTL = time.Hour
+	// maxSessionItems caps the items remembered across all responses.
+	maxSessionItems = 10000
+)
+
+// upstreamSessions remembers which upstream session (Claude session or
+// Codex thread) produced each /v1/responses output item, so a follow-up
+// that echoes the items and adds tool outputs continues that session
+// instead of replaying the whole transcript to a new one.
+type upstreamSessions struct {
+	mu    sync.Mutex
+	items map[string]upstreamSession
+}
+
+type upstreamSession struct {
+	owner    string
+	model    string
+	threadID string
+	at       time.Time
+}
+
+// rememberSession records the session threadID behind the output items of
+// body, a response model served to r.
+func (s *Server) rememberSession(r *http.Request, model string, body map[string]any, threadID string) {
+	if threadID == "" || isReplay(r.Context()) {
+		return
+	}
+	var ids []string
+	for _, item := range outputItems(body["output"]) {
+		for _, key := range []string{"id", "call_id"} {
+			if id, _ := item[key].(string); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	s.sessions.remember(ids, upstreamSession{owner: keyName(r), model: model, threadID: threadID, at: time.Now()})
+}
+
+func outputItems(output any) []map[string]any {
+	switch v := output.(type) {
+	case []map[string]any:
+		return v
+	case []any:
+		out := make([]map[string]any, 0, len(v))
+		for _, item := range v {
+			if m, ok := item.(map[string]any); ok {
+				out = append(out, m)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func (u *upstreamSessions) remember(ids []string, session upstreamSession) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.items == nil {
+		u.items = map[string]upstreamSession{}
+	}
+	if len(u.items)+len(ids) > maxSessionItems {
+		for id, s := range u.items {
+			if session.at.Sub(s.at) > sessionTTL {
+				delete(u.items, id)
+			}
+		}
+	}
+	if len(u.items)+len(ids) > maxSessionItems {
+		// Still full of live sessions: start over rather than grow.
+		u.items = map[string]upstreamSession{}
+	}
+	for _, id := range ids {
+		u.items[id] = session
+	}
+}
+
+func (u *upstreamSessions) lookup(id string, now time.Time) (upstreamSession, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	s, ok := u.items[id]
+	if !ok || now.Sub(s.at) > sessionTTL {
+		return upstreamSession{}, false
+	}
+	return s, true
+}
+
+// continuation finds the upstream session a /v1/responses input follows
+// up on. The input's trailing client items (tool outputs and user
+// messages) continue the session that produced the item before them, or
+// that made the calls the tool outputs answer, when the same key ran it on
+// model. Otherwise the input is a new conversation and nil is returned.
+func (s *Server) continuation(r *http.Request, model string, input any) *proxy.Continuation {
+	if isReplay(r.Context()) {
+		return nil
+	}
+	items, _ := input.([]any)
+	start := len(items)
+	for start > 0 && isClientItem(items[start-1]) {
+		start--
+	}
+	if start == len(items) {
+		return nil
+	}
+	var keys []string
+	if start > 0 {
+		prev, _ := items[start-1].(map[string]any)
+		for _, key := range []string{"call_id", "id"} {
+			if id, _ := prev[key].(string); id != "" {
+				keys = append(keys, id)
+			}
+		}
+	}
+	for _, item := range items[start:] {
+		if m, _ := item.(map[string]any); m["type"] == "function_call_output" {
+			if id, _ := m["call_id"].(string); id != "" {
+				keys = append(keys, id)
+			}
+		}
+	}
+	now := time.Now()
+	for _, id := range keys {
+		session, ok := s.sessions.lookup(id, now)
+		if ok && session.owner == keyName(r) && session.model == model {
+			return &proxy.Continuation{ThreadID: session.threadID, Input: items[start:]}
+		}
+	}
+	return nil
+}
+
+// isClientItem reports whether an input item comes from the client rather
+// than from an earlier response.
+func isClientItem(item any) bool {
+	m, ok := item.(map[string]any)
+	if !ok {
+		return true
+	}
+	switch m["type"] {
+	case "function_call_output", "custom_tool_call_output":
+		return true
+	case nil, "message":
+		return m["role"] != "assistant"
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContinuationFollowsToolOutputs(t *testing.T) {
+	s := NewServer(nil)
+	r := httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	s.rememberSession(r, "sonnet", map[string]any{"output": []any{
+		map[string]any{"id": "fc_1", "type": "function_call", "call_id": "call_1", "name": "lookup"},
+		map[string]any{"id": "msg_1", "type": "message", "role": "assistant"},
+	}}, "sess-1")
+
+	var input any
+	_ = json.Unmarshal([]byte(`[
+		{"role": "user", "content": "look it up"},
+		{"id": "fc_1", "type": "function_call", "call_id": "call_1", "name": "lookup"},
+		{"type": "function_call_output", "call_id": "call_1", "output": "42"},
+		{"role": "user", "content": "and then?"}
+	]`), &input)
+
+	cont := s.continuation(r, "sonnet", input)
+	if cont == nil || cont.ThreadID != "sess-1" {
+		t.Fatalf("continuation = %#v", cont)
+	}
+	if items, _ := cont.Input.([]any); len(items) != 2 {
+		t.Fatalf("expected the two trailing client items, got %#v", cont.Input)
+	}
+
+	if cont := s.continuation(r, "opus", input); cont != nil {
+		t.Fatal("a session must only continue on the model that ran it")
+	}
+	other := httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	other = other.WithContext(context.WithValue(other.Context(), apiKeyContextKey{}, &APIKey{Name: "other"}))
+	if cont := s.continuation(other, "sonnet", input); cont != nil {
+		t.Fatal("a session must only continue for the key that ran it")
+	}
+	if cont := s.continuation(r, "sonnet", "fresh prompt"); cont != nil {
+		t.Fatal("string input is a new conversation")
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/proxy"
+)
+
+const (
+	// maxShadowResults is how many shadow runs are kept in memory; the log
+	// has them all.
+	maxShadowResults = 100
+	// maxShadowRuns caps the shadow runs at once; requests that would start
+	// another are not mirrored.
+	maxShadowRuns = 4
+	// shadowTimeout bounds a shadow run.
+	shadowTimeout = 10 * time.Minute
+)
+
+// ShadowResult is a request mirrored to a shadow model, and how the shadow's
+// answer compared with the one the client got.
+type ShadowResult struct {
+	Time             time.Time `json:"time"`
+	RequestID        uint64    `json:"request_id"`
+	Path             string    `json:"path"`
+	Model            string    `json:"model"`
+	Shadow           string    `json:"shadow"`
+	Status           int       `json:"status"`
+	Error            string    `json:"error,omitempty"`
+	LatencyMs        float64   `json:"latency_ms"`
+	PrimaryLatencyMs float64   `json:"primary_latency_ms"`
+	// WordsRemoved and WordsAdded are how far the shadow's output is from
+	// the client's, in words of a WordDiff.
+	WordsRemoved int    `json:"words_removed"`
+	WordsAdded   int    `json:"words_added"`
+	Output       string `json:"output"`
+}
+
+type shadowTraffic struct {
+	models  atomic.Pointer[map[string]config.Shadow]
+	running atomic.Int32
+
+	mu      sync.Mutex
+	results []ShadowResult
+}
+
+// SetShadow replaces the models whose requests are mirrored to a shadow
+// model.
+func (s *Server) SetShadow(models map[string]config.Shadow) {
+	s.shadow.models.Store(&models)
+}
+
+// ShadowResults returns the latest shadow runs, oldest first.
+func (s *Server) ShadowResults() []ShadowResult {
+	s.shadow.mu.Lock()
+	defer s.shadow.mu.Unlock()
+	return slices.Clone(s.shadow.results)
+}
+
+// mirror runs a logged request again on its model's shadow, in the
+// background and at batch priority, when it is one of the share picked.
+// Only successful requests the log can replay are mirrored, and only to
+// shadows their API key may use; the shadow's tokens count towards the
+// key's usage.
+func (s *Server) mirror(e RequestLogEntry) {
+	models := s.shadow.models.Load()
+	if models == nil || !e.Replayable || e.Status != http.StatusOK {
+		return
+	}
+	sh, ok := (*models)[e.Model]
+	if !ok || rand.Float64()*100 >= sh.Percent {
+		return
+	}
+	if s.shadow.running.Add(1) > maxShadowRuns {
+		s.shadow.running.Add(-1)
+		log.Printf("shadow: skipped request %d for %s: %d shadow runs already going", e.ID, e.Model, maxShadowRuns)
+		return
+	}
+	if key := e.replay.key; !key.AllowsModel(sh.Model) {
+		s.shadow.running.Add(-1)
+		log.Printf("shadow: skipped request %d for %s: API key %q may not use %s", e.ID, e.Model, key.Name, sh.Model)
+		return
+	}
+	go func() {
+		defer s.shadow.running.Add(-1)
+		ctx, cancel := context.WithTimeout(shadowContext(e), shadowTimeout)
+		defer cancel()
+		s.recordShadow(ctx, e, sh.Model)
+	}()
+}
+
+// shadowContext is what a shadow run of e runs under: the API key e came
+// with, so its model list and request budget apply, and the read-only
+// preset whatever the key's, so the shadow cannot edit files or run
+// commands on top of what the client's request did.
+func shadowContext(e RequestLogEntry) context.Context {
+	return proxy.WithSafety(e.replay.context(context.Background()), proxy.SafetyReadOnly)
+}
+
+// recordShadow runs e on model and keeps how it went.
+func (s *Server) recordShadow(ctx context.Context, e RequestLogEntry, model string) {
+	res := ShadowResult{
+		Time:             time.Now(),
+		RequestID:        e.ID,
+		Path:             e.Path,
+		Model:            e.Model,
+		Shadow:           model,
+		PrimaryLatencyMs: e.LatencyMs,
+	}
+	replay, err := s.rerun(ctx, e, model, config.PriorityBatch)
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Status = replay.Replay.Status
+		res.Error = replay.Replay.Error
+		res.LatencyMs = replay.Replay.LatencyMs
+		res.Output = replay.Replay.Output
+		res.WordsRemoved, res.WordsAdded = DiffChanged(replay.Diff)
+		if key := e.replay.key; key != nil && s.metrics != nil {
+			s.metrics.observeKey(key.Name, model, res.Status, replay.Replay.promptTokens, replay.Replay.completionTokens)
+		}
+	}
+	if res.Error != "" {
+		log.Printf("shadow: request %d for %s on %s failed: %s", e.ID, e.Model, model, res.Error)
+	} else {
+		log.Printf("shadow: request %d for %s on %s: %d in %.0fms (vs %.0fms), -%d/+%d words", e.ID, e.Model, model, res.Status, res.LatencyMs, res.PrimaryLatencyMs, res.WordsRemoved, res.WordsAdded)
+	}
+	s.shadow.mu.Lock()
+	defer s.shadow.mu.Unlock()
+	s.shadow.results = append(s.shadow.results, res)
+	if n := len(s.shadow.results) - maxShadowResults; n > 0 {
+		s.shadow.results = slices.Delete(s.shadow.results, 0, n)
+	}
+}
+
+func (s *Server) getShadow(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"data": s.ShadowResults()})
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+)
+
+func TestShadowMirrorsRequestsInTheBackground(t *testing.T) {
+	m1 := &streamingTestAdapter{model: "m1", deltas: []string{"primary answer"}}
+	m2 := &streamingTestAdapter{model: "m2", deltas: []string{"shadow answer"}}
+	s := NewServer(proxy.NewRouter(m1, m2))
+	metrics := NewMetrics()
+	s.SetMetrics(metrics)
+	s.SetShadow(map[string]config.Shadow{"m1": {Model: "m2", Percent: 100}})
+	h := metrics.Middleware(openapiv1.HandlerFromMux(s, http.NewServeMux()))
+	chat := func(model string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+model+`","messages":[{"role":"user","content":"hi"}]}`)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("chat on %s: %d %s", model, w.Code, w.Body)
+		}
+	}
+
+	chat("m2")
+	chat("m1")
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.ShadowResults()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no shadow run was recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := s.ShadowResults()
+	if len(got) != 1 {
+		t.Fatalf("shadow results = %+v, want only the m1 request mirrored", got)
+	}
+	res := got[0]
+	if res.Model != "m1" || res.Shadow != "m2" || res.Status != http.StatusOK || res.Output != "shadow answer" || res.WordsRemoved != 1 || res.WordsAdded != 1 {
+		t.Fatalf("shadow result = %+v", res)
+	}
+	if n := len(metrics.RecentRequests(0)); n != 2 {
+		t.Fatalf("request log has %d entries; the shadow run must not be logged", n)
+	}
+}
+
+// safetyTestAdapter records the safety preset of the chats it runs.
+type safetyTestAdapter struct {
+	streamingTestAdapter
+	safety chan string
+}
+
+func (a *safetyTestAdapter) Chat(ctx context.Context, req proxy.ChatRequest) (proxy.ChatResponse, error) {
+	a.safety <- proxy.SafetyFromContext(ctx)
+	return a.streamingTestAdapter.Chat(ctx, req)
+}
+
+func TestShadowRunsUnderTheRequestsKey(t *testing.T) {
+	m1 := &streamingTestAdapter{model: "m1", deltas: []string{"primary answer"}}
+	m2 := &safetyTestAdapter{streamingTestAdapter: streamingTestAdapter{model: "m2", deltas: []string{"shadow answer"}}, safety: make(chan string, 1)}
+	s := NewServer(proxy.NewRouter(m1, m2))
+	metrics := NewMetrics()
+	s.SetMetrics(metrics)
+	s.SetShadow(map[string]config.Shadow{"m1": {Model: "m2", Percent: 100}})
+	auth := NewAuthenticator([]config.APIKey{
+		{Name: "full", Key: "sk-full", Scopes: []string{config.ScopeAll}, Safety: proxy.SafetyFull},
+		{Name: "m1-only", Key: "sk-m1", Scopes: []string{config.ScopeAll}, DenyModels: []string{"m2"}},
+	})
+	h := metrics.Middleware(auth.Middleware(openapiv1.HandlerFromMux(s, http.NewServeMux())))
+	chat := func(token string) {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m1","messages":[{"role":"user","content":"hi"}]}`))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("chat with %s: %d %s", token, w.Code, w.Body)
+		}
+	}
+
+	chat("sk-m1")
+	chat("sk-full")
+	select {
+	case safety := <-m2.safety:
+		if safety != proxy.SafetyReadOnly {
+			t.Fatalf("shadow ran with safety %q, want %q", safety, proxy.SafetyReadOnly)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no shadow run")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.ShadowResults()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no shadow run was recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := s.ShadowResults(); len(got) != 1 || got[0].Status != http.StatusOK {
+		t.Fatalf("shadow results = %+v, want one run, for the key that may use m2", got)
+	}
+	keys := metrics.Snapshot().Keys
+	i := slices.IndexFunc(keys, func(k KeyStats) bool { return k.Key == "full" })
+	if i < 0 || keys[i].RequestsTotal != 2 {
+		t.Fatalf("key stats = %+v, want the shadow run charged to the key", keys)
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"llm-proxy/internal/openapiv1"
+)
+
+// responseIncludes are the `include` values OpenAI accepts when retrieving a
+// response. The CLIs never expose encrypted reasoning, logprobs or hosted tool
+// results, so none of them adds data: reasoning items always come back with
+// their plain-text summaries. Other values are rejected as OpenAI does.
+var responseIncludes = []string{
+	"code_interpreter_call.outputs",
+	"computer_call_output.output.image_url",
+	"file_search_call.results",
+	"message.input_image.image_url",
+	"message.output_text.logprobs",
+	"reasoning.encrypted_content",
+	"web_search_call.action.sources",
+	"web_search_call.results",
+}
+
+func (s *Server) GetResponse(w http.ResponseWriter, r *http.Request, responseID string, params openapiv1.GetResponseParams) {
+	include := r.URL.Query()["include[]"]
+	if params.Include != nil {
+		include = append(include, *params.Include...)
+	}
+	for _, v := range include {
+		if !slices.Contains(responseIncludes, v) {
+			writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("unsupported include value %q", v))
+			return
+		}
+	}
+	resp, ok := s.storedResponse(w, r, responseID)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(resp)
+}
+
+func (s *Server) DeleteResponse(w http.ResponseWriter, r *http.Request, responseID string) {
+	if _, ok := s.storedResponse(w, r, responseID); !ok {
+		return
+	}
+	if _, err := s.store.DeleteResponse(responseID); err != nil {
+		log.Printf("delete response: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to delete response")
+		return
+	}
+	writeJSON(w, http.StatusOK, openapiv1.DeletedResponse{
+		Id:      responseID,
+		Object:  openapiv1.DeletedResponseObjectResponse,
+		Deleted: true,
+	})
+}
+
+// storedResponse loads a response created by the calling key, writing a 404
+// when it does not exist, expired, belongs to another key, or no store is
+// configured.
+func (s *Server) storedResponse(w http.ResponseWriter, r *http.Request, id string) ([]byte, bool) {
+	notFound := func() ([]byte, bool) {
+		writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("Response with id '%s' not found.", id))
+		return nil, false
+	}
+	if s.store == nil {
+		return notFound()
+	}
+	resp, ok, err := s.store.Response(id)
+	if err != nil {
+		log.Printf("read response: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to read response")
+		return nil, false
+	}
+	if !ok || resp.Owner != keyName(r) {
+		return notFound()
+	}
+	return resp.Body, true
+}
+
+// keyName names the API key of r, or "" when auth is disabled.
+func keyName(r *http.Request) string {
+	if key := KeyFromContext(r.Context()); key != nil {
+		return key.Name
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+	"llm-proxy/internal/store"
+)
+
+func TestStoredResponsesCanBeRetrievedAndDeleted(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "state.db"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &streamingTestAdapter{model: "m2"}))
+	s.SetStore(st)
+	mux := http.NewServeMux()
+	handler := openapiv1.HandlerFromMux(s, mux)
+	as := func(r *http.Request, key string) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, &APIKey{Name: key}))
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, as(httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader([]byte(`{"model":"m1","input":"hi"}`))), "alice"))
+	var created map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := created["id"].(string)
+	if id == "" {
+		t.Fatalf("no response id in %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, as(httptest.NewRequest(http.MethodGet, "/v1/responses/"+id+"?include[]=reasoning.encrypted_content", nil), "alice"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("get: %d %s", w.Code, w.Body)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got["id"] != id {
+		t.Fatalf("get returned %s", w.Body)
+	}
+
+	for _, tc := range []struct {
+		key, path string
+		want      int
+	}{
+		{"bob", "/v1/responses/" + id, http.StatusNotFound},
+		{"alice", "/v1/responses/" + id + "?include=bogus", http.StatusBadRequest},
+	} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, as(httptest.NewRequest(http.MethodGet, tc.path, nil), tc.key))
+		if w.Code != tc.want {
+			t.Fatalf("%s as %s: got %d, want %d", tc.path, tc.key, w.Code, tc.want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, as(httptest.NewRequest(http.MethodDelete, "/v1/responses/"+id, nil), "alice"))
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"deleted":true`)) {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, as(httptest.NewRequest(http.MethodGet, "/v1/responses/"+id, nil), "alice"))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("get after delete: %d", w.Code)
+	}
+}
@@ -0,0 +1,376 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"llm-proxy/internal/openapiv1"
+)
+
+// outputFormat is a request's structured output: a JSON object, or a JSON
+// value matching schema. The CLIs have no native support, so the model is
+// told the format and its answer is repaired and checked afterwards.
+type outputFormat struct {
+	name   string
+	schema map[string]any
+}
+
+// chatOutputFormat returns the response_format of a chat request, or nil
+// for plain text.
+func chatOutputFormat(req openapiv1.ChatCompletionsRequest) (*outputFormat, error) {
+	rf := req.ResponseFormat
+	if rf == nil {
+		return nil, nil
+	}
+	switch rf.Type {
+	case openapiv1.ResponseFormatTypeText:
+		return nil, nil
+	case openapiv1.ResponseFormatTypeJsonObject:
+		return &outputFormat{}, nil
+	case openapiv1.ResponseFormatTypeJsonSchema:
+		if rf.JsonSchema == nil || rf.JsonSchema.Schema == nil {
+			return nil, errors.New("response_format.json_schema.schema is required")
+		}
+		return &outputFormat{name: rf.JsonSchema.Name, schema: *rf.JsonSchema.Schema}, nil
+	}
+	return nil, fmt.Errorf("unsupported response_format type %q", rf.Type)
+}
+
+// responsesOutputFormat returns the text.format of a /v1/responses request,
+// or nil for plain text.
+func responsesOutputFormat(req openapiv1.ResponsesRequest) (*outputFormat, error) {
+	if req.Text == nil || req.Text.Format == nil {
+		return nil, nil
+	}
+	f := req.Text.Format
+	switch f.Type {
+	case openapiv1.ResponsesTextFormatTypeText:
+		return nil, nil
+	case openapiv1.ResponsesTextFormatTypeJsonObject:
+		return &outputFormat{}, nil
+	case openapiv1.ResponsesTextFormatTypeJsonSchema:
+		if f.Schema == nil {
+			return nil, errors.New("text.format.schema is required")
+		}
+		return &outputFormat{name: stringValue(f.Name), schema: *f.Schema}, nil
+	}
+	return nil, fmt.Errorf("unsupported text.format type %q", f.Type)
+}
+
+// instruction tells the model how to answer.
+func (f *outputFormat) instruction() string {
+	if f.schema == nil {
+		return "Respond with a single JSON object and nothing else: no prose before or after it and no code fences."
+	}
+	schema, _ := json.Marshal(f.schema)
+	return fmt.Sprintf("Respond with a single JSON value matching the JSON schema %q below and nothing else: no prose before or after it and no code fences. If you cannot answer in this format, say why in plain text instead.\n\n%s", f.name, schema)
+}
+
+// responsesInput adds the instruction to a /v1/responses input.
+func (f *outputFormat) responsesInput(input any) any {
+	if f == nil {
+		return input
+	}
+	switch v := input.(type) {
+	case string:
+		return v + "\n\n" + f.instruction()
+	case []any:
+		out := append(make([]any, 0, len(v)+1), v...)
+		return append(out, map[string]any{"type": "message", "role": "developer", "content": f.instruction()})
+	}
+	return input
+}
+
+// enforce repairs the model's answer into the requested JSON and checks it.
+// When it cannot comply, the returned refusal says why: the model's own
+// words if it answered without JSON, or how the JSON misses the schema.
+func (f *outputFormat) enforce(text string) (out, refusal string) {
+	value, raw, ok := extractJSON(text)
+	if !ok {
+		if text = strings.TrimSpace(text); text != "" {
+			return "", text
+		}
+		return "", "The model did not produce any output."
+	}
+	if f.schema == nil {
+		if _, isObject := value.(map[string]any); !isObject {
+			return "", "The model's answer is JSON but not an object."
+		}
+		return raw, ""
+	}
+	if err := (&schemaValidator{root: f.schema}).validate(value, f.schema, "$"); err != nil {
+		return "", fmt.Sprintf("The model's answer does not match the %q schema: %v.", f.name, err)
+	}
+	return raw, ""
+}
+
+var codeFence = regexp.MustCompile("(?s)```[a-zA-Z]*\\s*\\n(.*?)\\n?```")
+
+// extractJSON finds the JSON value in a model's answer: the whole text, a
+// fenced code block, or the first value embedded in prose.
+func extractJSON(text string) (any, string, bool) {
+	candidates := []string{strings.TrimSpace(text)}
+	for _, m := range codeFence.FindAllStringSubmatch(text, -1) {
+		candidates = append(candidates, strings.TrimSpace(m[1]))
+	}
+	for _, c := range candidates {
+		if v, ok := decodeJSON(c); ok {
+			return v, c, true
+		}
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] != '{' && text[i] != '[' {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(text[i:]))
+		dec.UseNumber()
+		var v any
+		if dec.Decode(&v) == nil {
+			return v, text[i : i+int(dec.InputOffset())], true
+		}
+	}
+	return nil, "", false
+}
+
+func decodeJSON(s string) (any, bool) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if dec.Decode(&v) != nil || v == nil {
+		return nil, false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+	return v, true
+}
+
+// schemaValidator checks values against the subset of JSON Schema that
+// OpenAI's strict structured outputs accept.
+type schemaValidator struct {
+	root map[string]any
+}
+
+func (sv *schemaValidator) validate(v any, schema map[string]any, at string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := sv.resolve(ref)
+		if err != nil {
+			return err
+		}
+		return sv.validate(v, target, at)
+	}
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if jsonTypeIs(v, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s is %s, want %s", at, jsonTypeName(v), strings.Join(types, " or "))
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(v, c) {
+		return fmt.Errorf("%s must be %s", at, jsonString(c))
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is %s, not one of %s", at, jsonString(v), jsonString(enum))
+		}
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		options, ok := schema[key].([]any)
+		if !ok {
+			continue
+		}
+		matched := false
+		var firstErr error
+		for _, o := range options {
+			sub, _ := o.(map[string]any)
+			err := sv.validate(v, sub, at)
+			if err == nil {
+				matched = true
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s matches none of its %s options (first: %v)", at, key, firstErr)
+		}
+	}
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, o := range all {
+			sub, _ := o.(map[string]any)
+			if err := sv.validate(v, sub, at); err != nil {
+				return err
+			}
+		}
+	}
+	switch val := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, r := range required {
+				if name, _ := r.(string); name != "" {
+					if _, ok := val[name]; !ok {
+						return fmt.Errorf("%s is missing required property %q", at, name)
+					}
+				}
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if sub, ok := props[k].(map[string]any); ok {
+				if err := sv.validate(val[k], sub, at+"."+k); err != nil {
+					return err
+				}
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					return fmt.Errorf("%s has unexpected property %q", at, k)
+				}
+			case map[string]any:
+				if err := sv.validate(val[k], extra, at+"."+k); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range val {
+				if err := sv.validate(item, items, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+					return err
+				}
+			}
+		}
+		if n, ok := schema["minItems"].(float64); ok && float64(len(val)) < n {
+			return fmt.Errorf("%s has %d items, want at least %v", at, len(val), n)
+		}
+		if n, ok := schema["maxItems"].(float64); ok && float64(len(val)) > n {
+			return fmt.Errorf("%s has %d items, want at most %v", at, len(val), n)
+		}
+	}
+	return nil
+}
+
+// resolve follows a local $ref such as "#/$defs/step".
+func (sv *schemaValidator) resolve(ref string) (map[string]any, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	var node any = sv.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+		m, _ := node.(map[string]any)
+		if node = m[part]; node == nil {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	schema, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	return schema, nil
+}
+
+func schemaTypes(t any) []string {
+	switch v := t.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func jsonTypeIs(v any, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	}
+	return jsonTypeName(v) == t
+}
+
+func jsonTypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// jsonEqual compares JSON values by their encoding, so a decoded
+// json.Number equals the float64 a schema was decoded with.
+func jsonEqual(a, b any) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	return jsonString(a) == jsonString(b)
+}
+
+func jsonString(v any) string {
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
+
+// messageContent is the content of an assistant message answering with
+// text: the text itself, or under a structured output format the repaired
+// JSON or a refusal part.
+func (f *outputFormat) messageContent(text string) []map[string]any {
+	if f != nil {
+		var refusal string
+		if text, refusal = f.enforce(text); refusal != "" {
+			return []map[string]any{{"type": "refusal", "refusal": refusal}}
+		}
+	}
+	return []map[string]any{{"type": "output_text", "text": text}}
+}
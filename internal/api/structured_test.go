@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llm-proxy/internal/proxy"
+)
+
+func TestOutputFormatRepairsAndValidates(t *testing.T) {
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"steps": {"type": "array", "items": {"$ref": "#/$defs/step"}}
+		},
+		"required": ["name", "steps"],
+		"additionalProperties": false,
+		"$defs": {"step": {"type": "object", "properties": {"n": {"type": "integer"}}, "required": ["n"]}}
+	}`), &schema); err != nil {
+		t.Fatal(err)
+	}
+	f := &outputFormat{name: "plan", schema: schema}
+
+	cases := []struct {
+		text, out, refusal string
+	}{
+		{text: `{"name":"a","steps":[{"n":1}]}`, out: `{"name":"a","steps":[{"n":1}]}`},
+		{text: "Here you go:\n```json\n{\"name\":\"a\",\"steps\":[]}\n```", out: `{"name":"a","steps":[]}`},
+		{text: `Sure! {"name":"a","steps":[]} Hope that helps.`, out: `{"name":"a","steps":[]}`},
+		{text: `{"name":"a","steps":[{"n":1.5}]}`, refusal: "$.steps[0].n is number, want integer"},
+		{text: `{"name":"a"}`, refusal: `missing required property "steps"`},
+		{text: `{"name":"a","steps":[],"extra":1}`, refusal: `unexpected property "extra"`},
+		{text: "I can't help with that.", refusal: "I can't help with that."},
+	}
+	for _, c := range cases {
+		out, refusal := f.enforce(c.text)
+		if out != c.out {
+			t.Errorf("enforce(%q) = %q, want %q", c.text, out, c.out)
+		}
+		if (c.refusal == "") != (refusal == "") || !strings.Contains(refusal, c.refusal) {
+			t.Errorf("enforce(%q) refusal = %q, want it to contain %q", c.text, refusal, c.refusal)
+		}
+	}
+
+	if _, refusal := (&outputFormat{}).enforce(`[1, 2]`); refusal == "" {
+		t.Fatal("json_object accepted an array")
+	}
+}
+
+func TestChatCompletionEnforcesResponseFormat(t *testing.T) {
+	adapter := &streamingTestAdapter{model: "m1", deltas: []string{"```json\n", `{"ok": true}`, "\n```"}}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+
+	body := []byte(`{"model":"m1","messages":[{"role":"user","content":"hi"}],
+		"response_format":{"type":"json_schema","json_schema":{"name":"r","schema":{"type":"object","properties":{"ok":{"type":"boolean"}},"required":["ok"]}}}}`)
+	w := httptest.NewRecorder()
+	s.CreateChatCompletion(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body)))
+
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string  `json:"content"`
+				Refusal *string `json:"refusal"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v\n%s", err, w.Body.String())
+	}
+	if got := resp.Choices[0].Message; got.Content != `{"ok": true}` || got.Refusal != nil {
+		t.Fatalf("unexpected message: %+v", got)
+	}
+	last := adapter.chats[0].Messages[len(adapter.chats[0].Messages)-1]
+	if last.Role != "system" || !strings.Contains(last.Content, `"required":["ok"]`) {
+		t.Fatalf("schema instruction not sent: %+v", last)
+	}
+}
+
+func TestStreamResponseRefusesNonConformingOutput(t *testing.T) {
+	adapter := &streamingTestAdapter{
+		model:  "m1",
+		events: []proxy.ResponseEvent{{Kind: proxy.ResponseEventOutput, Delta: `{"ok": "yes"}`}},
+	}
+	s := NewServer(proxy.NewRouter(adapter, &streamingTestAdapter{model: "m2"}))
+
+	body := []byte(`{"model":"m1","stream":true,"input":"hi",
+		"text":{"format":{"type":"json_schema","name":"r","schema":{"type":"object","properties":{"ok":{"type":"boolean"}}}}}}`)
+	w := httptest.NewRecorder()
+	s.CreateResponse(w, httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader(body)))
+
+	var refusal string
+	var content []any
+	for _, ev := range decodeSSEEvents(t, w.Body.String()) {
+		switch ev["type"] {
+		case "response.output_text.delta", "response.output_text.done":
+			t.Fatalf("non-conforming output was streamed: %v", ev)
+		case "response.refusal.done":
+			refusal, _ = ev["refusal"].(string)
+		case "response.completed":
+			resp, _ := ev["response"].(map[string]any)
+			output, _ := resp["output"].([]any)
+			item, _ := output[0].(map[string]any)
+			content, _ = item["content"].([]any)
+		}
+	}
+	if !strings.Contains(refusal, "$.ok is string, want boolean") {
+		t.Fatalf("refusal = %q", refusal)
+	}
+	if part, _ := content[0].(map[string]any); part["type"] != "refusal" || part["refusal"] != refusal {
+		t.Fatalf("unexpected message content: %v", content)
+	}
+}
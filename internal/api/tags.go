@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// TagsHeader tags a request for analytics with comma-separated labels or
+// key=value pairs, e.g. "project=billing,tool=aider". Tags show up in the
+// request log, the access log and per-tag usage in the metrics.
+const TagsHeader = "X-LLM-Proxy-Tags"
+
+// Tags beyond maxRequestTags are dropped and longer ones cut to maxTagLen,
+// so a client cannot bloat the logs.
+const (
+	maxRequestTags = 16
+	maxTagLen      = 64
+)
+
+func parseTags(header string) []string {
+	if header == "" {
+		return nil
+	}
+	return addTags(nil, strings.Split(header, ",")...)
+}
+
+// metadataTags turns a request's metadata into key=value tags.
+func metadataTags(metadata *map[string]string) []string {
+	if metadata == nil {
+		return nil
+	}
+	tags := make([]string, 0, len(*metadata))
+	for k, v := range *metadata {
+		tags = append(tags, k+"="+v)
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+// addTags appends the tags not already in dst, trimmed and within the limits.
+func addTags(dst []string, tags ...string) []string {
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if len(tag) > maxTagLen {
+			tag = strings.ToValidUTF8(tag[:maxTagLen], "")
+		}
+		if tag == "" || slices.Contains(dst, tag) {
+			continue
+		}
+		if len(dst) >= maxRequestTags {
+			break
+		}
+		dst = append(dst, tag)
+	}
+	return dst
+}
+
+type tagObserver interface {
+	AddObservedTags([]string)
+}
+
+// ObserveTags adds tags found in the request body to those from its header.
+func ObserveTags(w http.ResponseWriter, tags []string) {
+	if mw, ok := w.(tagObserver); ok {
+		mw.AddObservedTags(tags)
+	}
+}
+
+func (r *statusRecorder) AddObservedTags(tags []string) {
+	r.tags = addTags(r.tags, tags...)
+}
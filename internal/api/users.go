@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxUserLen cuts client-supplied user IDs to a sane size for the logs.
+const maxUserLen = 128
+
+type userObserver interface {
+	SetObservedUser(string)
+}
+
+// ObserveUser records the end user a request was made for: the `user` field
+// of OpenAI's request bodies.
+func ObserveUser(w http.ResponseWriter, user string) {
+	if mw, ok := w.(userObserver); ok {
+		mw.SetObservedUser(user)
+	}
+}
+
+func (r *statusRecorder) SetObservedUser(user string) {
+	user = strings.TrimSpace(user)
+	if len(user) > maxUserLen {
+		user = strings.ToValidUTF8(user[:maxUserLen], "")
+	}
+	r.observedUser = user
+}
+
+// userLimiter caps each end user's request rate with a token bucket that
+// holds a minute's worth of requests. Users are scoped to the API key that
+// names them, since clients pick the IDs.
+type userLimiter struct {
+	mu      sync.Mutex
+	perMin  int
+	buckets map[string]*userBucket
+	lastGC  time.Time
+}
+
+type userBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+func (l *userLimiter) setLimit(perMin int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.perMin = perMin
+	l.buckets = nil
+}
+
+// allow takes a request from id's bucket, or returns how long until one is
+// available.
+func (l *userLimiter) allow(id string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.perMin <= 0 {
+		return true, 0
+	}
+	if l.buckets == nil {
+		l.buckets = map[string]*userBucket{}
+	}
+	capacity := float64(l.perMin)
+	perSec := capacity / 60
+	if now.Sub(l.lastGC) > time.Minute {
+		// A bucket idle for a minute is full again, the same as none.
+		for k, b := range l.buckets {
+			if now.Sub(b.at) > time.Minute {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastGC = now
+	}
+	b := l.buckets[id]
+	if b == nil {
+		b = &userBucket{tokens: capacity, at: now}
+		l.buckets[id] = b
+	}
+	b.tokens = min(capacity, b.tokens+now.Sub(b.at).Seconds()*perSec)
+	b.at = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / perSec * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// SetUserRateLimit caps each end user, as named by the `user` field, at
+// perMin requests a minute; zero means no cap.
+func (s *Server) SetUserRateLimit(perMin int) {
+	s.users.setLimit(perMin)
+}
+
+// allowUser records the request's user and reports whether it is within its
+// rate limit, writing a 429 when it is not.
+func (s *Server) allowUser(w http.ResponseWriter, r *http.Request, user *string) bool {
+	if user == nil || strings.TrimSpace(*user) == "" {
+		return true
+	}
+	ObserveUser(w, *user)
+	ok, wait := s.users.allow(keyName(r)+"\x00"+strings.TrimSpace(*user), time.Now())
+	if ok {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+	writeJSON(w, http.StatusTooManyRequests, map[string]any{"error": map[string]any{
+		"type":    "rate_limit_error",
+		"code":    "rate_limit_exceeded",
+		"message": fmt.Sprintf("user %q is over its request rate limit; retry in %s", strings.TrimSpace(*user), wait.Round(time.Second)),
+	}})
+	return false
+}
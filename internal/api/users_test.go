@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/proxy"
+)
+
+func TestUserLimiterRefillsOverAMinute(t *testing.T) {
+	var l userLimiter
+	l.setLimit(2)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("ci\x00alice", now); !ok {
+			t.Fatalf("request %d was limited", i)
+		}
+	}
+	ok, wait := l.allow("ci\x00alice", now)
+	if ok || wait != 30*time.Second {
+		t.Fatalf("expected a 30s wait, got ok=%v wait=%s", ok, wait)
+	}
+	if ok, _ := l.allow("ci\x00bob", now); !ok {
+		t.Fatal("users must have their own buckets")
+	}
+	if ok, _ := l.allow("ci\x00alice", now.Add(30*time.Second)); !ok {
+		t.Fatal("bucket did not refill")
+	}
+}
+
+func TestUserFieldIsCountedAndLimited(t *testing.T) {
+	m := NewMetrics()
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1", deltas: []string{"ok"}}, &streamingTestAdapter{model: "m2"}))
+	s.SetUserRateLimit(1)
+	h := m.Middleware(http.HandlerFunc(s.CreateChatCompletion))
+
+	send := func() *httptest.ResponseRecorder {
+		body := []byte(`{"model":"m1","user":"alice","messages":[{"role":"user","content":"hi"}]}`)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body)))
+		return w
+	}
+	if w := send(); w.Code != http.StatusOK {
+		t.Fatalf("first request: %d %s", w.Code, w.Body)
+	}
+	w := send()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+
+	if got := m.RecentRequests(1)[0].User; got != "alice" {
+		t.Fatalf("request log user = %q", got)
+	}
+	users := m.Snapshot().Users
+	if len(users) != 1 || users[0].Key != "alice" || users[0].RequestsTotal != 2 || users[0].ErrorsTotal != 1 {
+		t.Fatalf("unexpected user stats %+v", users)
+	}
+}
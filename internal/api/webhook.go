@@ -0,0 +1,238 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"llm-proxy/internal/config"
+)
+
+const (
+	webhookTimeout  = 10 * time.Second
+	webhookAttempts = 3
+)
+
+// webhookBackoff is the wait before each retry of a failed delivery.
+var webhookBackoff = []time.Duration{time.Second, 10 * time.Second}
+
+// webhookSender delivers response lifecycle events, signed as described by
+// Standard Webhooks (webhook-id, webhook-timestamp and webhook-signature
+// headers) so receivers can use existing verification libraries.
+type webhookSender struct {
+	secret     atomic.Pointer[string]
+	allowHosts atomic.Pointer[[]string]
+	client     *http.Client
+}
+
+// webhook is where a response's events are delivered. public is set for a
+// URL the client sent, which may only reach public addresses.
+type webhook struct {
+	url    string
+	public bool
+}
+
+// SetWebhookSecret sets the key used to sign webhook deliveries. Without one,
+// webhooks are disabled.
+func (s *Server) SetWebhookSecret(secret string) {
+	s.webhooks.secret.Store(&secret)
+}
+
+// SetWebhookAllowHosts sets the hosts a webhook URL sent with a request may
+// use even when they are not public.
+func (s *Server) SetWebhookAllowHosts(hosts []string) {
+	s.webhooks.allowHosts.Store(&hosts)
+}
+
+func (h *webhookSender) allowed(host string) bool {
+	p := h.allowHosts.Load()
+	return p != nil && slices.ContainsFunc(*p, func(allowed string) bool {
+		return strings.EqualFold(allowed, host)
+	})
+}
+
+func (h *webhookSender) signingKey() []byte {
+	p := h.secret.Load()
+	if p == nil || *p == "" {
+		return nil
+	}
+	if raw, ok := strings.CutPrefix(*p, "whsec_"); ok {
+		if key, err := base64.StdEncoding.DecodeString(raw); err == nil {
+			return key
+		}
+	}
+	return []byte(*p)
+}
+
+// webhookFor returns the webhook for r: WebhookHeader, else the key's.
+// Replays call none. The header's URL must resolve to public addresses
+// only, unless its host is in the allow list, since clients choose it: it
+// could otherwise point the proxy at services on its own network or at a
+// cloud metadata endpoint. Deliveries check the address again when they
+// connect, in case the name resolves differently by then.
+func (s *Server) webhookFor(r *http.Request) (webhook, error) {
+	if isReplay(r.Context()) {
+		return webhook{}, nil
+	}
+	if u := strings.TrimSpace(r.Header.Get(WebhookHeader)); u != "" {
+		if s.webhooks.signingKey() == nil {
+			return webhook{}, fmt.Errorf("%s: webhooks are not configured", WebhookHeader)
+		}
+		if err := config.ValidateWebhookURL(u); err != nil {
+			return webhook{}, fmt.Errorf("%s: %w", WebhookHeader, err)
+		}
+		parsed, _ := url.Parse(u)
+		if s.webhooks.allowed(parsed.Hostname()) {
+			return webhook{url: u}, nil
+		}
+		if err := checkPublicHost(r.Context(), parsed.Hostname()); err != nil {
+			return webhook{}, fmt.Errorf("%s: %w", WebhookHeader, err)
+		}
+		return webhook{url: u, public: true}, nil
+	}
+	if key := KeyFromContext(r.Context()); key != nil {
+		return webhook{url: key.Webhook}, nil
+	}
+	return webhook{}, nil
+}
+
+// checkPublicHost resolves host and fails unless all its addresses are
+// public.
+func checkPublicHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return fmt.Errorf("%s resolves to %s, which is not a public address", host, addr)
+		}
+	}
+	return nil
+}
+
+// publicAddr reports whether addr is a public unicast address: not
+// loopback, private (including unique local IPv6 and carrier-grade NAT),
+// link-local (which holds the 169.254.169.254 metadata endpoint) or
+// unspecified.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddrs.Contains(addr)
+}
+
+// sharedAddrs is the carrier-grade NAT range, private in all but name.
+var sharedAddrs = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicWebhookClient delivers to the URLs clients send.
+var publicWebhookClient = newPublicClient()
+
+// newPublicClient returns a client that refuses to connect to addresses
+// publicAddr rejects, also after redirects, and ignores proxy settings,
+// since a proxy would connect on its behalf.
+func newPublicClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(addr.Addr()) {
+				return fmt.Errorf("webhook address %s is not public", addr.Addr())
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: webhookTimeout},
+	}
+}
+
+// notifyWebhook posts a response.completed, response.incomplete,
+// response.failed or response.cancelled event for response to url in the
+// background. The payload follows OpenAI's webhook events, with the
+// response object added.
+func (s *Server) notifyWebhook(hook webhook, eventType string, response map[string]any) {
+	key := s.webhooks.signingKey()
+	if hook.url == "" || key == nil {
+		return
+	}
+	id := genID("evt")
+	body, err := json.Marshal(map[string]any{
+		"id":         id,
+		"object":     "event",
+		"type":       eventType,
+		"created_at": time.Now().Unix(),
+		"data":       map[string]any{"id": response["id"], "response": response},
+	})
+	if err != nil {
+		log.Printf("webhook %s: %v", eventType, err)
+		return
+	}
+	go s.webhooks.deliver(hook, id, key, body)
+}
+
+func (h *webhookSender) deliver(hook webhook, id string, key, body []byte) {
+	client := h.client
+	switch {
+	case hook.public:
+		client = publicWebhookClient
+	case client == nil:
+		client = &http.Client{Timeout: webhookTimeout}
+	}
+	var err error
+	for attempt := 0; attempt < webhookAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(webhookBackoff[min(attempt-1, len(webhookBackoff)-1)])
+		}
+		if err = h.post(client, hook.url, id, key, body); err == nil {
+			return
+		}
+	}
+	log.Printf("webhook %s to %s failed after %d attempts: %v", id, hook.url, webhookAttempts, err)
+}
+
+func (h *webhookSender) post(client *http.Client, url, id string, key, body []byte) error {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s.%s.%s", id, ts, body)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("webhook-id", id)
+	req.Header.Set("webhook-timestamp", ts)
+	req.Header.Set("webhook-signature", "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+func failedResponse(id, model string, createdAt int64, upstream map[string]any) map[string]any {
+	failed := responseObject(id, model, createdAt, "failed", []any{})
+	failed["error"] = upstream
+	return failed
+}
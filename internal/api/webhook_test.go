@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/proxy"
+)
+
+func TestWebhookIsSignedAndSentOnCompletion(t *testing.T) {
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan delivery, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- delivery{r.Header, body}
+	}))
+	defer receiver.Close()
+
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &streamingTestAdapter{model: "m2"}))
+	s.SetWebhookSecret("whsec_" + base64.StdEncoding.EncodeToString([]byte("secret")))
+	s.SetWebhookAllowHosts([]string{"127.0.0.1"})
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader([]byte(`{"model":"m1","input":"hi"}`)))
+	r.Header.Set(WebhookHeader, receiver.URL)
+	w := httptest.NewRecorder()
+	s.CreateResponse(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+
+	var d delivery
+	select {
+	case d = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(d.header.Get("webhook-id") + "." + d.header.Get("webhook-timestamp") + "."))
+	mac.Write(d.body)
+	if want := "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil)); d.header.Get("webhook-signature") != want {
+		t.Fatalf("signature %q, want %q", d.header.Get("webhook-signature"), want)
+	}
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			ID       string         `json:"id"`
+			Response map[string]any `json:"response"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(d.body, &event); err != nil {
+		t.Fatal(err)
+	}
+	var created map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if event.Type != "response.completed" || event.Data.ID != created["id"] || event.Data.Response["status"] != "completed" {
+		t.Fatalf("unexpected event %s", d.body)
+	}
+}
+
+func TestWebhookHeaderNeedsSecret(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &streamingTestAdapter{model: "m2"}))
+	r := httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader([]byte(`{"model":"m1","input":"hi"}`)))
+	r.Header.Set(WebhookHeader, "https://example.com/hook")
+	w := httptest.NewRecorder()
+	s.CreateResponse(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a webhook secret, got %d", w.Code)
+	}
+}
+
+func TestWebhookHeaderMustBePublic(t *testing.T) {
+	s := NewServer(proxy.NewRouter(&streamingTestAdapter{model: "m1"}, &streamingTestAdapter{model: "m2"}))
+	s.SetWebhookSecret("secret")
+	for _, hook := range []string{"http://127.0.0.1:8080/hook", "http://169.254.169.254/latest/meta-data/", "http://[::1]/hook", "http://10.1.2.3/hook", "http://localhost/hook"} {
+		r := httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader([]byte(`{"model":"m1","input":"hi"}`)))
+		r.Header.Set(WebhookHeader, hook)
+		w := httptest.NewRecorder()
+		s.CreateResponse(w, r)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "not a public address") {
+			t.Fatalf("%s: got %d %s, want 400", hook, w.Code, w.Body)
+		}
+	}
+}
+
+func TestPublicWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("the webhook reached a loopback address")
+	}))
+	defer receiver.Close()
+	// A name that passed checkPublicHost may resolve elsewhere when the
+	// delivery connects.
+	_, err := newPublicClient().Post(receiver.URL, "application/json", strings.NewReader("{}"))
+	if err == nil || !strings.Contains(err.Error(), "is not public") {
+		t.Fatalf("err = %v, want the loopback address refused", err)
+	}
+}
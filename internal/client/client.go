@@ -0,0 +1,230 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type Client struct {
+	BaseURL string
+	APIKey  string
+	HTTP    *http.Client
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    http.DefaultClient,
+	}
+}
+
+func LocalBaseURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+type Model struct {
+	ID      string `json:"id"`
+	OwnedBy string `json:"owned_by"`
+	// ContextWindow is 0 when the proxy does not know it.
+	ContextWindow int `json:"context_window,omitempty"`
+	// BaseModel is the model an alias or virtual model runs.
+	BaseModel string `json:"base_model,omitempty"`
+}
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func (c *Client) ListModels(ctx context.Context) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/v1/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
+	var out struct {
+		Data []Model `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode model list: %w", err)
+	}
+	return out.Data, nil
+}
+
+func (c *Client) ChatStream(ctx context.Context, model string, messages []Message, onDelta func(string) error) (string, error) {
+	resp, err := c.postStream(ctx, "/v1/chat/completions", map[string]any{
+		"model":    model,
+		"messages": messages,
+		"stream":   true,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out strings.Builder
+	err = readEvents(resp.Body, func(payload string) error {
+		var chunk struct {
+			Error *struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			return nil
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("%s: %s", chunk.Error.Type, chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			out.WriteString(choice.Delta.Content)
+			if onDelta != nil {
+				if err := onDelta(choice.Delta.Content); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return out.String(), err
+}
+
+// ResponsesStream streams a /v1/responses turn for input, calling onDelta
+// with each output text delta, and returns the whole output.
+func (c *Client) ResponsesStream(ctx context.Context, model string, input string, onDelta func(string) error) (string, error) {
+	resp, err := c.postStream(ctx, "/v1/responses", map[string]any{
+		"model":  model,
+		"input":  input,
+		"stream": true,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out strings.Builder
+	err = readEvents(resp.Body, func(payload string) error {
+		var ev struct {
+			Type  string `json:"type"`
+			Delta string `json:"delta"`
+			Error *struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+			return nil
+		}
+		switch ev.Type {
+		case "error":
+			if ev.Error != nil {
+				return fmt.Errorf("%s: %s", ev.Error.Type, ev.Error.Message)
+			}
+			return errors.New("stream reported an error")
+		case "response.output_text.delta":
+			out.WriteString(ev.Delta)
+			if onDelta != nil && ev.Delta != "" {
+				return onDelta(ev.Delta)
+			}
+		}
+		return nil
+	})
+	return out.String(), err
+}
+
+func (c *Client) postStream(ctx context.Context, path string, payload any) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, decodeError(resp)
+	}
+	return resp, nil
+}
+
+// readEvents calls handle with the data of each SSE event in r until
+// [DONE], stopping early when handle fails.
+func readEvents(r io.Reader, handle func(payload string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		payload := strings.TrimPrefix(line, "data: ")
+		if payload == "[DONE]" {
+			return nil
+		}
+		if err := handle(payload); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("stream ended without [DONE]")
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	return c.HTTP.Do(req)
+}
+
+func decodeError(resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var body struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(raw, &body) == nil && body.Error.Message != "" {
+		return fmt.Errorf("%s (%d): %s", body.Error.Type, resp.StatusCode, body.Error.Message)
+	}
+	return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChatStreamCollectsDeltasUntilDone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hello\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	var deltas []string
+	text, err := New(srv.URL).ChatStream(context.Background(), "m1", []Message{{Role: "user", Content: "hi"}}, func(d string) error {
+		deltas = append(deltas, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if text != "hello world" || len(deltas) != 2 {
+		t.Fatalf("unexpected stream result %q (%d deltas)", text, len(deltas))
+	}
+}
+
+func TestChatStreamSurfacesErrorEvent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"object\":\"error\",\"error\":{\"type\":\"upstream_error\",\"message\":\"boom\"}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL).ChatStream(context.Background(), "m1", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected upstream error, got %v", err)
+	}
+}
+
+func TestResponsesStreamCollectsOutputDeltas(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/responses" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		fmt.Fprint(w, "data: {\"type\":\"response.created\"}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"response.reasoning_text.delta\",\"delta\":\"hmm\"}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"hello\"}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\" world\"}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	text, err := New(srv.URL).ResponsesStream(context.Background(), "m1", "hi", nil)
+	if err != nil || text != "hello world" {
+		t.Fatalf("ResponsesStream = %q, %v", text, err)
+	}
+}
+
+func TestLocalBaseURL(t *testing.T) {
+	cases := map[string]string{
+		":8080":          "http://127.0.0.1:8080",
+		"0.0.0.0:9000":   "http://127.0.0.1:9000",
+		"localhost:8080": "http://localhost:8080",
+	}
+	for addr, want := range cases {
+		if got := LocalBaseURL(addr); got != want {
+			t.Fatalf("LocalBaseURL(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
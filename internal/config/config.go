@@ -0,0 +1,1144 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Auth Auth `json:"auth"`
+	// Pricing maps model IDs to list prices used for cost estimates; the
+	// subscription CLIs never report a real cost.
+	Pricing map[string]ModelPrice `json:"pricing,omitempty"`
+	Claude  Claude                `json:"claude,omitempty"`
+	Codex   Codex                 `json:"codex,omitempty"`
+	History History               `json:"history,omitempty"`
+	Limits  Limits                `json:"limits,omitempty"`
+	// Races defines virtual models that send each request to several models at
+	// once and stream whichever answers first.
+	Races map[string][]string `json:"races,omitempty"`
+	Auto  *Auto               `json:"auto,omitempty"`
+	// VirtualModels are model IDs that run a base model with a fixed system
+	// prompt and output cap, e.g. a team's "commit-writer".
+	VirtualModels map[string]VirtualModel `json:"virtual_models,omitempty"`
+	// Pipelines are model IDs that run several models in turn, each
+	// refining the previous one's draft.
+	Pipelines map[string][]PipelineStep `json:"pipelines,omitempty"`
+	BestOfN   BestOfN                   `json:"best_of_n,omitempty"`
+	// Profiles are isolated backend setups (binaries, HOME, env) served by the
+	// same proxy, e.g. one per subscription. Keys pick one with "profile".
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+	// Server tunes the HTTP server; it is read at startup only.
+	Server Server `json:"server,omitempty"`
+	// Store persists conversations and responses across restarts; it is read
+	// at startup only.
+	Store    *Store   `json:"store,omitempty"`
+	Webhooks Webhooks `json:"webhooks,omitempty"`
+	// AccessLog writes a line per HTTP request; it is read at startup only.
+	AccessLog     *AccessLog    `json:"access_log,omitempty"`
+	UpstreamDumps UpstreamDumps `json:"upstream_dumps,omitempty"`
+	Discovery     Discovery     `json:"discovery,omitempty"`
+	Streaming     Streaming     `json:"streaming,omitempty"`
+	Permissions   Permissions   `json:"permissions,omitempty"`
+	QuietHours    *QuietHours   `json:"quiet_hours,omitempty"`
+	// ProcessLimits caps the memory, CPU time and open files of each CLI
+	// process (Linux only).
+	ProcessLimits ProcessLimits `json:"process_limits,omitempty"`
+	// DeprecatedModels maps retired or renamed model IDs to what clients
+	// asking for them should be told and, with ReplacedBy, served instead.
+	DeprecatedModels map[string]DeprecatedModel `json:"deprecated_models,omitempty"`
+	// Shadow maps model IDs to a model a share of their requests is also
+	// sent to in the background, to try it on real traffic.
+	Shadow map[string]Shadow `json:"shadow,omitempty"`
+	// Tokenizers picks how tokens are counted for usage and budgets when
+	// the CLIs report none.
+	Tokenizers Tokenizers `json:"tokenizers,omitempty"`
+	// ContextWindows catches prompts too long for their model before they
+	// reach the CLI.
+	ContextWindows ContextWindows `json:"context_windows,omitempty"`
+}
+
+// VirtualModel runs Model, any model ID the proxy serves except another
+// virtual model, with SystemPrompt ahead of the client's messages. MaxTokens
+// cuts answers off after about that many tokens, reported as finish_reason
+// "length". Temperature is only there to be refused: neither CLI takes
+// sampling parameters.
+type VirtualModel struct {
+	Model        string   `json:"model"`
+	SystemPrompt string   `json:"system_prompt,omitempty"`
+	MaxTokens    int      `json:"max_tokens,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+}
+
+// PipelineStep is one model of a pipeline, any model ID the proxy serves
+// except another pipeline. Prompt replaces the client's messages for the
+// step, with {{input}} standing for the client's prompt and {{draft}} for
+// the previous step's answer; steps after the first default to a generic
+// "improve the draft" prompt.
+type PipelineStep struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt,omitempty"`
+}
+
+// BestOfN configures the best_of_n request extension. JudgeModel picks the
+// winning sample; empty means the model the request ran on. Max caps n (5
+// when zero).
+type BestOfN struct {
+	JudgeModel string `json:"judge_model,omitempty"`
+	Max        int    `json:"max,omitempty"`
+}
+
+// DeprecatedModel marks a model ID as deprecated. With ReplacedBy set,
+// requests for it run ReplacedBy instead; either way the response carries
+// a Warning header with Message, or a default one.
+type DeprecatedModel struct {
+	ReplacedBy string `json:"replaced_by,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// Shadow mirrors Percent of the requests for a model to Model. The shadow
+// answers are logged and compared with the real ones, never returned.
+type Shadow struct {
+	Model   string  `json:"model"`
+	Percent float64 `json:"percent"`
+}
+
+// Tokenizers maps encoding names to tiktoken rank files, such as
+// cl100k_base.tiktoken, and models to the encoding that counts their
+// tokens: by exact ID or glob pattern, else Default. "heuristic", a token
+// per 4 characters, and the bundled "cl100k_base" and "o200k_base" need no
+// file; "heuristic" is the default.
+type Tokenizers struct {
+	Encodings map[string]string `json:"encodings,omitempty"`
+	Models    map[string]string `json:"models,omitempty"`
+	Default   string            `json:"default,omitempty"`
+}
+
+// ContextWindows maps model IDs or glob patterns to their context window in
+// tokens, of which ReserveTokens are kept for the answer. A prompt that does
+// not fit is refused, or with Overflow "truncate" a chat loses its oldest
+// messages until it does.
+type ContextWindows struct {
+	Models        map[string]int `json:"models,omitempty"`
+	ReserveTokens int            `json:"reserve_tokens,omitempty"`
+	Overflow      string         `json:"overflow,omitempty"`
+}
+
+// Discovery tunes how the CLIs are found and checked at startup.
+type Discovery struct {
+	// SearchDirs are searched for claude and codex, before the usual
+	// install locations, when they are not on PATH.
+	SearchDirs []string `json:"search_dirs,omitempty"`
+	// SkipVersionCheck skips running each CLI's --version at startup.
+	SkipVersionCheck bool `json:"skip_version_check,omitempty"`
+}
+
+// AccessLog configures the access log. Path "-" writes to stdout. A file is
+// rotated once it grows past MaxSizeMB (100 when zero) or, with RotateEvery,
+// once it has been written to for that long. Rotated files are deleted past
+// MaxBackups (5 when zero), once older than MaxAge, and oldest first while
+// the log takes more than MaxTotalMB.
+type AccessLog struct {
+	Path string `json:"path"`
+	// Format is "combined" (the default) or "json".
+	Format      string   `json:"format,omitempty"`
+	MaxSizeMB   int      `json:"max_size_mb,omitempty"`
+	RotateEvery Duration `json:"rotate_every,omitempty"`
+	MaxBackups  int      `json:"max_backups,omitempty"`
+	MaxAge      Duration `json:"max_age,omitempty"`
+	MaxTotalMB  int      `json:"max_total_mb,omitempty"`
+}
+
+// UpstreamDumps caps the files written by --debug-upstream: dumps older
+// than MaxAge are deleted, then the oldest while there are more than
+// MaxFiles or they take more than MaxTotalMB. Zero values keep the
+// defaults of a week, 1000 files and 1024 MB.
+type UpstreamDumps struct {
+	MaxAge     Duration `json:"max_age,omitempty"`
+	MaxFiles   int      `json:"max_files,omitempty"`
+	MaxTotalMB int      `json:"max_total_mb,omitempty"`
+}
+
+// Webhooks holds the secret used to sign webhook deliveries. A "whsec_"
+// prefixed secret is base64 after the prefix, as in Standard Webhooks.
+// AllowHosts lists the hosts a webhook URL sent with a request may use even
+// when they resolve to a private, loopback or link-local address.
+type Webhooks struct {
+	Secret     string   `json:"secret,omitempty"`
+	SecretEnv  string   `json:"secret_env,omitempty"`
+	AllowHosts []string `json:"allow_hosts,omitempty"`
+}
+
+func (w Webhooks) SigningSecret() string {
+	if w.Secret != "" {
+		return w.Secret
+	}
+	if w.SecretEnv != "" {
+		return strings.TrimSpace(os.Getenv(w.SecretEnv))
+	}
+	return ""
+}
+
+// Store configures the SQLite conversation store. TTL is how long idle
+// conversations and stored responses are kept; zero means 30 days.
+type Store struct {
+	Path string   `json:"path"`
+	TTL  Duration `json:"ttl,omitempty"`
+}
+
+// Server holds HTTP server knobs. Zero values keep llm-proxy's defaults; the
+// write timeout defaults to none since streams can run for many minutes.
+type Server struct {
+	ReadHeaderTimeout Duration `json:"read_header_timeout,omitempty"`
+	ReadTimeout       Duration `json:"read_timeout,omitempty"`
+	WriteTimeout      Duration `json:"write_timeout,omitempty"`
+	IdleTimeout       Duration `json:"idle_timeout,omitempty"`
+	MaxHeaderBytes    int      `json:"max_header_bytes,omitempty"`
+	// H2C serves HTTP/2 over cleartext alongside HTTP/1.1.
+	H2C bool `json:"h2c,omitempty"`
+}
+
+// Duration is a time.Duration written as a Go duration string ("30s", "2m").
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type Profile struct {
+	ClaudeBin string `json:"claude_bin,omitempty"`
+	CodexBin  string `json:"codex_bin,omitempty"`
+	// Home is used as HOME (and on Windows USERPROFILE) for both CLIs, so
+	// each profile keeps its own ~/.claude and ~/.codex logins.
+	Home string            `json:"home,omitempty"`
+	Env  map[string]string `json:"env,omitempty"`
+}
+
+// Environ returns the profile's environment overrides as KEY=VALUE entries.
+func (p Profile) Environ() []string {
+	var env []string
+	if p.Home != "" {
+		env = append(env, "HOME="+p.Home)
+		if runtime.GOOS == "windows" {
+			env = append(env, "USERPROFILE="+p.Home)
+		}
+	}
+	return append(env, environ(p.Env)...)
+}
+
+// environ returns vars as KEY=VALUE entries, sorted by key.
+func environ(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	env := make([]string, 0, len(keys))
+	for _, k := range keys {
+		env = append(env, k+"="+vars[k])
+	}
+	return env
+}
+
+func validateEnv(field string, vars map[string]string) error {
+	for k := range vars {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			return fmt.Errorf("%s: invalid variable name %q", field, k)
+		}
+	}
+	return nil
+}
+
+// History bounds the chat history sent to the CLIs: system messages plus the
+// most recent turns within both limits. With SummaryModel set, dropped turns
+// are summarized by that model instead of discarded outright.
+type History struct {
+	MaxMessages  int    `json:"max_messages,omitempty"`
+	MaxChars     int    `json:"max_chars,omitempty"`
+	SummaryModel string `json:"summary_model,omitempty"`
+}
+
+// Auto enables the "auto" virtual model: the first rule whose conditions all
+// hold picks the model, else Default.
+type Auto struct {
+	Default string     `json:"default"`
+	Rules   []AutoRule `json:"rules,omitempty"`
+}
+
+type AutoRule struct {
+	Model    string   `json:"model"`
+	MinChars int      `json:"min_chars,omitempty"`
+	MaxChars int      `json:"max_chars,omitempty"`
+	Keywords []string `json:"keywords,omitempty"`
+	Efforts  []string `json:"efforts,omitempty"`
+}
+
+// Limits caps backend concurrency. Requests over MaxConcurrent wait in a
+// queue; zero means unlimited.
+type Limits struct {
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+	// CoalesceIdentical runs one upstream turn for identical concurrent
+	// requests and streams it to all of them.
+	CoalesceIdentical bool `json:"coalesce_identical,omitempty"`
+	// UserRequestsPerMinute caps each end user, named by the request's
+	// `user` field, per API key; zero means no cap.
+	UserRequestsPerMinute int `json:"user_requests_per_minute,omitempty"`
+	// MaxPromptTokens rejects requests whose estimated prompt is larger, and
+	// MaxRequestCostUSD ones whose prompt would cost more at the model's
+	// list price; zero means no cap.
+	MaxPromptTokens   int     `json:"max_prompt_tokens,omitempty"`
+	MaxRequestCostUSD float64 `json:"max_request_cost_usd,omitempty"`
+	// LoopRepeats refuses a key's request once it has sent the same one
+	// this many times within a minute; LoopToolCalls once a conversation
+	// ends with the same tool call this many times. Zero disables either.
+	LoopRepeats   int `json:"loop_repeats,omitempty"`
+	LoopToolCalls int `json:"loop_tool_calls,omitempty"`
+}
+
+// QuietHours holds batch traffic (keys or requests with priority "batch")
+// back during Windows, to save subscription quota for working hours. Action
+// "queue" (the default) keeps batch requests waiting until the window ends,
+// "reject" fails them with a 503 and Retry-After. Interactive requests are
+// never held.
+type QuietHours struct {
+	Windows []QuietWindow `json:"windows"`
+	Action  string        `json:"action,omitempty"`
+	// Timezone is an IANA zone name for the windows; empty means the
+	// proxy's local time.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// QuietWindow runs from Start to End, both "HH:MM"; an End before Start
+// runs past midnight. Days ("mon" to "sun") are the days the window starts
+// on; empty means every day.
+type QuietWindow struct {
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+	Days  []string `json:"days,omitempty"`
+}
+
+// Location returns the time zone the windows are in.
+func (q QuietHours) Location() (*time.Location, error) {
+	if q.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(q.Timezone)
+}
+
+// Minutes returns Start and End as minutes after midnight.
+func (w QuietWindow) Minutes() (start, end int, err error) {
+	if start, err = parseClock(w.Start); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseClock(w.End); err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// Weekdays returns Days, or every day when Days is empty.
+func (w QuietWindow) Weekdays() ([]time.Weekday, error) {
+	if len(w.Days) == 0 {
+		return []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}, nil
+	}
+	out := make([]time.Weekday, 0, len(w.Days))
+	for _, d := range w.Days {
+		day, ok := weekdays[strings.ToLower(strings.TrimSpace(d))]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q (want mon, tue, wed, thu, fri, sat or sun)", d)
+		}
+		out = append(out, day)
+	}
+	return out, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (q *QuietHours) validate() error {
+	switch q.Action {
+	case "", "queue", "reject":
+	default:
+		return fmt.Errorf("quiet_hours.action: must be queue or reject, not %q", q.Action)
+	}
+	if _, err := q.Location(); err != nil {
+		return fmt.Errorf("quiet_hours.timezone: %w", err)
+	}
+	if len(q.Windows) == 0 {
+		return errors.New("quiet_hours.windows: at least one window is required")
+	}
+	for i, w := range q.Windows {
+		field := fmt.Sprintf("quiet_hours.windows[%d]", i)
+		start, end, err := w.Minutes()
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		if start == end {
+			return fmt.Errorf("%s: start and end are the same", field)
+		}
+		if _, err := w.Weekdays(); err != nil {
+			return fmt.Errorf("%s.days: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// Streaming shapes streamed responses.
+type Streaming struct {
+	// PartialOnFailure ends a stream whose backend fails after some output
+	// with that output, marked as cut short, instead of an error.
+	PartialOnFailure bool `json:"partial_on_failure,omitempty"`
+	// MaxDuration caps how long a stream's backend may run; a stream that
+	// takes longer ends with what it has, marked incomplete.
+	MaxDuration Duration `json:"max_duration,omitempty"`
+	// OutputFilters clean up answers, streamed or not, before clients get
+	// them.
+	OutputFilters OutputFilters `json:"output_filters,omitempty"`
+	// Compat lists compatibility flags, small changes to the shape of
+	// streamed chunks that some clients rely on, for keys that set none.
+	Compat []string `json:"compat,omitempty"`
+	// DoneWithin is the time budget of the done_within flag, counted from
+	// when the request arrives. It has no default: a config that uses the
+	// flag must set it.
+	DoneWithin Duration `json:"done_within,omitempty"`
+}
+
+// OutputFilters are the output filters to apply. StripANSI removes the
+// terminal escape sequences CLIs sometimes leak, StripPreamble an opening
+// "Sure!", and CodeFences "normalize" tags fenced code blocks with a
+// canonical language and closes them, "strip" removes their fence lines.
+type OutputFilters struct {
+	StripANSI     bool   `json:"strip_ansi,omitempty"`
+	StripPreamble bool   `json:"strip_preamble,omitempty"`
+	CodeFences    string `json:"code_fences,omitempty"`
+}
+
+// ProcessLimits caps each CLI process the proxy starts: MaxMemoryMB its
+// private memory, MaxCPUTime the CPU it may use and MaxOpenFiles its file
+// descriptors. Zero leaves a limit alone. They are rlimits, so they only
+// apply on Linux.
+type ProcessLimits struct {
+	MaxMemoryMB  int      `json:"max_memory_mb,omitempty"`
+	MaxCPUTime   Duration `json:"max_cpu_time,omitempty"`
+	MaxOpenFiles int      `json:"max_open_files,omitempty"`
+}
+
+// Permissions says what happens when a CLI outside YOLO mode asks for
+// permission to use a tool. OnPrompt is "deny" (the default), which refuses
+// the tool and lets the agent carry on, or "fail", which fails the request
+// with a permission_required error. A Claude run silent for StallTimeout
+// (5m when zero) after a tool call is taken to be stuck on a prompt and
+// fails either way.
+type Permissions struct {
+	OnPrompt     string   `json:"on_prompt,omitempty"`
+	StallTimeout Duration `json:"stall_timeout,omitempty"`
+}
+
+// Claude holds extra flags for the `claude` CLI. Models maps model IDs to
+// settings for requests to that model; an entry with Model set defines an
+// alias that is listed as its own model and runs Model.
+type Claude struct {
+	Args   []string               `json:"args,omitempty"`
+	Models map[string]ClaudeModel `json:"models,omitempty"`
+	// TextFallback says when a stream is rerun with plain text output: "on"
+	// (the default) when it fails or yields no text, "on_error" only when it
+	// fails, "off" never.
+	TextFallback string `json:"text_fallback,omitempty"`
+	// MaxTurns caps the agent turns of each run (--max-turns); a model's
+	// own max_turns overrides it. Zero leaves the CLI's default.
+	MaxTurns int `json:"max_turns,omitempty"`
+	// Env is added to the environment of every claude process, e.g.
+	// HTTPS_PROXY or CLAUDE_CONFIG_DIR; a profile's env applies on top.
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// Environ returns Env as KEY=VALUE entries.
+func (c Claude) Environ() []string {
+	return environ(c.Env)
+}
+
+type ClaudeModel struct {
+	Model              string   `json:"model,omitempty"`
+	Args               []string `json:"args,omitempty"`
+	SystemPrompt       string   `json:"system_prompt,omitempty"`
+	AppendSystemPrompt string   `json:"append_system_prompt,omitempty"`
+	// Agents is passed to --agents: a JSON object of agent name to definition
+	// (description, prompt, tools, model).
+	Agents   json.RawMessage `json:"agents,omitempty"`
+	MaxTurns int             `json:"max_turns,omitempty"`
+}
+
+// AgentsJSON returns Agents in compact form, or "" when unset.
+func (m ClaudeModel) AgentsJSON() string {
+	if len(m.Agents) == 0 {
+		return ""
+	}
+	var b bytes.Buffer
+	if err := json.Compact(&b, m.Agents); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+// Codex holds default app-server thread/turn settings; Models overrides them
+// per model ID.
+type Codex struct {
+	CodexTurn
+	Models map[string]CodexTurn `json:"models,omitempty"`
+	// KeepThreads saves Codex threads on disk instead of discarding them, so
+	// /v1/responses follow-ups with tool outputs can continue them.
+	KeepThreads bool `json:"keep_threads,omitempty"`
+	// Env is added to the environment of every codex process, e.g.
+	// HTTPS_PROXY or CODEX_HOME; a profile's env applies on top.
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// Environ returns Env as KEY=VALUE entries.
+func (c Codex) Environ() []string {
+	return environ(c.Env)
+}
+
+type CodexTurn struct {
+	Sandbox        string `json:"sandbox,omitempty"`
+	ApprovalPolicy string `json:"approval_policy,omitempty"`
+	Cwd            string `json:"cwd,omitempty"`
+	Effort         string `json:"effort,omitempty"`
+	WebSearch      *bool  `json:"web_search,omitempty"`
+	// MaxTurns stops a turn at its max_turns-th tool call, as Claude's
+	// --max-turns would.
+	MaxTurns int `json:"max_turns,omitempty"`
+}
+
+func (t CodexTurn) validate(field string) error {
+	switch t.Sandbox {
+	case "", "read-only", "workspace-write", "danger-full-access":
+	default:
+		return fmt.Errorf("%s.sandbox: unknown mode %q", field, t.Sandbox)
+	}
+	switch t.ApprovalPolicy {
+	case "", "untrusted", "on-failure", "on-request", "never":
+	default:
+		return fmt.Errorf("%s.approval_policy: unknown policy %q", field, t.ApprovalPolicy)
+	}
+	switch t.Effort {
+	case "", "none", "minimal", "low", "medium", "high", "xhigh":
+	default:
+		return fmt.Errorf("%s.effort: unknown effort %q", field, t.Effort)
+	}
+	if t.MaxTurns < 0 {
+		return fmt.Errorf("%s.max_turns: must not be negative", field)
+	}
+	if t.Cwd != "" && !filepath.IsAbs(t.Cwd) {
+		return fmt.Errorf("%s.cwd: must be an absolute path", field)
+	}
+	return nil
+}
+
+// reservedClaudeFlags are set by the adapter itself and cannot be overridden.
+var reservedClaudeFlags = []string{"-p", "--print", "--output-format", "--input-format", "--model", "--verbose", "--include-partial-messages"}
+
+type ModelPrice struct {
+	PromptPerMTok     float64 `json:"prompt_per_mtok"`
+	CompletionPerMTok float64 `json:"completion_per_mtok"`
+}
+
+func (p ModelPrice) Cost(promptTokens, completionTokens uint64) float64 {
+	return float64(promptTokens)*p.PromptPerMTok/1e6 + float64(completionTokens)*p.CompletionPerMTok/1e6
+}
+
+type Auth struct {
+	Keys []APIKey `json:"keys"`
+}
+
+type APIKey struct {
+	Name string `json:"name"`
+	// Key holds the literal bearer token; KeyEnv names an environment variable
+	// to read it from so secrets can stay out of the file.
+	Key    string   `json:"key,omitempty"`
+	KeyEnv string   `json:"key_env,omitempty"`
+	Scopes []string `json:"scopes"`
+	// Profile pins the key to one of Config.Profiles.
+	Profile string `json:"profile,omitempty"`
+	// Priority is "interactive" (default) or "batch"; batch requests only run
+	// when no interactive request is waiting.
+	Priority string `json:"priority,omitempty"`
+	// Safety is a preset ("read-only", "workspace-write" or "full") for what
+	// the CLIs may do on this key's requests. It replaces YOLO and the Codex
+	// sandbox and approval settings for them.
+	Safety string `json:"safety,omitempty"`
+	// WebhookURL receives a signed POST when a /v1/responses request made
+	// with this key completes, fails or is cancelled.
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// Models, when set, are the only model IDs the key may use; DenyModels
+	// are refused even if Models matches them. Entries are glob patterns
+	// ("claude-*").
+	Models     []string `json:"models,omitempty"`
+	DenyModels []string `json:"deny_models,omitempty"`
+	// MaxPromptTokens and MaxRequestCostUSD override Limits' for this key.
+	MaxPromptTokens   int     `json:"max_prompt_tokens,omitempty"`
+	MaxRequestCostUSD float64 `json:"max_request_cost_usd,omitempty"`
+	// StreamCompat replaces Streaming.Compat for this key; an empty list
+	// turns the global flags off.
+	StreamCompat []string `json:"stream_compat,omitempty"`
+}
+
+func (k APIKey) Token() string {
+	if k.Key != "" {
+		return k.Key
+	}
+	if k.KeyEnv != "" {
+		return strings.TrimSpace(os.Getenv(k.KeyEnv))
+	}
+	return ""
+}
+
+func DefaultPath() string {
+	if v := strings.TrimSpace(os.Getenv("LLM_PROXY_CONFIG")); v != "" {
+		return v
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "llm-proxy", "config.json")
+}
+
+// InlineEnv holds config JSON applied on top of the config file, for setups
+// such as containers that are configured through the environment. Objects
+// in it merge into the file's; other values replace them.
+const InlineEnv = "LLM_PROXY_CONFIG_JSON"
+
+// Load reads the config at path, then InlineEnv. A missing file is not an
+// error unless the path was given explicitly, so the proxy keeps working with
+// env-only setups.
+func Load(path string, explicit bool) (*Config, error) {
+	cfg := &Config{}
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := decode(raw, cfg); err != nil {
+				return nil, fmt.Errorf("parse config %s: %w", path, err)
+			}
+		case !errors.Is(err, os.ErrNotExist) || explicit:
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+	}
+	if inline := strings.TrimSpace(os.Getenv(InlineEnv)); inline != "" {
+		if err := decode([]byte(inline), cfg); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", InlineEnv, err)
+		}
+		if path == "" {
+			path = InlineEnv
+		} else {
+			path += " + " + InlineEnv
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func decode(raw []byte, cfg *Config) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(cfg)
+}
+
+func (c *Config) validate() error {
+	seen := map[string]bool{}
+	for i, k := range c.Auth.Keys {
+		name := k.Name
+		if name == "" {
+			name = fmt.Sprintf("auth.keys[%d]", i)
+		}
+		if k.Token() == "" {
+			return fmt.Errorf("%s: key is empty (set key or key_env)", name)
+		}
+		if seen[k.Token()] {
+			return fmt.Errorf("%s: duplicate key", name)
+		}
+		seen[k.Token()] = true
+		for _, s := range k.Scopes {
+			if !validScope(s) {
+				return fmt.Errorf("%s: unknown scope %q", name, s)
+			}
+		}
+		if _, ok := c.Profiles[k.Profile]; k.Profile != "" && !ok {
+			return fmt.Errorf("%s: unknown profile %q", name, k.Profile)
+		}
+		switch k.Priority {
+		case "", PriorityInteractive, PriorityBatch:
+		default:
+			return fmt.Errorf("%s: unknown priority %q", name, k.Priority)
+		}
+		switch k.Safety {
+		case "", SafetyReadOnly, SafetyWorkspaceWrite, SafetyFull:
+		default:
+			return fmt.Errorf("%s: unknown safety preset %q", name, k.Safety)
+		}
+		if err := validateCompat(name+": stream_compat", k.StreamCompat, c.Streaming.DoneWithin); err != nil {
+			return err
+		}
+		if k.MaxPromptTokens < 0 || k.MaxRequestCostUSD < 0 {
+			return fmt.Errorf("%s: max_prompt_tokens and max_request_cost_usd must not be negative", name)
+		}
+		for _, patterns := range [][]string{k.Models, k.DenyModels} {
+			for _, m := range patterns {
+				if _, err := path.Match(m, ""); m == "" || err != nil {
+					return fmt.Errorf("%s: invalid model pattern %q", name, m)
+				}
+			}
+		}
+		if k.WebhookURL != "" {
+			if err := ValidateWebhookURL(k.WebhookURL); err != nil {
+				return fmt.Errorf("%s: webhook_url: %w", name, err)
+			}
+			if c.Webhooks.SigningSecret() == "" {
+				return fmt.Errorf("%s: webhook_url needs webhooks.secret or webhooks.secret_env", name)
+			}
+		}
+	}
+	for _, h := range c.Webhooks.AllowHosts {
+		if strings.TrimSpace(h) == "" || strings.Contains(h, "/") {
+			return fmt.Errorf("webhooks.allow_hosts: %q is not a host name or address", h)
+		}
+	}
+	for name, p := range c.Profiles {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("profiles: empty profile name")
+		}
+		if p.Home != "" && !filepath.IsAbs(p.Home) {
+			return fmt.Errorf("profiles.%s.home: must be an absolute path", name)
+		}
+		if err := validateEnv("profiles."+name+".env", p.Env); err != nil {
+			return err
+		}
+	}
+	for model, p := range c.Pricing {
+		if p.PromptPerMTok < 0 || p.CompletionPerMTok < 0 {
+			return fmt.Errorf("pricing.%s: prices must not be negative", model)
+		}
+	}
+	if err := validateClaudeArgs("claude.args", c.Claude.Args); err != nil {
+		return err
+	}
+	if err := validateEnv("claude.env", c.Claude.Env); err != nil {
+		return err
+	}
+	if err := validateEnv("codex.env", c.Codex.Env); err != nil {
+		return err
+	}
+	switch c.Claude.TextFallback {
+	case "", "on", "on_error", "off":
+	default:
+		return fmt.Errorf("claude.text_fallback: must be on, on_error or off, not %q", c.Claude.TextFallback)
+	}
+	if c.Claude.MaxTurns < 0 {
+		return errors.New("claude.max_turns: must not be negative")
+	}
+	for model, m := range c.Claude.Models {
+		if err := validateClaudeArgs("claude.models."+model+".args", m.Args); err != nil {
+			return err
+		}
+		if m.MaxTurns < 0 {
+			return fmt.Errorf("claude.models.%s.max_turns: must not be negative", model)
+		}
+		if len(m.Agents) > 0 {
+			var agents map[string]json.RawMessage
+			if err := json.Unmarshal(m.Agents, &agents); err != nil {
+				return fmt.Errorf("claude.models.%s.agents: must be a JSON object of agent definitions", model)
+			}
+		}
+	}
+	switch c.Permissions.OnPrompt {
+	case "", "deny", "fail":
+	default:
+		return fmt.Errorf("permissions.on_prompt: must be deny or fail, not %q", c.Permissions.OnPrompt)
+	}
+	if c.Permissions.StallTimeout < 0 {
+		return errors.New("permissions.stall_timeout: must not be negative")
+	}
+	if c.Streaming.MaxDuration < 0 {
+		return errors.New("streaming.max_duration: must not be negative")
+	}
+	if c.Streaming.DoneWithin < 0 {
+		return errors.New("streaming.done_within: must not be negative")
+	}
+	if p := c.ProcessLimits; p.MaxMemoryMB < 0 || p.MaxCPUTime < 0 || p.MaxOpenFiles < 0 {
+		return errors.New("process_limits: limits must not be negative")
+	}
+	if c.Limits.UserRequestsPerMinute < 0 {
+		return errors.New("limits.user_requests_per_minute: must not be negative")
+	}
+	if c.Limits.MaxPromptTokens < 0 || c.Limits.MaxRequestCostUSD < 0 {
+		return errors.New("limits: max_prompt_tokens and max_request_cost_usd must not be negative")
+	}
+	if c.Limits.LoopRepeats == 1 || c.Limits.LoopRepeats < 0 || c.Limits.LoopToolCalls == 1 || c.Limits.LoopToolCalls < 0 {
+		return errors.New("limits: loop_repeats and loop_tool_calls must be 0 (off) or at least 2")
+	}
+	if c.History.MaxMessages < 0 || c.History.MaxChars < 0 {
+		return errors.New("history: limits must not be negative")
+	}
+	if c.History.SummaryModel != "" && c.History.MaxMessages == 0 && c.History.MaxChars == 0 {
+		return errors.New("history.summary_model: needs max_messages or max_chars")
+	}
+	for id, models := range c.Races {
+		if len(models) < 2 {
+			return fmt.Errorf("races.%s: needs at least two models", id)
+		}
+		for _, m := range models {
+			if _, nested := c.Races[m]; nested {
+				return fmt.Errorf("races.%s: %s is itself a race", id, m)
+			}
+		}
+	}
+	for id, m := range c.VirtualModels {
+		if strings.TrimSpace(id) == "" {
+			return errors.New("virtual_models: empty model ID")
+		}
+		if strings.TrimSpace(m.Model) == "" {
+			return fmt.Errorf("virtual_models.%s.model: is required", id)
+		}
+		if _, nested := c.VirtualModels[m.Model]; nested {
+			return fmt.Errorf("virtual_models.%s.model: %s is itself a virtual model", id, m.Model)
+		}
+		if m.MaxTokens < 0 {
+			return fmt.Errorf("virtual_models.%s.max_tokens: must not be negative", id)
+		}
+		if m.Temperature != nil {
+			return fmt.Errorf("virtual_models.%s.temperature: not supported, the Claude and Codex CLIs take no sampling parameters", id)
+		}
+	}
+	for id, steps := range c.Pipelines {
+		if len(steps) < 2 {
+			return fmt.Errorf("pipelines.%s: needs at least two steps", id)
+		}
+		for i, step := range steps {
+			if strings.TrimSpace(step.Model) == "" {
+				return fmt.Errorf("pipelines.%s[%d].model: is required", id, i)
+			}
+			if _, nested := c.Pipelines[step.Model]; nested {
+				return fmt.Errorf("pipelines.%s[%d]: %s is itself a pipeline", id, i, step.Model)
+			}
+			if i > 0 && step.Prompt != "" && !strings.Contains(step.Prompt, "{{draft}}") {
+				return fmt.Errorf("pipelines.%s[%d].prompt: must include {{draft}}", id, i)
+			}
+		}
+	}
+	if c.BestOfN.Max < 0 {
+		return errors.New("best_of_n.max: must not be negative")
+	}
+	if c.Auto != nil {
+		if err := c.Auto.validate(); err != nil {
+			return err
+		}
+	}
+	if c.QuietHours != nil {
+		if err := c.QuietHours.validate(); err != nil {
+			return err
+		}
+	}
+	for id, d := range c.DeprecatedModels {
+		if strings.TrimSpace(id) == "" {
+			return errors.New("deprecated_models: empty model ID")
+		}
+		if d.ReplacedBy == id {
+			return fmt.Errorf("deprecated_models.%s.replaced_by: redirects to itself", id)
+		}
+		if _, chained := c.DeprecatedModels[d.ReplacedBy]; chained {
+			return fmt.Errorf("deprecated_models.%s.replaced_by: %s is itself deprecated", id, d.ReplacedBy)
+		}
+	}
+	for id, sh := range c.Shadow {
+		switch {
+		case strings.TrimSpace(id) == "":
+			return errors.New("shadow: empty model ID")
+		case strings.TrimSpace(sh.Model) == "":
+			return fmt.Errorf("shadow.%s.model: is required", id)
+		case sh.Model == id:
+			return fmt.Errorf("shadow.%s.model: shadows itself", id)
+		case sh.Percent <= 0 || sh.Percent > 100:
+			return fmt.Errorf("shadow.%s.percent: must be above 0 and at most 100", id)
+		}
+	}
+	for name, file := range c.Tokenizers.Encodings {
+		switch {
+		case strings.TrimSpace(name) == "" || name == TokenizerHeuristic:
+			return fmt.Errorf("tokenizers.encodings: invalid encoding name %q", name)
+		case strings.TrimSpace(file) == "":
+			return fmt.Errorf("tokenizers.encodings.%s: a tiktoken file is required", name)
+		}
+	}
+	encoding := func(name string) bool {
+		_, ok := c.Tokenizers.Encodings[name]
+		return ok || name == TokenizerHeuristic || name == TokenizerCl100k || name == TokenizerO200k
+	}
+	for model, name := range c.Tokenizers.Models {
+		if _, err := path.Match(model, ""); strings.TrimSpace(model) == "" || err != nil {
+			return fmt.Errorf("tokenizers.models: invalid model pattern %q", model)
+		}
+		if !encoding(name) {
+			return fmt.Errorf("tokenizers.models.%s: unknown encoding %q", model, name)
+		}
+	}
+	if d := c.Tokenizers.Default; d != "" && !encoding(d) {
+		return fmt.Errorf("tokenizers.default: unknown encoding %q", d)
+	}
+	switch c.Streaming.OutputFilters.CodeFences {
+	case "", CodeFencesNormalize, CodeFencesStrip:
+	default:
+		return fmt.Errorf("streaming.output_filters.code_fences: unknown mode %q", c.Streaming.OutputFilters.CodeFences)
+	}
+	if err := validateCompat("streaming.compat", c.Streaming.Compat, c.Streaming.DoneWithin); err != nil {
+		return err
+	}
+	switch c.ContextWindows.Overflow {
+	case "", OverflowReject, OverflowTruncate:
+	default:
+		return fmt.Errorf("context_windows.overflow: unknown overflow %q", c.ContextWindows.Overflow)
+	}
+	if c.ContextWindows.ReserveTokens < 0 {
+		return errors.New("context_windows.reserve_tokens: must not be negative")
+	}
+	for model, window := range c.ContextWindows.Models {
+		if _, err := path.Match(model, ""); strings.TrimSpace(model) == "" || err != nil {
+			return fmt.Errorf("context_windows.models: invalid model pattern %q", model)
+		}
+		if window <= c.ContextWindows.ReserveTokens {
+			return fmt.Errorf("context_windows.models.%s: must be more than reserve_tokens", model)
+		}
+	}
+	if c.Server.ReadHeaderTimeout < 0 || c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 {
+		return errors.New("server: timeouts must not be negative")
+	}
+	if c.Server.MaxHeaderBytes < 0 {
+		return errors.New("server.max_header_bytes: must not be negative")
+	}
+	if c.Store != nil {
+		if strings.TrimSpace(c.Store.Path) == "" {
+			return errors.New("store.path: is required")
+		}
+		if c.Store.TTL < 0 {
+			return errors.New("store.ttl: must not be negative")
+		}
+	}
+	if c.AccessLog != nil {
+		if strings.TrimSpace(c.AccessLog.Path) == "" {
+			return errors.New("access_log.path: is required")
+		}
+		if c.AccessLog.Format != "" && c.AccessLog.Format != "combined" && c.AccessLog.Format != "json" {
+			return fmt.Errorf("access_log.format: unknown format %q (want combined or json)", c.AccessLog.Format)
+		}
+		a := c.AccessLog
+		if a.MaxSizeMB < 0 || a.MaxBackups < 0 || a.MaxTotalMB < 0 || a.RotateEvery < 0 || a.MaxAge < 0 {
+			return errors.New("access_log: sizes, counts and durations must not be negative")
+		}
+	}
+	if d := c.UpstreamDumps; d.MaxAge < 0 || d.MaxFiles < 0 || d.MaxTotalMB < 0 {
+		return errors.New("upstream_dumps: limits must not be negative")
+	}
+	if c.Limits.MaxConcurrent < 0 {
+		return errors.New("limits.max_concurrent: must not be negative")
+	}
+	if err := c.Codex.CodexTurn.validate("codex"); err != nil {
+		return err
+	}
+	for model, t := range c.Codex.Models {
+		if err := t.validate("codex.models." + model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Auto) validate() error {
+	if strings.TrimSpace(a.Default) == "" {
+		return errors.New("auto.default: model is required")
+	}
+	if a.Default == "auto" {
+		return errors.New("auto.default: cannot route to auto")
+	}
+	for i, r := range a.Rules {
+		field := fmt.Sprintf("auto.rules[%d]", i)
+		if strings.TrimSpace(r.Model) == "" {
+			return fmt.Errorf("%s.model: model is required", field)
+		}
+		if r.Model == "auto" {
+			return fmt.Errorf("%s.model: cannot route to auto", field)
+		}
+		if r.MinChars < 0 || r.MaxChars < 0 {
+			return fmt.Errorf("%s: char limits must not be negative", field)
+		}
+		if r.MaxChars > 0 && r.MinChars > r.MaxChars {
+			return fmt.Errorf("%s: min_chars exceeds max_chars", field)
+		}
+		for _, e := range r.Efforts {
+			switch e {
+			case "none", "minimal", "low", "medium", "high", "xhigh":
+			default:
+				return fmt.Errorf("%s.efforts: unknown effort %q", field, e)
+			}
+		}
+	}
+	return nil
+}
+
+func validateClaudeArgs(field string, args []string) error {
+	for _, arg := range args {
+		if strings.TrimSpace(arg) == "" {
+			return fmt.Errorf("%s: empty argument", field)
+		}
+		name, _, _ := strings.Cut(arg, "=")
+		for _, reserved := range reservedClaudeFlags {
+			if name == reserved {
+				return fmt.Errorf("%s: %s is managed by llm-proxy", field, reserved)
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	ScopeAll       = "*"
+	ScopeModels    = "models"
+	ScopeChat      = "chat"
+	ScopeResponses = "responses"
+	ScopeYOLO      = "yolo"
+	ScopeAdmin     = "admin"
+)
+
+const (
+	PriorityInteractive = "interactive"
+	PriorityBatch       = "batch"
+)
+
+const (
+	CodeFencesNormalize = "normalize"
+	CodeFencesStrip     = "strip"
+)
+
+// Compatibility flags. CompatFirstChunkContent adds an empty content to
+// the role in the first chunk of a chat completions stream,
+// CompatNoRedirects serves a request for a path that is not clean, such as
+// /v1//chat/completions, at the clean path instead of redirecting it there,
+// and CompatDoneWithin ends a chat completions stream, cut short if need
+// be, within Streaming.DoneWithin.
+const (
+	CompatFirstChunkContent = "first_chunk_content"
+	CompatNoRedirects       = "no_redirects"
+	CompatDoneWithin        = "done_within"
+)
+
+// validateCompat checks flags, which need a done_within budget when they
+// include done_within.
+func validateCompat(field string, flags []string, doneWithin Duration) error {
+	for _, f := range flags {
+		switch f {
+		case CompatFirstChunkContent, CompatNoRedirects:
+		case CompatDoneWithin:
+			if doneWithin == 0 {
+				return fmt.Errorf("%s: done_within needs streaming.done_within", field)
+			}
+		default:
+			return fmt.Errorf("%s: unknown compatibility flag %q", field, f)
+		}
+	}
+	return nil
+}
+
+const (
+	OverflowReject   = "reject"
+	OverflowTruncate = "truncate"
+)
+
+// TokenizerHeuristic is the encoding that counts a token per 4 characters.
+const TokenizerHeuristic = "heuristic"
+
+// The encodings the proxy bundles, usable without a file.
+const (
+	TokenizerCl100k = "cl100k_base"
+	TokenizerO200k  = "o200k_base"
+)
+
+const (
+	SafetyReadOnly       = "read-only"
+	SafetyWorkspaceWrite = "workspace-write"
+	SafetyFull           = "full"
+)
+
+func validScope(s string) bool {
+	switch s {
+	case ScopeAll, ScopeModels, ScopeChat, ScopeResponses, ScopeYOLO, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// ValidateWebhookURL accepts absolute http and https URLs.
+func ValidateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// LookupModel returns the entry of m for model: the one for its exact ID,
+// else for the longest glob pattern that matches it.
+func LookupModel[T any](m map[string]T, model string) (T, bool) {
+	if v, ok := m[model]; ok {
+		return v, true
+	}
+	best, found := "", false
+	for p := range m {
+		if found && (len(p) < len(best) || len(p) == len(best) && p > best) {
+			continue
+		}
+		if ok, _ := path.Match(p, model); ok {
+			best, found = p, true
+		}
+	}
+	if !found {
+		var zero T
+		return zero, false
+	}
+	return m[best], true
+}
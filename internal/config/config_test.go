@@ -0,0 +1,293 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadMissingFileIsOnlyAnErrorWhenExplicit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.json")
+	if _, err := Load(path, false); err != nil {
+		t.Fatalf("expected implicit missing config to be ignored, got %v", err)
+	}
+	if _, err := Load(path, true); err == nil {
+		t.Fatalf("expected explicit missing config to fail")
+	}
+}
+
+func TestLoadAppliesInlineConfigFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	body := `{"limits":{"max_concurrent":2},"races":{"fast":["haiku","gpt-5"]}}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(InlineEnv, `{"limits":{"max_concurrent":8},"races":{"best":["opus","gpt-5"]}}`)
+	cfg, err := Load(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Limits.MaxConcurrent != 8 || len(cfg.Races) != 2 {
+		t.Fatalf("expected env config merged over the file, got %+v %v", cfg.Limits, cfg.Races)
+	}
+
+	t.Setenv(InlineEnv, `{"limits":{"max_concurrent":-1}}`)
+	if _, err := Load("", false); err == nil || !strings.Contains(err.Error(), InlineEnv) {
+		t.Fatalf("expected invalid env config to be reported against %s, got %v", InlineEnv, err)
+	}
+}
+
+func TestLoadRejectsUnknownScope(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	body := `{"auth":{"keys":[{"name":"ide","key":"sk-1","scopes":["chat","root"]}]}}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(path, true)
+	if err == nil || !strings.Contains(err.Error(), `unknown scope "root"`) {
+		t.Fatalf("expected unknown scope error, got %v", err)
+	}
+}
+
+func TestAPIKeyTokenFromEnv(t *testing.T) {
+	t.Setenv("TEST_LLM_PROXY_KEY", " sk-env ")
+	k := APIKey{KeyEnv: "TEST_LLM_PROXY_KEY"}
+	if got := k.Token(); got != "sk-env" {
+		t.Fatalf("unexpected token %q", got)
+	}
+}
+
+func TestLoadRejectsReservedClaudeFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	body := `{"claude":{"args":["--max-turns","3"],"models":{"sonnet":{"args":["--model=opus"]}}}}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(path, true)
+	if err == nil || !strings.Contains(err.Error(), "claude.models.sonnet.args: --model is managed by llm-proxy") {
+		t.Fatalf("expected reserved flag error, got %v", err)
+	}
+}
+
+func TestLoadRejectsKeyWithUnknownProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	body := `{"profiles":{"work":{"home":"/home/me/work"}},"auth":{"keys":[{"name":"ide","key":"sk-1","scopes":["*"],"profile":"personal"}]}}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(path, true)
+	if err == nil || !strings.Contains(err.Error(), `unknown profile "personal"`) {
+		t.Fatalf("expected unknown profile error, got %v", err)
+	}
+}
+
+func TestLoadRejectsUnknownSafetyPreset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	body := `{"auth":{"keys":[{"name":"ide","key":"sk-1","scopes":["*"],"safety":"yolo"}]}}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(path, true)
+	if err == nil || !strings.Contains(err.Error(), `ide: unknown safety preset "yolo"`) {
+		t.Fatalf("expected unknown safety preset error, got %v", err)
+	}
+}
+
+func TestLoadRejectsNegativeStreamDuration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"streaming":{"max_duration":"-1m"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, true); err == nil || !strings.Contains(err.Error(), "streaming.max_duration: must not be negative") {
+		t.Fatalf("expected negative duration error, got %v", err)
+	}
+}
+
+// loadErr loads body as the config file and returns Load's error.
+func loadErr(t *testing.T, body string) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(path, true)
+	return err
+}
+
+func TestLoadValidates(t *testing.T) {
+	tests := []struct {
+		body string
+		want string // a substring of the error; empty for a valid config
+	}{
+		{`{"shadow":{"sonnet":{"percent":10}}}`, "shadow.sonnet.model: is required"},
+		{`{"shadow":{"sonnet":{"model":"sonnet","percent":10}}}`, "shadow.sonnet.model: shadows itself"},
+		{`{"shadow":{"sonnet":{"model":"gpt-5","percent":0}}}`, "shadow.sonnet.percent: must be above 0 and at most 100"},
+		{`{"shadow":{"sonnet":{"model":"gpt-5","percent":150}}}`, "shadow.sonnet.percent: must be above 0 and at most 100"},
+		{`{"shadow":{"sonnet":{"model":"gpt-5","percent":2.5}}}`, ""},
+
+		{`{"tokenizers":{"encodings":{"heuristic":"/x.tiktoken"}}}`, "tokenizers.encodings: invalid encoding name"},
+		{`{"tokenizers":{"encodings":{"cl100k_base":""}}}`, "tokenizers.encodings.cl100k_base: a tiktoken file is required"},
+		{`{"tokenizers":{"models":{"gpt-[":"heuristic"}}}`, "tokenizers.models: invalid model pattern"},
+		{`{"tokenizers":{"models":{"gpt-*":"p50k_base"}}}`, "tokenizers.models.gpt-*: unknown encoding"},
+		{`{"tokenizers":{"default":"r50k_base"}}`, "tokenizers.default: unknown encoding"},
+		{`{"tokenizers":{"models":{"gpt-*":"o200k_base"},"default":"cl100k_base"}}`, ""},
+		{`{"tokenizers":{"encodings":{"cl100k_base":"/x.tiktoken"},"models":{"gpt-*":"cl100k_base","claude-*":"heuristic"}}}`, ""},
+
+		{`{"context_windows":{"overflow":"drop"}}`, "context_windows.overflow: unknown overflow"},
+		{`{"context_windows":{"reserve_tokens":-1}}`, "context_windows.reserve_tokens: must not be negative"},
+		{`{"context_windows":{"models":{"gpt-[":1000}}}`, "context_windows.models: invalid model pattern"},
+		{`{"context_windows":{"models":{"sonnet":8000},"reserve_tokens":8000}}`, "context_windows.models.sonnet: must be more than reserve_tokens"},
+		{`{"context_windows":{"models":{"gpt-*":400000},"reserve_tokens":8000,"overflow":"truncate"}}`, ""},
+
+		{`{"streaming":{"output_filters":{"code_fences":"tidy"}}}`, "streaming.output_filters.code_fences: unknown mode"},
+		{`{"streaming":{"output_filters":{"strip_ansi":true,"strip_preamble":true,"code_fences":"strip"}}}`, ""},
+
+		{`{"streaming":{"compat":["first_chunk_content","trailing_commas"]}}`, `streaming.compat: unknown compatibility flag "trailing_commas"`},
+		{`{"streaming":{"compat":["continue"],"done_within":"90s"}}`, `streaming.compat: unknown compatibility flag "continue"`},
+		{`{"streaming":{"done_within":"-1s"}}`, "streaming.done_within: must not be negative"},
+		{`{"auth":{"keys":[{"name":"cursor","key":"k","scopes":["*"],"stream_compat":["x"]}]}}`, `stream_compat: unknown compatibility flag "x"`},
+		{`{"auth":{"keys":[{"name":"cursor","key":"k","scopes":["*"],"stream_compat":["done_within"]}]}}`, "stream_compat: done_within needs streaming.done_within"},
+		{`{"streaming":{"compat":["first_chunk_content"]},"auth":{"keys":[{"name":"cursor","key":"k","scopes":["*"],"stream_compat":[]}]}}`, ""},
+		{`{"streaming":{"compat":["done_within"],"done_within":"90s"},"auth":{"keys":[{"name":"cursor","key":"k","scopes":["*"],"stream_compat":["done_within","no_redirects"]}]}}`, ""},
+
+		{`{"claude":{"env":{"":"x"}}}`, "claude.env: invalid variable name"},
+		{`{"codex":{"env":{"A=B":"x"}}}`, "codex.env: invalid variable name"},
+		{`{"profiles":{"work":{"env":{"":"x"}}}}`, "profiles.work.env: invalid variable name"},
+		{`{"claude":{"env":{"HTTPS_PROXY":"http://proxy:3128","CLAUDE_CONFIG_DIR":"/srv/claude"}},"codex":{"env":{"CODEX_HOME":"/srv/codex"}}}`, ""},
+
+		{`{"webhooks":{"allow_hosts":[" "]}}`, `webhooks.allow_hosts: " " is not a host name or address`},
+		{`{"webhooks":{"allow_hosts":["https://hooks.internal/x"]}}`, "webhooks.allow_hosts: \"https://hooks.internal/x\" is not a host name or address"},
+		{`{"webhooks":{"allow_hosts":["hooks.internal","10.0.0.5"]}}`, ""},
+	}
+	for _, tt := range tests {
+		err := loadErr(t, tt.body)
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: got %v, want %q", tt.body, err, tt.want)
+		}
+	}
+}
+
+func TestAdapterEnviron(t *testing.T) {
+	c := Claude{Env: map[string]string{"NO_PROXY": "localhost", "HTTPS_PROXY": "http://proxy:3128"}}
+	if got := strings.Join(c.Environ(), " "); got != "HTTPS_PROXY=http://proxy:3128 NO_PROXY=localhost" {
+		t.Fatalf("Environ = %q", got)
+	}
+}
+
+func TestLookupModelPrefersExactThenLongestPattern(t *testing.T) {
+	m := map[string]int{"gpt-*": 1, "gpt-5-*": 2, "gpt-5-mini": 3, "*": 4}
+	for model, want := range map[string]int{"gpt-4o": 1, "gpt-5-codex": 2, "gpt-5-mini": 3, "sonnet": 4} {
+		if got, ok := LookupModel(m, model); !ok || got != want {
+			t.Errorf("LookupModel(%q) = %d, %v; want %d", model, got, ok, want)
+		}
+	}
+	delete(m, "*")
+	if got, ok := LookupModel(m, "sonnet"); ok {
+		t.Errorf("LookupModel(sonnet) = %d, want no match", got)
+	}
+}
+
+func TestLoadParsesProcessLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"process_limits":{"max_memory_mb":2048,"max_cpu_time":"10m","max_open_files":1024}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := cfg.ProcessLimits; p.MaxMemoryMB != 2048 || time.Duration(p.MaxCPUTime) != 10*time.Minute || p.MaxOpenFiles != 1024 {
+		t.Fatalf("unexpected process limits: %+v", p)
+	}
+	if err := os.WriteFile(path, []byte(`{"process_limits":{"max_open_files":-1}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, true); err == nil || !strings.Contains(err.Error(), "process_limits: limits must not be negative") {
+		t.Fatalf("expected negative limit error, got %v", err)
+	}
+}
+
+func TestLoadParsesServerDurations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	body := `{"server":{"read_header_timeout":"5s","idle_timeout":"3m","h2c":true}}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(cfg.Server.ReadHeaderTimeout) != 5*time.Second || time.Duration(cfg.Server.IdleTimeout) != 3*time.Minute || !cfg.Server.H2C {
+		t.Fatalf("unexpected server config: %+v", cfg.Server)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"server":{"read_timeout":30}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, true); err == nil || !strings.Contains(err.Error(), "duration must be a string") {
+		t.Fatalf("expected duration format error, got %v", err)
+	}
+}
+
+func TestLoadRejectsBadQuietHours(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	for body, want := range map[string]string{
+		`{"quiet_hours":{"windows":[{"start":"25:00","end":"07:00"}]}}`:                        `quiet_hours.windows[0]: "25:00" is not a HH:MM time`,
+		`{"quiet_hours":{"windows":[{"start":"22:00","end":"07:00","days":["xyz"]}]}}`:         `quiet_hours.windows[0].days: unknown day "xyz"`,
+		`{"quiet_hours":{"windows":[{"start":"22:00","end":"07:00"}],"action":"drop"}}`:        `quiet_hours.action: must be queue or reject`,
+		`{"quiet_hours":{"windows":[{"start":"22:00","end":"07:00"}],"timezone":"Mars/Base"}}`: `quiet_hours.timezone`,
+	} {
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path, true); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", body, want, err)
+		}
+	}
+}
+
+func TestLoadRejectsDeprecatedModelChains(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	body := `{"deprecated_models":{"gpt-old":{"replaced_by":"gpt-mid"},"gpt-mid":{"replaced_by":"gpt-new"}}}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, true); err == nil || !strings.Contains(err.Error(), "gpt-mid is itself deprecated") {
+		t.Fatalf("expected chained redirect error, got %v", err)
+	}
+}
+
+func TestLoadRejectsBadVirtualModels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	for body, want := range map[string]string{
+		`{"virtual_models":{"writer":{"system_prompt":"hi"}}}`:               `virtual_models.writer.model: is required`,
+		`{"virtual_models":{"writer":{"model":"sonnet","temperature":0.2}}}`: `virtual_models.writer.temperature: not supported`,
+		`{"virtual_models":{"a":{"model":"b"},"b":{"model":"sonnet"}}}`:      `virtual_models.a.model: b is itself a virtual model`,
+		`{"virtual_models":{"writer":{"model":"sonnet","max_tokens":-1}}}`:   `virtual_models.writer.max_tokens: must not be negative`,
+	} {
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path, true); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", body, want, err)
+		}
+	}
+}
+
+func TestLoadRejectsBadPipelines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	for body, want := range map[string]string{
+		`{"pipelines":{"p":[{"model":"haiku"}]}}`:                                                 `pipelines.p: needs at least two steps`,
+		`{"pipelines":{"p":[{"model":"haiku"},{"model":"q"}],"q":[{"model":"a"},{"model":"b"}]}}`: `pipelines.p[1]: q is itself a pipeline`,
+		`{"pipelines":{"p":[{"model":"haiku"},{"model":"sonnet","prompt":"Improve it"}]}}`:        `pipelines.p[1].prompt: must include {{draft}}`,
+	} {
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path, true); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", body, want, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package conformance
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"llm-proxy/internal/aider"
+	"llm-proxy/internal/api"
+	"llm-proxy/internal/client"
+	"llm-proxy/internal/config"
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+)
+
+// aiderEdit is the answer of aiderAdapter: a search and replace block, as
+// Aider's diff edit format asks for.
+const aiderEdit = "Updating the greeting.\n\nhello.txt\n```\n<<<<<<< SEARCH\nHello\n=======\nHello, world\n>>>>>>> REPLACE\n```\n"
+
+// aiderAdapter answers every chat with aiderEdit, in small deltas as
+// Claude streams.
+type aiderAdapter struct {
+	mockAdapter
+	chats atomic.Int32
+}
+
+func (a *aiderAdapter) Chat(_ context.Context, req proxy.ChatRequest) (proxy.ChatResponse, error) {
+	a.chats.Add(1)
+	return proxy.ChatResponse{Model: req.Model, Text: aiderEdit}, nil
+}
+
+func (a *aiderAdapter) ChatStream(_ context.Context, req proxy.ChatRequest, onDelta func(string) error) (proxy.ChatResponse, error) {
+	a.chats.Add(1)
+	for rest := aiderEdit; rest != ""; {
+		n := min(len(rest), 3)
+		if err := onDelta(rest[:n]); err != nil {
+			return proxy.ChatResponse{}, err
+		}
+		rest = rest[n:]
+	}
+	return proxy.ChatResponse{Model: req.Model, Text: aiderEdit}, nil
+}
+
+// TestAider runs Aider, the command in CONFORMANCE_AIDER (e.g. "aider"),
+// against the proxy with the model files `llm-proxy aider` writes, and
+// checks that it applies the edit the mock backend answers with and knows
+// the model's context window.
+func TestAider(t *testing.T) {
+	command := strings.Fields(os.Getenv("CONFORMANCE_AIDER"))
+	if len(command) == 0 {
+		t.Skip("set CONFORMANCE_AIDER to run Aider against the proxy")
+	}
+	backend := &aiderAdapter{mockAdapter: mockAdapter{model: model}}
+	s := api.NewServer(proxy.NewRouter(backend, &mockAdapter{model: "mock-codex"}))
+	s.SetContextWindows(config.ContextWindows{Models: map[string]int{model: 200000}})
+	srv := httptest.NewServer(openapiv1.Handler(s))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	models, err := client.New(srv.URL).ListModels(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := aider.Metadata(models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := aider.Settings(models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{aider.MetadataFile: metadata, aider.SettingsFile: settings, "hello.txt": []byte("Hello\n")} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.CommandContext(t.Context(), command[0], append(command[1:],
+		"--model", aider.ModelName(model),
+		"--openai-api-base", srv.URL+"/v1",
+		"--openai-api-key", "unused",
+		"--model-metadata-file", filepath.Join(dir, aider.MetadataFile),
+		"--model-settings-file", filepath.Join(dir, aider.SettingsFile),
+		"--no-git", "--yes-always", "--no-check-update", "--analytics-disable",
+		"--message", "Greet the world instead.",
+		"hello.txt",
+	)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("aider failed: %v\n%s", err, out)
+	}
+	if backend.chats.Load() == 0 {
+		t.Fatalf("aider never reached the proxy:\n%s", out)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "hello.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Hello, world\n" {
+		t.Errorf("hello.txt = %q after aider ran:\n%s", got, out)
+	}
+	if strings.Contains(string(out), "Unknown context window") {
+		t.Errorf("aider does not know the model's context window:\n%s", out)
+	}
+}
@@ -0,0 +1,272 @@
+// Package conformance runs the official openai-go SDK against the proxy,
+// backed by a mock adapter, and checks that every object it sends decodes
+// with all the fields the SDK marks as required. The SDK is lenient about
+// missing fields, so a field the proxy forgot only shows up as a broken
+// client somewhere else; these tests catch it here.
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/packages/respjson"
+	"github.com/openai/openai-go/responses"
+
+	"llm-proxy/internal/api"
+	"llm-proxy/internal/openapiv1"
+	"llm-proxy/internal/proxy"
+)
+
+// mockAdapter answers every request with the same reasoning and text.
+type mockAdapter struct {
+	model string
+}
+
+func (a *mockAdapter) SupportsModel(_ context.Context, model string) (bool, error) {
+	return model == a.model, nil
+}
+
+func (a *mockAdapter) ListModels(context.Context) ([]proxy.Model, error) {
+	return []proxy.Model{{ID: a.model, Backend: proxy.BackendClaude}}, nil
+}
+
+func (a *mockAdapter) HealthCheck(context.Context) error { return nil }
+
+func (a *mockAdapter) Chat(_ context.Context, req proxy.ChatRequest) (proxy.ChatResponse, error) {
+	return proxy.ChatResponse{Model: req.Model, Text: "Hello there."}, nil
+}
+
+func (a *mockAdapter) ChatStream(_ context.Context, req proxy.ChatRequest, onDelta func(string) error) (proxy.ChatResponse, error) {
+	for _, d := range []string{"Hello", " there."} {
+		if err := onDelta(d); err != nil {
+			return proxy.ChatResponse{}, err
+		}
+	}
+	return proxy.ChatResponse{Model: req.Model, Text: "Hello there."}, nil
+}
+
+func (a *mockAdapter) Respond(_ context.Context, req proxy.ResponsesRequest) (proxy.ResponsesResponse, error) {
+	return proxy.ResponsesResponse{Model: req.Model, Text: "Hello there.", Reasoning: "Greeting."}, nil
+}
+
+func (a *mockAdapter) RespondStream(ctx context.Context, req proxy.ResponsesRequest, onDelta func(string) error) (proxy.ResponsesResponse, error) {
+	return a.RespondStreamEvents(ctx, req, func(ev proxy.ResponseEvent) error {
+		if ev.Kind != proxy.ResponseEventOutput {
+			return nil
+		}
+		return onDelta(ev.Delta)
+	})
+}
+
+func (a *mockAdapter) RespondStreamEvents(_ context.Context, req proxy.ResponsesRequest, onEvent func(proxy.ResponseEvent) error) (proxy.ResponsesResponse, error) {
+	for _, ev := range []proxy.ResponseEvent{
+		{Kind: proxy.ResponseEventReasoning, Delta: "Greeting."},
+		{Kind: proxy.ResponseEventToolCall, Tool: &proxy.ToolCall{ID: "call_1", Name: "shell", Arguments: `{"command":"ls"}`}},
+		{Kind: proxy.ResponseEventOutput, Delta: "Hello"},
+		{Kind: proxy.ResponseEventOutput, Delta: " there."},
+	} {
+		if err := onEvent(ev); err != nil {
+			return proxy.ResponsesResponse{}, err
+		}
+	}
+	return proxy.ResponsesResponse{Model: req.Model, Text: "Hello there.", Reasoning: "Greeting."}, nil
+}
+
+const model = "mock-model"
+
+// newProxy starts the proxy with mock Claude and Codex backends and returns
+// its URL.
+func newProxy(t *testing.T) string {
+	t.Helper()
+	s := api.NewServer(proxy.NewRouter(&mockAdapter{model: model}, &mockAdapter{model: "mock-codex"}))
+	srv := httptest.NewServer(openapiv1.Handler(s))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func newClient(t *testing.T) openai.Client {
+	t.Helper()
+	return openai.NewClient(
+		option.WithBaseURL(newProxy(t)+"/v1/"),
+		option.WithAPIKey("unused"),
+		option.WithMaxRetries(0),
+	)
+}
+
+func TestModelsList(t *testing.T) {
+	client := newClient(t)
+	page, err := client.Models.List(t.Context())
+	if err != nil {
+		t.Fatalf("list models: %v", err)
+	}
+	if len(page.Data) != 2 || page.Data[0].ID != model {
+		t.Fatalf("models = %s", page.RawJSON())
+	}
+	checkRequired(t, "Model", page.Data)
+}
+
+func TestChatCompletion(t *testing.T) {
+	client := newClient(t)
+	completion, err := client.Chat.Completions.New(t.Context(), openai.ChatCompletionNewParams{
+		Model:    model,
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")},
+	})
+	if err != nil {
+		t.Fatalf("chat completion: %v", err)
+	}
+	if len(completion.Choices) != 1 || completion.Choices[0].Message.Content != "Hello there." {
+		t.Fatalf("completion = %+v", completion)
+	}
+	checkRequired(t, "ChatCompletion", *completion)
+}
+
+func TestChatCompletionStream(t *testing.T) {
+	client := newClient(t)
+	stream := client.Chat.Completions.NewStreaming(t.Context(), openai.ChatCompletionNewParams{
+		Model:    model,
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")},
+	})
+	var acc openai.ChatCompletionAccumulator
+	chunks := 0
+	for stream.Next() {
+		chunk := stream.Current()
+		checkRequired(t, fmt.Sprintf("ChatCompletionChunk[%d]", chunks), chunk)
+		acc.AddChunk(chunk)
+		chunks++
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if len(acc.Choices) != 1 || acc.Choices[0].Message.Content != "Hello there." || acc.Choices[0].FinishReason != "stop" {
+		t.Fatalf("accumulated completion = %+v", acc.ChatCompletion)
+	}
+}
+
+func TestResponse(t *testing.T) {
+	client := newClient(t)
+	resp, err := client.Responses.New(t.Context(), responses.ResponseNewParams{
+		Model: model,
+		Input: responses.ResponseNewParamsInputUnion{OfString: openai.String("hi")},
+	})
+	if err != nil {
+		t.Fatalf("create response: %v", err)
+	}
+	if resp.OutputText() != "Hello there." || resp.Status != responses.ResponseStatusCompleted {
+		t.Fatalf("response = %s", resp.RawJSON())
+	}
+	checkRequired(t, "Response", *resp)
+}
+
+func TestResponseStream(t *testing.T) {
+	client := newClient(t)
+	stream := client.Responses.NewStreaming(t.Context(), responses.ResponseNewParams{
+		Model: model,
+		Input: responses.ResponseNewParamsInputUnion{OfString: openai.String("hi")},
+	})
+	var text strings.Builder
+	var completed *responses.Response
+	for stream.Next() {
+		ev := stream.Current()
+		variant := ev.AsAny()
+		if variant == nil {
+			if !newerEvents[ev.Type] {
+				t.Errorf("event type %q is unknown to the SDK", ev.Type)
+			}
+			continue
+		}
+		checkRequired(t, ev.Type, variant)
+		switch ev.Type {
+		case "response.output_text.delta":
+			text.WriteString(ev.AsResponseOutputTextDelta().Delta)
+		case "response.completed":
+			r := ev.AsResponseCompleted().Response
+			completed = &r
+		}
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if text.String() != "Hello there." {
+		t.Fatalf("streamed text = %q", text.String())
+	}
+	if completed == nil || completed.OutputText() != "Hello there." {
+		t.Fatalf("no response.completed event with the output")
+	}
+}
+
+// newerEvents are stream events the proxy sends that postdate the SDK
+// release under test. Clients built on it skip them.
+var newerEvents = map[string]bool{
+	"response.reasoning_text.delta": true,
+	"response.reasoning_text.done":  true,
+}
+
+var fieldType = reflect.TypeOf(respjson.Field{})
+
+// checkRequired reports fields of v, an SDK object decoded from the proxy,
+// that the SDK requires but the proxy left out, or sent with a value the SDK
+// could not decode. Nested objects and arrays of objects are checked too.
+func checkRequired(t *testing.T, path string, v any) {
+	t.Helper()
+	for _, problem := range requiredProblems(path, reflect.ValueOf(v)) {
+		t.Error(problem)
+	}
+}
+
+func requiredProblems(path string, v reflect.Value) []string {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		var problems []string
+		for i := 0; i < v.Len(); i++ {
+			problems = append(problems, requiredProblems(fmt.Sprintf("%s[%d]", path, i), v.Index(i))...)
+		}
+		return problems
+	case reflect.Struct:
+	default:
+		return nil
+	}
+	meta := v.FieldByName("JSON")
+	if !meta.IsValid() || meta.Kind() != reflect.Struct {
+		return nil
+	}
+	var problems []string
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		name, opts, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		status := meta.FieldByName(sf.Name)
+		if !status.IsValid() || status.Type() != fieldType {
+			continue
+		}
+		field := status.Interface().(respjson.Field)
+		at := path + "." + name
+		switch raw := field.Raw(); {
+		case raw == respjson.Omitted:
+			if strings.Contains(opts, "required") {
+				problems = append(problems, at+" is missing")
+			}
+			continue
+		case raw == respjson.Null:
+			continue
+		case !field.Valid():
+			problems = append(problems, fmt.Sprintf("%s has a value the SDK cannot decode: %s", at, raw))
+			continue
+		}
+		problems = append(problems, requiredProblems(at, v.Field(i))...)
+	}
+	return problems
+}
@@ -0,0 +1,59 @@
+package conformance
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// pythonScript drives the official Python SDK, whose pydantic models are
+// stricter than openai-go, through the same flows. It reads the proxy's
+// base URL from its first argument.
+const pythonScript = `
+import sys
+from openai import OpenAI
+
+client = OpenAI(base_url=sys.argv[1] + "/v1", api_key="unused", max_retries=0)
+model = "mock-model"
+
+assert [m.id for m in client.models.list()][0] == model
+
+chat = client.chat.completions.create(model=model, messages=[{"role": "user", "content": "hi"}])
+assert chat.choices[0].message.content == "Hello there.", chat
+
+text = "".join(
+    c.choices[0].delta.content or ""
+    for c in client.chat.completions.create(model=model, messages=[{"role": "user", "content": "hi"}], stream=True)
+    if c.choices
+)
+assert text == "Hello there.", text
+
+resp = client.responses.create(model=model, input="hi")
+assert resp.output_text == "Hello there.", resp
+
+done = None
+for ev in client.responses.create(model=model, input="hi", stream=True):
+    if ev.type == "response.completed":
+        done = ev.response
+assert done is not None and done.output_text == "Hello there.", done
+print("ok")
+`
+
+// TestPythonSDK runs pythonScript with the command in CONFORMANCE_PYTHON, an
+// interpreter with the openai package installed, e.g. "python3" or
+// "docker run --rm -i --network host my-openai-image python". The script is
+// passed on stdin.
+func TestPythonSDK(t *testing.T) {
+	command := strings.Fields(os.Getenv("CONFORMANCE_PYTHON"))
+	if len(command) == 0 {
+		t.Skip("set CONFORMANCE_PYTHON to run the Python SDK checks")
+	}
+	url := newProxy(t)
+	cmd := exec.CommandContext(t.Context(), command[0], append(command[1:], "-", url)...)
+	cmd.Stdin = strings.NewReader(pythonScript)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("python SDK checks failed: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,206 @@
+// Package logfile writes append-only log files that rotate themselves and
+// stay within disk caps, so llm-proxy's on-disk logs need no external
+// logrotate.
+package logfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxSize    = 100 << 20
+	defaultMaxBackups = 5
+)
+
+// backupTimeFormat names rotated files; it sorts in rotation order.
+const backupTimeFormat = "20060102T150405.000"
+
+// rotateRetry is how long a file that could not be rotated is written to
+// before the rotation is tried again.
+const rotateRetry = time.Minute
+
+// Options bounds a log file. Zero values pick the defaults.
+type Options struct {
+	// MaxSize is the size in bytes past which the file is rotated; zero
+	// means 100 MiB.
+	MaxSize int64
+	// Interval also rotates the file once it has been written to for that
+	// long, e.g. daily; zero rotates by size only.
+	Interval time.Duration
+	// MaxBackups is how many rotated files are kept; zero means 5.
+	MaxBackups int
+	// MaxAge deletes rotated files older than this; zero keeps them
+	// regardless of age.
+	MaxAge time.Duration
+	// MaxTotalSize caps the file and its backups together, deleting the
+	// oldest backups first; room for a full MaxSize file is always kept.
+	// Zero means no cap.
+	MaxTotalSize int64
+}
+
+// File is a log file that is renamed to <path>.<time> and started afresh
+// once it grows past MaxSize or gets older than Interval. It is safe for
+// concurrent use; each Write lands whole in one file. When a rotation
+// fails, writes go on to the file as it is and the rotation is retried
+// after rotateRetry.
+type File struct {
+	path string
+	opts Options
+
+	mu       sync.Mutex
+	f        *os.File
+	closed   bool
+	size     int64
+	openedAt time.Time
+	// retryAt holds off rotating again after a failed rotation.
+	retryAt time.Time
+}
+
+// Open opens path for appending, creating it and its directory if needed.
+func Open(path string, opts Options) (*File, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultMaxSize
+	}
+	if opts.MaxBackups <= 0 {
+		opts.MaxBackups = defaultMaxBackups
+	}
+	l := &File{path: path, opts: opts}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	if err := l.prune(); err != nil {
+		l.f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *File) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f = f
+	l.size = info.Size()
+	l.openedAt = time.Now()
+	return nil
+}
+
+// Write appends p to the file. A Write whose rotation failed still lands
+// in the file as it is, and returns the rotation's error with all of p
+// written.
+func (l *File) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	if l.f == nil {
+		// A rotation that could not reopen the file; try again.
+		if err := l.open(); err != nil {
+			return 0, err
+		}
+	} else {
+		full := l.size+int64(len(p)) > l.opts.MaxSize
+		due := l.opts.Interval > 0 && time.Since(l.openedAt) >= l.opts.Interval
+		if l.size > 0 && (full || due) && !time.Now().Before(l.retryAt) {
+			if rotateErr = l.rotate(); l.f == nil {
+				return 0, rotateErr
+			}
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotate renames the file to a backup and opens a fresh one. When the
+// rename fails it reopens the file as it is, leaving l.f nil only when
+// that fails too.
+func (l *File) rotate() error {
+	// The file is closed first: Windows does not rename open files.
+	closeErr := l.f.Close()
+	l.f = nil
+	backup := l.path + "." + time.Now().Format(backupTimeFormat)
+	renameErr := os.Rename(l.path, backup)
+	if renameErr != nil {
+		openedAt := l.openedAt
+		if err := l.open(); err != nil {
+			return err
+		}
+		l.openedAt = openedAt
+		l.retryAt = time.Now().Add(rotateRetry)
+		return fmt.Errorf("rotate %s: %w", l.path, errors.Join(closeErr, renameErr))
+	}
+	if err := l.open(); err != nil {
+		return err
+	}
+	return l.prune()
+}
+
+// prune deletes the backups that no longer fit the limits.
+func (l *File) prune() error {
+	backups, err := l.backups()
+	if err != nil {
+		return err
+	}
+	limits := Limits{MaxAge: l.opts.MaxAge, MaxFiles: l.opts.MaxBackups, MaxTotalSize: l.opts.MaxTotalSize}
+	return prune(backups, limits, max(l.size, l.opts.MaxSize))
+}
+
+// backups lists the rotated files, oldest first.
+func (l *File) backups() ([]entry, error) {
+	dir, base := filepath.Split(l.path)
+	dirEntries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+	var out []entry
+	for _, e := range dirEntries {
+		suffix, ok := strings.CutPrefix(e.Name(), base+".")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, suffix); err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, entry{path: filepath.Join(dir, e.Name()), size: info.Size(), modTime: info.ModTime()})
+	}
+	slices.SortFunc(out, func(a, b entry) int { return strings.Compare(a.path, b.path) })
+	return out, nil
+}
+
+func (l *File) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
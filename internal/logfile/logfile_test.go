@@ -0,0 +1,166 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileRotatesAndKeepsMaxBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "access.log")
+	f, err := Open(path, Options{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n", "six\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		// Backups are named by time, to the millisecond.
+		time.Sleep(2 * time.Millisecond)
+	}
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %v", backups)
+	}
+	newest, _ := os.ReadFile(backups[1].path)
+	current, _ := os.ReadFile(path)
+	if string(newest) != "four\nfive\n" || string(current) != "six\n" {
+		t.Fatalf("unexpected contents: backup %q, current %q", newest, current)
+	}
+}
+
+func TestFileAppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Open(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("new\n"))
+	f.Close()
+	if _, err := f.Write([]byte("late\n")); err == nil {
+		t.Fatal("expected write after close to fail")
+	}
+	got, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(got), "old\nnew\n") || len(got) != 8 {
+		t.Fatalf("unexpected contents %q", got)
+	}
+}
+
+func TestFileCapsTotalSizeAndAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	old := path + ".20200101T000000.000"
+	if err := os.WriteFile(old, []byte("ancient\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-48 * time.Hour)
+	_ = os.Chtimes(old, past, past)
+
+	f, err := Open(path, Options{MaxSize: 10, MaxBackups: 100, MaxAge: 24 * time.Hour, MaxTotalSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("expected the expired backup to be deleted on open, got %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		_, _ = f.Write([]byte("123456789\n"))
+		time.Sleep(2 * time.Millisecond)
+	}
+	backups, _ := f.backups()
+	var total int64
+	for _, b := range backups {
+		total += b.size
+	}
+	if len(backups) != 1 || total+f.size > 20 {
+		t.Fatalf("expected one 10-byte backup beside the current file, got %+v", backups)
+	}
+}
+
+func TestPruneDirDeletesOldestMatchingFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i, name := range []string{"a.jsonl", "b.jsonl", "c.jsonl", "keep.txt"} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("0123456789"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		mod := time.Now().Add(time.Duration(i-10) * time.Minute)
+		_ = os.Chtimes(p, mod, mod)
+	}
+	err := PruneDir(dir, func(name string) bool { return strings.HasSuffix(name, ".jsonl") }, Limits{MaxTotalSize: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, ",") != "b.jsonl,c.jsonl,keep.txt" {
+		t.Fatalf("unexpected files left: %v", names)
+	}
+}
+
+func TestFileKeepsWritingWhenRotationFails(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	path := filepath.Join(dir, "access.log")
+	f, err := Open(path, Options{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("123456789\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// With the file gone the rename fails; the line still gets written.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write([]byte("abc\n")); n != 4 || err == nil {
+		t.Fatalf("Write = %d, %v; want the line written and the rotation error", n, err)
+	}
+	// Until the retry is due, a full file is written to without rotating.
+	if _, err := f.Write([]byte("0123456789\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "abc\n0123456789\n" {
+		t.Fatalf("file holds %q", got)
+	}
+	f.retryAt = time.Time{}
+	if _, err := f.Write([]byte("x\n")); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := f.backups(); len(backups) != 1 {
+		t.Fatalf("expected the retried rotation to leave a backup, got %v", backups)
+	}
+
+	// With the directory gone the file cannot be reopened either; writes
+	// fail until it can be.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("0123456789\n")); err == nil {
+		t.Fatal("expected a write with nowhere to go to fail")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("back\n")); err != nil {
+		t.Fatalf("write after the directory came back: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "back\n" {
+		t.Fatalf("file holds %q", got)
+	}
+}
@@ -0,0 +1,73 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Limits caps the disk used by a set of log files. Files older than MaxAge
+// are deleted first, then the oldest until at most MaxFiles remain and they
+// total at most MaxTotalSize bytes. Zero disables a cap.
+type Limits struct {
+	MaxAge       time.Duration
+	MaxFiles     int
+	MaxTotalSize int64
+}
+
+type entry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// PruneDir applies limits to the files in dir whose names match, e.g. one
+// dump file per request; the oldest by modification time go first.
+func PruneDir(dir string, match func(name string) bool, limits Limits) error {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var files []entry
+	for _, e := range dirEntries {
+		if e.IsDir() || !match(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, entry{path: filepath.Join(dir, e.Name()), size: info.Size(), modTime: info.ModTime()})
+	}
+	slices.SortFunc(files, func(a, b entry) int { return a.modTime.Compare(b.modTime) })
+	return prune(files, limits, 0)
+}
+
+// prune deletes files, sorted oldest first, until they fit limits; reserved
+// counts toward MaxTotalSize without being deletable.
+func prune(files []entry, limits Limits, reserved int64) error {
+	total := reserved
+	for _, f := range files {
+		total += f.size
+	}
+	cutoff := time.Time{}
+	if limits.MaxAge > 0 {
+		cutoff = time.Now().Add(-limits.MaxAge)
+	}
+	for len(files) > 0 {
+		f := files[0]
+		expired := !cutoff.IsZero() && f.modTime.Before(cutoff)
+		tooMany := limits.MaxFiles > 0 && len(files) > limits.MaxFiles
+		tooBig := limits.MaxTotalSize > 0 && total > limits.MaxTotalSize
+		if !expired && !tooMany && !tooBig {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= f.size
+		files = files[1:]
+	}
+	return nil
+}
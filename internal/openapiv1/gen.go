@@ -6,18 +6,75 @@
 package openapiv1
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/oapi-codegen/runtime"
 )
 
+const (
+	BearerAuthScopes = "bearerAuth.Scopes"
+)
+
+// Defines values for AuditEntrySetting.
+const (
+	Config     AuditEntrySetting = "config"
+	Pause      AuditEntrySetting = "pause"
+	QuietHours AuditEntrySetting = "quiet_hours"
+	Yolo       AuditEntrySetting = "yolo"
+)
+
+// Defines values for AuditEntrySource.
+const (
+	AdminApi AuditEntrySource = "admin-api"
+	Reload   AuditEntrySource = "reload"
+	Tui      AuditEntrySource = "tui"
+)
+
 // Defines values for ChatCompletionsResponseObject.
 const (
 	ChatCompletion ChatCompletionsResponseObject = "chat.completion"
 )
 
+// Defines values for DeletedResponseObject.
+const (
+	DeletedResponseObjectResponse DeletedResponseObject = "response"
+)
+
+// Defines values for DiffOpOp.
+const (
+	Delete DiffOpOp = "delete"
+	Equal  DiffOpOp = "equal"
+	Insert DiffOpOp = "insert"
+)
+
+// Defines values for EvalItemMatch.
+const (
+	Contains EvalItemMatch = "contains"
+	Exact    EvalItemMatch = "exact"
+	Regex    EvalItemMatch = "regex"
+)
+
+// Defines values for EvalRunObject.
+const (
+	EvalRunObjectEvalRun EvalRunObject = "eval.run"
+)
+
+// Defines values for EvalRunStatus.
+const (
+	EvalRunStatusCancelled EvalRunStatus = "cancelled"
+	EvalRunStatusCompleted EvalRunStatus = "completed"
+	EvalRunStatusRunning   EvalRunStatus = "running"
+)
+
+// Defines values for LivenessStatus.
+const (
+	Ok LivenessStatus = "ok"
+)
+
 // Defines values for ModelObject.
 const (
 	ModelObjectModel ModelObject = "model"
@@ -28,6 +85,31 @@ const (
 	List ModelListResponseObject = "list"
 )
 
+// Defines values for PauseStateMode.
+const (
+	PauseStateModeQueue  PauseStateMode = "queue"
+	PauseStateModeReject PauseStateMode = "reject"
+)
+
+// Defines values for QuietHoursStateAction.
+const (
+	QuietHoursStateActionQueue  QuietHoursStateAction = "queue"
+	QuietHoursStateActionReject QuietHoursStateAction = "reject"
+)
+
+// Defines values for ReplayPath.
+const (
+	ReplayPathV1chatcompletions ReplayPath = "/v1/chat/completions"
+	ReplayPathV1responses       ReplayPath = "/v1/responses"
+)
+
+// Defines values for ResponseFormatType.
+const (
+	ResponseFormatTypeJsonObject ResponseFormatType = "json_object"
+	ResponseFormatTypeJsonSchema ResponseFormatType = "json_schema"
+	ResponseFormatTypeText       ResponseFormatType = "text"
+)
+
 // Defines values for ResponsesOutputTextType.
 const (
 	OutputText ResponsesOutputTextType = "output_text"
@@ -35,30 +117,134 @@ const (
 
 // Defines values for ResponsesResponseObject.
 const (
-	Response ResponsesResponseObject = "response"
+	ResponsesResponseObjectResponse ResponsesResponseObject = "response"
 )
 
+// Defines values for ResponsesResponseStatus.
+const (
+	ResponsesResponseStatusCancelled  ResponsesResponseStatus = "cancelled"
+	ResponsesResponseStatusCompleted  ResponsesResponseStatus = "completed"
+	ResponsesResponseStatusFailed     ResponsesResponseStatus = "failed"
+	ResponsesResponseStatusInProgress ResponsesResponseStatus = "in_progress"
+	ResponsesResponseStatusIncomplete ResponsesResponseStatus = "incomplete"
+)
+
+// Defines values for ResponsesTextFormatType.
+const (
+	ResponsesTextFormatTypeJsonObject ResponsesTextFormatType = "json_object"
+	ResponsesTextFormatTypeJsonSchema ResponsesTextFormatType = "json_schema"
+	ResponsesTextFormatTypeText       ResponsesTextFormatType = "text"
+)
+
+// Defines values for ShadowResultPath.
+const (
+	ShadowResultPathV1chatcompletions ShadowResultPath = "/v1/chat/completions"
+	ShadowResultPathV1responses       ShadowResultPath = "/v1/responses"
+)
+
+// Defines values for WindowStatsWindow.
+const (
+	N1h WindowStatsWindow = "1h"
+	N1m WindowStatsWindow = "1m"
+	N5m WindowStatsWindow = "5m"
+)
+
+// AuditEntry defines model for AuditEntry.
+type AuditEntry struct {
+	// From The previous value; absent for config reloads.
+	From *string `json:"from,omitempty"`
+
+	// Key The API key that made an admin-api change, when auth is on.
+	Key     *string           `json:"key,omitempty"`
+	Setting AuditEntrySetting `json:"setting"`
+	Source  AuditEntrySource  `json:"source"`
+	Time    time.Time         `json:"time"`
+
+	// To The new value; for config reloads, the file reloaded.
+	To string `json:"to"`
+}
+
+// AuditEntrySetting defines model for AuditEntry.Setting.
+type AuditEntrySetting string
+
+// AuditEntrySource defines model for AuditEntry.Source.
+type AuditEntrySource string
+
+// BestOfNResult How a best_of_n request picked its answer.
+type BestOfNResult struct {
+	// Alternatives The answers that lost, in sample order.
+	Alternatives *[]string `json:"alternatives,omitempty"`
+
+	// Failed Samples that failed and were left out.
+	Failed     *int   `json:"failed,omitempty"`
+	JudgeModel string `json:"judge_model"`
+
+	// N Samples requested.
+	N int `json:"n"`
+
+	// Winner Index of the returned sample, counting from 0 in sample order.
+	Winner int `json:"winner"`
+}
+
 // ChatChoice defines model for ChatChoice.
 type ChatChoice struct {
-	FinishReason *string     `json:"finish_reason,omitempty"`
-	Index        int         `json:"index"`
-	Message      ChatMessage `json:"message"`
+	FinishReason string `json:"finish_reason"`
+	Index        int    `json:"index"`
+
+	// Logprobs Always null; the CLIs do not report log probabilities.
+	Logprobs *map[string]interface{} `json:"logprobs"`
+	Message  ChatCompletionMessage   `json:"message"`
+}
+
+// ChatCompletionMessage defines model for ChatCompletionMessage.
+type ChatCompletionMessage struct {
+	Content string `json:"content"`
+
+	// Refusal Set instead of content on an assistant reply that could not produce the requested structured output.
+	Refusal *string `json:"refusal"`
+	Role    string  `json:"role"`
 }
 
 // ChatCompletionsRequest defines model for ChatCompletionsRequest.
 type ChatCompletionsRequest struct {
+	// BestOfN Extension: run this many samples and let a judge model pick the best one, which is the only answer returned. Not available with stream; best_of_n.max in the config caps it (5 by default).
+	BestOfN  *int          `json:"best_of_n,omitempty"`
 	Messages []ChatMessage `json:"messages"`
-	Model    string        `json:"model"`
-	Stream   *bool         `json:"stream,omitempty"`
+
+	// Metadata Key-value pairs recorded with the request as tags (key=value) in metrics and logs, alongside those in the X-LLM-Proxy-Tags header.
+	Metadata *map[string]string `json:"metadata,omitempty"`
+	Model    string             `json:"model"`
+
+	// ReasoningEffort Reasoning effort hint; honoured by backends that support it (Codex).
+	ReasoningEffort *string `json:"reasoning_effort,omitempty"`
+
+	// ResponseFormat Structured output. The model is told to answer with JSON (matching json_schema.schema for json_schema); the proxy repairs and validates the answer and returns a refusal when it does not comply.
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	Stream         *bool           `json:"stream,omitempty"`
+
+	// StreamCoalesce llm-proxy extension. Batches small streamed deltas into fewer SSE events, flushing after interval_ms or once max_bytes are buffered.
+	StreamCoalesce *StreamCoalesce `json:"stream_coalesce,omitempty"`
+
+	// User End-user ID, as in OpenAI's API. Usage is counted per user and limits.user_requests_per_minute applies to each.
+	User *string `json:"user,omitempty"`
 }
 
 // ChatCompletionsResponse defines model for ChatCompletionsResponse.
 type ChatCompletionsResponse struct {
+	// BestOfN How a best_of_n request picked its answer.
+	BestOfN *BestOfNResult                `json:"best_of_n,omitempty"`
 	Choices []ChatChoice                  `json:"choices"`
+	Created int                           `json:"created"`
 	Id      string                        `json:"id"`
 	Model   string                        `json:"model"`
 	Object  ChatCompletionsResponseObject `json:"object"`
-	Usage   *Usage                        `json:"usage,omitempty"`
+
+	// ServiceTier Always "default"; the CLIs have a single tier.
+	ServiceTier string `json:"service_tier"`
+
+	// SystemFingerprint Identifies the backend model the request was routed to; it changes when the routing does. Streamed chunks carry the same value.
+	SystemFingerprint string `json:"system_fingerprint"`
+	Usage             *Usage `json:"usage,omitempty"`
 }
 
 // ChatCompletionsResponseObject defines model for ChatCompletionsResponse.Object.
@@ -70,11 +256,190 @@ type ChatMessage struct {
 	Role    string `json:"role"`
 }
 
+// DeletedResponse defines model for DeletedResponse.
+type DeletedResponse struct {
+	Deleted bool                  `json:"deleted"`
+	Id      string                `json:"id"`
+	Object  DeletedResponseObject `json:"object"`
+}
+
+// DeletedResponseObject defines model for DeletedResponse.Object.
+type DeletedResponseObject string
+
+// DiffOp defines model for DiffOp.
+type DiffOp struct {
+	Op   DiffOpOp `json:"op"`
+	Text string   `json:"text"`
+}
+
+// DiffOpOp defines model for DiffOp.Op.
+type DiffOpOp string
+
+// Error defines model for Error.
+type Error struct {
+	Error struct {
+		Code    *string `json:"code"`
+		Message string  `json:"message"`
+		Type    string  `json:"type"`
+	} `json:"error"`
+}
+
+// EvalItem defines model for EvalItem.
+type EvalItem struct {
+	// Expected The answer to score against; items without one are not scored.
+	Expected *string `json:"expected,omitempty"`
+
+	// Id Names the item in the results; its 1-based position when omitted.
+	Id *string `json:"id,omitempty"`
+
+	// Input The user message.
+	Input string `json:"input"`
+
+	// Match How the answer must match expected: contain it (the default) or equal it, both ignoring case and surrounding whitespace, or match it as a regular expression.
+	Match  *EvalItemMatch `json:"match,omitempty"`
+	System *string        `json:"system,omitempty"`
+}
+
+// EvalItemMatch How the answer must match expected: contain it (the default) or equal it, both ignoring case and surrounding whitespace, or match it as a regular expression.
+type EvalItemMatch string
+
+// EvalModelSummary defines model for EvalModelSummary.
+type EvalModelSummary struct {
+	AvgLatencyMs float32 `json:"avg_latency_ms"`
+	Failed       int     `json:"failed"`
+	Model        string  `json:"model"`
+
+	// PassRate passed / scored, absent while nothing was scored.
+	PassRate *float32 `json:"pass_rate,omitempty"`
+	Passed   int      `json:"passed"`
+	Runs     int      `json:"runs"`
+	Scored   int      `json:"scored"`
+}
+
+// EvalRequest defines model for EvalRequest.
+type EvalRequest struct {
+	// Concurrency How many items run at once (default 2, at most 8).
+	Concurrency *int       `json:"concurrency,omitempty"`
+	Items       []EvalItem `json:"items"`
+	Models      []string   `json:"models"`
+}
+
+// EvalResult defines model for EvalResult.
+type EvalResult struct {
+	Error     *string `json:"error,omitempty"`
+	Expected  *string `json:"expected,omitempty"`
+	ItemId    string  `json:"item_id"`
+	LatencyMs float32 `json:"latency_ms"`
+	Model     string  `json:"model"`
+	Output    string  `json:"output"`
+
+	// Passed Whether output matched expected; absent for unscored items.
+	Passed *bool `json:"passed,omitempty"`
+	Status int   `json:"status"`
+}
+
+// EvalRun defines model for EvalRun.
+type EvalRun struct {
+	CompletedAt *int               `json:"completed_at,omitempty"`
+	CreatedAt   int                `json:"created_at"`
+	Done        int                `json:"done"`
+	Id          string             `json:"id"`
+	Models      []string           `json:"models"`
+	Object      EvalRunObject      `json:"object"`
+	Status      EvalRunStatus      `json:"status"`
+	Summary     []EvalModelSummary `json:"summary"`
+
+	// Total Items times models.
+	Total int `json:"total"`
+}
+
+// EvalRunObject defines model for EvalRun.Object.
+type EvalRunObject string
+
+// EvalRunStatus defines model for EvalRun.Status.
+type EvalRunStatus string
+
+// HealthStat defines model for HealthStat.
+type HealthStat struct {
+	Backend   string     `json:"backend"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+
+	// CircuitOpen Requests to the backend fail with 503 until a probe passes.
+	CircuitOpen bool    `json:"circuit_open"`
+	Error       *string `json:"error,omitempty"`
+
+	// Failures Probes that failed in a row.
+	Failures  *int     `json:"failures,omitempty"`
+	Healthy   bool     `json:"healthy"`
+	LatencyMs *float32 `json:"latency_ms,omitempty"`
+}
+
+// JSONSchemaFormat defines model for JSONSchemaFormat.
+type JSONSchemaFormat struct {
+	Description *string                 `json:"description,omitempty"`
+	Name        string                  `json:"name"`
+	Schema      *map[string]interface{} `json:"schema,omitempty"`
+	Strict      *bool                   `json:"strict,omitempty"`
+}
+
+// Liveness defines model for Liveness.
+type Liveness struct {
+	Status LivenessStatus `json:"status"`
+}
+
+// LivenessStatus defines model for Liveness.Status.
+type LivenessStatus string
+
+// MetricsSnapshot Counters and per-model, per-key and per-backend state. Only the main fields are listed; see the README for the rest.
+type MetricsSnapshot struct {
+	AvgLatencyMs *float32 `json:"avg_latency_ms,omitempty"`
+	BytesSent    *int     `json:"bytes_sent,omitempty"`
+
+	// DeprecatedModels Requests for each deprecated model ID, whether redirected or served as asked.
+	DeprecatedModels *map[string]int           `json:"deprecated_models,omitempty"`
+	ErrorsTotal      *int                      `json:"errors_total,omitempty"`
+	Health           *[]HealthStat             `json:"health,omitempty"`
+	InFlight         *int                      `json:"in_flight,omitempty"`
+	Keys             *[]map[string]interface{} `json:"keys,omitempty"`
+
+	// LoopsDetected Requests refused with loop_detected because their client kept repeating itself.
+	LoopsDetected *int                      `json:"loops_detected,omitempty"`
+	MaxLatencyMs  *float32                  `json:"max_latency_ms,omitempty"`
+	Models        *[]map[string]interface{} `json:"models,omitempty"`
+	Quotas        *[]QuotaStat              `json:"quotas,omitempty"`
+	RequestsTotal *int                      `json:"requests_total,omitempty"`
+
+	// Since When the counters started, at start-up or the last reset.
+	Since                 *time.Time `json:"since,omitempty"`
+	StreamsCancelled      *int       `json:"streams_cancelled,omitempty"`
+	StreamsClientAborted  *int       `json:"streams_client_aborted,omitempty"`
+	StreamsCompleted      *int       `json:"streams_completed,omitempty"`
+	StreamsUpstreamFailed *int       `json:"streams_upstream_failed,omitempty"`
+
+	// TextFallbacks Claude streams that failed or came back empty and were run again with plain text output.
+	TextFallbacks *int `json:"text_fallbacks,omitempty"`
+
+	// Windows Traffic over the last minute, 5 minutes and hour.
+	Windows              *[]WindowStats         `json:"windows,omitempty"`
+	AdditionalProperties map[string]interface{} `json:"-"`
+}
+
 // Model defines model for Model.
 type Model struct {
+	// BaseModel The model an alias or virtual model runs; left out for other models.
+	BaseModel *string `json:"base_model,omitempty"`
+
+	// ContextWindow The model's context window in tokens, from the context_windows config; left out for models it does not cover.
+	ContextWindow *int `json:"context_window,omitempty"`
+
+	// Created When the proxy started; the CLIs do not date their models.
+	Created int         `json:"created"`
 	Id      string      `json:"id"`
 	Object  ModelObject `json:"object"`
 	OwnedBy *string     `json:"owned_by,omitempty"`
+
+	// Warm Whether the model started a turn within the last five minutes, so its CLI and prompt cache are warm and the next request starts faster than a cold one. Races are warm when any leg is, auto when its default model is.
+	Warm *bool `json:"warm,omitempty"`
 }
 
 // ModelObject defines model for Model.Object.
@@ -89,6 +454,112 @@ type ModelListResponse struct {
 // ModelListResponseObject defines model for ModelListResponse.Object.
 type ModelListResponseObject string
 
+// NetworkStat defines model for NetworkStat.
+type NetworkStat struct {
+	Backend string `json:"backend"`
+
+	// Endpoint The API the backend's CLI calls.
+	Endpoint  string   `json:"endpoint"`
+	Error     *string  `json:"error,omitempty"`
+	LatencyMs *float32 `json:"latency_ms,omitempty"`
+
+	// Proxy Outbound proxy used, credentials redacted; absent for a direct connection.
+	Proxy *string `json:"proxy,omitempty"`
+
+	// ProxyEnv Environment variable the proxy was taken from.
+	ProxyEnv  *string `json:"proxy_env,omitempty"`
+	Reachable bool    `json:"reachable"`
+}
+
+// PauseState defines model for PauseState.
+type PauseState struct {
+	// Mode reject answers new requests with 503 and Retry-After, queue holds them until traffic resumes. Running requests finish either way.
+	Mode       PauseStateMode `json:"mode"`
+	Paused     bool           `json:"paused"`
+	RetryAfter int            `json:"retry_after"`
+
+	// Since When the pause began; absent while not paused.
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// PauseStateMode reject answers new requests with 503 and Retry-After, queue holds them until traffic resumes. Running requests finish either way.
+type PauseStateMode string
+
+// QuietHoursState defines model for QuietHoursState.
+type QuietHoursState struct {
+	Action QuietHoursStateAction `json:"action"`
+
+	// Active Whether batch requests are held back now.
+	Active bool `json:"active"`
+
+	// Paused The admin override, or null when the schedule decides.
+	Paused *bool `json:"paused"`
+
+	// Scheduled Whether a configured window is open now.
+	Scheduled bool `json:"scheduled"`
+
+	// Until When the open window ends; null when paused by hand or inactive.
+	Until *time.Time `json:"until"`
+}
+
+// QuietHoursStateAction defines model for QuietHoursState.Action.
+type QuietHoursStateAction string
+
+// QuotaStat defines model for QuotaStat.
+type QuotaStat struct {
+	Backend   string            `json:"backend"`
+	CheckedAt time.Time         `json:"checked_at"`
+	Error     *string           `json:"error,omitempty"`
+	Windows   []QuotaWindowStat `json:"windows"`
+}
+
+// QuotaWindowStat defines model for QuotaWindowStat.
+type QuotaWindowStat struct {
+	ResetsAt      *time.Time `json:"resets_at,omitempty"`
+	UsedPercent   float32    `json:"used_percent"`
+	WindowMinutes *int       `json:"window_minutes,omitempty"`
+}
+
+// Readiness defines model for Readiness.
+type Readiness struct {
+	// Backends Whether each backend takes requests, by backend name.
+	Backends map[string]bool `json:"backends"`
+	Ready    bool            `json:"ready"`
+}
+
+// Replay defines model for Replay.
+type Replay struct {
+	// Diff A word-level diff from the original output to the replay's. The equal and delete runs spell out the original, the equal and insert runs the replay.
+	Diff     []DiffOp   `json:"diff"`
+	Id       int64      `json:"id"`
+	Original ReplayRun  `json:"original"`
+	Path     ReplayPath `json:"path"`
+	Replay   ReplayRun  `json:"replay"`
+}
+
+// ReplayPath defines model for Replay.Path.
+type ReplayPath string
+
+// ReplayRun defines model for ReplayRun.
+type ReplayRun struct {
+	Error     *string `json:"error,omitempty"`
+	LatencyMs float32 `json:"latency_ms"`
+	Model     string  `json:"model"`
+
+	// Output The answer's text, empty when the run failed.
+	Output string `json:"output"`
+	Status int    `json:"status"`
+}
+
+// ResponseFormat Structured output. The model is told to answer with JSON (matching json_schema.schema for json_schema); the proxy repairs and validates the answer and returns a refusal when it does not comply.
+type ResponseFormat struct {
+	JsonSchema *JSONSchemaFormat  `json:"json_schema,omitempty"`
+	Type       ResponseFormatType `json:"type"`
+}
+
+// ResponseFormatType defines model for ResponseFormat.Type.
+type ResponseFormatType string
+
 // ResponsesInputItem defines model for ResponsesInputItem.
 type ResponsesInputItem struct {
 	union json.RawMessage
@@ -116,11 +587,30 @@ type ResponsesOutputText struct {
 // ResponsesOutputTextType defines model for ResponsesOutputText.Type.
 type ResponsesOutputTextType string
 
+// ResponsesReasoning defines model for ResponsesReasoning.
+type ResponsesReasoning struct {
+	// Effort Reasoning effort hint; honoured by backends that support it (Codex).
+	Effort *string `json:"effort,omitempty"`
+}
+
 // ResponsesRequest defines model for ResponsesRequest.
 type ResponsesRequest struct {
-	Input  *ResponsesRequest_Input `json:"input,omitempty"`
-	Model  string                  `json:"model"`
-	Stream *bool                   `json:"stream,omitempty"`
+	// BestOfN Extension: run this many samples and let a judge model pick the best one, which is the only answer returned. Not available with stream; best_of_n.max in the config caps it (5 by default).
+	BestOfN *int                    `json:"best_of_n,omitempty"`
+	Input   *ResponsesRequest_Input `json:"input,omitempty"`
+
+	// Metadata Key-value pairs recorded with the request as tags (key=value) in metrics and logs, alongside those in the X-LLM-Proxy-Tags header.
+	Metadata  *map[string]string  `json:"metadata,omitempty"`
+	Model     string              `json:"model"`
+	Reasoning *ResponsesReasoning `json:"reasoning,omitempty"`
+	Stream    *bool               `json:"stream,omitempty"`
+
+	// StreamCoalesce llm-proxy extension. Batches small streamed deltas into fewer SSE events, flushing after interval_ms or once max_bytes are buffered.
+	StreamCoalesce *StreamCoalesce `json:"stream_coalesce,omitempty"`
+	Text           *ResponsesText  `json:"text,omitempty"`
+
+	// User End-user ID, as in OpenAI's API. Usage is counted per user and limits.user_requests_per_minute applies to each.
+	User *string `json:"user,omitempty"`
 }
 
 // ResponsesRequestInput0 defines model for .
@@ -136,16 +626,99 @@ type ResponsesRequest_Input struct {
 
 // ResponsesResponse defines model for ResponsesResponse.
 type ResponsesResponse struct {
-	Id     string                  `json:"id"`
-	Model  string                  `json:"model"`
-	Object ResponsesResponseObject `json:"object"`
-	Output []ResponsesOutputItem   `json:"output"`
-	Usage  *Usage                  `json:"usage,omitempty"`
+	// BestOfN How a best_of_n request picked its answer.
+	BestOfN   *BestOfNResult `json:"best_of_n,omitempty"`
+	CreatedAt *int           `json:"created_at,omitempty"`
+	Error     *struct {
+		Code    *string `json:"code,omitempty"`
+		Message *string `json:"message,omitempty"`
+		Type    *string `json:"type,omitempty"`
+	} `json:"error"`
+	Id string `json:"id"`
+
+	// IncompleteDetails Why the response is incomplete, e.g. max_output_tokens, max_turns, max_duration or upstream_error.
+	IncompleteDetails *struct {
+		Reason *string `json:"reason,omitempty"`
+	} `json:"incomplete_details"`
+	Model  string                   `json:"model"`
+	Object ResponsesResponseObject  `json:"object"`
+	Output []ResponsesOutputItem    `json:"output"`
+	Status *ResponsesResponseStatus `json:"status,omitempty"`
+
+	// Usage Token usage as reported by the CLI, or estimated when it reports none.
+	Usage *ResponsesUsage `json:"usage,omitempty"`
 }
 
 // ResponsesResponseObject defines model for ResponsesResponse.Object.
 type ResponsesResponseObject string
 
+// ResponsesResponseStatus defines model for ResponsesResponse.Status.
+type ResponsesResponseStatus string
+
+// ResponsesText defines model for ResponsesText.
+type ResponsesText struct {
+	// Format Structured output, as response_format on chat completions.
+	Format *ResponsesTextFormat `json:"format,omitempty"`
+}
+
+// ResponsesTextFormat Structured output, as response_format on chat completions.
+type ResponsesTextFormat struct {
+	Description *string                 `json:"description,omitempty"`
+	Name        *string                 `json:"name,omitempty"`
+	Schema      *map[string]interface{} `json:"schema,omitempty"`
+	Strict      *bool                   `json:"strict,omitempty"`
+	Type        ResponsesTextFormatType `json:"type"`
+}
+
+// ResponsesTextFormatType defines model for ResponsesTextFormat.Type.
+type ResponsesTextFormatType string
+
+// ResponsesUsage Token usage as reported by the CLI, or estimated when it reports none.
+type ResponsesUsage struct {
+	InputTokens        *int `json:"input_tokens,omitempty"`
+	InputTokensDetails *struct {
+		CachedTokens *int `json:"cached_tokens,omitempty"`
+	} `json:"input_tokens_details,omitempty"`
+	OutputTokens        *int `json:"output_tokens,omitempty"`
+	OutputTokensDetails *struct {
+		ReasoningTokens *int `json:"reasoning_tokens,omitempty"`
+	} `json:"output_tokens_details,omitempty"`
+	TotalTokens *int `json:"total_tokens,omitempty"`
+}
+
+// ShadowResult defines model for ShadowResult.
+type ShadowResult struct {
+	Error            *string          `json:"error,omitempty"`
+	LatencyMs        float32          `json:"latency_ms"`
+	Model            string           `json:"model"`
+	Output           string           `json:"output"`
+	Path             ShadowResultPath `json:"path"`
+	PrimaryLatencyMs float32          `json:"primary_latency_ms"`
+
+	// RequestId The mirrored request's `id` in the request log.
+	RequestId int64  `json:"request_id"`
+	Shadow    string `json:"shadow"`
+
+	// Status The shadow run's HTTP status; 0 when it could not run.
+	Status int       `json:"status"`
+	Time   time.Time `json:"time"`
+
+	// WordsAdded Words of the shadow's output not in the client's.
+	WordsAdded int `json:"words_added"`
+
+	// WordsRemoved Words of the client's output missing from the shadow's.
+	WordsRemoved int `json:"words_removed"`
+}
+
+// ShadowResultPath defines model for ShadowResult.Path.
+type ShadowResultPath string
+
+// StreamCoalesce llm-proxy extension. Batches small streamed deltas into fewer SSE events, flushing after interval_ms or once max_bytes are buffered.
+type StreamCoalesce struct {
+	IntervalMs *int `json:"interval_ms,omitempty"`
+	MaxBytes   *int `json:"max_bytes,omitempty"`
+}
+
 // Usage defines model for Usage.
 type Usage struct {
 	CompletionTokens *int `json:"completion_tokens,omitempty"`
@@ -153,12 +726,395 @@ type Usage struct {
 	TotalTokens      *int `json:"total_tokens,omitempty"`
 }
 
+// WindowStats defines model for WindowStats.
+type WindowStats struct {
+	AvgLatencyMs     *float32          `json:"avg_latency_ms,omitempty"`
+	CompletionTokens *int              `json:"completion_tokens,omitempty"`
+	ErrorRate        *float32          `json:"error_rate,omitempty"`
+	ErrorsTotal      int               `json:"errors_total"`
+	MaxLatencyMs     *float32          `json:"max_latency_ms,omitempty"`
+	PromptTokens     *int              `json:"prompt_tokens,omitempty"`
+	RequestsPerMin   *float32          `json:"requests_per_min,omitempty"`
+	RequestsTotal    int               `json:"requests_total"`
+	Window           WindowStatsWindow `json:"window"`
+}
+
+// WindowStatsWindow defines model for WindowStats.Window.
+type WindowStatsWindow string
+
+// YOLOState defines model for YOLOState.
+type YOLOState struct {
+	Enabled bool `json:"enabled"`
+}
+
+// CreateEvalParams defines parameters for CreateEval.
+type CreateEvalParams struct {
+	// Models Comma-separated models, for a JSONL body.
+	Models *string `form:"models,omitempty" json:"models,omitempty"`
+
+	// Concurrency How many items run at once, for a JSONL body.
+	Concurrency *int `form:"concurrency,omitempty" json:"concurrency,omitempty"`
+}
+
+// GetResponseParams defines parameters for GetResponse.
+type GetResponseParams struct {
+	// Include Extra output data to include. `include[]` is accepted as well.
+	Include *[]string `form:"include,omitempty" json:"include,omitempty"`
+}
+
+// StreamResponseEventsParams defines parameters for StreamResponseEvents.
+type StreamResponseEventsParams struct {
+	// StartingAfter Resume after this sequence number; all buffered events are replayed when absent.
+	StartingAfter *int64 `form:"starting_after,omitempty" json:"starting_after,omitempty"`
+}
+
 // CreateChatCompletionJSONRequestBody defines body for CreateChatCompletion for application/json ContentType.
 type CreateChatCompletionJSONRequestBody = ChatCompletionsRequest
 
+// CreateEvalJSONRequestBody defines body for CreateEval for application/json ContentType.
+type CreateEvalJSONRequestBody = EvalRequest
+
 // CreateResponseJSONRequestBody defines body for CreateResponse for application/json ContentType.
 type CreateResponseJSONRequestBody = ResponsesRequest
 
+// Getter for additional properties for MetricsSnapshot. Returns the specified
+// element and whether it was found
+func (a MetricsSnapshot) Get(fieldName string) (value interface{}, found bool) {
+	if a.AdditionalProperties != nil {
+		value, found = a.AdditionalProperties[fieldName]
+	}
+	return
+}
+
+// Setter for additional properties for MetricsSnapshot
+func (a *MetricsSnapshot) Set(fieldName string, value interface{}) {
+	if a.AdditionalProperties == nil {
+		a.AdditionalProperties = make(map[string]interface{})
+	}
+	a.AdditionalProperties[fieldName] = value
+}
+
+// Override default JSON handling for MetricsSnapshot to handle AdditionalProperties
+func (a *MetricsSnapshot) UnmarshalJSON(b []byte) error {
+	object := make(map[string]json.RawMessage)
+	err := json.Unmarshal(b, &object)
+	if err != nil {
+		return err
+	}
+
+	if raw, found := object["avg_latency_ms"]; found {
+		err = json.Unmarshal(raw, &a.AvgLatencyMs)
+		if err != nil {
+			return fmt.Errorf("error reading 'avg_latency_ms': %w", err)
+		}
+		delete(object, "avg_latency_ms")
+	}
+
+	if raw, found := object["bytes_sent"]; found {
+		err = json.Unmarshal(raw, &a.BytesSent)
+		if err != nil {
+			return fmt.Errorf("error reading 'bytes_sent': %w", err)
+		}
+		delete(object, "bytes_sent")
+	}
+
+	if raw, found := object["deprecated_models"]; found {
+		err = json.Unmarshal(raw, &a.DeprecatedModels)
+		if err != nil {
+			return fmt.Errorf("error reading 'deprecated_models': %w", err)
+		}
+		delete(object, "deprecated_models")
+	}
+
+	if raw, found := object["errors_total"]; found {
+		err = json.Unmarshal(raw, &a.ErrorsTotal)
+		if err != nil {
+			return fmt.Errorf("error reading 'errors_total': %w", err)
+		}
+		delete(object, "errors_total")
+	}
+
+	if raw, found := object["health"]; found {
+		err = json.Unmarshal(raw, &a.Health)
+		if err != nil {
+			return fmt.Errorf("error reading 'health': %w", err)
+		}
+		delete(object, "health")
+	}
+
+	if raw, found := object["in_flight"]; found {
+		err = json.Unmarshal(raw, &a.InFlight)
+		if err != nil {
+			return fmt.Errorf("error reading 'in_flight': %w", err)
+		}
+		delete(object, "in_flight")
+	}
+
+	if raw, found := object["keys"]; found {
+		err = json.Unmarshal(raw, &a.Keys)
+		if err != nil {
+			return fmt.Errorf("error reading 'keys': %w", err)
+		}
+		delete(object, "keys")
+	}
+
+	if raw, found := object["loops_detected"]; found {
+		err = json.Unmarshal(raw, &a.LoopsDetected)
+		if err != nil {
+			return fmt.Errorf("error reading 'loops_detected': %w", err)
+		}
+		delete(object, "loops_detected")
+	}
+
+	if raw, found := object["max_latency_ms"]; found {
+		err = json.Unmarshal(raw, &a.MaxLatencyMs)
+		if err != nil {
+			return fmt.Errorf("error reading 'max_latency_ms': %w", err)
+		}
+		delete(object, "max_latency_ms")
+	}
+
+	if raw, found := object["models"]; found {
+		err = json.Unmarshal(raw, &a.Models)
+		if err != nil {
+			return fmt.Errorf("error reading 'models': %w", err)
+		}
+		delete(object, "models")
+	}
+
+	if raw, found := object["quotas"]; found {
+		err = json.Unmarshal(raw, &a.Quotas)
+		if err != nil {
+			return fmt.Errorf("error reading 'quotas': %w", err)
+		}
+		delete(object, "quotas")
+	}
+
+	if raw, found := object["requests_total"]; found {
+		err = json.Unmarshal(raw, &a.RequestsTotal)
+		if err != nil {
+			return fmt.Errorf("error reading 'requests_total': %w", err)
+		}
+		delete(object, "requests_total")
+	}
+
+	if raw, found := object["since"]; found {
+		err = json.Unmarshal(raw, &a.Since)
+		if err != nil {
+			return fmt.Errorf("error reading 'since': %w", err)
+		}
+		delete(object, "since")
+	}
+
+	if raw, found := object["streams_cancelled"]; found {
+		err = json.Unmarshal(raw, &a.StreamsCancelled)
+		if err != nil {
+			return fmt.Errorf("error reading 'streams_cancelled': %w", err)
+		}
+		delete(object, "streams_cancelled")
+	}
+
+	if raw, found := object["streams_client_aborted"]; found {
+		err = json.Unmarshal(raw, &a.StreamsClientAborted)
+		if err != nil {
+			return fmt.Errorf("error reading 'streams_client_aborted': %w", err)
+		}
+		delete(object, "streams_client_aborted")
+	}
+
+	if raw, found := object["streams_completed"]; found {
+		err = json.Unmarshal(raw, &a.StreamsCompleted)
+		if err != nil {
+			return fmt.Errorf("error reading 'streams_completed': %w", err)
+		}
+		delete(object, "streams_completed")
+	}
+
+	if raw, found := object["streams_upstream_failed"]; found {
+		err = json.Unmarshal(raw, &a.StreamsUpstreamFailed)
+		if err != nil {
+			return fmt.Errorf("error reading 'streams_upstream_failed': %w", err)
+		}
+		delete(object, "streams_upstream_failed")
+	}
+
+	if raw, found := object["text_fallbacks"]; found {
+		err = json.Unmarshal(raw, &a.TextFallbacks)
+		if err != nil {
+			return fmt.Errorf("error reading 'text_fallbacks': %w", err)
+		}
+		delete(object, "text_fallbacks")
+	}
+
+	if raw, found := object["windows"]; found {
+		err = json.Unmarshal(raw, &a.Windows)
+		if err != nil {
+			return fmt.Errorf("error reading 'windows': %w", err)
+		}
+		delete(object, "windows")
+	}
+
+	if len(object) != 0 {
+		a.AdditionalProperties = make(map[string]interface{})
+		for fieldName, fieldBuf := range object {
+			var fieldVal interface{}
+			err := json.Unmarshal(fieldBuf, &fieldVal)
+			if err != nil {
+				return fmt.Errorf("error unmarshaling field %s: %w", fieldName, err)
+			}
+			a.AdditionalProperties[fieldName] = fieldVal
+		}
+	}
+	return nil
+}
+
+// Override default JSON handling for MetricsSnapshot to handle AdditionalProperties
+func (a MetricsSnapshot) MarshalJSON() ([]byte, error) {
+	var err error
+	object := make(map[string]json.RawMessage)
+
+	if a.AvgLatencyMs != nil {
+		object["avg_latency_ms"], err = json.Marshal(a.AvgLatencyMs)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'avg_latency_ms': %w", err)
+		}
+	}
+
+	if a.BytesSent != nil {
+		object["bytes_sent"], err = json.Marshal(a.BytesSent)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'bytes_sent': %w", err)
+		}
+	}
+
+	if a.DeprecatedModels != nil {
+		object["deprecated_models"], err = json.Marshal(a.DeprecatedModels)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'deprecated_models': %w", err)
+		}
+	}
+
+	if a.ErrorsTotal != nil {
+		object["errors_total"], err = json.Marshal(a.ErrorsTotal)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'errors_total': %w", err)
+		}
+	}
+
+	if a.Health != nil {
+		object["health"], err = json.Marshal(a.Health)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'health': %w", err)
+		}
+	}
+
+	if a.InFlight != nil {
+		object["in_flight"], err = json.Marshal(a.InFlight)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'in_flight': %w", err)
+		}
+	}
+
+	if a.Keys != nil {
+		object["keys"], err = json.Marshal(a.Keys)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'keys': %w", err)
+		}
+	}
+
+	if a.LoopsDetected != nil {
+		object["loops_detected"], err = json.Marshal(a.LoopsDetected)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'loops_detected': %w", err)
+		}
+	}
+
+	if a.MaxLatencyMs != nil {
+		object["max_latency_ms"], err = json.Marshal(a.MaxLatencyMs)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'max_latency_ms': %w", err)
+		}
+	}
+
+	if a.Models != nil {
+		object["models"], err = json.Marshal(a.Models)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'models': %w", err)
+		}
+	}
+
+	if a.Quotas != nil {
+		object["quotas"], err = json.Marshal(a.Quotas)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'quotas': %w", err)
+		}
+	}
+
+	if a.RequestsTotal != nil {
+		object["requests_total"], err = json.Marshal(a.RequestsTotal)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'requests_total': %w", err)
+		}
+	}
+
+	if a.Since != nil {
+		object["since"], err = json.Marshal(a.Since)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'since': %w", err)
+		}
+	}
+
+	if a.StreamsCancelled != nil {
+		object["streams_cancelled"], err = json.Marshal(a.StreamsCancelled)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'streams_cancelled': %w", err)
+		}
+	}
+
+	if a.StreamsClientAborted != nil {
+		object["streams_client_aborted"], err = json.Marshal(a.StreamsClientAborted)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'streams_client_aborted': %w", err)
+		}
+	}
+
+	if a.StreamsCompleted != nil {
+		object["streams_completed"], err = json.Marshal(a.StreamsCompleted)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'streams_completed': %w", err)
+		}
+	}
+
+	if a.StreamsUpstreamFailed != nil {
+		object["streams_upstream_failed"], err = json.Marshal(a.StreamsUpstreamFailed)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'streams_upstream_failed': %w", err)
+		}
+	}
+
+	if a.TextFallbacks != nil {
+		object["text_fallbacks"], err = json.Marshal(a.TextFallbacks)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'text_fallbacks': %w", err)
+		}
+	}
+
+	if a.Windows != nil {
+		object["windows"], err = json.Marshal(a.Windows)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling 'windows': %w", err)
+		}
+	}
+
+	for fieldName, field := range a.AdditionalProperties {
+		object[fieldName], err = json.Marshal(field)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling '%s': %w", fieldName, err)
+		}
+	}
+	return json.Marshal(object)
+}
+
 // AsResponsesInputItem0 returns the union data inside the ResponsesInputItem as a ResponsesInputItem0
 func (t ResponsesInputItem) AsResponsesInputItem0() (ResponsesInputItem0, error) {
 	var body ResponsesInputItem0
@@ -289,11 +1245,35 @@ type ServerInterface interface {
 	// (POST /v1/chat/completions)
 	CreateChatCompletion(w http.ResponseWriter, r *http.Request)
 
+	// (POST /v1/evals)
+	CreateEval(w http.ResponseWriter, r *http.Request, params CreateEvalParams)
+
+	// (GET /v1/evals/{eval_id})
+	GetEval(w http.ResponseWriter, r *http.Request, evalId string)
+
+	// (POST /v1/evals/{eval_id}/cancel)
+	CancelEval(w http.ResponseWriter, r *http.Request, evalId string)
+
+	// (GET /v1/evals/{eval_id}/results)
+	GetEvalResults(w http.ResponseWriter, r *http.Request, evalId string)
+
 	// (GET /v1/models)
 	ListModels(w http.ResponseWriter, r *http.Request)
 
 	// (POST /v1/responses)
 	CreateResponse(w http.ResponseWriter, r *http.Request)
+
+	// (DELETE /v1/responses/{response_id})
+	DeleteResponse(w http.ResponseWriter, r *http.Request, responseId string)
+
+	// (GET /v1/responses/{response_id})
+	GetResponse(w http.ResponseWriter, r *http.Request, responseId string, params GetResponseParams)
+
+	// (POST /v1/responses/{response_id}/cancel)
+	CancelResponse(w http.ResponseWriter, r *http.Request, responseId string)
+
+	// (GET /v1/responses/{response_id}/events)
+	StreamResponseEvents(w http.ResponseWriter, r *http.Request, responseId string, params StreamResponseEventsParams)
 }
 
 // ServerInterfaceWrapper converts contexts to parameters.
@@ -308,6 +1288,12 @@ type MiddlewareFunc func(http.Handler) http.Handler
 // CreateChatCompletion operation middleware
 func (siw *ServerInterfaceWrapper) CreateChatCompletion(w http.ResponseWriter, r *http.Request) {
 
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		siw.Handler.CreateChatCompletion(w, r)
 	}))
@@ -319,9 +1305,149 @@ func (siw *ServerInterfaceWrapper) CreateChatCompletion(w http.ResponseWriter, r
 	handler.ServeHTTP(w, r)
 }
 
+// CreateEval operation middleware
+func (siw *ServerInterfaceWrapper) CreateEval(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params CreateEvalParams
+
+	// ------------- Optional query parameter "models" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "models", r.URL.Query(), &params.Models)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "models", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "concurrency" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "concurrency", r.URL.Query(), &params.Concurrency)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "concurrency", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.CreateEval(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetEval operation middleware
+func (siw *ServerInterfaceWrapper) GetEval(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "eval_id" -------------
+	var evalId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "eval_id", r.PathValue("eval_id"), &evalId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "eval_id", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetEval(w, r, evalId)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// CancelEval operation middleware
+func (siw *ServerInterfaceWrapper) CancelEval(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "eval_id" -------------
+	var evalId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "eval_id", r.PathValue("eval_id"), &evalId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "eval_id", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.CancelEval(w, r, evalId)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetEvalResults operation middleware
+func (siw *ServerInterfaceWrapper) GetEvalResults(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "eval_id" -------------
+	var evalId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "eval_id", r.PathValue("eval_id"), &evalId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "eval_id", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetEvalResults(w, r, evalId)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
 // ListModels operation middleware
 func (siw *ServerInterfaceWrapper) ListModels(w http.ResponseWriter, r *http.Request) {
 
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		siw.Handler.ListModels(w, r)
 	}))
@@ -336,6 +1462,12 @@ func (siw *ServerInterfaceWrapper) ListModels(w http.ResponseWriter, r *http.Req
 // CreateResponse operation middleware
 func (siw *ServerInterfaceWrapper) CreateResponse(w http.ResponseWriter, r *http.Request) {
 
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		siw.Handler.CreateResponse(w, r)
 	}))
@@ -347,6 +1479,152 @@ func (siw *ServerInterfaceWrapper) CreateResponse(w http.ResponseWriter, r *http
 	handler.ServeHTTP(w, r)
 }
 
+// DeleteResponse operation middleware
+func (siw *ServerInterfaceWrapper) DeleteResponse(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "response_id" -------------
+	var responseId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "response_id", r.PathValue("response_id"), &responseId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "response_id", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteResponse(w, r, responseId)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetResponse operation middleware
+func (siw *ServerInterfaceWrapper) GetResponse(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "response_id" -------------
+	var responseId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "response_id", r.PathValue("response_id"), &responseId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "response_id", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetResponseParams
+
+	// ------------- Optional query parameter "include" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "include", r.URL.Query(), &params.Include)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "include", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetResponse(w, r, responseId, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// CancelResponse operation middleware
+func (siw *ServerInterfaceWrapper) CancelResponse(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "response_id" -------------
+	var responseId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "response_id", r.PathValue("response_id"), &responseId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "response_id", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.CancelResponse(w, r, responseId)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// StreamResponseEvents operation middleware
+func (siw *ServerInterfaceWrapper) StreamResponseEvents(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "response_id" -------------
+	var responseId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "response_id", r.PathValue("response_id"), &responseId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "response_id", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params StreamResponseEventsParams
+
+	// ------------- Optional query parameter "starting_after" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "starting_after", r.URL.Query(), &params.StartingAfter)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "starting_after", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.StreamResponseEvents(w, r, responseId, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
 type UnescapedCookieParamError struct {
 	ParamName string
 	Err       error
@@ -468,8 +1746,16 @@ func HandlerWithOptions(si ServerInterface, options StdHTTPServerOptions) http.H
 	}
 
 	m.HandleFunc("POST "+options.BaseURL+"/v1/chat/completions", wrapper.CreateChatCompletion)
+	m.HandleFunc("POST "+options.BaseURL+"/v1/evals", wrapper.CreateEval)
+	m.HandleFunc("GET "+options.BaseURL+"/v1/evals/{eval_id}", wrapper.GetEval)
+	m.HandleFunc("POST "+options.BaseURL+"/v1/evals/{eval_id}/cancel", wrapper.CancelEval)
+	m.HandleFunc("GET "+options.BaseURL+"/v1/evals/{eval_id}/results", wrapper.GetEvalResults)
 	m.HandleFunc("GET "+options.BaseURL+"/v1/models", wrapper.ListModels)
 	m.HandleFunc("POST "+options.BaseURL+"/v1/responses", wrapper.CreateResponse)
+	m.HandleFunc("DELETE "+options.BaseURL+"/v1/responses/{response_id}", wrapper.DeleteResponse)
+	m.HandleFunc("GET "+options.BaseURL+"/v1/responses/{response_id}", wrapper.GetResponse)
+	m.HandleFunc("POST "+options.BaseURL+"/v1/responses/{response_id}/cancel", wrapper.CancelResponse)
+	m.HandleFunc("GET "+options.BaseURL+"/v1/responses/{response_id}/events", wrapper.StreamResponseEvents)
 
 	return m
 }
@@ -7,27 +7,167 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type ClaudeAdapter struct {
-	bin       string
+	bin string
+	// models is the static list: CLAUDE_MODELS, or haiku, sonnet and opus,
+	// plus the aliases. ListModels discovers the account's models instead.
 	models    []string
+	aliases   []string
+	catalog   modelCatalog
+	opts      ClaudeOptions
 	checkAuth sync.Once
 	authErr   error
+	cooldown  cooldown
+	warmth    warmth
+	// version is the CLI's, once InspectBinary or a health check ran it.
+	version atomic.Pointer[cliVersion]
+}
+
+// ClaudeOptions holds extra `claude` CLI flags applied to every invocation,
+// plus per-model settings.
+type ClaudeOptions struct {
+	// Bin overrides CLAUDE_BIN; Env adds KEY=VALUE entries to the CLI's
+	// environment (e.g. a separate HOME for another subscription).
+	Bin    string
+	Env    []string
+	Args   []string
+	Models map[string]ClaudeModelOptions
+	// TextFallback is one of the TextFallback modes; empty means
+	// TextFallbackOn.
+	TextFallback string
+	// MaxTurns caps the agent turns of a run (--max-turns); zero leaves
+	// the CLI's default. Models may override it.
+	MaxTurns    int
+	Permissions PermissionPolicy
+}
+
+// ClaudeModelOptions customises requests for one model ID. With Base set the ID
+// is an alias: it is listed as a model of its own and runs Base, typically with
+// its own system prompt or agent definitions.
+type ClaudeModelOptions struct {
+	Base               string
+	Args               []string
+	SystemPrompt       string
+	AppendSystemPrompt string
+	// Agents is a JSON object passed to --agents.
+	Agents   string
+	MaxTurns int
 }
 
 func NewClaudeAdapter() *ClaudeAdapter {
+	return NewClaudeAdapterWithOptions(ClaudeOptions{})
+}
+
+func NewClaudeAdapterWithOptions(opts ClaudeOptions) *ClaudeAdapter {
+	models := parseClaudeModels(os.Getenv("CLAUDE_MODELS"))
+	var aliases []string
+	for id, m := range opts.Models {
+		if m.Base != "" && !slices.Contains(models, id) {
+			aliases = append(aliases, id)
+		}
+	}
+	sort.Strings(aliases)
+	bin := opts.Bin
+	if bin == "" {
+		bin = envOrDefault("CLAUDE_BIN", "claude")
+	}
 	return &ClaudeAdapter{
-		bin:    envOrDefault("CLAUDE_BIN", "claude"),
-		models: parseClaudeModels(os.Getenv("CLAUDE_MODELS")),
+		bin:     bin,
+		models:  append(models, aliases...),
+		aliases: aliases,
+		opts:    opts,
+	}
+}
+
+var claudeStreamArgs = []string{"--verbose", "--output-format", "stream-json", "--include-partial-messages"}
+
+// streamArgs are claudeStreamArgs minus what the installed CLI lacks.
+func (a *ClaudeAdapter) streamArgs() []string {
+	if v := a.version.Load(); v != nil && v.less(claudePartialMessagesVersion) {
+		return claudeStreamArgs[:len(claudeStreamArgs)-1]
 	}
+	return claudeStreamArgs
+}
+
+// cliArgs builds a `claude -p` invocation. Configured flags go right after -p
+// so variadic ones such as --allowedTools are terminated by the adapter's own
+// flags instead of swallowing the prompt. safety is the request's preset.
+func (a *ClaudeAdapter) cliArgs(model, safety, prompt string, output ...string) []string {
+	m := a.opts.Models[model]
+	args := []string{"-p"}
+	args = append(args, a.opts.Args...)
+	args = append(args, m.Args...)
+	if m.SystemPrompt != "" {
+		args = append(args, "--system-prompt", m.SystemPrompt)
+	}
+	if m.AppendSystemPrompt != "" {
+		args = append(args, "--append-system-prompt", m.AppendSystemPrompt)
+	}
+	if m.Agents != "" {
+		args = append(args, "--agents", m.Agents)
+	}
+	if n := a.maxTurns(model); n > 0 {
+		args = append(args, "--max-turns", strconv.Itoa(n))
+	}
+	args = append(args, output...)
+	if m.Base != "" {
+		model = m.Base
+	}
+	args = append(args, "--model", model)
+	args = append(args, claudeSafetyArgs(safety)...)
+	if a.promptViaStdin(prompt) {
+		return args
+	}
+	return append(args, prompt)
+}
+
+// BaseModel returns the model an alias configured with Base runs.
+func (a *ClaudeAdapter) BaseModel(model string) string {
+	return a.opts.Models[model].Base
+}
+
+func (a *ClaudeAdapter) maxTurns(model string) int {
+	if n := a.opts.Models[model].MaxTurns; n > 0 {
+		return n
+	}
+	return a.opts.MaxTurns
+}
+
+// maxArgvPrompt is the largest prompt passed as an argument. Linux caps a
+// single argument at 128 KiB, so anything near that goes over stdin, which
+// `claude -p` reads when no prompt argument is given.
+const maxArgvPrompt = 32 << 10
+
+// promptViaStdin reports whether the prompt goes over stdin. It always does
+// when the CLI is a .cmd or .bat shim, as npm installs it on Windows:
+// cmd.exe would otherwise run whatever the prompt puts after an `&`.
+func (a *ClaudeAdapter) promptViaStdin(prompt string) bool {
+	return len(prompt) > maxArgvPrompt || batchShim(resolveBin(a.bin))
+}
+
+func (a *ClaudeAdapter) command(ctx context.Context, model string, prompt string, output ...string) *exec.Cmd {
+	a.warmth.touch(model)
+	cmd := newCommand(ctx, a.bin, a.cliArgs(model, SafetyFromContext(ctx), prompt, output...)...)
+	cmd.Env = commandEnv(a.opts.Env)
+	if a.promptViaStdin(prompt) {
+		cmd.Stdin = strings.NewReader(prompt)
+	}
+	return cmd
 }
 
 func parseClaudeModels(raw string) []string {
@@ -62,17 +202,20 @@ func (a *ClaudeAdapter) ListModels(ctx context.Context) ([]Model, error) {
 	if err := a.ensureSubscriptionMode(); err != nil {
 		return nil, err
 	}
-	out := make([]Model, 0, len(a.models))
-	for _, m := range a.models {
-		out = append(out, Model{ID: m, Backend: BackendClaude})
-	}
-	return out, nil
+	return a.catalog.get(ctx, a.fetchModels)
 }
 
-func (a *ClaudeAdapter) SupportsModel(_ context.Context, model string) (bool, error) {
+func (a *ClaudeAdapter) SupportsModel(ctx context.Context, model string) (bool, error) {
 	model = strings.TrimSpace(model)
-	for _, m := range a.models {
-		if m == model {
+	if slices.Contains(a.models, model) {
+		return true, nil
+	}
+	models, err := a.ListModels(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range models {
+		if m.ID == model {
 			return true, nil
 		}
 	}
@@ -86,6 +229,9 @@ func (a *ClaudeAdapter) Chat(ctx context.Context, req ChatRequest) (ChatResponse
 	model := req.Model
 	prompt := buildChatPrompt(req.Messages)
 	out, err := a.runClaudeText(ctx, model, prompt)
+	if errors.Is(err, errTurnLimit) {
+		return ChatResponse{Model: req.Model, Text: turnLimitNotice(a.maxTurns(model)), Incomplete: IncompleteMaxTurns}, nil
+	}
 	if err != nil {
 		return ChatResponse{}, err
 	}
@@ -102,50 +248,31 @@ func (a *ClaudeAdapter) ChatStream(ctx context.Context, req ChatRequest, onDelta
 	model := req.Model
 	prompt := buildChatPrompt(req.Messages)
 
-	text, emitted, err := a.runClaudeStream(ctx, model, prompt, onDelta)
-	if err != nil {
-		fallback, fbErr := a.runClaudeText(ctx, model, prompt)
-		if fbErr != nil {
-			return ChatResponse{}, fbErr
-		}
-		text = strings.TrimSpace(fallback)
-		if !emitted && onDelta != nil && text != "" {
-			if cbErr := onDelta(text); cbErr != nil {
-				return ChatResponse{}, cbErr
-			}
-		}
-		return ChatResponse{Model: req.Model, Text: text}, nil
-	}
-	if strings.TrimSpace(text) == "" {
-		fallback, fbErr := a.runClaudeText(ctx, model, prompt)
+	text, emitted, incomplete, err := a.runClaudeStream(ctx, model, prompt, "", onDelta)
+	if err != nil || strings.TrimSpace(text) == "" {
+		fallback, ok, fbErr := a.textFallback(ctx, model, prompt, err)
 		if fbErr != nil {
 			return ChatResponse{}, fbErr
 		}
-		text = strings.TrimSpace(fallback)
-		if !emitted && onDelta != nil && text != "" {
-			if err := onDelta(text); err != nil {
-				return ChatResponse{}, err
+		if ok {
+			text = fallback
+			if !emitted && onDelta != nil && text != "" {
+				if cbErr := onDelta(text); cbErr != nil {
+					return ChatResponse{}, cbErr
+				}
 			}
 		}
 	}
-	return ChatResponse{Model: req.Model, Text: text}, nil
+	return ChatResponse{Model: req.Model, Text: text, Incomplete: incomplete}, nil
 }
 
 func (a *ClaudeAdapter) Respond(ctx context.Context, req ResponsesRequest) (ResponsesResponse, error) {
 	if err := a.ensureSubscriptionMode(); err != nil {
 		return ResponsesResponse{}, err
 	}
-	model := req.Model
-	prompt := buildResponsesPrompt(req.Input)
-	out, err := a.runClaudeText(ctx, model, prompt)
-	if err != nil {
-		return ResponsesResponse{}, err
-	}
-	return ResponsesResponse{
-		Model:     req.Model,
-		Text:      strings.TrimSpace(out),
-		Reasoning: "",
-	}, nil
+	// Go through stream-json so thinking blocks are kept; plain text output
+	// only carries the final answer.
+	return a.RespondStreamEvents(ctx, req, nil)
 }
 
 func (a *ClaudeAdapter) RespondStream(ctx context.Context, req ResponsesRequest, onDelta func(string) error) (ResponsesResponse, error) {
@@ -153,35 +280,24 @@ func (a *ClaudeAdapter) RespondStream(ctx context.Context, req ResponsesRequest,
 		return ResponsesResponse{}, err
 	}
 	model := req.Model
-	prompt := buildResponsesPrompt(req.Input)
+	prompt, resume := claudeResponsesPrompt(req)
 
-	text, emitted, err := a.runClaudeStream(ctx, model, prompt, onDelta)
-	if err != nil {
-		fallback, fbErr := a.runClaudeText(ctx, model, prompt)
-		if fbErr != nil {
-			return ResponsesResponse{}, fbErr
-		}
-		text = strings.TrimSpace(fallback)
-		if !emitted && onDelta != nil && text != "" {
-			if cbErr := onDelta(text); cbErr != nil {
-				return ResponsesResponse{}, cbErr
-			}
-		}
-		return ResponsesResponse{Model: req.Model, Text: text}, nil
-	}
-	if strings.TrimSpace(text) == "" {
-		fallback, fbErr := a.runClaudeText(ctx, model, prompt)
+	text, emitted, incomplete, err := a.runClaudeStream(ctx, model, prompt, resume, onDelta)
+	if err != nil || strings.TrimSpace(text) == "" {
+		fallback, ok, fbErr := a.textFallback(ctx, model, buildResponsesPrompt(req.Input), err)
 		if fbErr != nil {
 			return ResponsesResponse{}, fbErr
 		}
-		text = strings.TrimSpace(fallback)
-		if !emitted && onDelta != nil && text != "" {
-			if err := onDelta(text); err != nil {
-				return ResponsesResponse{}, err
+		if ok {
+			text = fallback
+			if !emitted && onDelta != nil && text != "" {
+				if cbErr := onDelta(text); cbErr != nil {
+					return ResponsesResponse{}, cbErr
+				}
 			}
 		}
 	}
-	return ResponsesResponse{Model: req.Model, Text: text, Reasoning: ""}, nil
+	return ResponsesResponse{Model: req.Model, Text: text, Incomplete: incomplete}, nil
 }
 
 func (a *ClaudeAdapter) RespondStreamEvents(ctx context.Context, req ResponsesRequest, onEvent func(ResponseEvent) error) (ResponsesResponse, error) {
@@ -189,268 +305,364 @@ func (a *ClaudeAdapter) RespondStreamEvents(ctx context.Context, req ResponsesRe
 		return ResponsesResponse{}, err
 	}
 	model := req.Model
-	prompt := buildResponsesPrompt(req.Input)
+	prompt, resume := claudeResponsesPrompt(req)
 
-	text, reasoning, emittedOutput, emittedReasoning, err := a.runClaudeStreamEvents(ctx, model, prompt, onEvent)
-	if err != nil {
-		fallback, fbErr := a.runClaudeText(ctx, model, prompt)
+	run, err := a.runClaudeStreamEvents(ctx, model, prompt, resume, onEvent)
+	text, reasoning := run.text, run.reasoning
+	if err != nil || strings.TrimSpace(text) == "" {
+		// The rerun starts a new session, so it needs the whole transcript.
+		fallback, ok, fbErr := a.textFallback(ctx, model, buildResponsesPrompt(req.Input), err)
 		if fbErr != nil {
 			return ResponsesResponse{}, fbErr
 		}
-		text = strings.TrimSpace(fallback)
-		if onEvent != nil && !emittedOutput && text != "" {
-			if cbErr := onEvent(ResponseEvent{Kind: ResponseEventOutput, Delta: text}); cbErr != nil {
-				return ResponsesResponse{}, cbErr
+		if ok {
+			text = fallback
+			run.sessionID = ""
+			run.usage, run.incomplete = nil, ""
+			if onEvent != nil && !run.emittedOutput && text != "" {
+				if cbErr := onEvent(ResponseEvent{Kind: ResponseEventOutput, Delta: text}); cbErr != nil {
+					return ResponsesResponse{}, cbErr
+				}
 			}
 		}
-		return ResponsesResponse{Model: req.Model, Text: text, Reasoning: strings.TrimSpace(reasoning)}, nil
-	}
-	if strings.TrimSpace(text) == "" {
-		fallback, fbErr := a.runClaudeText(ctx, model, prompt)
-		if fbErr != nil {
-			return ResponsesResponse{}, fbErr
-		}
-		text = strings.TrimSpace(fallback)
-		if onEvent != nil && !emittedOutput && text != "" {
-			if cbErr := onEvent(ResponseEvent{Kind: ResponseEventOutput, Delta: text}); cbErr != nil {
-				return ResponsesResponse{}, cbErr
-			}
+		if err != nil {
+			return ResponsesResponse{Model: req.Model, Text: text, Reasoning: reasoning}, nil
 		}
 	}
-	if onEvent != nil && !emittedReasoning && strings.TrimSpace(reasoning) != "" {
-		if cbErr := onEvent(ResponseEvent{Kind: ResponseEventReasoning, Delta: strings.TrimSpace(reasoning)}); cbErr != nil {
+	if onEvent != nil && !run.emittedReasoning && reasoning != "" {
+		if cbErr := onEvent(ResponseEvent{Kind: ResponseEventReasoning, Delta: reasoning}); cbErr != nil {
 			return ResponsesResponse{}, cbErr
 		}
 	}
-	return ResponsesResponse{Model: req.Model, Text: text, Reasoning: strings.TrimSpace(reasoning)}, nil
+	return ResponsesResponse{Model: req.Model, Text: text, Reasoning: reasoning, ThreadID: run.sessionID, Usage: run.usage, Incomplete: run.incomplete}, nil
 }
 
-func (a *ClaudeAdapter) runClaudeText(ctx context.Context, model string, prompt string) (string, error) {
-	args := []string{
-		"-p",
-		"--output-format", "text",
-		"--model", model,
+// claudeResponsesPrompt returns the prompt for req and the session it
+// continues, if any.
+func claudeResponsesPrompt(req ResponsesRequest) (string, string) {
+	if c := req.Continue; c != nil && c.ThreadID != "" {
+		return buildResponsesPrompt(c.Input), c.ThreadID
 	}
-	if YOLOEnabled() {
-		args = append(args, "--dangerously-skip-permissions")
+	return buildResponsesPrompt(req.Input), ""
+}
+
+// Claude text fallback modes. A stream that fails or yields no text is run
+// again with plain text output, which costs a second call: TextFallbackOn
+// does so in both cases, TextFallbackOnError only when the stream failed and
+// TextFallbackOff never, returning the stream's error or empty answer.
+const (
+	TextFallbackOn      = "on"
+	TextFallbackOnError = "on_error"
+	TextFallbackOff     = "off"
+)
+
+// textFallback reruns prompt as plain text after a stream that failed with
+// streamErr or, when streamErr is nil, came back empty. When the fallback
+// mode rules that out, ok is false and err is streamErr.
+func (a *ClaudeAdapter) textFallback(ctx context.Context, model string, prompt string, streamErr error) (text string, ok bool, err error) {
+	var permission *PermissionPromptError
+	if errors.As(streamErr, &permission) {
+		// A rerun would stop at the same prompt.
+		return "", false, streamErr
+	}
+	switch ClassifyError(streamErr, "") {
+	case ErrorResourceLimit:
+		// A rerun would run into the same limit.
+		return "", false, streamErr
+	case ErrorOutputTooLarge:
+		// The client is told its output was too large rather than
+		// charged for a rerun of the whole agent in text mode.
+		return "", false, streamErr
+	}
+	switch a.opts.TextFallback {
+	case TextFallbackOff:
+		return "", false, streamErr
+	case TextFallbackOnError:
+		if streamErr == nil {
+			return "", false, nil
+		}
 	}
-	args = append(args, prompt)
-	cmd := exec.CommandContext(ctx, a.bin, args...)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	out, err := cmd.Output()
+	TraceFromContext(ctx).addTextFallback()
+	out, err := a.runClaudeText(ctx, model, prompt)
+	return strings.TrimSpace(out), true, err
+}
+
+func (a *ClaudeAdapter) runClaudeText(ctx context.Context, model string, prompt string) (string, error) {
+	if err := a.cooldown.check(model); err != nil {
+		return "", err
+	}
+	cmd := a.command(ctx, model, prompt, "--output-format", "text")
+	dump := a.openDump(cmd, prompt)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderrWriter(ctx, &stderr)
+	timer := startCLITimer(ctx)
+	err := startCommand(cmd)
+	if err == nil {
+		timer.spawned()
+		err = waitCommand(cmd)
+	}
+	timer.done()
+	out := stdout.Bytes()
+	dump.record("stdout", string(out))
+	if err != nil && claudeTurnLimitPattern.Match(out) {
+		err = errTurnLimit
+	} else if err != nil {
+		err = a.failure(model, "claude command", err, stderr.String(), claudeTextFailure(out))
+	}
+	dump.exit(err)
 	if err != nil {
-		return "", fmt.Errorf("claude command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		return "", err
 	}
-	return string(out), nil
+	return sanitizeText(string(out)), nil
 }
 
-func (a *ClaudeAdapter) runClaudeStream(ctx context.Context, model string, prompt string, onDelta func(string) error) (string, bool, error) {
-	args := []string{
-		"-p",
-		"--verbose",
-		"--output-format", "stream-json",
-		"--include-partial-messages",
-		"--model", model,
+func (a *ClaudeAdapter) runClaudeStream(ctx context.Context, model string, prompt string, resume string, onDelta func(string) error) (text string, emitted bool, incomplete string, err error) {
+	if err := a.cooldown.check(model); err != nil {
+		return "", false, "", err
 	}
-	if YOLOEnabled() {
-		args = append(args, "--dangerously-skip-permissions")
+	output := a.streamArgs()
+	if resume != "" {
+		output = append([]string{"--resume", resume}, output...)
 	}
-	args = append(args, prompt)
-	cmd := exec.CommandContext(ctx, a.bin, args...)
+	cmd := a.command(ctx, model, prompt, output...)
+	dump := a.openDump(cmd, prompt)
+	defer dump.exit(nil)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return "", false, err
+		return "", false, "", err
 	}
 	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Start(); err != nil {
-		return "", false, err
+	cmd.Stderr = stderrWriter(ctx, &stderr)
+	timer := startCLITimer(ctx)
+	defer timer.done()
+	if err := startCommand(cmd); err != nil {
+		return "", false, "", err
 	}
+	watch := a.watchPrompts(ctx, cmd)
+	defer watch.stop()
 
-	scanner := bufio.NewScanner(stdout)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	scanner := newLineReader(stdout)
 	var out strings.Builder
-	emitted := false
-	lastByIndex := map[string]string{}
+	parser := a.streamParser()
+	clean := newOutputSanitizer()
+	emit := func(events []ResponseEvent) error {
+		for _, ev := range events {
+			if ev.Kind != ResponseEventOutput {
+				continue
+			}
+			out.WriteString(ev.Delta)
+			emitted = true
+			if onDelta != nil {
+				if err := onDelta(ev.Delta); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
 
 	for scanner.Scan() {
+		dump.record("stdout", scanner.Text())
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
 			continue
 		}
-		ev, ok := extractClaudeEvent(line, lastByIndex)
-		if !ok || ev.Delta == "" || ev.Kind != ResponseEventOutput {
-			continue
+		events := parser.parse(line)
+		watch.line(events)
+		if len(events) > 0 {
+			timer.firstByte()
+		} else {
+			timer.spawned()
 		}
-		out.WriteString(ev.Delta)
-		emitted = true
-		if onDelta != nil {
-			if err := onDelta(ev.Delta); err != nil {
-				_ = cmd.Process.Kill()
-				_ = cmd.Wait()
-				return "", emitted, err
-			}
+		if err := emit(clean.events(events)); err != nil {
+			_ = killProcess(cmd)
+			_ = waitCommand(cmd)
+			return "", emitted, "", err
 		}
 	}
 	if scanErr := scanner.Err(); scanErr != nil {
-		_ = cmd.Process.Kill()
-		_ = cmd.Wait()
-		return "", emitted, scanErr
-	}
-	if err := cmd.Wait(); err != nil {
-		return "", emitted, fmt.Errorf("claude stream command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		_ = killProcess(cmd)
+		_ = waitCommand(cmd)
+		scanErr = fmt.Errorf("claude stream output: %w", scanErr)
+		dump.exit(scanErr)
+		return "", emitted, "", scanErr
+	}
+	waitErr := waitCommand(cmd)
+	if err := watch.stop(); err != nil {
+		dump.exit(err)
+		return "", emitted, "", err
+	}
+	if err := waitErr; err != nil && !parser.turnLimit {
+		err = a.failure(model, "claude stream command", err, stderr.String(), parser.failure())
+		dump.exit(err)
+		return "", emitted, "", err
+	}
+	if err := emit(clean.finish(parser.finish())); err != nil {
+		return "", emitted, "", err
+	}
+	if parser.turnLimit && !emitted {
+		if err := emit([]ResponseEvent{{Kind: ResponseEventOutput, Delta: turnLimitNotice(a.maxTurns(model))}}); err != nil {
+			return "", emitted, "", err
+		}
 	}
-	return strings.TrimSpace(out.String()), emitted, nil
+	return strings.TrimSpace(out.String()), emitted, parser.incomplete(), nil
+}
+
+// claudeRun is what a stream-json run produced.
+type claudeRun struct {
+	text             string
+	reasoning        string
+	emittedOutput    bool
+	emittedReasoning bool
+	// sessionID is the CLI's session, which resume continues.
+	sessionID string
+	usage     *Usage
+	// incomplete is set when the answer was cut off by the output limit.
+	incomplete string
 }
 
-func (a *ClaudeAdapter) runClaudeStreamEvents(ctx context.Context, model string, prompt string, onEvent func(ResponseEvent) error) (string, string, bool, bool, error) {
-	args := []string{
-		"-p",
-		"--verbose",
-		"--output-format", "stream-json",
-		"--include-partial-messages",
-		"--model", model,
+// runClaudeStreamEvents runs prompt with stream-json output, as a new session
+// or, when resume is set, continuing that session.
+func (a *ClaudeAdapter) runClaudeStreamEvents(ctx context.Context, model string, prompt string, resume string, onEvent func(ResponseEvent) error) (claudeRun, error) {
+	if err := a.cooldown.check(model); err != nil {
+		return claudeRun{}, err
 	}
-	if YOLOEnabled() {
-		args = append(args, "--dangerously-skip-permissions")
+	output := a.streamArgs()
+	if resume != "" {
+		output = append([]string{"--resume", resume}, output...)
 	}
-	args = append(args, prompt)
-	cmd := exec.CommandContext(ctx, a.bin, args...)
+	cmd := a.command(ctx, model, prompt, output...)
+	dump := a.openDump(cmd, prompt)
+	defer dump.exit(nil)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return "", "", false, false, err
+		return claudeRun{}, err
 	}
 	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Start(); err != nil {
-		return "", "", false, false, err
+	cmd.Stderr = stderrWriter(ctx, &stderr)
+	timer := startCLITimer(ctx)
+	defer timer.done()
+	if err := startCommand(cmd); err != nil {
+		return claudeRun{}, err
 	}
+	watch := a.watchPrompts(ctx, cmd)
+	defer watch.stop()
 
-	scanner := bufio.NewScanner(stdout)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-	var output strings.Builder
+	scanner := newLineReader(stdout)
+	var text strings.Builder
 	var reasoning strings.Builder
 	emittedOutput := false
 	emittedReasoning := false
-	lastByIndex := map[string]string{}
+	parser := a.streamParser()
+	clean := newOutputSanitizer()
+	emit := func(events []ResponseEvent) error {
+		for _, ev := range events {
+			switch ev.Kind {
+			case ResponseEventReasoning:
+				reasoning.WriteString(ev.Delta)
+				emittedReasoning = true
+			case ResponseEventOutput:
+				text.WriteString(ev.Delta)
+				emittedOutput = true
+			}
+			if onEvent != nil {
+				if err := onEvent(ev); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
 
 	for scanner.Scan() {
+		dump.record("stdout", scanner.Text())
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
 			continue
 		}
-		ev, ok := extractClaudeEvent(line, lastByIndex)
-		if !ok || ev.Delta == "" {
-			continue
-		}
-		if ev.Kind == ResponseEventReasoning {
-			reasoning.WriteString(ev.Delta)
-			emittedReasoning = true
+		events := parser.parse(line)
+		watch.line(events)
+		if len(events) > 0 {
+			timer.firstByte()
 		} else {
-			output.WriteString(ev.Delta)
-			emittedOutput = true
-		}
-		if onEvent != nil {
-			if err := onEvent(ev); err != nil {
-				_ = cmd.Process.Kill()
-				_ = cmd.Wait()
-				return "", "", emittedOutput, emittedReasoning, err
-			}
+			timer.spawned()
+		}
+		if err := emit(clean.events(events)); err != nil {
+			_ = killProcess(cmd)
+			_ = waitCommand(cmd)
+			return claudeRun{emittedOutput: emittedOutput, emittedReasoning: emittedReasoning}, err
 		}
 	}
 	if scanErr := scanner.Err(); scanErr != nil {
-		_ = cmd.Process.Kill()
-		_ = cmd.Wait()
-		return "", "", emittedOutput, emittedReasoning, scanErr
-	}
-	if err := cmd.Wait(); err != nil {
-		return "", "", emittedOutput, emittedReasoning, fmt.Errorf("claude stream command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		_ = killProcess(cmd)
+		_ = waitCommand(cmd)
+		scanErr = fmt.Errorf("claude stream output: %w", scanErr)
+		dump.exit(scanErr)
+		return claudeRun{emittedOutput: emittedOutput, emittedReasoning: emittedReasoning}, scanErr
+	}
+	waitErr := waitCommand(cmd)
+	if err := watch.stop(); err != nil {
+		dump.exit(err)
+		return claudeRun{emittedOutput: emittedOutput, emittedReasoning: emittedReasoning}, err
+	}
+	if err := waitErr; err != nil && !parser.turnLimit {
+		err = a.failure(model, "claude stream command", err, stderr.String(), parser.failure())
+		dump.exit(err)
+		return claudeRun{emittedOutput: emittedOutput, emittedReasoning: emittedReasoning}, err
+	}
+	if err := emit(clean.finish(parser.finish())); err != nil {
+		return claudeRun{emittedOutput: emittedOutput, emittedReasoning: emittedReasoning}, err
+	}
+	if parser.turnLimit && !emittedOutput {
+		if err := emit([]ResponseEvent{{Kind: ResponseEventOutput, Delta: turnLimitNotice(a.maxTurns(model))}}); err != nil {
+			return claudeRun{emittedOutput: emittedOutput, emittedReasoning: emittedReasoning}, err
+		}
 	}
-	return strings.TrimSpace(output.String()), strings.TrimSpace(reasoning.String()), emittedOutput, emittedReasoning, nil
+	reasoningText := reasoning.String()
+	if !emittedReasoning {
+		reasoningText = sanitizeText(parser.reasoning())
+	}
+	return claudeRun{
+		text:             strings.TrimSpace(text.String()),
+		reasoning:        strings.TrimSpace(reasoningText),
+		emittedOutput:    emittedOutput,
+		emittedReasoning: emittedReasoning,
+		sessionID:        parser.sessionID,
+		usage:            parser.usage,
+		incomplete:       parser.incomplete(),
+	}, nil
 }
 
-func extractClaudeEvent(line string, lastByIndex map[string]string) (ResponseEvent, bool) {
-	var raw map[string]any
-	if err := json.Unmarshal([]byte(line), &raw); err != nil {
-		return ResponseEvent{}, false
-	}
-
-	// claude stream-json wraps token deltas inside {"type":"stream_event","event":{...}}
-	// while other entries may include top-level assistant/message objects.
-	if strings.EqualFold(stringVal(raw["type"]), "stream_event") {
-		if ev, ok := raw["event"].(map[string]any); ok {
-			raw = ev
-		}
+// openDump starts the upstream dump of cmd, when dumping is on. A prompt too
+// long for the command line is recorded as stdin.
+func (a *ClaudeAdapter) openDump(cmd *exec.Cmd, prompt string) *upstreamDump {
+	dump := openUpstreamDump(BackendClaude, cmd.Args)
+	if cmd.Stdin != nil {
+		dump.record("stdin", prompt)
 	}
+	return dump
+}
 
-	typ := stringVal(raw["type"])
-	switch typ {
-	case "content_block_delta":
-		if d, ok := raw["delta"].(map[string]any); ok {
-			if t := stringVal(d["thinking"]); t != "" {
-				return ResponseEvent{Kind: ResponseEventReasoning, Delta: t}, true
-			}
-			if t := stringVal(d["text"]); t != "" {
-				return ResponseEvent{Kind: ResponseEventOutput, Delta: t}, true
-			}
-		}
-	case "content_block_start":
-		if cb, ok := raw["content_block"].(map[string]any); ok {
-			if t := stringVal(cb["thinking"]); t != "" {
-				return ResponseEvent{Kind: ResponseEventReasoning, Delta: t}, true
-			}
-			if t := stringVal(cb["text"]); t != "" {
-				return ResponseEvent{Kind: ResponseEventOutput, Delta: t}, true
-			}
-		}
-	case "message_delta":
-		if d, ok := raw["delta"].(map[string]any); ok {
-			if t := stringVal(d["text"]); t != "" {
-				return ResponseEvent{Kind: ResponseEventOutput, Delta: t}, true
-			}
-		}
+// failure describes a failed claude run of model. The CLI prints some
+// errors, usage limits among them, as its answer on stdout; reported is that
+// error, which starts a cooldown of model when it is a usage limit.
+func (a *ClaudeAdapter) failure(model string, what string, err error, stderr string, reported *UpstreamError) error {
+	if reported == nil {
+		return fmt.Errorf("%s failed: %w: %s", what, err, sanitizeText(strings.TrimSpace(stderr)))
 	}
+	reported.Message = sanitizeText(strings.TrimSpace(reported.Message))
+	reported.Err = err
+	return a.cooldown.observe(BackendClaude, model, fmt.Errorf("%s failed: %w", what, reported))
+}
 
-	// Fallback parser for legacy shapes that expose growing partial content.
-	// Skip assistant/user snapshots when stream_event deltas are available to avoid duplicates.
-	if msg, ok := raw["message"].(map[string]any); ok && !strings.EqualFold(typ, "assistant") && !strings.EqualFold(typ, "user") {
-		if content, ok := msg["content"].([]any); ok {
-			for idx, it := range content {
-				item, ok := it.(map[string]any)
-				if !ok {
-					continue
-				}
-				full := stringVal(item["text"])
-				kind := ResponseEventOutput
-				if strings.EqualFold(stringVal(item["type"]), "thinking") {
-					full = stringVal(item["thinking"])
-					kind = ResponseEventReasoning
-				}
-				if full == "" {
-					continue
-				}
-				cacheKey := fmt.Sprintf("%d:%s", idx, kind)
-				prev := lastByIndex[cacheKey]
-				if strings.HasPrefix(full, prev) {
-					delta := strings.TrimPrefix(full, prev)
-					lastByIndex[cacheKey] = full
-					if delta != "" {
-						return ResponseEvent{Kind: kind, Delta: delta}, true
-					}
-				} else if prev == "" {
-					lastByIndex[cacheKey] = full
-					return ResponseEvent{Kind: kind, Delta: full}, true
-				} else {
-					// New assistant message or reset of the same index; emit full text again.
-					lastByIndex[cacheKey] = full
-					return ResponseEvent{Kind: kind, Delta: full}, true
-				}
-			}
-		}
+// claudeTextFailure is the error a failed text-mode run printed as its
+// answer, if it printed one.
+func claudeTextFailure(out []byte) *UpstreamError {
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil
 	}
-
-	return ResponseEvent{}, false
+	return &UpstreamError{Message: string(out)}
 }
 
 func stringVal(v any) string {
@@ -468,19 +680,140 @@ func stringVal(v any) string {
 
 type CodexAdapter struct {
 	bin       string
+	opts      CodexOptions
 	checkAuth sync.Once
 	authErr   error
+	catalog   modelCatalog
+	quota     quotaCache
+	cooldown  cooldown
+	warmth    warmth
+	version   atomic.Pointer[cliVersion]
+	// served is when an app-server last answered; see HealthCheck.
+	served serverSeen
+	// spare is the app-server Warmup left for the first turn.
+	spare codexSpare
+}
+
+// CodexTurnOptions are thread and turn settings passed to the Codex
+// app-server. Empty fields keep Codex's own defaults.
+type CodexTurnOptions struct {
+	Sandbox        string // read-only, workspace-write, danger-full-access
+	ApprovalPolicy string // untrusted, on-failure, on-request, never
+	Cwd            string
+	Effort         string
+	WebSearch      *bool
+	// MaxTurns stops a turn at its MaxTurns-th tool call. The app-server
+	// has no limit of its own; this matches Claude's --max-turns, where
+	// each round of tool calls takes a turn and the answer one more.
+	MaxTurns int
+	// keepThread saves the thread so a later turn can resume it, as that
+	// turn does with resume.
+	keepThread bool
+	resume     string
+	// safety is the preset withSafety applied.
+	safety string
+}
+
+// CodexOptions holds default turn options and per-model overrides; set fields
+// of a model entry replace the defaults.
+type CodexOptions struct {
+	CodexTurnOptions
+	Models map[string]CodexTurnOptions
+	// Bin overrides CODEX_BIN; Env adds KEY=VALUE entries to the CLI's
+	// environment (e.g. CODEX_HOME for another ChatGPT account).
+	Bin string
+	Env []string
+	// KeepThreads saves threads instead of making them ephemeral, so
+	// /v1/responses follow-ups such as tool outputs can continue them.
+	KeepThreads bool
+	Permissions PermissionPolicy
+}
+
+func (o CodexOptions) forModel(model string) CodexTurnOptions {
+	out := o.CodexTurnOptions
+	m, ok := o.Models[model]
+	if !ok {
+		return out
+	}
+	if m.Sandbox != "" {
+		out.Sandbox = m.Sandbox
+	}
+	if m.ApprovalPolicy != "" {
+		out.ApprovalPolicy = m.ApprovalPolicy
+	}
+	if m.Cwd != "" {
+		out.Cwd = m.Cwd
+	}
+	if m.Effort != "" {
+		out.Effort = m.Effort
+	}
+	if m.WebSearch != nil {
+		out.WebSearch = m.WebSearch
+	}
+	if m.MaxTurns > 0 {
+		out.MaxTurns = m.MaxTurns
+	}
+	return out
 }
 
 func NewCodexAdapter() *CodexAdapter {
-	return &CodexAdapter{bin: envOrDefault("CODEX_BIN", "codex")}
+	return NewCodexAdapterWithOptions(CodexOptions{})
+}
+
+func NewCodexAdapterWithOptions(opts CodexOptions) *CodexAdapter {
+	bin := opts.Bin
+	if bin == "" {
+		bin = envOrDefault("CODEX_BIN", "codex")
+	}
+	return &CodexAdapter{bin: bin, opts: opts}
+}
+
+// WithEnv returns a copy of the adapter whose CLI runs with extra environment
+// entries on top of its own, e.g. a different CODEX_HOME.
+func (a *CodexAdapter) WithEnv(extra ...string) *CodexAdapter {
+	opts := a.opts
+	opts.Env = append(slices.Clone(a.opts.Env), extra...)
+	return &CodexAdapter{bin: a.bin, opts: opts}
+}
+
+// codexHome is where the CLI keeps its auth, honouring CODEX_HOME and HOME
+// overrides from the adapter's environment.
+func (a *CodexAdapter) codexHome() string {
+	if v := lookupEnv(a.opts.Env, "CODEX_HOME"); v != "" {
+		return v
+	}
+	if v := lookupEnv(a.opts.Env, "HOME"); v != "" {
+		return filepath.Join(v, ".codex")
+	}
+	if v := lookupEnv(a.opts.Env, "USERPROFILE"); v != "" && runtime.GOOS == "windows" {
+		return filepath.Join(v, ".codex")
+	}
+	if v := os.Getenv("CODEX_HOME"); v != "" {
+		return v
+	}
+	home := UserHome()
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".codex")
+}
+
+// UserHome is the user's home directory: HOME, else the passwd entry, as
+// containers often run without HOME. It is "" when neither is known.
+func UserHome() string {
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		return home
+	}
+	if u, err := user.Current(); err == nil && u.HomeDir != "" && u.HomeDir != "/" {
+		return u.HomeDir
+	}
+	return ""
 }
 
 func (a *CodexAdapter) ensureSubscriptionMode(ctx context.Context) error {
 	a.checkAuth.Do(func() {
-		home, _ := os.UserHomeDir()
-		if home != "" {
-			authFile := filepath.Join(home, ".codex", "auth.json")
+		if codexHome := a.codexHome(); codexHome != "" {
+			authFile := filepath.Join(codexHome, "auth.json")
 			data, err := os.ReadFile(authFile)
 			if err == nil {
 				var state struct {
@@ -492,12 +825,16 @@ func (a *CodexAdapter) ensureSubscriptionMode(ctx context.Context) error {
 			}
 		}
 
-		cmd := exec.CommandContext(ctx, a.bin, "login", "status")
+		cmd := newCommand(ctx, a.bin, "login", "status")
+		cmd.Env = commandEnv(a.opts.Env)
 		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
+		cmd.Stderr = stderrWriter(ctx, &stderr)
 		out, err := cmd.Output()
 		if err != nil {
-			a.authErr = fmt.Errorf("failed to check codex login status: %w: %s", err, strings.TrimSpace(stderr.String()))
+			a.authErr = fmt.Errorf("failed to check codex login status: %w: %s", err, strings.TrimSpace(sanitizeText(stderr.String())))
+			if a.codexHome() == "" {
+				a.authErr = fmt.Errorf("%w (HOME is not set; set HOME or CODEX_HOME to where codex keeps its login)", a.authErr)
+			}
 			return
 		}
 		status := strings.ToLower(string(out))
@@ -508,21 +845,31 @@ func (a *CodexAdapter) ensureSubscriptionMode(ctx context.Context) error {
 	return a.authErr
 }
 
+// ListModels serves the app-server's model list from a cache, since every
+// fetch spawns a CLI process.
 func (a *CodexAdapter) ListModels(ctx context.Context) ([]Model, error) {
 	if err := a.ensureSubscriptionMode(ctx); err != nil {
 		return nil, err
 	}
+	return a.catalog.get(ctx, a.fetchModels)
+}
 
-	client, err := newCodexRPCClient(ctx, a.bin)
+func (a *CodexAdapter) fetchModels(ctx context.Context) ([]Model, error) {
+	client, err := newCodexRPCClient(ctx, a.bin, a.opts.Env)
 	if err != nil {
 		return nil, err
 	}
+	defer client.stderr.attach(ctx)()
 	defer client.Close()
 
-	if err := client.initialize(); err != nil {
+	if err := a.initialize(ctx, client); err != nil {
 		return nil, err
 	}
+	return listCodexModels(client)
+}
 
+// listCodexModels asks an initialized app-server for its models.
+func listCodexModels(client *codexRPCClient) ([]Model, error) {
 	var resp struct {
 		Data []struct {
 			ID string `json:"id"`
@@ -563,13 +910,14 @@ func (a *CodexAdapter) Chat(ctx context.Context, req ChatRequest) (ChatResponse,
 	if err := a.ensureSubscriptionMode(ctx); err != nil {
 		return ChatResponse{}, err
 	}
-	turn, err := a.runTurnStructured(ctx, req.Model, buildChatPrompt(req.Messages), nil)
+	turn, err := a.runTurnStructured(ctx, req.Model, req.ReasoningEffort, "", buildChatPrompt(req.Messages), nil, false)
 	if err != nil {
 		return ChatResponse{}, err
 	}
 	return ChatResponse{
-		Model: req.Model,
-		Text:  turn.Output,
+		Model:      req.Model,
+		Text:       turn.Output,
+		Incomplete: turn.Incomplete,
 	}, nil
 }
 
@@ -577,33 +925,45 @@ func (a *CodexAdapter) ChatStream(ctx context.Context, req ChatRequest, onDelta
 	if err := a.ensureSubscriptionMode(ctx); err != nil {
 		return ChatResponse{}, err
 	}
-	turn, err := a.runTurnStructured(ctx, req.Model, buildChatPrompt(req.Messages), nil)
+	turn, err := a.runTurnStructured(ctx, req.Model, req.ReasoningEffort, "", buildChatPrompt(req.Messages), outputDeltas(onDelta), true)
 	if err != nil {
 		return ChatResponse{}, err
 	}
-	if onDelta != nil && strings.TrimSpace(turn.Output) != "" {
-		if err := onDelta(turn.Output); err != nil {
-			return ChatResponse{}, err
-		}
-	}
 	return ChatResponse{
-		Model: req.Model,
-		Text:  turn.Output,
+		Model:      req.Model,
+		Text:       turn.Output,
+		Incomplete: turn.Incomplete,
 	}, nil
 }
 
+// respondTurn runs a /v1/responses turn, continuing req.Continue's thread
+// when the app-server can resume it and starting a new one with the whole
+// input otherwise.
+func (a *CodexAdapter) respondTurn(ctx context.Context, req ResponsesRequest, onEvent func(ResponseEvent) error, streamOutput bool) (codexTurnResult, error) {
+	if c := req.Continue; c != nil && c.ThreadID != "" {
+		turn, err := a.runTurnStructured(ctx, req.Model, req.ReasoningEffort, c.ThreadID, buildResponsesPrompt(c.Input), onEvent, streamOutput)
+		if !errors.Is(err, errThreadNotResumed) {
+			return turn, err
+		}
+	}
+	return a.runTurnStructured(ctx, req.Model, req.ReasoningEffort, "", buildResponsesPrompt(req.Input), onEvent, streamOutput)
+}
+
 func (a *CodexAdapter) Respond(ctx context.Context, req ResponsesRequest) (ResponsesResponse, error) {
 	if err := a.ensureSubscriptionMode(ctx); err != nil {
 		return ResponsesResponse{}, err
 	}
-	turn, err := a.runTurnStructured(ctx, req.Model, buildResponsesPrompt(req.Input), nil)
+	turn, err := a.respondTurn(ctx, req, nil, false)
 	if err != nil {
 		return ResponsesResponse{}, err
 	}
 	return ResponsesResponse{
-		Model:     req.Model,
-		Text:      turn.Output,
-		Reasoning: turn.Reasoning,
+		Model:      req.Model,
+		Text:       turn.Output,
+		Reasoning:  turn.Reasoning,
+		ThreadID:   turn.ThreadID,
+		Usage:      turn.Usage,
+		Incomplete: turn.Incomplete,
 	}, nil
 }
 
@@ -611,19 +971,17 @@ func (a *CodexAdapter) RespondStream(ctx context.Context, req ResponsesRequest,
 	if err := a.ensureSubscriptionMode(ctx); err != nil {
 		return ResponsesResponse{}, err
 	}
-	turn, err := a.runTurnStructured(ctx, req.Model, buildResponsesPrompt(req.Input), nil)
+	turn, err := a.respondTurn(ctx, req, outputDeltas(onDelta), true)
 	if err != nil {
 		return ResponsesResponse{}, err
 	}
-	if onDelta != nil && strings.TrimSpace(turn.Output) != "" {
-		if err := onDelta(turn.Output); err != nil {
-			return ResponsesResponse{}, err
-		}
-	}
 	return ResponsesResponse{
-		Model:     req.Model,
-		Text:      turn.Output,
-		Reasoning: turn.Reasoning,
+		Model:      req.Model,
+		Text:       turn.Output,
+		Reasoning:  turn.Reasoning,
+		ThreadID:   turn.ThreadID,
+		Usage:      turn.Usage,
+		Incomplete: turn.Incomplete,
 	}, nil
 }
 
@@ -631,20 +989,26 @@ func (a *CodexAdapter) RespondStreamEvents(ctx context.Context, req ResponsesReq
 	if err := a.ensureSubscriptionMode(ctx); err != nil {
 		return ResponsesResponse{}, err
 	}
-	turn, err := a.runTurnStructured(ctx, req.Model, buildResponsesPrompt(req.Input), onEvent)
+	turn, err := a.respondTurn(ctx, req, onEvent, false)
 	if err != nil {
 		return ResponsesResponse{}, err
 	}
 	return ResponsesResponse{
-		Model:     req.Model,
-		Text:      turn.Output,
-		Reasoning: turn.Reasoning,
+		Model:      req.Model,
+		Text:       turn.Output,
+		Reasoning:  turn.Reasoning,
+		ThreadID:   turn.ThreadID,
+		Usage:      turn.Usage,
+		Incomplete: turn.Incomplete,
 	}, nil
 }
 
 type codexTurnResult struct {
-	Output    string
-	Reasoning string
+	Output     string
+	Reasoning  string
+	ThreadID   string
+	Usage      *Usage
+	Incomplete string
 }
 
 type codexTurnState struct {
@@ -709,53 +1073,185 @@ func (s *codexTurnState) result(lastAgentMessage string) codexTurnResult {
 	}
 }
 
-func (a *CodexAdapter) runTurnStructured(ctx context.Context, model string, prompt string, onEvent func(ResponseEvent) error) (codexTurnResult, error) {
-	client, err := newCodexRPCClient(ctx, a.bin)
-	if err != nil {
-		return codexTurnResult{}, err
+// outputDeltas adapts a plain delta callback to turn events, dropping reasoning.
+func outputDeltas(onDelta func(string) error) func(ResponseEvent) error {
+	if onDelta == nil {
+		return nil
 	}
-	defer client.Close()
+	return func(ev ResponseEvent) error {
+		if ev.Kind != ResponseEventOutput {
+			return nil
+		}
+		return onDelta(ev.Delta)
+	}
+}
+
+// codexTurnError is the error of a failed turn, in turn/completed and error
+// notifications.
+type codexTurnError struct {
+	Message        string          `json:"message"`
+	CodexErrorInfo json.RawMessage `json:"codexErrorInfo"`
+}
+
+func (e *codexTurnError) upstream() *UpstreamError {
+	return &UpstreamError{Type: codexErrorKind(e.CodexErrorInfo), Message: e.Message}
+}
 
-	if err := client.initialize(); err != nil {
+// runTurnStructured runs one Codex turn. With streamOutput, agent message
+// deltas are forwarded live as output events (separated by a blank line when
+// the agent starts a new message) and the result output is everything that was
+// streamed; otherwise only the final agent message is emitted once the turn
+// completes and earlier messages are folded into reasoning. While model is
+// over its usage limit, turns fail without starting the app-server.
+func (a *CodexAdapter) runTurnStructured(ctx context.Context, model string, effort string, resume string, prompt string, onEvent func(ResponseEvent) error, streamOutput bool) (codexTurnResult, error) {
+	if err := a.cooldown.check(model); err != nil {
 		return codexTurnResult{}, err
 	}
+	turn, err := a.runTurn(ctx, model, effort, resume, prompt, onEvent, streamOutput)
+	return turn, a.cooldown.observe(BackendCodex, model, err)
+}
 
-	var threadStart struct {
-		Thread struct {
-			ID string `json:"id"`
-		} `json:"thread"`
+func (a *CodexAdapter) runTurn(ctx context.Context, model string, effort string, resume string, prompt string, onEvent func(ResponseEvent) error, streamOutput bool) (codexTurnResult, error) {
+	opts := a.opts.forModel(model)
+	if effort != "" {
+		opts.Effort = effort
+	}
+	opts = opts.withSafety(SafetyFromContext(ctx))
+	opts.keepThread = a.opts.KeepThreads
+	opts.resume = resume
+
+	started := time.Now()
+	client := a.spare.take(codexAppServerArgs(ctx))
+	spawned := client == nil
+	if spawned {
+		var err error
+		if client, err = newCodexRPCClient(ctx, a.bin, a.opts.Env); err != nil {
+			return codexTurnResult{}, err
+		}
 	}
-	if err := client.call("thread/start", map[string]any{
-		"model":     model,
-		"ephemeral": true,
-	}, &threadStart, nil); err != nil {
-		return codexTurnResult{}, err
+	// Detached only after Close, which waits for the last of stderr.
+	defer client.stderr.attach(ctx)()
+	defer client.Close()
+
+	if spawned {
+		err := a.initialize(ctx, client)
+		TraceFromContext(ctx).addSpawn(time.Since(started))
+		if err != nil {
+			return codexTurnResult{}, err
+		}
 	}
-	if threadStart.Thread.ID == "" {
-		return codexTurnResult{}, errors.New("codex returned empty thread id")
+	return a.runTurnOn(ctx, client, model, opts, prompt, onEvent, streamOutput)
+}
+
+// runTurnOn runs one turn on its own thread of an initialized app-server,
+// which may be running other turns at the same time.
+func (a *CodexAdapter) runTurnOn(ctx context.Context, client *codexRPCClient, model string, opts CodexTurnOptions, prompt string, onEvent func(ResponseEvent) error, streamOutput bool) (codexTurnResult, error) {
+	a.warmth.touch(model)
+	defer client.stderr.attach(ctx)()
+	timer := startCLITimer(ctx)
+	defer timer.done()
+	threadID, err := client.startThread(model, opts)
+	if err != nil {
+		return codexTurnResult{}, err
 	}
+	timer.spawned()
+	inbox := client.subscribe(threadID)
+	defer client.unsubscribe(threadID)
 
 	var (
 		lastAgentMessage string
+		turnErr          *UpstreamError
 		callbackErr      error
 		state            codexTurnState
 		emittedReasoning bool
+		streamed         strings.Builder
+		streamedMsgIdx   = -1
+		usage            *Usage
+		toolCalls        int
+		turnID           string
+		turnLimited      bool
+		permissionErr    *PermissionPromptError
 	)
+	// stopTurn asks the app-server to interrupt the turn without waiting:
+	// the turn/completed that follows ends it as usual.
+	stopTurn := func() {
+		method, params := client.interruptRequest(threadID, turnID)
+		_, _ = client.send(method, params, nil)
+	}
 
+	clean := newOutputSanitizer()
 	emit := func(kind ResponseEventKind, delta string) {
-		if onEvent == nil || callbackErr != nil || delta == "" {
+		if onEvent == nil || callbackErr != nil {
+			return
+		}
+		ev, ok := clean.event(ResponseEvent{Kind: kind, Delta: delta})
+		if !ok {
 			return
 		}
-		if err := onEvent(ResponseEvent{Kind: kind, Delta: delta}); err != nil {
+		if err := onEvent(ev); err != nil {
 			callbackErr = err
 		}
 	}
 
 	turnCompleted := false
 	notify := func(msg codexRPCMessage) {
+		if decline, ok := codexApprovalMethods[msg.Method]; ok && len(msg.ID) > 0 {
+			// Nobody can approve it; an unanswered request hangs the turn.
+			_ = client.reply(msg.ID, decline)
+			if a.opts.Permissions.OnPrompt == PermissionFail && permissionErr == nil {
+				permissionErr = &PermissionPromptError{Backend: BackendCodex, Tool: codexApprovalTool(msg), Detail: "declined"}
+				if turnID != "" {
+					stopTurn()
+				}
+			}
+			return
+		}
+		switch msg.Method {
+		case "item/reasoning/summaryTextDelta", "item/agentMessage/delta":
+			timer.firstByte()
+		}
 		switch msg.Method {
 		case "turn/completed":
 			turnCompleted = true
+			var payload struct {
+				Turn struct {
+					Error *codexTurnError `json:"error"`
+				} `json:"turn"`
+			}
+			if json.Unmarshal(msg.Params, &payload) == nil && payload.Turn.Error != nil && payload.Turn.Error.Message != "" {
+				turnErr = payload.Turn.Error.upstream()
+			}
+		case "account/rateLimits/updated":
+			a.observeQuota(msg.Params)
+		case "thread/tokenUsage/updated":
+			var payload struct {
+				TokenUsage struct {
+					Last struct {
+						InputTokens       int `json:"inputTokens"`
+						CachedInputTokens int `json:"cachedInputTokens"`
+						OutputTokens      int `json:"outputTokens"`
+					} `json:"last"`
+				} `json:"tokenUsage"`
+			}
+			if json.Unmarshal(msg.Params, &payload) == nil {
+				// Each update reports the model call just made; a turn
+				// with tool calls makes several.
+				if usage == nil {
+					usage = &Usage{}
+				}
+				last := payload.TokenUsage.Last
+				usage.InputTokens += last.InputTokens
+				usage.CachedInputTokens += last.CachedInputTokens
+				usage.OutputTokens += last.OutputTokens
+			}
+		case "error":
+			var payload struct {
+				Error     codexTurnError `json:"error"`
+				WillRetry bool           `json:"willRetry"`
+			}
+			if json.Unmarshal(msg.Params, &payload) == nil && !payload.WillRetry && payload.Error.Message != "" {
+				turnErr = payload.Error.upstream()
+			}
 		case "item/reasoning/summaryTextDelta":
 			var payload struct {
 				Delta string `json:"delta"`
@@ -771,15 +1267,43 @@ func (a *CodexAdapter) runTurnStructured(ctx context.Context, model string, prom
 			}
 			if json.Unmarshal(msg.Params, &payload) == nil && payload.Delta != "" {
 				state.appendAgentDelta(payload.Delta)
+				if streamOutput {
+					msgIdx := len(state.agentMsgs)
+					if streamedMsgIdx >= 0 && streamedMsgIdx != msgIdx {
+						streamed.WriteString("\n\n")
+						emit(ResponseEventOutput, "\n\n")
+					}
+					streamedMsgIdx = msgIdx
+					streamed.WriteString(payload.Delta)
+					emit(ResponseEventOutput, payload.Delta)
+				}
 			}
 		case "item/started":
 			var payload struct {
-				Item struct {
-					Type string `json:"type"`
-				} `json:"item"`
+				Item json.RawMessage `json:"item"`
 			}
-			if json.Unmarshal(msg.Params, &payload) == nil {
-				if strings.EqualFold(payload.Item.Type, "agentMessage") {
+			if json.Unmarshal(msg.Params, &payload) != nil {
+				break
+			}
+			if tool, ok := codexToolCall(payload.Item); ok {
+				timer.firstByte()
+				toolCalls++
+				if opts.MaxTurns > 0 && toolCalls >= opts.MaxTurns && !turnLimited {
+					turnLimited = true
+					if turnID != "" {
+						stopTurn()
+					}
+				}
+				if onEvent != nil && callbackErr == nil {
+					callbackErr = onEvent(ResponseEvent{Kind: ResponseEventToolCall, Tool: &tool})
+				}
+				break
+			}
+			var item struct {
+				Type string `json:"type"`
+			}
+			if json.Unmarshal(payload.Item, &item) == nil {
+				if strings.EqualFold(item.Type, "agentMessage") {
 					// New assistant message: close previous if it never got an explicit completed event.
 					if state.currentAgent.Len() > 0 {
 						state.completeAgentMessage()
@@ -810,32 +1334,59 @@ func (a *CodexAdapter) runTurnStructured(ctx context.Context, model string, prom
 		}
 	}
 
-	var turnResp map[string]any
-	err = client.call("turn/start", map[string]any{
-		"threadId": threadStart.Thread.ID,
-		"model":    model,
-		"input": []map[string]any{
-			{
-				"type": "text",
-				"text": prompt,
-			},
-		},
-	}, &turnResp, notify)
+	turnID, err = client.startTurn(threadID, inbox.out, model, opts, prompt, notify)
 	if err != nil {
 		return codexTurnResult{}, err
 	}
+	if (turnLimited || permissionErr != nil) && !turnCompleted {
+		stopTurn()
+	}
+	client.turnActive.Store(true)
 
-	if err := waitForTurnCompleted(ctx, client.msgs, notify, turnCompleted); err != nil {
+	if err := waitForTurnCompleted(ctx, inbox.out, notify, turnCompleted); err != nil {
+		if ctx.Err() != nil {
+			client.interrupt(threadID, turnID)
+		}
+		return codexTurnResult{}, err
+	}
+	if err := client.readError(); !turnCompleted && err != nil {
+		// msgs closed before turn/completed because stdout broke off.
 		return codexTurnResult{}, err
 	}
 	if callbackErr != nil {
 		return codexTurnResult{}, callbackErr
 	}
+	if permissionErr != nil {
+		return codexTurnResult{}, permissionErr
+	}
 
 	result := state.result(lastAgentMessage)
+	result.Output, result.Reasoning = sanitizeText(result.Output), sanitizeText(result.Reasoning)
+	result.ThreadID = threadID
+	result.Usage = usage
+	if turnLimited {
+		result.Incomplete = IncompleteMaxTurns
+		if result.Output == "" {
+			result.Output = turnLimitNotice(opts.MaxTurns)
+		}
+	}
+	if result.Output == "" && turnErr != nil {
+		return codexTurnResult{}, fmt.Errorf("codex turn failed: %w", turnErr)
+	}
 	if result.Output == "" {
 		return codexTurnResult{}, errors.New("codex returned empty assistant output")
 	}
+	if streamOutput {
+		if streamedMsgIdx < 0 {
+			emit(ResponseEventOutput, result.Output)
+		} else {
+			result.Output = strings.TrimSpace(sanitizeText(streamed.String()))
+		}
+		if callbackErr != nil {
+			return codexTurnResult{}, callbackErr
+		}
+		return result, nil
+	}
 	if !emittedReasoning && strings.TrimSpace(result.Reasoning) != "" {
 		emit(ResponseEventReasoning, result.Reasoning)
 	}
@@ -846,6 +1397,77 @@ func (a *CodexAdapter) runTurnStructured(ctx context.Context, model string, prom
 	return result, nil
 }
 
+func codexThreadParams(model string, opts CodexTurnOptions) map[string]any {
+	params := map[string]any{
+		"model":     model,
+		"ephemeral": !opts.keepThread,
+	}
+	if opts.Cwd != "" {
+		params["cwd"] = opts.Cwd
+	}
+	// YOLO already runs the app-server without sandbox or approvals, unless
+	// a safety preset replaced it.
+	if opts.safety != "" || !YOLOEnabled() {
+		if opts.Sandbox != "" {
+			params["sandbox"] = opts.Sandbox
+		}
+		if opts.ApprovalPolicy != "" {
+			params["approvalPolicy"] = opts.ApprovalPolicy
+		}
+	}
+	if opts.WebSearch != nil {
+		params["config"] = map[string]any{"tools.web_search": *opts.WebSearch}
+	}
+	return params
+}
+
+// codexToolCall maps an app-server item that represents tool activity
+// (commands, file edits, MCP calls, web searches) to a ToolCall.
+func codexToolCall(raw json.RawMessage) (ToolCall, bool) {
+	var item struct {
+		Type      string          `json:"type"`
+		ID        string          `json:"id"`
+		Command   json.RawMessage `json:"command"`
+		Cwd       string          `json:"cwd"`
+		Changes   json.RawMessage `json:"changes"`
+		Server    string          `json:"server"`
+		Tool      string          `json:"tool"`
+		Arguments json.RawMessage `json:"arguments"`
+		Query     string          `json:"query"`
+	}
+	if json.Unmarshal(raw, &item) != nil {
+		return ToolCall{}, false
+	}
+	var (
+		name string
+		args any
+	)
+	switch item.Type {
+	case "commandExecution":
+		name = "shell"
+		args = map[string]any{"command": item.Command, "cwd": item.Cwd}
+	case "fileChange":
+		name = "apply_patch"
+		args = map[string]any{"changes": item.Changes}
+	case "mcpToolCall":
+		name = item.Tool
+		if item.Server != "" {
+			name = item.Server + "." + item.Tool
+		}
+		args = item.Arguments
+	case "webSearch":
+		name = "web_search"
+		args = map[string]any{"query": item.Query}
+	default:
+		return ToolCall{}, false
+	}
+	encoded, err := json.Marshal(args)
+	if err != nil || string(encoded) == "null" {
+		encoded = []byte("{}")
+	}
+	return ToolCall{ID: item.ID, Name: name, Arguments: string(encoded)}, true
+}
+
 func waitForTurnCompleted(ctx context.Context, msgs <-chan codexRPCMessage, notify func(codexRPCMessage), alreadyCompleted bool) error {
 	if alreadyCompleted {
 		return nil
@@ -869,61 +1491,335 @@ func waitForTurnCompleted(ctx context.Context, msgs <-chan codexRPCMessage, noti
 }
 
 type Router struct {
+	mu     sync.RWMutex
 	claude Adapter
 	codex  Adapter
+	// races maps virtual model IDs to the model IDs raced against each other.
+	races map[string][]string
+	// virtuals maps virtual model IDs to their base model and settings.
+	virtuals map[string]VirtualModel
+	// pipelines maps pipeline model IDs to their steps.
+	pipelines map[string][]PipelineStep
+	auto      *AutoPolicy
+	pins      *conversationPins
+	// health holds the backends' probe results; see CheckHealth.
+	health *healthState
+	// network holds the last CheckNetwork results.
+	network networkCache
 }
 
 func NewRouter(claude Adapter, codex Adapter) *Router {
-	return &Router{claude: claude, codex: codex}
+	return &Router{claude: claude, codex: codex, pins: newConversationPins(), health: newHealthState()}
+}
+
+// SetAdapters swaps the backends used for new requests; in-flight requests keep
+// the adapter they already resolved.
+func (r *Router) SetAdapters(claude Adapter, codex Adapter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.claude = claude
+	r.codex = codex
+	r.health.reset()
+	r.network.reset()
+}
+
+// SetRaces replaces the racing models: each ID resolves to a RaceAdapter over
+// the listed model IDs, which may use the claude/ and codex/ prefixes.
+func (r *Router) SetRaces(races map[string][]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.races = races
+}
+
+// WithCodexEnv returns a router sharing the Claude backend whose Codex backend
+// runs with extra environment entries. It returns r unchanged when the Codex
+// backend is not a *CodexAdapter.
+func (r *Router) WithCodexEnv(extra ...string) *Router {
+	claude, codex := r.adapters()
+	c, ok := codex.(*CodexAdapter)
+	if !ok {
+		return r
+	}
+	out := NewRouter(claude, c.WithEnv(extra...))
+	out.pins = r.pins
+	out.health = r.health
+	out.SetRaces(r.raceModels())
+	out.SetVirtualModels(r.virtualModels())
+	out.SetPipelines(r.pipelineModels())
+	out.SetAutoPolicy(r.autoPolicy())
+	return out
+}
+
+// SetAutoPolicy enables the AutoModel virtual model; nil disables it.
+func (r *Router) SetAutoPolicy(p *AutoPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.auto = p
+}
+
+// SetPinStore persists conversation pins in store, so conversations keep
+// their auto and race choices across restarts. Routers derived with
+// WithCodexEnv share it.
+func (r *Router) SetPinStore(store PinStore) {
+	r.pins.setStore(store)
+}
+
+func (r *Router) autoPolicy() *AutoPolicy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.auto
+}
+
+func (r *Router) raceModels() map[string][]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.races
+}
+
+func (r *Router) adapters() (Adapter, Adapter) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.claude, r.codex
 }
 
 type modelSupporter interface {
 	SupportsModel(context.Context, string) (bool, error)
 }
 
+// Resolve picks the backend for a requested model ID and returns the model ID
+// to pass to it. AutoModel resolves to the auto policy's default and racing
+// models to a RaceAdapter; virtual models wrap their base model's adapter in
+// a VirtualAdapter and pipelines resolve to a PipelineAdapter over their
+// steps. A "claude/" or "codex/" prefix forces that backend
+// and is stripped; bare IDs go to the first backend that lists them, Claude
+// first. Within a conversation (see WithConversation) a race resolves to the
+// model that won its first turn. A backend whose health probes keep failing
+// is refused with a BackendUnavailableError and sits races out. Every model
+// the request would run is checked against ctx's model policy (see
+// WithModelPolicy).
+func (r *Router) Resolve(ctx context.Context, model string) (Adapter, string, error) {
+	if err := checkModel(ctx, model); err != nil {
+		return nil, "", err
+	}
+	if v, ok := r.virtualModels()[model]; ok {
+		adapter, backendModel, err := r.Resolve(ctx, v.Base)
+		if err != nil {
+			return nil, "", fmt.Errorf("virtual model %s: %w", model, err)
+		}
+		return NewVirtualAdapter(model, v, adapter), backendModel, nil
+	}
+	if steps, ok := r.pipelineModels()[model]; ok {
+		return r.resolvePipeline(ctx, model, steps)
+	}
+	if p := r.autoPolicy(); p != nil && model == AutoModel {
+		// Without a prompt to inspect (see RouteChat), auto means the default.
+		model = p.Default
+		if err := checkModel(ctx, model); err != nil {
+			return nil, "", err
+		}
+	}
+	if members, ok := r.raceModels()[model]; ok {
+		if pinned, ok := r.pins.get(ctx, model); ok {
+			return r.resolveAvailable(ctx, pinned)
+		}
+		legs := make([]RaceLeg, 0, len(members))
+		var legMembers []string
+		var unavailable error
+		for _, member := range members {
+			adapter, backendModel, err := r.resolveBackend(ctx, member)
+			if err != nil {
+				return nil, "", fmt.Errorf("race %s: %w", model, err)
+			}
+			if err := r.available(adapter); err != nil {
+				unavailable = err
+				continue
+			}
+			legs = append(legs, RaceLeg{Adapter: adapter, Model: backendModel})
+			legMembers = append(legMembers, member)
+		}
+		if len(legs) == 0 {
+			return nil, "", fmt.Errorf("race %s: %w", model, unavailable)
+		}
+		race := NewRaceAdapter(model, legs...)
+		race.onWin = func(leg int) { r.pins.set(ctx, model, legMembers[leg]) }
+		return race, model, nil
+	}
+	return r.resolveAvailable(ctx, model)
+}
+
+func (r *Router) resolveAvailable(ctx context.Context, model string) (Adapter, string, error) {
+	adapter, backendModel, err := r.resolveBackend(ctx, model)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := r.available(adapter); err != nil {
+		return nil, "", err
+	}
+	return adapter, backendModel, nil
+}
+
+func (r *Router) resolveBackend(ctx context.Context, model string) (Adapter, string, error) {
+	if err := checkModel(ctx, model); err != nil {
+		return nil, "", err
+	}
+	claude, codex := r.adapters()
+	if prefix, rest, ok := strings.Cut(model, "/"); ok {
+		var adapter Adapter
+		switch Backend(prefix) {
+		case BackendClaude:
+			adapter = claude
+		case BackendCodex:
+			adapter = codex
+		}
+		if adapter != nil {
+			if s, ok := adapter.(modelSupporter); ok {
+				supported, err := s.SupportsModel(ctx, rest)
+				if err != nil {
+					return nil, "", fmt.Errorf("failed checking %s models: %w", prefix, err)
+				}
+				if !supported {
+					return nil, "", fmt.Errorf("unsupported model id: %s", model)
+				}
+			}
+			if err := checkModel(ctx, rest); err != nil {
+				return nil, "", err
+			}
+			if err := checkAlias(ctx, adapter, rest); err != nil {
+				return nil, "", err
+			}
+			return adapter, rest, nil
+		}
+	}
+	adapter, err := r.AdapterForModel(ctx, model)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := checkAlias(ctx, adapter, model); err != nil {
+		return nil, "", err
+	}
+	return adapter, model, nil
+}
+
 func (r *Router) AdapterForModel(ctx context.Context, model string) (Adapter, error) {
-	if s, ok := r.claude.(modelSupporter); ok {
+	claude, codex := r.adapters()
+	if s, ok := claude.(modelSupporter); ok {
 		supported, err := s.SupportsModel(ctx, model)
 		if err != nil {
 			return nil, fmt.Errorf("failed checking Claude models: %w", err)
 		}
 		if supported {
-			return r.claude, nil
+			return claude, nil
 		}
 	}
-	if s, ok := r.codex.(modelSupporter); ok {
+	if s, ok := codex.(modelSupporter); ok {
 		supported, err := s.SupportsModel(ctx, model)
 		if err != nil {
 			return nil, fmt.Errorf("failed checking Codex models: %w", err)
 		}
 		if supported {
-			return r.codex, nil
+			return codex, nil
 		}
 	}
 	return nil, fmt.Errorf("unsupported model id: %s", model)
 }
 
 func (r *Router) ListModels(ctx context.Context) ([]Model, error) {
-	claudeModels, err := r.claude.ListModels(ctx)
+	claude, codex := r.adapters()
+	claudeModels, err := claude.ListModels(ctx)
 	if err != nil {
 		return nil, err
 	}
-	codexModels, err := r.codex.ListModels(ctx)
+	codexModels, err := codex.ListModels(ctx)
 	if err != nil {
 		return nil, err
 	}
-	out := make([]Model, 0, len(claudeModels)+len(codexModels))
-	out = append(out, claudeModels...)
-	out = append(out, codexModels...)
+	races := r.raceModels()
+	out := make([]Model, 0, len(claudeModels)+len(codexModels)+len(races))
+	warm := make(map[string]bool)
+	for _, list := range []struct {
+		adapter Adapter
+		models  []Model
+	}{{claude, claudeModels}, {codex, codexModels}} {
+		reporter, _ := list.adapter.(WarmReporter)
+		aliases, _ := list.adapter.(aliaser)
+		for _, m := range list.models {
+			if reporter != nil {
+				m.Warm = reporter.Warm(m.ID)
+			}
+			if aliases != nil {
+				m.Base = aliases.BaseModel(m.ID)
+			}
+			warm[m.ID] = m.Warm
+			out = append(out, m)
+		}
+	}
+	ids := make([]string, 0, len(races))
+	for id := range races {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		// A race answers as fast as its quickest leg.
+		m := Model{ID: id, Backend: BackendRace}
+		for _, leg := range races[id] {
+			m.Warm = m.Warm || warm[leg]
+		}
+		out = append(out, m)
+		warm[id] = m.Warm
+	}
+	if p := r.autoPolicy(); p != nil {
+		out = append(out, Model{ID: AutoModel, Backend: BackendAuto, Warm: warm[p.Default]})
+		warm[AutoModel] = warm[p.Default]
+	}
+	virtuals := virtualModelList(r.virtualModels(), warm)
+	for _, m := range virtuals {
+		warm[m.ID] = m.Warm
+	}
+	out = append(out, virtuals...)
+	out = append(out, pipelineModelList(r.pipelineModels(), warm)...)
 	return out, nil
 }
 
+// codexCallTimeout bounds the wait for the reply to one app-server request.
+// Turns run after turn/start has been answered, so this only covers the
+// request itself.
+const codexCallTimeout = 2 * time.Minute
+
+// codexRPCClient talks JSON-RPC to one `codex app-server` process. Replies
+// are routed to the call waiting for their ID, so calls may run
+// concurrently and be answered in any order. Notifications and server
+// requests are queued in arrival order for the turn running on their
+// thread (see subscribe), or for msgs.
 type codexRPCClient struct {
-	cmd    *exec.Cmd
-	stdin  *bufio.Writer
-	msgs   chan codexRPCMessage
-	stderr bytes.Buffer
+	cmd     *exec.Cmd
+	dump    *upstreamDump
+	writeMu sync.Mutex
+	stdin   *bufio.Writer
+	// msgs delivers notifications and server requests that belong to no
+	// subscribed thread; it is closed once stdout has ended and everything
+	// queued before has been delivered.
+	msgs  <-chan codexRPCMessage
+	inbox *rpcInbox
+	// done is closed when stdout ends.
+	done        chan struct{}
+	closeOnce   sync.Once
+	callTimeout time.Duration
+
+	mu       sync.Mutex
+	pending  map[string]chan codexRPCMessage
+	threads  map[string]*rpcInbox
+	eof      bool
+	protocol codexProtocol
+	// readErr is why reading stdout stopped early; set before done closes.
+	readErr error
+
+	// stderr is written by the process's stderr copier until it exits and
+	// read when stdout ends, so it locks; each turn attaches its request.
+	stderr stderrFanout
 	id     atomic.Int64
+	// turnActive keeps a cancelled context from killing the app-server while
+	// a turn runs, so the turn can be interrupted first; see interrupt.
+	turnActive atomic.Bool
 }
 
 type codexRPCMessage struct {
@@ -934,15 +1830,23 @@ type codexRPCMessage struct {
 	Error  *struct {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
+		Data    struct {
+			CodexErrorInfo json.RawMessage `json:"codexErrorInfo"`
+		} `json:"data"`
 	} `json:"error"`
 }
 
-func newCodexRPCClient(ctx context.Context, bin string) (*codexRPCClient, error) {
-	args := []string{"app-server"}
-	if YOLOEnabled() {
-		args = []string{"--dangerously-bypass-approvals-and-sandbox", "app-server"}
+// codexAppServerArgs are the arguments an app-server for ctx starts with.
+func codexAppServerArgs(ctx context.Context) []string {
+	if SafetyFromContext(ctx) == "" && YOLOEnabled() {
+		return []string{"--dangerously-bypass-approvals-and-sandbox", "app-server"}
 	}
-	cmd := exec.CommandContext(ctx, bin, args...)
+	return []string{"app-server"}
+}
+
+func newCodexRPCClient(ctx context.Context, bin string, env []string) (*codexRPCClient, error) {
+	cmd := newCommand(ctx, bin, codexAppServerArgs(ctx)...)
+	cmd.Env = commandEnv(env)
 	stdinPipe, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, err
@@ -953,33 +1857,284 @@ func newCodexRPCClient(ctx context.Context, bin string) (*codexRPCClient, error)
 	}
 	client := &codexRPCClient{
 		cmd:   cmd,
+		dump:  openUpstreamDump(BackendCodex, cmd.Args),
 		stdin: bufio.NewWriter(stdinPipe),
-		msgs:  make(chan codexRPCMessage, 256),
 	}
 	cmd.Stderr = &client.stderr
-	if err := cmd.Start(); err != nil {
+	cmd.Cancel = func() error {
+		if client.turnActive.Load() {
+			return nil
+		}
+		return killProcess(cmd)
+	}
+	if err := startCommand(cmd); err != nil {
+		client.dump.exit(err)
 		return nil, err
 	}
+	client.serve(stdoutPipe)
+	return client, nil
+}
 
-	scanner := bufio.NewScanner(stdoutPipe)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-	go func() {
-		defer close(client.msgs)
-		for scanner.Scan() {
-			var msg codexRPCMessage
-			if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
-				continue
+// serve starts reading the app-server's stdout.
+func (c *codexRPCClient) serve(stdout io.Reader) {
+	c.inbox = newRPCInbox()
+	c.msgs = c.inbox.out
+	c.done = make(chan struct{})
+	c.pending = map[string]chan codexRPCMessage{}
+	c.threads = map[string]*rpcInbox{}
+	if c.callTimeout == 0 {
+		c.callTimeout = codexCallTimeout
+	}
+	go c.read(stdout)
+}
+
+// read dispatches every stdout line. It never blocks on a consumer, so a
+// reply always reaches its call however many notifications nobody reads.
+func (c *codexRPCClient) read(stdout io.Reader) {
+	scanner := newLineReader(stdout)
+	for scanner.Scan() {
+		c.dump.record("stdout", scanner.Text())
+		var msg codexRPCMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		c.mu.Lock()
+		if msg.Method == "" && len(msg.ID) > 0 {
+			key := rpcIDKey(msg.ID)
+			if reply, ok := c.pending[key]; ok {
+				delete(c.pending, key)
+				reply <- msg
 			}
-			client.msgs <- msg
+		} else {
+			c.route(msg)
 		}
-	}()
+		c.mu.Unlock()
+	}
+	c.mu.Lock()
+	if err := scanner.Err(); err != nil {
+		c.readErr = fmt.Errorf("codex app-server output: %w", err)
+	}
+	c.eof = true
+	c.inbox.close()
+	for _, inbox := range c.threads {
+		inbox.close()
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
 
-	return client, nil
+// route queues a notification or server request for the turn on its thread.
+// Messages naming no thread concern the whole app-server and go to every
+// subscribed thread; the rest go to msgs. Called with c.mu held.
+func (c *codexRPCClient) route(msg codexRPCMessage) {
+	if c.protocol == codexProtocolV1 {
+		for _, m := range translateV1(msg) {
+			c.routeOne(m)
+		}
+		return
+	}
+	c.routeOne(msg)
+}
+
+func (c *codexRPCClient) routeOne(msg codexRPCMessage) {
+	threadID := messageThread(msg)
+	if inbox, ok := c.threads[threadID]; ok {
+		inbox.push(msg)
+		return
+	}
+	if threadID == "" && len(c.threads) > 0 {
+		for _, inbox := range c.threads {
+			inbox.push(msg)
+		}
+		return
+	}
+	c.inbox.push(msg)
+}
+
+// messageThread returns the thread a message names, if any.
+func messageThread(msg codexRPCMessage) string {
+	var params struct {
+		ThreadID string `json:"threadId"`
+	}
+	_ = json.Unmarshal(msg.Params, &params)
+	return params.ThreadID
+}
+
+// subscribe starts queueing the messages of threadID for the returned inbox
+// instead of msgs. Those that arrived before it, between the reply naming
+// the thread and now, move over from msgs under the same lock, so the
+// inbox holds every message of the thread in order.
+func (c *codexRPCClient) subscribe(threadID string) *rpcInbox {
+	inbox := newRPCInbox()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	early := c.inbox.take(func(msg codexRPCMessage) bool {
+		return messageThread(msg) == threadID
+	})
+	for _, msg := range early {
+		inbox.push(msg)
+	}
+	if c.eof {
+		inbox.close()
+	} else {
+		c.threads[threadID] = inbox
+	}
+	return inbox
 }
 
+func (c *codexRPCClient) unsubscribe(threadID string) {
+	c.mu.Lock()
+	inbox := c.threads[threadID]
+	delete(c.threads, threadID)
+	c.mu.Unlock()
+	if inbox != nil {
+		inbox.discard()
+	}
+}
+
+// messagesFor returns the channel the messages of threadID arrive on.
+func (c *codexRPCClient) messagesFor(threadID string) <-chan codexRPCMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if inbox, ok := c.threads[threadID]; ok {
+		return inbox.out
+	}
+	return c.msgs
+}
+
+// rpcInbox queues messages for one reader in arrival order. Pushing never
+// blocks, so a reader that falls behind cannot stall the others.
+type rpcInbox struct {
+	out     chan codexRPCMessage
+	stop    chan struct{}
+	stopped sync.Once
+	// kick makes deliver put back the message it is offering on out.
+	kick chan struct{}
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []codexRPCMessage
+	closed bool
+	// held is set while deliver offers a message it popped off queue, and
+	// taking while take holds deliver back.
+	held   bool
+	taking bool
+}
+
+func newRPCInbox() *rpcInbox {
+	b := &rpcInbox{
+		out:  make(chan codexRPCMessage),
+		stop: make(chan struct{}),
+		kick: make(chan struct{}, 1),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	go b.deliver()
+	return b
+}
+
+func (b *rpcInbox) push(msg codexRPCMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.queue = append(b.queue, msg)
+		b.cond.Broadcast()
+	}
+}
+
+// take removes the undelivered messages match selects and returns them in
+// order, including one deliver is offering that nobody has read yet.
+func (b *rpcInbox) take(match func(codexRPCMessage) bool) []codexRPCMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.taking = true
+	defer b.cond.Broadcast()
+	defer func() { b.taking = false }()
+	for b.held {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+		b.cond.Wait()
+	}
+	var taken []codexRPCMessage
+	kept := b.queue[:0]
+	for _, msg := range b.queue {
+		if match(msg) {
+			taken = append(taken, msg)
+		} else {
+			kept = append(kept, msg)
+		}
+	}
+	b.queue = kept
+	return taken
+}
+
+// close closes out once everything queued has been delivered.
+func (b *rpcInbox) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.cond.Broadcast()
+}
+
+// discard drops whatever is still queued, for a reader that went away.
+func (b *rpcInbox) discard() {
+	b.stopped.Do(func() { close(b.stop) })
+	b.close()
+}
+
+func (b *rpcInbox) deliver() {
+	defer close(b.out)
+	for {
+		b.mu.Lock()
+		for b.taking || len(b.queue) == 0 && !b.closed {
+			b.cond.Wait()
+		}
+		if len(b.queue) == 0 {
+			b.mu.Unlock()
+			return
+		}
+		msg := b.queue[0]
+		b.queue = b.queue[1:]
+		b.held = true
+		b.mu.Unlock()
+		sent := false
+		select {
+		case b.out <- msg:
+			sent = true
+		case <-b.kick:
+		case <-b.stop:
+		}
+		b.mu.Lock()
+		b.held = false
+		if !sent {
+			b.queue = append([]codexRPCMessage{msg}, b.queue...)
+		}
+		b.cond.Broadcast()
+		b.mu.Unlock()
+		select {
+		case <-b.stop:
+			return
+		default:
+		}
+	}
+}
+
+// rpcIDKey normalizes a JSON-RPC ID, which may be a string or a number.
+func rpcIDKey(id json.RawMessage) string {
+	var s string
+	if json.Unmarshal(id, &s) == nil {
+		return s
+	}
+	return string(bytes.TrimSpace(id))
+}
+
+// initialize starts the session and picks the protocol the server speaks.
 func (c *codexRPCClient) initialize() error {
-	var resp map[string]any
-	return c.call("initialize", map[string]any{
+	var resp struct {
+		UserAgent string `json:"userAgent"`
+	}
+	err := c.call("initialize", map[string]any{
 		"clientInfo": map[string]any{
 			"name":    "llm-proxy",
 			"version": "0.1.0",
@@ -988,60 +2143,144 @@ func (c *codexRPCClient) initialize() error {
 			"experimentalApi": true,
 		},
 	}, &resp, nil)
+	if err != nil {
+		return err
+	}
+	c.negotiate(resp.UserAgent)
+	return nil
 }
 
-func (c *codexRPCClient) call(method string, params any, out any, onNotify func(codexRPCMessage)) error {
-	id := c.id.Add(1)
-	req := map[string]any{
+// send writes one request and returns its ID without waiting for the reply.
+// A non-nil reply channel receives the reply.
+func (c *codexRPCClient) send(method string, params any, reply chan codexRPCMessage) (string, error) {
+	id := strconv.FormatInt(c.id.Add(1), 10)
+	line, err := json.Marshal(map[string]any{
 		"jsonrpc": "2.0",
-		"id":      fmt.Sprintf("%d", id),
+		"id":      id,
 		"method":  method,
 		"params":  params,
-	}
-	line, err := json.Marshal(req)
+	})
 	if err != nil {
-		return err
+		return "", err
+	}
+	if reply != nil {
+		c.mu.Lock()
+		c.pending[id] = reply
+		c.mu.Unlock()
 	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.dump.record("stdin", string(line))
 	if _, err := c.stdin.Write(line); err != nil {
-		return err
+		c.forget(id)
+		return "", err
 	}
 	if err := c.stdin.WriteByte('\n'); err != nil {
-		return err
+		c.forget(id)
+		return "", err
 	}
 	if err := c.stdin.Flush(); err != nil {
+		c.forget(id)
+		return "", err
+	}
+	return id, nil
+}
+
+// reply answers the server request id with result.
+func (c *codexRPCClient) reply(id json.RawMessage, result any) error {
+	line, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  result,
+	})
+	if err != nil {
 		return err
 	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.dump.record("stdin", string(line))
+	if _, err := c.stdin.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return c.stdin.Flush()
+}
 
-	for msg := range c.msgs {
-		if len(msg.ID) == 0 {
-			if onNotify != nil {
-				onNotify(msg)
-			}
-			continue
-		}
+// forget stops waiting for the reply to id; a late reply is dropped.
+func (c *codexRPCClient) forget(id string) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
 
-		var gotID string
-		if err := json.Unmarshal(msg.ID, &gotID); err != nil {
-			continue
-		}
-		if gotID != fmt.Sprintf("%d", id) {
-			if onNotify != nil && msg.Method != "" {
-				onNotify(msg)
+// call sends a request and waits up to callTimeout for its reply. While it
+// waits, notifications go to onNotify; without one they stay queued for the
+// next reader of msgs.
+func (c *codexRPCClient) call(method string, params any, out any, onNotify func(codexRPCMessage)) error {
+	return c.callOn(c.msgs, method, params, out, onNotify)
+}
+
+// callOn is call for a reader of msgs other than the client's own, such as
+// the inbox of a subscribed thread.
+func (c *codexRPCClient) callOn(msgs <-chan codexRPCMessage, method string, params any, out any, onNotify func(codexRPCMessage)) error {
+	reply := make(chan codexRPCMessage, 1)
+	id, err := c.send(method, params, reply)
+	if err != nil {
+		return err
+	}
+	timer := time.NewTimer(c.callTimeout)
+	defer timer.Stop()
+	var notes <-chan codexRPCMessage
+	if onNotify != nil {
+		notes = msgs
+	}
+
+	for {
+		select {
+		case msg := <-reply:
+			return decodeRPCReply(method, msg, out)
+		case msg, ok := <-notes:
+			if !ok {
+				notes = nil
+				continue
 			}
-			continue
-		}
-		if msg.Error != nil {
-			return fmt.Errorf("codex RPC error on %s: (%d) %s", method, msg.Error.Code, msg.Error.Message)
-		}
-		if out == nil {
-			return nil
-		}
-		if len(msg.Result) == 0 {
-			return nil
+			onNotify(msg)
+		case <-c.done:
+			select {
+			case msg := <-reply:
+				return decodeRPCReply(method, msg, out)
+			default:
+			}
+			c.forget(id)
+			return c.streamEnded()
+		case <-timer.C:
+			c.forget(id)
+			return fmt.Errorf("codex RPC %s: no reply within %s: %w", method, c.callTimeout, context.DeadlineExceeded)
 		}
-		return json.Unmarshal(msg.Result, out)
 	}
+}
+
+func decodeRPCReply(method string, msg codexRPCMessage, out any) error {
+	if msg.Error != nil {
+		return &codexRPCError{Method: method, Code: msg.Error.Code, Message: msg.Error.Message, Info: codexErrorKind(msg.Error.Data.CodexErrorInfo)}
+	}
+	if out == nil || len(msg.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(msg.Result, out)
+}
+
+// readError returns why reading stdout stopped early, if it did.
+func (c *codexRPCClient) readError() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readErr
+}
 
+// streamEnded explains why the app-server's stdout ended.
+func (c *codexRPCClient) streamEnded() error {
+	if err := c.readError(); err != nil {
+		return err
+	}
 	stderr := strings.TrimSpace(c.stderr.String())
 	if stderr == "" {
 		stderr = "unknown codex app-server failure"
@@ -1049,12 +2288,48 @@ func (c *codexRPCClient) call(method string, params any, out any, onNotify func(
 	return fmt.Errorf("codex app-server stream ended: %s", stderr)
 }
 
-func (c *codexRPCClient) Close() {
-	_ = c.stdin.Flush()
-	if c.cmd.Process != nil {
-		_ = c.cmd.Process.Kill()
+// codexInterruptGrace bounds how long an interrupted turn may take to wind
+// down before the app-server is killed.
+const codexInterruptGrace = 2 * time.Second
+
+// interrupt asks the app-server to stop the running turn and waits briefly
+// for it to report completion, so Codex records the turn as interrupted
+// rather than losing the process mid-write.
+func (c *codexRPCClient) interrupt(threadID, turnID string) {
+	method, params := c.interruptRequest(threadID, turnID)
+	if _, err := c.send(method, params, nil); err != nil {
+		return
+	}
+	msgs := c.messagesFor(threadID)
+	timer := time.NewTimer(codexInterruptGrace)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return
+		case msg, ok := <-msgs:
+			if !ok || msg.Method == "turn/completed" {
+				return
+			}
+		}
 	}
-	_ = c.cmd.Wait()
+}
+
+func (c *codexRPCClient) Close() {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.inbox.discard()
+		for _, inbox := range c.threads {
+			inbox.discard()
+		}
+		c.mu.Unlock()
+		c.writeMu.Lock()
+		_ = c.stdin.Flush()
+		c.writeMu.Unlock()
+		_ = killProcess(c.cmd)
+		_ = waitCommand(c.cmd)
+		c.dump.exit(nil)
+	})
 }
 
 func buildChatPrompt(messages []Message) string {
@@ -1073,19 +2348,22 @@ func buildChatPrompt(messages []Message) string {
 	return strings.TrimSpace(b.String())
 }
 
-func buildResponsesPrompt(input any) string {
-	switch v := input.(type) {
-	case nil:
-		return ""
-	case string:
-		return strings.TrimSpace(v)
-	default:
-		b, err := json.Marshal(v)
-		if err != nil {
-			return fmt.Sprintf("%v", v)
+// commandEnv returns the environment for a CLI process: nil (inherit) without
+// overrides, else the proxy's environment with extra applied on top.
+func commandEnv(extra []string) []string {
+	if len(extra) == 0 {
+		return nil
+	}
+	return append(os.Environ(), extra...)
+}
+
+func lookupEnv(env []string, key string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(env[i], "="); ok && k == key {
+			return v
 		}
-		return string(b)
 	}
+	return ""
 }
 
 func envOrDefault(key, fallback string) string {
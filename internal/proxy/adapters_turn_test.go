@@ -2,6 +2,9 @@ package proxy
 
 import (
 	"context"
+	"errors"
+	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -96,3 +99,441 @@ func TestExtractClaudeEventResetsWhenTextChangesNonPrefix(t *testing.T) {
 		t.Fatalf("unexpected delta: %q", ev.Delta)
 	}
 }
+
+func TestCodexChatStreamForwardsAgentMessageDeltas(t *testing.T) {
+	adapter := newFakeCodexAdapter(t,
+		codexNotification("item/reasoning/summaryTextDelta", map[string]any{"delta": "thinking"}),
+		codexItem("item/started", "agentMessage"),
+		codexAgentDelta("Looking"),
+		codexAgentDelta(" around."),
+		codexItem("item/completed", "agentMessage"),
+		codexItem("item/started", "agentMessage"),
+		codexAgentDelta("Hello"),
+		codexAgentDelta(" world"),
+		codexItem("item/completed", "agentMessage"),
+		codexNotification("turn/completed", map[string]any{}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var deltas []string
+	resp, err := adapter.ChatStream(ctx, ChatRequest{Model: "gpt-5", Messages: []Message{{Role: "user", Content: "hi"}}}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	want := []string{"Looking", " around.", "\n\n", "Hello", " world"}
+	if len(deltas) != len(want) {
+		t.Fatalf("deltas = %q, want %q", deltas, want)
+	}
+	for i := range want {
+		if deltas[i] != want[i] {
+			t.Fatalf("deltas = %q, want %q", deltas, want)
+		}
+	}
+	if resp.Text != "Looking around.\n\nHello world" {
+		t.Fatalf("unexpected output: %q", resp.Text)
+	}
+}
+
+func TestCodexCancelInterruptsTurn(t *testing.T) {
+	adapter := newFakeCodexAdapter(t, codexAgentDelta("Working"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := adapter.ChatStream(ctx, ChatRequest{Model: "gpt-5", Messages: []Message{{Role: "user", Content: "hi"}}}, func(string) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+	params, ok := fakeCodexRequests(t)["turn/interrupt"]
+	if !ok {
+		t.Fatal("turn/interrupt was not sent")
+	}
+	if params["threadId"] != "thread-1" || params["turnId"] != "turn-1" {
+		t.Fatalf("unexpected turn/interrupt params %v", params)
+	}
+}
+
+func TestClaudeRespondStreamEventsEmitsThinkingDeltas(t *testing.T) {
+	adapter := newFakeClaudeAdapter(t,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Let me "}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"think."}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hi"}}}`,
+		`{"type":"assistant","message":{"content":[{"type":"thinking","thinking":"Let me think."},{"type":"text","text":"Hi"}]}}`,
+	)
+
+	var events []ResponseEvent
+	resp, err := adapter.RespondStreamEvents(context.Background(), ResponsesRequest{Model: "sonnet", Input: "hi"}, func(ev ResponseEvent) error {
+		events = append(events, ev)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RespondStreamEvents: %v", err)
+	}
+	want := []ResponseEvent{
+		{Kind: ResponseEventReasoning, Delta: "Let me "},
+		{Kind: ResponseEventReasoning, Delta: "think."},
+		{Kind: ResponseEventOutput, Delta: "Hi"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events = %#v, want %#v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("events = %#v, want %#v", events, want)
+		}
+	}
+	if resp.Text != "Hi" || resp.Reasoning != "Let me think." {
+		t.Fatalf("unexpected response: %#v", resp)
+	}
+}
+
+func TestClaudeRespondKeepsThinkingFromAssistantSnapshot(t *testing.T) {
+	adapter := newFakeClaudeAdapter(t,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hi"}}}`,
+		`{"type":"assistant","message":{"content":[{"type":"thinking","thinking":"Greeting back."},{"type":"text","text":"Hi"}]}}`,
+	)
+
+	resp, err := adapter.Respond(context.Background(), ResponsesRequest{Model: "sonnet", Input: "hi"})
+	if err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+	if resp.Text != "Hi" || resp.Reasoning != "Greeting back." {
+		t.Fatalf("unexpected response: %#v", resp)
+	}
+}
+
+func TestClaudeRespondStreamEventsEmitsToolCalls(t *testing.T) {
+	adapter := newFakeClaudeAdapter(t,
+		`{"type":"assistant","message":{"content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"ls"}}]}}`,
+		`{"type":"assistant","message":{"content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"ls"}}]}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Done"}}}`,
+	)
+
+	var tools []ToolCall
+	_, err := adapter.RespondStreamEvents(context.Background(), ResponsesRequest{Model: "sonnet", Input: "hi"}, func(ev ResponseEvent) error {
+		if ev.Kind == ResponseEventToolCall {
+			tools = append(tools, *ev.Tool)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RespondStreamEvents: %v", err)
+	}
+	if len(tools) != 1 || tools[0] != (ToolCall{ID: "toolu_1", Name: "Bash", Arguments: `{"command":"ls"}`}) {
+		t.Fatalf("unexpected tool calls: %#v", tools)
+	}
+}
+
+func TestCodexRespondStreamEventsEmitsToolCalls(t *testing.T) {
+	adapter := newFakeCodexAdapter(t,
+		codexNotification("item/started", map[string]any{"item": map[string]any{"type": "commandExecution", "id": "cmd-1", "command": "ls -la", "cwd": "/tmp"}}),
+		codexNotification("item/started", map[string]any{"item": map[string]any{"type": "mcpToolCall", "id": "mcp-1", "server": "docs", "tool": "search", "arguments": map[string]any{"q": "x"}}}),
+		codexItem("item/started", "agentMessage"),
+		codexAgentDelta("Done"),
+		codexItem("item/completed", "agentMessage"),
+		codexNotification("turn/completed", map[string]any{}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var tools []ToolCall
+	_, err := adapter.RespondStreamEvents(ctx, ResponsesRequest{Model: "gpt-5", Input: "hi"}, func(ev ResponseEvent) error {
+		if ev.Kind == ResponseEventToolCall {
+			tools = append(tools, *ev.Tool)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RespondStreamEvents: %v", err)
+	}
+	want := []ToolCall{
+		{ID: "cmd-1", Name: "shell", Arguments: `{"command":"ls -la","cwd":"/tmp"}`},
+		{ID: "mcp-1", Name: "docs.search", Arguments: `{"q":"x"}`},
+	}
+	if len(tools) != len(want) || tools[0] != want[0] || tools[1] != want[1] {
+		t.Fatalf("tool calls = %#v, want %#v", tools, want)
+	}
+}
+
+func TestCodexRespondSumsTokenUsage(t *testing.T) {
+	usage := func(in, cached, out int) map[string]any {
+		return codexNotification("thread/tokenUsage/updated", map[string]any{"tokenUsage": map[string]any{
+			"last": map[string]any{"inputTokens": in, "cachedInputTokens": cached, "outputTokens": out},
+		}})
+	}
+	adapter := newFakeCodexAdapter(t,
+		usage(100, 80, 10),
+		codexItem("item/started", "agentMessage"),
+		codexAgentDelta("Done"),
+		codexItem("item/completed", "agentMessage"),
+		usage(120, 100, 5),
+		codexNotification("turn/completed", map[string]any{}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := adapter.Respond(ctx, ResponsesRequest{Model: "gpt-5", Input: "hi"})
+	if err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+	if resp.Usage == nil || *resp.Usage != (Usage{InputTokens: 220, CachedInputTokens: 180, OutputTokens: 15}) {
+		t.Fatalf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestClaudeCLIArgsPlacesConfiguredFlagsBeforeAdapterFlags(t *testing.T) {
+	a := NewClaudeAdapterWithOptions(ClaudeOptions{
+		Args:   []string{"--allowedTools", "Read", "Grep"},
+		Models: map[string]ClaudeModelOptions{"sonnet": {Args: []string{"--max-turns", "3"}}},
+	})
+	got := strings.Join(a.cliArgs("sonnet", "", "hello", "--output-format", "text"), " ")
+	want := "-p --allowedTools Read Grep --max-turns 3 --output-format text --model sonnet"
+	if YOLOEnabled() {
+		want += " --dangerously-skip-permissions"
+	}
+	want += " hello"
+	if got != want {
+		t.Fatalf("args = %q, want %q", got, want)
+	}
+	if got := strings.Join(a.cliArgs("opus", "", "hi"), " "); strings.Contains(got, "--max-turns") {
+		t.Fatalf("per-model args leaked to another model: %q", got)
+	}
+}
+
+func TestCodexTurnUsesConfiguredAndRequestedOptions(t *testing.T) {
+	adapter := newFakeCodexAdapter(t,
+		codexAgentDelta("ok"),
+		codexItem("item/completed", "agentMessage"),
+		codexNotification("turn/completed", map[string]any{}),
+	)
+	webSearch := true
+	adapter.opts = CodexOptions{
+		CodexTurnOptions: CodexTurnOptions{Sandbox: "read-only", Cwd: "/srv/repo", Effort: "low"},
+		Models: map[string]CodexTurnOptions{
+			"gpt-5": {Sandbox: "workspace-write", ApprovalPolicy: "never", WebSearch: &webSearch},
+		},
+	}
+	prevYOLO := YOLOEnabled()
+	SetYOLO(false)
+	defer SetYOLO(prevYOLO)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := adapter.Chat(ctx, ChatRequest{Model: "gpt-5", Messages: []Message{{Role: "user", Content: "hi"}}, ReasoningEffort: "high"}); err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+
+	reqs := fakeCodexRequests(t)
+	thread := reqs["thread/start"]
+	if thread["sandbox"] != "workspace-write" || thread["approvalPolicy"] != "never" || thread["cwd"] != "/srv/repo" {
+		t.Fatalf("unexpected thread/start params: %#v", thread)
+	}
+	if cfg, _ := thread["config"].(map[string]any); cfg["tools.web_search"] != true {
+		t.Fatalf("expected web search override, got %#v", thread["config"])
+	}
+	if effort := reqs["turn/start"]["effort"]; effort != "high" {
+		t.Fatalf("expected request effort to win, got %v", effort)
+	}
+}
+
+func TestClaudeAliasRunsBaseModelWithAgents(t *testing.T) {
+	a := NewClaudeAdapterWithOptions(ClaudeOptions{
+		Models: map[string]ClaudeModelOptions{
+			"code-reviewer": {
+				Base:               "sonnet",
+				AppendSystemPrompt: "Review the diff.",
+				Agents:             `{"reviewer":{"description":"Reviews code","prompt":"Be strict."}}`,
+			},
+		},
+	})
+	if ok, _ := a.SupportsModel(context.Background(), "code-reviewer"); !ok {
+		t.Fatal("expected alias to be a supported model")
+	}
+	got := a.cliArgs("code-reviewer", "", "diff")
+	want := []string{"-p", "--append-system-prompt", "Review the diff.", "--agents", `{"reviewer":{"description":"Reviews code","prompt":"Be strict."}}`, "--model", "sonnet"}
+	for i, w := range want {
+		if got[i] != w {
+			t.Fatalf("args = %q, want prefix %q", got, want)
+		}
+	}
+}
+
+func TestClaudeSendsLongPromptsOverStdin(t *testing.T) {
+	adapter := newFakeClaudeAdapter(t, `{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"ok"}}}`)
+
+	long := strings.Repeat("x", maxArgvPrompt+1)
+	if _, err := adapter.ChatStream(context.Background(), ChatRequest{Model: "sonnet", Messages: []Message{{Role: "user", Content: long}}}, nil); err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	args, stdin := fakeClaudeInvocation(t)
+	if !strings.Contains(stdin, long) {
+		t.Fatalf("expected prompt on stdin, got %d bytes", len(stdin))
+	}
+	for _, arg := range args {
+		if strings.Contains(arg, long) {
+			t.Fatal("long prompt was also passed as an argument")
+		}
+	}
+
+	if _, err := adapter.ChatStream(context.Background(), ChatRequest{Model: "sonnet", Messages: []Message{{Role: "user", Content: "short"}}}, nil); err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	args, stdin = fakeClaudeInvocation(t)
+	if stdin != "" || !strings.Contains(args[len(args)-1], "short") {
+		t.Fatalf("expected short prompt as last argument, got args %q stdin %q", args, stdin)
+	}
+}
+
+func TestCodexWithEnvUsesOverriddenCodexHome(t *testing.T) {
+	t.Setenv("CODEX_HOME", "")
+	base := NewCodexAdapterWithOptions(CodexOptions{Env: []string{"HOME=/home/work"}})
+	if got := base.codexHome(); got != "/home/work/.codex" {
+		t.Fatalf("codexHome = %q", got)
+	}
+	scoped := base.WithEnv("CODEX_HOME=/srv/codex-b")
+	if got := scoped.codexHome(); got != "/srv/codex-b" {
+		t.Fatalf("codexHome = %q", got)
+	}
+	if len(base.opts.Env) != 1 {
+		t.Fatalf("WithEnv modified the original adapter: %q", base.opts.Env)
+	}
+}
+
+func TestClaudeTextFallbackModes(t *testing.T) {
+	for _, tt := range []struct {
+		mode     string
+		fallback bool
+	}{
+		{mode: "", fallback: true},
+		{mode: TextFallbackOn, fallback: true},
+		{mode: TextFallbackOnError, fallback: false},
+		{mode: TextFallbackOff, fallback: false},
+	} {
+		adapter := newFakeClaudeAdapter(t, `{"type":"system","subtype":"init"}`)
+		adapter.opts.TextFallback = tt.mode
+
+		ctx, trace := WithRequestTrace(context.Background())
+		resp, err := adapter.ChatStream(ctx, ChatRequest{Model: "sonnet", Messages: []Message{{Role: "user", Content: "hi"}}}, nil)
+		if err != nil {
+			t.Fatalf("%q: ChatStream: %v", tt.mode, err)
+		}
+		args, _ := fakeClaudeInvocation(t)
+		rerun := strings.Contains(strings.Join(args, " "), "--output-format text")
+		if rerun != tt.fallback || (trace.TextFallbacks() == 1) != tt.fallback {
+			t.Fatalf("%q: rerun = %v, traced %d fallbacks", tt.mode, rerun, trace.TextFallbacks())
+		}
+		if !tt.fallback && resp.Text != "" {
+			t.Fatalf("%q: unexpected text %q", tt.mode, resp.Text)
+		}
+	}
+}
+
+func TestResponsesContinueUpstreamSessions(t *testing.T) {
+	cont := &Continuation{ThreadID: "sess-1", Input: []any{map[string]any{"type": "function_call_output", "call_id": "c1", "output": "42"}}}
+	req := ResponsesRequest{Model: "sonnet", Input: "the whole transcript", Continue: cont}
+
+	claude := newFakeClaudeAdapter(t,
+		`{"type":"system","subtype":"init","session_id":"sess-1"}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"done"}}}`,
+	)
+	resp, err := claude.RespondStreamEvents(context.Background(), req, nil)
+	if err != nil {
+		t.Fatalf("claude: %v", err)
+	}
+	args, _ := fakeClaudeInvocation(t)
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "--resume sess-1") || !strings.HasSuffix(joined, "[tool] Output of call c1: 42") {
+		t.Fatalf("claude args = %q", joined)
+	}
+	if resp.ThreadID != "sess-1" {
+		t.Fatalf("claude session = %q", resp.ThreadID)
+	}
+
+	codex := newFakeCodexAdapter(t,
+		codexAgentDelta("done"),
+		codexItem("item/completed", "agentMessage"),
+		codexNotification("turn/completed", map[string]any{}),
+	)
+	req.Model, cont.ThreadID = "gpt-5", "thread-9"
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := codex.Respond(ctx, req); err != nil {
+		t.Fatalf("codex: %v", err)
+	}
+	reqs := fakeCodexRequests(t)
+	if reqs["thread/resume"]["threadId"] != "thread-9" || reqs["turn/start"]["threadId"] != "thread-9" {
+		t.Fatalf("expected the turn on the resumed thread, got %#v %#v", reqs["thread/resume"], reqs["turn/start"])
+	}
+	if _, started := reqs["thread/start"]; started {
+		t.Fatal("a resumed turn must not start a new thread")
+	}
+}
+
+func TestCodexTurnLimitInterruptsAtToolCall(t *testing.T) {
+	adapter := newFakeCodexAdapter(t,
+		codexAgentDelta("Let me look."),
+		codexNotification("item/started", map[string]any{"item": map[string]any{"type": "commandExecution", "id": "cmd-1", "command": "ls"}}),
+		codexNotification("item/started", map[string]any{"item": map[string]any{"type": "commandExecution", "id": "cmd-2", "command": "cat go.mod"}}),
+	)
+	adapter.opts.MaxTurns = 2
+
+	resp, err := adapter.ChatStream(t.Context(), ChatRequest{Model: "gpt-5", Messages: []Message{{Role: "user", Content: "hi"}}}, nil)
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	if resp.Incomplete != IncompleteMaxTurns || resp.Text != "Let me look." {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if _, ok := fakeCodexRequests(t)["turn/interrupt"]; !ok {
+		t.Fatal("the turn was not interrupted")
+	}
+}
+
+func TestCodexDeclinesApprovalRequests(t *testing.T) {
+	approval := codexNotification("item/commandExecution/requestApproval", map[string]any{"threadId": "thread-1", "turnId": "turn-1", "itemId": "cmd-1", "command": "rm -rf build"})
+	approval["id"] = "approval-1"
+	adapter := newFakeCodexAdapter(t,
+		approval,
+		codexAgentDelta("I was not allowed to clean up."),
+		codexNotification("turn/completed", map[string]any{}),
+	)
+
+	resp, err := adapter.Chat(t.Context(), ChatRequest{Model: "gpt-5", Messages: []Message{{Role: "user", Content: "clean up"}}})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if resp.Text != "I was not allowed to clean up." {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	raw, err := os.ReadFile(os.Getenv("LLM_PROXY_FAKE_CODEX_LOG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `{"id":"approval-1","jsonrpc":"2.0","result":{"decision":"decline"}}`) {
+		t.Fatalf("approval request not declined:\n%s", raw)
+	}
+}
+
+func TestCodexApprovalRequestFailsWithFailPolicy(t *testing.T) {
+	approval := codexNotification("item/commandExecution/requestApproval", map[string]any{"threadId": "thread-1", "turnId": "turn-1", "itemId": "cmd-1", "command": "rm -rf build"})
+	approval["id"] = "approval-1"
+	adapter := newFakeCodexAdapter(t, approval)
+	adapter.opts.Permissions = PermissionPolicy{OnPrompt: PermissionFail}
+
+	_, err := adapter.Chat(t.Context(), ChatRequest{Model: "gpt-5", Messages: []Message{{Role: "user", Content: "clean up"}}})
+	var prompt *PermissionPromptError
+	if !errors.As(err, &prompt) || prompt.Tool != "shell (rm -rf build)" {
+		t.Fatalf("want a PermissionPromptError for the command, got %v", err)
+	}
+	if _, ok := fakeCodexRequests(t)["turn/interrupt"]; !ok {
+		t.Fatal("the turn was not interrupted")
+	}
+}
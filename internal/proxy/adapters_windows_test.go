@@ -0,0 +1,34 @@
+//go:build windows
+
+package proxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClaudeSendsPromptsToCmdShimsOverStdin(t *testing.T) {
+	adapter := newFakeClaudeAdapter(t, `{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"ok"}}}`)
+	shim := filepath.Join(t.TempDir(), "claude.cmd")
+	if err := os.WriteFile(shim, []byte("@\""+os.Args[0]+"\" %*\r\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	adapter.bin = shim
+
+	prompt := `" & calc &`
+	if _, err := adapter.ChatStream(context.Background(), ChatRequest{Model: "sonnet", Messages: []Message{{Role: "user", Content: prompt}}}, nil); err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	args, stdin := fakeClaudeInvocation(t)
+	if !strings.Contains(stdin, prompt) {
+		t.Fatalf("expected prompt on stdin, got %q", stdin)
+	}
+	for _, arg := range args {
+		if strings.Contains(arg, "calc") {
+			t.Fatalf("prompt was passed as an argument: %q", args)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// AutoModel is the virtual model ID routed by an AutoPolicy.
+const AutoModel = "auto"
+
+// BackendAuto marks AutoModel in model listings.
+const BackendAuto Backend = "auto"
+
+// AutoPolicy picks a model for requests to AutoModel. Rules are tried in
+// order and the first match wins; Default is used when none match.
+type AutoPolicy struct {
+	Rules   []AutoRule
+	Default string
+}
+
+// AutoRule matches when every condition it sets holds. Chars count the whole
+// prompt sent to the CLI; Keywords match case-insensitively anywhere in it.
+type AutoRule struct {
+	Model    string
+	MinChars int
+	MaxChars int
+	// Keywords matches if any keyword occurs.
+	Keywords []string
+	// Efforts matches if the requested reasoning effort is one of these.
+	Efforts []string
+}
+
+func (r AutoRule) matches(prompt, effort string) bool {
+	if r.MinChars > 0 && len(prompt) < r.MinChars {
+		return false
+	}
+	if r.MaxChars > 0 && len(prompt) > r.MaxChars {
+		return false
+	}
+	if len(r.Efforts) > 0 && !slices.Contains(r.Efforts, effort) {
+		return false
+	}
+	if len(r.Keywords) > 0 {
+		lower := strings.ToLower(prompt)
+		return slices.ContainsFunc(r.Keywords, func(k string) bool {
+			return strings.Contains(lower, strings.ToLower(k))
+		})
+	}
+	return true
+}
+
+// Pick returns the model for a prompt and requested reasoning effort.
+func (p AutoPolicy) Pick(prompt, effort string) string {
+	for _, r := range p.Rules {
+		if r.matches(prompt, effort) {
+			return r.Model
+		}
+	}
+	return p.Default
+}
+
+// RouteChat returns the model ID to resolve for req: the auto policy's pick
+// for AutoModel, else req.Model unchanged. Within a conversation (see
+// WithConversation) the first pick sticks.
+func (r *Router) RouteChat(ctx context.Context, req ChatRequest) string {
+	if p := r.autoPolicy(); p != nil && req.Model == AutoModel {
+		return r.routeAuto(ctx, func() string {
+			return p.Pick(buildChatPrompt(req.Messages), req.ReasoningEffort)
+		})
+	}
+	return req.Model
+}
+
+// RouteResponses is RouteChat for Responses API requests.
+func (r *Router) RouteResponses(ctx context.Context, req ResponsesRequest) string {
+	if p := r.autoPolicy(); p != nil && req.Model == AutoModel {
+		return r.routeAuto(ctx, func() string {
+			return p.Pick(buildResponsesPrompt(req.Input), req.ReasoningEffort)
+		})
+	}
+	return req.Model
+}
+
+func (r *Router) routeAuto(ctx context.Context, pick func() string) string {
+	if pinned, ok := r.pins.get(ctx, AutoModel); ok {
+		return pinned
+	}
+	model := pick()
+	if p := r.autoPolicy(); p != nil && model != p.Default && !r.modelAvailable(ctx, model) {
+		// Don't pin a conversation to a backend that is down.
+		return p.Default
+	}
+	r.pins.set(ctx, AutoModel, model)
+	return model
+}
+
+// modelAvailable reports whether model resolves to a backend taking requests.
+func (r *Router) modelAvailable(ctx context.Context, model string) bool {
+	_, _, err := r.Resolve(ctx, model)
+	var unavailable *BackendUnavailableError
+	return !errors.As(err, &unavailable)
+}
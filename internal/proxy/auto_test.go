@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAutoPolicyPicksFirstMatchingRule(t *testing.T) {
+	p := AutoPolicy{
+		Default: "sonnet",
+		Rules: []AutoRule{
+			{Model: "opus", Efforts: []string{"high", "xhigh"}},
+			{Model: "opus", MinChars: 1000},
+			{Model: "opus", Keywords: []string{"Architecture"}},
+			{Model: "haiku", MaxChars: 40},
+		},
+	}
+	cases := []struct {
+		prompt, effort, want string
+	}{
+		{"hi", "", "haiku"},
+		{"hi", "high", "opus"},
+		{strings.Repeat("x", 1200), "", "opus"},
+		{"review the architecture", "", "opus"},
+		{"explain this function to me in a few sentences please", "low", "sonnet"},
+	}
+	for _, c := range cases {
+		if got := p.Pick(c.prompt, c.effort); got != c.want {
+			t.Errorf("Pick(%.20q, %q) = %q, want %q", c.prompt, c.effort, got, c.want)
+		}
+	}
+}
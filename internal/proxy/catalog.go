@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// modelCatalogTTL is how long a fetched model list counts as fresh.
+	modelCatalogTTL = 5 * time.Minute
+	// modelCatalogRefreshTimeout bounds a background refresh.
+	modelCatalogRefreshTimeout = time.Minute
+)
+
+// modelCatalog caches a backend's model list. Once a fetch has succeeded the
+// cached list is always served immediately; when it is stale a single refresh
+// runs in the background and a failed refresh keeps the old list.
+type modelCatalog struct {
+	mu         sync.Mutex
+	models     []Model
+	fetchedAt  time.Time
+	refreshing bool
+}
+
+func (c *modelCatalog) get(ctx context.Context, fetch func(context.Context) ([]Model, error)) ([]Model, error) {
+	c.mu.Lock()
+	if c.models != nil {
+		models := slices.Clone(c.models)
+		if time.Since(c.fetchedAt) > modelCatalogTTL && !c.refreshing {
+			c.refreshing = true
+			go c.refresh(fetch)
+		}
+		c.mu.Unlock()
+		return models, nil
+	}
+	c.mu.Unlock()
+
+	models, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.models, c.fetchedAt = models, time.Now()
+	c.mu.Unlock()
+	return slices.Clone(models), nil
+}
+
+// set caches models fetched some other way.
+func (c *modelCatalog) set(models []Model) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.models, c.fetchedAt = models, time.Now()
+}
+
+func (c *modelCatalog) refresh(fetch func(context.Context) ([]Model, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), modelCatalogRefreshTimeout)
+	defer cancel()
+	models, err := fetch(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshing = false
+	if err != nil {
+		log.Printf("model list refresh failed, serving cached list: %v", err)
+		return
+	}
+	c.models, c.fetchedAt = models, time.Now()
+}
+
+// PrefetchModels fills the backends' model caches so the first /v1/models
+// call does not wait on the CLIs. Errors are left for real requests to report.
+func (r *Router) PrefetchModels(ctx context.Context) {
+	_, _ = r.ListModels(ctx)
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestModelCatalogServesStaleListWhileRefreshing(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fetch := func(context.Context) ([]Model, error) {
+		if calls.Add(1) > 1 {
+			<-release
+			return []Model{{ID: "new"}}, nil
+		}
+		return []Model{{ID: "old"}}, nil
+	}
+
+	var c modelCatalog
+	if got, err := c.get(context.Background(), fetch); err != nil || got[0].ID != "old" {
+		t.Fatalf("first fetch: %v %v", got, err)
+	}
+	c.mu.Lock()
+	c.fetchedAt = time.Now().Add(-2 * modelCatalogTTL)
+	c.mu.Unlock()
+
+	for range 3 {
+		got, err := c.get(context.Background(), fetch)
+		if err != nil || got[0].ID != "old" {
+			t.Fatalf("expected stale list without waiting, got %v %v", got, err)
+		}
+	}
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, _ := c.get(context.Background(), fetch)
+		if got[0].ID == "new" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh never landed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("expected a single background refresh, got %d fetches", n)
+	}
+}
+
+func TestModelCatalogDoesNotCacheFailures(t *testing.T) {
+	var c modelCatalog
+	fail := func(context.Context) ([]Model, error) { return nil, errors.New("not logged in") }
+	if _, err := c.get(context.Background(), fail); err == nil {
+		t.Fatal("expected error")
+	}
+	ok := func(context.Context) ([]Model, error) { return []Model{{ID: "gpt-5"}}, nil }
+	if got, err := c.get(context.Background(), ok); err != nil || len(got) != 1 {
+		t.Fatalf("expected retry after failure, got %v %v", got, err)
+	}
+}
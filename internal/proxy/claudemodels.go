@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The Claude CLI has no command that lists models, so the static list
+// (CLAUDE_MODELS, or haiku, sonnet and opus) is extended with the models the
+// account's settings name.
+
+// claudeModelID matches the IDs and aliases the CLI's --model accepts.
+var claudeModelID = regexp.MustCompile(`^(claude-[a-z0-9.-]+|haiku|sonnet|opus|opusplan|default)(\[1m\])?$`)
+
+// claudeModelEnv are the settings and environment variables that pin the
+// model behind each alias.
+var claudeModelEnv = []string{"ANTHROPIC_MODEL", "ANTHROPIC_DEFAULT_OPUS_MODEL", "ANTHROPIC_DEFAULT_SONNET_MODEL", "ANTHROPIC_DEFAULT_HAIKU_MODEL"}
+
+func (a *ClaudeAdapter) fetchModels(context.Context) ([]Model, error) {
+	ids := slices.Clone(a.models)
+	for _, id := range a.settingsModels() {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	for _, alias := range a.aliases {
+		if !slices.Contains(ids, alias) {
+			ids = append(ids, alias)
+		}
+	}
+	out := make([]Model, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, Model{ID: id, Backend: BackendClaude})
+	}
+	return out, nil
+}
+
+// settingsModels returns the models named by the account's settings.json
+// (its model and the env it sets for the CLI) and by the environment.
+func (a *ClaudeAdapter) settingsModels() []string {
+	var settings struct {
+		Model string            `json:"model"`
+		Env   map[string]string `json:"env"`
+	}
+	if raw, err := os.ReadFile(filepath.Join(a.configDir(), "settings.json")); err == nil {
+		_ = json.Unmarshal(raw, &settings)
+	}
+	var ids []string
+	add := func(id string) {
+		id = strings.TrimSpace(id)
+		if claudeModelID.MatchString(id) && id != "default" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	add(settings.Model)
+	for _, key := range claudeModelEnv {
+		add(settings.Env[key])
+		if v := lookupEnv(a.opts.Env, key); v != "" {
+			add(v)
+		} else {
+			add(os.Getenv(key))
+		}
+	}
+	return ids
+}
+
+// configDir is the CLI's config directory: CLAUDE_CONFIG_DIR, else
+// ~/.claude under the HOME the CLI runs with.
+func (a *ClaudeAdapter) configDir() string {
+	if dir := lookupEnv(a.opts.Env, "CLAUDE_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	home := lookupEnv(a.opts.Env, "HOME")
+	if home == "" {
+		if dir := os.Getenv("CLAUDE_CONFIG_DIR"); dir != "" {
+			return dir
+		}
+		home, _ = os.UserHomeDir()
+	}
+	return filepath.Join(home, ".claude")
+}
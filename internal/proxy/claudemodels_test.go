@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func claudeModelIDs(t *testing.T, a *ClaudeAdapter) []string {
+	t.Helper()
+	models, err := a.ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, m := range models {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestClaudeModelsIncludeSettings(t *testing.T) {
+	newFakeClaudeAdapter(t)
+	t.Setenv("CLAUDE_MODELS", "")
+	t.Setenv("ANTHROPIC_DEFAULT_HAIKU_MODEL", "")
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".claude"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	settings := `{"model":"claude-opus-4-1","env":{"ANTHROPIC_DEFAULT_SONNET_MODEL":"claude-sonnet-4-5"}}`
+	if err := os.WriteFile(filepath.Join(home, ".claude", "settings.json"), []byte(settings), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a := NewClaudeAdapterWithOptions(ClaudeOptions{
+		Bin: os.Args[0],
+		Env: []string{"HOME=" + home, "ANTHROPIC_DEFAULT_HAIKU_MODEL=claude-haiku-4-5"},
+	})
+
+	got := claudeModelIDs(t, a)
+	want := []string{"haiku", "sonnet", "opus", "claude-opus-4-1", "claude-sonnet-4-5", "claude-haiku-4-5"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("models = %q, want %q", got, want)
+	}
+}
+
+func TestRouterListsTheBaseOfAliasesAndVirtualModels(t *testing.T) {
+	newFakeClaudeAdapter(t)
+	t.Setenv("CLAUDE_MODELS", "sonnet")
+	claude := NewClaudeAdapterWithOptions(ClaudeOptions{
+		Bin:    os.Args[0],
+		Models: map[string]ClaudeModelOptions{"reviewer": {Base: "sonnet"}},
+	})
+	r := NewRouter(claude, &raceTestAdapter{})
+	r.SetVirtualModels(map[string]VirtualModel{"commit-writer": {Base: "sonnet"}})
+
+	models, err := r.ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bases := map[string]string{}
+	for _, m := range models {
+		bases[m.ID] = m.Base
+	}
+	for id, want := range map[string]string{"sonnet": "", "reviewer": "sonnet", "commit-writer": "sonnet"} {
+		if got, ok := bases[id]; !ok || got != want {
+			t.Errorf("%s: base = %q (listed %v), want %q", id, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// claudeStreamFormat is the shape of the CLI's stream-json output, which has
+// changed between releases. Releases with --include-partial-messages stream
+// token deltas wrapped in stream_event lines, followed by each complete
+// assistant message; older ones only print the complete messages.
+type claudeStreamFormat int
+
+const (
+	claudeStreamPartial claudeStreamFormat = iota
+	claudeStreamMessages
+)
+
+// claudeStreamFormatFor picks the format from the CLI's version, assuming
+// the current one when it is not known yet.
+func claudeStreamFormatFor(v *cliVersion) claudeStreamFormat {
+	if v != nil && v.less(claudePartialMessagesVersion) {
+		return claudeStreamMessages
+	}
+	return claudeStreamPartial
+}
+
+// claudeStreamParser turns the lines of one stream-json run into response
+// events. Whatever the format, a run that printed an answer yields it: when
+// no deltas arrived, finish returns the text of the assistant messages or,
+// failing that, the result line, instead of leaving the caller to rerun the
+// prompt as plain text. Line types it does not know are logged once each.
+type claudeStreamParser struct {
+	format      claudeStreamFormat
+	version     string
+	lastByIndex map[string]string
+	seenTools   map[string]bool
+	// Text and thinking from complete assistant messages.
+	snapshotText      strings.Builder
+	snapshotReasoning strings.Builder
+	emittedOutput     bool
+	emittedReasoning  bool
+	result            string
+	// resultErr is the message of a result that reports an error.
+	resultErr string
+	// errType and errMessage come from the last error event, or the error
+	// of an assistant message that the API call behind it failed with.
+	errType    string
+	errMessage string
+	sessionID  string
+	// usage and stopReason come from the result line.
+	usage      *Usage
+	stopReason string
+	// turnLimit is set when the run stopped at --max-turns.
+	turnLimit bool
+}
+
+func (a *ClaudeAdapter) streamParser() *claudeStreamParser {
+	v := a.version.Load()
+	version := "unknown"
+	if v != nil {
+		version = v.String()
+	}
+	return &claudeStreamParser{
+		format:      claudeStreamFormatFor(v),
+		version:     version,
+		lastByIndex: map[string]string{},
+		seenTools:   map[string]bool{},
+	}
+}
+
+// claudeLineTypes are the stream-json line types the parser understands.
+var claudeLineTypes = map[string]bool{
+	"system": true, "user": true, "assistant": true, "result": true, "stream_event": true, "error": true,
+	// Unwrapped stream events, printed by some releases.
+	"message_start": true, "message_delta": true, "message_stop": true,
+	"content_block_start": true, "content_block_delta": true, "content_block_stop": true,
+}
+
+// parse returns the events in line: output and reasoning deltas, and tool
+// calls the first time each is seen.
+func (p *claudeStreamParser) parse(line string) []ResponseEvent {
+	var head struct {
+		Type      string `json:"type"`
+		Subtype   string `json:"subtype"`
+		IsError   bool   `json:"is_error"`
+		Result    string `json:"result"`
+		SessionID string `json:"session_id"`
+		// The stop reason is on result lines, assistant messages and
+		// message_delta events (wrapped in stream_event or not).
+		StopReason string `json:"stop_reason"`
+		Message    struct {
+			StopReason string `json:"stop_reason"`
+		} `json:"message"`
+		Delta struct {
+			StopReason string `json:"stop_reason"`
+		} `json:"delta"`
+		Event struct {
+			Type  string `json:"type"`
+			Delta struct {
+				StopReason string `json:"stop_reason"`
+			} `json:"delta"`
+			Error *claudeAPIError `json:"error"`
+		} `json:"event"`
+		// An error event's {"type", "message"}, or the kind of error an
+		// assistant message failed with ("rate_limit", …).
+		Error json.RawMessage `json:"error"`
+		Usage *struct {
+			InputTokens              int `json:"input_tokens"`
+			CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+			CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+			OutputTokens             int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal([]byte(line), &head); err != nil {
+		warnClaudeFormat(p.version, "non-JSON output")
+		return nil
+	}
+	if head.SessionID != "" {
+		p.sessionID = head.SessionID
+	}
+	for _, reason := range []string{head.StopReason, head.Message.StopReason, head.Delta.StopReason, head.Event.Delta.StopReason} {
+		if reason != "" {
+			p.stopReason = reason
+		}
+	}
+	p.observeError(head.Type, head.Error)
+	if head.Type == "stream_event" && head.Event.Type == "error" && head.Event.Error != nil {
+		p.errType, p.errMessage = head.Event.Error.Type, head.Event.Error.Message
+	}
+	var events []ResponseEvent
+	switch head.Type {
+	case "error":
+		return nil
+	case "result":
+		if head.Subtype == "error_max_turns" {
+			p.turnLimit = true
+		}
+		if head.IsError {
+			p.resultErr = head.Result
+		} else {
+			p.result = head.Result
+		}
+		if u := head.Usage; u != nil {
+			// Anthropic counts cached prompt tokens apart from input_tokens.
+			p.usage = &Usage{
+				InputTokens:       u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+				CachedInputTokens: u.CacheReadInputTokens,
+				OutputTokens:      u.OutputTokens,
+			}
+		}
+		return nil
+	case "assistant":
+		snap, ok := parseClaudeSnapshot(line)
+		if !ok {
+			return nil
+		}
+		for _, tool := range snap.toolCalls() {
+			if p.seenTools[tool.ID] {
+				continue
+			}
+			p.seenTools[tool.ID] = true
+			events = append(events, ResponseEvent{Kind: ResponseEventToolCall, Tool: &tool})
+		}
+		thinking, text := snap.thinking(), snap.text()
+		appendParagraph(&p.snapshotReasoning, thinking)
+		appendParagraph(&p.snapshotText, text)
+		if p.format == claudeStreamMessages {
+			// Complete messages are all this format has, so they are the stream.
+			if thinking != "" {
+				events = append(events, p.emit(ResponseEvent{Kind: ResponseEventReasoning, Delta: thinking}))
+			}
+			if text != "" {
+				events = append(events, p.emit(ResponseEvent{Kind: ResponseEventOutput, Delta: text}))
+			}
+		}
+		return events
+	}
+	if ev, ok := extractClaudeEvent(line, p.lastByIndex); ok && ev.Delta != "" {
+		return append(events, p.emit(ev))
+	}
+	if !claudeLineTypes[head.Type] {
+		warnClaudeFormat(p.version, fmt.Sprintf("line type %q", head.Type))
+	}
+	return events
+}
+
+// claudeAPIError is the error of an Anthropic API error event.
+type claudeAPIError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// observeError records the error a line of type lineType carries: an error
+// event has the API's error object, and an assistant message whose API call
+// failed names the kind of failure.
+func (p *claudeStreamParser) observeError(lineType string, raw json.RawMessage) {
+	if len(raw) == 0 {
+		return
+	}
+	switch lineType {
+	case "error":
+		var e claudeAPIError
+		if json.Unmarshal(raw, &e) == nil && e.Type != "" {
+			p.errType, p.errMessage = e.Type, e.Message
+		}
+	case "assistant":
+		var kind string
+		if json.Unmarshal(raw, &kind) == nil && kind != "" {
+			p.errType = kind
+		}
+	}
+}
+
+// failure returns the error the run reported, if it reported one.
+func (p *claudeStreamParser) failure() *UpstreamError {
+	if p.resultErr == "" && p.errType == "" {
+		return nil
+	}
+	msg := p.resultErr
+	if msg == "" {
+		msg = p.errMessage
+	}
+	return &UpstreamError{Type: p.errType, Message: msg}
+}
+
+func (p *claudeStreamParser) emit(ev ResponseEvent) ResponseEvent {
+	if ev.Kind == ResponseEventReasoning {
+		p.emittedReasoning = true
+	} else {
+		p.emittedOutput = true
+	}
+	return ev
+}
+
+// finish returns the answer of a run whose output never arrived as deltas.
+func (p *claudeStreamParser) finish() []ResponseEvent {
+	if p.emittedOutput {
+		return nil
+	}
+	text := strings.TrimSpace(p.snapshotText.String())
+	if text == "" {
+		text = strings.TrimSpace(p.result)
+	}
+	if text == "" {
+		return nil
+	}
+	if p.format == claudeStreamPartial {
+		warnClaudeFormat(p.version, "a stream without token deltas")
+	}
+	return []ResponseEvent{p.emit(ResponseEvent{Kind: ResponseEventOutput, Delta: text})}
+}
+
+// incomplete returns why the answer was cut off: by the model's output limit
+// or the run's turn limit.
+func (p *claudeStreamParser) incomplete() string {
+	if p.turnLimit {
+		return IncompleteMaxTurns
+	}
+	if p.stopReason == "max_tokens" {
+		return "max_output_tokens"
+	}
+	return ""
+}
+
+// reasoning is the thinking from the complete messages, for runs that did
+// not stream it.
+func (p *claudeStreamParser) reasoning() string {
+	if p.emittedReasoning {
+		return ""
+	}
+	return p.snapshotReasoning.String()
+}
+
+var claudeFormatWarnings sync.Map
+
+// warnClaudeFormat logs, once per version and kind, stream-json output the
+// parser does not understand, which usually means the CLI changed its format.
+func warnClaudeFormat(version, what string) {
+	if _, seen := claudeFormatWarnings.LoadOrStore(version+"\x00"+what, true); seen {
+		return
+	}
+	log.Printf("claude %s: unrecognised stream-json output (%s); streaming may degrade until llm-proxy supports this CLI version", version, what)
+}
+
+func appendParagraph(b *strings.Builder, s string) {
+	if s == "" {
+		return
+	}
+	if b.Len() > 0 {
+		b.WriteString("\n\n")
+	}
+	b.WriteString(s)
+}
+
+// claudeSnapshot is a complete {"type":"assistant"} stream-json message.
+type claudeSnapshot struct {
+	Type    string `json:"type"`
+	Message struct {
+		Content []struct {
+			Type     string          `json:"type"`
+			Text     string          `json:"text"`
+			Thinking string          `json:"thinking"`
+			ID       string          `json:"id"`
+			Name     string          `json:"name"`
+			Input    json.RawMessage `json:"input"`
+		} `json:"content"`
+	} `json:"message"`
+}
+
+func parseClaudeSnapshot(line string) (claudeSnapshot, bool) {
+	var snap claudeSnapshot
+	if json.Unmarshal([]byte(line), &snap) != nil || snap.Type != "assistant" {
+		return claudeSnapshot{}, false
+	}
+	return snap, true
+}
+
+func (s claudeSnapshot) thinking() string {
+	var parts []string
+	for _, c := range s.Message.Content {
+		if c.Type == "thinking" && strings.TrimSpace(c.Thinking) != "" {
+			parts = append(parts, strings.TrimSpace(c.Thinking))
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (s claudeSnapshot) text() string {
+	var parts []string
+	for _, c := range s.Message.Content {
+		if c.Type == "text" && strings.TrimSpace(c.Text) != "" {
+			parts = append(parts, strings.TrimSpace(c.Text))
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (s claudeSnapshot) toolCalls() []ToolCall {
+	var out []ToolCall
+	for _, c := range s.Message.Content {
+		if c.Type != "tool_use" || c.Name == "" {
+			continue
+		}
+		args := "{}"
+		if len(c.Input) > 0 && string(c.Input) != "null" {
+			args = string(c.Input)
+		}
+		out = append(out, ToolCall{ID: c.ID, Name: c.Name, Arguments: args})
+	}
+	return out
+}
+
+func extractClaudeEvent(line string, lastByIndex map[string]string) (ResponseEvent, bool) {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return ResponseEvent{}, false
+	}
+
+	// claude stream-json wraps token deltas inside {"type":"stream_event","event":{...}}
+	// while other entries may include top-level assistant/message objects.
+	if strings.EqualFold(stringVal(raw["type"]), "stream_event") {
+		if ev, ok := raw["event"].(map[string]any); ok {
+			raw = ev
+		}
+	}
+
+	typ := stringVal(raw["type"])
+	switch typ {
+	case "content_block_delta":
+		if d, ok := raw["delta"].(map[string]any); ok {
+			if t := stringVal(d["thinking"]); t != "" {
+				return ResponseEvent{Kind: ResponseEventReasoning, Delta: t}, true
+			}
+			if t := stringVal(d["text"]); t != "" {
+				return ResponseEvent{Kind: ResponseEventOutput, Delta: t}, true
+			}
+		}
+	case "content_block_start":
+		if cb, ok := raw["content_block"].(map[string]any); ok {
+			if t := stringVal(cb["thinking"]); t != "" {
+				return ResponseEvent{Kind: ResponseEventReasoning, Delta: t}, true
+			}
+			if t := stringVal(cb["text"]); t != "" {
+				return ResponseEvent{Kind: ResponseEventOutput, Delta: t}, true
+			}
+		}
+	case "message_delta":
+		if d, ok := raw["delta"].(map[string]any); ok {
+			if t := stringVal(d["text"]); t != "" {
+				return ResponseEvent{Kind: ResponseEventOutput, Delta: t}, true
+			}
+		}
+	}
+
+	// Fallback parser for legacy shapes that expose growing partial content.
+	// Skip assistant/user snapshots when stream_event deltas are available to avoid duplicates.
+	if msg, ok := raw["message"].(map[string]any); ok && !strings.EqualFold(typ, "assistant") && !strings.EqualFold(typ, "user") {
+		if content, ok := msg["content"].([]any); ok {
+			for idx, it := range content {
+				item, ok := it.(map[string]any)
+				if !ok {
+					continue
+				}
+				full := stringVal(item["text"])
+				kind := ResponseEventOutput
+				if strings.EqualFold(stringVal(item["type"]), "thinking") {
+					full = stringVal(item["thinking"])
+					kind = ResponseEventReasoning
+				}
+				if full == "" {
+					continue
+				}
+				cacheKey := fmt.Sprintf("%d:%s", idx, kind)
+				prev := lastByIndex[cacheKey]
+				if strings.HasPrefix(full, prev) {
+					delta := strings.TrimPrefix(full, prev)
+					lastByIndex[cacheKey] = full
+					if delta != "" {
+						return ResponseEvent{Kind: kind, Delta: delta}, true
+					}
+				} else if prev == "" {
+					lastByIndex[cacheKey] = full
+					return ResponseEvent{Kind: kind, Delta: full}, true
+				} else {
+					// New assistant message or reset of the same index; emit full text again.
+					lastByIndex[cacheKey] = full
+					return ResponseEvent{Kind: kind, Delta: full}, true
+				}
+			}
+		}
+	}
+
+	return ResponseEvent{}, false
+}
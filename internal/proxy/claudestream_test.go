@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The fixtures in testdata/claude-stream are synthetic, written by hand
+// rather than captured from a CLI: each follows the stream-json layout of
+// the release it is named after, with made-up IDs and content. Replace one
+// with a real capture when a release changes the format.
+func TestClaudeStreamParserFixtures(t *testing.T) {
+	tests := []struct {
+		version   string
+		deltas    int
+		text      string
+		reasoning string
+		tools     []string
+	}{
+		{version: "1.0.60", deltas: 2, text: "There is one file: main.go.", reasoning: "I should list the files.", tools: []string{"toolu_01"}},
+		{version: "1.0.98", deltas: 2, text: "Hello, world."},
+		{version: "2.0.14", deltas: 4, text: "One file: main.go.", reasoning: "Check the directory.", tools: []string{"toolu_01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			v, ok := parseCLIVersion(tt.version)
+			if !ok {
+				t.Fatalf("bad version %q", tt.version)
+			}
+			adapter := &ClaudeAdapter{}
+			adapter.version.Store(&v)
+			parser := adapter.streamParser()
+
+			f, err := os.Open(filepath.Join("testdata", "claude-stream", tt.version+".jsonl"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var events []ResponseEvent
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				events = append(events, parser.parse(scanner.Text())...)
+			}
+			events = append(events, parser.finish()...)
+
+			var text, reasoning strings.Builder
+			var tools []string
+			deltas := 0
+			for _, ev := range events {
+				switch ev.Kind {
+				case ResponseEventOutput:
+					text.WriteString(ev.Delta)
+					deltas++
+				case ResponseEventReasoning:
+					reasoning.WriteString(ev.Delta)
+					deltas++
+				case ResponseEventToolCall:
+					tools = append(tools, ev.Tool.ID)
+				}
+			}
+			if text.String() != tt.text || reasoning.String() != tt.reasoning {
+				t.Fatalf("text = %q, reasoning = %q", text.String(), reasoning.String())
+			}
+			if deltas != tt.deltas {
+				t.Fatalf("got %d deltas, want %d", deltas, tt.deltas)
+			}
+			if strings.Join(tools, ",") != strings.Join(tt.tools, ",") {
+				t.Fatalf("tools = %v, want %v", tools, tt.tools)
+			}
+		})
+	}
+}
+
+func TestClaudeStreamParserFallsBackToResult(t *testing.T) {
+	parser := (&ClaudeAdapter{}).streamParser()
+	for _, line := range []string{
+		`{"type":"system","subtype":"init"}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_chunk","value":"Hi"}}}`,
+		`{"type":"result","subtype":"success","is_error":false,"result":"Hi there"}`,
+	} {
+		if events := parser.parse(line); len(events) != 0 {
+			t.Fatalf("unexpected events %#v", events)
+		}
+	}
+	events := parser.finish()
+	if len(events) != 1 || events[0] != (ResponseEvent{Kind: ResponseEventOutput, Delta: "Hi there"}) {
+		t.Fatalf("finish = %#v", events)
+	}
+}
+
+func TestClaudeStreamWithoutDeltasDoesNotRerunAsText(t *testing.T) {
+	adapter := newFakeClaudeAdapter(t,
+		`{"type":"assistant","message":{"content":[{"type":"text","text":"From the message"}]}}`,
+		`{"type":"result","subtype":"success","is_error":false,"result":"From the message"}`,
+	)
+
+	var deltas []string
+	resp, err := adapter.ChatStream(t.Context(), ChatRequest{Model: "sonnet", Messages: []Message{{Role: "user", Content: "hi"}}}, func(d string) error {
+		deltas = append(deltas, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	if resp.Text != "From the message" || len(deltas) != 1 {
+		t.Fatalf("resp = %#v, deltas = %q", resp, deltas)
+	}
+	args, _ := fakeClaudeInvocation(t)
+	if !strings.Contains(strings.Join(args, " "), "stream-json") {
+		t.Fatalf("last run was not the stream: %q", args)
+	}
+}
+
+func TestClaudeRespondReportsUsageAndTruncation(t *testing.T) {
+	adapter := newFakeClaudeAdapter(t,
+		`{"type":"assistant","message":{"content":[{"type":"text","text":"Cut"}],"stop_reason":"max_tokens"}}`,
+		`{"type":"result","subtype":"success","is_error":false,"result":"Cut","usage":{"input_tokens":10,"cache_creation_input_tokens":5,"cache_read_input_tokens":100,"output_tokens":7}}`,
+	)
+
+	resp, err := adapter.Respond(t.Context(), ResponsesRequest{Model: "sonnet", Input: "hi"})
+	if err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+	if resp.Usage == nil || *resp.Usage != (Usage{InputTokens: 115, CachedInputTokens: 100, OutputTokens: 7}) {
+		t.Fatalf("usage = %+v", resp.Usage)
+	}
+	if resp.Incomplete != "max_output_tokens" {
+		t.Fatalf("incomplete = %q", resp.Incomplete)
+	}
+}
+
+func TestClaudeRunRecordsCLITimings(t *testing.T) {
+	adapter := newFakeClaudeAdapter(t,
+		`{"type":"system","subtype":"init","session_id":"s1"}`,
+		`{"type":"assistant","message":{"content":[{"type":"text","text":"Hi"}]}}`,
+		`{"type":"result","subtype":"success","is_error":false,"result":"Hi"}`,
+	)
+	ctx, trace := WithRequestTrace(t.Context())
+	started := time.Now()
+	if _, err := adapter.RespondStreamEvents(ctx, ResponsesRequest{Model: "sonnet", Input: "hi"}, nil); err != nil {
+		t.Fatalf("RespondStreamEvents: %v", err)
+	}
+	elapsed := time.Since(started)
+
+	got := trace.Timings()
+	if got.Spawn <= 0 || got.FirstByte < 0 || got.Stream < 0 {
+		t.Fatalf("unexpected timings: %+v", got)
+	}
+	if total := got.Spawn + got.FirstByte + got.Stream; total > elapsed {
+		t.Fatalf("timings add up to %v, more than the run took (%v)", total, elapsed)
+	}
+}
+
+func TestClaudeTurnLimitEndsIncomplete(t *testing.T) {
+	adapter := newFakeClaudeAdapter(t,
+		`{"type":"assistant","message":{"content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"ls"}}]}}`,
+		`{"type":"result","subtype":"error_max_turns","is_error":true,"num_turns":3}`,
+	)
+	adapter.opts = ClaudeOptions{MaxTurns: 5, Models: map[string]ClaudeModelOptions{"sonnet": {MaxTurns: 3}}}
+
+	resp, err := adapter.Respond(t.Context(), ResponsesRequest{Model: "sonnet", Input: "hi"})
+	if err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+	if resp.Incomplete != IncompleteMaxTurns || resp.Text != turnLimitNotice(3) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	args, _ := fakeClaudeInvocation(t)
+	if !strings.Contains(strings.Join(args, " "), "--max-turns 3") {
+		t.Fatalf("--max-turns not passed: %q", args)
+	}
+}
+
+func TestClaudeStallAfterToolCallFailsAsPermissionPrompt(t *testing.T) {
+	adapter := newFakeClaudeAdapter(t,
+		`{"type":"assistant","message":{"content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"rm -rf build"}}]}}`,
+	)
+	t.Setenv("LLM_PROXY_FAKE_CLAUDE_HANG", "1m")
+	adapter.opts.Permissions = PermissionPolicy{StallTimeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	_, err := adapter.ChatStream(t.Context(), ChatRequest{Model: "sonnet", Messages: []Message{{Role: "user", Content: "clean up"}}}, nil)
+	var prompt *PermissionPromptError
+	if !errors.As(err, &prompt) || prompt.Tool != "Bash" {
+		t.Fatalf("want a PermissionPromptError for Bash, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("stalled run took %s to stop", elapsed)
+	}
+	if ClassifyError(err, "") != ErrorPermission {
+		t.Fatalf("classified as %q", ClassifyError(err, ""))
+	}
+}
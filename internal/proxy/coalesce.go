@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Coalescer runs one upstream turn for identical concurrent requests (same
+// adapter, call, request, caller and safety preset) and fans its stream out
+// to every caller.
+// Callers joining late first replay what was already streamed. The upstream
+// turn is cancelled only once every caller has gone, or after
+// flightTimeout.
+type Coalescer struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+	timeout time.Duration
+}
+
+// flightTimeout bounds a shared upstream turn. It runs detached from the
+// caller that started it, whose deadline it does not keep, so without a
+// bound of its own a CLI that hangs would hold every identical request
+// that comes along.
+const flightTimeout = time.Hour
+
+func NewCoalescer() *Coalescer {
+	return &Coalescer{flights: map[string]*flight{}, timeout: flightTimeout}
+}
+
+type flight struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []ResponseEvent
+	done   bool
+	res    any
+	err    error
+	refs   int
+	cancel context.CancelFunc
+}
+
+// Wrap returns adapter with its calls coalesced.
+func (c *Coalescer) Wrap(adapter Adapter) Adapter {
+	return &coalescingAdapter{Adapter: adapter, c: c}
+}
+
+type coalescingAdapter struct {
+	Adapter
+	c *Coalescer
+}
+
+type callerKey struct{}
+
+// WithCaller tags ctx with who a request runs for, such as its API key.
+// Requests of different callers are never coalesced: one must not get an
+// answer produced under another's permissions.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+func callerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
+
+// key identifies a flight. Requests only share one when they would run the
+// same way: the safety preset decides what the CLI may do.
+func (a *coalescingAdapter) key(ctx context.Context, call string, req any) string {
+	raw, _ := json.Marshal(req)
+	sum := sha256.Sum256(fmt.Appendf(nil, "%p\x00%s\x00%q\x00%s\x00%s", a.Adapter, call, callerFromContext(ctx), SafetyFromContext(ctx), raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *coalescingAdapter) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	res, err := a.c.do(ctx, a.key(ctx, "chat", req), func(ctx context.Context, _ func(ResponseEvent) error) (any, error) {
+		return a.Adapter.Chat(ctx, req)
+	}, nil)
+	resp, _ := res.(ChatResponse)
+	return resp, err
+}
+
+func (a *coalescingAdapter) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (ChatResponse, error) {
+	res, err := a.c.do(ctx, a.key(ctx, "chat_stream", req), func(ctx context.Context, emit func(ResponseEvent) error) (any, error) {
+		return a.Adapter.ChatStream(ctx, req, func(delta string) error {
+			return emit(ResponseEvent{Kind: ResponseEventOutput, Delta: delta})
+		})
+	}, func(ev ResponseEvent) error { return onDelta(ev.Delta) })
+	resp, _ := res.(ChatResponse)
+	return resp, err
+}
+
+func (a *coalescingAdapter) Respond(ctx context.Context, req ResponsesRequest) (ResponsesResponse, error) {
+	res, err := a.c.do(ctx, a.key(ctx, "respond", req), func(ctx context.Context, _ func(ResponseEvent) error) (any, error) {
+		return a.Adapter.Respond(ctx, req)
+	}, nil)
+	resp, _ := res.(ResponsesResponse)
+	return resp, err
+}
+
+func (a *coalescingAdapter) RespondStream(ctx context.Context, req ResponsesRequest, onDelta func(string) error) (ResponsesResponse, error) {
+	res, err := a.c.do(ctx, a.key(ctx, "respond_stream", req), func(ctx context.Context, emit func(ResponseEvent) error) (any, error) {
+		return a.Adapter.RespondStream(ctx, req, func(delta string) error {
+			return emit(ResponseEvent{Kind: ResponseEventOutput, Delta: delta})
+		})
+	}, func(ev ResponseEvent) error { return onDelta(ev.Delta) })
+	resp, _ := res.(ResponsesResponse)
+	return resp, err
+}
+
+func (a *coalescingAdapter) RespondStreamEvents(ctx context.Context, req ResponsesRequest, onEvent func(ResponseEvent) error) (ResponsesResponse, error) {
+	res, err := a.c.do(ctx, a.key(ctx, "respond_events", req), func(ctx context.Context, emit func(ResponseEvent) error) (any, error) {
+		if ea, ok := a.Adapter.(ResponsesEventAdapter); ok {
+			return ea.RespondStreamEvents(ctx, req, emit)
+		}
+		return a.Adapter.RespondStream(ctx, req, func(delta string) error {
+			return emit(ResponseEvent{Kind: ResponseEventOutput, Delta: delta})
+		})
+	}, onEvent)
+	resp, _ := res.(ResponsesResponse)
+	return resp, err
+}
+
+// do joins or starts the flight for key and relays its events to onEvent
+// (which may be nil) until it finishes or ctx is done.
+func (c *Coalescer) do(ctx context.Context, key string, run func(context.Context, func(ResponseEvent) error) (any, error), onEvent func(ResponseEvent) error) (any, error) {
+	c.mu.Lock()
+	f, ok := c.flights[key]
+	if !ok {
+		// The upstream turn keeps the first caller's context values (stderr
+		// capture, conversation) but not its cancellation or deadline.
+		runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+		f = &flight{cancel: cancel}
+		f.cond = sync.NewCond(&f.mu)
+		c.flights[key] = f
+		go c.run(runCtx, key, f, run)
+	}
+	f.mu.Lock()
+	f.refs++
+	f.mu.Unlock()
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.refs--
+		if f.refs == 0 && !f.done {
+			// The flight is dying: an identical request from now on starts
+			// a new one rather than joining it while the CLI winds down.
+			f.cancel()
+			c.forget(key, f)
+		}
+	}()
+	stop := context.AfterFunc(ctx, func() {
+		f.mu.Lock()
+		f.cond.Broadcast()
+		f.mu.Unlock()
+	})
+	defer stop()
+
+	next := 0
+	for {
+		f.mu.Lock()
+		for next == len(f.events) && !f.done && ctx.Err() == nil {
+			f.cond.Wait()
+		}
+		if err := ctx.Err(); err != nil {
+			f.mu.Unlock()
+			return nil, err
+		}
+		pending := f.events[next:]
+		next = len(f.events)
+		done, res, err := f.done, f.res, f.err
+		f.mu.Unlock()
+
+		if onEvent != nil {
+			for _, ev := range pending {
+				if err := onEvent(ev); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if done {
+			return res, err
+		}
+	}
+}
+
+func (c *Coalescer) run(ctx context.Context, key string, f *flight, run func(context.Context, func(ResponseEvent) error) (any, error)) {
+	defer f.cancel()
+	res, err := run(ctx, func(ev ResponseEvent) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.events = append(f.events, ev)
+		f.cond.Broadcast()
+		return ctx.Err()
+	})
+	c.mu.Lock()
+	c.forget(key, f)
+	c.mu.Unlock()
+	f.mu.Lock()
+	f.done, f.res, f.err = true, res, err
+	f.cond.Broadcast()
+	f.mu.Unlock()
+}
+
+// forget removes f from the flights unless a newer flight took key. Called
+// with c.mu held.
+func (c *Coalescer) forget(key string, f *flight) {
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+}
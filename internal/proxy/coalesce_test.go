@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingAdapter streams "a", "b", "c" with a pause before each delta.
+type countingAdapter struct {
+	raceTestAdapter
+	calls atomic.Int32
+}
+
+func (a *countingAdapter) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (ChatResponse, error) {
+	a.calls.Add(1)
+	for _, d := range []string{"a", "b", "c"} {
+		select {
+		case <-time.After(20 * time.Millisecond):
+		case <-ctx.Done():
+			return ChatResponse{}, ctx.Err()
+		}
+		if err := onDelta(d); err != nil {
+			return ChatResponse{}, err
+		}
+	}
+	return ChatResponse{Model: req.Model, Text: "abc"}, nil
+}
+
+func TestCoalescerSharesOneTurnBetweenIdenticalStreams(t *testing.T) {
+	upstream := &countingAdapter{}
+	c := NewCoalescer()
+	req := ChatRequest{Model: "sonnet", Messages: []Message{{Role: "user", Content: "hi"}}}
+
+	var wg sync.WaitGroup
+	outs := make([]string, 3)
+	for i := range outs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i > 0 {
+				// Join mid-stream; the missed deltas are replayed.
+				time.Sleep(30 * time.Millisecond)
+			}
+			var b strings.Builder
+			resp, err := c.Wrap(upstream).ChatStream(context.Background(), req, func(d string) error {
+				b.WriteString(d)
+				return nil
+			})
+			if err != nil || resp.Text != "abc" {
+				t.Errorf("caller %d: %q, %v", i, resp.Text, err)
+			}
+			outs[i] = b.String()
+		}()
+	}
+	wg.Wait()
+	for i, out := range outs {
+		if out != "abc" {
+			t.Fatalf("caller %d streamed %q", i, out)
+		}
+	}
+	if n := upstream.calls.Load(); n != 1 {
+		t.Fatalf("expected one upstream turn, got %d", n)
+	}
+
+	other := req
+	other.Messages = []Message{{Role: "user", Content: "bye"}}
+	if _, err := c.Wrap(upstream).ChatStream(context.Background(), other, func(string) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if n := upstream.calls.Load(); n != 2 {
+		t.Fatalf("expected a different prompt to run its own turn, got %d turns", n)
+	}
+}
+
+func TestCoalescerCancelsUpstreamWhenEveryCallerLeaves(t *testing.T) {
+	upstream := &raceTestAdapter{delay: time.Minute, cancelled: make(chan struct{})}
+	c := NewCoalescer()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := c.Wrap(upstream).ChatStream(ctx, ChatRequest{}, func(string) error { return nil }); err == nil {
+		t.Fatal("expected cancellation error")
+	}
+	select {
+	case <-upstream.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream turn was not cancelled")
+	}
+}
+
+func TestCoalescerKeepsCallersAndSafetyPresetsApart(t *testing.T) {
+	upstream := &countingAdapter{}
+	c := NewCoalescer()
+	req := ChatRequest{Model: "sonnet", Messages: []Message{{Role: "user", Content: "hi"}}}
+	ctxs := []context.Context{
+		WithCaller(context.Background(), "ci"),
+		WithCaller(context.Background(), "ide"),
+		WithSafety(WithCaller(context.Background(), "ci"), SafetyFull),
+	}
+
+	var wg sync.WaitGroup
+	for _, ctx := range ctxs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Wrap(upstream).ChatStream(ctx, req, func(string) error { return nil }); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := upstream.calls.Load(); n != int32(len(ctxs)) {
+		t.Fatalf("expected a turn per caller and preset, got %d", n)
+	}
+}
+
+func TestCoalescerFlightOutlivesItsLeaderUntilItsTimeout(t *testing.T) {
+	upstream := &countingAdapter{}
+	c := NewCoalescer()
+	req := ChatRequest{Model: "sonnet", Messages: []Message{{Role: "user", Content: "hi"}}}
+
+	// The first caller's deadline ends its wait, not the turn the second
+	// caller shares.
+	leader, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		_, err := c.Wrap(upstream).ChatStream(leader, req, func(string) error { return nil })
+		done <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	resp, err := c.Wrap(upstream).ChatStream(context.Background(), req, func(string) error { return nil })
+	if err != nil || resp.Text != "abc" {
+		t.Fatalf("follower got %q, %v after the leader's deadline", resp.Text, err)
+	}
+	if err := <-done; err != context.DeadlineExceeded {
+		t.Fatalf("leader got %v, want its own deadline", err)
+	}
+
+	// A turn that runs past the flight timeout ends for everyone.
+	c.timeout = 30 * time.Millisecond
+	req.Messages[0].Content = "again"
+	if _, err := c.Wrap(upstream).ChatStream(context.Background(), req, func(string) error { return nil }); err != context.DeadlineExceeded {
+		t.Fatalf("turn past the flight timeout ended with %v", err)
+	}
+}
+
+// lingeringAdapter is a countingAdapter whose turn takes a while to wind
+// down once cancelled, like a CLI being killed.
+type lingeringAdapter struct {
+	countingAdapter
+}
+
+func (a *lingeringAdapter) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (ChatResponse, error) {
+	resp, err := a.countingAdapter.ChatStream(ctx, req, onDelta)
+	if ctx.Err() != nil {
+		time.Sleep(200 * time.Millisecond)
+	}
+	return resp, err
+}
+
+func TestCoalescerRetryAfterCancelStartsANewTurn(t *testing.T) {
+	upstream := &lingeringAdapter{}
+	c := NewCoalescer()
+	req := ChatRequest{Model: "sonnet", Messages: []Message{{Role: "user", Content: "hi"}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Wrap(upstream).ChatStream(ctx, req, func(string) error { return nil }); err == nil {
+		t.Fatal("expected the first caller to give up")
+	}
+	// The retry comes while the abandoned turn is still winding down.
+	resp, err := c.Wrap(upstream).ChatStream(context.Background(), req, func(string) error { return nil })
+	if err != nil || resp.Text != "abc" {
+		t.Fatalf("retry got %q, %v", resp.Text, err)
+	}
+	if n := upstream.calls.Load(); n != 2 {
+		t.Fatalf("expected the retry to run its own turn, got %d turns", n)
+	}
+}
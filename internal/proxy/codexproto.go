@@ -0,0 +1,268 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// codexProtocol is the generation of the app-server API a Codex CLI speaks.
+// v2 has threads and turns (thread/start, turn/start, item/* notifications).
+// Releases before codexThreadsVersion only have v1 conversations
+// (newConversation, sendUserMessage, codex/event/* notifications), which the
+// client translates to v2's shapes as they arrive, so turns are handled the
+// same way for both.
+type codexProtocol int
+
+const (
+	codexProtocolV2 codexProtocol = iota
+	codexProtocolV1
+)
+
+// codexThreadsVersion is the first Codex release with the v2 API.
+var codexThreadsVersion = cliVersion{0, 46, 0}
+
+func codexProtocolFor(v cliVersion) codexProtocol {
+	if v.less(codexThreadsVersion) {
+		return codexProtocolV1
+	}
+	return codexProtocolV2
+}
+
+// rpcMethodNotFound is JSON-RPC's error code for an unknown method.
+const rpcMethodNotFound = -32601
+
+// codexRPCError is an error reply from the app-server. Info is the kind
+// named by the codexErrorInfo in its data, when it has one.
+type codexRPCError struct {
+	Method  string
+	Code    int
+	Message string
+	Info    string
+}
+
+func (e *codexRPCError) Error() string {
+	return fmt.Sprintf("codex RPC error on %s: (%d) %s", e.Method, e.Code, e.Message)
+}
+
+// codexErrorKind returns the kind a codexErrorInfo names: it is either a
+// bare string ("usageLimitExceeded") or an object keyed by the kind
+// ({"httpConnectionFailed": {"httpStatusCode": 502}}).
+func codexErrorKind(info json.RawMessage) string {
+	var kind string
+	if json.Unmarshal(info, &kind) == nil {
+		return kind
+	}
+	var keyed map[string]json.RawMessage
+	if json.Unmarshal(info, &keyed) == nil && len(keyed) == 1 {
+		for kind := range keyed {
+			return kind
+		}
+	}
+	return ""
+}
+
+func isMethodNotFound(err error) bool {
+	var rpcErr *codexRPCError
+	return errors.As(err, &rpcErr) && rpcErr.Code == rpcMethodNotFound
+}
+
+// negotiate picks the protocol from the initialize reply, whose userAgent
+// carries the server's version (e.g. "codex_cli_rs/0.58.0 (Linux; x86_64)").
+// Servers that do not say keep v2 until thread/start proves them older.
+func (c *codexRPCClient) negotiate(userAgent string) {
+	if _, rest, ok := strings.Cut(userAgent, "/"); ok {
+		if v, ok := parseCLIVersion(rest); ok {
+			c.setProtocol(codexProtocolFor(v))
+		}
+	}
+}
+
+func (c *codexRPCClient) setProtocol(p codexProtocol) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.protocol = p
+}
+
+func (c *codexRPCClient) currentProtocol() codexProtocol {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.protocol
+}
+
+// errThreadNotResumed reports a thread the app-server could not resume, so
+// the turn has to start over on a new one.
+var errThreadNotResumed = errors.New("codex thread could not be resumed")
+
+// startThread starts the thread (v1: conversation) a turn runs on and
+// returns its ID, or resumes opts.resume. A server that does not know
+// thread/start is switched to v1.
+func (c *codexRPCClient) startThread(model string, opts CodexTurnOptions) (string, error) {
+	if opts.resume != "" {
+		return c.resumeThread(model, opts)
+	}
+	if c.currentProtocol() == codexProtocolV2 {
+		var resp struct {
+			Thread struct {
+				ID string `json:"id"`
+			} `json:"thread"`
+		}
+		err := c.call("thread/start", codexThreadParams(model, opts), &resp, nil)
+		if !isMethodNotFound(err) {
+			if err == nil && resp.Thread.ID == "" {
+				err = errors.New("codex returned empty thread id")
+			}
+			return resp.Thread.ID, err
+		}
+		c.setProtocol(codexProtocolV1)
+	}
+	var resp struct {
+		ConversationID string `json:"conversationId"`
+	}
+	if err := c.call("newConversation", codexConversationParams(model, opts), &resp, nil); err != nil {
+		return "", err
+	}
+	if resp.ConversationID == "" {
+		return "", errors.New("codex returned empty conversation id")
+	}
+	err := c.call("addConversationListener", map[string]any{"conversationId": resp.ConversationID}, nil, nil)
+	return resp.ConversationID, err
+}
+
+// resumeThread loads the saved thread opts.resume so the turn continues it.
+// v1 servers cannot.
+func (c *codexRPCClient) resumeThread(model string, opts CodexTurnOptions) (string, error) {
+	if c.currentProtocol() == codexProtocolV1 {
+		return "", errThreadNotResumed
+	}
+	params := codexThreadParams(model, opts)
+	delete(params, "ephemeral")
+	params["threadId"] = opts.resume
+	var resp struct {
+		Thread struct {
+			ID string `json:"id"`
+		} `json:"thread"`
+	}
+	if err := c.call("thread/resume", params, &resp, nil); err != nil {
+		return "", fmt.Errorf("%w: %v", errThreadNotResumed, err)
+	}
+	if resp.Thread.ID == "" {
+		return opts.resume, nil
+	}
+	return resp.Thread.ID, nil
+}
+
+// startTurn sends the prompt on threadID and returns the turn's ID (v1 has
+// none). Notifications arriving on msgs, the thread's inbox, before the
+// reply go to notify.
+func (c *codexRPCClient) startTurn(threadID string, msgs <-chan codexRPCMessage, model string, opts CodexTurnOptions, prompt string, notify func(codexRPCMessage)) (string, error) {
+	if c.currentProtocol() == codexProtocolV1 {
+		params := map[string]any{
+			"conversationId": threadID,
+			"items":          []map[string]any{{"type": "text", "data": map[string]any{"text": prompt}}},
+		}
+		return "", c.callOn(msgs, "sendUserMessage", params, nil, notify)
+	}
+	var resp struct {
+		Turn struct {
+			ID string `json:"id"`
+		} `json:"turn"`
+	}
+	params := map[string]any{
+		"threadId": threadID,
+		"model":    model,
+		"input":    []map[string]any{{"type": "text", "text": prompt}},
+	}
+	if opts.Effort != "" {
+		params["effort"] = opts.Effort
+	}
+	err := c.callOn(msgs, "turn/start", params, &resp, notify)
+	return resp.Turn.ID, err
+}
+
+// interruptRequest is the request that stops the running turn on threadID.
+func (c *codexRPCClient) interruptRequest(threadID, turnID string) (string, map[string]any) {
+	if c.currentProtocol() == codexProtocolV1 {
+		return "interruptConversation", map[string]any{"conversationId": threadID}
+	}
+	params := map[string]any{"threadId": threadID}
+	if turnID != "" {
+		params["turnId"] = turnID
+	}
+	return "turn/interrupt", params
+}
+
+// codexConversationParams are codexThreadParams for v1's newConversation,
+// which takes the reasoning effort as config rather than per turn.
+func codexConversationParams(model string, opts CodexTurnOptions) map[string]any {
+	params := codexThreadParams(model, opts)
+	delete(params, "ephemeral")
+	if opts.Effort != "" {
+		config, _ := params["config"].(map[string]any)
+		if config == nil {
+			config = map[string]any{}
+		}
+		config["model_reasoning_effort"] = opts.Effort
+		params["config"] = config
+	}
+	return params
+}
+
+// translateV1 turns a v1 codex/event/* notification into the v2
+// notifications the turn loop handles. Other messages pass unchanged.
+func translateV1(msg codexRPCMessage) []codexRPCMessage {
+	event, ok := strings.CutPrefix(msg.Method, "codex/event/")
+	if !ok {
+		return []codexRPCMessage{msg}
+	}
+	var params struct {
+		ConversationID string `json:"conversationId"`
+		Msg            struct {
+			Delta            string          `json:"delta"`
+			Message          string          `json:"message"`
+			LastAgentMessage string          `json:"last_agent_message"`
+			CallID           string          `json:"call_id"`
+			Command          []string        `json:"command"`
+			Cwd              string          `json:"cwd"`
+			CodexErrorInfo   json.RawMessage `json:"codex_error_info"`
+		} `json:"msg"`
+	}
+	if json.Unmarshal(msg.Params, &params) != nil {
+		return []codexRPCMessage{msg}
+	}
+	m := params.Msg
+	note := func(method string, fields map[string]any) codexRPCMessage {
+		fields["threadId"] = params.ConversationID
+		raw, _ := json.Marshal(fields)
+		return codexRPCMessage{Method: method, Params: raw}
+	}
+	switch event {
+	case "agent_message_delta":
+		return []codexRPCMessage{note("item/agentMessage/delta", map[string]any{"delta": m.Delta})}
+	case "agent_reasoning_delta":
+		return []codexRPCMessage{note("item/reasoning/summaryTextDelta", map[string]any{"delta": m.Delta})}
+	case "agent_message":
+		return []codexRPCMessage{note("item/completed", map[string]any{"item": map[string]any{"type": "agentMessage"}})}
+	case "exec_command_begin":
+		item := map[string]any{"type": "commandExecution", "id": m.CallID, "command": strings.Join(m.Command, " "), "cwd": m.Cwd}
+		return []codexRPCMessage{note("item/started", map[string]any{"item": item})}
+	case "task_complete":
+		return []codexRPCMessage{
+			note(msg.Method, map[string]any{"msg": map[string]any{"last_agent_message": m.LastAgentMessage}}),
+			note("turn/completed", map[string]any{"turn": map[string]any{"status": "completed"}}),
+		}
+	case "stream_error":
+		return []codexRPCMessage{note("error", map[string]any{"error": map[string]any{"message": m.Message}, "willRetry": true})}
+	case "error":
+		turnErr := map[string]any{"message": m.Message}
+		if len(m.CodexErrorInfo) > 0 {
+			turnErr["codexErrorInfo"] = m.CodexErrorInfo
+		}
+		turn := map[string]any{"status": "failed", "error": turnErr}
+		return []codexRPCMessage{note("turn/completed", map[string]any{"turn": turn})}
+	case "turn_aborted":
+		return []codexRPCMessage{note("turn/completed", map[string]any{"turn": map[string]any{"status": "interrupted"}})}
+	}
+	return []codexRPCMessage{msg}
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func codexV1Event(event string, msg map[string]any) map[string]any {
+	msg["type"] = event
+	return codexNotification("codex/event/"+event, map[string]any{"conversationId": "conv-1", "msg": msg})
+}
+
+var codexV1Script = []map[string]any{
+	codexV1Event("agent_reasoning_delta", map[string]any{"delta": "thinking"}),
+	codexV1Event("exec_command_begin", map[string]any{"call_id": "c1", "command": []string{"ls", "-la"}, "cwd": "/tmp"}),
+	codexV1Event("agent_message_delta", map[string]any{"delta": "Hello"}),
+	codexV1Event("agent_message_delta", map[string]any{"delta": " world"}),
+	codexV1Event("agent_message", map[string]any{"message": "Hello world"}),
+	codexV1Event("task_complete", map[string]any{"last_agent_message": "Hello world"}),
+}
+
+func TestCodexFallsBackToV1WhenThreadsAreUnknown(t *testing.T) {
+	adapter := newFakeCodexAdapter(t, codexV1Script...)
+	t.Setenv("LLM_PROXY_FAKE_CODEX_V1", "1")
+
+	var tools []ToolCall
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := adapter.RespondStreamEvents(ctx, ResponsesRequest{Model: "gpt-5", Input: "hi", ReasoningEffort: "high"}, func(ev ResponseEvent) error {
+		if ev.Tool != nil {
+			tools = append(tools, *ev.Tool)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RespondStream: %v", err)
+	}
+	if resp.Text != "Hello world" || resp.Reasoning != "thinking" || resp.ThreadID != "conv-1" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if len(tools) != 1 || tools[0].Name != "shell" || tools[0].ID != "c1" {
+		t.Fatalf("unexpected tool calls: %+v", tools)
+	}
+	reqs := fakeCodexRequests(t)
+	if _, ok := reqs["thread/start"]; !ok {
+		t.Fatal("expected thread/start to be tried first")
+	}
+	conv := reqs["newConversation"]
+	config, _ := conv["config"].(map[string]any)
+	if conv["model"] != "gpt-5" || config["model_reasoning_effort"] != "high" {
+		t.Fatalf("unexpected newConversation params: %v", conv)
+	}
+	if reqs["sendUserMessage"]["conversationId"] != "conv-1" || reqs["addConversationListener"]["conversationId"] != "conv-1" {
+		t.Fatalf("unexpected v1 requests: %v", reqs)
+	}
+}
+
+func TestCodexPicksV1FromTheServerVersion(t *testing.T) {
+	adapter := newFakeCodexAdapter(t, codexV1Script...)
+	t.Setenv("LLM_PROXY_FAKE_CODEX_V1", "1")
+	t.Setenv("LLM_PROXY_FAKE_CODEX_USER_AGENT", "codex_cli_rs/0.40.0 (Linux 6.1; x86_64) xterm")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := adapter.Respond(ctx, ResponsesRequest{Model: "gpt-5", Input: "hi"})
+	if err != nil || resp.Text != "Hello world" {
+		t.Fatalf("Respond = %+v, %v", resp, err)
+	}
+	if _, ok := fakeCodexRequests(t)["thread/start"]; ok {
+		t.Fatal("expected a 0.40 server to be spoken to in v1 straight away")
+	}
+}
+
+func TestCodexV1ErrorsFailTheTurn(t *testing.T) {
+	adapter := newFakeCodexAdapter(t, codexV1Event("error", map[string]any{"message": "model overloaded"}))
+	t.Setenv("LLM_PROXY_FAKE_CODEX_V1", "1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := adapter.Respond(ctx, ResponsesRequest{Model: "gpt-5", Input: "hi"})
+	if err == nil || err.Error() != "codex turn failed: model overloaded" {
+		t.Fatalf("expected the v1 error to fail the turn, got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// cliVersion is a CLI's major.minor.patch version.
+type cliVersion [3]int
+
+var cliVersionRe = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+
+// parseCLIVersion finds the first x.y.z in a CLI's --version output, e.g.
+// "1.0.98 (Claude Code)" or "codex-cli 0.58.0".
+func parseCLIVersion(out string) (cliVersion, bool) {
+	m := cliVersionRe.FindStringSubmatch(out)
+	if m == nil {
+		return cliVersion{}, false
+	}
+	var v cliVersion
+	for i := range v {
+		v[i], _ = strconv.Atoi(m[i+1])
+	}
+	return v, true
+}
+
+func (v cliVersion) less(o cliVersion) bool {
+	return slices.Compare(v[:], o[:]) < 0
+}
+
+func (v cliVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// The oldest CLI releases the adapters are written against. Claude before
+// claudePartialMessagesVersion has no --include-partial-messages, so its
+// streams are read a message at a time rather than failing; Codex before
+// minCodexVersion has no app-server, and before codexThreadsVersion is
+// spoken to in the v1 protocol.
+var (
+	minClaudeVersion             = cliVersion{1, 0, 0}
+	claudePartialMessagesVersion = cliVersion{1, 0, 86}
+	minCodexVersion              = cliVersion{0, 39, 0}
+)
+
+var binSearchDirs atomic.Pointer[[]string]
+
+// SetBinSearchDirs adds directories searched for the CLIs, before the usual
+// install locations, when a binary is not found on PATH.
+func SetBinSearchDirs(dirs []string) {
+	dirs = slices.Clone(dirs)
+	binSearchDirs.Store(&dirs)
+}
+
+// installDirs are where the CLIs' installers put them, in case the proxy
+// runs with a PATH that lacks them (services, containers, GUI launchers).
+func installDirs() []string {
+	var dirs []string
+	if p := binSearchDirs.Load(); p != nil {
+		dirs = append(dirs, *p...)
+	}
+	home := UserHome()
+	if runtime.GOOS == "windows" {
+		if home != "" {
+			dirs = append(dirs, filepath.Join(home, ".local", "bin"))
+		}
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			dirs = append(dirs, filepath.Join(appData, "npm"))
+		}
+		return dirs
+	}
+	if home != "" {
+		dirs = append(dirs,
+			filepath.Join(home, ".local", "bin"),
+			filepath.Join(home, ".claude", "local"),
+			filepath.Join(home, ".npm-global", "bin"),
+			filepath.Join(home, ".bun", "bin"),
+		)
+	}
+	return append(dirs, "/opt/homebrew/bin", "/usr/local/bin")
+}
+
+// resolveBin finds bin on PATH, then in the install directories. A bin
+// that names a path, or is found nowhere, is returned unchanged so exec
+// reports it.
+func resolveBin(bin string) string {
+	if path, err := exec.LookPath(bin); err == nil {
+		return path
+	}
+	if filepath.Base(bin) != bin {
+		return bin
+	}
+	for _, dir := range installDirs() {
+		// LookPath checks the file is executable and, on Windows, tries the
+		// PATHEXT extensions (.exe, .cmd).
+		if path, err := exec.LookPath(filepath.Join(dir, bin)); err == nil {
+			return path
+		}
+	}
+	return bin
+}
+
+// BinaryInfo is what discovery found out about a backend's CLI.
+type BinaryInfo struct {
+	Backend Backend
+	Path    string
+	Version string
+	// Err is set when the CLI was not found or `--version` failed.
+	Err error
+	// Warning is set when the CLI runs but is older than supported.
+	Warning string
+}
+
+// BinaryInspector is implemented by adapters that run a CLI.
+type BinaryInspector interface {
+	InspectBinary(context.Context) BinaryInfo
+}
+
+// InspectBinaries locates each backend's CLI and checks its version, so an
+// old or missing CLI is reported at startup rather than mid-request. The
+// adapters adapt to the versions found.
+func (r *Router) InspectBinaries(ctx context.Context) []BinaryInfo {
+	claude, codex := r.adapters()
+	var out []BinaryInfo
+	for _, adapter := range []Adapter{claude, codex} {
+		if b, ok := adapter.(BinaryInspector); ok {
+			out = append(out, b.InspectBinary(ctx))
+		}
+	}
+	return out
+}
+
+func (a *ClaudeAdapter) InspectBinary(ctx context.Context) BinaryInfo {
+	info := inspectBinary(ctx, BackendClaude, a.bin, a.opts.Env, minClaudeVersion)
+	if v, ok := parseCLIVersion(info.Version); ok {
+		a.version.Store(&v)
+		if info.Warning == "" && v.less(claudePartialMessagesVersion) {
+			info.Warning = fmt.Sprintf("claude %s is older than %s: streams arrive a message at a time instead of per token", v, claudePartialMessagesVersion)
+		}
+	}
+	return info
+}
+
+func (a *CodexAdapter) InspectBinary(ctx context.Context) BinaryInfo {
+	info := inspectBinary(ctx, BackendCodex, a.bin, a.opts.Env, minCodexVersion)
+	if v, ok := parseCLIVersion(info.Version); ok {
+		a.version.Store(&v)
+		if info.Warning == "" && codexProtocolFor(v) == codexProtocolV1 {
+			info.Warning = fmt.Sprintf("codex %s predates the thread API (%s): using the older conversation API, which reports fewer tool calls", v, codexThreadsVersion)
+		}
+	}
+	return info
+}
+
+func inspectBinary(ctx context.Context, backend Backend, bin string, env []string, minVersion cliVersion) BinaryInfo {
+	info := BinaryInfo{Backend: backend, Path: resolveBin(bin)}
+	out, err := runVersion(ctx, bin, env)
+	if err != nil {
+		info.Err = err
+		return info
+	}
+	info.Version = out
+	v, ok := parseCLIVersion(out)
+	switch {
+	case !ok:
+		info.Warning = fmt.Sprintf("could not read a version from %q", out)
+	case v.less(minVersion):
+		info.Warning = fmt.Sprintf("%s %s is older than the oldest supported release, %s; upgrade it", backend, v, minVersion)
+	}
+	return info
+}
+
+// runVersion returns the trimmed output of `bin --version`.
+func runVersion(ctx context.Context, bin string, env []string) (string, error) {
+	cmd := newCommand(ctx, bin, "--version")
+	cmd.Env = commandEnv(env)
+	out, err := cmd.CombinedOutput()
+	text := strings.TrimSpace(string(out))
+	if err != nil {
+		return "", fmt.Errorf("%s --version: %w: %s", bin, err, text)
+	}
+	return text, nil
+}
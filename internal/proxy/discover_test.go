@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseCLIVersion(t *testing.T) {
+	for out, want := range map[string]cliVersion{
+		"1.0.98 (Claude Code)": {1, 0, 98},
+		"codex-cli 0.58.0":     {0, 58, 0},
+		"2.1.3-beta.1":         {2, 1, 3},
+	} {
+		if got, ok := parseCLIVersion(out); !ok || got != want {
+			t.Errorf("parseCLIVersion(%q) = %v, %v; want %v", out, got, ok, want)
+		}
+	}
+	if _, ok := parseCLIVersion("unknown"); ok {
+		t.Error("expected no version in output without one")
+	}
+}
+
+func TestResolveBinSearchesInstallDirs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the binary")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "llm-proxy-test-cli")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := resolveBin("llm-proxy-test-cli"); got != "llm-proxy-test-cli" {
+		t.Fatalf("expected an unknown binary to be left alone, got %q", got)
+	}
+	SetBinSearchDirs([]string{dir})
+	defer SetBinSearchDirs(nil)
+	if got := resolveBin("llm-proxy-test-cli"); got != bin {
+		t.Fatalf("resolveBin = %q, want %q", got, bin)
+	}
+}
+
+func TestClaudeInspectBinaryAdaptsToOldVersions(t *testing.T) {
+	adapter := newFakeClaudeAdapter(t, "1.0.50 (Claude Code)")
+	if !slices.Contains(adapter.streamArgs(), "--include-partial-messages") {
+		t.Fatal("expected partial messages to be asked for before the version is known")
+	}
+	info := adapter.InspectBinary(context.Background())
+	if info.Err != nil || info.Version != "1.0.50 (Claude Code)" || !strings.Contains(info.Warning, "message at a time") {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	if slices.Contains(adapter.streamArgs(), "--include-partial-messages") {
+		t.Fatal("expected --include-partial-messages to be dropped for an old CLI")
+	}
+
+	adapter = newFakeClaudeAdapter(t, "0.2.9 (Claude Code)")
+	if info := adapter.InspectBinary(context.Background()); !strings.Contains(info.Warning, "upgrade") {
+		t.Fatalf("expected an upgrade warning, got %+v", info)
+	}
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"llm-proxy/internal/logfile"
+)
+
+var (
+	upstreamDumpDir    atomic.Pointer[string]
+	upstreamDumpSeq    atomic.Uint64
+	upstreamDumpLimits atomic.Pointer[logfile.Limits]
+)
+
+// defaultUpstreamDumpLimits keep a forgotten --debug-upstream from filling
+// the disk.
+var defaultUpstreamDumpLimits = logfile.Limits{
+	MaxAge:       7 * 24 * time.Hour,
+	MaxFiles:     1000,
+	MaxTotalSize: 1 << 30,
+}
+
+// SetUpstreamDumpDir makes every CLI process write its raw traffic (stdin,
+// the stream-json or JSON-RPC lines on stdout, and how it exited) to its own
+// file in dir, for ReplayDump. An empty dir turns dumping off.
+func SetUpstreamDumpDir(dir string) {
+	upstreamDumpDir.Store(&dir)
+}
+
+// SetUpstreamDumpLimits caps the dump directory; older dumps are deleted
+// as new ones are written. Zero fields keep the defaults.
+func SetUpstreamDumpLimits(limits logfile.Limits) {
+	if limits.MaxAge <= 0 {
+		limits.MaxAge = defaultUpstreamDumpLimits.MaxAge
+	}
+	if limits.MaxFiles <= 0 {
+		limits.MaxFiles = defaultUpstreamDumpLimits.MaxFiles
+	}
+	if limits.MaxTotalSize <= 0 {
+		limits.MaxTotalSize = defaultUpstreamDumpLimits.MaxTotalSize
+	}
+	upstreamDumpLimits.Store(&limits)
+}
+
+// dumpHeader is the first line of a dump file.
+type dumpHeader struct {
+	Backend Backend   `json:"backend"`
+	Args    []string  `json:"args"`
+	Time    time.Time `json:"time"`
+}
+
+// dumpRecord is one line of CLI traffic, or the final Exit record.
+type dumpRecord struct {
+	Stream string `json:"stream,omitempty"`
+	Line   string `json:"line,omitempty"`
+	Exit   string `json:"exit,omitempty"`
+}
+
+// upstreamDump writes one CLI process's traffic. A nil dump discards
+// everything, so call sites need no checks.
+type upstreamDump struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func openUpstreamDump(backend Backend, args []string) *upstreamDump {
+	dir := upstreamDumpDir.Load()
+	if dir == nil || *dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(*dir, 0o700); err != nil {
+		log.Printf("upstream dump: %v", err)
+		return nil
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s-%06d.jsonl", now.Format("20060102T150405.000"), backend, upstreamDumpSeq.Add(1))
+	f, err := os.OpenFile(filepath.Join(*dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Printf("upstream dump: %v", err)
+		return nil
+	}
+	limits := defaultUpstreamDumpLimits
+	if l := upstreamDumpLimits.Load(); l != nil {
+		limits = *l
+	}
+	if err := logfile.PruneDir(*dir, isUpstreamDump, limits); err != nil {
+		log.Printf("upstream dump: %v", err)
+	}
+	d := &upstreamDump{f: f, enc: json.NewEncoder(f)}
+	_ = d.enc.Encode(dumpHeader{Backend: backend, Args: args, Time: now})
+	return d
+}
+
+func isUpstreamDump(name string) bool {
+	return strings.HasSuffix(name, ".jsonl") &&
+		(strings.Contains(name, "-"+string(BackendClaude)+"-") || strings.Contains(name, "-"+string(BackendCodex)+"-"))
+}
+
+func (d *upstreamDump) record(stream, line string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.f != nil {
+		_ = d.enc.Encode(dumpRecord{Stream: stream, Line: line})
+	}
+}
+
+// exit records how the process ended and closes the dump.
+func (d *upstreamDump) exit(err error) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.f == nil {
+		return
+	}
+	if err != nil {
+		_ = d.enc.Encode(dumpRecord{Exit: err.Error()})
+	}
+	_ = d.f.Close()
+	d.f = nil
+}
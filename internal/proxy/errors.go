@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrorClass groups backend failures by how a client should react to them.
+type ErrorClass string
+
+const (
+	ErrorUnknown       ErrorClass = ""
+	ErrorAuth          ErrorClass = "auth"
+	ErrorRateLimit     ErrorClass = "rate_limit"
+	ErrorModelNotFound ErrorClass = "model_not_found"
+	ErrorTimeout       ErrorClass = "timeout"
+	ErrorCrash         ErrorClass = "crash"
+	ErrorUnavailable   ErrorClass = "unavailable"
+	ErrorPermission    ErrorClass = "permission"
+	// ErrorResourceLimit is a CLI that ran out of memory, CPU time or file
+	// descriptors, typically under SetProcessLimits.
+	ErrorResourceLimit ErrorClass = "resource_limit"
+	// ErrorNetwork is a CLI that could not reach its API: no route, DNS,
+	// a refused or reset connection, a proxy or an untrusted certificate.
+	ErrorNetwork ErrorClass = "network"
+	// ErrorOutputTooLarge is a CLI that printed a line of output longer
+	// than the proxy reads; see ErrLineTooLong.
+	ErrorOutputTooLarge ErrorClass = "output_too_large"
+)
+
+// UpstreamError is a failure the CLI reported as its answer rather than as
+// crash output: a failed result or error event in claude's stream-json, or
+// an error notification from the Codex app-server. Type is the
+// machine-readable kind it came with, when it had one.
+type UpstreamError struct {
+	Type    string
+	Message string
+	// Err is the failure it explains, such as the CLI's exit status.
+	Err error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%v: %s", e.Err, e.Message)
+}
+
+func (e *UpstreamError) Unwrap() error { return e.Err }
+
+// errorTypes classes the error kinds the CLIs report in their structured
+// output: the Anthropic API's error type and the error of an assistant
+// message in claude's stream-json, and a Codex error's codexErrorInfo
+// (camelCase from v2 app-servers, snake_case from v1). Codex's JSON-RPC
+// error codes are the generic ones, invalid request or internal error, so
+// they class nothing.
+var errorTypes = map[string]ErrorClass{
+	"rate_limit_error":      ErrorRateLimit,
+	"rate_limit":            ErrorRateLimit,
+	"usageLimitExceeded":    ErrorRateLimit,
+	"usage_limit_exceeded":  ErrorRateLimit,
+	"authentication_error":  ErrorAuth,
+	"authentication_failed": ErrorAuth,
+	"permission_error":      ErrorAuth,
+	"unauthorized":          ErrorAuth,
+	"not_found_error":       ErrorModelNotFound,
+
+	"httpConnectionFailed":              ErrorNetwork,
+	"http_connection_failed":            ErrorNetwork,
+	"responseStreamConnectionFailed":    ErrorNetwork,
+	"response_stream_connection_failed": ErrorNetwork,
+}
+
+// reportedErrorType returns the error kind the CLI reported err with, or ""
+// for a failure it reported as text only.
+func reportedErrorType(err error) string {
+	var upstream *UpstreamError
+	if errors.As(err, &upstream) && upstream.Type != "" {
+		return upstream.Type
+	}
+	var rpcErr *codexRPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Info
+	}
+	return ""
+}
+
+// Failures without an error kind errorTypes knows are told apart by the
+// phrases the CLIs print. Lists are checked in errorPhrases order. A list
+// marked tail only looks at the last stderrTailLines lines of stderr, where
+// a CLI prints the error it gave up on: earlier lines can be a tool's or an
+// MCP server's, and a connection one of those failed to make says nothing
+// about whether the CLI can reach its API.
+var errorPhrases = []struct {
+	class   ErrorClass
+	phrases []string
+	tail    bool
+}{
+	{ErrorRateLimit, []string{"rate limit", "rate_limit", "usage limit", "usage_limit", "limit reached", "too many requests", "quota exceeded"}, false},
+	{ErrorAuth, []string{"not logged in", "/login", "codex login", "invalid api key", "authentication_error", "authentication failed", "unauthorized", "token expired", "session expired", "auth mode is not", "refusing api-key mode"}, false},
+	{ErrorModelNotFound, []string{"unsupported model", "model not found", "model_not_found", "not_found_error", "unknown model", "invalid model"}, false},
+	{ErrorResourceLimit, []string{"cpu time limit exceeded", "out of memory", "allocation failed", "memory allocation of", "cannot allocate memory", "too many open files", "emfile"}, false},
+	{ErrorNetwork, []string{"econnrefused", "econnreset", "enotfound", "eai_again", "etimedout", "enetunreach", "getaddrinfo", "connection refused", "network is unreachable", "could not resolve host", "dns error", "error sending request", "tunneling socket", "proxyconnect", "self signed certificate", "self-signed certificate", "unable to get local issuer certificate", "certificate verify failed", "unable to verify the first certificate"}, true},
+	{ErrorTimeout, []string{"timed out", "timeout"}, false},
+}
+
+// ClassifyError sorts a backend failure into an ErrorClass: by the error
+// kind the CLI reported it with, when it did, and only otherwise by the
+// text of err and of the stderr the CLI printed while serving the request.
+func ClassifyError(err error, stderr string) ErrorClass {
+	if err == nil {
+		return ErrorUnknown
+	}
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		return ErrorRateLimit
+	}
+	var unavailable *BackendUnavailableError
+	if errors.As(err, &unavailable) {
+		return ErrorUnavailable
+	}
+	var permission *PermissionPromptError
+	if errors.As(err, &permission) {
+		return ErrorPermission
+	}
+	if errors.Is(err, errCPUTimeLimit) {
+		return ErrorResourceLimit
+	}
+	if errors.Is(err, ErrLineTooLong) {
+		return ErrorOutputTooLarge
+	}
+	if class, ok := errorTypes[reportedErrorType(err)]; ok {
+		return class
+	}
+	text := strings.ToLower(err.Error() + "\n" + stderr)
+	tail := strings.ToLower(err.Error() + "\n" + lastLines(stderr, stderrTailLines))
+	for _, p := range errorPhrases {
+		text := text
+		if p.tail {
+			text = tail
+		}
+		for _, phrase := range p.phrases {
+			if strings.Contains(text, phrase) {
+				return p.class
+			}
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTimeout
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) || strings.Contains(text, "app-server stream ended") {
+		return ErrorCrash
+	}
+	return ErrorUnknown
+}
+
+// stderrTailLines is how much of the end of stderr tail phrases are looked
+// for in.
+const stderrTailLines = 3
+
+// lastLines returns the last n non-blank lines of s.
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n\r\t "), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
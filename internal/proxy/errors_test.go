@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err    error
+		stderr string
+		want   ErrorClass
+	}{
+		{errors.New("claude command failed: exit status 1: Claude AI usage limit reached|1760000000"), "", ErrorRateLimit},
+		{errors.New("codex RPC error on turn/start: (-32000) You've hit your usage limit."), "", ErrorRateLimit},
+		{errors.New("claude command failed: exit status 1"), "Invalid API key · Please run /login", ErrorAuth},
+		{errors.New("codex auth mode is not ChatGPT subscription: api key"), "", ErrorAuth},
+		{errors.New("unsupported model id: codex/missing"), "", ErrorModelNotFound},
+		{fmt.Errorf("turn: %w", context.DeadlineExceeded), "", ErrorTimeout},
+		{errors.New("codex app-server stream ended: panic"), "", ErrorCrash},
+		{fmt.Errorf("turn: %w", &PermissionPromptError{Backend: BackendCodex, Tool: "shell (ls)", Detail: "declined"}), "", ErrorPermission},
+		{errors.New("claude command failed: signal: CPU time limit exceeded"), "", ErrorResourceLimit},
+		{errors.New("claude command failed: exit status 134"), "FATAL ERROR: Reached heap limit Allocation failed - JavaScript heap out of memory", ErrorResourceLimit},
+		{errors.New("codex app-server stream ended: memory allocation of 1048576 bytes failed"), "", ErrorResourceLimit},
+		{errors.New("claude command failed: exit status 1"), "API Error: Connection error. (cause: getaddrinfo ENOTFOUND api.anthropic.com)", ErrorNetwork},
+		{errors.New("claude command failed: exit status 1"), "tunneling socket could not be established, cause=connect ECONNREFUSED 10.0.0.1:3128", ErrorNetwork},
+		{errors.New("codex turn failed: stream error: error sending request for url (https://chatgpt.com/backend-api/codex/responses)"), "", ErrorNetwork},
+		{errors.New("claude command failed: exit status 1"), "[mcp:db] connect ECONNREFUSED 127.0.0.1:5432\nstep 1\nstep 2\nstep 3\nError: tool loop aborted", ErrorUnknown},
+		{fmt.Errorf("claude stream output: %w: exceeds 268435456 bytes", ErrLineTooLong), "", ErrorOutputTooLarge},
+		{errors.New("something odd"), "", ErrorUnknown},
+		// The kind the CLI reported wins over what the text mentions.
+		{&UpstreamError{Type: "authentication_error", Message: "OAuth token has expired; the rate limit page has details"}, "", ErrorAuth},
+		{&UpstreamError{Type: "not_found_error", Message: "model: claude-nope"}, "", ErrorModelNotFound},
+		{fmt.Errorf("turn: %w", &codexRPCError{Method: "turn/start", Code: -32603, Message: "stream disconnected before completion", Info: "responseStreamConnectionFailed"}), "", ErrorNetwork},
+		{&UpstreamError{Type: "invalid_request_error", Message: "prompt is too long"}, "timeout waiting for tool", ErrorTimeout},
+	}
+	for _, c := range cases {
+		if got := ClassifyError(c.err, c.stderr); got != c.want {
+			t.Errorf("ClassifyError(%q, %q) = %q, want %q", c.err, c.stderr, got, c.want)
+		}
+	}
+}
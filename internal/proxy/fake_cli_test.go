@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The test binary doubles as the backend CLIs. With LLM_PROXY_FAKE_CODEX set
+// it is a scripted `codex app-server`: LLM_PROXY_FAKE_CODEX_SCRIPT holds a JSON
+// array of notifications sent after the turn/start response, and every request
+// line is appended to LLM_PROXY_FAKE_CODEX_LOG when set; with
+// LLM_PROXY_FAKE_CODEX_V1 set it only speaks the v1 conversation API, and
+// LLM_PROXY_FAKE_CODEX_USER_AGENT is its initialize userAgent. With
+// LLM_PROXY_FAKE_CLAUDE set it is `claude -p`: it prints
+// LLM_PROXY_FAKE_CLAUDE_OUTPUT verbatim, then sleeps for
+// LLM_PROXY_FAKE_CLAUDE_HANG if set, and records its args and stdin to
+// LLM_PROXY_FAKE_CLAUDE_RECORD. With ReplayEnv set it replays a dump.
+func TestMain(m *testing.M) {
+	switch {
+	case os.Getenv(ReplayEnv) != "":
+		os.Exit(ServeReplay(os.Getenv(ReplayEnv), os.Stdin, os.Stdout, os.Stderr))
+	case os.Getenv("LLM_PROXY_FAKE_CODEX") == "1" && len(os.Args) == 2 && os.Args[1] == "--version":
+		fmt.Println("codex-cli 0.60.0")
+		os.Exit(0)
+	case os.Getenv("LLM_PROXY_FAKE_CODEX") == "1":
+		runFakeCodex()
+		os.Exit(0)
+	case os.Getenv("LLM_PROXY_FAKE_CLAUDE") == "1":
+		if path := os.Getenv("LLM_PROXY_FAKE_CLAUDE_RECORD"); path != "" {
+			stdin, _ := io.ReadAll(os.Stdin)
+			record, _ := json.Marshal(map[string]any{"args": os.Args[1:], "stdin": string(stdin)})
+			_ = os.WriteFile(path, record, 0o600)
+		}
+		fmt.Print(os.Getenv("LLM_PROXY_FAKE_CLAUDE_OUTPUT"))
+		if hang, err := time.ParseDuration(os.Getenv("LLM_PROXY_FAKE_CLAUDE_HANG")); err == nil {
+			time.Sleep(hang)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func runFakeCodex() {
+	var script []json.RawMessage
+	_ = json.Unmarshal([]byte(os.Getenv("LLM_PROXY_FAKE_CODEX_SCRIPT")), &script)
+
+	out := bufio.NewWriter(os.Stdout)
+	send := func(v any) {
+		line, _ := json.Marshal(v)
+		out.Write(line)
+		out.WriteByte('\n')
+		out.Flush()
+	}
+
+	var reqLog *os.File
+	if path := os.Getenv("LLM_PROXY_FAKE_CODEX_LOG"); path != "" {
+		reqLog, _ = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if reqLog != nil {
+			fmt.Fprintf(reqLog, "%s\n", scanner.Bytes())
+		}
+		var req struct {
+			ID     string `json:"id"`
+			Method string `json:"method"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &req) != nil {
+			continue
+		}
+		legacy := os.Getenv("LLM_PROXY_FAKE_CODEX_V1") == "1"
+		switch req.Method {
+		case "initialize":
+			send(map[string]any{"id": req.ID, "result": map[string]any{"userAgent": os.Getenv("LLM_PROXY_FAKE_CODEX_USER_AGENT")}})
+		case "thread/start", "turn/start", "turn/interrupt":
+			if legacy {
+				send(map[string]any{"id": req.ID, "error": map[string]any{"code": -32601, "message": "method not found"}})
+				continue
+			}
+		}
+		switch req.Method {
+		case "initialize":
+		case "newConversation":
+			send(map[string]any{"id": req.ID, "result": map[string]any{"conversationId": "conv-1"}})
+		case "sendUserMessage":
+			send(map[string]any{"id": req.ID, "result": map[string]any{}})
+			for _, n := range script {
+				fmt.Fprintf(out, "%s\n", n)
+				out.Flush()
+			}
+		case "interruptConversation":
+			send(map[string]any{"id": req.ID, "result": map[string]any{}})
+			send(map[string]any{"method": "codex/event/turn_aborted", "params": map[string]any{"conversationId": "conv-1", "msg": map[string]any{"type": "turn_aborted"}}})
+		case "model/list":
+			send(map[string]any{"id": req.ID, "result": map[string]any{"data": []map[string]any{{"id": "gpt-5"}}}})
+		case "thread/start":
+			send(map[string]any{"id": req.ID, "result": map[string]any{"thread": map[string]any{"id": "thread-1"}}})
+		case "turn/start":
+			send(map[string]any{"id": req.ID, "result": map[string]any{"turn": map[string]any{"id": "turn-1"}}})
+			for _, n := range script {
+				fmt.Fprintf(out, "%s\n", n)
+				out.Flush()
+				// Like codex, block on a server request until it is answered.
+				var call struct {
+					ID string `json:"id"`
+				}
+				if json.Unmarshal(n, &call) != nil || call.ID == "" {
+					continue
+				}
+				for scanner.Scan() {
+					if reqLog != nil {
+						fmt.Fprintf(reqLog, "%s\n", scanner.Bytes())
+					}
+					var reply struct {
+						ID string `json:"id"`
+					}
+					if json.Unmarshal(scanner.Bytes(), &reply) == nil && reply.ID == call.ID {
+						break
+					}
+				}
+			}
+		case "turn/interrupt":
+			send(map[string]any{"id": req.ID, "result": map[string]any{}})
+			send(map[string]any{"method": "turn/completed", "params": map[string]any{"turn": map[string]any{"id": "turn-1", "status": "interrupted"}}})
+		default:
+			send(map[string]any{"id": req.ID, "result": map[string]any{}})
+		}
+	}
+}
+
+// newFakeCodexAdapter returns a CodexAdapter backed by the scripted fake
+// app-server, with a ChatGPT login so the subscription check passes.
+func newFakeCodexAdapter(t *testing.T, script ...map[string]any) *CodexAdapter {
+	t.Helper()
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".codex"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".codex", "auth.json"), []byte(`{"auth_mode":"chatgpt"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("LLM_PROXY_FAKE_CODEX", "1")
+	t.Setenv("LLM_PROXY_FAKE_CODEX_SCRIPT", string(raw))
+	t.Setenv("LLM_PROXY_FAKE_CODEX_LOG", filepath.Join(home, "requests.jsonl"))
+	return &CodexAdapter{bin: os.Args[0]}
+}
+
+// fakeCodexRequests returns the params of each request the fake app-server
+// received, keyed by method.
+func fakeCodexRequests(t *testing.T) map[string]map[string]any {
+	t.Helper()
+	raw, err := os.ReadFile(os.Getenv("LLM_PROXY_FAKE_CODEX_LOG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := map[string]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		var req struct {
+			Method string         `json:"method"`
+			Params map[string]any `json:"params"`
+		}
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			t.Fatal(err)
+		}
+		out[req.Method] = req.Params
+	}
+	return out
+}
+
+// fakeClaudeInvocation returns the args and stdin of the last fake claude run.
+func fakeClaudeInvocation(t *testing.T) ([]string, string) {
+	t.Helper()
+	raw, err := os.ReadFile(os.Getenv("LLM_PROXY_FAKE_CLAUDE_RECORD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec struct {
+		Args  []string `json:"args"`
+		Stdin string   `json:"stdin"`
+	}
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Args, rec.Stdin
+}
+
+func codexNotification(method string, params any) map[string]any {
+	return map[string]any{"method": method, "params": params}
+}
+
+func codexAgentDelta(delta string) map[string]any {
+	return codexNotification("item/agentMessage/delta", map[string]any{"delta": delta})
+}
+
+func codexItem(method string, itemType string) map[string]any {
+	return codexNotification(method, map[string]any{"item": map[string]any{"type": itemType}})
+}
+
+// newFakeClaudeAdapter returns a ClaudeAdapter whose CLI prints the given
+// stream-json lines.
+func newFakeClaudeAdapter(t *testing.T, lines ...string) *ClaudeAdapter {
+	t.Helper()
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("LLM_PROXY_FAKE_CLAUDE", "1")
+	t.Setenv("LLM_PROXY_FAKE_CLAUDE_OUTPUT", strings.Join(lines, "\n")+"\n")
+	t.Setenv("LLM_PROXY_FAKE_CLAUDE_RECORD", filepath.Join(t.TempDir(), "claude.json"))
+	return &ClaudeAdapter{bin: os.Args[0], models: []string{"sonnet"}}
+}
@@ -0,0 +1,491 @@
+package proxy
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// Code fence filters.
+const (
+	CodeFencesNormalize = "normalize"
+	CodeFencesStrip     = "strip"
+)
+
+// OutputFilters clean up the text the CLIs answer before clients get it.
+// StripANSI removes terminal escape sequences. StripPreamble drops an
+// opening "Sure!" or "Certainly, here is the code:". CodeFences "normalize"
+// tags fenced code blocks with a lowercase, canonical language and closes
+// one left open; "strip" removes the fence lines, leaving the code.
+type OutputFilters struct {
+	StripANSI     bool
+	StripPreamble bool
+	CodeFences    string
+}
+
+func (f OutputFilters) enabled() bool {
+	return f.StripANSI || f.StripPreamble || f.CodeFences != ""
+}
+
+// FilterOutput returns adapter with f applied to its answers. Streams are
+// filtered as they go, holding back only what the filters cannot decide
+// yet, so their deltas add up to what the same answer filtered whole gives.
+func FilterOutput(adapter Adapter, f OutputFilters) Adapter {
+	if !f.enabled() {
+		return adapter
+	}
+	return &filteringAdapter{Adapter: adapter, f: f}
+}
+
+type filteringAdapter struct {
+	Adapter
+	f OutputFilters
+}
+
+func (a *filteringAdapter) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	resp, err := a.Adapter.Chat(ctx, req)
+	resp.Text = a.f.apply(resp.Text)
+	return resp, err
+}
+
+func (a *filteringAdapter) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (ChatResponse, error) {
+	var resp ChatResponse
+	text, err := a.f.stream(onDelta, func(write func(string) error) (err error) {
+		resp, err = a.Adapter.ChatStream(ctx, req, write)
+		return err
+	})
+	resp.Text = text
+	return resp, err
+}
+
+func (a *filteringAdapter) Respond(ctx context.Context, req ResponsesRequest) (ResponsesResponse, error) {
+	resp, err := a.Adapter.Respond(ctx, req)
+	resp.Text = a.f.apply(resp.Text)
+	return resp, err
+}
+
+func (a *filteringAdapter) RespondStream(ctx context.Context, req ResponsesRequest, onDelta func(string) error) (ResponsesResponse, error) {
+	var resp ResponsesResponse
+	text, err := a.f.stream(onDelta, func(write func(string) error) (err error) {
+		resp, err = a.Adapter.RespondStream(ctx, req, write)
+		return err
+	})
+	resp.Text = text
+	return resp, err
+}
+
+func (a *filteringAdapter) RespondStreamEvents(ctx context.Context, req ResponsesRequest, onEvent func(ResponseEvent) error) (ResponsesResponse, error) {
+	var resp ResponsesResponse
+	onDelta := func(delta string) error {
+		return onEvent(ResponseEvent{Kind: ResponseEventOutput, Delta: delta})
+	}
+	text, err := a.f.stream(onDelta, func(write func(string) error) (err error) {
+		resp, err = respondEvents(ctx, a.Adapter, req, func(ev ResponseEvent) error {
+			if ev.Kind != ResponseEventOutput {
+				return onEvent(ev)
+			}
+			return write(ev.Delta)
+		})
+		return err
+	})
+	resp.Text = text
+	return resp, err
+}
+
+// stream runs a stream through the filters: run gets the function its
+// deltas go to, and onDelta what comes out of the filters. It returns all
+// that came out.
+func (f OutputFilters) stream(onDelta func(string) error, run func(func(string) error) error) (string, error) {
+	chain := f.chain()
+	var out strings.Builder
+	emit := func(s string) error {
+		if s == "" {
+			return nil
+		}
+		out.WriteString(s)
+		return onDelta(s)
+	}
+	err := run(func(delta string) error {
+		return emit(chain.write(delta))
+	})
+	if flushErr := emit(chain.flush()); err == nil {
+		err = flushErr
+	}
+	return out.String(), err
+}
+
+// outputFilter filters a stream of text: write returns what can be passed
+// on of what it was given and held back before, flush what is left at the
+// end.
+type outputFilter interface {
+	write(s string) string
+	flush() string
+}
+
+// filterChain runs each filter on what the previous one passed on.
+type filterChain []outputFilter
+
+func (f OutputFilters) chain() filterChain {
+	var chain filterChain
+	if f.StripANSI {
+		chain = append(chain, &ansiFilter{})
+	}
+	if f.StripPreamble {
+		chain = append(chain, &preambleFilter{})
+	}
+	if f.CodeFences != "" {
+		chain = append(chain, &fenceFilter{strip: f.CodeFences == CodeFencesStrip, lineStart: true})
+	}
+	return chain
+}
+
+// apply filters a whole answer.
+func (f OutputFilters) apply(text string) string {
+	return f.chain().apply(text)
+}
+
+func (c filterChain) apply(s string) string {
+	return c.write(s) + c.flush()
+}
+
+func (c filterChain) write(s string) string {
+	for _, f := range c {
+		s = f.write(s)
+	}
+	return s
+}
+
+func (c filterChain) flush() string {
+	out := ""
+	for _, f := range c {
+		out = f.write(out) + f.flush()
+	}
+	return out
+}
+
+// maxEscape bounds the escape sequence ansiFilter holds back waiting for
+// its end; a longer one is dropped as it stands.
+const maxEscape = 4096
+
+// ansiFilter removes ANSI escape sequences: CSI (colors, cursor moves),
+// OSC (titles, hyperlinks), DCS and the like, and two-byte escapes.
+type ansiFilter struct {
+	pending string
+}
+
+func (f *ansiFilter) write(s string) string {
+	s = f.pending + s
+	f.pending = ""
+	var out strings.Builder
+	for {
+		i := strings.IndexAny(s, "\x1b\u009b")
+		if i < 0 {
+			// The first byte of a U+009B split from the rest.
+			if strings.HasSuffix(s, "\xc2") {
+				s, f.pending = s[:len(s)-1], s[len(s)-1:]
+			}
+			out.WriteString(s)
+			break
+		}
+		out.WriteString(s[:i])
+		n, complete := escapeLen(s[i:])
+		if !complete {
+			if len(s)-i <= maxEscape {
+				f.pending = s[i:]
+			}
+			break
+		}
+		s = s[i+n:]
+	}
+	return out.String()
+}
+
+func (f *ansiFilter) flush() string {
+	out := ""
+	if f.pending == "\xc2" {
+		out = f.pending
+	}
+	f.pending = ""
+	return out
+}
+
+// escapeLen returns the length of the escape sequence s starts with, and
+// false when s ends before the sequence does.
+func escapeLen(s string) (int, bool) {
+	if strings.HasPrefix(s, "\u009b") {
+		return csiLen(s, len("\u009b"))
+	}
+	if len(s) < 2 {
+		return 0, false
+	}
+	switch c := s[1]; {
+	case c == '[':
+		return csiLen(s, 2)
+	case c == ']' || c == 'P' || c == 'X' || c == '^' || c == '_':
+		// A string ended by BEL (OSC only) or ST, ESC \.
+		for j := 2; j < len(s); j++ {
+			if s[j] == '\a' && c == ']' {
+				return j + 1, true
+			}
+			if s[j] == '\x1b' && j+1 < len(s) && s[j+1] == '\\' {
+				return j + 2, true
+			}
+		}
+		return 0, false
+	case c >= 0x20 && c <= 0x2f:
+		// Intermediate bytes, then a final byte: charset designations.
+		for j := 2; j < len(s); j++ {
+			if s[j] < 0x20 || s[j] > 0x2f {
+				return j + 1, true
+			}
+		}
+		return 0, false
+	case c >= 0x30 && c <= 0x7e:
+		return 2, true
+	}
+	// A lone ESC.
+	return 1, true
+}
+
+// csiLen returns the length of a control sequence whose parameters start at
+// i: parameter and intermediate bytes, then a final byte.
+func csiLen(s string, i int) (int, bool) {
+	for j := i; j < len(s); j++ {
+		switch c := s[j]; {
+		case c >= 0x20 && c <= 0x3f:
+		case c >= 0x40 && c <= 0x7e:
+			return j + 1, true
+		default:
+			// Not a valid sequence: drop what there was of it.
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// maxPreamble is how far into an answer preambleFilter looks for the end
+// of an opening pleasantry.
+const maxPreamble = 200
+
+var (
+	preambleWords  = []string{"sure", "certainly", "of course", "absolutely", "okay", "ok", "alright", "great question", "good question", "happy to help", "no problem"}
+	preambleOpener = regexp.MustCompile(`^(?i:` + strings.Join(preambleWords, "|") + `)`)
+	// preamblePattern is an opener followed by "!" or "." or by ", here
+	// is..." up to the end of that sentence.
+	preamblePattern = regexp.MustCompile(preambleOpener.String() + `(?:[!.]|,\s*(?i:here(?:'s| is| are)|i(?:'d| would| can| will|'ll)|let me)\b[^\n]*?[.!:])(?:\s|$)\s*`)
+)
+
+// preambleFilter drops a pleasantry the answer opens with, once the
+// answer goes on after it.
+type preambleFilter struct {
+	buf  strings.Builder
+	done bool
+}
+
+func (f *preambleFilter) write(s string) string {
+	if f.done {
+		return s
+	}
+	f.buf.WriteString(s)
+	text := f.buf.String()
+	start := strings.TrimLeft(text, " \t\r\n")
+	if start == "" {
+		return ""
+	}
+	opener := preambleOpener.FindString(start)
+	if opener == "" {
+		if couldOpen(start) {
+			return ""
+		}
+		return f.pass(text)
+	}
+	if len(start) > len(opener) && !strings.ContainsRune("!.,", rune(start[len(opener)])) {
+		// "Surely", "Of course it": not a pleasantry.
+		return f.pass(text)
+	}
+	loc := preamblePattern.FindStringIndex(start)
+	if loc != nil {
+		if rest := start[loc[1]:]; rest != "" {
+			f.done = true
+			f.buf.Reset()
+			return rest
+		}
+	}
+	if len(start) < maxPreamble && (loc != nil || !strings.Contains(start, "\n")) {
+		return ""
+	}
+	return f.pass(text)
+}
+
+// flush passes on an answer that was nothing but a pleasantry as it is.
+func (f *preambleFilter) flush() string {
+	if f.done {
+		return ""
+	}
+	return f.pass(f.buf.String())
+}
+
+func (f *preambleFilter) pass(text string) string {
+	f.done = true
+	f.buf.Reset()
+	return text
+}
+
+// couldOpen reports whether s could still grow into a preamble opener.
+func couldOpen(s string) bool {
+	s = strings.ToLower(s)
+	for _, w := range preambleWords {
+		if len(s) < len(w) && strings.HasPrefix(w, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// fenceLanguages maps the usual aliases of code block languages to one
+// name each.
+var fenceLanguages = map[string]string{
+	"py":      "python",
+	"python3": "python",
+	"js":      "javascript",
+	"node":    "javascript",
+	"ts":      "typescript",
+	"sh":      "bash",
+	"shell":   "bash",
+	"zsh":     "bash",
+	"yml":     "yaml",
+	"golang":  "go",
+	"rb":      "ruby",
+	"rs":      "rust",
+	"c++":     "cpp",
+	"cs":      "csharp",
+	"c#":      "csharp",
+	"md":      "markdown",
+}
+
+// fenceFilter normalizes or strips the fence lines of fenced code blocks.
+// Lines that could be a fence are held back until they end.
+type fenceFilter struct {
+	strip bool
+	// lineStart is set at the start of a line, line holds the line while
+	// it could be a fence.
+	lineStart bool
+	line      strings.Builder
+	// open is the opening fence of the block the text is in, "" outside.
+	open string
+}
+
+func (f *fenceFilter) write(s string) string {
+	var out strings.Builder
+	for len(s) > 0 {
+		if !f.lineStart {
+			i := strings.IndexByte(s, '\n')
+			if i < 0 {
+				out.WriteString(s)
+				break
+			}
+			out.WriteString(s[:i+1])
+			s = s[i+1:]
+			f.lineStart = true
+			continue
+		}
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			f.line.WriteString(s)
+			if !maybeFence(f.line.String()) {
+				out.WriteString(f.line.String())
+				f.line.Reset()
+				f.lineStart = false
+			}
+			break
+		}
+		f.line.WriteString(s[:i+1])
+		s = s[i+1:]
+		out.WriteString(f.endLine(f.line.String()))
+		f.line.Reset()
+	}
+	return out.String()
+}
+
+func (f *fenceFilter) flush() string {
+	out := ""
+	if f.line.Len() > 0 {
+		out = f.endLine(f.line.String())
+		f.line.Reset()
+	}
+	if f.open != "" && !f.strip {
+		if out != "" && !strings.HasSuffix(out, "\n") || out == "" && !f.lineStart {
+			out += "\n"
+		}
+		out += f.open
+		f.open = ""
+	}
+	return out
+}
+
+// endLine rewrites a whole line, with its newline if it has one, if it is a
+// fence.
+func (f *fenceFilter) endLine(line string) string {
+	body := strings.TrimSuffix(line, "\n")
+	nl := line[len(body):]
+	indent, marker, info, ok := parseFence(body)
+	if !ok {
+		return line
+	}
+	switch {
+	case f.open == "":
+		f.open = indent + marker
+		if f.strip {
+			return ""
+		}
+		if lang, rest, _ := strings.Cut(info, " "); lang != "" {
+			lang = strings.ToLower(lang)
+			if alias, ok := fenceLanguages[lang]; ok {
+				lang = alias
+			}
+			info = strings.TrimSpace(lang + " " + rest)
+		}
+		return indent + marker + info + nl
+	case info == "" && marker[0] == f.open[len(f.open)-1] && len(marker) >= len(strings.TrimLeft(f.open, " ")):
+		f.open = ""
+		if f.strip {
+			return ""
+		}
+		return body + nl
+	}
+	return line
+}
+
+// parseFence splits a fence line into its indentation, its run of three or
+// more backticks or tildes and its info string.
+func parseFence(line string) (indent, marker, info string, ok bool) {
+	rest := strings.TrimLeft(line, " ")
+	if len(line)-len(rest) > 3 || len(rest) < 3 || (rest[0] != '`' && rest[0] != '~') {
+		return "", "", "", false
+	}
+	n := len(rest) - len(strings.TrimLeft(rest, rest[:1]))
+	if n < 3 {
+		return "", "", "", false
+	}
+	info = strings.TrimSpace(rest[n:])
+	if rest[0] == '`' && strings.Contains(info, "`") {
+		return "", "", "", false
+	}
+	return line[:len(line)-len(rest)], rest[:n], info, true
+}
+
+// maybeFence reports whether a line begun with s could still be a fence.
+func maybeFence(s string) bool {
+	rest := strings.TrimLeft(s, " ")
+	if len(s)-len(rest) > 3 {
+		return false
+	}
+	if rest == "" {
+		return true
+	}
+	n := len(rest) - len(strings.TrimLeft(rest, rest[:1]))
+	if rest[0] != '`' && rest[0] != '~' {
+		return false
+	}
+	return n >= 3 || n == len(rest)
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestOutputFiltersCleanAnswers(t *testing.T) {
+	ansi := OutputFilters{StripANSI: true}
+	preamble := OutputFilters{StripPreamble: true}
+	normalize := OutputFilters{CodeFences: CodeFencesNormalize}
+	strip := OutputFilters{CodeFences: CodeFencesStrip}
+	cases := []struct {
+		f        OutputFilters
+		in, want string
+	}{
+		{ansi, "\x1b[1;32mgreen\x1b[0m text", "green text"},
+		{ansi, "\x1b]0;title\amid\x1b]8;;https://x.dev\x1b\\link\x1b]8;;\x1b\\ end", "midlink end"},
+		{ansi, "a\x1b(Bb\x1b=c\u009b2Kd", "abcd"},
+		{ansi, "cut \x1b[3", "cut "},
+		{preamble, "Sure! Here it is.", "Here it is."},
+		{preamble, "Certainly, here is the updated function:\n\nfunc f() {}", "func f() {}"},
+		{preamble, "  Of course. 4", "4"},
+		{preamble, "OK, let me check.\nDone.", "Done."},
+		{preamble, "Sure!", "Sure!"},
+		{preamble, "Surely not.", "Surely not."},
+		{preamble, "Of course it fails: x is nil.", "Of course it fails: x is nil."},
+		{preamble, "Sure, the answer is 4.", "Sure, the answer is 4."},
+		{preamble, "Great job on the tests.", "Great job on the tests."},
+		{normalize, "Code:\n``` Py \nprint(1)\n```\nbye", "Code:\n```python\nprint(1)\n```\nbye"},
+		{normalize, "~~~JS title=x\nf()\n~~~", "~~~javascript title=x\nf()\n~~~"},
+		{normalize, "````md\n```go\nx\n```\n````", "````markdown\n```go\nx\n```\n````"},
+		{normalize, "```go\nfunc main() {}", "```go\nfunc main() {}\n```"},
+		{normalize, "inline ``` not a fence\n    ```indented code", "inline ``` not a fence\n    ```indented code"},
+		{strip, "```go\nfunc main() {}\n```\n", "func main() {}\n"},
+		{strip, "Run:\n```sh\nmake\n```\nthen test.", "Run:\nmake\nthen test."},
+		{OutputFilters{StripANSI: true, StripPreamble: true, CodeFences: CodeFencesStrip}, "\x1b[2mSure!\x1b[0m\n```\nls\n```", "ls\n"},
+	}
+	for _, tc := range cases {
+		if got := tc.f.apply(tc.in); got != tc.want {
+			t.Errorf("%+v on %q = %q, want %q", tc.f, tc.in, got, tc.want)
+		}
+		// Split anywhere, the stream adds up to the same.
+		for i := 1; i < len(tc.in); i++ {
+			if got := streamFiltered(tc.f, tc.in[:i], tc.in[i:]); got != tc.want {
+				t.Errorf("%+v on %q split at %d = %q, want %q", tc.f, tc.in, i, got, tc.want)
+			}
+		}
+		if got := streamFiltered(tc.f, strings.Split(tc.in, "")...); got != tc.want {
+			t.Errorf("%+v on %q byte by byte = %q, want %q", tc.f, tc.in, got, tc.want)
+		}
+	}
+}
+
+func streamFiltered(f OutputFilters, deltas ...string) string {
+	chain := f.chain()
+	var out strings.Builder
+	for _, d := range deltas {
+		out.WriteString(chain.write(d))
+	}
+	out.WriteString(chain.flush())
+	return out.String()
+}
+
+func TestFilterOutputWrapsStreamsAndWholeAnswers(t *testing.T) {
+	base := &raceTestAdapter{deltas: []string{"Sure", "! \x1b[3", "1mHello", "\x1b[0m"}}
+	adapter := FilterOutput(base, OutputFilters{StripANSI: true, StripPreamble: true})
+
+	var deltas []string
+	resp, err := adapter.ChatStream(context.Background(), ChatRequest{}, func(d string) error {
+		deltas = append(deltas, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(deltas, ""); got != "Hello" || resp.Text != "Hello" {
+		t.Fatalf("streamed %q, text %q; want Hello", deltas, resp.Text)
+	}
+	resp, err = adapter.Chat(context.Background(), ChatRequest{})
+	if err != nil || resp.Text != "Hello" {
+		t.Fatalf("chat = %q, %v", resp.Text, err)
+	}
+	if FilterOutput(base, OutputFilters{}) != Adapter(base) {
+		t.Fatal("no filters should leave the adapter as it is")
+	}
+}
@@ -0,0 +1,247 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// healthFailuresToOpen is how many probes in a row must fail before a
+// backend's circuit opens and requests to it fail fast.
+const healthFailuresToOpen = 2
+
+// HealthStatus is the outcome of the latest health probes of one backend.
+type HealthStatus struct {
+	Backend   Backend
+	Err       error
+	CheckedAt time.Time
+	Latency   time.Duration
+	// Failures counts the probes that failed in a row.
+	Failures int
+}
+
+// Healthy reports whether the last probe passed, or none has run yet.
+func (s HealthStatus) Healthy() bool { return s.Err == nil }
+
+// CircuitOpen reports whether requests to the backend are being refused.
+func (s HealthStatus) CircuitOpen() bool { return s.Failures >= healthFailuresToOpen }
+
+// BackendUnavailableError is returned for requests to a backend whose health
+// probes keep failing.
+type BackendUnavailableError struct {
+	Backend Backend
+	Err     error
+}
+
+func (e *BackendUnavailableError) Error() string {
+	return fmt.Sprintf("%s backend is unavailable: %v", e.Backend, e.Err)
+}
+
+func (e *BackendUnavailableError) Unwrap() error { return e.Err }
+
+// healthState holds the latest status of each backend.
+type healthState struct {
+	mu       sync.Mutex
+	statuses map[Backend]HealthStatus
+}
+
+func newHealthState() *healthState {
+	return &healthState{statuses: map[Backend]HealthStatus{}}
+}
+
+func (h *healthState) get(backend Backend) HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.statuses[backend]
+}
+
+// record stores the outcome of a probe. A usage limit is reported but not
+// counted toward opening the circuit: the backend is up, and its other
+// models keep serving.
+func (h *healthState) record(backend Backend, err error, latency time.Duration) HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st := HealthStatus{Backend: backend, Err: err, CheckedAt: time.Now(), Latency: latency}
+	var rl *RateLimitError
+	switch {
+	case errors.As(err, &rl):
+		st.Failures = h.statuses[backend].Failures
+	case err != nil:
+		st.Failures = h.statuses[backend].Failures + 1
+	}
+	h.statuses[backend] = st
+	return st
+}
+
+func (h *healthState) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clear(h.statuses)
+}
+
+// CheckHealth probes both backends concurrently and records the results,
+// which Health reports and routing consults.
+func (r *Router) CheckHealth(ctx context.Context) []HealthStatus {
+	claude, codex := r.adapters()
+	adapters := []struct {
+		backend Backend
+		adapter Adapter
+	}{{BackendClaude, claude}, {BackendCodex, codex}}
+	out := make([]HealthStatus, len(adapters))
+	var wg sync.WaitGroup
+	for i, a := range adapters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := a.adapter.HealthCheck(ctx)
+			out[i] = r.health.record(a.backend, err, time.Since(start))
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// Health returns the latest probe results of both backends.
+func (r *Router) Health() []HealthStatus {
+	out := make([]HealthStatus, 0, 2)
+	for _, backend := range []Backend{BackendClaude, BackendCodex} {
+		st := r.health.get(backend)
+		st.Backend = backend
+		out = append(out, st)
+	}
+	return out
+}
+
+// Ready reports whether at least one backend can take requests.
+func (r *Router) Ready() bool {
+	for _, st := range r.Health() {
+		if !st.CircuitOpen() {
+			return true
+		}
+	}
+	return false
+}
+
+// backendOf returns which backend adapter is, or "" for any other adapter.
+func (r *Router) backendOf(adapter Adapter) Backend {
+	claude, codex := r.adapters()
+	switch adapter {
+	case claude:
+		return BackendClaude
+	case codex:
+		return BackendCodex
+	}
+	return ""
+}
+
+// available returns a BackendUnavailableError when adapter's circuit is open.
+func (r *Router) available(adapter Adapter) error {
+	backend := r.backendOf(adapter)
+	if backend == "" {
+		return nil
+	}
+	if st := r.health.get(backend); st.CircuitOpen() {
+		return &BackendUnavailableError{Backend: backend, Err: st.Err}
+	}
+	return nil
+}
+
+// HealthCheck checks that the Claude CLI runs and would serve requests on
+// the subscription, without spending a prompt.
+func (a *ClaudeAdapter) HealthCheck(ctx context.Context) error {
+	if err := a.ensureSubscriptionMode(); err != nil {
+		return err
+	}
+	return a.checkVersion(ctx)
+}
+
+// codexServerVouches is how long an app-server that answered initialize,
+// for a request or a probe, stands in for the next probes.
+const codexServerVouches = 15 * time.Minute
+
+// serverSeen remembers when an app-server last answered initialize, and
+// whether the latest start failed since.
+type serverSeen struct {
+	mu     sync.Mutex
+	at     time.Time
+	failed bool
+}
+
+func (s *serverSeen) observe(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failed = true
+		return
+	}
+	s.at, s.failed = time.Now(), false
+}
+
+// recent reports whether an app-server answered lately and none failed to
+// since.
+func (s *serverSeen) recent() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.failed && !s.at.IsZero() && time.Since(s.at) < codexServerVouches
+}
+
+// initialize initializes client, noting for health probes whether the
+// app-server answered.
+func (a *CodexAdapter) initialize(ctx context.Context, client *codexRPCClient) error {
+	err := client.initialize()
+	if ctx.Err() == nil {
+		a.served.observe(err)
+	}
+	return err
+}
+
+// HealthCheck checks the ChatGPT login and that the CLI runs. It starts an
+// app-server and has it answer initialize only when no request or probe
+// has lately, or the last one failed, so an idle proxy does not spawn one
+// every minute.
+func (a *CodexAdapter) HealthCheck(ctx context.Context) error {
+	if err := a.ensureSubscriptionMode(ctx); err != nil {
+		return err
+	}
+	if a.served.recent() {
+		_, err := runVersion(ctx, a.bin, a.opts.Env)
+		return err
+	}
+	client, err := newCodexRPCClient(ctx, a.bin, a.opts.Env)
+	if err != nil {
+		a.served.observe(err)
+		return err
+	}
+	defer client.stderr.attach(ctx)()
+	defer client.Close()
+	return a.initialize(ctx, client)
+}
+
+// HealthCheck passes while any leg is healthy.
+func (a *RaceAdapter) HealthCheck(ctx context.Context) error {
+	var errs []error
+	for _, leg := range a.legs {
+		err := leg.Adapter.HealthCheck(ctx)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// checkVersion runs `bin --version`, recording the version for the adapter
+// to adapt to.
+func (a *ClaudeAdapter) checkVersion(ctx context.Context) error {
+	out, err := runVersion(ctx, a.bin, a.opts.Env)
+	if err != nil {
+		return err
+	}
+	if v, ok := parseCLIVersion(out); ok {
+		a.version.Store(&v)
+	}
+	return nil
+}
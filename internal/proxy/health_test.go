@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// healthTestAdapter fails its health checks with err.
+type healthTestAdapter struct {
+	raceTestAdapter
+	err error
+}
+
+func (a *healthTestAdapter) HealthCheck(context.Context) error { return a.err }
+
+func TestFailingProbesOpenTheCircuit(t *testing.T) {
+	claude := &healthTestAdapter{err: errors.New("claude --version: exit status 127")}
+	codex := &healthTestAdapter{}
+	r := NewRouter(claude, codex)
+	r.SetRaces(map[string][]string{"quick": {"claude/opus", "codex/gpt-5"}})
+	ctx := context.Background()
+
+	r.CheckHealth(ctx)
+	if _, _, err := r.Resolve(ctx, "claude/opus"); err != nil {
+		t.Fatalf("one failed probe refused requests: %v", err)
+	}
+
+	r.CheckHealth(ctx)
+	_, _, err := r.Resolve(ctx, "claude/opus")
+	var unavailable *BackendUnavailableError
+	if !errors.As(err, &unavailable) || unavailable.Backend != BackendClaude || ClassifyError(err, "") != ErrorUnavailable {
+		t.Fatalf("Resolve = %v, want claude unavailable", err)
+	}
+	adapter, _, err := r.Resolve(ctx, "quick")
+	if err != nil {
+		t.Fatalf("race with a healthy leg: %v", err)
+	}
+	if race := adapter.(*RaceAdapter); len(race.legs) != 1 || race.legs[0].Adapter != codex {
+		t.Fatalf("race legs = %+v, want only codex", race.legs)
+	}
+	if !r.Ready() {
+		t.Fatal("not ready with codex healthy")
+	}
+
+	claude.err = nil
+	r.CheckHealth(ctx)
+	if _, _, err := r.Resolve(ctx, "claude/opus"); err != nil {
+		t.Fatalf("passing probe did not close the circuit: %v", err)
+	}
+}
+
+func TestRouterNotReadyWhenEveryBackendIsDown(t *testing.T) {
+	down := errors.New("not logged in")
+	r := NewRouter(&healthTestAdapter{err: down}, &healthTestAdapter{err: down})
+	r.CheckHealth(context.Background())
+	r.CheckHealth(context.Background())
+	if r.Ready() {
+		t.Fatal("ready with both circuits open")
+	}
+	r.SetAdapters(&healthTestAdapter{}, &healthTestAdapter{})
+	if !r.Ready() {
+		t.Fatal("new adapters inherited the old health")
+	}
+}
+
+func TestCodexHealthCheckInitializesAnAppServer(t *testing.T) {
+	codex := newFakeCodexAdapter(t)
+	if err := codex.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("codex HealthCheck: %v", err)
+	}
+	if req := fakeCodexRequests(t); req["initialize"] == nil {
+		t.Fatalf("app-server was not initialized: %v", req)
+	}
+
+	if err := os.Remove(os.Getenv("LLM_PROXY_FAKE_CODEX_LOG")); err != nil {
+		t.Fatal(err)
+	}
+	if err := codex.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("codex HealthCheck: %v", err)
+	}
+	if _, err := os.Stat(os.Getenv("LLM_PROXY_FAKE_CODEX_LOG")); !os.IsNotExist(err) {
+		t.Fatal("expected the next probe to trust the app-server that just answered")
+	}
+}
+
+func TestUsageLimitsDoNotOpenTheCircuit(t *testing.T) {
+	claude := &healthTestAdapter{err: &RateLimitError{Backend: BackendClaude, Model: "opus", Reset: time.Now().Add(time.Hour)}}
+	r := NewRouter(claude, &healthTestAdapter{})
+	for range healthFailuresToOpen + 1 {
+		r.CheckHealth(context.Background())
+	}
+	if _, _, err := r.Resolve(context.Background(), "claude/sonnet"); err != nil {
+		t.Fatalf("usage limit opened the circuit: %v", err)
+	}
+}
+
+func TestClaudeHealthCheckRunsVersion(t *testing.T) {
+	claude := newFakeClaudeAdapter(t, "2.0.0 (Claude Code)")
+	if err := claude.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("claude HealthCheck: %v", err)
+	}
+	if args, _ := fakeClaudeInvocation(t); len(args) != 1 || args[0] != "--version" {
+		t.Fatalf("claude args = %q, want --version", args)
+	}
+
+	t.Setenv("ANTHROPIC_API_KEY", "sk-test")
+	if err := (&ClaudeAdapter{bin: claude.bin}).HealthCheck(context.Background()); err == nil {
+		t.Fatal("HealthCheck passed in API-key mode")
+	}
+}
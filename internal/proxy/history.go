@@ -0,0 +1,62 @@
+package proxy
+
+// HistoryPolicy bounds the conversation history flattened into a CLI prompt.
+// Zero limits disable the corresponding check.
+type HistoryPolicy struct {
+	MaxMessages int
+	MaxChars    int
+	// SummaryModel, when set, is asked to summarize the dropped messages so the
+	// gist survives truncation.
+	SummaryModel string
+}
+
+func (p HistoryPolicy) Enabled() bool {
+	return p.MaxMessages > 0 || p.MaxChars > 0
+}
+
+// TrimHistory applies the policy to messages. System messages are always
+// kept and moved to the front; of the rest, the most recent ones that fit are
+// kept and the last message is never dropped. Dropped messages are returned in
+// their original order.
+func (p HistoryPolicy) TrimHistory(messages []Message) (kept []Message, dropped []Message) {
+	if !p.Enabled() {
+		return messages, nil
+	}
+	var system, turns []Message
+	for _, m := range messages {
+		if m.Role == "system" || m.Role == "developer" {
+			system = append(system, m)
+		} else {
+			turns = append(turns, m)
+		}
+	}
+
+	start := 0
+	if p.MaxMessages > 0 && len(turns) > p.MaxMessages {
+		start = len(turns) - p.MaxMessages
+	}
+	if p.MaxChars > 0 {
+		total := 0
+		for _, m := range turns[start:] {
+			total += len(m.Content)
+		}
+		for total > p.MaxChars && start < len(turns)-1 {
+			total -= len(turns[start].Content)
+			start++
+		}
+	}
+	if start == 0 {
+		return messages, nil
+	}
+	kept = append(kept, system...)
+	kept = append(kept, turns[start:]...)
+	return kept, turns[:start]
+}
+
+// SummaryPrompt builds the request used to summarize dropped messages.
+func SummaryPrompt(dropped []Message) []Message {
+	return []Message{
+		{Role: "system", Content: "Summarize the following earlier part of a conversation in a short paragraph. Keep facts, decisions, names, and open questions; drop pleasantries. Reply with the summary only."},
+		{Role: "user", Content: buildChatPrompt(dropped)},
+	}
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrimHistoryKeepsSystemAndRecentTurns(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "one"},
+		{Role: "assistant", Content: "two"},
+		{Role: "user", Content: "three"},
+		{Role: "assistant", Content: "four"},
+		{Role: "user", Content: "five"},
+	}
+
+	kept, dropped := HistoryPolicy{MaxMessages: 3}.TrimHistory(messages)
+	wantKept := []Message{messages[0], messages[3], messages[4], messages[5]}
+	if !reflect.DeepEqual(kept, wantKept) {
+		t.Fatalf("kept = %#v, want %#v", kept, wantKept)
+	}
+	if !reflect.DeepEqual(dropped, messages[1:3]) {
+		t.Fatalf("dropped = %#v", dropped)
+	}
+
+	kept, _ = HistoryPolicy{MaxChars: 9}.TrimHistory(messages)
+	if !reflect.DeepEqual(kept, []Message{messages[0], messages[4], messages[5]}) {
+		t.Fatalf("char limit kept = %#v", kept)
+	}
+
+	kept, _ = HistoryPolicy{MaxChars: 1}.TrimHistory(messages)
+	if !reflect.DeepEqual(kept, []Message{messages[0], messages[5]}) {
+		t.Fatalf("expected the last message to survive, got %#v", kept)
+	}
+
+	if kept, dropped := (HistoryPolicy{}).TrimHistory(messages); len(dropped) != 0 || len(kept) != len(messages) {
+		t.Fatalf("disabled policy changed history: %#v", kept)
+	}
+}
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The janitor keeps track of every CLI process the proxy has running, so
+// none outlives its request or the proxy: cancelled requests and
+// waitCommand kill a CLI's whole process group, KillProcesses kills what is
+// left at shutdown, and with SetProcessDir the running CLIs are also written
+// to a file that RecoverProcesses reads after a crash.
+
+// trackedProcess is a running CLI as recorded in the process file.
+type trackedProcess struct {
+	PID     int       `json:"pid"`
+	Bin     string    `json:"bin"`
+	Started time.Time `json:"started"`
+	// limits are the process limits the CLI was started under.
+	limits ProcessLimits
+}
+
+var janitor struct {
+	mu    sync.Mutex
+	procs map[*exec.Cmd]trackedProcess
+	file  string
+}
+
+// SetProcessDir makes the janitor record the running CLIs in a file of
+// this process's own under dir; an empty dir stops recording.
+func SetProcessDir(dir string) error {
+	file := ""
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+		file = filepath.Join(dir, strconv.Itoa(os.Getpid())+".json")
+	}
+	janitor.mu.Lock()
+	defer janitor.mu.Unlock()
+	janitor.file = file
+	return saveProcessesLocked()
+}
+
+func trackProcess(cmd *exec.Cmd, p trackedProcess) {
+	janitor.mu.Lock()
+	defer janitor.mu.Unlock()
+	if janitor.procs == nil {
+		janitor.procs = map[*exec.Cmd]trackedProcess{}
+	}
+	janitor.procs[cmd] = p
+	_ = saveProcessesLocked()
+}
+
+func untrackProcess(cmd *exec.Cmd) trackedProcess {
+	janitor.mu.Lock()
+	defer janitor.mu.Unlock()
+	p := janitor.procs[cmd]
+	delete(janitor.procs, cmd)
+	_ = saveProcessesLocked()
+	return p
+}
+
+// KillProcesses kills every running CLI with everything it started, for
+// shutdown, and returns how many there were. The process file goes with
+// them.
+func KillProcesses() int {
+	janitor.mu.Lock()
+	cmds := make([]*exec.Cmd, 0, len(janitor.procs))
+	for cmd := range janitor.procs {
+		cmds = append(cmds, cmd)
+	}
+	janitor.procs = nil
+	_ = saveProcessesLocked()
+	janitor.mu.Unlock()
+	for _, cmd := range cmds {
+		_ = killProcess(cmd)
+	}
+	return len(cmds)
+}
+
+// saveProcessesLocked rewrites the process file, or removes it when no CLI
+// runs.
+func saveProcessesLocked() error {
+	if janitor.file == "" {
+		return nil
+	}
+	if len(janitor.procs) == 0 {
+		if err := os.Remove(janitor.file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	procs := make([]trackedProcess, 0, len(janitor.procs))
+	for _, p := range janitor.procs {
+		procs = append(procs, p)
+	}
+	raw, err := json.Marshal(procs)
+	if err != nil {
+		return err
+	}
+	tmp := janitor.file + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, janitor.file)
+}
+
+// RecoverProcesses kills the CLIs recorded in dir by proxies that are no
+// longer running, such as one that crashed, and returns how many it killed.
+// A recorded PID is only killed while its command line still names the CLI
+// it was, in case the PID was reused.
+func RecoverProcesses(dir string) (int, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	killed := 0
+	for _, file := range files {
+		owner, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil || owner == os.Getpid() || processAlive(owner) {
+			continue
+		}
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return killed, err
+		}
+		var procs []trackedProcess
+		if err := json.Unmarshal(raw, &procs); err != nil {
+			log.Printf("process janitor: %s: %v", file, err)
+		}
+		for _, p := range procs {
+			cmdline := processCommandLine(p.PID)
+			if cmdline == "" || !strings.Contains(cmdline, filepath.Base(p.Bin)) {
+				continue
+			}
+			killGroup(p.PID)
+			killed++
+		}
+		if err := os.Remove(file); err != nil {
+			return killed, fmt.Errorf("remove %s: %w", file, err)
+		}
+	}
+	return killed, nil
+}
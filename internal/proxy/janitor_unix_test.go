@@ -0,0 +1,127 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// processGone reports whether pid has exited; zombies nobody reaps count.
+func processGone(pid int) bool {
+	if !processAlive(pid) {
+		return true
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+func waitGone(t *testing.T, pid int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !processGone(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("process %d still running", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJanitorTracksCLIsAndKillsWhatTheyLeave(t *testing.T) {
+	dir := t.TempDir()
+	if err := SetProcessDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = SetProcessDir("") })
+	file := filepath.Join(dir, strconv.Itoa(os.Getpid())+".json")
+
+	cmd := newCommand(context.Background(), "sh", "-c", "sleep 30 & echo $!; read _")
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := startCommand(cmd); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, _ := strconv.Atoi(strings.TrimSpace(line))
+
+	// Other tests' CLIs may still be winding down, so only this one's entry
+	// is checked.
+	recorded := func() bool {
+		var procs []trackedProcess
+		raw, _ := os.ReadFile(file)
+		_ = json.Unmarshal(raw, &procs)
+		for _, p := range procs {
+			if p.PID == cmd.Process.Pid {
+				return true
+			}
+		}
+		return false
+	}
+	if !recorded() {
+		t.Fatal("the running CLI is not in the process file")
+	}
+
+	stdin.Close()
+	_ = waitCommand(cmd)
+	waitGone(t, child)
+	if recorded() {
+		t.Fatal("the CLI is still in the process file after it exited")
+	}
+}
+
+func TestRecoverProcessesKillsOrphansOfDeadProxies(t *testing.T) {
+	orphan := exec.Command("sleep", "30")
+	orphan.SysProcAttr = procAttr()
+	if err := orphan.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer orphan.Process.Kill()
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	record := func(owner int) string {
+		raw, _ := json.Marshal([]trackedProcess{{PID: orphan.Process.Pid, Bin: orphan.Path}})
+		path := filepath.Join(dir, strconv.Itoa(owner)+".json")
+		if err := os.WriteFile(path, raw, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	live := record(os.Getppid())
+	if n, err := RecoverProcesses(dir); err != nil || n != 0 {
+		t.Fatalf("RecoverProcesses with a live owner = %d, %v", n, err)
+	}
+	if processGone(orphan.Process.Pid) {
+		t.Fatal("killed a process of a proxy that is still running")
+	}
+	os.Remove(live)
+
+	dead := record(exited.Process.Pid)
+	if n, err := RecoverProcesses(dir); err != nil || n != 1 {
+		t.Fatalf("RecoverProcesses = %d, %v, want 1", n, err)
+	}
+	if err := orphan.Wait(); err == nil || !strings.Contains(err.Error(), "killed") {
+		t.Fatalf("orphan exited with %v, want killed", err)
+	}
+	if _, err := os.Stat(dead); !os.IsNotExist(err) {
+		t.Fatalf("process file of the dead proxy was kept: %v", err)
+	}
+}
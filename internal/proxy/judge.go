@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JudgePrompt builds the request asking a judge model which of candidates
+// best answers request, a chat transcript ([]Message) or a Responses input.
+func JudgePrompt(request any, candidates []string) []Message {
+	var prompt string
+	if messages, ok := request.([]Message); ok {
+		prompt = buildChatPrompt(messages)
+	} else {
+		prompt = buildResponsesPrompt(request)
+	}
+	var b strings.Builder
+	b.WriteString("Request:\n")
+	b.WriteString(prompt)
+	for i, c := range candidates {
+		fmt.Fprintf(&b, "\n\nCandidate %d:\n%s", i+1, strings.TrimSpace(c))
+	}
+	return []Message{
+		{Role: "system", Content: fmt.Sprintf("You judge %d candidate answers to the same request. Pick the one that answers it best: correct first, then complete, then clear and concise. Reply with the candidate's number only.", len(candidates))},
+		{Role: "user", Content: b.String()},
+	}
+}
+
+var judgeVerdict = regexp.MustCompile(`\d+`)
+
+// ParseJudgeVerdict returns the index of the candidate, out of n, that a
+// judge's reply to JudgePrompt names.
+func ParseJudgeVerdict(reply string, n int) (int, bool) {
+	pick, err := strconv.Atoi(judgeVerdict.FindString(reply))
+	if err != nil || pick < 1 || pick > n {
+		return 0, false
+	}
+	return pick - 1, true
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxLineSize bounds one line of CLI output. Stream-json events carrying
+// large tool results run to tens of MiB; a line past this is treated as a
+// runaway process rather than buffered until memory runs out.
+const maxLineSize = 256 << 20
+
+// ErrLineTooLong reports a CLI output line longer than maxLineSize.
+var ErrLineTooLong = errors.New("CLI output line too long")
+
+// lineReader reads newline-delimited CLI output like bufio.Scanner, without
+// the scanner's fixed token size: a line longer than the read buffer spills
+// into a growing heap buffer, up to limit.
+type lineReader struct {
+	r     *bufio.Reader
+	limit int
+	line  []byte
+	err   error
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: bufio.NewReaderSize(r, 64*1024), limit: maxLineSize}
+}
+
+// Scan reads the next line, without its line ending, for Bytes and Text.
+func (l *lineReader) Scan() bool {
+	if l.err != nil {
+		return false
+	}
+	if cap(l.line) > 1<<20 {
+		// Don't keep a giant line's buffer alive for the small ones after it.
+		l.line = nil
+	}
+	l.line = l.line[:0]
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		if len(l.line)+len(chunk) > l.limit {
+			l.err = fmt.Errorf("%w: exceeds %d bytes", ErrLineTooLong, l.limit)
+			return false
+		}
+		l.line = append(l.line, chunk...)
+		switch {
+		case err == nil:
+			l.line = l.line[:len(l.line)-1]
+			if n := len(l.line); n > 0 && l.line[n-1] == '\r' {
+				l.line = l.line[:n-1]
+			}
+			return true
+		case errors.Is(err, bufio.ErrBufferFull):
+		case errors.Is(err, io.EOF):
+			l.err = io.EOF
+			return len(l.line) > 0
+		default:
+			l.err = err
+			return false
+		}
+	}
+}
+
+// Bytes returns the current line. It is overwritten by the next Scan.
+func (l *lineReader) Bytes() []byte { return l.line }
+
+func (l *lineReader) Text() string { return string(l.line) }
+
+// Err returns the error that stopped Scan, or nil at the end of the output.
+func (l *lineReader) Err() error {
+	if errors.Is(l.err, io.EOF) {
+		return nil
+	}
+	return l.err
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLineReaderReadsLinesPastTheBuffer(t *testing.T) {
+	big := `{"type":"user","content":"` + strings.Repeat("x", 3<<20) + `"}`
+	r := newLineReader(strings.NewReader("first\r\n" + big + "\n\nlast"))
+
+	var lines []string
+	for r.Scan() {
+		lines = append(lines, r.Text())
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if len(lines) != 4 || lines[0] != "first" || lines[1] != big || lines[2] != "" || lines[3] != "last" {
+		t.Fatalf("got %d lines, want first, the big one, an empty one and last", len(lines))
+	}
+}
+
+func TestLineReaderReportsLineTooLong(t *testing.T) {
+	r := newLineReader(strings.NewReader("ok\n" + strings.Repeat("x", 100) + "\nnever\n"))
+	r.limit = 64
+
+	if !r.Scan() || r.Text() != "ok" {
+		t.Fatalf("first line = %q", r.Text())
+	}
+	if r.Scan() {
+		t.Fatalf("Scan returned the oversized line %q", r.Text())
+	}
+	if err := r.Err(); !errors.Is(err, ErrLineTooLong) {
+		t.Fatalf("Err = %v, want ErrLineTooLong", err)
+	}
+	if r.Scan() {
+		t.Fatal("Scan continued after the error")
+	}
+}
+
+func TestOversizedLinesAreNotRetriedAsText(t *testing.T) {
+	adapter := &ClaudeAdapter{bin: "/nonexistent/claude", opts: ClaudeOptions{TextFallback: TextFallbackOn}}
+	streamErr := fmt.Errorf("claude stream output: %w: exceeds 268435456 bytes", ErrLineTooLong)
+	if _, ok, err := adapter.textFallback(context.Background(), "sonnet", "hi", streamErr); ok || err != streamErr {
+		t.Fatalf("textFallback = %v, %v; want the stream's error without a rerun", ok, err)
+	}
+	if class := ClassifyError(streamErr, ""); class != ErrorOutputTooLarge {
+		t.Fatalf("ClassifyError = %q, want %q", class, ErrorOutputTooLarge)
+	}
+}
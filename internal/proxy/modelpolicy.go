@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+)
+
+// ModelNotAllowedError is returned by Resolve when the request's model policy
+// (see WithModelPolicy) refuses one of the models it would run.
+type ModelNotAllowedError struct {
+	Model string
+}
+
+func (e *ModelNotAllowedError) Error() string {
+	return fmt.Sprintf("model %q is not allowed", e.Model)
+}
+
+type modelPolicyKey struct{}
+
+// WithModelPolicy makes Resolve refuse, with a ModelNotAllowedError, every
+// model allow rejects: the requested ID and whatever it expands to, such as a
+// backend prefix's bare ID, an alias's base, the auto default, race legs,
+// virtual model bases and pipeline steps. A nil allow leaves ctx untouched.
+func WithModelPolicy(ctx context.Context, allow func(model string) bool) context.Context {
+	if allow == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, modelPolicyKey{}, allow)
+}
+
+// checkModel returns a ModelNotAllowedError when ctx's policy refuses model.
+func checkModel(ctx context.Context, model string) error {
+	if allow, _ := ctx.Value(modelPolicyKey{}).(func(string) bool); allow != nil && !allow(model) {
+		return &ModelNotAllowedError{Model: model}
+	}
+	return nil
+}
+
+// aliaser is implemented by adapters with model IDs that run another model.
+type aliaser interface {
+	// BaseModel returns the model an alias runs, or "" for other IDs.
+	BaseModel(model string) string
+}
+
+// checkAlias checks the base model when adapter runs model as an alias.
+func checkAlias(ctx context.Context, adapter Adapter, model string) error {
+	if a, ok := adapter.(aliaser); ok {
+		if base := a.BaseModel(model); base != "" {
+			return checkModel(ctx, base)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// networkCheckTimeout bounds each connectivity check.
+const networkCheckTimeout = 10 * time.Second
+
+// networkCheckTTL is how long CheckNetwork answers with its last results:
+// each check is a request to every backend's API, which a monitor polling
+// the health endpoint should not send on every poll.
+const networkCheckTTL = 30 * time.Second
+
+// The APIs the CLIs talk to: Claude's unless ANTHROPIC_BASE_URL points it
+// elsewhere, and the ChatGPT backend Codex uses on a subscription.
+const (
+	claudeAPIEndpoint = "https://api.anthropic.com"
+	codexAPIEndpoint  = "https://chatgpt.com"
+)
+
+// NetworkInfo is whether a backend's CLI can reach its API, going through
+// the outbound proxy its environment sets, if any.
+type NetworkInfo struct {
+	Backend  Backend
+	Endpoint string
+	// Proxy is the proxy URL, credentials redacted, and ProxyEnv the
+	// variable it came from; both are empty for a direct connection.
+	Proxy    string
+	ProxyEnv string
+	Err      error
+	Latency  time.Duration
+}
+
+// NetworkChecker is implemented by adapters whose CLI calls an API.
+type NetworkChecker interface {
+	CheckNetwork(context.Context) NetworkInfo
+}
+
+// networkCache holds the last CheckNetwork results. Callers that come while
+// a check runs wait for its results rather than starting checks of their
+// own.
+type networkCache struct {
+	mu      sync.Mutex
+	infos   []NetworkInfo
+	checked time.Time
+}
+
+func (c *networkCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.infos, c.checked = nil, time.Time{}
+}
+
+// CheckNetwork checks, concurrently, that each backend's API answers from
+// here the way its CLI would connect. A CLI that cannot reach its API
+// fails every request with little more than "command failed", so this is
+// what tells a missing or wrong proxy setting apart from a broken CLI.
+// Results are reused for networkCheckTTL.
+func (r *Router) CheckNetwork(ctx context.Context) []NetworkInfo {
+	r.network.mu.Lock()
+	defer r.network.mu.Unlock()
+	if !r.network.checked.IsZero() && time.Since(r.network.checked) < networkCheckTTL {
+		return slices.Clone(r.network.infos)
+	}
+	// The results are shared, so they must not be cut short by the caller
+	// that happened to run the check going away.
+	infos := r.checkNetwork(context.WithoutCancel(ctx))
+	r.network.infos, r.network.checked = infos, time.Now()
+	return slices.Clone(infos)
+}
+
+func (r *Router) checkNetwork(ctx context.Context) []NetworkInfo {
+	claude, codex := r.adapters()
+	var checkers []NetworkChecker
+	for _, adapter := range []Adapter{claude, codex} {
+		if c, ok := adapter.(NetworkChecker); ok {
+			checkers = append(checkers, c)
+		}
+	}
+	out := make([]NetworkInfo, len(checkers))
+	var wg sync.WaitGroup
+	for i, c := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out[i] = c.CheckNetwork(ctx)
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+func (a *ClaudeAdapter) CheckNetwork(ctx context.Context) NetworkInfo {
+	env := append(os.Environ(), a.opts.Env...)
+	endpoint := lookupEnv(env, "ANTHROPIC_BASE_URL")
+	if endpoint == "" {
+		endpoint = claudeAPIEndpoint
+	}
+	return checkNetwork(ctx, BackendClaude, endpoint, env)
+}
+
+func (a *CodexAdapter) CheckNetwork(ctx context.Context) NetworkInfo {
+	return checkNetwork(ctx, BackendCodex, codexAPIEndpoint, append(os.Environ(), a.opts.Env...))
+}
+
+// checkNetwork sends a HEAD request to endpoint through the proxy env
+// sets for it. Any HTTP answer, whatever its status, counts as reachable.
+func checkNetwork(ctx context.Context, backend Backend, endpoint string, env []string) NetworkInfo {
+	info := NetworkInfo{Backend: backend, Endpoint: endpoint}
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		info.Err = err
+		return info
+	}
+	proxyURL, source, err := proxyFor(env, target)
+	if err != nil {
+		info.Err = fmt.Errorf("%s: %w", source, err)
+		return info
+	}
+	if proxyURL != nil {
+		info.Proxy, info.ProxyEnv = proxyURL.Redacted(), source
+	}
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+		Timeout:   networkCheckTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	defer client.CloseIdleConnections()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+	if err != nil {
+		info.Err = err
+		return info
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	info.Latency = time.Since(start)
+	if err != nil {
+		info.Err = networkError(backend, info, err)
+		return info
+	}
+	resp.Body.Close()
+	return info
+}
+
+// networkError says what a failed check points at.
+func networkError(backend Backend, info NetworkInfo, err error) error {
+	var unknownCA x509.UnknownAuthorityError
+	var verify *tls.CertificateVerificationError
+	if errors.As(err, &unknownCA) || errors.As(err, &verify) {
+		return fmt.Errorf("%w (a proxy that inspects TLS needs its CA certificate trusted: set NODE_EXTRA_CA_CERTS for claude, SSL_CERT_FILE for codex, in %s.env)", err, backend)
+	}
+	if info.Proxy != "" {
+		return fmt.Errorf("through proxy %s from %s: %w", info.Proxy, info.ProxyEnv, err)
+	}
+	return fmt.Errorf("%w (no proxy is set: behind one, set HTTPS_PROXY in %s.env)", err, backend)
+}
+
+// proxyFor returns the proxy a CLI running with env uses for target, as
+// curl and most HTTP clients pick it: HTTPS_PROXY or HTTP_PROXY by scheme,
+// then ALL_PROXY, the upper-case name first, unless NO_PROXY matches the
+// host. It also returns the variable the proxy came from.
+func proxyFor(env []string, target *url.URL) (*url.URL, string, error) {
+	if noProxy(firstEnv(env, "NO_PROXY", "no_proxy"), target.Hostname()) {
+		return nil, "", nil
+	}
+	names := []string{"ALL_PROXY", "all_proxy"}
+	if target.Scheme == "https" {
+		names = append([]string{"HTTPS_PROXY", "https_proxy"}, names...)
+	} else {
+		names = append([]string{"HTTP_PROXY", "http_proxy"}, names...)
+	}
+	for _, name := range names {
+		raw := lookupEnv(env, name)
+		if raw == "" {
+			continue
+		}
+		if !strings.Contains(raw, "://") {
+			raw = "http://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, name, fmt.Errorf("invalid proxy URL %q", lookupEnv(env, name))
+		}
+		return u, name, nil
+	}
+	return nil, "", nil
+}
+
+func firstEnv(env []string, names ...string) string {
+	for _, name := range names {
+		if v := lookupEnv(env, name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// noProxy reports whether list, a NO_PROXY value, exempts host: "*", the
+// host itself, or a domain it is in, with or without a leading dot.
+func noProxy(list, host string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		entry = strings.TrimPrefix(entry, ".")
+		switch {
+		case entry == "":
+		case entry == "*", host == entry, strings.HasSuffix(host, "."+entry):
+			return true
+		}
+	}
+	return false
+}
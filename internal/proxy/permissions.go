@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What to do when a CLI outside YOLO mode asks for permission to use a
+// tool. Nobody is there to answer, so either way the tool does not run.
+const (
+	// PermissionDeny refuses the tool and lets the agent carry on without it.
+	PermissionDeny = "deny"
+	// PermissionFail fails the request with a PermissionPromptError.
+	PermissionFail = "fail"
+)
+
+// defaultPermissionStall is how long a Claude run may sit silent after a
+// tool call before it counts as stuck on a permission prompt. Tools that
+// legitimately run longer need a higher StallTimeout.
+const defaultPermissionStall = 5 * time.Minute
+
+// PermissionPolicy handles the permission prompts of CLIs outside YOLO mode.
+// Codex asks over its app-server and is answered straight away; Claude has
+// no way to be answered, so a run that stalls after a tool call is stopped.
+type PermissionPolicy struct {
+	// OnPrompt is PermissionDeny (the default) or PermissionFail. Claude
+	// runs stuck on a prompt fail either way.
+	OnPrompt string
+	// StallTimeout is the silence after a tool call that makes a Claude
+	// run count as stuck; zero means defaultPermissionStall.
+	StallTimeout time.Duration
+}
+
+func (p PermissionPolicy) stallTimeout() time.Duration {
+	if p.StallTimeout > 0 {
+		return p.StallTimeout
+	}
+	return defaultPermissionStall
+}
+
+// PermissionPromptError is a request stopped because its CLI wanted
+// permission to use a tool.
+type PermissionPromptError struct {
+	Backend Backend
+	Tool    string
+	Detail  string
+}
+
+func (e *PermissionPromptError) Error() string {
+	tool := e.Tool
+	if tool == "" {
+		tool = "a tool"
+	}
+	return fmt.Sprintf("%s asked for permission to use %s (%s), which the proxy cannot grant outside YOLO mode; allow the tool in the CLI's settings or enable YOLO", e.Backend, tool, e.Detail)
+}
+
+// codexApprovalMethods are the app-server requests asking to approve a
+// command or patch, with the reply that declines each.
+var codexApprovalMethods = map[string]map[string]any{
+	"item/commandExecution/requestApproval": {"decision": "decline"},
+	"item/fileChange/requestApproval":       {"decision": "decline"},
+	"execCommandApproval":                   {"decision": "denied"},
+	"applyPatchApproval":                    {"decision": "denied"},
+}
+
+// codexApprovalTool names what an approval request is for.
+func codexApprovalTool(msg codexRPCMessage) string {
+	var params struct {
+		Command json.RawMessage `json:"command"`
+		Reason  string          `json:"reason"`
+	}
+	_ = json.Unmarshal(msg.Params, &params)
+	switch msg.Method {
+	case "item/fileChange/requestApproval", "applyPatchApproval":
+		return "apply_patch"
+	}
+	var command string
+	if json.Unmarshal(params.Command, &command) != nil {
+		var argv []string
+		if json.Unmarshal(params.Command, &argv) == nil && len(argv) > 0 {
+			command = strings.Join(argv, " ")
+		}
+	}
+	if command == "" {
+		return "shell"
+	}
+	return fmt.Sprintf("shell (%s)", command)
+}
+
+// promptWatch stops a Claude run that made no progress after a tool call for
+// longer than the stall timeout: outside YOLO mode that is the CLI waiting
+// on a permission prompt nobody will answer. A nil watch does nothing.
+type promptWatch struct {
+	mu      sync.Mutex
+	tool    string
+	toolAt  time.Time
+	stalled *PermissionPromptError
+	done    chan struct{}
+}
+
+func (a *ClaudeAdapter) watchPrompts(ctx context.Context, cmd *exec.Cmd) *promptWatch {
+	if unguarded(SafetyFromContext(ctx)) {
+		return nil
+	}
+	timeout := a.opts.Permissions.stallTimeout()
+	w := &promptWatch{done: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+			w.mu.Lock()
+			stalled := !w.toolAt.IsZero() && time.Since(w.toolAt) >= timeout
+			if stalled {
+				w.stalled = &PermissionPromptError{
+					Backend: BackendClaude,
+					Tool:    w.tool,
+					Detail:  fmt.Sprintf("no output for %s after calling it", timeout),
+				}
+			}
+			w.mu.Unlock()
+			if stalled {
+				_ = killProcess(cmd)
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// line records the events parsed from a line of output. Lines without
+// events, such as the message_stop that follows a tool call, do not count
+// as progress.
+func (w *promptWatch) line(events []ResponseEvent) {
+	if w == nil || len(events) == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.toolAt = time.Time{}
+	for _, ev := range events {
+		if ev.Kind == ResponseEventToolCall && ev.Tool != nil {
+			w.tool, w.toolAt = ev.Tool.Name, time.Now()
+		}
+	}
+}
+
+// stop ends the watch and returns the error of a run it stopped.
+func (w *promptWatch) stop() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.done:
+	default:
+		close(w.done)
+	}
+	if w.stalled == nil {
+		return nil
+	}
+	return w.stalled
+}
@@ -0,0 +1,235 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BackendPipeline marks the virtual models served by a PipelineAdapter.
+const BackendPipeline Backend = "pipeline"
+
+// PipelineStep is one model of a pipeline. Prompt is what the step is sent
+// instead of the client's messages, with {{input}} replaced by the client's
+// prompt and {{draft}} by the previous step's answer. An empty Prompt sends
+// the first step the request as is and later steps DefaultRefinePrompt.
+type PipelineStep struct {
+	Model  string
+	Prompt string
+}
+
+// DefaultRefinePrompt is the Prompt of a pipeline step after the first that
+// has none.
+const DefaultRefinePrompt = "Here is a request and a draft answer to it.\n\nRequest:\n{{input}}\n\nDraft:\n{{draft}}\n\nImprove the draft: fix mistakes, fill gaps and tighten it. Reply with the improved answer only."
+
+// PipelineStage is a PipelineStep resolved to its adapter.
+type PipelineStage struct {
+	Adapter Adapter
+	Model   string
+	Prompt  string
+}
+
+// PipelineAdapter runs its stages one after another, each refining the
+// previous one's answer. Only the last stage's answer is the output; earlier
+// drafts are reported as reasoning, and streamed as reasoning events as they
+// come in.
+type PipelineAdapter struct {
+	id     string
+	stages []PipelineStage
+}
+
+func NewPipelineAdapter(id string, stages ...PipelineStage) *PipelineAdapter {
+	return &PipelineAdapter{id: id, stages: stages}
+}
+
+// SetPipelines replaces the pipeline models. Steps may use any model ID the
+// router resolves except another pipeline.
+func (r *Router) SetPipelines(pipelines map[string][]PipelineStep) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pipelines = pipelines
+}
+
+func (r *Router) pipelineModels() map[string][]PipelineStep {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pipelines
+}
+
+func (r *Router) resolvePipeline(ctx context.Context, id string, steps []PipelineStep) (Adapter, string, error) {
+	stages := make([]PipelineStage, 0, len(steps))
+	for _, step := range steps {
+		adapter, backendModel, err := r.Resolve(ctx, step.Model)
+		if err != nil {
+			return nil, "", fmt.Errorf("pipeline %s: %w", id, err)
+		}
+		stages = append(stages, PipelineStage{Adapter: adapter, Model: backendModel, Prompt: step.Prompt})
+	}
+	return NewPipelineAdapter(id, stages...), id, nil
+}
+
+// pipelineModelList lists the pipelines, warm when all their steps are.
+func pipelineModelList(pipelines map[string][]PipelineStep, warm map[string]bool) []Model {
+	ids := make([]string, 0, len(pipelines))
+	for id := range pipelines {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	out := make([]Model, 0, len(ids))
+	for _, id := range ids {
+		m := Model{ID: id, Backend: BackendPipeline, Warm: true}
+		for _, step := range pipelines[id] {
+			m.Warm = m.Warm && warm[step.Model]
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func (a *PipelineAdapter) ListModels(context.Context) ([]Model, error) {
+	return []Model{{ID: a.id, Backend: BackendPipeline}}, nil
+}
+
+func (a *PipelineAdapter) HealthCheck(ctx context.Context) error {
+	for _, st := range a.stages {
+		if err := st.Adapter.HealthCheck(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prompt renders stage i's prompt; ok is false when the stage gets the
+// client's request as is.
+func (a *PipelineAdapter) prompt(i int, input, draft string) (prompt string, ok bool) {
+	prompt = a.stages[i].Prompt
+	if prompt == "" {
+		if i == 0 {
+			return "", false
+		}
+		prompt = DefaultRefinePrompt
+	}
+	return strings.NewReplacer("{{input}}", input, "{{draft}}", draft).Replace(prompt), true
+}
+
+func (a *PipelineAdapter) chatRequest(i int, req ChatRequest, input, draft string) ChatRequest {
+	req.Model = a.stages[i].Model
+	if prompt, ok := a.prompt(i, input, draft); ok {
+		req.Messages = []Message{{Role: "user", Content: prompt}}
+	}
+	return req
+}
+
+func (a *PipelineAdapter) responsesRequest(i int, req ResponsesRequest, input, draft string) ResponsesRequest {
+	req.Model = a.stages[i].Model
+	// A session belongs to one stage, so pipelines always replay the
+	// transcript.
+	req.Continue = nil
+	if prompt, ok := a.prompt(i, input, draft); ok {
+		req.Input = prompt
+	}
+	return req
+}
+
+// draftHeading introduces a stage's draft in the reasoning.
+func (a *PipelineAdapter) draftHeading(i int) string {
+	heading := fmt.Sprintf("Step %d (%s):\n", i+1, a.stages[i].Model)
+	if i > 0 {
+		heading = "\n\n" + heading
+	}
+	return heading
+}
+
+// Chat runs the drafts and returns the last stage's answer. Chat responses
+// have no room for reasoning, so the drafts are not shown.
+func (a *PipelineAdapter) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	return a.ChatStream(ctx, req, nil)
+}
+
+func (a *PipelineAdapter) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (ChatResponse, error) {
+	input := buildChatPrompt(req.Messages)
+	var draft string
+	last := len(a.stages) - 1
+	for i := range last {
+		resp, err := a.stages[i].Adapter.Chat(ctx, a.chatRequest(i, req, input, draft))
+		if err != nil {
+			return ChatResponse{}, fmt.Errorf("pipeline %s step %d: %w", a.id, i+1, err)
+		}
+		draft = resp.Text
+	}
+	final := a.chatRequest(last, req, input, draft)
+	if onDelta == nil {
+		return a.stages[last].Adapter.Chat(ctx, final)
+	}
+	return a.stages[last].Adapter.ChatStream(ctx, final, onDelta)
+}
+
+func (a *PipelineAdapter) Respond(ctx context.Context, req ResponsesRequest) (ResponsesResponse, error) {
+	return a.RespondStreamEvents(ctx, req, nil)
+}
+
+func (a *PipelineAdapter) RespondStream(ctx context.Context, req ResponsesRequest, onDelta func(string) error) (ResponsesResponse, error) {
+	return a.RespondStreamEvents(ctx, req, func(ev ResponseEvent) error {
+		if ev.Kind != ResponseEventOutput {
+			return nil
+		}
+		return onDelta(ev.Delta)
+	})
+}
+
+// RespondStreamEvents streams each draft as reasoning while it is written,
+// then the last stage's events as they are.
+func (a *PipelineAdapter) RespondStreamEvents(ctx context.Context, req ResponsesRequest, onEvent func(ResponseEvent) error) (ResponsesResponse, error) {
+	emit := func(ev ResponseEvent) error {
+		if onEvent == nil || (ev.Delta == "" && ev.Kind != ResponseEventToolCall) {
+			return nil
+		}
+		return onEvent(ev)
+	}
+	input := buildResponsesPrompt(req.Input)
+	var draft string
+	var reasoning strings.Builder
+	last := len(a.stages) - 1
+	for i := range last {
+		heading := a.draftHeading(i)
+		reasoning.WriteString(heading)
+		if err := emit(ResponseEvent{Kind: ResponseEventReasoning, Delta: heading}); err != nil {
+			return ResponsesResponse{}, err
+		}
+		resp, err := respondEvents(ctx, a.stages[i].Adapter, a.responsesRequest(i, req, input, draft), func(ev ResponseEvent) error {
+			if ev.Kind != ResponseEventOutput {
+				return nil
+			}
+			return emit(ResponseEvent{Kind: ResponseEventReasoning, Delta: ev.Delta})
+		})
+		if err != nil {
+			return ResponsesResponse{}, fmt.Errorf("pipeline %s step %d: %w", a.id, i+1, err)
+		}
+		draft = resp.Text
+		reasoning.WriteString(draft)
+	}
+	if last > 0 {
+		reasoning.WriteString("\n\n")
+		if err := emit(ResponseEvent{Kind: ResponseEventReasoning, Delta: "\n\n"}); err != nil {
+			return ResponsesResponse{}, err
+		}
+	}
+	resp, err := respondEvents(ctx, a.stages[last].Adapter, a.responsesRequest(last, req, input, draft), emit)
+	if err != nil {
+		return resp, err
+	}
+	resp.Reasoning = reasoning.String() + resp.Reasoning
+	return resp, nil
+}
+
+// respondEvents runs req on adapter, streaming its events when it has them
+// and its output deltas otherwise.
+func respondEvents(ctx context.Context, adapter Adapter, req ResponsesRequest, onEvent func(ResponseEvent) error) (ResponsesResponse, error) {
+	if ea, ok := adapter.(ResponsesEventAdapter); ok {
+		return ea.RespondStreamEvents(ctx, req, onEvent)
+	}
+	return adapter.RespondStream(ctx, req, func(delta string) error {
+		return onEvent(ResponseEvent{Kind: ResponseEventOutput, Delta: delta})
+	})
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// echoTestAdapter answers every request for model with reply and records
+// the prompts it was sent.
+type echoTestAdapter struct {
+	model   string
+	reply   string
+	prompts []string
+}
+
+func (a *echoTestAdapter) SupportsModel(_ context.Context, model string) (bool, error) {
+	return model == a.model, nil
+}
+
+func (a *echoTestAdapter) ListModels(context.Context) ([]Model, error) {
+	return []Model{{ID: a.model, Backend: BackendClaude}}, nil
+}
+
+func (a *echoTestAdapter) HealthCheck(context.Context) error { return nil }
+
+func (a *echoTestAdapter) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	return a.ChatStream(ctx, req, func(string) error { return nil })
+}
+
+func (a *echoTestAdapter) ChatStream(_ context.Context, req ChatRequest, onDelta func(string) error) (ChatResponse, error) {
+	a.prompts = append(a.prompts, buildChatPrompt(req.Messages))
+	return ChatResponse{Model: req.Model, Text: a.reply}, onDelta(a.reply)
+}
+
+func (a *echoTestAdapter) Respond(ctx context.Context, req ResponsesRequest) (ResponsesResponse, error) {
+	return a.RespondStream(ctx, req, func(string) error { return nil })
+}
+
+func (a *echoTestAdapter) RespondStream(_ context.Context, req ResponsesRequest, onDelta func(string) error) (ResponsesResponse, error) {
+	a.prompts = append(a.prompts, buildResponsesPrompt(req.Input))
+	return ResponsesResponse{Model: req.Model, Text: a.reply}, onDelta(a.reply)
+}
+
+func TestPipelineStreamsDraftsAsReasoning(t *testing.T) {
+	drafter := &echoTestAdapter{model: "haiku", reply: "rough draft"}
+	refiner := &echoTestAdapter{model: "gpt-5", reply: "polished"}
+	router := NewRouter(drafter, refiner)
+	router.SetPipelines(map[string][]PipelineStep{
+		"draft-refine": {{Model: "haiku"}, {Model: "gpt-5", Prompt: "Polish {{draft}} for {{input}}"}},
+	})
+
+	models, err := router.ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := models[len(models)-1]; last.ID != "draft-refine" || last.Backend != BackendPipeline {
+		t.Fatalf("expected draft-refine listed as a pipeline, got %+v", models)
+	}
+
+	adapter, _, err := router.Resolve(context.Background(), "draft-refine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reasoning, output strings.Builder
+	resp, err := adapter.(ResponsesEventAdapter).RespondStreamEvents(context.Background(), ResponsesRequest{Model: "draft-refine", Input: "hi"}, func(ev ResponseEvent) error {
+		if ev.Kind == ResponseEventReasoning {
+			reasoning.WriteString(ev.Delta)
+		} else {
+			output.WriteString(ev.Delta)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Step 1 (haiku):\nrough draft\n\n"; reasoning.String() != want || resp.Reasoning != want {
+		t.Fatalf("reasoning: streamed %q, returned %q, want %q", reasoning.String(), resp.Reasoning, want)
+	}
+	if output.String() != "polished" || resp.Text != "polished" {
+		t.Fatalf("output: streamed %q, returned %q", output.String(), resp.Text)
+	}
+	if drafter.prompts[0] != "hi" || refiner.prompts[0] != "Polish rough draft for hi" {
+		t.Fatalf("prompts: draft %q, refine %q", drafter.prompts, refiner.prompts)
+	}
+
+	output.Reset()
+	chat, err := adapter.ChatStream(context.Background(), ChatRequest{Model: "draft-refine", Messages: []Message{{Role: "user", Content: "hi"}}}, func(d string) error {
+		output.WriteString(d)
+		return nil
+	})
+	if err != nil || chat.Text != "polished" || output.String() != "polished" {
+		t.Fatalf("chat: streamed %q, got %+v, %v", output.String(), chat, err)
+	}
+	if got := refiner.prompts[1]; got != "[user] Polish rough draft for [user] hi" {
+		t.Fatalf("chat refine prompt = %q", got)
+	}
+}
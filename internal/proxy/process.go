@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// newCommand prepares a backend CLI invocation. Cancelling ctx stops the CLI
+// together with anything it started, which on Windows (where npm installs
+// the CLIs as .cmd shims running node) is more than the process itself.
+func newCommand(ctx context.Context, bin string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, resolveBin(bin), args...)
+	cmd.SysProcAttr = procAttr()
+	cmd.Cancel = func() error { return killProcess(cmd) }
+	return cmd
+}
+
+// startCommand starts cmd, holds it to the process limits and hands it to
+// the janitor. The limits are set before the CLI runs, by a wrapper that
+// execs it, so it and the helpers it spawns never run without them. A
+// started command must be waited for with waitCommand.
+func startCommand(cmd *exec.Cmd) error {
+	p := trackedProcess{Bin: cmd.Path}
+	if limits := processLimits.Load(); limits != nil && *limits != (ProcessLimits{}) && ProcessLimitsSupported {
+		p.limits = *limits
+		limitCommand(cmd, p.limits)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.PID, p.Started = cmd.Process.Pid, time.Now()
+	trackProcess(cmd, p)
+	return nil
+}
+
+// waitCommand waits for a command started with startCommand, then kills
+// whatever it left running behind it. A CLI the CPU time limit killed
+// fails with errCPUTimeLimit.
+func waitCommand(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	killGroup(cmd.Process.Pid)
+	p := untrackProcess(cmd)
+	if err != nil && cpuLimitKilled(cmd.ProcessState, p.limits) {
+		err = fmt.Errorf("%w: %w", err, errCPUTimeLimit)
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// procAttr puts each CLI in a process group of its own, so it can be killed
+// together with the tools and servers it starts.
+func procAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// batchShim is false: only Windows runs scripts through a shell that parses
+// their arguments again.
+func batchShim(string) bool { return false }
+
+// killGroup kills what is left of the process group a CLI led.
+func killGroup(pid int) {
+	_ = syscall.Kill(-pid, syscall.SIGKILL)
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// processCommandLine returns pid's command line, or "" when it cannot be
+// read.
+func processCommandLine(pid int) string {
+	if raw, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline"); err == nil {
+		return strings.TrimSpace(strings.ReplaceAll(string(raw), "\x00", " "))
+	}
+	out, err := exec.Command("ps", "-o", "command=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,53 @@
+//go:build windows
+
+package proxy
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// createNoWindow keeps console windows from flashing up for every CLI.
+const createNoWindow = 0x08000000
+
+func procAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: createNoWindow}
+}
+
+// killProcess ends the CLI's whole process tree with taskkill: killing just
+// the process would leave node running behind a .cmd shim.
+func killProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	kill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+	kill.SysProcAttr = procAttr()
+	if err := kill.Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+// batchShim reports whether path is a .cmd or .bat file. Windows runs those
+// through cmd.exe, which parses the arguments again, so `&` or `|` in an
+// argument would start commands of its own.
+func batchShim(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".cmd", ".bat":
+		return true
+	}
+	return false
+}
+
+// killGroup does nothing: killProcess already ends the whole tree, and a
+// CLI that exited on its own leaves no group behind to find.
+func killGroup(int) {}
+
+// processAlive and processCommandLine are not needed on Windows, where
+// RecoverProcesses leaves processes alone.
+func processAlive(int) bool { return false }
+
+func processCommandLine(int) string { return "" }
@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// quotaTTL is how long a fetched quota counts as fresh. Codex also pushes
+// updates during turns, which keep the cache fresh while there is traffic.
+const quotaTTL = 5 * time.Minute
+
+// quotaPollIdle is how long after its last turn a backend's quota is still
+// polled in the background; see PollQuotas.
+const quotaPollIdle = 15 * time.Minute
+
+// errQuotaIdle is the polled quota error of a backend that has had no
+// traffic to fetch it for.
+var errQuotaIdle = errors.New("not checked while the backend is idle")
+
+// errQuotaNotReported is the quota error of a backend whose CLI has no way
+// to report its remaining usage.
+var errQuotaNotReported = errors.New("not reported by the CLI")
+
+// QuotaWindow is one subscription usage window, e.g. the 5-hour limit.
+type QuotaWindow struct {
+	UsedPercent   float64
+	WindowMinutes int
+	ResetsAt      time.Time
+}
+
+// Quota is what a backend reported about its remaining subscription usage.
+type Quota struct {
+	Backend   Backend
+	Windows   []QuotaWindow
+	CheckedAt time.Time
+	Err       error
+}
+
+// QuotaReader is implemented by adapters that can report their remaining
+// subscription usage.
+type QuotaReader interface {
+	Quota(context.Context) Quota
+}
+
+// Quotas returns the usage reported by each backend, served from cache
+// while fresh.
+func (r *Router) Quotas(ctx context.Context) []Quota {
+	claude, codex := r.adapters()
+	var out []Quota
+	for _, adapter := range []Adapter{claude, codex} {
+		if q, ok := adapter.(QuotaReader); ok {
+			out = append(out, q.Quota(ctx))
+		}
+	}
+	return out
+}
+
+// quotaPoller is implemented by QuotaReaders that poll their quota in the
+// background differently from how they answer an explicit request.
+type quotaPoller interface {
+	pollQuota(context.Context) Quota
+}
+
+// PollQuotas is Quotas for background polling: a backend that has been
+// idle for quotaPollIdle reports what it last did rather than starting a
+// CLI just to be asked.
+func (r *Router) PollQuotas(ctx context.Context) []Quota {
+	claude, codex := r.adapters()
+	var out []Quota
+	for _, adapter := range []Adapter{claude, codex} {
+		switch q := adapter.(type) {
+		case quotaPoller:
+			out = append(out, q.pollQuota(ctx))
+		case QuotaReader:
+			out = append(out, q.Quota(ctx))
+		}
+	}
+	return out
+}
+
+// quotaCache holds the last quota a backend reported.
+type quotaCache struct {
+	mu    sync.Mutex
+	quota Quota
+}
+
+func (c *quotaCache) get(ctx context.Context, fetch func(context.Context) Quota) Quota {
+	c.mu.Lock()
+	q := c.quota
+	c.mu.Unlock()
+	if !q.CheckedAt.IsZero() && time.Since(q.CheckedAt) < quotaTTL {
+		return q
+	}
+	q = fetch(ctx)
+	c.set(q)
+	return q
+}
+
+// cached returns the last quota, however old.
+func (c *quotaCache) cached() Quota {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.quota
+}
+
+func (c *quotaCache) set(q Quota) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quota = q
+}
+
+// withCooldown reports a used-up window, until the last reset, for a backend
+// with models resting after hitting their usage limit, unless the CLI
+// reported its windows itself.
+func withCooldown(q Quota, c *cooldown) Quota {
+	rl := c.latest()
+	if len(q.Windows) > 0 || rl == nil {
+		return q
+	}
+	q.Err = nil
+	q.Windows = []QuotaWindow{{UsedPercent: 100, ResetsAt: rl.Reset}}
+	return q
+}
+
+// Quota reports the Claude subscription's usage. The CLI does not expose
+// it, so only a usage limit hit by a request shows.
+func (a *ClaudeAdapter) Quota(context.Context) Quota {
+	return withCooldown(Quota{Backend: BackendClaude, CheckedAt: time.Now(), Err: errQuotaNotReported}, &a.cooldown)
+}
+
+// Quota reports the ChatGPT subscription's usage windows, asking the
+// app-server through account/rateLimits/read when the cache is stale.
+func (a *CodexAdapter) Quota(ctx context.Context) Quota {
+	return withCooldown(a.quota.get(ctx, a.fetchQuota), &a.cooldown)
+}
+
+// pollQuota is Quota while Codex has had a turn within quotaPollIdle, and
+// the cached quota otherwise: fetching one takes an app-server, and while
+// turns run they push updates that keep the cache fresh anyway.
+func (a *CodexAdapter) pollQuota(ctx context.Context) Quota {
+	if a.warmth.active(quotaPollIdle) {
+		return a.Quota(ctx)
+	}
+	q := a.quota.cached()
+	if q.CheckedAt.IsZero() {
+		q = Quota{Backend: BackendCodex, Err: errQuotaIdle}
+	}
+	return withCooldown(q, &a.cooldown)
+}
+
+func (a *CodexAdapter) fetchQuota(ctx context.Context) Quota {
+	q := Quota{Backend: BackendCodex, CheckedAt: time.Now()}
+	if err := a.ensureSubscriptionMode(ctx); err != nil {
+		q.Err = err
+		return q
+	}
+	client, err := newCodexRPCClient(ctx, a.bin, a.opts.Env)
+	if err != nil {
+		q.Err = err
+		return q
+	}
+	defer client.stderr.attach(ctx)()
+	defer client.Close()
+	if err := a.initialize(ctx, client); err != nil {
+		q.Err = err
+		return q
+	}
+	var resp codexRateLimits
+	if err := client.call("account/rateLimits/read", map[string]any{}, &resp, nil); err != nil {
+		q.Err = err
+		return q
+	}
+	q.Windows = resp.windows()
+	return q
+}
+
+// observeQuota updates the cache from an account/rateLimits/updated
+// notification sent during a turn.
+func (a *CodexAdapter) observeQuota(params json.RawMessage) {
+	var payload codexRateLimits
+	if json.Unmarshal(params, &payload) != nil || payload.RateLimits == nil {
+		return
+	}
+	a.quota.set(Quota{Backend: BackendCodex, Windows: payload.windows(), CheckedAt: time.Now()})
+}
+
+type codexRateLimits struct {
+	RateLimits *struct {
+		Primary   *codexRateLimitWindow `json:"primary"`
+		Secondary *codexRateLimitWindow `json:"secondary"`
+	} `json:"rateLimits"`
+}
+
+type codexRateLimitWindow struct {
+	UsedPercent        float64 `json:"usedPercent"`
+	WindowDurationMins int     `json:"windowDurationMins"`
+	ResetsAt           int64   `json:"resetsAt"`
+}
+
+func (l codexRateLimits) windows() []QuotaWindow {
+	if l.RateLimits == nil {
+		return nil
+	}
+	var out []QuotaWindow
+	for _, w := range []*codexRateLimitWindow{l.RateLimits.Primary, l.RateLimits.Secondary} {
+		if w == nil {
+			continue
+		}
+		qw := QuotaWindow{UsedPercent: w.UsedPercent, WindowMinutes: w.WindowDurationMins}
+		if w.ResetsAt > 0 {
+			qw.ResetsAt = time.Unix(w.ResetsAt, 0)
+		}
+		out = append(out, qw)
+	}
+	return out
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCodexQuotaCachesTurnUpdates(t *testing.T) {
+	adapter := newFakeCodexAdapter(t,
+		codexNotification("account/rateLimits/updated", map[string]any{"rateLimits": map[string]any{
+			"primary":   map[string]any{"usedPercent": 42.5, "windowDurationMins": 300, "resetsAt": 1760799600},
+			"secondary": map[string]any{"usedPercent": 10, "windowDurationMins": 10080},
+		}}),
+		codexAgentDelta("Hello"),
+		codexNotification("turn/completed", map[string]any{}),
+	)
+	if _, err := adapter.Chat(context.Background(), ChatRequest{Model: "gpt-5", Messages: []Message{{Role: "user", Content: "hi"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(os.Getenv("LLM_PROXY_FAKE_CODEX_LOG")); err != nil {
+		t.Fatal(err)
+	}
+
+	q := adapter.Quota(context.Background())
+	if q.Err != nil || len(q.Windows) != 2 {
+		t.Fatalf("unexpected quota: %+v", q)
+	}
+	if w := q.Windows[0]; w.UsedPercent != 42.5 || w.WindowMinutes != 300 || !w.ResetsAt.Equal(time.Unix(1760799600, 0)) {
+		t.Fatalf("unexpected primary window: %+v", w)
+	}
+	if !q.Windows[1].ResetsAt.IsZero() {
+		t.Fatalf("expected no reset time for the secondary window: %+v", q.Windows[1])
+	}
+	if _, err := os.Stat(os.Getenv("LLM_PROXY_FAKE_CODEX_LOG")); !os.IsNotExist(err) {
+		t.Fatal("expected the cached quota to be served without an app-server")
+	}
+}
+
+func TestCodexQuotaIsNotPolledWhileIdle(t *testing.T) {
+	adapter := newFakeCodexAdapter(t,
+		codexNotification("account/rateLimits/updated", map[string]any{"rateLimits": map[string]any{
+			"primary": map[string]any{"usedPercent": 42.5, "windowDurationMins": 300},
+		}}),
+		codexAgentDelta("Hello"),
+		codexNotification("turn/completed", map[string]any{}),
+	)
+	router := NewRouter(NewClaudeAdapter(), adapter)
+	quotas := router.PollQuotas(context.Background())
+	if len(quotas) != 2 || quotas[1].Err != errQuotaIdle {
+		t.Fatalf("idle poll = %+v", quotas)
+	}
+	if _, err := os.Stat(os.Getenv("LLM_PROXY_FAKE_CODEX_LOG")); !os.IsNotExist(err) {
+		t.Fatal("polling an idle backend started an app-server")
+	}
+
+	if _, err := adapter.Chat(context.Background(), ChatRequest{Model: "gpt-5", Messages: []Message{{Role: "user", Content: "hi"}}}); err != nil {
+		t.Fatal(err)
+	}
+	adapter.warmth.last["gpt-5"] = time.Now().Add(-quotaPollIdle)
+	if q := router.PollQuotas(context.Background())[1]; q.Err != nil || len(q.Windows) != 1 || q.Windows[0].UsedPercent != 42.5 {
+		t.Fatalf("idle poll after a turn = %+v, want the quota the turn reported", q)
+	}
+}
+
+func TestClaudeQuotaShowsCooldown(t *testing.T) {
+	a := NewClaudeAdapter()
+	if q := a.Quota(context.Background()); q.Err == nil || len(q.Windows) != 0 {
+		t.Fatalf("expected no quota from the claude CLI, got %+v", q)
+	}
+	reset := time.Now().Add(time.Hour)
+	a.cooldown.models = map[string]*RateLimitError{"sonnet": {Backend: BackendClaude, Model: "sonnet", Reset: reset}}
+	q := a.Quota(context.Background())
+	if q.Err != nil || len(q.Windows) != 1 || q.Windows[0].UsedPercent != 100 || !q.Windows[0].ResetsAt.Equal(reset) {
+		t.Fatalf("expected a used-up window while cooling off, got %+v", q)
+	}
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// BackendRace marks the virtual models served by a RaceAdapter.
+const BackendRace Backend = "race"
+
+// RaceLeg is one contender of a race: an adapter and the model ID to send it.
+type RaceLeg struct {
+	Adapter Adapter
+	Model   string
+}
+
+// RaceAdapter sends every request to all of its legs at once. The first leg to
+// stream anything (or to finish, for non-streaming calls) wins; the others are
+// cancelled. A leg that fails before producing output drops out, and the race
+// only fails when every leg has.
+type RaceAdapter struct {
+	id   string
+	legs []RaceLeg
+	// onWin, if set, is told the index of each race's winning leg.
+	onWin func(leg int)
+}
+
+func NewRaceAdapter(id string, legs ...RaceLeg) *RaceAdapter {
+	return &RaceAdapter{id: id, legs: legs}
+}
+
+func (a *RaceAdapter) ListModels(context.Context) ([]Model, error) {
+	return []Model{{ID: a.id, Backend: BackendRace}}, nil
+}
+
+func (a *RaceAdapter) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	return raceLegs(ctx, a.legs, func(ctx context.Context, leg RaceLeg, _ func(struct{}) error) (ChatResponse, error) {
+		req := req
+		req.Model = leg.Model
+		return leg.Adapter.Chat(ctx, req)
+	}, nil, a.onWin)
+}
+
+func (a *RaceAdapter) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (ChatResponse, error) {
+	return raceLegs(ctx, a.legs, func(ctx context.Context, leg RaceLeg, emit func(string) error) (ChatResponse, error) {
+		req := req
+		req.Model = leg.Model
+		return leg.Adapter.ChatStream(ctx, req, emit)
+	}, onDelta, a.onWin)
+}
+
+func (a *RaceAdapter) Respond(ctx context.Context, req ResponsesRequest) (ResponsesResponse, error) {
+	// A session belongs to one leg, so races always replay the transcript.
+	req.Continue = nil
+	return raceLegs(ctx, a.legs, func(ctx context.Context, leg RaceLeg, _ func(struct{}) error) (ResponsesResponse, error) {
+		req := req
+		req.Model = leg.Model
+		return leg.Adapter.Respond(ctx, req)
+	}, nil, a.onWin)
+}
+
+func (a *RaceAdapter) RespondStream(ctx context.Context, req ResponsesRequest, onDelta func(string) error) (ResponsesResponse, error) {
+	req.Continue = nil
+	return raceLegs(ctx, a.legs, func(ctx context.Context, leg RaceLeg, emit func(string) error) (ResponsesResponse, error) {
+		req := req
+		req.Model = leg.Model
+		return leg.Adapter.RespondStream(ctx, req, emit)
+	}, onDelta, a.onWin)
+}
+
+func (a *RaceAdapter) RespondStreamEvents(ctx context.Context, req ResponsesRequest, onEvent func(ResponseEvent) error) (ResponsesResponse, error) {
+	req.Continue = nil
+	return raceLegs(ctx, a.legs, func(ctx context.Context, leg RaceLeg, emit func(ResponseEvent) error) (ResponsesResponse, error) {
+		req := req
+		req.Model = leg.Model
+		if ea, ok := leg.Adapter.(ResponsesEventAdapter); ok {
+			return ea.RespondStreamEvents(ctx, req, emit)
+		}
+		return leg.Adapter.RespondStream(ctx, req, func(delta string) error {
+			return emit(ResponseEvent{Kind: ResponseEventOutput, Delta: delta})
+		})
+	}, onEvent, a.onWin)
+}
+
+type raceResult[R any] struct {
+	leg int
+	res R
+	err error
+}
+
+// errRaceLost stops a leg that produced output after another leg had won.
+var errRaceLost = errors.New("race lost")
+
+// raceLegs runs run for every leg concurrently. The first leg to emit an event
+// claims the race and has its events passed to forward (which may be nil);
+// the other legs are cancelled and onWin (which may be nil) is told the winner.
+func raceLegs[E, R any](ctx context.Context, legs []RaceLeg, run func(context.Context, RaceLeg, func(E) error) (R, error), forward func(E) error, onWin func(int)) (R, error) {
+	var zero R
+	if len(legs) == 0 {
+		return zero, errors.New("race has no backends")
+	}
+	cancels := make([]context.CancelFunc, len(legs))
+	ctxs := make([]context.Context, len(legs))
+	for i := range legs {
+		ctxs[i], cancels[i] = context.WithCancel(ctx)
+	}
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	var mu sync.Mutex
+	winner := -1
+	// claim must be called with mu held.
+	claim := func(i int) bool {
+		if winner == -1 {
+			winner = i
+			for j, cancel := range cancels {
+				if j != i {
+					cancel()
+				}
+			}
+			if onWin != nil {
+				onWin(i)
+			}
+		}
+		return winner == i
+	}
+
+	results := make(chan raceResult[R], len(legs))
+	for i, leg := range legs {
+		go func() {
+			res, err := run(ctxs[i], leg, func(ev E) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if !claim(i) {
+					return errRaceLost
+				}
+				if forward == nil {
+					return nil
+				}
+				return forward(ev)
+			})
+			results <- raceResult[R]{leg: i, res: res, err: err}
+		}()
+	}
+
+	var errs []error
+	for range legs {
+		r := <-results
+		mu.Lock()
+		won := winner == r.leg || (winner == -1 && r.err == nil && claim(r.leg))
+		decided := winner != -1
+		mu.Unlock()
+		if won {
+			return r.res, r.err
+		}
+		if !decided {
+			errs = append(errs, fmt.Errorf("%s: %w", legs[r.leg].Model, r.err))
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	return zero, fmt.Errorf("all raced backends failed: %w", errors.Join(errs...))
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// raceTestAdapter streams its deltas after delay, or fails with err.
+type raceTestAdapter struct {
+	delay     time.Duration
+	deltas    []string
+	err       error
+	cancelled chan struct{}
+}
+
+func (a *raceTestAdapter) ListModels(context.Context) ([]Model, error) { return nil, nil }
+
+func (a *raceTestAdapter) HealthCheck(context.Context) error { return nil }
+
+func (a *raceTestAdapter) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	return a.ChatStream(ctx, req, func(string) error { return nil })
+}
+
+func (a *raceTestAdapter) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (ChatResponse, error) {
+	select {
+	case <-time.After(a.delay):
+	case <-ctx.Done():
+		if a.cancelled != nil {
+			close(a.cancelled)
+		}
+		return ChatResponse{}, ctx.Err()
+	}
+	if a.err != nil {
+		return ChatResponse{}, a.err
+	}
+	for _, d := range a.deltas {
+		if err := onDelta(d); err != nil {
+			return ChatResponse{}, err
+		}
+	}
+	return ChatResponse{Model: req.Model, Text: strings.Join(a.deltas, "")}, nil
+}
+
+func (a *raceTestAdapter) Respond(context.Context, ResponsesRequest) (ResponsesResponse, error) {
+	return ResponsesResponse{}, errors.New("not implemented")
+}
+
+func (a *raceTestAdapter) RespondStream(context.Context, ResponsesRequest, func(string) error) (ResponsesResponse, error) {
+	return ResponsesResponse{}, errors.New("not implemented")
+}
+
+func TestRaceStreamsFirstBackendAndCancelsTheOther(t *testing.T) {
+	slow := &raceTestAdapter{delay: time.Minute, deltas: []string{"slow"}, cancelled: make(chan struct{})}
+	fast := &raceTestAdapter{delay: 10 * time.Millisecond, deltas: []string{"fa", "st"}}
+	race := NewRaceAdapter("quick", RaceLeg{Adapter: slow, Model: "opus"}, RaceLeg{Adapter: fast, Model: "gpt-5"})
+
+	var got strings.Builder
+	resp, err := race.ChatStream(context.Background(), ChatRequest{Model: "quick"}, func(d string) error {
+		got.WriteString(d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "fast" || resp.Model != "gpt-5" {
+		t.Fatalf("expected fast backend to win, got %q from %q", got.String(), resp.Model)
+	}
+	select {
+	case <-slow.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected losing backend to be cancelled")
+	}
+}
+
+func TestRaceFallsBackWhenOneBackendFails(t *testing.T) {
+	broken := &raceTestAdapter{err: errors.New("not logged in")}
+	ok := &raceTestAdapter{delay: 20 * time.Millisecond, deltas: []string{"hi"}}
+	race := NewRaceAdapter("quick", RaceLeg{Adapter: broken, Model: "opus"}, RaceLeg{Adapter: ok, Model: "gpt-5"})
+
+	resp, err := race.Chat(context.Background(), ChatRequest{})
+	if err != nil || resp.Text != "hi" {
+		t.Fatalf("expected surviving backend's answer, got %q, %v", resp.Text, err)
+	}
+
+	race = NewRaceAdapter("quick", RaceLeg{Adapter: broken, Model: "opus"}, RaceLeg{Adapter: broken, Model: "gpt-5"})
+	if _, err := race.Chat(context.Background(), ChatRequest{}); err == nil || !strings.Contains(err.Error(), "all raced backends failed") {
+		t.Fatalf("expected combined failure, got %v", err)
+	}
+}
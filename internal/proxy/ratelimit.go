@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCooldown is how long a model rests after a usage-limit error that
+// did not say when the limit resets.
+const defaultCooldown = time.Minute
+
+// RateLimitError reports that a backend's subscription hit its usage limit
+// for Model. Until Reset, requests for that model fail fast with the same
+// error instead of starting the CLI.
+type RateLimitError struct {
+	Backend Backend
+	Model   string
+	Reset   time.Time
+	Err     error
+}
+
+func (e *RateLimitError) Error() string {
+	what := string(e.Backend)
+	if e.Model != "" {
+		what += " " + e.Model
+	}
+	return fmt.Sprintf("%s usage limit reached, resets at %s (in %s): %v",
+		what, e.Reset.Format(time.RFC3339), time.Until(e.Reset).Round(time.Second), e.Err)
+}
+
+func (e *RateLimitError) Unwrap() error { return e.Err }
+
+var (
+	// Claude: "Claude AI usage limit reached|1760000000".
+	resetEpochRe = regexp.MustCompile(`(?i)limit reached\|(\d{9,})`)
+	// Codex error payloads: "resets_in_seconds": 3600.
+	resetSecondsRe = regexp.MustCompile(`(?i)resets?_in_seconds"?\s*[:=]\s*(\d+)`)
+	// Codex: "try again in 2 hours 5 minutes".
+	resetInRe   = regexp.MustCompile(`(?i)try again in ((?:\d+\s*[a-z]+[\s,]*(?:and\s+)?)+)`)
+	resetPartRe = regexp.MustCompile(`(?i)(\d+)\s*(day|hour|hr|minute|min|second|sec)`)
+	// Claude: "resets 3pm (Europe/Berlin)"; Codex: "try again at 3:45 PM".
+	resetClockRe = regexp.MustCompile(`(?i)(?:resets?|try again)(?: at)? (\d{1,2})(?::(\d{2}))?\s*([ap]m)(?:\s*\(([^)]+)\))?`)
+)
+
+var resetUnits = map[string]time.Duration{
+	"day": 24 * time.Hour, "hour": time.Hour, "hr": time.Hour,
+	"minute": time.Minute, "min": time.Minute, "second": time.Second, "sec": time.Second,
+}
+
+// ParseRateLimitReset finds when a usage limit resets in a CLI's error text.
+func ParseRateLimitReset(text string, now time.Time) (time.Time, bool) {
+	if m := resetEpochRe.FindStringSubmatch(text); m != nil {
+		if sec, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+			return time.Unix(sec, 0), true
+		}
+	}
+	if m := resetSecondsRe.FindStringSubmatch(text); m != nil {
+		if sec, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+			return now.Add(time.Duration(sec) * time.Second), true
+		}
+	}
+	if m := resetInRe.FindStringSubmatch(text); m != nil {
+		var d time.Duration
+		for _, part := range resetPartRe.FindAllStringSubmatch(m[1], -1) {
+			n, _ := strconv.Atoi(part[1])
+			d += time.Duration(n) * resetUnits[strings.ToLower(part[2])]
+		}
+		if d > 0 {
+			return now.Add(d), true
+		}
+	}
+	if m := resetClockRe.FindStringSubmatch(text); m != nil {
+		loc := now.Location()
+		if m[4] != "" {
+			if l, err := time.LoadLocation(m[4]); err == nil {
+				loc = l
+			}
+		}
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour > 12 || minute > 59 {
+			return time.Time{}, false
+		}
+		hour %= 12
+		if strings.EqualFold(m[3], "pm") {
+			hour += 12
+		}
+		local := now.In(loc)
+		reset := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, loc)
+		if !reset.After(now) {
+			reset = reset.AddDate(0, 0, 1)
+		}
+		return reset, true
+	}
+	return time.Time{}, false
+}
+
+// reportedRateLimit tells whether err is a usage limit the CLI reported in
+// its structured output: an UpstreamError or Codex JSON-RPC error of a rate
+// limit type, or claude's "usage limit reached|<epoch>" result. Free text
+// that merely mentions a limit, such as a tool's output or a model's answer
+// echoed into an error, is not one.
+func reportedRateLimit(err error) bool {
+	if errorTypes[reportedErrorType(err)] == ErrorRateLimit {
+		return true
+	}
+	var upstream *UpstreamError
+	return errors.As(err, &upstream) && resetEpochRe.MatchString(upstream.Message)
+}
+
+// cooldown keeps the models that hit their usage limit out of service until
+// the limit resets.
+type cooldown struct {
+	mu     sync.Mutex
+	models map[string]*RateLimitError
+}
+
+// check returns the pending usage-limit error, if model is resting.
+func (c *cooldown) check(model string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rl := c.models[model]
+	if rl == nil {
+		return nil
+	}
+	if !rl.Reset.After(time.Now()) {
+		delete(c.models, model)
+		return nil
+	}
+	return rl
+}
+
+// latest returns the pending usage-limit error that resets last, if any
+// model is resting.
+func (c *cooldown) latest() *RateLimitError {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var latest *RateLimitError
+	now := time.Now()
+	for model, rl := range c.models {
+		if !rl.Reset.After(now) {
+			delete(c.models, model)
+			continue
+		}
+		if latest == nil || rl.Reset.After(latest.Reset) {
+			latest = rl
+		}
+	}
+	return latest
+}
+
+// observe turns a reported usage-limit failure of model into a
+// RateLimitError and starts its cooldown. Other errors are returned
+// unchanged.
+func (c *cooldown) observe(backend Backend, model string, err error) error {
+	if err == nil || !reportedRateLimit(err) {
+		return err
+	}
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		return err
+	}
+	now := time.Now()
+	reset, ok := ParseRateLimitReset(err.Error(), now)
+	if !ok || !reset.After(now) {
+		reset = now.Add(defaultCooldown)
+	}
+	rl = &RateLimitError{Backend: backend, Model: model, Reset: reset, Err: err}
+	c.mu.Lock()
+	if c.models == nil {
+		c.models = make(map[string]*RateLimitError)
+	}
+	c.models[model] = rl
+	c.mu.Unlock()
+	return rl
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitReset(t *testing.T) {
+	now := time.Date(2026, 10, 18, 13, 30, 0, 0, time.UTC)
+	cases := []struct {
+		text string
+		want time.Time
+	}{
+		{"Claude AI usage limit reached|1760799600", time.Unix(1760799600, 0)},
+		{`{"error":{"type":"usage_limit_reached","resets_in_seconds": 5400}}`, now.Add(90 * time.Minute)},
+		{"You've hit your usage limit. Upgrade to Pro, or try again in 2 hours 5 minutes.", now.Add(2*time.Hour + 5*time.Minute)},
+		{"You've hit your usage limit. Try again in 1 day, 3 hours.", now.Add(27 * time.Hour)},
+		{"5-hour limit reached ∙ resets 3pm", time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC)},
+		{"You've hit your usage limit. Try again at 9:15 AM.", time.Date(2026, 10, 19, 9, 15, 0, 0, time.UTC)},
+		{"Claude usage limit reached. Your limit will reset at 3pm (Europe/Berlin).", time.Date(2026, 10, 18, 13, 0, 0, 0, time.UTC).AddDate(0, 0, 1)},
+	}
+	for _, c := range cases {
+		got, ok := ParseRateLimitReset(c.text, now)
+		if !ok || !got.Equal(c.want) {
+			t.Errorf("ParseRateLimitReset(%q) = %v, %v; want %v", c.text, got, ok, c.want)
+		}
+	}
+	if _, ok := ParseRateLimitReset("usage limit reached", now); ok {
+		t.Error("expected no reset time without one in the text")
+	}
+}
+
+func TestCodexUsageLimitStartsCooldown(t *testing.T) {
+	adapter := newFakeCodexAdapter(t,
+		map[string]any{"method": "error", "params": map[string]any{
+			"error":     map[string]any{"message": "You've hit your usage limit. Try again in 2 hours.", "codexErrorInfo": "usageLimitExceeded"},
+			"willRetry": false,
+		}},
+		map[string]any{"method": "turn/completed", "params": map[string]any{"turn": map[string]any{"id": "turn-1", "status": "failed"}}},
+	)
+	req := ChatRequest{Model: "gpt-5", Messages: []Message{{Role: "user", Content: "hi"}}}
+
+	_, err := adapter.Chat(context.Background(), req)
+	var rl *RateLimitError
+	if !errors.As(err, &rl) {
+		t.Fatalf("expected a rate limit error, got %v", err)
+	}
+	if rl.Backend != BackendCodex || time.Until(rl.Reset) < 119*time.Minute {
+		t.Fatalf("unexpected cooldown: %s until %v", rl.Backend, rl.Reset)
+	}
+	if ClassifyError(err, "") != ErrorRateLimit {
+		t.Fatalf("expected the error to classify as a rate limit: %v", err)
+	}
+
+	if err := os.Remove(os.Getenv("LLM_PROXY_FAKE_CODEX_LOG")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := adapter.Chat(context.Background(), req); !errors.As(err, &rl) || !strings.Contains(err.Error(), "usage limit") {
+		t.Fatalf("expected the cooldown to fail fast, got %v", err)
+	}
+	if _, err := os.Stat(os.Getenv("LLM_PROXY_FAKE_CODEX_LOG")); !os.IsNotExist(err) {
+		t.Fatal("expected no app-server to start while cooling off")
+	}
+
+	other := ChatRequest{Model: "gpt-5-mini", Messages: req.Messages}
+	if _, err := adapter.Chat(context.Background(), other); errors.As(err, &rl) && rl.Model == "gpt-5" {
+		t.Fatalf("expected other models to keep running, got %v", err)
+	}
+	if _, err := os.Stat(os.Getenv("LLM_PROXY_FAKE_CODEX_LOG")); err != nil {
+		t.Fatal("expected an app-server for a model that is not cooling off")
+	}
+}
+
+func TestUnreportedUsageLimitTextStartsNoCooldown(t *testing.T) {
+	adapter := newFakeCodexAdapter(t,
+		map[string]any{"method": "error", "params": map[string]any{
+			"error":     map[string]any{"message": "tool output: rate limit reached, try again in 2 hours"},
+			"willRetry": false,
+		}},
+		map[string]any{"method": "turn/completed", "params": map[string]any{"turn": map[string]any{"id": "turn-1", "status": "failed"}}},
+	)
+	req := ChatRequest{Model: "gpt-5", Messages: []Message{{Role: "user", Content: "hi"}}}
+
+	_, err := adapter.Chat(context.Background(), req)
+	var rl *RateLimitError
+	if err == nil || errors.As(err, &rl) {
+		t.Fatalf("expected a plain turn failure, got %v", err)
+	}
+	if err := adapter.cooldown.check("gpt-5"); err != nil {
+		t.Fatalf("expected no cooldown, got %v", err)
+	}
+}
+
+func TestClaudeStreamReportsRateLimitErrors(t *testing.T) {
+	cases := []struct {
+		lines []string
+		want  bool
+	}{
+		{[]string{`{"type":"error","error":{"type":"rate_limit_error","message":"Number of requests has exceeded your rate limit"}}`}, true},
+		{[]string{`{"type":"stream_event","event":{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}}`}, true},
+		{[]string{`{"type":"assistant","message":{"content":[{"type":"text","text":"API Error"}]},"error":"rate_limit"}`}, true},
+		{[]string{`{"type":"result","subtype":"success","is_error":true,"result":"Claude AI usage limit reached|1760000000"}`}, true},
+		{[]string{`{"type":"result","subtype":"success","is_error":true,"result":"the page said: usage limit reached, try again in 2 hours"}`}, false},
+		{[]string{`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`}, false},
+	}
+	for _, c := range cases {
+		p := NewClaudeAdapter().streamParser()
+		for _, line := range c.lines {
+			p.parse(line)
+		}
+		reported := p.failure()
+		if reported == nil {
+			t.Fatalf("%s: expected a reported error", c.lines)
+		}
+		if got := reportedRateLimit(reported); got != c.want {
+			t.Errorf("%s: reportedRateLimit = %v, want %v", c.lines, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// ReplayEnv, when set to a dump file, makes the llm-proxy binary stand in for
+// the CLI that was dumped; see ServeReplay.
+const ReplayEnv = "LLM_PROXY_REPLAY"
+
+type upstreamDumpFile struct {
+	header  dumpHeader
+	records []dumpRecord
+}
+
+func readUpstreamDump(path string) (*upstreamDumpFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	var d upstreamDumpFile
+	if err := dec.Decode(&d.header); err != nil {
+		return nil, fmt.Errorf("%s: read header: %w", path, err)
+	}
+	if d.header.Backend != BackendClaude && d.header.Backend != BackendCodex {
+		return nil, fmt.Errorf("%s: not an upstream dump", path)
+	}
+	for {
+		var rec dumpRecord
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return &d, nil
+			}
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		d.records = append(d.records, rec)
+	}
+}
+
+// ReplayDump runs a dumped CLI session through the adapter's parsing again:
+// bin, normally the llm-proxy binary itself, is started with ReplayEnv set
+// and plays the recorded CLI back. Events are reported as the live request
+// saw them; Codex output is streamed per delta when streamOutput is set, as
+// for chat streams.
+func ReplayDump(ctx context.Context, path, bin string, streamOutput bool, onEvent func(ResponseEvent) error) (ResponsesResponse, error) {
+	d, err := readUpstreamDump(path)
+	if err != nil {
+		return ResponsesResponse{}, err
+	}
+	env := []string{ReplayEnv + "=" + path}
+	if d.header.Backend == BackendCodex {
+		a := NewCodexAdapterWithOptions(CodexOptions{Bin: bin, Env: env})
+		turn, err := a.runTurnStructured(ctx, "", "", "", "", onEvent, streamOutput)
+		if err != nil {
+			return ResponsesResponse{}, err
+		}
+		return ResponsesResponse{Text: turn.Output, Reasoning: turn.Reasoning, ThreadID: turn.ThreadID}, nil
+	}
+	a := NewClaudeAdapterWithOptions(ClaudeOptions{Bin: bin, Env: env})
+	if !slices.Contains(d.header.Args, "stream-json") {
+		text, err := a.runClaudeText(ctx, "", "")
+		if err == nil && onEvent != nil {
+			err = onEvent(ResponseEvent{Kind: ResponseEventOutput, Delta: text})
+		}
+		return ResponsesResponse{Text: text}, err
+	}
+	run, err := a.runClaudeStreamEvents(ctx, "", "", "", onEvent)
+	return ResponsesResponse{Text: run.text, Reasoning: run.reasoning, ThreadID: run.sessionID}, err
+}
+
+// ServeReplay plays back the CLI recorded in the dump at path on stdin and
+// stdout and returns the exit code. Claude's output is printed as recorded.
+// Codex requests are answered with what the app-server sent after the same
+// request in the recording, IDs rewritten to match.
+func ServeReplay(path string, stdin io.Reader, stdout, stderr io.Writer) int {
+	d, err := readUpstreamDump(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+	if d.header.Backend == BackendCodex {
+		replayCodex(d.records, stdin, out)
+		return 0
+	}
+	for _, rec := range d.records {
+		if rec.Stream == "stdout" {
+			fmt.Fprintln(out, rec.Line)
+		}
+		if rec.Exit != "" {
+			out.Flush()
+			fmt.Fprintln(stderr, rec.Exit)
+			return 1
+		}
+	}
+	return 0
+}
+
+type codexReplayExchange struct {
+	method  string
+	id      json.RawMessage
+	replies []string
+	used    bool
+}
+
+func replayCodex(records []dumpRecord, stdin io.Reader, out *bufio.Writer) {
+	var exchanges []*codexReplayExchange
+	for _, rec := range records {
+		switch rec.Stream {
+		case "stdin":
+			var req codexRPCMessage
+			_ = json.Unmarshal([]byte(rec.Line), &req)
+			exchanges = append(exchanges, &codexReplayExchange{method: req.Method, id: req.ID})
+		case "stdout":
+			if len(exchanges) > 0 {
+				last := exchanges[len(exchanges)-1]
+				last.replies = append(last.replies, rec.Line)
+			}
+		}
+	}
+
+	scanner := newLineReader(stdin)
+	for scanner.Scan() {
+		var req codexRPCMessage
+		if json.Unmarshal(scanner.Bytes(), &req) != nil {
+			continue
+		}
+		i := slices.IndexFunc(exchanges, func(ex *codexReplayExchange) bool {
+			return !ex.used && ex.method == req.Method
+		})
+		if i < 0 {
+			fmt.Fprintf(out, `{"id":%s,"result":{}}`+"\n", req.ID)
+			out.Flush()
+			continue
+		}
+		ex := exchanges[i]
+		ex.used = true
+		for _, line := range ex.replies {
+			fmt.Fprintln(out, rewriteReplyID(line, ex.id, req.ID))
+		}
+		out.Flush()
+	}
+}
+
+// rewriteReplyID points the reply to the recorded request at the replayed
+// one.
+func rewriteReplyID(line string, recorded, replayed json.RawMessage) string {
+	var msg map[string]json.RawMessage
+	if json.Unmarshal([]byte(line), &msg) != nil || string(msg["id"]) != string(recorded) {
+		return line
+	}
+	msg["id"] = replayed
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return line
+	}
+	return string(out)
+}
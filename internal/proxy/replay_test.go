@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"llm-proxy/internal/logfile"
+)
+
+// dumpedFile returns the only dump written to dir.
+func dumpedFile(t *testing.T, dir string) string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("dump files = %v, %v; want one", files, err)
+	}
+	return files[0]
+}
+
+func TestReplayCodexDump(t *testing.T) {
+	dir := t.TempDir()
+	SetUpstreamDumpDir(dir)
+	defer SetUpstreamDumpDir("")
+
+	adapter := newFakeCodexAdapter(t,
+		codexNotification("item/reasoning/summaryTextDelta", map[string]any{"delta": "thinking"}),
+		codexItem("item/started", "agentMessage"),
+		codexAgentDelta("Hello"),
+		codexAgentDelta(" world"),
+		codexItem("item/completed", "agentMessage"),
+		codexNotification("turn/completed", map[string]any{}),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	live, err := adapter.Respond(ctx, ResponsesRequest{Model: "gpt-5", Input: "hi"})
+	if err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+	path := dumpedFile(t, dir)
+	SetUpstreamDumpDir("")
+
+	var deltas []string
+	replayed, err := ReplayDump(ctx, path, os.Args[0], true, func(ev ResponseEvent) error {
+		if ev.Kind == ResponseEventOutput {
+			deltas = append(deltas, ev.Delta)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReplayDump: %v", err)
+	}
+	if replayed.Text != live.Text || replayed.Reasoning != live.Reasoning {
+		t.Fatalf("replayed = %q/%q, live = %q/%q", replayed.Text, replayed.Reasoning, live.Text, live.Reasoning)
+	}
+	if len(deltas) != 2 {
+		t.Fatalf("output deltas = %q, want the two recorded", deltas)
+	}
+}
+
+func TestReplayClaudeDump(t *testing.T) {
+	dir := t.TempDir()
+	SetUpstreamDumpDir(dir)
+	defer SetUpstreamDumpDir("")
+
+	adapter := newFakeClaudeAdapter(t,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Hmm."}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hi"}}}`,
+		`{"type":"assistant","message":{"content":[{"type":"thinking","thinking":"Hmm."},{"type":"text","text":"Hi"}]}}`,
+	)
+	live, err := adapter.RespondStreamEvents(context.Background(), ResponsesRequest{Model: "sonnet", Input: "hi"}, func(ResponseEvent) error { return nil })
+	if err != nil {
+		t.Fatalf("RespondStreamEvents: %v", err)
+	}
+	path := dumpedFile(t, dir)
+	SetUpstreamDumpDir("")
+	t.Setenv("LLM_PROXY_FAKE_CLAUDE_OUTPUT", "not what was recorded\n")
+
+	replayed, err := ReplayDump(context.Background(), path, os.Args[0], false, nil)
+	if err != nil {
+		t.Fatalf("ReplayDump: %v", err)
+	}
+	if replayed.Text != live.Text || replayed.Reasoning != live.Reasoning {
+		t.Fatalf("replayed = %q/%q, live = %q/%q", replayed.Text, replayed.Reasoning, live.Text, live.Reasoning)
+	}
+}
+
+func TestUpstreamDumpsStayWithinLimits(t *testing.T) {
+	dir := t.TempDir()
+	SetUpstreamDumpDir(dir)
+	defer SetUpstreamDumpDir("")
+	SetUpstreamDumpLimits(logfile.Limits{MaxFiles: 2})
+	defer SetUpstreamDumpLimits(logfile.Limits{})
+
+	other := filepath.Join(dir, "notes.jsonl")
+	if err := os.WriteFile(other, []byte("{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		openUpstreamDump(BackendClaude, []string{"-p"}).exit(nil)
+		time.Sleep(10 * time.Millisecond)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*-claude-*.jsonl"))
+	if len(files) != 2 {
+		t.Fatalf("expected the 2 newest dumps to be kept, got %v", files)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Fatalf("files that are not dumps must be left alone: %v", err)
+	}
+}
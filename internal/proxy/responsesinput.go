@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// buildResponsesPrompt renders a /v1/responses input as a transcript in
+// buildChatPrompt's "[role] text" form. Structured input is read item by
+// item: messages with their text parts, function calls and their outputs;
+// items it does not know are kept as JSON so nothing is silently dropped.
+func buildResponsesPrompt(input any) string {
+	switch v := input.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case []any:
+		var b strings.Builder
+		for _, item := range v {
+			role, text := responsesItemText(item)
+			if text == "" {
+				continue
+			}
+			b.WriteString("[")
+			b.WriteString(role)
+			b.WriteString("] ")
+			b.WriteString(text)
+			b.WriteString("\n")
+		}
+		return strings.TrimSpace(b.String())
+	default:
+		return marshalItem(v)
+	}
+}
+
+// responsesItemText returns the role an input item speaks as and its text.
+func responsesItemText(item any) (string, string) {
+	obj, ok := item.(map[string]any)
+	if !ok {
+		if s, ok := item.(string); ok {
+			return "user", strings.TrimSpace(s)
+		}
+		return "user", marshalItem(item)
+	}
+	typ, _ := obj["type"].(string)
+	switch typ {
+	case "", "message":
+		role, _ := obj["role"].(string)
+		if role == "" {
+			role = "user"
+		}
+		return role, contentText(obj["content"])
+	case "function_call", "custom_tool_call":
+		name, _ := obj["name"].(string)
+		args, _ := obj["arguments"].(string)
+		if args == "" {
+			args, _ = obj["input"].(string)
+		}
+		callID, _ := obj["call_id"].(string)
+		return "assistant", fmt.Sprintf("Called tool %s (call %s) with: %s", name, callID, args)
+	case "function_call_output", "custom_tool_call_output":
+		callID, _ := obj["call_id"].(string)
+		return "tool", fmt.Sprintf("Output of call %s: %s", callID, contentText(obj["output"]))
+	case "reasoning":
+		// The model's own reasoning from earlier turns: the CLIs keep theirs.
+		return "", ""
+	}
+	return "user", marshalItem(item)
+}
+
+// contentText flattens message content, a string or a list of parts.
+func contentText(content any) string {
+	switch v := content.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case []any:
+		var parts []string
+		for _, p := range v {
+			if text := partText(p); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return marshalItem(content)
+}
+
+func partText(part any) string {
+	obj, ok := part.(map[string]any)
+	if !ok {
+		if s, ok := part.(string); ok {
+			return strings.TrimSpace(s)
+		}
+		return marshalItem(part)
+	}
+	switch obj["type"] {
+	case "input_text", "output_text", "text", "summary_text":
+		s, _ := obj["text"].(string)
+		return strings.TrimSpace(s)
+	case "refusal":
+		s, _ := obj["refusal"].(string)
+		return "(refused) " + strings.TrimSpace(s)
+	case "input_image":
+		if url, _ := obj["image_url"].(string); url != "" && !strings.HasPrefix(url, "data:") {
+			return "[image: " + url + "]"
+		}
+		if id, _ := obj["file_id"].(string); id != "" {
+			return "[image: file " + id + "]"
+		}
+		return "[image attached inline; not available to this backend]"
+	case "input_file":
+		name, _ := obj["filename"].(string)
+		if name == "" {
+			name, _ = obj["file_id"].(string)
+		}
+		return "[file: " + name + "]"
+	}
+	return marshalItem(part)
+}
+
+func marshalItem(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
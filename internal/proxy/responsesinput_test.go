@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildResponsesPromptReadsInputItems(t *testing.T) {
+	var input any
+	err := json.Unmarshal([]byte(`[
+		{"role": "developer", "content": "Answer in French."},
+		{"type": "message", "role": "user", "content": [
+			{"type": "input_text", "text": "What is in this picture?"},
+			{"type": "input_image", "image_url": "https://example.com/cat.png"},
+			{"type": "input_image", "image_url": "data:image/png;base64,AAAA"}
+		]},
+		{"type": "reasoning", "summary": []},
+		{"type": "function_call", "call_id": "call_1", "name": "lookup", "arguments": "{\"q\":\"cat\"}"},
+		{"type": "function_call_output", "call_id": "call_1", "output": "a tabby"},
+		{"type": "message", "role": "assistant", "content": [{"type": "output_text", "text": "Un chat."}]},
+		{"type": "item_reference", "id": "msg_1"}
+	]`), &input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[developer] Answer in French.
+[user] What is in this picture?
+[image: https://example.com/cat.png]
+[image attached inline; not available to this backend]
+[assistant] Called tool lookup (call call_1) with: {"q":"cat"}
+[tool] Output of call call_1: a tabby
+[assistant] Un chat.
+[user] {"id":"msg_1","type":"item_reference"}`
+	if got := buildResponsesPrompt(input); got != want {
+		t.Fatalf("prompt:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := buildResponsesPrompt(" hello "); got != "hello" {
+		t.Fatalf("string input = %q", got)
+	}
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ProcessLimits caps the resources of each CLI process the proxy starts;
+// zero fields leave a limit alone. Memory is the process's private memory
+// (its heap, RLIMIT_DATA), as address-space limits break node. The limits
+// are enforced on Linux only; a CLI that runs into one fails with
+// ErrorResourceLimit.
+type ProcessLimits struct {
+	MemoryBytes uint64
+	CPUTime     time.Duration
+	OpenFiles   uint64
+}
+
+var processLimits atomic.Pointer[ProcessLimits]
+
+func SetProcessLimits(limits ProcessLimits) {
+	processLimits.Store(&limits)
+}
+
+// errCPUTimeLimit is what a CLI that the kernel killed for using up its CPU
+// time fails with: a kill says nothing of why, so it is told apart from
+// the proxy's own by the CPU time the CLI had used.
+var errCPUTimeLimit = errors.New("cpu time limit exceeded")
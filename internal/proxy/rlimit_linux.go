@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ProcessLimitsSupported reports whether SetProcessLimits is enforced.
+const ProcessLimitsSupported = true
+
+// limitedExecArg marks the proxy's own binary started as the wrapper that
+// sets the process limits on itself and then execs the CLI, which keeps
+// them, so the CLI runs under its limits from its first instruction.
+const limitedExecArg = "-llm-proxy-limited-exec"
+
+func init() {
+	if len(os.Args) > 1 && os.Args[1] == limitedExecArg {
+		execLimited(os.Args[2:])
+	}
+}
+
+// limitCommand makes cmd start through the limits wrapper.
+func limitCommand(cmd *exec.Cmd, limits ProcessLimits) {
+	secs := uint64((limits.CPUTime + time.Second - 1) / time.Second)
+	args := []string{cmd.Args[0], limitedExecArg,
+		strconv.FormatUint(limits.MemoryBytes, 10),
+		strconv.FormatUint(secs, 10),
+		strconv.FormatUint(limits.OpenFiles, 10),
+		cmd.Path}
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = append(args, cmd.Args...)
+}
+
+// execLimited is the wrapper: args are the memory, CPU seconds and open
+// files limits, the CLI's path and its argv. It does not return; a limit it
+// cannot set fails the CLI rather than letting it run without.
+func execLimited(args []string) {
+	err := errors.New("malformed arguments")
+	if len(args) >= 5 {
+		err = setProcessLimits(args[:3])
+		if err == nil {
+			err = syscall.Exec(args[3], args[4:], os.Environ())
+		}
+	}
+	fmt.Fprintf(os.Stderr, "llm-proxy: process limits: %v\n", err)
+	os.Exit(126)
+}
+
+func setProcessLimits(args []string) error {
+	var n [3]uint64
+	for i, arg := range args {
+		v, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return err
+		}
+		n[i] = v
+	}
+	memory, secs, files := n[0], n[1], n[2]
+	if memory > 0 {
+		if err := setrlimit(syscall.RLIMIT_DATA, memory, memory); err != nil {
+			return fmt.Errorf("memory: %w", err)
+		}
+	}
+	if secs > 0 {
+		// SIGXCPU at the soft limit ends the process; SIGKILL a second
+		// later ends one that ignores it.
+		if err := setrlimit(syscall.RLIMIT_CPU, secs, secs+1); err != nil {
+			return fmt.Errorf("cpu time: %w", err)
+		}
+	}
+	if files > 0 {
+		if err := setrlimit(syscall.RLIMIT_NOFILE, files, files); err != nil {
+			return fmt.Errorf("open files: %w", err)
+		}
+	}
+	return nil
+}
+
+// setrlimit goes through the syscall package, which then leaves the open
+// files limit alone when it execs the CLI instead of restoring the one the
+// proxy started with.
+func setrlimit(resource int, cur, max uint64) error {
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: cur, Max: max})
+}
+
+// cpuLimitKilled reports whether state is a CLI the SIGKILL at the hard
+// RLIMIT_CPU ended: killed, with the CPU time of the limit used up.
+func cpuLimitKilled(state *os.ProcessState, limits ProcessLimits) bool {
+	if limits.CPUTime <= 0 || state == nil {
+		return false
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() || status.Signal() != syscall.SIGKILL {
+		return false
+	}
+	return state.UserTime()+state.SystemTime() >= limits.CPUTime.Truncate(time.Second)
+}
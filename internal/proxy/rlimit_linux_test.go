@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestStartCommandAppliesProcessLimits(t *testing.T) {
+	t.Cleanup(func() { SetProcessLimits(ProcessLimits{}) })
+	SetProcessLimits(ProcessLimits{MemoryBytes: 512 << 20, CPUTime: 90 * time.Second, OpenFiles: 64})
+
+	// The CLI reads its own limits, so they must be in place before it
+	// runs, not set some time after it started.
+	cmd := newCommand(context.Background(), "cat", "/proc/self/limits")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := startCommand(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitCommand(cmd); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`Max cpu time\s+90\s+91\s`,
+		`Max data size\s+536870912\s+536870912\s`,
+		`Max open files\s+64\s+64\s`,
+	} {
+		if !regexp.MustCompile(want).Match(out.Bytes()) {
+			t.Errorf("limits lack %q:\n%s", want, out.Bytes())
+		}
+	}
+}
+
+func TestCPUTimeLimitKillIsAResourceLimit(t *testing.T) {
+	t.Cleanup(func() { SetProcessLimits(ProcessLimits{}) })
+	SetProcessLimits(ProcessLimits{CPUTime: time.Second})
+
+	// A CLI that ignores SIGXCPU runs on to the hard limit, where the
+	// kernel kills it.
+	cmd := newCommand(context.Background(), "sh", "-c", `trap "" XCPU; while :; do :; done`)
+	if err := startCommand(cmd); err != nil {
+		t.Fatal(err)
+	}
+	err := waitCommand(cmd)
+	if class := ClassifyError(err, ""); class != ErrorResourceLimit {
+		t.Fatalf("ClassifyError(%v) = %q, want %q", err, class, ErrorResourceLimit)
+	}
+
+	// A CLI the proxy kills is not.
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd = newCommand(ctx, "sleep", "10")
+	if err := startCommand(cmd); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := waitCommand(cmd); ClassifyError(err, "") == ErrorResourceLimit {
+		t.Fatalf("cancelled CLI classified as %q: %v", ErrorResourceLimit, err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package proxy
+
+import (
+	"os"
+	"os/exec"
+)
+
+// ProcessLimitsSupported reports whether SetProcessLimits is enforced.
+const ProcessLimitsSupported = false
+
+func limitCommand(*exec.Cmd, ProcessLimits) {}
+
+func cpuLimitKilled(*os.ProcessState, ProcessLimits) bool {
+	return false
+}
@@ -0,0 +1,261 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newPipeRPCClient returns a client talking to the test over pipes in place
+// of an app-server: requests are read from the returned scanner and replies
+// written to the returned writer.
+func newPipeRPCClient(t *testing.T) (*codexRPCClient, *bufio.Scanner, *io.PipeWriter) {
+	t.Helper()
+	reqR, reqW := io.Pipe()
+	outR, outW := io.Pipe()
+	t.Cleanup(func() {
+		reqR.Close()
+		outW.Close()
+	})
+	c := &codexRPCClient{stdin: bufio.NewWriter(reqW)}
+	c.serve(outR)
+	return c, bufio.NewScanner(reqR), outW
+}
+
+func readRPCRequest(t *testing.T, requests *bufio.Scanner) (id, method string) {
+	t.Helper()
+	if !requests.Scan() {
+		t.Fatalf("no request: %v", requests.Err())
+	}
+	var req struct {
+		ID     string `json:"id"`
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(requests.Bytes(), &req); err != nil {
+		t.Fatal(err)
+	}
+	return req.ID, req.Method
+}
+
+func TestCodexRPCRoutesRepliesOutOfOrder(t *testing.T) {
+	c, requests, out := newPipeRPCClient(t)
+
+	var wg sync.WaitGroup
+	results := map[string]string{}
+	var mu sync.Mutex
+	for _, method := range []string{"a", "b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var resp struct{ Method string }
+			if err := c.call(method, nil, &resp, nil); err != nil {
+				t.Errorf("call %s: %v", method, err)
+			}
+			mu.Lock()
+			results[method] = resp.Method
+			mu.Unlock()
+		}()
+	}
+	ids := map[string]string{}
+	for range 2 {
+		id, method := readRPCRequest(t, requests)
+		ids[method] = id
+	}
+	fmt.Fprintln(out, `{"method":"item/started","params":{}}`)
+	fmt.Fprintf(out, `{"id":%q,"result":{"method":"b"}}`+"\n", ids["b"])
+	fmt.Fprintf(out, `{"id":%q,"result":{"method":"a"}}`+"\n", ids["a"])
+	wg.Wait()
+
+	if results["a"] != "a" || results["b"] != "b" {
+		t.Fatalf("results = %v, want each call its own reply", results)
+	}
+	select {
+	case msg := <-c.msgs:
+		if msg.Method != "item/started" {
+			t.Fatalf("queued message = %q", msg.Method)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("notification received during the calls was dropped")
+	}
+}
+
+func TestCodexRPCCallTimesOut(t *testing.T) {
+	c, requests, out := newPipeRPCClient(t)
+	c.callTimeout = 50 * time.Millisecond
+
+	errc := make(chan error, 1)
+	go func() { errc <- c.call("slow", nil, nil, nil) }()
+	slowID, _ := readRPCRequest(t, requests)
+	err := <-errc
+	if !errors.Is(err, context.DeadlineExceeded) || ClassifyError(err, "") != ErrorTimeout {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+
+	// The late reply is dropped and the client keeps working.
+	go func() {
+		id, _ := readRPCRequest(t, requests)
+		fmt.Fprintf(out, `{"id":%q,"result":{}}`+"\n", slowID)
+		fmt.Fprintf(out, `{"id":%q,"result":{"ok":true}}`+"\n", id)
+	}()
+	c.callTimeout = time.Second
+	var resp struct{ OK bool }
+	if err := c.call("fast", nil, &resp, nil); err != nil || !resp.OK {
+		t.Fatalf("call after timeout = %+v, %v", resp, err)
+	}
+}
+
+func TestCodexRPCCallFailsWhenStreamEnds(t *testing.T) {
+	c, requests, out := newPipeRPCClient(t)
+
+	errc := make(chan error, 1)
+	go func() { errc <- c.call("never", nil, nil, nil) }()
+	readRPCRequest(t, requests)
+	out.Close()
+
+	select {
+	case err := <-errc:
+		if err == nil || !strings.Contains(err.Error(), "stream ended") {
+			t.Fatalf("err = %v, want stream ended", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("call still waiting after the stream ended")
+	}
+}
+
+func TestCodexSubscribeKeepsMessagesThatArrivedFirst(t *testing.T) {
+	c, requests, out := newPipeRPCClient(t)
+
+	go func() {
+		id, _ := readRPCRequest(t, requests)
+		fmt.Fprintf(out, `{"id":%q,"result":{"thread":{"id":"t1"}}}`+"\n", id)
+		fmt.Fprintln(out, `{"method":"thread/started","params":{"threadId":"t1"}}`)
+		fmt.Fprintln(out, `{"method":"item/started","params":{"threadId":"t2"}}`)
+		fmt.Fprintln(out, `{"method":"item/started","params":{"threadId":"t1"}}`)
+	}()
+	var resp struct {
+		Thread struct{ ID string }
+	}
+	if err := c.call("thread/start", nil, &resp, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Let the notifications reach msgs, one of them already on offer there,
+	// before the turn subscribes.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.inbox.mu.Lock()
+		n := len(c.inbox.queue)
+		if c.inbox.held {
+			n++
+		}
+		c.inbox.mu.Unlock()
+		if n == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d notifications queued, want 3", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	inbox := c.subscribe(resp.Thread.ID)
+	for _, want := range []string{"thread/started", "item/started"} {
+		select {
+		case msg := <-inbox.out:
+			if msg.Method != want || messageThread(msg) != "t1" {
+				t.Fatalf("thread message = %s on %q, want %s on t1", msg.Method, messageThread(msg), want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s sent before subscribing was lost", want)
+		}
+	}
+	select {
+	case msg := <-c.msgs:
+		if messageThread(msg) != "t2" {
+			t.Fatalf("msgs kept a message of %q", messageThread(msg))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message of another thread was taken")
+	}
+}
+
+func TestCodexConcurrentTurnsOnOneClientStayIsolated(t *testing.T) {
+	c, requests, out := newPipeRPCClient(t)
+	var writeMu sync.Mutex
+	send := func(v any) {
+		line, _ := json.Marshal(v)
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		fmt.Fprintf(out, "%s\n", line)
+	}
+	onThread := func(thread, method string, params map[string]any) {
+		params["threadId"] = thread
+		send(codexNotification(method, params))
+	}
+
+	// The fake app-server starts two threads, then interleaves the turns'
+	// notifications once both are running.
+	go func() {
+		threads, turns := 0, 0
+		for requests.Scan() {
+			var req struct {
+				ID     string `json:"id"`
+				Method string `json:"method"`
+			}
+			_ = json.Unmarshal(requests.Bytes(), &req)
+			switch req.Method {
+			case "thread/start":
+				threads++
+				send(map[string]any{"id": req.ID, "result": map[string]any{"thread": map[string]any{"id": fmt.Sprintf("thread-%d", threads)}}})
+			case "turn/start":
+				turns++
+				send(map[string]any{"id": req.ID, "result": map[string]any{"turn": map[string]any{"id": fmt.Sprintf("turn-%d", turns)}}})
+				if turns < 2 {
+					continue
+				}
+				for _, thread := range []string{"thread-1", "thread-2"} {
+					onThread(thread, "item/started", map[string]any{"item": map[string]any{"type": "agentMessage"}})
+				}
+				for i := range 3 {
+					onThread("thread-2", "item/agentMessage/delta", map[string]any{"delta": fmt.Sprintf("two%d ", i)})
+					onThread("thread-1", "item/agentMessage/delta", map[string]any{"delta": fmt.Sprintf("one%d ", i)})
+				}
+				send(codexNotification("account/rateLimits/updated", map[string]any{"rateLimits": map[string]any{"primary": map[string]any{"usedPercent": 10}}}))
+				onThread("thread-2", "turn/completed", map[string]any{"turn": map[string]any{"id": "turn-2"}})
+				onThread("thread-1", "turn/completed", map[string]any{"turn": map[string]any{"id": "turn-1"}})
+			}
+		}
+	}()
+
+	adapter := &CodexAdapter{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	outputs := make([]string, 2)
+	for i := range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			turn, err := adapter.runTurnOn(ctx, c, "gpt-5", CodexTurnOptions{}, "hi", nil, true)
+			if err != nil {
+				t.Errorf("turn %d: %v", i, err)
+			}
+			outputs[i] = turn.ThreadID + ": " + turn.Output
+		}()
+	}
+	wg.Wait()
+
+	got := map[string]bool{outputs[0]: true, outputs[1]: true}
+	if !got["thread-1: one0 one1 one2"] || !got["thread-2: two0 two1 two2"] {
+		t.Fatalf("outputs = %q, want each turn only its own thread's deltas", outputs)
+	}
+	if q := adapter.quota.quota; len(q.Windows) != 1 || q.Windows[0].UsedPercent != 10 {
+		t.Fatalf("quota = %+v, want the app-server-wide update seen", q)
+	}
+}
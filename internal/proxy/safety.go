@@ -0,0 +1,77 @@
+package proxy
+
+import "context"
+
+// Safety presets bound what the CLIs may do on the proxy's host for a
+// request. A request's preset replaces both YOLO and the configured Codex
+// sandbox and approval policy; requests without one keep those.
+const (
+	// SafetyReadOnly lets the CLIs read files but not edit them or run
+	// commands.
+	SafetyReadOnly = "read-only"
+	// SafetyWorkspaceWrite also lets them edit files. Codex runs commands
+	// in its workspace sandbox; Claude has no sandbox, so it runs none.
+	SafetyWorkspaceWrite = "workspace-write"
+	// SafetyFull lifts every restriction, as YOLO does.
+	SafetyFull = "full"
+)
+
+// claudeReadOnlyTools are the Claude tools that change files or run
+// commands.
+const claudeReadOnlyTools = "Bash,Edit,MultiEdit,Write,NotebookEdit"
+
+type safetyKey struct{}
+
+// WithSafety tags ctx with a safety preset. An empty preset leaves ctx
+// untouched.
+func WithSafety(ctx context.Context, preset string) context.Context {
+	if preset == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, safetyKey{}, preset)
+}
+
+// SafetyFromContext returns the preset set by WithSafety.
+func SafetyFromContext(ctx context.Context) string {
+	preset, _ := ctx.Value(safetyKey{}).(string)
+	return preset
+}
+
+// unguarded reports whether a request runs without permission checks: its
+// preset is SafetyFull, or it has none and YOLO is on.
+func unguarded(safety string) bool {
+	if safety == "" {
+		return YOLOEnabled()
+	}
+	return safety == SafetyFull
+}
+
+// claudeSafetyArgs are the flags that hold `claude -p` to a preset.
+func claudeSafetyArgs(safety string) []string {
+	switch safety {
+	case SafetyReadOnly:
+		return []string{"--permission-mode", "default", "--disallowedTools", claudeReadOnlyTools}
+	case SafetyWorkspaceWrite:
+		return []string{"--permission-mode", "acceptEdits", "--disallowedTools", "Bash"}
+	}
+	if unguarded(safety) {
+		return []string{"--dangerously-skip-permissions"}
+	}
+	return nil
+}
+
+// withSafety replaces the sandbox and approval policy with a preset's. The
+// CLI is never asked to approve anything: what the sandbox refuses fails.
+func (o CodexTurnOptions) withSafety(safety string) CodexTurnOptions {
+	switch safety {
+	case SafetyReadOnly, SafetyWorkspaceWrite:
+		o.Sandbox = safety
+	case SafetyFull:
+		o.Sandbox = "danger-full-access"
+	default:
+		return o
+	}
+	o.ApprovalPolicy = "never"
+	o.safety = safety
+	return o
+}
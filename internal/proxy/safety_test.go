@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClaudeSafetyPresetsReplaceYOLO(t *testing.T) {
+	prevYOLO := YOLOEnabled()
+	SetYOLO(true)
+	defer SetYOLO(prevYOLO)
+
+	a := NewClaudeAdapter()
+	for safety, want := range map[string]string{
+		"":                   "--model sonnet --dangerously-skip-permissions hi",
+		SafetyReadOnly:       "--model sonnet --permission-mode default --disallowedTools " + claudeReadOnlyTools + " hi",
+		SafetyWorkspaceWrite: "--model sonnet --permission-mode acceptEdits --disallowedTools Bash hi",
+		SafetyFull:           "--model sonnet --dangerously-skip-permissions hi",
+	} {
+		if got := strings.Join(a.cliArgs("sonnet", safety, "hi"), " "); !strings.HasSuffix(got, want) {
+			t.Errorf("safety %q: args = %q, want suffix %q", safety, got, want)
+		}
+	}
+	w := a.watchPrompts(WithSafety(context.Background(), SafetyReadOnly), nil)
+	if w == nil {
+		t.Fatal("expected a read-only run to watch for permission prompts under YOLO")
+	}
+	w.stop()
+}
+
+func TestCodexSafetyPresetOverridesConfiguredSandbox(t *testing.T) {
+	adapter := newFakeCodexAdapter(t,
+		codexAgentDelta("ok"),
+		codexItem("item/completed", "agentMessage"),
+		codexNotification("turn/completed", map[string]any{}),
+	)
+	adapter.opts = CodexOptions{CodexTurnOptions: CodexTurnOptions{Sandbox: "danger-full-access", ApprovalPolicy: "on-request"}}
+	prevYOLO := YOLOEnabled()
+	SetYOLO(true)
+	defer SetYOLO(prevYOLO)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx = WithSafety(ctx, SafetyReadOnly)
+	if _, err := adapter.Chat(ctx, ChatRequest{Model: "gpt-5", Messages: []Message{{Role: "user", Content: "hi"}}}); err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	thread := fakeCodexRequests(t)["thread/start"]
+	if thread["sandbox"] != "read-only" || thread["approvalPolicy"] != "never" {
+		t.Fatalf("unexpected thread/start params: %#v", thread)
+	}
+}
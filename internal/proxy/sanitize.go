@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// The CLIs write for a terminal: when they believe they are on one, or when
+// a tool run mid-turn is, their output can carry colors, cursor moves,
+// spinners redrawn with carriage returns and window titles. None of that
+// belongs in an API response, so the adapters pass what they answer, error
+// messages and captured stderr through sanitizeText or, for streams, an
+// outputSanitizer.
+
+// sanitizeText removes terminal escape sequences and control characters
+// other than newlines and tabs from s.
+func sanitizeText(s string) string {
+	return sanitizeChain().apply(s)
+}
+
+func sanitizeChain() filterChain {
+	return filterChain{&ansiFilter{}, &controlFilter{}}
+}
+
+// controlFilter removes C0 and C1 control characters and DEL, but newlines
+// and tabs. A carriage return stays when a newline follows, so CRLF line
+// ends are kept, and is dropped otherwise: a line a spinner redrew shows its
+// frames run together, never as a line that overwrites itself.
+type controlFilter struct {
+	// cr is set when the last write ended in a carriage return, which
+	// waits for the next one to tell whether a newline follows.
+	cr bool
+}
+
+func (f *controlFilter) write(s string) string {
+	if f.cr {
+		s, f.cr = "\r"+s, false
+	}
+	if strings.HasSuffix(s, "\r") {
+		s, f.cr = s[:len(s)-1], true
+	}
+	return stripControls(s)
+}
+
+// flush drops a carriage return the stream ended with.
+func (f *controlFilter) flush() string {
+	f.cr = false
+	return ""
+}
+
+func stripControls(s string) string {
+	clean := func(r rune) bool {
+		return r != '\n' && r != '\t' && (r < 0x20 || r == 0x7f || r >= 0x80 && r <= 0x9f)
+	}
+	if strings.IndexFunc(s, clean) < 0 {
+		return s
+	}
+	var out strings.Builder
+	for len(s) > 0 {
+		r, n := utf8.DecodeRuneInString(s)
+		if r == utf8.RuneError || !clean(r) || r == '\r' && strings.HasPrefix(s[n:], "\n") {
+			// Bytes that are not UTF-8 are kept as they are: the JSON
+			// encoder replaces them.
+			out.WriteString(s[:n])
+		}
+		s = s[n:]
+	}
+	return out.String()
+}
+
+// outputSanitizer sanitizes the output and reasoning deltas of one run. Each
+// kind has its own filters, so an escape sequence split across two deltas is
+// still removed whole.
+type outputSanitizer struct {
+	output, reasoning filterChain
+}
+
+func newOutputSanitizer() *outputSanitizer {
+	return &outputSanitizer{output: sanitizeChain(), reasoning: sanitizeChain()}
+}
+
+// event sanitizes ev's delta, returning false when nothing is left of it.
+// Tool calls pass as they are.
+func (s *outputSanitizer) event(ev ResponseEvent) (ResponseEvent, bool) {
+	switch ev.Kind {
+	case ResponseEventOutput:
+		ev.Delta = s.output.write(ev.Delta)
+	case ResponseEventReasoning:
+		ev.Delta = s.reasoning.write(ev.Delta)
+	default:
+		return ev, true
+	}
+	return ev, ev.Delta != ""
+}
+
+func (s *outputSanitizer) events(events []ResponseEvent) []ResponseEvent {
+	out := events[:0:0]
+	for _, ev := range events {
+		if ev, ok := s.event(ev); ok {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+// finish sanitizes the last events of a run and returns them with whatever
+// the filters still held.
+func (s *outputSanitizer) finish(events []ResponseEvent) []ResponseEvent {
+	out := s.events(events)
+	if d := s.reasoning.flush(); d != "" {
+		out = append(out, ResponseEvent{Kind: ResponseEventReasoning, Delta: d})
+	}
+	if d := s.output.flush(); d != "" {
+		out = append(out, ResponseEvent{Kind: ResponseEventOutput, Delta: d})
+	}
+	return out
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The fixtures in testdata/cli-noise are synthetic, written by hand rather
+// than captured from a CLI: they carry the kinds of terminal noise that can
+// surround an answer when a CLI or a tool it runs thinks it is on a
+// terminal, such as window titles, cursor and keyboard modes, colors,
+// hyperlinks, CRLF line ends, BEL and backspace.
+
+func TestSanitizeTextRemovesTerminalNoise(t *testing.T) {
+	raw, err := os.ReadFile("testdata/cli-noise/claude-text.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "● The build fails because `go vet` flags the copy.\r\n\r\n  ⎿  main.go:42\tcopies lock value\r\nFix: pass a pointer.\r\n"
+	if got := sanitizeText(string(raw)); got != want {
+		t.Fatalf("sanitizeText = %q, want %q", got, want)
+	}
+	for i := 1; i < len(raw); i++ {
+		clean := newOutputSanitizer()
+		var got strings.Builder
+		for _, ev := range clean.finish(clean.events([]ResponseEvent{
+			{Kind: ResponseEventOutput, Delta: string(raw[:i])},
+			{Kind: ResponseEventOutput, Delta: string(raw[i:])},
+		})) {
+			got.WriteString(ev.Delta)
+		}
+		if got.String() != want {
+			t.Fatalf("split at %d: %q, want %q", i, got.String(), want)
+		}
+	}
+	for _, s := range []string{"tabs\tand\nnewlines stay", "ünïcödé ✓ stays", "bad \xff bytes stay"} {
+		if got := sanitizeText(s); got != s {
+			t.Errorf("sanitizeText(%q) = %q", s, got)
+		}
+	}
+	if got := sanitizeText("nul\x00 del\x7f c1\u0085 ff\f"); got != "nul del c1 ff" {
+		t.Errorf("control characters kept: %q", got)
+	}
+	const spinner = "⠋ working\r⠙ working\rdone\r\nnext\r"
+	for i := 0; i <= len(spinner); i++ {
+		clean := newOutputSanitizer()
+		var got strings.Builder
+		for _, ev := range clean.finish(clean.events([]ResponseEvent{
+			{Kind: ResponseEventOutput, Delta: spinner[:i]},
+			{Kind: ResponseEventOutput, Delta: spinner[i:]},
+		})) {
+			got.WriteString(ev.Delta)
+		}
+		if want := "⠋ working⠙ workingdone\r\nnext"; got.String() != want {
+			t.Fatalf("split at %d: %q, want %q", i, got.String(), want)
+		}
+	}
+}
+
+func TestClaudeStreamSanitizesDeltas(t *testing.T) {
+	raw, err := os.ReadFile("testdata/cli-noise/claude-stream.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter := newFakeClaudeAdapter(t, strings.Split(strings.TrimSpace(string(raw)), "\n")...)
+
+	var deltas []string
+	resp, err := adapter.ChatStream(context.Background(), ChatRequest{Model: "sonnet", Messages: []Message{{Role: "user", Content: "hi"}}}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	want := "Run make test now.\r\nThen done."
+	if got := strings.Join(deltas, ""); got != want || resp.Text != want {
+		t.Fatalf("streamed %q, text %q; want %q", deltas, resp.Text, want)
+	}
+	assertNoControlEscapes(t, deltas)
+}
+
+func TestClaudeTextOutputIsSanitized(t *testing.T) {
+	raw, err := os.ReadFile("testdata/cli-noise/claude-text.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter := newFakeClaudeAdapter(t)
+	t.Setenv("LLM_PROXY_FAKE_CLAUDE_OUTPUT", string(raw))
+
+	out, err := adapter.runClaudeText(context.Background(), "sonnet", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "● The build fails") {
+		t.Fatalf("unexpected output %q", out)
+	}
+	assertNoControlEscapes(t, []string{out})
+}
+
+func TestCodexStreamSanitizesDeltas(t *testing.T) {
+	adapter := newFakeCodexAdapter(t,
+		codexNotification("item/reasoning/summaryTextDelta", map[string]any{"delta": "\x1b[2mchecking\x1b[0m"}),
+		codexItem("item/started", "agentMessage"),
+		codexAgentDelta("\x1b[1"),
+		codexAgentDelta("mDone\x1b[0m\r\n"),
+		codexAgentDelta("\x07ok"),
+		codexItem("item/completed", "agentMessage"),
+		codexNotification("turn/completed", map[string]any{}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var events []ResponseEvent
+	resp, err := adapter.RespondStreamEvents(ctx, ResponsesRequest{Model: "gpt-5", Input: "hi"}, func(ev ResponseEvent) error {
+		events = append(events, ev)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RespondStreamEvents: %v", err)
+	}
+	var output, reasoning []string
+	for _, ev := range events {
+		if ev.Kind == ResponseEventReasoning {
+			reasoning = append(reasoning, ev.Delta)
+		} else {
+			output = append(output, ev.Delta)
+		}
+	}
+	if got := strings.Join(output, ""); got != "Done\r\nok" || resp.Text != "Done\r\nok" {
+		t.Fatalf("streamed %q, text %q", output, resp.Text)
+	}
+	if got := strings.Join(reasoning, ""); got != "checking" || resp.Reasoning != "checking" {
+		t.Fatalf("reasoning %q, response reasoning %q", reasoning, resp.Reasoning)
+	}
+	assertNoControlEscapes(t, append(output, reasoning...))
+}
+
+// assertNoControlEscapes fails when the JSON encoding of any of texts has
+// to escape a control character other than the CR of a CRLF.
+func assertNoControlEscapes(t *testing.T, texts []string) {
+	t.Helper()
+	for _, s := range texts {
+		b, _ := json.Marshal(s)
+		if strings.Contains(string(b), `\u00`) || strings.Contains(strings.ReplaceAll(string(b), `\r\n`, ""), `\r`) {
+			t.Errorf("%s still carries control characters", b)
+		}
+	}
+}
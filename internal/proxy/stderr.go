@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// maxCapturedStderr bounds how much CLI stderr is kept per request; the tail
+// is kept since that is where failures are reported.
+const maxCapturedStderr = 8 << 10
+
+// StderrCapture collects the stderr of every CLI process started on behalf of
+// one request.
+type StderrCapture struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+type stderrCaptureKey struct{}
+
+// WithStderrCapture returns a context whose CLI processes copy their stderr
+// into the returned capture.
+func WithStderrCapture(ctx context.Context) (context.Context, *StderrCapture) {
+	c := &StderrCapture{}
+	return context.WithValue(ctx, stderrCaptureKey{}, c), c
+}
+
+// StderrFromContext returns the capture attached to ctx, or nil.
+func StderrFromContext(ctx context.Context) *StderrCapture {
+	c, _ := ctx.Value(stderrCaptureKey{}).(*StderrCapture)
+	return c
+}
+
+func (c *StderrCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = append(c.buf, p...)
+	if over := len(c.buf) - maxCapturedStderr; over > 0 {
+		c.buf = append(c.buf[:0], c.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the captured stderr, sanitized as CLI output is.
+func (c *StderrCapture) String() string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return sanitizeText(string(c.buf))
+}
+
+// stderrWriter tees w into the request's capture, if any.
+func stderrWriter(ctx context.Context, w io.Writer) io.Writer {
+	if c := StderrFromContext(ctx); c != nil {
+		return io.MultiWriter(w, c)
+	}
+	return w
+}
+
+// stderrFanout keeps the stderr of a process several requests may share and
+// copies it into the captures of the requests attached while it is written,
+// so each request sees only the diagnostics from its own time on the
+// process.
+type stderrFanout struct {
+	own StderrCapture
+
+	mu       sync.Mutex
+	captures map[*StderrCapture]int
+}
+
+func (f *stderrFanout) Write(p []byte) (int, error) {
+	_, _ = f.own.Write(p)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for c := range f.captures {
+		_, _ = c.Write(p)
+	}
+	return len(p), nil
+}
+
+// attach copies what is written from now on into the capture of ctx, if
+// any, until the returned func is called.
+func (f *stderrFanout) attach(ctx context.Context) func() {
+	c := StderrFromContext(ctx)
+	if c == nil {
+		return func() {}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.captures == nil {
+		f.captures = map[*StderrCapture]int{}
+	}
+	f.captures[c]++
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.captures[c]--; f.captures[c] == 0 {
+			delete(f.captures, c)
+		}
+	}
+}
+
+// String returns the process's stderr, sanitized as CLI output is.
+func (f *stderrFanout) String() string {
+	return f.own.String()
+}
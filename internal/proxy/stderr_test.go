@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStderrCaptureKeepsTail(t *testing.T) {
+	ctx, capture := WithStderrCapture(context.Background())
+	w := stderrWriter(ctx, &strings.Builder{})
+	_, _ = w.Write([]byte(strings.Repeat("a", maxCapturedStderr)))
+	_, _ = w.Write([]byte("tail"))
+
+	got := capture.String()
+	if len(got) != maxCapturedStderr {
+		t.Fatalf("expected %d bytes, got %d", maxCapturedStderr, len(got))
+	}
+	if !strings.HasSuffix(got, "tail") {
+		t.Fatalf("expected capture to keep the tail, got ...%q", got[len(got)-8:])
+	}
+	if StderrFromContext(context.Background()).String() != "" {
+		t.Fatal("expected empty string without a capture")
+	}
+}
+
+func TestStderrFanoutGoesToTheRequestsAttachedAtTheTime(t *testing.T) {
+	var f stderrFanout
+	ctx1, first := WithStderrCapture(context.Background())
+	ctx2, second := WithStderrCapture(context.Background())
+
+	detach1 := f.attach(ctx1)
+	_, _ = f.Write([]byte("one "))
+	detach2 := f.attach(ctx2)
+	_, _ = f.Write([]byte("both "))
+	detach1()
+	_, _ = f.Write([]byte("two"))
+	detach2()
+	_, _ = f.Write([]byte(" none"))
+
+	if got := first.String(); got != "one both " {
+		t.Fatalf("first request captured %q", got)
+	}
+	if got := second.String(); got != "both two" {
+		t.Fatalf("second request captured %q", got)
+	}
+	if got := f.String(); got != "one both two none" {
+		t.Fatalf("process stderr = %q", got)
+	}
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// conversationPinTTL is how long an idle conversation keeps its pins.
+	conversationPinTTL  = time.Hour
+	maxConversationPins = 10000
+)
+
+type conversationKey struct{}
+
+// WithConversation tags ctx with a client-supplied conversation ID. Requests
+// of one conversation to a virtual model (auto or a race) keep using the
+// model chosen for its first turn. An empty id leaves ctx untouched.
+func WithConversation(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, conversationKey{}, id)
+}
+
+// ConversationFromContext returns the conversation ID set by WithConversation.
+func ConversationFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(conversationKey{}).(string)
+	return id
+}
+
+type pinKey struct {
+	conversation string
+	model        string
+}
+
+type pin struct {
+	model    string
+	lastUsed time.Time
+}
+
+// PinStore persists conversation pins so they outlive the process; see
+// Router.SetPinStore.
+type PinStore interface {
+	Pin(conversation, virtual string) (string, bool, error)
+	SetPin(conversation, virtual, model string) error
+}
+
+// conversationPins remembers which concrete model a conversation was routed
+// to for each virtual model it used. With a store, pins are written through
+// and looked up there when they are not (or no longer) cached.
+type conversationPins struct {
+	mu    sync.Mutex
+	pins  map[pinKey]pin
+	store PinStore
+}
+
+func newConversationPins() *conversationPins {
+	return &conversationPins{pins: map[pinKey]pin{}}
+}
+
+func (p *conversationPins) get(ctx context.Context, virtual string) (string, bool) {
+	conv := ConversationFromContext(ctx)
+	if conv == "" {
+		return "", false
+	}
+	p.mu.Lock()
+	k := pinKey{conv, virtual}
+	v, ok := p.pins[k]
+	if ok && time.Since(v.lastUsed) <= conversationPinTTL {
+		v.lastUsed = time.Now()
+		p.pins[k] = v
+		p.mu.Unlock()
+		return v.model, true
+	}
+	delete(p.pins, k)
+	store := p.store
+	p.mu.Unlock()
+
+	if store == nil {
+		return "", false
+	}
+	model, ok, err := store.Pin(conv, virtual)
+	if err != nil {
+		log.Printf("conversation store: %v", err)
+		return "", false
+	}
+	if ok {
+		p.remember(k, model)
+	}
+	return model, ok
+}
+
+func (p *conversationPins) set(ctx context.Context, virtual, model string) {
+	conv := ConversationFromContext(ctx)
+	if conv == "" {
+		return
+	}
+	p.remember(pinKey{conv, virtual}, model)
+	p.mu.Lock()
+	store := p.store
+	p.mu.Unlock()
+	if store != nil {
+		if err := store.SetPin(conv, virtual, model); err != nil {
+			log.Printf("conversation store: %v", err)
+		}
+	}
+}
+
+func (p *conversationPins) remember(k pinKey, model string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.pins) >= maxConversationPins {
+		p.pruneLocked()
+	}
+	p.pins[k] = pin{model: model, lastUsed: time.Now()}
+}
+
+func (p *conversationPins) setStore(store PinStore) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.store = store
+}
+
+// pruneLocked drops expired pins, and the oldest ones if still full.
+func (p *conversationPins) pruneLocked() {
+	var oldest pinKey
+	var oldestAt time.Time
+	for k, v := range p.pins {
+		if time.Since(v.lastUsed) > conversationPinTTL {
+			delete(p.pins, k)
+			continue
+		}
+		if oldestAt.IsZero() || v.lastUsed.Before(oldestAt) {
+			oldest, oldestAt = k, v.lastUsed
+		}
+	}
+	if len(p.pins) >= maxConversationPins {
+		delete(p.pins, oldest)
+	}
+}
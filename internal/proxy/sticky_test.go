@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAutoRoutingSticksWithinConversation(t *testing.T) {
+	r := NewRouter(&raceTestAdapter{}, &raceTestAdapter{})
+	r.SetAutoPolicy(&AutoPolicy{Default: "haiku", Rules: []AutoRule{{Model: "opus", MinChars: 100}}})
+
+	short := ChatRequest{Model: AutoModel, Messages: []Message{{Role: "user", Content: "hi"}}}
+	long := ChatRequest{Model: AutoModel, Messages: []Message{{Role: "user", Content: strings.Repeat("x", 200)}}}
+
+	ctx := WithConversation(context.Background(), "c1")
+	if got := r.RouteChat(ctx, short); got != "haiku" {
+		t.Fatalf("first turn routed to %q", got)
+	}
+	if got := r.RouteChat(ctx, long); got != "haiku" {
+		t.Fatalf("expected conversation to stay on haiku, got %q", got)
+	}
+	if got := r.RouteChat(context.Background(), long); got != "opus" {
+		t.Fatalf("expected request without conversation to be routed freshly, got %q", got)
+	}
+}
+
+func TestRaceWinnerSticksWithinConversation(t *testing.T) {
+	fast := &raceTestAdapter{delay: 10 * time.Millisecond, deltas: []string{"claude"}}
+	slow := &raceTestAdapter{delay: 500 * time.Millisecond, deltas: []string{"codex"}}
+	r := NewRouter(fast, slow)
+	r.SetRaces(map[string][]string{"quick": {"claude/haiku", "codex/gpt-5"}})
+
+	ctx := WithConversation(context.Background(), "c1")
+	adapter, _, err := r.Resolve(ctx, "quick")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := adapter.Chat(ctx, ChatRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	adapter, model, err := r.Resolve(ctx, "quick")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adapter != fast || model != "haiku" {
+		t.Fatalf("expected pinned winner claude/haiku, got %T %q", adapter, model)
+	}
+}
+
+type memPinStore map[pinKey]string
+
+func (m memPinStore) Pin(conversation, virtual string) (string, bool, error) {
+	model, ok := m[pinKey{conversation, virtual}]
+	return model, ok, nil
+}
+
+func (m memPinStore) SetPin(conversation, virtual, model string) error {
+	m[pinKey{conversation, virtual}] = model
+	return nil
+}
+
+func TestPinsOutliveRouterWithStore(t *testing.T) {
+	store := memPinStore{}
+	policy := &AutoPolicy{Default: "haiku", Rules: []AutoRule{{Model: "opus", MinChars: 100}}}
+	long := ChatRequest{Model: AutoModel, Messages: []Message{{Role: "user", Content: strings.Repeat("x", 200)}}}
+	ctx := WithConversation(context.Background(), "c1")
+
+	r := NewRouter(&raceTestAdapter{}, &raceTestAdapter{})
+	r.SetAutoPolicy(policy)
+	r.SetPinStore(store)
+	if got := r.RouteChat(ctx, ChatRequest{Model: AutoModel}); got != "haiku" {
+		t.Fatalf("first turn routed to %q", got)
+	}
+
+	// A fresh router stands in for a restarted proxy.
+	r = NewRouter(&raceTestAdapter{}, &raceTestAdapter{})
+	r.SetAutoPolicy(policy)
+	r.SetPinStore(store)
+	if got := r.RouteChat(ctx, long); got != "haiku" {
+		t.Fatalf("expected stored pin haiku, got %q", got)
+	}
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// RequestTrace records what the adapters did while serving one request that
+// the response does not show, for metrics and the request log.
+type RequestTrace struct {
+	textFallbacks atomic.Int32
+
+	spawnNs     atomic.Int64
+	firstByteNs atomic.Int64
+	streamNs    atomic.Int64
+}
+
+type requestTraceKey struct{}
+
+// WithRequestTrace returns a context whose adapters record into the returned
+// trace.
+func WithRequestTrace(ctx context.Context) (context.Context, *RequestTrace) {
+	t := &RequestTrace{}
+	return context.WithValue(ctx, requestTraceKey{}, t), t
+}
+
+// TraceFromContext returns the trace attached to ctx, or nil.
+func TraceFromContext(ctx context.Context) *RequestTrace {
+	t, _ := ctx.Value(requestTraceKey{}).(*RequestTrace)
+	return t
+}
+
+func (t *RequestTrace) addTextFallback() {
+	if t != nil {
+		t.textFallbacks.Add(1)
+	}
+}
+
+// TextFallbacks is how many times a Claude stream was rerun as plain text.
+func (t *RequestTrace) TextFallbacks() int {
+	if t == nil {
+		return 0
+	}
+	return int(t.textFallbacks.Load())
+}
+
+// CLITimings splits the time a request spent in backend CLIs, summed over
+// every CLI run serving it (retries, text fallbacks, race entrants).
+type CLITimings struct {
+	// Spawn is starting the CLI until it is ready for the prompt: the
+	// process start (and with stream-json, Claude's init line), or Codex's
+	// app-server handshake and thread start.
+	Spawn time.Duration
+	// FirstByte is from then until the model's first output.
+	FirstByte time.Duration
+	// Stream is from the first output until the CLI finished.
+	Stream time.Duration
+}
+
+// Timings returns the CLI time recorded so far.
+func (t *RequestTrace) Timings() CLITimings {
+	if t == nil {
+		return CLITimings{}
+	}
+	return CLITimings{
+		Spawn:     time.Duration(t.spawnNs.Load()),
+		FirstByte: time.Duration(t.firstByteNs.Load()),
+		Stream:    time.Duration(t.streamNs.Load()),
+	}
+}
+
+func (t *RequestTrace) addSpawn(d time.Duration) {
+	if t != nil {
+		t.spawnNs.Add(int64(d))
+	}
+}
+
+// cliTimer times one CLI run into its request's trace. Repeated marks are
+// ignored, and a run that ends early counts the rest of its time in the
+// phase it was in.
+type cliTimer struct {
+	trace        *RequestTrace
+	start        time.Time
+	ready, first time.Time
+}
+
+func startCLITimer(ctx context.Context) *cliTimer {
+	return &cliTimer{trace: TraceFromContext(ctx), start: time.Now()}
+}
+
+// spawned marks the CLI ready for the prompt.
+func (c *cliTimer) spawned() {
+	if c.ready.IsZero() {
+		c.ready = time.Now()
+	}
+}
+
+// firstByte marks the model's first output.
+func (c *cliTimer) firstByte() {
+	c.spawned()
+	if c.first.IsZero() {
+		c.first = time.Now()
+	}
+}
+
+// done adds the run's phases to the trace.
+func (c *cliTimer) done() {
+	if c.trace == nil {
+		return
+	}
+	end := time.Now()
+	ready, first := c.ready, c.first
+	if ready.IsZero() {
+		ready = end
+	}
+	if first.IsZero() {
+		first = end
+	}
+	c.trace.spawnNs.Add(int64(ready.Sub(c.start)))
+	c.trace.firstByteNs.Add(int64(first.Sub(ready)))
+	c.trace.streamNs.Add(int64(end.Sub(first)))
+}
@@ -0,0 +1,27 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// IncompleteMaxTurns is the Incomplete reason of an answer cut short because
+// the agent used up its turn limit (Claude's --max-turns, or Codex's
+// max_turns tool calls).
+const IncompleteMaxTurns = "max_turns"
+
+// errTurnLimit is a plain-text Claude run stopped by --max-turns, which
+// exits with an error instead of an answer.
+var errTurnLimit = errors.New("agent turn limit reached")
+
+var claudeTurnLimitPattern = regexp.MustCompile(`(?i)reached max turns`)
+
+// turnLimitNotice is the answer of a run that hit its turn limit before
+// writing one, so clients show why it stopped instead of nothing.
+func turnLimitNotice(maxTurns int) string {
+	if maxTurns <= 0 {
+		return "Stopped: the agent reached its turn limit before finishing its answer."
+	}
+	return fmt.Sprintf("Stopped: the agent reached its limit of %d turns before finishing its answer.", maxTurns)
+}
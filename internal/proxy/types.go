@@ -12,6 +12,11 @@ const (
 type Model struct {
 	ID      string
 	Backend Backend
+	// Warm is set when the model started a turn within the last few
+	// minutes, so the next one skips the cold-start cost.
+	Warm bool
+	// Base is the model an alias or virtual model runs, if it is one.
+	Base string
 }
 
 type Message struct {
@@ -23,23 +28,54 @@ type ChatRequest struct {
 	Model    string
 	Messages []Message
 	Stream   bool
+	// ReasoningEffort is an optional hint for backends that support it.
+	ReasoningEffort string
 }
 
 type ChatResponse struct {
 	Model string
 	Text  string
+	// Incomplete is why the answer was cut short, as in ResponsesResponse.
+	Incomplete string
 }
 
 type ResponsesRequest struct {
 	Model  string
 	Input  any
 	Stream bool
+	// ReasoningEffort is an optional hint for backends that support it.
+	ReasoningEffort string
+	// Continue, when set, continues an earlier turn's upstream session
+	// instead of replaying Input as a new one.
+	Continue *Continuation
+}
+
+// Continuation is a follow-up to an earlier turn: ThreadID is the session
+// it ran in (its ResponsesResponse.ThreadID) and Input the items the client
+// sent since, such as tool outputs. Adapters that cannot resume the session
+// run the whole ResponsesRequest.Input instead.
+type Continuation struct {
+	ThreadID string
+	Input    any
 }
 
 type ResponsesResponse struct {
 	Model     string
 	Text      string
 	Reasoning string
+	// ThreadID is the Codex thread or Claude session that ran the turn.
+	ThreadID string
+	// Usage is the token usage the CLI reported, if it did.
+	Usage *Usage
+	// Incomplete says why the answer stopped short, e.g. "max_output_tokens".
+	Incomplete string
+}
+
+// Usage is a turn's token usage as reported by the backend.
+type Usage struct {
+	InputTokens       int
+	CachedInputTokens int
+	OutputTokens      int
 }
 
 type ResponseEventKind string
@@ -47,11 +83,22 @@ type ResponseEventKind string
 const (
 	ResponseEventReasoning ResponseEventKind = "reasoning"
 	ResponseEventOutput    ResponseEventKind = "output"
+	ResponseEventToolCall  ResponseEventKind = "tool_call"
 )
 
 type ResponseEvent struct {
 	Kind  ResponseEventKind
 	Delta string
+	// Tool is set for ResponseEventToolCall.
+	Tool *ToolCall
+}
+
+// ToolCall describes a tool the backend CLI ran on its own during a turn.
+// Arguments is a JSON object.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
 }
 
 type ResponsesEventAdapter interface {
@@ -64,4 +111,6 @@ type Adapter interface {
 	ChatStream(context.Context, ChatRequest, func(string) error) (ChatResponse, error)
 	Respond(context.Context, ResponsesRequest) (ResponsesResponse, error)
 	RespondStream(context.Context, ResponsesRequest, func(string) error) (ResponsesResponse, error)
+	// HealthCheck cheaply checks that the backend could serve a request now.
+	HealthCheck(context.Context) error
 }
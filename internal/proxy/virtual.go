@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// BackendVirtual marks the virtual models served by a VirtualAdapter.
+const BackendVirtual Backend = "virtual"
+
+// VirtualModel is a model ID that runs Base with a fixed system prompt and,
+// with MaxTokens set, an output cap: answers are cut off after about that
+// many tokens and reported as incomplete, as OpenAI does for max_tokens.
+type VirtualModel struct {
+	Base         string
+	SystemPrompt string
+	MaxTokens    int
+}
+
+// VirtualAdapter serves a virtual model by expanding its requests for the
+// adapter its base model resolved to.
+type VirtualAdapter struct {
+	id    string
+	model VirtualModel
+	base  Adapter
+}
+
+func NewVirtualAdapter(id string, model VirtualModel, base Adapter) *VirtualAdapter {
+	return &VirtualAdapter{id: id, model: model, base: base}
+}
+
+// SetVirtualModels replaces the virtual models. Their bases may be any model
+// ID the router resolves except another virtual model.
+func (r *Router) SetVirtualModels(models map[string]VirtualModel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.virtuals = models
+}
+
+func (r *Router) virtualModels() map[string]VirtualModel {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.virtuals
+}
+
+// virtualModelList lists the virtual models, as warm as their bases.
+func virtualModelList(models map[string]VirtualModel, warm map[string]bool) []Model {
+	ids := make([]string, 0, len(models))
+	for id := range models {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	out := make([]Model, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, Model{ID: id, Backend: BackendVirtual, Warm: warm[models[id].Base], Base: models[id].Base})
+	}
+	return out
+}
+
+func (a *VirtualAdapter) ListModels(context.Context) ([]Model, error) {
+	return []Model{{ID: a.id, Backend: BackendVirtual}}, nil
+}
+
+func (a *VirtualAdapter) HealthCheck(ctx context.Context) error {
+	return a.base.HealthCheck(ctx)
+}
+
+func (a *VirtualAdapter) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	req.Messages = a.chatMessages(req.Messages)
+	resp, err := a.base.Chat(ctx, req)
+	if err == nil && a.model.MaxTokens > 0 {
+		var cut bool
+		if resp.Text, cut = capText(resp.Text, a.model.MaxTokens); cut {
+			resp.Incomplete = incompleteMaxTokens
+		}
+	}
+	return resp, err
+}
+
+func (a *VirtualAdapter) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (ChatResponse, error) {
+	req.Messages = a.chatMessages(req.Messages)
+	ctx, capped := a.newCap(ctx)
+	if capped == nil {
+		return a.base.ChatStream(ctx, req, onDelta)
+	}
+	defer capped.cancel()
+	resp, err := a.base.ChatStream(ctx, req, capped.wrap(onDelta))
+	if capped.cut {
+		return ChatResponse{Model: req.Model, Text: capped.text(), Incomplete: incompleteMaxTokens}, nil
+	}
+	return resp, err
+}
+
+func (a *VirtualAdapter) Respond(ctx context.Context, req ResponsesRequest) (ResponsesResponse, error) {
+	req.Input = a.responsesInput(req)
+	resp, err := a.base.Respond(ctx, req)
+	if err == nil && a.model.MaxTokens > 0 {
+		var cut bool
+		if resp.Text, cut = capText(resp.Text, a.model.MaxTokens); cut {
+			resp.Incomplete = incompleteMaxTokens
+		}
+	}
+	return resp, err
+}
+
+func (a *VirtualAdapter) RespondStream(ctx context.Context, req ResponsesRequest, onDelta func(string) error) (ResponsesResponse, error) {
+	req.Input = a.responsesInput(req)
+	ctx, capped := a.newCap(ctx)
+	if capped == nil {
+		return a.base.RespondStream(ctx, req, onDelta)
+	}
+	defer capped.cancel()
+	resp, err := a.base.RespondStream(ctx, req, capped.wrap(onDelta))
+	if capped.cut {
+		return ResponsesResponse{Model: req.Model, Text: capped.text(), Incomplete: incompleteMaxTokens}, nil
+	}
+	return resp, err
+}
+
+func (a *VirtualAdapter) RespondStreamEvents(ctx context.Context, req ResponsesRequest, onEvent func(ResponseEvent) error) (ResponsesResponse, error) {
+	req.Input = a.responsesInput(req)
+	ctx, capped := a.newCap(ctx)
+	if capped == nil {
+		return respondEvents(ctx, a.base, req, onEvent)
+	}
+	defer capped.cancel()
+	forward := func(string) error { return nil }
+	if onEvent != nil {
+		forward = func(delta string) error {
+			return onEvent(ResponseEvent{Kind: ResponseEventOutput, Delta: delta})
+		}
+	}
+	output := capped.wrap(forward)
+	resp, err := respondEvents(ctx, a.base, req, func(ev ResponseEvent) error {
+		if ev.Kind == ResponseEventOutput {
+			return output(ev.Delta)
+		}
+		if onEvent == nil {
+			return nil
+		}
+		return onEvent(ev)
+	})
+	if capped.cut {
+		return ResponsesResponse{Model: req.Model, Text: capped.text(), Reasoning: resp.Reasoning, Incomplete: incompleteMaxTokens}, nil
+	}
+	return resp, err
+}
+
+// chatMessages puts the system prompt ahead of the client's messages.
+func (a *VirtualAdapter) chatMessages(messages []Message) []Message {
+	if a.model.SystemPrompt == "" {
+		return messages
+	}
+	return append([]Message{{Role: "system", Content: a.model.SystemPrompt}}, messages...)
+}
+
+// responsesInput puts the system prompt ahead of the input. A continued
+// session already had it with its first turn.
+func (a *VirtualAdapter) responsesInput(req ResponsesRequest) any {
+	if a.model.SystemPrompt == "" {
+		return req.Input
+	}
+	system := map[string]any{"role": "system", "content": a.model.SystemPrompt}
+	switch input := req.Input.(type) {
+	case string:
+		return []any{system, map[string]any{"role": "user", "content": input}}
+	case []any:
+		return append([]any{system}, input...)
+	}
+	return req.Input
+}
+
+// incompleteMaxTokens is the Incomplete reason for answers cut off by a
+// virtual model's MaxTokens.
+const incompleteMaxTokens = "max_output_tokens"
+
+// errOutputCapped stops a backend once a virtual model's answer reached its
+// MaxTokens.
+var errOutputCapped = errors.New("output reached max_tokens")
+
+// capText cuts text after about maxTokens tokens, at 4 characters a token
+// like the proxy's other estimates.
+func capText(text string, maxTokens int) (string, bool) {
+	runes := []rune(text)
+	if len(runes) <= maxTokens*4 {
+		return text, false
+	}
+	return string(runes[:maxTokens*4]), true
+}
+
+// outputCap passes streamed output through until MaxTokens is reached, then
+// stops the backend.
+type outputCap struct {
+	left   int // runes
+	out    []rune
+	cut    bool
+	cancel context.CancelFunc
+}
+
+// newCap returns a nil cap when the model has no MaxTokens.
+func (a *VirtualAdapter) newCap(ctx context.Context) (context.Context, *outputCap) {
+	if a.model.MaxTokens <= 0 {
+		return ctx, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, &outputCap{left: a.model.MaxTokens * 4, cancel: cancel}
+}
+
+func (c *outputCap) wrap(onDelta func(string) error) func(string) error {
+	return func(delta string) error {
+		if c.cut {
+			return errOutputCapped
+		}
+		runes := []rune(delta)
+		if len(runes) > c.left {
+			runes, c.cut = runes[:c.left], true
+		}
+		c.left -= len(runes)
+		c.out = append(c.out, runes...)
+		if len(runes) > 0 && onDelta != nil {
+			if err := onDelta(string(runes)); err != nil {
+				return err
+			}
+		}
+		if c.cut {
+			// The backend may retry on a failed stream; cancel so it
+			// gives up instead.
+			c.cancel()
+			return errOutputCapped
+		}
+		return nil
+	}
+}
+
+func (c *outputCap) text() string {
+	return string(c.out)
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// virtualTestAdapter streams deltas and records the requests it got.
+type virtualTestAdapter struct {
+	raceTestAdapter
+	model string
+	chats []ChatRequest
+}
+
+func (a *virtualTestAdapter) SupportsModel(_ context.Context, model string) (bool, error) {
+	return model == a.model, nil
+}
+
+func (a *virtualTestAdapter) ListModels(context.Context) ([]Model, error) {
+	return []Model{{ID: a.model, Backend: BackendClaude}}, nil
+}
+
+func (a *virtualTestAdapter) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (ChatResponse, error) {
+	a.chats = append(a.chats, req)
+	return a.raceTestAdapter.ChatStream(ctx, req, onDelta)
+}
+
+func (a *virtualTestAdapter) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	return a.ChatStream(ctx, req, func(string) error { return nil })
+}
+
+func TestVirtualModelAddsSystemPromptAndCapsOutput(t *testing.T) {
+	base := &virtualTestAdapter{model: "sonnet", raceTestAdapter: raceTestAdapter{deltas: []string{"abcdef", "ghijkl", "never sent"}}}
+	router := NewRouter(base, &virtualTestAdapter{model: "gpt-5"})
+	router.SetVirtualModels(map[string]VirtualModel{
+		"commit-writer": {Base: "sonnet", SystemPrompt: "Write a commit message.", MaxTokens: 2},
+	})
+
+	models, err := router.ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := models[len(models)-1]; last.ID != "commit-writer" || last.Backend != BackendVirtual {
+		t.Fatalf("expected commit-writer listed as virtual, got %+v", models)
+	}
+
+	adapter, backendModel, err := router.Resolve(context.Background(), "commit-writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backendModel != "sonnet" {
+		t.Fatalf("backend model = %q", backendModel)
+	}
+	var got strings.Builder
+	resp, err := adapter.ChatStream(context.Background(), ChatRequest{Model: backendModel, Messages: []Message{{Role: "user", Content: "diff"}}}, func(d string) error {
+		got.WriteString(d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "abcdefgh" || resp.Text != "abcdefgh" || resp.Incomplete != "max_output_tokens" {
+		t.Fatalf("expected output capped at 8 characters, streamed %q, got %+v", got.String(), resp)
+	}
+	if msgs := base.chats[0].Messages; len(msgs) != 2 || msgs[0].Role != "system" || msgs[0].Content != "Write a commit message." {
+		t.Fatalf("expected the system prompt first, got %+v", msgs)
+	}
+
+	resp, err = adapter.Chat(context.Background(), ChatRequest{Model: backendModel})
+	if err != nil || resp.Text != "abcdefgh" || resp.Incomplete != "max_output_tokens" {
+		t.Fatalf("Chat: %+v, %v", resp, err)
+	}
+}
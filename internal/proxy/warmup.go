@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+type WarmupState string
+
+const (
+	WarmupRunning WarmupState = "running"
+	WarmupReady   WarmupState = "ready"
+	WarmupFailed  WarmupState = "failed"
+)
+
+// WarmupStatus reports progress of one backend's warm-up.
+type WarmupStatus struct {
+	Backend  Backend
+	State    WarmupState
+	Err      error
+	Duration time.Duration
+}
+
+// Warmer is implemented by adapters that can pay their cold-start cost ahead
+// of the first request.
+type Warmer interface {
+	Warmup(context.Context) error
+}
+
+// Warmup warms both backends concurrently, reporting each state change, and
+// returns once both are done. Backends that cannot warm up are skipped.
+func (r *Router) Warmup(ctx context.Context, report func(WarmupStatus)) {
+	claude, codex := r.adapters()
+	var wg sync.WaitGroup
+	for backend, adapter := range map[Backend]Adapter{BackendClaude: claude, BackendCodex: codex} {
+		w, ok := adapter.(Warmer)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			report(WarmupStatus{Backend: backend, State: WarmupRunning})
+			err := w.Warmup(ctx)
+			status := WarmupStatus{Backend: backend, State: WarmupReady, Duration: time.Since(start)}
+			if err != nil {
+				status.State, status.Err = WarmupFailed, err
+			}
+			report(status)
+		}()
+	}
+	wg.Wait()
+}
+
+// warmupPrompt is the cheapest turn that still exercises login and model
+// startup.
+const warmupPrompt = "Reply with OK."
+
+// Warmup runs one trivial prompt, preferring the smallest model.
+func (a *ClaudeAdapter) Warmup(ctx context.Context) error {
+	if err := a.ensureSubscriptionMode(); err != nil {
+		return err
+	}
+	model := "haiku"
+	if ok, _ := a.SupportsModel(ctx, model); !ok && len(a.models) > 0 {
+		model = a.models[0]
+	}
+	_, err := a.runClaudeText(ctx, model, warmupPrompt)
+	return err
+}
+
+// Warmup checks the login, starts an app-server through initialize and
+// model/list, which loads the binary and its config and fills the model
+// cache, and keeps it for the first turn, which then skips the spawn.
+func (a *CodexAdapter) Warmup(ctx context.Context) error {
+	if err := a.ensureSubscriptionMode(ctx); err != nil {
+		return err
+	}
+	// The app-server outlives the warm-up, so it must not die with ctx.
+	client, err := newCodexRPCClient(context.WithoutCancel(ctx), a.bin, a.opts.Env)
+	if err != nil {
+		return err
+	}
+	if err := a.initialize(ctx, client); err != nil {
+		client.Close()
+		return err
+	}
+	models, err := listCodexModels(client)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	a.catalog.set(models)
+	a.spare.put(client)
+	return nil
+}
+
+// codexSpare holds an initialized app-server until a turn takes it, or
+// closes it after warmWindow: by then the warm-up no longer saves much.
+type codexSpare struct {
+	mu     sync.Mutex
+	client *codexRPCClient
+	timer  *time.Timer
+}
+
+func (s *codexSpare) put(client *codexRPCClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		s.timer.Stop()
+		s.client.Close()
+	}
+	s.client = client
+	s.timer = time.AfterFunc(warmWindow, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.client == client {
+			s.client = nil
+			client.Close()
+		}
+	})
+}
+
+// take returns the spare app-server when it is still running and was
+// started with args, or nil. Either way the spare is used up.
+func (s *codexSpare) take(args []string) *codexRPCClient {
+	s.mu.Lock()
+	client := s.client
+	s.client = nil
+	if client != nil {
+		s.timer.Stop()
+	}
+	s.mu.Unlock()
+	if client == nil {
+		return nil
+	}
+	select {
+	case <-client.done:
+		client.Close()
+		return nil
+	default:
+	}
+	if !slices.Equal(client.cmd.Args[1:], args) {
+		client.Close()
+		return nil
+	}
+	return client
+}
+
+// warmWindow is how long after a turn started its model counts as warm:
+// both providers keep prompt caches for about five minutes, and the CLI's
+// binary, config and login are still in memory, so the next turn starts
+// faster than a cold one.
+const warmWindow = 5 * time.Minute
+
+// WarmReporter is implemented by adapters that know which of their models
+// ran a turn recently.
+type WarmReporter interface {
+	Warm(model string) bool
+}
+
+// warmth records when each model last started a turn.
+type warmth struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func (w *warmth) touch(model string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.last == nil {
+		w.last = make(map[string]time.Time)
+	}
+	w.last[model] = time.Now()
+}
+
+func (w *warmth) warm(model string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	at, ok := w.last[model]
+	return ok && time.Since(at) < warmWindow
+}
+
+// active reports whether any model started a turn within d.
+func (w *warmth) active(d time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, at := range w.last {
+		if time.Since(at) < d {
+			return true
+		}
+	}
+	return false
+}
+
+// Warm reports whether model started a turn within warmWindow.
+func (a *ClaudeAdapter) Warm(model string) bool { return a.warmth.warm(model) }
+
+// Warm reports whether model started a turn within warmWindow.
+func (a *CodexAdapter) Warm(model string) bool { return a.warmth.warm(model) }
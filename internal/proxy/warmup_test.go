@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRouterWarmupRunsTrivialClaudePrompt(t *testing.T) {
+	claude := newFakeClaudeAdapter(t, `{"type":"result","result":"OK"}`)
+	r := NewRouter(claude, &raceTestAdapter{})
+
+	var mu sync.Mutex
+	var got []WarmupStatus
+	r.Warmup(context.Background(), func(st WarmupStatus) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, st)
+	})
+
+	if len(got) != 2 || got[0].State != WarmupRunning || got[1].State != WarmupReady || got[1].Backend != BackendClaude {
+		t.Fatalf("unexpected warm-up reports: %+v", got)
+	}
+	args, stdin := fakeClaudeInvocation(t)
+	if !slices.Contains(args, "sonnet") || !slices.Contains(append(args, stdin), warmupPrompt) {
+		t.Fatalf("unexpected warm-up invocation: %q %q", args, stdin)
+	}
+}
+
+func TestListModelsMarksRecentlyUsedModelsWarm(t *testing.T) {
+	claude := newFakeClaudeAdapter(t, `{"type":"result","result":"OK"}`)
+	claude.models = []string{"haiku", "sonnet"}
+	r := NewRouter(claude, &raceTestAdapter{})
+	r.SetRaces(map[string][]string{"fast": {"haiku", "sonnet"}})
+	r.SetAutoPolicy(&AutoPolicy{Default: "haiku"})
+
+	if _, err := claude.Chat(context.Background(), ChatRequest{Model: "sonnet", Messages: []Message{{Role: "user", Content: "hi"}}}); err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	models, err := r.ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	warm := map[string]bool{}
+	for _, m := range models {
+		warm[m.ID] = m.Warm
+	}
+	want := map[string]bool{"haiku": false, "sonnet": true, "fast": true, AutoModel: false}
+	for id, w := range want {
+		if got, ok := warm[id]; !ok || got != w {
+			t.Errorf("%s: warm = %v (listed %v), want %v", id, got, ok, w)
+		}
+	}
+}
+
+func TestCodexWarmupLeavesAnAppServerForTheFirstTurn(t *testing.T) {
+	adapter := newFakeCodexAdapter(t, codexAgentDelta("Hello"), codexNotification("turn/completed", map[string]any{}))
+	if err := adapter.Warmup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := adapter.SupportsModel(context.Background(), "gpt-5"); !ok || err != nil {
+		t.Fatalf("warm-up did not fill the model cache: %v, %v", ok, err)
+	}
+	started := func() int {
+		raw, err := os.ReadFile(os.Getenv("LLM_PROXY_FAKE_CODEX_LOG"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(raw), `"method":"initialize"`)
+	}
+
+	chat := func() {
+		t.Helper()
+		resp, err := adapter.Chat(context.Background(), ChatRequest{Model: "gpt-5", Messages: []Message{{Role: "user", Content: "hi"}}})
+		if err != nil || resp.Text != "Hello" {
+			t.Fatalf("chat = %q, %v", resp.Text, err)
+		}
+	}
+	chat()
+	if n := started(); n != 1 {
+		t.Fatalf("first turn after warm-up started %d app-servers in all, want the warmed one only", n)
+	}
+	chat()
+	if n := started(); n != 2 {
+		t.Fatalf("second turn reused a used app-server: %d started", n)
+	}
+}
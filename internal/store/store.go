@@ -0,0 +1,269 @@
+// Package store persists conversation state in SQLite so it survives proxy
+// restarts: the models conversations were pinned to and the responses served,
+// with the conversation and upstream session (Codex thread or Claude session)
+// that produced them.
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// DefaultTTL is how long idle conversations and stored responses are kept.
+	DefaultTTL = 30 * 24 * time.Hour
+	// cleanupInterval is how often expired rows are deleted.
+	cleanupInterval = time.Hour
+)
+
+// migrations bring the database schema up to date: migrations[i] moves it
+// from user_version i to i+1. Databases created before user_version was
+// kept are at version 0 whatever their tables, so migrations only create
+// what is missing.
+var migrations = []func(*sql.Tx) error{
+	execMigration(`
+CREATE TABLE IF NOT EXISTS conversation_pins (
+	conversation  TEXT NOT NULL,
+	virtual_model TEXT NOT NULL,
+	model         TEXT NOT NULL,
+	last_used     INTEGER NOT NULL,
+	PRIMARY KEY (conversation, virtual_model)
+);
+CREATE INDEX IF NOT EXISTS conversation_pins_last_used ON conversation_pins (last_used);
+CREATE TABLE IF NOT EXISTS responses (
+	id           TEXT PRIMARY KEY,
+	conversation TEXT NOT NULL DEFAULT '',
+	model        TEXT NOT NULL,
+	thread_id    TEXT NOT NULL DEFAULT '',
+	body         BLOB NOT NULL,
+	created_at   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS responses_created_at ON responses (created_at);
+CREATE INDEX IF NOT EXISTS responses_conversation ON responses (conversation);
+`),
+	// The API key that created a response, for GET and DELETE
+	// /v1/responses/{id}.
+	addColumn("responses", "owner", "TEXT NOT NULL DEFAULT ''"),
+}
+
+func execMigration(query string) func(*sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// addColumn adds column to table unless it is there already.
+func addColumn(table, column, decl string) func(*sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		var n int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n); err != nil || n > 0 {
+			return err
+		}
+		_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl))
+		return err
+	}
+}
+
+// Response is a served Responses API object. Body is its JSON as returned to
+// the client; Owner is the API key that created it, empty without auth.
+type Response struct {
+	ID           string
+	Owner        string
+	Conversation string
+	Model        string
+	ThreadID     string
+	Body         []byte
+	CreatedAt    time.Time
+}
+
+// Store is a SQLite-backed conversation store. It is safe for concurrent use.
+type Store struct {
+	db  *sql.DB
+	ttl time.Duration
+	now func() time.Time
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// Open opens or creates the database at path and starts deleting rows idle
+// for longer than ttl (DefaultTTL when zero).
+func Open(path string, ttl time.Duration) (*Store, error) {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create store dir: %w", err)
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init store %s: %w", path, err)
+	}
+	s := &Store{db: db, ttl: ttl, now: time.Now, stop: make(chan struct{})}
+	if err := s.Cleanup(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s.done.Add(1)
+	go s.cleanupLoop()
+	return s, nil
+}
+
+// migrate runs the migrations past the database's user_version, each in a
+// transaction with the version bump.
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than this build's %d", version, len(migrations))
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := migrations[i](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to version %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the cleanup loop and closes the database.
+func (s *Store) Close() error {
+	close(s.stop)
+	s.done.Wait()
+	return s.db.Close()
+}
+
+func (s *Store) cleanupLoop() {
+	defer s.done.Done()
+	t := time.NewTicker(cleanupInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			if err := s.Cleanup(); err != nil {
+				log.Printf("store cleanup failed: %v", err)
+			}
+		}
+	}
+}
+
+// Cleanup deletes pins idle and responses created longer than the TTL ago.
+func (s *Store) Cleanup() error {
+	cutoff := s.now().Add(-s.ttl).UnixMilli()
+	if _, err := s.db.Exec(`DELETE FROM conversation_pins WHERE last_used < ?`, cutoff); err != nil {
+		return fmt.Errorf("clean up pins: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM responses WHERE created_at < ?`, cutoff); err != nil {
+		return fmt.Errorf("clean up responses: %w", err)
+	}
+	return nil
+}
+
+// Pin returns the model conversation was pinned to for virtual, if the pin
+// has not expired, and marks it used.
+func (s *Store) Pin(conversation, virtual string) (string, bool, error) {
+	now := s.now()
+	var model string
+	err := s.db.QueryRow(
+		`UPDATE conversation_pins SET last_used = ?
+		 WHERE conversation = ? AND virtual_model = ? AND last_used >= ?
+		 RETURNING model`,
+		now.UnixMilli(), conversation, virtual, now.Add(-s.ttl).UnixMilli(),
+	).Scan(&model)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("read pin: %w", err)
+	}
+	return model, true, nil
+}
+
+// SetPin pins conversation to model for virtual.
+func (s *Store) SetPin(conversation, virtual, model string) error {
+	_, err := s.db.Exec(
+		`INSERT INTO conversation_pins (conversation, virtual_model, model, last_used) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (conversation, virtual_model) DO UPDATE SET model = excluded.model, last_used = excluded.last_used`,
+		conversation, virtual, model, s.now().UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("write pin: %w", err)
+	}
+	return nil
+}
+
+// SaveResponse stores resp, replacing any response with the same ID. A zero
+// CreatedAt is set to now.
+func (s *Store) SaveResponse(resp Response) error {
+	if resp.CreatedAt.IsZero() {
+		resp.CreatedAt = s.now()
+	}
+	_, err := s.db.Exec(
+		`INSERT OR REPLACE INTO responses (id, owner, conversation, model, thread_id, body, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		resp.ID, resp.Owner, resp.Conversation, resp.Model, resp.ThreadID, resp.Body, resp.CreatedAt.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("save response %s: %w", resp.ID, err)
+	}
+	return nil
+}
+
+// Response returns the stored response with id, if it exists and has not
+// expired.
+func (s *Store) Response(id string) (Response, bool, error) {
+	var resp Response
+	var created int64
+	err := s.db.QueryRow(
+		`SELECT id, owner, conversation, model, thread_id, body, created_at FROM responses WHERE id = ? AND created_at >= ?`,
+		id, s.now().Add(-s.ttl).UnixMilli(),
+	).Scan(&resp.ID, &resp.Owner, &resp.Conversation, &resp.Model, &resp.ThreadID, &resp.Body, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Response{}, false, nil
+	}
+	if err != nil {
+		return Response{}, false, fmt.Errorf("read response %s: %w", id, err)
+	}
+	resp.CreatedAt = time.UnixMilli(created)
+	return resp, true, nil
+}
+
+// DeleteResponse deletes the response with id and reports whether it existed.
+func (s *Store) DeleteResponse(id string) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM responses WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete response %s: %w", id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "llm-proxy.db")
+	s, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPin("key/conv", "fast", "haiku"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveResponse(Response{ID: "resp_1", Conversation: "key/conv", Model: "gpt-5", ThreadID: "thr_1", Body: []byte(`{"id":"resp_1"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if model, ok, err := s.Pin("key/conv", "fast"); err != nil || !ok || model != "haiku" {
+		t.Fatalf("pin after reopen: %q %v %v", model, ok, err)
+	}
+	resp, ok, err := s.Response("resp_1")
+	if err != nil || !ok {
+		t.Fatalf("response after reopen: %v %v", ok, err)
+	}
+	if resp.ThreadID != "thr_1" || resp.Conversation != "key/conv" || string(resp.Body) != `{"id":"resp_1"}` {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if deleted, err := s.DeleteResponse("resp_1"); err != nil || !deleted {
+		t.Fatalf("delete: %v %v", deleted, err)
+	}
+	if _, ok, _ := s.Response("resp_1"); ok {
+		t.Fatal("response still stored after delete")
+	}
+}
+
+func TestStoreExpiresIdleRows(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "llm-proxy.db"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	if err := s.SetPin("conv", "auto", "sonnet"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveResponse(Response{ID: "resp_1", Model: "sonnet", Body: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, ok, _ := s.Pin("conv", "auto"); ok {
+		t.Fatal("expired pin was returned")
+	}
+	if _, ok, _ := s.Response("resp_1"); ok {
+		t.Fatal("expired response was returned")
+	}
+	if err := s.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := s.db.QueryRow(`SELECT (SELECT COUNT(*) FROM conversation_pins) + (SELECT COUNT(*) FROM responses)`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("cleanup left %d rows", n)
+	}
+}
+
+func TestStoreMigratesDatabasesWithoutOwners(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llm-proxy.db")
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first release's responses table, with no owner and user_version 0.
+	if _, err := db.Exec(`CREATE TABLE responses (id TEXT PRIMARY KEY, conversation TEXT NOT NULL DEFAULT '', model TEXT NOT NULL, thread_id TEXT NOT NULL DEFAULT '', body BLOB NOT NULL, created_at INTEGER NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO responses (id, model, body, created_at) VALUES ('resp_old', 'gpt-5', '{}', ?)`, time.Now().UnixMilli()); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	for range 2 {
+		s, err := Open(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp, ok, err := s.Response("resp_old"); err != nil || !ok || resp.Owner != "" {
+			t.Fatalf("old response: %+v %v %v", resp, ok, err)
+		}
+		if err := s.SaveResponse(Response{ID: "resp_new", Owner: "ci", Model: "gpt-5", Body: []byte(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+		if resp, _, err := s.Response("resp_new"); err != nil || resp.Owner != "ci" {
+			t.Fatalf("new response: %+v %v", resp, err)
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,187 @@
+package tokenizer
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// BPE is a byte-pair encoding in tiktoken's format, split into pieces the
+// way cl100k_base or o200k_base does.
+type BPE struct {
+	ranks   map[string]int
+	pattern *regexp.Regexp
+}
+
+// LoadBPE reads a tiktoken rank file, such as cl100k_base.tiktoken.
+func LoadBPE(file string) (*BPE, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadBPE(f)
+}
+
+// ReadBPE reads tiktoken ranks: a line per token, its bytes in base64 and
+// its rank. The text is split the way cl100k_base does.
+func ReadBPE(r io.Reader) (*BPE, error) {
+	b := &BPE{ranks: map[string]int{}, pattern: cl100kPattern}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: want a token and a rank", line)
+		}
+		raw, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		b.ranks[string(raw)] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(b.ranks) == 0 {
+		return nil, fmt.Errorf("no tokens")
+	}
+	return b, nil
+}
+
+func (b *BPE) Count(text string) int {
+	n := 0
+	for _, piece := range splitPieces(b.pattern, text) {
+		n += b.countPiece([]byte(piece))
+	}
+	return n
+}
+
+// countPiece merges the lowest-ranked pair of adjacent parts of piece, the
+// leftmost of equals, until no pair is a token, and returns how many parts
+// are left. The parts are a linked list and the pairs a heap, so a piece of
+// n bytes takes O(n log n) however long it is.
+func (b *BPE) countPiece(piece []byte) int {
+	if _, ok := b.ranks[string(piece)]; ok {
+		return 1
+	}
+	// Parts are named by where they start; next[i] is where the part after
+	// part i starts, len(piece) for the last one.
+	n := len(piece)
+	next := make([]int, n)
+	prev := make([]int, n)
+	for i := range n {
+		next[i], prev[i] = i+1, i-1
+	}
+	pairs := &pairHeap{}
+	push := func(start int) {
+		if start < 0 || next[start] >= n {
+			return
+		}
+		end := next[next[start]]
+		if rank, ok := b.ranks[string(piece[start:end])]; ok {
+			heap.Push(pairs, pair{rank: rank, start: start, end: end})
+		}
+	}
+	for i := range n - 1 {
+		push(i)
+	}
+	parts := n
+	for pairs.Len() > 0 {
+		p := heap.Pop(pairs).(pair)
+		// A pair is stale once either of its parts merged with another;
+		// the parts of a pair spanning the same bytes never change.
+		if next[p.start] >= n || next[next[p.start]] != p.end || prev[p.start] == -2 {
+			continue
+		}
+		gone := next[p.start]
+		next[p.start] = p.end
+		if p.end < n {
+			prev[p.end] = p.start
+		}
+		prev[gone] = -2
+		parts--
+		push(prev[p.start])
+		push(p.start)
+	}
+	return parts
+}
+
+// pair is two adjacent parts, piece[start:end], that merge into a token.
+type pair struct {
+	rank, start, end int
+}
+
+// pairHeap orders pairs by rank, then leftmost first.
+type pairHeap []pair
+
+func (h pairHeap) Len() int { return len(h) }
+func (h pairHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank < h[j].rank
+	}
+	return h[i].start < h[j].start
+}
+func (h pairHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *pairHeap) Push(x any)   { *h = append(*h, x.(pair)) }
+func (h *pairHeap) Pop() any {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
+
+// space is Unicode's White_Space, which tiktoken's \s matches and RE2's
+// \s, ASCII only, does not.
+const space = `\t-\r \x{85}\p{Z}`
+
+// cl100kPattern is cl100k_base's pattern without its `\s+(?!\S)`
+// alternative, which RE2 cannot express; splitPieces makes up for it.
+var cl100kPattern = regexp.MustCompile(`^(?:(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^` + space + `\p{L}\p{N}]+[\r\n]*|[` + space + `]*[\r\n]+|[` + space + `]+)`)
+
+// o200kPattern is o200k_base's pattern, likewise without `\s+(?!\S)`. Words
+// split at case changes and keep their contraction, and a run of
+// punctuation takes trailing slashes along with newlines.
+var o200kPattern = regexp.MustCompile(`^(?:` +
+	`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+	`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+	`|\p{N}{1,3}| ?[^` + space + `\p{L}\p{N}]+[\r\n/]*|[` + space + `]*[\r\n]+|[` + space + `]+)`)
+
+// splitPieces splits text with pattern the way tiktoken does before
+// merging.
+func splitPieces(pattern *regexp.Regexp, text string) []string {
+	var pieces []string
+	for len(text) > 0 {
+		end := 0
+		if loc := pattern.FindStringIndex(text); loc != nil {
+			end = loc[1]
+		}
+		if end == 0 {
+			_, end = utf8.DecodeRuneInString(text)
+		}
+		// A run of spaces before a word leaves its last space to the word,
+		// as `\s+(?!\S)` would.
+		if piece := text[:end]; end < len(text) && strings.TrimSpace(piece) == "" && !strings.ContainsAny(piece, "\r\n") {
+			if _, size := utf8.DecodeLastRuneInString(piece); size < len(piece) {
+				end -= size
+			}
+		}
+		pieces = append(pieces, text[:end])
+		text = text[end:]
+	}
+	return pieces
+}
@@ -0,0 +1,54 @@
+package tokenizer
+
+import (
+	"bytes"
+	_ "embed"
+	"regexp"
+	"sync"
+
+	"llm-proxy/internal/config"
+)
+
+// OpenAI's published vocabularies, as tiktoken downloads them from
+// openaipublic.blob.core.windows.net/encodings/ (SHA-256 223921b7… and
+// 446a9538…, the hashes tiktoken checks them against).
+var (
+	//go:embed encodings/cl100k_base.tiktoken
+	cl100kRanks []byte
+	//go:embed encodings/o200k_base.tiktoken
+	o200kRanks []byte
+)
+
+// builtin are the bundled encodings. Each is parsed the first time it
+// counts, so a proxy that never uses one does not pay for its ranks.
+var builtin = map[string]Tokenizer{
+	config.TokenizerCl100k: lazyBPE(sync.OnceValue(func() *BPE { return mustReadBuiltin(cl100kRanks, cl100kPattern) })),
+	config.TokenizerO200k:  lazyBPE(sync.OnceValue(func() *BPE { return mustReadBuiltin(o200kRanks, o200kPattern) })),
+}
+
+// codexModels are the patterns of the models Codex serves, which count with
+// o200k_base unless the config says otherwise.
+var codexModels = []string{"gpt-*", "o[0-9]*", "codex-*", "codex/*"}
+
+// lazyBPE is an encoding parsed on first use.
+type lazyBPE func() *BPE
+
+func (l lazyBPE) Count(text string) int { return l().Count(text) }
+
+func mustReadBuiltin(ranks []byte, pattern *regexp.Regexp) *BPE {
+	b, err := ReadBPE(bytes.NewReader(ranks))
+	if err != nil {
+		panic("tokenizer: bundled encoding: " + err.Error())
+	}
+	b.pattern = pattern
+	return b
+}
+
+// patternFor returns how the encoding called name splits text: as
+// o200k_base for a file loaded under that name, else as cl100k_base.
+func patternFor(name string) *regexp.Regexp {
+	if name == config.TokenizerO200k {
+		return o200kPattern
+	}
+	return cl100kPattern
+}
@@ -0,0 +1,83 @@
+// Package tokenizer counts tokens for usage and budget estimates, which the
+// CLIs do not always report.
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"llm-proxy/internal/config"
+)
+
+// Tokenizer counts the tokens of a text.
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// Heuristic counts a token per 4 characters, rounded up. It needs no
+// vocabulary and is close enough for English prose.
+var Heuristic Tokenizer = heuristic{}
+
+type heuristic struct{}
+
+func (heuristic) Count(text string) int {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0
+	}
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// Set picks the tokenizer for each model.
+type Set struct {
+	def    Tokenizer
+	models map[string]Tokenizer
+	codex  map[string]Tokenizer
+}
+
+// Load reads the encodings cfg names and returns the tokenizers it assigns.
+// Besides those, cl100k_base and o200k_base are bundled, and Codex's models
+// count with o200k_base unless cfg assigns them another. The zero config
+// counts every other model with Heuristic.
+func Load(cfg config.Tokenizers) (*Set, error) {
+	encodings := map[string]Tokenizer{config.TokenizerHeuristic: Heuristic}
+	for name, tok := range builtin {
+		encodings[name] = tok
+	}
+	for name, file := range cfg.Encodings {
+		bpe, err := LoadBPE(file)
+		if err != nil {
+			return nil, fmt.Errorf("tokenizers.encodings.%s: %w", name, err)
+		}
+		bpe.pattern = patternFor(name)
+		encodings[name] = bpe
+	}
+	s := &Set{def: Heuristic, models: map[string]Tokenizer{}, codex: map[string]Tokenizer{}}
+	for _, pattern := range codexModels {
+		s.codex[pattern] = encodings[config.TokenizerO200k]
+	}
+	if cfg.Default != "" {
+		s.def = encodings[cfg.Default]
+	}
+	for model, name := range cfg.Models {
+		s.models[model] = encodings[name]
+	}
+	return s, nil
+}
+
+// For returns the tokenizer for model: the one set for its exact ID, else
+// for the longest pattern matching it, else o200k_base for a Codex model,
+// else the default. A nil Set counts with Heuristic.
+func (s *Set) For(model string) Tokenizer {
+	if s == nil {
+		return Heuristic
+	}
+	if tok, ok := config.LookupModel(s.models, model); ok {
+		return tok
+	}
+	if tok, ok := config.LookupModel(s.codex, model); ok {
+		return tok
+	}
+	return s.def
+}
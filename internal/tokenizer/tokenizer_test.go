@@ -0,0 +1,171 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"llm-proxy/internal/config"
+)
+
+// writeRanks writes a tiktoken file with every byte and then tokens, in
+// rank order.
+func writeRanks(t *testing.T, tokens ...string) string {
+	t.Helper()
+	var b strings.Builder
+	for i := range 256 {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, tok := range tokens {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), 256+i)
+	}
+	file := filepath.Join(t.TempDir(), "test.tiktoken")
+	if err := os.WriteFile(file, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestSplitPiecesLikeCl100k(t *testing.T) {
+	cases := map[string][]string{
+		"Hello world":       {"Hello", " world"},
+		"I'm HERE'S":        {"I", "'m", " HERE", "'S"},
+		"12345":             {"123", "45"},
+		"a  b":              {"a", " ", " b"},
+		"a\n\nb":            {"a", "\n\n", "b"},
+		" \n x":             {" \n", " x"},
+		"x   ":              {"x", "   "},
+		"hi!!\n":            {"hi", "!!\n"},
+		"a\u00a0\u00a0b":    {"a", "\u00a0", "\u00a0b"},
+		"func f() {}":       {"func", " f", "()", " {}"},
+		"naïve café, ok?":   {"naïve", " café", ",", " ok", "?"},
+		"\xff\xfe":          {"\xff\xfe"},
+		"tab\tseparated\t1": {"tab", "\tseparated", "\t", "1"},
+	}
+	for text, want := range cases {
+		if got := splitPieces(cl100kPattern, text); !slices.Equal(got, want) {
+			t.Errorf("splitPieces(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestSplitPiecesLikeO200k(t *testing.T) {
+	cases := map[string][]string{
+		"Hello world":  {"Hello", " world"},
+		"I'm HERE'S":   {"I'm", " HERE'S"},
+		"camelCaseXML": {"camel", "Case", "XML"},
+		"12345":        {"123", "45"},
+		"a  b":         {"a", " ", " b"},
+		"x = a//b":     {"x", " =", " a", "//", "b"},
+		"hi!!\n":       {"hi", "!!\n"},
+	}
+	for text, want := range cases {
+		if got := splitPieces(o200kPattern, text); !slices.Equal(got, want) {
+			t.Errorf("splitPieces(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestBundledEncodings(t *testing.T) {
+	// Counts from tiktoken.
+	cases := []struct {
+		encoding, text string
+		want           int
+	}{
+		{config.TokenizerCl100k, "hello world", 2},
+		{config.TokenizerCl100k, "tiktoken is great!", 6},
+		{config.TokenizerO200k, "hello world", 2},
+		{config.TokenizerO200k, "tiktoken is great!", 6},
+	}
+	for _, c := range cases {
+		if got := builtin[c.encoding].Count(c.text); got != c.want {
+			t.Errorf("%s counted %q as %d tokens, want %d", c.encoding, c.text, got, c.want)
+		}
+	}
+
+	set, err := Load(config.Tokenizers{Models: map[string]string{"gpt-5-mini": config.TokenizerHeuristic}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "hello world" is 2 tokens with o200k_base, 3 by the heuristic.
+	for model, want := range map[string]int{"gpt-5": 2, "codex/gpt-5-codex": 2, "o3": 2, "gpt-5-mini": 3, "sonnet": 3} {
+		if got := set.For(model).Count("hello world"); got != want {
+			t.Errorf("%s counted %d tokens, want %d", model, got, want)
+		}
+	}
+}
+
+func TestBPEMergesLowestRankFirst(t *testing.T) {
+	bpe, err := LoadBPE(writeRanks(t, "ab", "abc", "hello", " world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]int{
+		"":            0,
+		"hello world": 2,
+		// " worlds" has no merges to reach " world" by: a token a byte.
+		"hello worlds": 8,
+		// a|b|c|a|b merges both "ab" before "abc": abc|ab.
+		"abcab": 2,
+		"xyz":   3,
+	}
+	for text, want := range cases {
+		if got := bpe.Count(text); got != want {
+			t.Errorf("Count(%q) = %d, want %d", text, got, want)
+		}
+	}
+	if got := bpe.Count(strings.Repeat("!", 3072)); got != 3072 {
+		t.Errorf("long piece counted %d tokens, want %d", got, 3072)
+	}
+	// Merging is O(n log n): a megabyte-long piece counts in well under a
+	// second, where merging by rescanning every pair would take hours.
+	if got := bpe.Count(strings.Repeat("ab", 1<<19)); got != 1<<19 {
+		t.Errorf("megabyte piece counted %d tokens, want %d", got, 1<<19)
+	}
+}
+
+func TestReadBPERejectsMalformedFiles(t *testing.T) {
+	for _, body := range []string{"", "YQ==\n", "!!! 1\n", "YQ== one\n"} {
+		if _, err := ReadBPE(strings.NewReader(body)); err == nil {
+			t.Errorf("ReadBPE(%q) succeeded", body)
+		}
+	}
+}
+
+func TestSetPicksTokenizerPerModel(t *testing.T) {
+	file := writeRanks(t, "hello")
+	set, err := Load(config.Tokenizers{
+		Encodings: map[string]string{"test": file},
+		Models:    map[string]string{"gpt-*": "test", "gpt-5-mini*": config.TokenizerHeuristic, "sonnet": "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "hello" is 1 token with the test encoding, 2 by the heuristic.
+	cases := map[string]int{"gpt-5": 1, "gpt-5-mini": 2, "sonnet": 1, "opus": 2}
+	for model, want := range cases {
+		if got := set.For(model).Count("hello"); got != want {
+			t.Errorf("%s counted %d tokens, want %d", model, got, want)
+		}
+	}
+	if got := (*Set)(nil).For("gpt-5").Count("hello"); got != 2 {
+		t.Errorf("nil set counted %d tokens, want the heuristic's 2", got)
+	}
+
+	set, err = Load(config.Tokenizers{Encodings: map[string]string{"test": file}, Default: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := set.For("opus").Count("hello"); got != 1 {
+		t.Errorf("default encoding counted %d tokens, want 1", got)
+	}
+
+	_, err = Load(config.Tokenizers{Encodings: map[string]string{"missing": filepath.Join(t.TempDir(), "nope.tiktoken")}})
+	if err == nil || !strings.Contains(err.Error(), "tokenizers.encodings.missing") {
+		t.Fatalf("missing file: err = %v", err)
+	}
+}
@@ -12,27 +12,32 @@ import (
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
 	"llm-proxy/internal/api"
+	"llm-proxy/internal/client"
 	"llm-proxy/internal/proxy"
 )
 
 type App struct {
 	addr    string
+	apiKey  string
 	metrics *api.Metrics
+	replay  ReplayFunc
 	server  *http.Server
 	errCh   <-chan error
 }
 
-func New(addr string, metrics *api.Metrics, server *http.Server, errCh <-chan error) *App {
+func New(addr string, apiKey string, metrics *api.Metrics, replay ReplayFunc, server *http.Server, errCh <-chan error) *App {
 	return &App{
 		addr:    addr,
+		apiKey:  apiKey,
 		metrics: metrics,
+		replay:  replay,
 		server:  server,
 		errCh:   errCh,
 	}
 }
 
 func (a *App) Run() error {
-	m := newModel(a.addr, a.metrics, a.errCh)
+	m := newModel(a.addr, a.apiKey, a.metrics, a.replay, a.errCh)
 	p := tea.NewProgram(m)
 	_, err := p.Run()
 	return err
@@ -51,6 +56,13 @@ func (a *App) Shutdown(ctx context.Context) error {
 
 type tickMsg time.Time
 
+type tab int
+
+const (
+	tabDashboard tab = iota
+	tabPlayground
+)
+
 type model struct {
 	addr      string
 	metrics   *api.Metrics
@@ -59,6 +71,7 @@ type model struct {
 	lastErr   string
 	running   bool
 	yolo      bool
+	paused    bool
 
 	width      int
 	height     int
@@ -66,9 +79,14 @@ type model struct {
 	snap       api.MetricsSnapshot
 	prevReqs   uint64
 	reqsPerSec uint64
+
+	audit []api.AuditEntry
+
+	tab  tab
+	play playground
 }
 
-func newModel(addr string, metrics *api.Metrics, errCh <-chan error) model {
+func newModel(addr string, apiKey string, metrics *api.Metrics, replay ReplayFunc, errCh <-chan error) model {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("#89dceb"))
@@ -79,7 +97,9 @@ func newModel(addr string, metrics *api.Metrics, errCh <-chan error) model {
 		startedAt: time.Now(),
 		running:   true,
 		yolo:      proxy.YOLOEnabled(),
+		paused:    api.CurrentPause().Paused,
 		spin:      s,
+		play:      newPlayground(client.LocalBaseURL(addr), apiKey, metrics, replay),
 	}
 }
 
@@ -99,14 +119,48 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "q", "ctrl+c":
+		case "ctrl+c":
+			return m, tea.Quit
+		case "tab":
+			if m.tab == tabDashboard {
+				m.tab = tabPlayground
+				cmds = append(cmds, m.play.input.Focus())
+				if !m.play.loaded {
+					cmds = append(cmds, m.play.loadModels())
+				}
+			} else {
+				m.tab = tabDashboard
+				m.play.input.Blur()
+			}
+			return m, tea.Batch(cmds...)
+		}
+		if m.tab == tabPlayground {
+			var cmd tea.Cmd
+			m.play, cmd = m.play.update(msg)
+			return m, cmd
+		}
+		switch msg.String() {
+		case "q":
 			return m, tea.Quit
 		case "y":
 			m.yolo = !m.yolo
 			proxy.SetYOLO(m.yolo)
+			api.RecordAudit(api.AuditEntry{Source: api.AuditSourceTUI, Setting: "yolo", From: api.OnOff(!m.yolo), To: api.OnOff(m.yolo)})
+		case "p":
+			prev := api.CurrentPause()
+			p := api.SetPause(api.Pause{Paused: !m.paused})
+			m.paused = p.Paused
+			api.RecordAudit(api.AuditEntry{Source: api.AuditSourceTUI, Setting: "pause", From: api.PauseAudit(prev), To: api.PauseAudit(p)})
 		}
+	case playgroundModelsMsg, playgroundDeltaMsg, playgroundDoneMsg, playgroundReplayMsg:
+		var cmd tea.Cmd
+		m.play, cmd = m.play.update(msg)
+		cmds = append(cmds, cmd)
 	case tickMsg:
+		m.yolo = proxy.YOLOEnabled()
+		m.paused = api.CurrentPause().Paused
 		m.snap = m.metrics.Snapshot()
+		m.audit = api.AuditLog()
 		if m.snap.RequestsTotal >= m.prevReqs {
 			m.reqsPerSec = m.snap.RequestsTotal - m.prevReqs
 		}
@@ -124,6 +178,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		var cmd tea.Cmd
 		m.spin, cmd = m.spin.Update(msg)
 		cmds = append(cmds, cmd)
+	default:
+		if m.tab == tabPlayground {
+			var cmd tea.Cmd
+			m.play.input, cmd = m.play.input.Update(msg)
+			cmds = append(cmds, cmd)
+		}
 	}
 	return m, tea.Batch(cmds...)
 }
@@ -155,6 +215,9 @@ func (m model) View() tea.View {
 	if !m.running {
 		statusColor = lipgloss.Color(mochaRed)
 		statusText = "stopped"
+	} else if m.paused {
+		statusColor = lipgloss.Color(mochaPeach)
+		statusText = "paused"
 	}
 	status := lipgloss.NewStyle().
 		Bold(true).
@@ -192,6 +255,13 @@ func (m model) View() tea.View {
 			Render("YOLO enabled: permission prompts and sandbox checks are bypassed in upstream CLIs.")
 		header = lipgloss.JoinVertical(lipgloss.Left, header, yoloWarning)
 	}
+	if alert, ok := recentLoopAlert(m.snap.LoopAlerts); ok {
+		loopWarning := lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color(mochaRed)).
+			Render(renderLoopAlert(alert))
+		header = lipgloss.JoinVertical(lipgloss.Left, header, loopWarning)
+	}
 
 	sectionTitle := lipgloss.NewStyle().
 		Bold(true).
@@ -212,15 +282,49 @@ func (m model) View() tea.View {
 		sectionTitle.Render("Service"),
 		fmt.Sprintf("%s %s", label.Render("Status:"), status),
 		fmt.Sprintf("%s %s", label.Render("YOLO mode:"), value.Render(yoloText)),
-		fmt.Sprintf("%s %s", label.Render("Address:"), value.Render("http://127.0.0.1"+m.addr)),
+		fmt.Sprintf("%s %s", label.Render("Address:"), value.Render(client.LocalBaseURL(m.addr))),
 		fmt.Sprintf("%s %s", label.Render("Uptime:"), value.Render(uptime.String())),
 	)
+	if len(m.snap.Warmup) > 0 {
+		serviceBody = lipgloss.JoinVertical(lipgloss.Left,
+			serviceBody,
+			fmt.Sprintf("%s %s", label.Render("Warm-up:"), value.Render(renderWarmup(m.snap.Warmup))),
+		)
+	}
+	if len(m.snap.Quotas) > 0 {
+		serviceBody = lipgloss.JoinVertical(lipgloss.Left,
+			serviceBody,
+			fmt.Sprintf("%s %s", label.Render("Quota:"), value.Render(renderQuotas(m.snap.Quotas))),
+		)
+	}
+	if len(m.snap.Health) > 0 {
+		style := value
+		for _, st := range m.snap.Health {
+			if !st.Healthy {
+				style = lipgloss.NewStyle().Foreground(lipgloss.Color(mochaPeach))
+			}
+		}
+		serviceBody = lipgloss.JoinVertical(lipgloss.Left,
+			serviceBody,
+			fmt.Sprintf("%s %s", label.Render("Health:"), style.Render(renderHealth(m.snap.Health))),
+		)
+	}
+	if len(m.snap.Cooldowns) > 0 {
+		serviceBody = lipgloss.JoinVertical(lipgloss.Left,
+			serviceBody,
+			fmt.Sprintf("%s %s", label.Render("Cooling off:"), lipgloss.NewStyle().Foreground(lipgloss.Color(mochaPeach)).Render(renderCooldowns(m.snap.Cooldowns))),
+		)
+	}
 	trafficBody := lipgloss.JoinVertical(lipgloss.Left,
 		sectionTitle.Render("Traffic"),
 		fmt.Sprintf("%s %s", label.Render("Requests:"), value.Render(fmt.Sprintf("%d", m.snap.RequestsTotal))),
 		fmt.Sprintf("%s %s", label.Render("Errors:"), value.Render(fmt.Sprintf("%d", m.snap.ErrorsTotal))),
 		fmt.Sprintf("%s %s", label.Render("In flight:"), value.Render(fmt.Sprintf("%d", m.snap.InFlight))),
 		fmt.Sprintf("%s %s", label.Render("Rate (req/s):"), value.Render(fmt.Sprintf("%d", m.reqsPerSec))),
+		fmt.Sprintf("%s %s", label.Render("Streams ok/gone/fail/cxl:"), value.Render(fmt.Sprintf("%d/%d/%d/%d",
+			m.snap.StreamsCompleted, m.snap.StreamsClientAborted, m.snap.StreamsUpstreamFailed, m.snap.StreamsCancelled))),
+		fmt.Sprintf("%s %s", label.Render("Text fallbacks:"), value.Render(fmt.Sprintf("%d", m.snap.TextFallbacks))),
+		fmt.Sprintf("%s %s", label.Render("Loops stopped:"), value.Render(fmt.Sprintf("%d", m.snap.LoopsDetected))),
 		fmt.Sprintf("%s %s", label.Render("Bytes out:"), value.Render(humanBytes(m.snap.BytesSent))),
 		fmt.Sprintf("%s %s", label.Render("Avg latency:"), value.Render(fmt.Sprintf("%.1f ms", m.snap.AvgLatencyMs))),
 		fmt.Sprintf("%s %s", label.Render("Max latency:"), value.Render(fmt.Sprintf("%.1f ms", m.snap.MaxLatencyMs))),
@@ -229,6 +333,39 @@ func (m model) View() tea.View {
 		sectionTitle.Render("Model Stats"),
 		renderModelStatsTable(m.snap.Models),
 	)
+	if len(m.snap.Keys) > 0 {
+		modelsBody = lipgloss.JoinVertical(lipgloss.Left,
+			modelsBody,
+			"",
+			sectionTitle.Render("Key Usage"),
+			renderKeyStatsTable(m.snap.Keys, "Key"),
+		)
+	}
+	if len(m.snap.Users) > 0 {
+		modelsBody = lipgloss.JoinVertical(lipgloss.Left,
+			modelsBody,
+			"",
+			sectionTitle.Render("User Usage"),
+			renderKeyStatsTable(m.snap.Users, "User"),
+		)
+	}
+	if len(m.snap.Tags) > 0 {
+		modelsBody = lipgloss.JoinVertical(lipgloss.Left,
+			modelsBody,
+			"",
+			sectionTitle.Render("Tag Usage"),
+			renderKeyStatsTable(m.snap.Tags, "Tag"),
+		)
+	}
+
+	if len(m.audit) > 0 {
+		modelsBody = lipgloss.JoinVertical(lipgloss.Left,
+			modelsBody,
+			"",
+			sectionTitle.Render("Policy History"),
+			renderAudit(m.audit, label, value),
+		)
+	}
 
 	errorBlock := ""
 	if m.lastErr != "" {
@@ -237,13 +374,37 @@ func (m model) View() tea.View {
 			Render("Server error: " + m.lastErr)
 	}
 
+	footerText := "[ tab ] playground   [ y ] toggle YOLO   [ p ] pause/resume   [ q ] quit   [ ctrl+c ] quit and stop proxy"
+	if m.tab == tabPlayground {
+		footerText = "[ tab ] dashboard   [ ↑/↓ ] model   [ enter ] send   [ esc ] cancel   [ ctrl+r ] reload models   [ ctrl+l ] pick logged request   [ ctrl+o ] replay it   [ ctrl+c ] quit"
+	}
 	footer := lipgloss.NewStyle().
 		Foreground(lipgloss.Color(mochaSapphire)).
-		Render("[ y ] toggle YOLO   [ q ] quit   [ ctrl+c ] quit and stop proxy")
+		Render(footerText)
+
+	activeTab := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color(mochaMantle)).
+		Background(lipgloss.Color(mochaBlue)).
+		Padding(0, 1)
+	inactiveTab := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(mochaSubtext)).
+		Padding(0, 1)
+	tabNames := []string{"Dashboard", "Playground"}
+	renderedTabs := make([]string, 0, len(tabNames))
+	for i, name := range tabNames {
+		if tab(i) == m.tab {
+			renderedTabs = append(renderedTabs, activeTab.Render(name))
+		} else {
+			renderedTabs = append(renderedTabs, inactiveTab.Render(name))
+		}
+	}
+	tabBar := lipgloss.JoinHorizontal(lipgloss.Top, renderedTabs...)
 
 	panelBody := lipgloss.JoinVertical(
 		lipgloss.Left,
 		header,
+		tabBar,
 		separator,
 		serviceBody,
 		separator,
@@ -251,6 +412,16 @@ func (m model) View() tea.View {
 		separator,
 		modelsBody,
 	)
+	if m.tab == tabPlayground {
+		errStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(mochaRed))
+		panelBody = lipgloss.JoinVertical(
+			lipgloss.Left,
+			header,
+			tabBar,
+			separator,
+			m.play.view(m.width, m.height, label, value, sectionTitle, errStyle),
+		)
+	}
 	if errorBlock != "" {
 		panelBody = lipgloss.JoinVertical(lipgloss.Left, panelBody, separator, errorBlock)
 	}
@@ -284,6 +455,129 @@ func humanBytes(n uint64) string {
 	return fmt.Sprintf("%.2f %s", float64(n)/float64(div), suffixes[exp])
 }
 
+func renderWarmup(stats []api.WarmupStat) string {
+	parts := make([]string, 0, len(stats))
+	for _, st := range stats {
+		switch st.State {
+		case string(proxy.WarmupReady):
+			parts = append(parts, fmt.Sprintf("%s ready (%.1fs)", st.Backend, st.DurationMs/1000))
+		case string(proxy.WarmupFailed):
+			parts = append(parts, fmt.Sprintf("%s failed: %s", st.Backend, st.Error))
+		default:
+			parts = append(parts, st.Backend+" warming up…")
+		}
+	}
+	return strings.Join(parts, "   ")
+}
+
+func renderQuotas(stats []api.QuotaStat) string {
+	parts := make([]string, 0, len(stats))
+	for _, st := range stats {
+		if len(st.Windows) == 0 {
+			reason := "n/a"
+			if st.Error != "" {
+				reason += " (" + st.Error + ")"
+			}
+			parts = append(parts, st.Backend+" "+reason)
+			continue
+		}
+		windows := make([]string, 0, len(st.Windows))
+		for _, w := range st.Windows {
+			text := fmt.Sprintf("%s %.0f%%", quotaWindowName(w.WindowMinutes), w.UsedPercent)
+			if w.ResetsAt != nil {
+				text += " (resets " + w.ResetsAt.Local().Format("Jan 2 15:04") + ")"
+			}
+			windows = append(windows, text)
+		}
+		parts = append(parts, st.Backend+" "+strings.Join(windows, ", "))
+	}
+	return strings.Join(parts, "   ")
+}
+
+// quotaWindowName names a usage window by its length, e.g. "5h" or "7d".
+func quotaWindowName(minutes int) string {
+	switch {
+	case minutes <= 0:
+		return "limit"
+	case minutes%(24*60) == 0:
+		return fmt.Sprintf("%dd", minutes/(24*60))
+	case minutes%60 == 0:
+		return fmt.Sprintf("%dh", minutes/60)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+func renderHealth(stats []api.HealthStat) string {
+	parts := make([]string, 0, len(stats))
+	for _, st := range stats {
+		switch {
+		case st.CheckedAt == nil:
+			parts = append(parts, st.Backend+" not probed yet")
+		case st.CircuitOpen:
+			parts = append(parts, fmt.Sprintf("%s down, %d failed probes: %s", st.Backend, st.Failures, st.Error))
+		case !st.Healthy:
+			parts = append(parts, fmt.Sprintf("%s failing: %s", st.Backend, st.Error))
+		default:
+			parts = append(parts, fmt.Sprintf("%s ok (%.0fms)", st.Backend, st.LatencyMs))
+		}
+	}
+	return strings.Join(parts, "   ")
+}
+
+func renderCooldowns(stats []api.CooldownStat) string {
+	parts := make([]string, 0, len(stats))
+	for _, st := range stats {
+		what := st.Backend
+		if st.Model != "" {
+			what += " " + st.Model
+		}
+		parts = append(parts, fmt.Sprintf("%s usage limit, resets %s (in %s)",
+			what, st.Until.Local().Format("15:04"), time.Until(st.Until).Round(time.Minute)))
+	}
+	return strings.Join(parts, "   ")
+}
+
+// loopAlertShownFor is how long the header keeps showing a loop alert.
+const loopAlertShownFor = 5 * time.Minute
+
+// recentLoopAlert returns the newest loop alert if it is recent enough to
+// show.
+func recentLoopAlert(alerts []api.LoopAlert) (api.LoopAlert, bool) {
+	if len(alerts) == 0 || time.Since(alerts[0].Time) > loopAlertShownFor {
+		return api.LoopAlert{}, false
+	}
+	return alerts[0], true
+}
+
+func renderLoopAlert(alert api.LoopAlert) string {
+	who := alert.Model
+	if alert.Key != "" {
+		who = alert.Key + " on " + alert.Model
+	}
+	return fmt.Sprintf("Loop stopped at %s (%s): %s.", alert.Time.Local().Format("15:04:05"), who, alert.Reason)
+}
+
+// auditRows is how many recent policy changes the dashboard shows.
+const auditRows = 5
+
+func renderAudit(entries []api.AuditEntry, label, value lipgloss.Style) string {
+	lines := make([]string, 0, auditRows)
+	for i := len(entries) - 1; i >= 0 && len(lines) < auditRows; i-- {
+		e := entries[i]
+		by := e.Source
+		if e.Key != "" {
+			by += " (" + e.Key + ")"
+		}
+		change := e.To
+		if e.From != "" {
+			change = e.From + " → " + e.To
+		}
+		lines = append(lines, fmt.Sprintf("%s %s", label.Render(e.Time.Local().Format("15:04:05")), value.Render(fmt.Sprintf("%s: %s by %s", e.Setting, change, by))))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
 func renderModelStatsTable(models []api.ModelStats) string {
 	if len(models) == 0 {
 		return "No model traffic yet."
@@ -302,12 +596,20 @@ func renderModelStatsTable(models []api.ModelStats) string {
 	}
 
 	var b strings.Builder
-	b.WriteString(fmt.Sprintf("%-*s %8s %10s %18s %16s %10s\n",
-		modelWidth, "Model", "Requests", "Tokens", "Avg Time/Response", "Avg Tokens/Call", "Avg Tok/s"))
-	b.WriteString(strings.Repeat("─", modelWidth+8+10+18+16+10+5))
+	b.WriteString(fmt.Sprintf("%-*s %8s %10s %18s %16s %10s %10s %18s\n",
+		modelWidth, "Model", "Requests", "Tokens", "Avg Time/Response", "Avg Tokens/Call", "Avg Tok/s", "Out Tok/s", "TTFT p50/p95"))
+	b.WriteString(strings.Repeat("─", modelWidth+8+10+18+16+10+10+18+7))
 	b.WriteByte('\n')
 	for _, s := range models {
-		row := fmt.Sprintf("%-*s %8d %10d %17.1fms %16.1f %10.1f",
+		ttft := "-"
+		if s.P50TTFTMs > 0 {
+			ttft = fmt.Sprintf("%.0f/%.0fms", s.P50TTFTMs, s.P95TTFTMs)
+		}
+		outRate := "-"
+		if s.OutputTokensPerSec > 0 {
+			outRate = fmt.Sprintf("%.1f", s.OutputTokensPerSec)
+		}
+		row := fmt.Sprintf("%-*s %8d %10d %17.1fms %16.1f %10.1f %10s %18s",
 			modelWidth,
 			trim(s.Model),
 			s.RequestsTotal,
@@ -315,9 +617,29 @@ func renderModelStatsTable(models []api.ModelStats) string {
 			s.AvgLatencyMs,
 			s.AvgTokensPerCall,
 			s.AvgTokensPerSec,
+			outRate,
+			ttft,
 		)
 		b.WriteString(row)
 		b.WriteByte('\n')
 	}
 	return strings.TrimRight(b.String(), "\n")
 }
+
+func renderKeyStatsTable(keys []api.KeyStats, heading string) string {
+	const keyWidth = 20
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%-*s %8s %8s %12s %12s %10s\n",
+		keyWidth, heading, "Requests", "Errors", "Prompt Tok", "Output Tok", "Est. Cost"))
+	b.WriteString(strings.Repeat("─", keyWidth+8+8+12+12+10+5))
+	b.WriteByte('\n')
+	for _, k := range keys {
+		name := []rune(k.Key)
+		if len(name) > keyWidth {
+			name = append(name[:keyWidth-1], '…')
+		}
+		b.WriteString(fmt.Sprintf("%-*s %8d %8d %12d %12d %10s\n",
+			keyWidth, string(name), k.RequestsTotal, k.ErrorsTotal, k.PromptTokens, k.CompletionTokens, fmt.Sprintf("$%.4f", k.CostUSD)))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,364 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"charm.land/bubbles/v2/textinput"
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+	"llm-proxy/internal/api"
+	"llm-proxy/internal/client"
+)
+
+type playgroundModelsMsg struct {
+	models []client.Model
+	err    error
+}
+
+type playgroundDeltaMsg string
+
+type playgroundDoneMsg struct {
+	err error
+}
+
+type playgroundReplayMsg struct {
+	replay api.Replay
+	err    error
+}
+
+// ReplayFunc runs a logged request again on model, or its own model when
+// model is empty; see api.Server.Replay.
+type ReplayFunc func(ctx context.Context, id uint64, model string) (api.Replay, error)
+
+type playground struct {
+	client    *client.Client
+	models    []client.Model
+	modelIdx  int
+	loaded    bool
+	loadErr   string
+	input     textinput.Model
+	prompt    string
+	output    string
+	lastErr   string
+	streaming bool
+	stream    <-chan tea.Msg
+	cancel    context.CancelFunc
+	startedAt time.Time
+	elapsed   time.Duration
+
+	// A logged request picked to replay, and the last replay's result.
+	metrics    *api.Metrics
+	replayFn   ReplayFunc
+	replayFrom *api.RequestLogEntry
+	replaying  bool
+	replayed   *api.Replay
+}
+
+func newPlayground(baseURL string, apiKey string, metrics *api.Metrics, replay ReplayFunc) playground {
+	in := textinput.New()
+	in.Placeholder = "Type a prompt and press enter"
+	in.Prompt = "› "
+	c := client.New(baseURL)
+	c.APIKey = apiKey
+	return playground{
+		client:   c,
+		input:    in,
+		metrics:  metrics,
+		replayFn: replay,
+	}
+}
+
+func (p playground) selectedModel() string {
+	if len(p.models) == 0 {
+		return ""
+	}
+	return p.models[p.modelIdx].ID
+}
+
+func (p playground) loadModels() tea.Cmd {
+	c := p.client
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		models, err := c.ListModels(ctx)
+		return playgroundModelsMsg{models: models, err: err}
+	}
+}
+
+func (p playground) send() (playground, tea.Cmd) {
+	prompt := strings.TrimSpace(p.input.Value())
+	model := p.selectedModel()
+	if prompt == "" || model == "" || p.streaming || p.replaying {
+		return p, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan tea.Msg, 64)
+	c := p.client
+	go func() {
+		defer close(ch)
+		_, err := c.ChatStream(ctx, model, []client.Message{{Role: "user", Content: prompt}}, func(delta string) error {
+			select {
+			case ch <- playgroundDeltaMsg(delta):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		ch <- playgroundDoneMsg{err: err}
+	}()
+
+	p.prompt = prompt
+	p.replayed = nil
+	p.output = ""
+	p.lastErr = ""
+	p.streaming = true
+	p.stream = ch
+	p.cancel = cancel
+	p.startedAt = time.Now()
+	p.elapsed = 0
+	p.input.Reset()
+	return p, waitPlayground(ch)
+}
+
+// pickReplay selects the next older request in the log that can be
+// replayed, wrapping around to the newest.
+func (p playground) pickReplay() playground {
+	var entries []api.RequestLogEntry
+	for _, e := range p.metrics.RecentRequests(0) {
+		if e.Replayable {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		p.lastErr = "no logged request can be replayed yet"
+		return p
+	}
+	next := entries[0]
+	if p.replayFrom != nil {
+		for i, e := range entries {
+			if e.ID == p.replayFrom.ID && i+1 < len(entries) {
+				next = entries[i+1]
+			}
+		}
+	}
+	p.replayFrom = &next
+	p.lastErr = ""
+	return p
+}
+
+// replay runs the picked request again on the selected model.
+func (p playground) replay() (playground, tea.Cmd) {
+	if p.replayFrom == nil || p.replayFn == nil || p.streaming || p.replaying {
+		return p, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	id, model, replay := p.replayFrom.ID, p.selectedModel(), p.replayFn
+	p.replaying = true
+	p.replayed = nil
+	p.lastErr = ""
+	p.cancel = cancel
+	p.startedAt = time.Now()
+	p.elapsed = 0
+	return p, func() tea.Msg {
+		r, err := replay(ctx, id, model)
+		return playgroundReplayMsg{replay: r, err: err}
+	}
+}
+
+func waitPlayground(ch <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-ch
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+func (p playground) update(msg tea.Msg) (playground, tea.Cmd) {
+	switch msg := msg.(type) {
+	case playgroundModelsMsg:
+		p.loaded = true
+		p.loadErr = ""
+		if msg.err != nil {
+			p.loadErr = msg.err.Error()
+			return p, nil
+		}
+		current := p.selectedModel()
+		p.models = msg.models
+		p.modelIdx = 0
+		for i, m := range p.models {
+			if m.ID == current {
+				p.modelIdx = i
+			}
+		}
+		return p, nil
+	case playgroundDeltaMsg:
+		p.output += string(msg)
+		p.elapsed = time.Since(p.startedAt)
+		return p, waitPlayground(p.stream)
+	case playgroundDoneMsg:
+		if msg.err != nil && msg.err != context.Canceled {
+			p.lastErr = msg.err.Error()
+		}
+		p.streaming = false
+		p.elapsed = time.Since(p.startedAt)
+		if p.cancel != nil {
+			p.cancel()
+			p.cancel = nil
+		}
+		return p, nil
+	case playgroundReplayMsg:
+		if msg.err != nil && msg.err != context.Canceled {
+			p.lastErr = msg.err.Error()
+		} else if msg.err == nil {
+			p.replayed = &msg.replay
+		}
+		p.replaying = false
+		p.elapsed = time.Since(p.startedAt)
+		if p.cancel != nil {
+			p.cancel()
+			p.cancel = nil
+		}
+		return p, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "enter":
+			return p.send()
+		case "esc":
+			if (p.streaming || p.replaying) && p.cancel != nil {
+				p.cancel()
+			}
+			return p, nil
+		case "ctrl+l":
+			if !p.replaying {
+				p = p.pickReplay()
+			}
+			return p, nil
+		case "ctrl+o":
+			return p.replay()
+		case "up":
+			if len(p.models) > 0 && !p.streaming {
+				p.modelIdx = (p.modelIdx - 1 + len(p.models)) % len(p.models)
+			}
+			return p, nil
+		case "down":
+			if len(p.models) > 0 && !p.streaming {
+				p.modelIdx = (p.modelIdx + 1) % len(p.models)
+			}
+			return p, nil
+		case "ctrl+r":
+			return p, p.loadModels()
+		}
+	}
+	var cmd tea.Cmd
+	p.input, cmd = p.input.Update(msg)
+	return p, cmd
+}
+
+func (p playground) view(width, height int, label, value, sectionTitle, errStyle lipgloss.Style) string {
+	modelText := "loading…"
+	switch {
+	case p.loadErr != "":
+		modelText = "unavailable"
+	case p.loaded && len(p.models) == 0:
+		modelText = "no models"
+	case len(p.models) > 0:
+		m := p.models[p.modelIdx]
+		modelText = fmt.Sprintf("%s (%s)  [%d/%d]", m.ID, m.OwnedBy, p.modelIdx+1, len(p.models))
+	}
+
+	state := "idle"
+	switch {
+	case p.streaming:
+		state = "streaming"
+	case p.replaying:
+		state = "replaying"
+	}
+	if p.elapsed > 0 {
+		state = fmt.Sprintf("%s  %s  %d chars", state, p.elapsed.Truncate(100*time.Millisecond), len([]rune(p.output)))
+	}
+
+	lines := []string{
+		sectionTitle.Render("Playground"),
+		fmt.Sprintf("%s %s", label.Render("Endpoint:"), value.Render(p.client.BaseURL+"/v1/chat/completions")),
+		fmt.Sprintf("%s %s", label.Render("Model:"), value.Render(modelText)),
+		fmt.Sprintf("%s %s", label.Render("State:"), value.Render(state)),
+	}
+	if p.replayFrom != nil {
+		e := p.replayFrom
+		lines = append(lines, fmt.Sprintf("%s %s", label.Render("Replay:"), value.Render(fmt.Sprintf("#%d %s %s (%d) at %s", e.ID, e.Path, e.Model, e.Status, e.Time.Format("15:04:05")))))
+	}
+	if p.loadErr != "" {
+		lines = append(lines, errStyle.Render("Model list error: "+p.loadErr))
+	}
+	lines = append(lines, "", p.input.View(), "")
+	text := p.output
+	if p.replayed != nil {
+		text = renderReplay(*p.replayed)
+	} else if p.prompt != "" {
+		lines = append(lines, label.Render("Prompt: ")+value.Render(p.prompt))
+	}
+
+	outWidth := 76
+	if width > 6 {
+		outWidth = width - 6
+	}
+	output := lipgloss.NewStyle().Width(outWidth).Render(text)
+	outLines := strings.Split(output, "\n")
+	maxLines := 12
+	if height > 0 {
+		maxLines = height - len(lines) - 14
+		if maxLines < 3 {
+			maxLines = 3
+		}
+	}
+	switch {
+	case len(outLines) <= maxLines:
+	case p.replayed != nil:
+		// A replay is read from the top.
+		outLines = outLines[:maxLines]
+	default:
+		outLines = outLines[len(outLines)-maxLines:]
+	}
+	lines = append(lines, value.Render(strings.Join(outLines, "\n")))
+	if p.lastErr != "" {
+		lines = append(lines, errStyle.Render("Error: "+p.lastErr))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// renderReplay heads the original and replayed runs and shows the replay's
+// output as a word diff against the original: words it dropped struck out
+// in red, words it added in green.
+func renderReplay(r api.Replay) string {
+	deletedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#f38ba8")).Strikethrough(true)
+	insertedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#a6e3a1"))
+	head := func(title string, run api.ReplayRun) string {
+		line := fmt.Sprintf("%s: %s (%d, %s)", title, run.Model, run.Status, time.Duration(run.LatencyMs*float64(time.Millisecond)).Truncate(100*time.Millisecond))
+		if run.Error != "" {
+			line += "  error: " + run.Error
+		}
+		return line
+	}
+	deleted, inserted := api.DiffChanged(r.Diff)
+	var diff strings.Builder
+	for _, op := range r.Diff {
+		switch op.Op {
+		case api.DiffDelete:
+			diff.WriteString(deletedStyle.Render(op.Text))
+		case api.DiffInsert:
+			diff.WriteString(insertedStyle.Render(op.Text))
+		default:
+			diff.WriteString(op.Text)
+		}
+	}
+	summary := "outputs match"
+	if deleted > 0 || inserted > 0 {
+		summary = fmt.Sprintf("%s, %s", deletedStyle.Render(fmt.Sprintf("-%d words", deleted)), insertedStyle.Render(fmt.Sprintf("+%d words", inserted)))
+	}
+	return strings.Join([]string{head("Original", r.Original), head("Replay", r.Replay), summary, "", diff.String()}, "\n")
+}
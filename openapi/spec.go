@@ -0,0 +1,8 @@
+// Package openapi holds the proxy's OpenAPI document, which
+// internal/openapiv1 is generated from and /openapi.json serves.
+package openapi
+
+import _ "embed"
+
+//go:embed openai.yaml
+var YAML []byte